@@ -0,0 +1,133 @@
+// cmd/goapp/api_key.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/postgres"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+const (
+	apiKeyTenantFlagKey    = "tenant"
+	apiKeyNameFlagKey      = "name"
+	apiKeyScopesFlagKey    = "scopes"
+	apiKeyExpiresInFlagKey = "expires-in"
+)
+
+var apiKeyCmd = &cobra.Command{
+	Use:   "api-key",
+	Short: "Manage API keys for machine clients",
+}
+
+// 最初のキー (api-keys:write を持つキー) は API から発行できないため, このコマンドで発行する
+var apiKeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Issue a new API key and print it once",
+	RunE:  runAPIKeyCreateE,
+}
+
+func init() {
+	f := apiKeyCreateCmd.Flags()
+	f.String(apiKeyTenantFlagKey, models.DefaultTenantID.String(), "tenant ID of the key")
+	f.String(apiKeyNameFlagKey, "", "name of the key")
+	f.StringSlice(apiKeyScopesFlagKey, []string{string(models.APIKeyScopeAPIKeysWrite)}, "scopes of the key (e.g. users:read,api-keys:write)")
+	f.Duration(apiKeyExpiresInFlagKey, 0, "lifetime of the key (0 means no expiry)")
+	apiKeyCreateCmd.MarkFlagRequired(apiKeyNameFlagKey)
+
+	apiKeyCmd.AddCommand(apiKeyCreateCmd)
+	rootCmd.AddCommand(apiKeyCmd)
+}
+
+func runAPIKeyCreateE(cmd *cobra.Command, args []string) error {
+
+	f := cmd.Flags()
+	tenant, _ := f.GetString(apiKeyTenantFlagKey)
+	name, _ := f.GetString(apiKeyNameFlagKey)
+	scopes, _ := f.GetStringSlice(apiKeyScopesFlagKey)
+	expiresIn, _ := f.GetDuration(apiKeyExpiresInFlagKey)
+
+	tenantID, err := uuid.Parse(tenant)
+	if err != nil {
+		return cerrors.ErrValidation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("invalid tenant id: %s", tenant),
+		)
+	}
+	if expiresIn < 0 {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid expires-in: %s", expiresIn),
+		)
+	}
+
+	prototype := &models.APIKeyPrototype{Name: name}
+	for _, scope := range scopes {
+		if !models.APIKeyScope(scope).Valid() {
+			return cerrors.ErrValidation.New(
+				cerrors.WithMessagef("invalid scope: %s", scope),
+			)
+		}
+		prototype.Scopes = append(prototype.Scopes, models.APIKeyScope(scope))
+	}
+	if expiresIn > 0 {
+		prototype.ExpiresAt = time.Now().Add(expiresIn)
+	}
+
+	ctx := logging.NewContext(context.Background(), logger)
+
+	// DB (PostgreSQL)
+	queryTracer, err := newPostgresQueryTracer()
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize postgres query tracer"),
+		)
+	}
+	dbPool, err := newPostgresPool(ctx, "primary", cfg.Postgres.Host, cfg.Postgres.Port, queryTracer)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize postgres connection"),
+		)
+	}
+	defer dbPool.Close()
+
+	dbHandler, err := postgres.NewHandler(dbPool)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize database handler"),
+		)
+	}
+	defer dbHandler.Close()
+
+	opsHandler, err := operations.NewHandler(dbHandler)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize operations handler"),
+		)
+	}
+
+	issued, err := opsHandler.IssueAPIKey(db.WithTenant(ctx, tenantID), nil, prototype)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to issue api key"),
+		)
+	}
+	logger.Info("api key issued", "api_key_id", issued.APIKey.ID, "tenant_id", tenantID, "prefix", issued.APIKey.Prefix)
+
+	// キーそのものはここでしか得られない
+	fmt.Fprintln(cmd.OutOrStdout(), issued.Secret)
+	return nil
+}
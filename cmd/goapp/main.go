@@ -2,7 +2,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -22,7 +21,6 @@ import (
 	"time"
 
 	// HTTP Server
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
 	// Validator
@@ -38,42 +36,39 @@ import (
 
 	// Profiling (Pyroscope)
 	"github.com/grafana/pyroscope-go"
+	"github.com/grafana/pyroscope-go/upstream/remote"
 
 	// OpenMetrics (Prometheus)
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	// OpenTelemetry
-	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/log/global"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/log"
-	"go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
-
-	// Session Manager (Valkey)
-	"github.com/alexedwards/scs/redisstore"
-	"github.com/alexedwards/scs/v2"
+
+	// Valkey
 	"github.com/gomodule/redigo/redis"
 
 	//
 	"github.com/aazw/go-base/pkg/api"
-	"github.com/aazw/go-base/pkg/api/openapi"
 	"github.com/aazw/go-base/pkg/cerrors"
 	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/cache"
 	"github.com/aazw/go-base/pkg/db/postgres"
+	"github.com/aazw/go-base/pkg/db/resilient"
+	"github.com/aazw/go-base/pkg/events"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
 	"github.com/aazw/go-base/pkg/operations"
+	"github.com/aazw/go-base/pkg/resilience"
+	"github.com/aazw/go-base/pkg/webhooks"
 )
 
 var (
 	GoVersion  = "unknown"
 	MainModule = "unknown"
+
+	// アプリケーションのバージョン. ビルド時に -ldflags "-X main.Version=v1.2.3" で上書きする
+	Version = "unknown"
 )
 
 const (
@@ -84,9 +79,10 @@ const (
 )
 
 const (
-	logLevelFlagKey  string = "log_level"
-	logFormatFlagKey string = "log_format"
-	configFlagKey    string = "config"
+	logLevelFlagKey         string = "log_level"
+	logFormatFlagKey        string = "log_format"
+	logSamplingRatioFlagKey string = "log_sampling_ratio"
+	configFlagKey           string = "config"
 )
 
 var (
@@ -110,6 +106,9 @@ var handlerOptions = &slog.HandlerOptions{
 }
 var logger *slog.Logger
 
+// ローカル (stderr) 出力先. OTLP 有効時は logging.FanoutHandler で OTLP と併用する
+var localLogSink logging.Sink
+
 var tracer = otel.Tracer(appName)
 
 func init() {
@@ -117,6 +116,9 @@ func init() {
 	if info, ok := debug.ReadBuildInfo(); ok {
 		GoVersion = info.GoVersion  // 例: go1.21.0
 		MainModule = info.GoVersion // 例: github.com/aazw/go-base (devel)
+		if Version == "unknown" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			Version = info.Main.Version // go install ...@v1.2.3 でビルドされた場合
+		}
 	}
 
 	// gin
@@ -128,6 +130,7 @@ func init() {
 	// CLIフラグ
 	f.String(logLevelFlagKey, "info", "log level = (info|debug)")
 	f.String(logFormatFlagKey, "text", "log format = (text|json)")
+	f.Float64(logSamplingRatioFlagKey, 1.0, "ratio of logs below WARN to output = (0.0-1.0)")
 	f.StringP(configFlagKey, "c", "", "Config file path")
 
 	// 環境変数も取り込む
@@ -136,13 +139,15 @@ func init() {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
 	// 明示的な BindEnv
-	viper.BindEnv(configFlagKey, envVarPrefix+"_CONFIG")        // GOAPP_CONFIG → config
-	viper.BindEnv(logLevelFlagKey, envVarPrefix+"_LOG_LEVEL")   // GOAPP_LOG_LEVEL → log_level
-	viper.BindEnv(logFormatFlagKey, envVarPrefix+"_LOG_FORMAT") // GOAPP_LOG_FORMAT → log_format
+	viper.BindEnv(configFlagKey, envVarPrefix+"_CONFIG")                       // GOAPP_CONFIG → config
+	viper.BindEnv(logLevelFlagKey, envVarPrefix+"_LOG_LEVEL")                  // GOAPP_LOG_LEVEL → log_level
+	viper.BindEnv(logFormatFlagKey, envVarPrefix+"_LOG_FORMAT")                // GOAPP_LOG_FORMAT → log_format
+	viper.BindEnv(logSamplingRatioFlagKey, envVarPrefix+"_LOG_SAMPLING_RATIO") // GOAPP_LOG_SAMPLING_RATIO → log_sampling_ratio
 
 	// フラグと viper のバインド
 	viper.BindPFlag(logLevelFlagKey, f.Lookup(logLevelFlagKey))
 	viper.BindPFlag(logFormatFlagKey, f.Lookup(logFormatFlagKey))
+	viper.BindPFlag(logSamplingRatioFlagKey, f.Lookup(logSamplingRatioFlagKey))
 	viper.BindPFlag(configFlagKey, f.Lookup(configFlagKey))
 }
 
@@ -180,7 +185,21 @@ func initConfig() error {
 			cerrors.WithMessagef("invalid log format: %s", logFormat),
 		)
 	}
-	logger = slog.New(handler)
+
+	// log sampling
+	logSamplingRatio := viper.GetFloat64(logSamplingRatioFlagKey)
+	if logSamplingRatio < 0 || logSamplingRatio > 1 {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid log sampling ratio: %v", logSamplingRatio),
+		)
+	}
+
+	localLogSink = logging.Sink{
+		Handler:       handler,
+		SamplingRatio: logSamplingRatio,
+	}
+	logger = slog.New(logging.NewFanoutHandler(localLogSink))
+	slog.SetDefault(logger) // logging.FromContext のフォールバック先
 
 	// config
 	cfg = config.NewConfig()
@@ -279,89 +298,154 @@ func runE(cmd *cobra.Command, args []string) (err error) {
 
 	ctx := context.Background()
 
-	// DB (PostgreSQL)
-	dbPool, err := newPostgresPool(ctx)
-	if err != nil {
-		return cerrors.AppendCheckpoint(
-			err,
-			cerrors.WithCheckpointMessage("failed to initialize postgres connection"),
-		)
+	// OpenTelemetry
+	// logger を OTLP にも送るものに置き換えるため, logger を使うストレージやバックグラウンドの処理より前に置く
+	if cfg.OTLPTrace.Enabled || cfg.OTLPMetric.Enabled || cfg.OTLPLog.Enabled {
+		otelShutdown, err := setupOTelSDK(ctx)
+		if err != nil {
+			return cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize OpenTelemetry SDK"),
+			)
+		}
+		defer func() {
+			err = errors.Join(err, otelShutdown(context.Background()))
+		}()
 	}
-	defer func() {
-		dbPool.Close()
-		logger.Info("postgres connection closed normally")
-	}()
 
-	dbHandler, err := postgres.NewHandler(dbPool)
+	// Storage (PostgreSQL + Valkey, or memory)
+	storageKind := viper.GetString(storageFlagKey)
+	st, err := newStorage(ctx, storageKind)
 	if err != nil {
 		return cerrors.AppendCheckpoint(
 			err,
-			cerrors.WithCheckpointMessage("failed to initialize database handler"),
+			cerrors.WithCheckpointMessagef("failed to initialize storage: %s", storageKind),
 		)
 	}
+	defer st.Close()
+	if st.redisPool == nil {
+		logger.Warn("running without postgres and valkey. data is kept in memory and lost on exit", "storage", storageKind)
+	}
 
-	opsHander, err := operations.NewHandler(dbHandler)
-	if err != nil {
-		return cerrors.AppendCheckpoint(
-			err,
-			cerrors.WithCheckpointMessage("failed to initialize API handler"),
-		)
+	// Circuit breakers & bulkheads (PostgreSQL)
+	// API からの呼び出しだけを守る. outbox relay と webhook deliverer は自身の間隔で再試行する
+	usersHandler := st.dbHandler
+	if st.postgresGuard != nil {
+		usersHandler, err = resilient.NewHandler(st.dbHandler, st.postgresGuard)
+		if err != nil {
+			return cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize resilient database handler"),
+			)
+		}
+	}
+
+	// User Cache (Valkey)
+	if cfg.UserCache.Enabled && st.redisPool == nil {
+		logger.Warn("user cache is enabled but valkey is not available. the cache is disabled", "storage", storageKind)
+	} else if cfg.UserCache.Enabled {
+		userCache, err := newUserCache(usersHandler, st.redisPool, st.valkeyGuard)
+		if err != nil {
+			return cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize user cache"),
+			)
+		}
+		usersHandler = userCache
+
+		userCacheCtx, cancelUserCache := context.WithCancel(logging.NewContext(ctx, logger))
+		userCacheDone := make(chan struct{})
+		go func() {
+			defer close(userCacheDone)
+			_ = userCache.Run(userCacheCtx)
+		}()
+		defer func() {
+			cancelUserCache()
+			<-userCacheDone
+		}()
 	}
 
-	// Valkey/Redis
-	redisPool, err := newValkeyPool(ctx)
+	opsHander, err := operations.NewHandler(usersHandler, operations.WithWebhookURLPolicy(webhookURLPolicy()))
 	if err != nil {
 		return cerrors.AppendCheckpoint(
 			err,
-			cerrors.WithCheckpointMessage("failed to initialize redis connection"),
+			cerrors.WithCheckpointMessage("failed to initialize API handler"),
 		)
 	}
-	defer func() {
-		if err := redisPool.Close(); err != nil {
-			logger.Info("valkey connection closure failed")
-			return
+
+	// HTTP Metrics (Prometheus / OTel)
+	if cfg.Prometheus.Enabled || cfg.OTLPMetric.Enabled {
+		err = newHTTPMetrics(ctx)
+		if err != nil {
+			return cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize metrics"),
+			)
 		}
-		logger.Info("valkey connection closed normally")
-	}()
+	}
 
-	// OpenTelemetry
-	if cfg.OTLPTrace.Enabled || cfg.OTLPMetric.Enabled || cfg.OTLPLog.Enabled {
-		otelShutdown, err := setupOTelSDK(ctx)
+	// Profiling (Pyroscope)
+	if cfg.Pyroscope.Enabled {
+		stopProfiler, err := newProfiler()
 		if err != nil {
 			return cerrors.AppendCheckpoint(
 				err,
-				cerrors.WithCheckpointMessage("failed to initialize OpenTelemetry SDK"),
+				cerrors.WithCheckpointMessage("failed to initialize profiler"),
 			)
 		}
 		defer func() {
-			err = errors.Join(err, otelShutdown(context.Background()))
+			stopProfiler()
+			logger.Info("profiler stopped normally")
 		}()
 	}
 
-	// Prometheus
-	if cfg.Prometheus.Enabled {
-		err = newPrometheus(ctx)
+	// Outbox Relay
+	if cfg.Outbox.RelayEnabled {
+		relay, err := newOutboxRelay(st.dbHandler, st.redisPool)
 		if err != nil {
 			return cerrors.AppendCheckpoint(
 				err,
-				cerrors.WithCheckpointMessage("failed to initialize metrics"),
+				cerrors.WithCheckpointMessage("failed to initialize outbox relay"),
 			)
 		}
+		relayCtx, cancelRelay := context.WithCancel(logging.NewContext(ctx, logger))
+		relayDone := make(chan struct{})
+		go func() {
+			defer close(relayDone)
+			_ = relay.Run(relayCtx)
+		}()
+		defer func() {
+			cancelRelay()
+			<-relayDone
+		}()
 	}
 
-	// Profiling (Pyroscope)
-	if cfg.Pyroscope.Enabled {
-		err = newProfiler()
+	// Webhooks
+	if cfg.Webhooks.Enabled {
+		if !cfg.Outbox.RelayEnabled {
+			logger.Warn("webhooks are enabled but the outbox relay is disabled. new events are not enqueued for delivery in this process")
+		}
+		deliverer, err := newWebhookDeliverer(st.dbHandler)
 		if err != nil {
 			return cerrors.AppendCheckpoint(
 				err,
-				cerrors.WithCheckpointMessage("failed to initialize profiler"),
+				cerrors.WithCheckpointMessage("failed to initialize webhook deliverer"),
 			)
 		}
+		delivererCtx, cancelDeliverer := context.WithCancel(logging.NewContext(ctx, logger))
+		delivererDone := make(chan struct{})
+		go func() {
+			defer close(delivererDone)
+			_ = deliverer.Run(delivererCtx)
+		}()
+		defer func() {
+			cancelDeliverer()
+			<-delivererDone
+		}()
 	}
 
-	// Session Manager (Valkey)
-	sessionManager, err := initSessionManager(redisPool)
+	// Session Manager (Valkey, or memory)
+	sessionManager, err := api.NewSessionManager(cfg.Session, st.sessionStore)
 	if err != nil {
 		return cerrors.AppendCheckpoint(
 			err,
@@ -370,27 +454,23 @@ func runE(cmd *cobra.Command, args []string) (err error) {
 	}
 
 	// Gin
-	router, err := setupRouter(sessionManager)
-	if err != nil {
-		return cerrors.AppendCheckpoint(
-			err,
-			cerrors.WithCheckpointMessage("failed to initialize router"),
-		)
+	routerOptions := []api.RouterOption{
+		api.WithServiceName(appName),
+		api.WithLogger(logger),
+		api.WithTracer(tracer),
+		api.WithHealthCheckers(st.healthCheckers...),
+		api.WithSessionIndex(st.sessionIndex),
 	}
-
-	// Add openapi handler
-	problemDetailsRenderer, err := api.NewProblemDetailsRenderer("https://example.com/", logger, tracer)
+	if httpMetrics != nil {
+		routerOptions = append(routerOptions, api.WithHTTPMetrics(httpMetrics))
+	}
+	router, err := api.NewRouter(cfg, opsHander, sessionManager, routerOptions...)
 	if err != nil {
 		return cerrors.AppendCheckpoint(
 			err,
-			cerrors.WithCheckpointMessage("failed to initialize problem details renderer"),
+			cerrors.WithCheckpointMessage("failed to initialize router"),
 		)
 	}
-	router.Use(problemDetailsRenderer.Middleware())
-
-	serverImpl := api.NewStrictServerImpl(opsHander, dbPool, redisPool, sessionManager)
-	handler := openapi.NewStrictHandler(serverImpl, nil)
-	openapi.RegisterHandlers(router, handler)
 
 	// Run with Graceful Shutdown
 	hostport := net.JoinHostPort(cfg.Server.Host, strconv.Itoa(int(cfg.Server.Port)))
@@ -451,12 +531,199 @@ func runE(cmd *cobra.Command, args []string) (err error) {
 	}
 }
 
+// Outbox
+// newOutboxRelay は設定で有効にした sink に配信する relay を生成する. redisPool が nil の場合は Valkey の sink を使わない
+func newOutboxRelay(dbHandler db.Handler, redisPool *redis.Pool) (*events.Relay, error) {
+
+	sinks := events.MultiSink{}
+	if cfg.Outbox.Sinks.Stdout.Enabled {
+		sink, err := events.NewStdoutSink(os.Stdout)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Outbox.Sinks.Valkey.Enabled && redisPool == nil {
+		logger.Warn("valkey sink is enabled but valkey is not available. the sink is disabled")
+	} else if cfg.Outbox.Sinks.Valkey.Enabled {
+		sink, err := events.NewValkeySink(redisPool, cfg.Outbox.Sinks.Valkey.Stream, cfg.Outbox.Sinks.Valkey.MaxLen)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Outbox.Sinks.Webhook.Enabled {
+		sink, err := events.NewWebhookSink(
+			cfg.Outbox.Sinks.Webhook.URL,
+			cfg.Outbox.Sinks.Webhook.Headers,
+			time.Duration(cfg.Outbox.Sinks.Webhook.TimeoutSeconds)*time.Second,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Webhooks.Enabled {
+		sink, err := webhooks.NewDispatcher(dbHandler)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("outbox relay is enabled but no sink is enabled"),
+		)
+	}
+
+	var sink events.Sink = sinks
+	if len(sinks) == 1 {
+		sink = sinks[0]
+	}
+	return events.NewRelay(dbHandler, sink, events.RelayConfig{
+		PollInterval: time.Duration(cfg.Outbox.PollIntervalMilliseconds) * time.Millisecond,
+		BatchSize:    cfg.Outbox.BatchSize,
+		Lease:        time.Duration(cfg.Outbox.LeaseSeconds) * time.Second,
+		RetryPolicy: models.RetryPolicy{
+			MaxAttempts:    cfg.Outbox.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Outbox.InitialBackoffSeconds) * time.Second,
+			MaxBackoff:     time.Duration(cfg.Outbox.MaxBackoffSeconds) * time.Second,
+		},
+	})
+}
+
+// User Cache
+// newUserCache は GetUser の結果を Valkey にキャッシュする db.Handler を生成する. guard が nil でなければ Valkey の呼び出しを guard で守る
+func newUserCache(dbHandler db.Handler, redisPool *redis.Pool, guard *resilience.Guard) (*cache.Handler, error) {
+
+	valkeyStore, err := cache.NewValkeyStore(redisPool)
+	if err != nil {
+		return nil, err
+	}
+	var store cache.Store = valkeyStore
+	if guard != nil {
+		store, err = resilient.NewStore(valkeyStore, guard)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metrics, err := cache.NewMetrics(appName)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Prometheus.Enabled {
+		prometheus.MustRegister(metrics)
+	}
+
+	return cache.NewHandler(dbHandler, store, cache.Config{
+		KeyPrefix:           cfg.UserCache.KeyPrefix,
+		TTL:                 time.Duration(cfg.UserCache.TTLSeconds) * time.Second,
+		TTLJitter:           time.Duration(cfg.UserCache.TTLJitterSeconds) * time.Second,
+		NegativeTTL:         time.Duration(cfg.UserCache.NegativeTTLSeconds) * time.Second,
+		InvalidationDelay:   time.Duration(cfg.UserCache.InvalidationDelayMilliseconds) * time.Millisecond,
+		LocalSize:           cfg.UserCache.LocalSize,
+		LocalTTL:            time.Duration(cfg.UserCache.LocalTTLSeconds) * time.Second,
+		InvalidationChannel: cfg.UserCache.InvalidationChannel,
+	}, cache.WithMetrics(metrics))
+}
+
+// Resilience
+// newResilienceGuards は PostgreSQL と Valkey の呼び出しを守る Guard を生成する. サーキットブレーカーとバルクヘッドを共に無効にした依存先は nil
+func newResilienceGuards() (postgresGuard *resilience.Guard, valkeyGuard *resilience.Guard, err error) {
+
+	metrics, err := resilience.NewMetrics(appName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	postgresGuard, err = newResilienceGuard("postgres", cfg.Resilience.Postgres, metrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	valkeyGuard, err = newResilienceGuard("valkey", cfg.Resilience.Valkey, metrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Prometheus.Enabled && (postgresGuard != nil || valkeyGuard != nil) {
+		prometheus.MustRegister(metrics)
+	}
+	return postgresGuard, valkeyGuard, nil
+}
+
+func newResilienceGuard(name string, dependency config.ResilienceDependency, metrics *resilience.Metrics) (*resilience.Guard, error) {
+
+	var guardConfig resilience.Config
+	if breaker := dependency.CircuitBreaker; breaker.Enabled {
+		guardConfig.Breaker = &resilience.BreakerConfig{
+			Window:              time.Duration(breaker.WindowSeconds) * time.Second,
+			MinRequests:         int(breaker.MinRequests),
+			FailureRate:         float64(breaker.FailureRatePercent) / 100,
+			OpenDuration:        time.Duration(breaker.OpenSeconds) * time.Second,
+			HalfOpenMaxRequests: int(breaker.HalfOpenMaxRequests),
+		}
+	}
+	if bulkhead := dependency.Bulkhead; bulkhead.Enabled {
+		guardConfig.Bulkhead = &resilience.BulkheadConfig{
+			MaxConcurrent: bulkhead.MaxConcurrent,
+			MaxWait:       time.Duration(bulkhead.MaxWaitMilliseconds) * time.Millisecond,
+		}
+	}
+	if guardConfig.Breaker == nil && guardConfig.Bulkhead == nil {
+		return nil, nil
+	}
+	return resilience.NewGuard(name, guardConfig, resilience.WithMetrics(metrics))
+}
+
+// Webhooks
+// newWebhookDeliverer は登録された webhook への配信を行う deliverer を生成する
+func newWebhookDeliverer(dbHandler db.Handler) (*webhooks.Deliverer, error) {
+
+	return webhooks.NewDeliverer(dbHandler, webhooks.DelivererConfig{
+		PollInterval: time.Duration(cfg.Webhooks.PollIntervalMilliseconds) * time.Millisecond,
+		BatchSize:    cfg.Webhooks.BatchSize,
+		Timeout:      time.Duration(cfg.Webhooks.TimeoutSeconds) * time.Second,
+		Lease:        time.Duration(cfg.Webhooks.LeaseSeconds) * time.Second,
+		RetryPolicy: models.RetryPolicy{
+			MaxAttempts:    cfg.Webhooks.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Webhooks.InitialBackoffSeconds) * time.Second,
+			MaxBackoff:     time.Duration(cfg.Webhooks.MaxBackoffSeconds) * time.Second,
+		},
+		MaxConsecutiveFailures: cfg.Webhooks.MaxConsecutiveFailures,
+		URLPolicy:              webhookURLPolicy(),
+	})
+}
+
+// webhookURLPolicy は webhook の登録と送信で受け付ける配信先の条件を返す
+func webhookURLPolicy() webhooks.URLPolicy {
+	return webhooks.URLPolicy{
+		AllowHTTP:            cfg.Webhooks.AllowHTTP,
+		AllowPrivateNetworks: cfg.Webhooks.AllowPrivateNetworks,
+	}
+}
+
 // PostgreSQL
-func newPostgresPool(ctx context.Context) (*pgxpool.Pool, error) {
+// newPostgresQueryTracer はプライマリ/レプリカの全プールで共有する QueryTracer を生成する
+func newPostgresQueryTracer() (*postgres.QueryTracer, error) {
+
+	// tracing & metrics & slow query log
+	queryTracer, err := postgres.NewQueryTracer(appName, time.Duration(cfg.Postgres.SlowQueryThresholdMilliseconds)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Prometheus.Enabled {
+		prometheus.MustRegister(queryTracer)
+	}
+	return queryTracer, nil
+}
+
+// newPostgresPool は host:port へのプールを生成する. 認証情報やプールの設定はプライマリ/レプリカで共通
+// poolName はメトリクスのラベル (primary, replica-0 等)
+func newPostgresPool(ctx context.Context, poolName string, host string, port uint, queryTracer *postgres.QueryTracer) (*pgxpool.Pool, error) {
 
 	dsn := &url.URL{
 		Scheme: "postgresql",
-		Host:   net.JoinHostPort(cfg.Postgres.Host, strconv.Itoa(int(cfg.Postgres.Port))),
+		Host:   net.JoinHostPort(host, strconv.Itoa(int(port))),
 		Path:   path.Join("/", cfg.Postgres.Database),
 		RawQuery: url.Values{
 			"sslmode": []string{cfg.Postgres.SslMode},
@@ -477,6 +744,8 @@ func newPostgresPool(ctx context.Context) (*pgxpool.Pool, error) {
 	pgCfg.MaxConnLifetime = time.Duration(cfg.Postgres.MaxConnLifetimeSeconds) * time.Second
 	pgCfg.HealthCheckPeriod = time.Duration(cfg.Postgres.HealthCheckPeriodSeconds) * time.Second
 
+	pgCfg.ConnConfig.Tracer = queryTracer
+
 	dbPool, err := pgxpool.NewWithConfig(ctx, pgCfg)
 	if err != nil {
 		return nil, cerrors.ErrDBConnection.New(
@@ -485,6 +754,16 @@ func newPostgresPool(ctx context.Context) (*pgxpool.Pool, error) {
 		)
 	}
 
+	// pool stats
+	poolStats, err := postgres.NewPoolStatsCollector(appName, poolName, dbPool)
+	if err != nil {
+		dbPool.Close()
+		return nil, err
+	}
+	if cfg.Prometheus.Enabled {
+		prometheus.MustRegister(poolStats)
+	}
+
 	return dbPool, nil
 }
 
@@ -522,361 +801,124 @@ func newValkeyPool(_ context.Context) (*redis.Pool, error) {
 	return pool, nil
 }
 
-// https://opentelemetry.io/docs/languages/go/getting-started/#initialize-the-opentelemetry-sdk
-func setupOTelSDK(ctx context.Context) (func(context.Context) error, error) {
-	var shutdownFuncs []func(context.Context) error
-	shutdown := func(ctx context.Context) error {
-		var err error
-		for _, fn := range shutdownFuncs {
-			err = errors.Join(err, fn(ctx))
-		}
-		shutdownFuncs = nil
+// HTTP Metrics (Prometheus / OTel)
+var httpMetrics *api.HTTPMetrics
 
-		if err != nil {
-			return cerrors.ErrUnavailable.New(
-				cerrors.WithCause(err),
-				cerrors.WithMessage("failed to shutdown server"),
-			)
-		}
-		return nil
+func newHTTPMetrics(_ context.Context) error {
+	m, err := api.NewHTTPMetrics(appName)
+	if err != nil {
+		return err
+	}
+	if cfg.Prometheus.Enabled {
+		prometheus.MustRegister(m)
 	}
+	httpMetrics = m
 
-	// 内部ロガーをlog/slogに差し替え
-	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
-		logger.Error("opentelemetry export error", "error", err)
-	}))
+	return nil
+}
 
-	// Set up propagator
-	prop := newPropagator()
-	otel.SetTextMapPropagator(prop)
+// var pyroscopeLogger = pyroscope.StandardLogger
+var pyroscopeLogger = &PyroscopeCustomLogger{}
 
-	// Set up trace provider
-	if cfg.OTLPTrace.Enabled {
-		tracerProvider, err := newOTLPTracerProvider(ctx)
-		if err != nil {
-			return shutdown, errors.Join(err, shutdown(ctx))
-		}
-		shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
-		otel.SetTracerProvider(tracerProvider)
-	}
+// Grafana Pyroscope
+// pyroscope.Start では HTTP クライアント (TLS 設定) を差し替えられないため, uploader と session を個別に組み立てる
+func newProfiler() (func(), error) {
 
-	// Set up meter provider
-	if cfg.OTLPMetric.Enabled {
-		meterProvider, err := newOTLPMeterProvider(ctx)
-		if err != nil {
-			return shutdown, errors.Join(err, shutdown(ctx))
-		}
-		shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
-		otel.SetMeterProvider(meterProvider)
+	scheme := "https"
+	if cfg.Pyroscope.Insecure {
+		scheme = "http"
+	}
+	uri := &url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(cfg.Pyroscope.Host, strconv.Itoa(int(cfg.Pyroscope.Port))),
+	}
+	hostname, _ := os.Hostname()
+	tags := map[string]string{
+		"hostname": hostname,
+		"version":  Version,
 	}
+	if cfg.App.Environment != "" {
+		tags["environment"] = cfg.App.Environment
+	}
+
+	// mutex/block プロファイルのサンプリングレート. 0 の場合は無効
+	runtime.SetMutexProfileFraction(cfg.Pyroscope.MutexProfileFraction)
+	runtime.SetBlockProfileRate(cfg.Pyroscope.BlockProfileRate)
 
-	// Set up logger provider
-	if cfg.OTLPLog.Enabled {
-		loggerProvider, err := newOTLPLoggerProvider(ctx)
+	// HTTP クライアント
+	// リダイレクトで Authorization ヘッダが落ちるのを避けるため, SDK と同様にリダイレクトは追わない
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.Pyroscope.Insecure {
+		tlsConfig, err := newTLSClientConfig(cfg.Pyroscope.Host, cfg.Pyroscope.TLS)
 		if err != nil {
-			return shutdown, errors.Join(err, shutdown(ctx))
+			return nil, err
 		}
-		shutdownFuncs = append(shutdownFuncs, loggerProvider.Shutdown)
-		global.SetLoggerProvider(loggerProvider)
+		transport.TLSClientConfig = tlsConfig
 	}
-
-	return shutdown, nil
-}
-
-func newPropagator() propagation.TextMapPropagator {
-	return propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	)
-}
-
-// For Grafana Tempo
-func newOTLPTracerProvider(ctx context.Context) (*trace.TracerProvider, error) {
-	// https://pkg.go.dev/go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp#example-package
-
-	hostport := net.JoinHostPort(cfg.OTLPTrace.Host, strconv.Itoa(int(cfg.OTLPTrace.Port)))
-
-	// exporter
-	traceExporter, err := otlptracehttp.New(
-		ctx,
-		// https://pkg.go.dev/go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp@v1.35.0#Option
-		otlptracehttp.WithEndpoint(hostport),
-		otlptracehttp.WithInsecure(), // TLS なし
-	)
+	httpClient := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: 30 * time.Second,
+	}
+
+	uploader, err := remote.NewRemote(remote.Config{
+		Address:           uri.String(),
+		TenantID:          cfg.Pyroscope.TenantID,
+		BasicAuthUser:     cfg.Pyroscope.BasicAuthUser,
+		BasicAuthPassword: cfg.Pyroscope.BasicAuthPassword,
+		HTTPHeaders:       cfg.Pyroscope.Headers,
+		HTTPClient:        httpClient,
+		Threads:           5, // per each profile type upload
+		Timeout:           30 * time.Second,
+		Logger:            pyroscopeLogger,
+	})
 	if err != nil {
 		return nil, cerrors.ErrSystemInternal.New(
 			cerrors.WithCause(err),
-			cerrors.WithMessage("failed to create trace exporter"),
+			cerrors.WithMessage("failed to create pyroscope uploader"),
 		)
 	}
 
-	// provider
-	tracerProvider := trace.NewTracerProvider(
-		trace.WithBatcher(
-			traceExporter,
-			// Default is 5s. Set to 1s for demonstrative purposes.
-			trace.WithBatchTimeout(time.Second),
-		),
-		trace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(appName),
-		)),
-	)
-	return tracerProvider, nil
-}
+	profileTypes := make([]pyroscope.ProfileType, 0, len(cfg.Pyroscope.ProfileTypes))
+	for _, profileType := range cfg.Pyroscope.ProfileTypes {
+		profileTypes = append(profileTypes, pyroscope.ProfileType(profileType))
+	}
+	if len(profileTypes) == 0 {
+		profileTypes = pyroscope.DefaultProfileTypes
+	}
 
-// PrometheusによるPull用エンドポイントのための準備
-func newOTLPMeterProvider(ctx context.Context) (*metric.MeterProvider, error) {
+	session, err := pyroscope.NewSession(pyroscope.SessionConfig{
+		Upstream: uploader,
+		Logger:   pyroscopeLogger,
+		AppName:  appName,
 
-	hostport := net.JoinHostPort(cfg.OTLPMetric.Host, strconv.Itoa(int(cfg.OTLPMetric.Port)))
+		// you can provide static tags via a map:
+		Tags: tags,
 
-	// exporter
-	metricExporter, err := otlpmetrichttp.New(
-		ctx,
-		otlpmetrichttp.WithEndpoint(hostport),
-		otlpmetrichttp.WithInsecure(), // TLS なし
-	)
+		ProfilingTypes: profileTypes,
+		UploadRate:     time.Duration(cfg.Pyroscope.UploadRateSeconds) * time.Second, // 0 の場合は SDK のデフォルト
+	})
 	if err != nil {
 		return nil, cerrors.ErrSystemInternal.New(
 			cerrors.WithCause(err),
-			cerrors.WithMessage("failed to create metric exporter"),
+			cerrors.WithMessage("failed to create pyroscope session"),
 		)
 	}
 
-	// provider
-	meterProvider := metric.NewMeterProvider(
-		metric.WithReader(metric.NewPeriodicReader(metricExporter,
-			// Default is 1m. Set to 3s for demonstrative purposes.
-			metric.WithInterval(3*time.Second))),
-	)
-	return meterProvider, nil
-}
-
-func newOTLPLoggerProvider(ctx context.Context) (*log.LoggerProvider, error) {
-
-	hostport := net.JoinHostPort(cfg.OTLPLog.Host, strconv.Itoa(int(cfg.OTLPLog.Port)))
-
-	// exporter
-	logExporter, err := otlploghttp.New(
-		ctx,
-		otlploghttp.WithEndpoint(hostport),
-		otlploghttp.WithInsecure(), // TLS なし
-	)
-	if err != nil {
+	uploader.Start()
+	if err := session.Start(); err != nil {
+		uploader.Stop()
 		return nil, cerrors.ErrSystemInternal.New(
 			cerrors.WithCause(err),
-			cerrors.WithMessage("failed to create log exporter"),
+			cerrors.WithMessage("failed to start pyroscope session"),
 		)
 	}
 
-	// provider
-	loggerProvider := log.NewLoggerProvider(
-		log.WithProcessor(log.NewBatchProcessor(logExporter)),
-	)
-	return loggerProvider, nil
-}
-
-// Prometheus
-var httpRequests *prometheus.HistogramVec
-
-func newPrometheus(_ context.Context) error {
-	httpRequests = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Namespace: appName,
-			Subsystem: "http_server",
-			Name:      "request_duration_seconds",
-			Help:      "HTTP リクエストの処理に要した時間（秒）",
-			Buckets:   prometheus.DefBuckets,
-		},
-		[]string{"path", "method", "status"},
-	)
-	prometheus.MustRegister(httpRequests)
-
-	return nil
-}
-
-// var pyroscopeLogger = pyroscope.StandardLogger
-var pyroscopeLogger = &PyroscopeCustomLogger{}
-
-// Grafana Pyroscope
-func newProfiler() error {
-	uri := &url.URL{
-		Scheme: "http",
-		Host:   net.JoinHostPort(cfg.Pyroscope.Host, strconv.Itoa(int(cfg.Pyroscope.Port))),
-	}
-	hostname, _ := os.Hostname()
-
-	runtime.SetMutexProfileFraction(5)
-	runtime.SetBlockProfileRate(5)
-
-	pyroscope.Start(pyroscope.Config{
-		ApplicationName: appName,
-
-		// replace this with the address of pyroscope server
-		ServerAddress: uri.String(),
-
-		// you can disable logging by setting this to nil
-		Logger: pyroscopeLogger,
-
-		// you can provide static tags via a map:
-		Tags: map[string]string{
-			"hostname": hostname,
-		},
-
-		ProfileTypes: []pyroscope.ProfileType{
-			// these profile types are enabled by default:
-			pyroscope.ProfileCPU,
-			pyroscope.ProfileAllocObjects,
-			pyroscope.ProfileAllocSpace,
-			pyroscope.ProfileInuseObjects,
-			pyroscope.ProfileInuseSpace,
-
-			// these profile types are optional:
-			pyroscope.ProfileGoroutines,
-			pyroscope.ProfileMutexCount,
-			pyroscope.ProfileMutexDuration,
-			pyroscope.ProfileBlockCount,
-			pyroscope.ProfileBlockDuration,
-		},
-	})
-
-	return nil
-}
-
-// Session manager
-func initSessionManager(pool *redis.Pool) (*scs.SessionManager, error) {
-
-	sessionManager := scs.New()
-	sessionManager.Store = redisstore.New(pool)
-
-	return sessionManager, nil
-}
-
-// Gin
-func setupRouter(sessionManager *scs.SessionManager) (*gin.Engine, error) {
-
-	// https://github.com/gin-gonic/gin/blob/v1.10.0/gin.go#L224C2-L224C34
-	// gin.Default()内では、engine.Use(Logger(), Recovery()) を読んでいる. gin.Logger()が先.
-	// router := gin.Default()
-	router := gin.New()
-
-	// Custom gin logger for Access Log
-	// https://github.com/gin-gonic/gin/blob/v1.10.0/logger.go#L212-L281
-	// https://github.com/gin-gonic/gin/blob/v1.10.0/logger.go#L196-L200
-	// https://github.com/gin-gonic/gin/blob/v1.10.0/logger.go#L60
-	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		// ↓デフォルト実装
-		// https://github.com/gin-gonic/gin/blob/v1.10.0/logger.go#L141-L161
-
-		if param.Latency > time.Minute {
-			param.Latency = param.Latency.Truncate(time.Second)
-		}
-
-		// log/slogで出力する
-		logFormat := viper.GetString(logFormatFlagKey)
-		var buf bytes.Buffer
-		var handler slog.Handler
-		switch strings.ToLower(logFormat) {
-		case "text":
-			handler = slog.NewTextHandler(&buf, handlerOptions)
-		case "json":
-			handler = slog.NewJSONHandler(&buf, handlerOptions)
-		}
-		logger := slog.New(handler)
-
-		// https://github.com/gin-gonic/gin/blob/v1.10.0/logger.go#L152-L160
-		args := []any{
-			// "%v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s"
-			"access_timestamp", param.TimeStamp.Format(time.RFC3339Nano),
-			"status_code", param.StatusCode,
-			"latency", param.Latency,
-			"client_ip", param.ClientIP,
-			"method", param.Method,
-			"path", param.Path,
-		}
-		if param.ErrorMessage != "" {
-			args = append(args, "error_message", param.ErrorMessage)
-		}
-
-		logger.Info("gin access log", args...)
-		return buf.String()
-	}))
-
-	// Default recovery
-	router.Use(gin.Recovery())
-
-	// rate limiter
-	if cfg.Server.RateLimit.Enabled {
-		router.Use(api.RateLimiter(1, 5))
-	}
-
-	// max request tize
-	if cfg.Server.MaxRequestSize <= 0 {
-		sizeLimiter, err := api.NewRequestSizeLimiter("https://example.com/", logger)
-		if err != nil {
-			return nil, cerrors.ErrSystemInternal.New(
-				cerrors.WithCause(err),
-				cerrors.WithMessage("failed to init request size limiter"),
-			)
-		}
-		router.Use(sizeLimiter.Middleware(cfg.Server.MaxRequestSize))
-	}
-
-	// Tracing middleware
-	if cfg.OTLPTrace.Enabled || cfg.OTLPMetric.Enabled || cfg.OTLPLog.Enabled {
-		router.Use(otelgin.Middleware(appName))
+	stop := func() {
+		session.Stop()
+		uploader.Stop()
 	}
-
-	// Prometheus middleware
-	if cfg.Prometheus.Enabled {
-		// Custom Metrics
-		router.Use(func(c *gin.Context) {
-			start := time.Now()
-			c.Next()
-			duration := time.Since(start).Seconds()
-			status := fmt.Sprint(c.Writer.Status())
-			httpRequests.WithLabelValues(c.FullPath(), c.Request.Method, status).Observe(duration)
-		})
-
-		// Metrics Endpoint: (Prometheus)
-		router.GET(cfg.Prometheus.MetricsPath, gin.WrapH(promhttp.Handler()))
-	}
-
-	// add Custom Headers
-	if len(cfg.Server.CustomHeaders) > 0 {
-		router.Use(func(c *gin.Context) {
-			for _, customHeader := range cfg.Server.CustomHeaders {
-				if customHeader.Enabled && customHeader.Name != "" && customHeader.Value != "" {
-					responseHeader := c.Writer.Header()
-					if _, ok := responseHeader[customHeader.Name]; ok {
-						if customHeader.Override {
-							c.Header(customHeader.Name, customHeader.Value)
-						}
-					} else {
-						c.Header(customHeader.Name, customHeader.Value)
-					}
-				}
-			}
-			c.Next()
-		})
-	}
-
-	// Session Load
-	// designed by https://github.com/alexedwards/scs/blob/v2.8.0/session.go#L132
-	router.Use(SessionLoadAndSave(sessionManager))
-
-	// CORS
-	if cfg.Server.CORS.Enabled {
-		// https://github.com/gin-contrib/cors
-		router.Use(cors.New(cors.Config{
-			AllowOrigins:     cfg.Server.CORS.AllowOrigins,
-			AllowMethods:     cfg.Server.CORS.AllowMethods,
-			AllowHeaders:     cfg.Server.CORS.AllowHeaders,
-			ExposeHeaders:    cfg.Server.CORS.ExposeHeaders,
-			AllowCredentials: cfg.Server.CORS.AllowCredentials,
-			MaxAge:           time.Hour * time.Duration(cfg.Server.CORS.MaxAgeHour),
-		}))
-	}
-
-	return router, nil
+	return stop, nil
 }
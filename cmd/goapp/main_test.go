@@ -1 +1,168 @@
 package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/aazw/go-base/pkg/config"
+)
+
+// OTLP/HTTP のレシーバーのスタブ. 受け取ったリクエストを記録するだけで 200 を返す
+type otlpReceiverStub struct {
+	requests chan *http.Request
+}
+
+func newOTLPReceiverStub(t *testing.T) (*otlpReceiverStub, string, uint) {
+	t.Helper()
+
+	stub := &otlpReceiverStub{requests: make(chan *http.Request, 16)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.requests <- r.Clone(context.Background())
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portStr, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub, host, uint(port)
+}
+
+func TestNewOTLPTracerProvider_ExportsToReceiver(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_TRACES_SAMPLER", "")
+
+	stub, host, port := newOTLPReceiverStub(t)
+
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.OTLPTrace = config.OTLPTrace{
+		OTLPExporter: config.OTLPExporter{
+			Enabled:     true,
+			Host:        host,
+			Port:        port,
+			Protocol:    "http/protobuf",
+			URLPath:     "/custom/v1/traces",
+			Insecure:    true,
+			Headers:     map[string]string{"X-Scope-OrgID": "tenant-a"},
+			Compression: "gzip",
+		},
+		SamplingRatio: 1.0,
+	}
+
+	ctx := context.Background()
+	res, err := newResource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := newOTLPTracerProvider(ctx, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	_, span := tp.Tracer("test").Start(ctx, "test-span")
+	span.End()
+	if err := tp.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-stub.requests:
+		if r.URL.Path != "/custom/v1/traces" {
+			t.Errorf("path = %q, want %q", r.URL.Path, "/custom/v1/traces")
+		}
+		if got := r.Header.Get("X-Scope-OrgID"); got != "tenant-a" {
+			t.Errorf("X-Scope-OrgID = %q, want %q", got, "tenant-a")
+		}
+		if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("Content-Encoding = %q, want %q", got, "gzip")
+		}
+	default:
+		t.Fatal("receiver did not get any export request")
+	}
+}
+
+func TestNewOTLPTracerProvider_SamplingRatioZero(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_TRACES_SAMPLER", "")
+
+	stub, host, port := newOTLPReceiverStub(t)
+
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.OTLPTrace = config.OTLPTrace{
+		OTLPExporter: config.OTLPExporter{
+			Enabled:  true,
+			Host:     host,
+			Port:     port,
+			Insecure: true,
+		},
+		SamplingRatio: 0,
+	}
+
+	ctx := context.Background()
+	res, err := newResource(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp, err := newOTLPTracerProvider(ctx, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	_, span := tp.Tracer("test").Start(ctx, "test-span")
+	if span.SpanContext().IsSampled() {
+		t.Error("root span should not be sampled when sampling_ratio is 0")
+	}
+	span.End()
+	if err := tp.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-stub.requests:
+		t.Error("receiver should not get any export request")
+	default:
+	}
+}
+
+func TestResolveOTLPExporter_EnvEndpointWins(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "https://collector.example.com:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", "grpc")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "")
+
+	settings, err := resolveOTLPExporter("LOGS", config.OTLPExporter{
+		Host:     "opentelemetry-collector",
+		Port:     4318,
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.endpoint != "" {
+		t.Errorf("endpoint = %q, want empty (resolved by exporter from env)", settings.endpoint)
+	}
+	if settings.protocol != "grpc" {
+		t.Errorf("protocol = %q, want %q", settings.protocol, "grpc")
+	}
+}
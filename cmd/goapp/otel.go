@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"google.golang.org/grpc/credentials"
+
+	otelpyroscope "github.com/grafana/otel-profiling-go"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+const (
+	otlpProtocolHTTPProtobuf = "http/protobuf"
+	otlpProtocolGRPC         = "grpc"
+)
+
+// https://opentelemetry.io/docs/languages/go/getting-started/#initialize-the-opentelemetry-sdk
+func setupOTelSDK(ctx context.Context) (func(context.Context) error, error) {
+	var shutdownFuncs []func(context.Context) error
+	shutdown := func(ctx context.Context) error {
+		var err error
+		for _, fn := range shutdownFuncs {
+			err = errors.Join(err, fn(ctx))
+		}
+		shutdownFuncs = nil
+
+		if err != nil {
+			return cerrors.ErrUnavailable.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to shutdown server"),
+			)
+		}
+		return nil
+	}
+
+	// 内部ロガーをlog/slogに差し替え
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Error("opentelemetry export error", "error", err)
+	}))
+
+	// Set up propagator
+	prop := newPropagator()
+	otel.SetTextMapPropagator(prop)
+
+	// Set up resource (各 provider 共通)
+	res, err := newResource(ctx)
+	if err != nil {
+		return shutdown, err
+	}
+
+	// Set up trace provider
+	if cfg.OTLPTrace.Enabled {
+		tracerProvider, err := newOTLPTracerProvider(ctx, res)
+		if err != nil {
+			return shutdown, errors.Join(err, shutdown(ctx))
+		}
+		shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
+
+		// span とプロファイルを紐付ける (root span に pyroscope.profile.id を付与し, pprof ラベルに span_id を載せる)
+		if cfg.Pyroscope.Enabled {
+			otel.SetTracerProvider(otelpyroscope.NewTracerProvider(tracerProvider))
+		} else {
+			otel.SetTracerProvider(tracerProvider)
+		}
+	}
+
+	// Set up meter provider
+	if cfg.OTLPMetric.Enabled {
+		meterProvider, err := newOTLPMeterProvider(ctx, res)
+		if err != nil {
+			return shutdown, errors.Join(err, shutdown(ctx))
+		}
+		shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
+		otel.SetMeterProvider(meterProvider)
+	}
+
+	// Set up logger provider
+	if cfg.OTLPLog.Enabled {
+		loggerProvider, err := newOTLPLoggerProvider(ctx, res)
+		if err != nil {
+			return shutdown, errors.Join(err, shutdown(ctx))
+		}
+		shutdownFuncs = append(shutdownFuncs, loggerProvider.Shutdown)
+		global.SetLoggerProvider(loggerProvider)
+
+		// log/slog → OTLP (ローカル出力と併用)
+		var otlpLogLevel slog.Level
+		if cfg.OTLPLog.Level != "" {
+			if err := otlpLogLevel.UnmarshalText([]byte(cfg.OTLPLog.Level)); err != nil {
+				return shutdown, errors.Join(cerrors.ErrValidation.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessagef("invalid otlp log level: %s", cfg.OTLPLog.Level),
+				), shutdown(ctx))
+			}
+		}
+		logger = slog.New(logging.NewFanoutHandler(
+			localLogSink,
+			logging.Sink{
+				Handler:       logging.NewOTelHandler(loggerProvider, appName),
+				Level:         otlpLogLevel,
+				SamplingRatio: cfg.OTLPLog.SamplingRatio,
+			},
+		))
+		slog.SetDefault(logger)
+	}
+
+	return shutdown, nil
+}
+
+func newPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	)
+}
+
+// newResource は service.name/service.version/deployment.environment とホスト情報を持つ resource を生成する
+// OTEL_SERVICE_NAME / OTEL_RESOURCE_ATTRIBUTES が設定されている場合はそちらを優先する
+func newResource(ctx context.Context) (*resource.Resource, error) {
+
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(appName),
+		semconv.ServiceVersion(Version),
+	}
+	if cfg.App.Environment != "" {
+		attrs = append(attrs,
+			semconv.DeploymentEnvironmentName(cfg.App.Environment),
+			attribute.String("deployment.environment", cfg.App.Environment), // 旧キー (Grafana 等のダッシュボード互換用)
+		)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(attrs...),
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(), // 後勝ちなので最後に置く
+	)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create otel resource"),
+		)
+	}
+	return res, nil
+}
+
+// For Grafana Tempo
+func newOTLPTracerProvider(ctx context.Context, res *resource.Resource) (*trace.TracerProvider, error) {
+	// https://pkg.go.dev/go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp#example-package
+
+	settings, err := resolveOTLPExporter("TRACES", cfg.OTLPTrace.OTLPExporter)
+	if err != nil {
+		return nil, err
+	}
+
+	// exporter
+	var traceExporter trace.SpanExporter
+	switch settings.protocol {
+	case otlpProtocolGRPC:
+		// https://pkg.go.dev/go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc#Option
+		var opts []otlptracegrpc.Option
+		if settings.endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(settings.endpoint))
+			if settings.insecure {
+				opts = append(opts, otlptracegrpc.WithInsecure())
+			} else {
+				opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(settings.tlsConfig)))
+			}
+		}
+		if len(settings.headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(settings.headers))
+		}
+		// gRPC の WithCompressor は gzip のみ受け付ける (none は指定しないことで圧縮しない)
+		if settings.compression == "gzip" {
+			opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlptracegrpc.WithTimeout(settings.timeout))
+		}
+		opts = append(opts, otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig(settings.retry)))
+		traceExporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		// https://pkg.go.dev/go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp#Option
+		var opts []otlptracehttp.Option
+		if settings.endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(settings.endpoint))
+			if settings.insecure {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			} else {
+				opts = append(opts, otlptracehttp.WithTLSClientConfig(settings.tlsConfig))
+			}
+		}
+		if settings.urlPath != "" {
+			opts = append(opts, otlptracehttp.WithURLPath(settings.urlPath))
+		}
+		if len(settings.headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(settings.headers))
+		}
+		switch settings.compression {
+		case "gzip":
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		case "none":
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.NoCompression))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlptracehttp.WithTimeout(settings.timeout))
+		}
+		opts = append(opts, otlptracehttp.WithRetry(otlptracehttp.RetryConfig(settings.retry)))
+		traceExporter, err = otlptracehttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create trace exporter"),
+		)
+	}
+
+	// batch
+	// 0 の項目は OTEL_BSP_* 環境変数 → SDK のデフォルト値 (5s, 2048, 512) に任せる
+	var batchOpts []trace.BatchSpanProcessorOption
+	if cfg.OTLPTrace.Batch.TimeoutMilliseconds > 0 {
+		batchOpts = append(batchOpts, trace.WithBatchTimeout(time.Duration(cfg.OTLPTrace.Batch.TimeoutMilliseconds)*time.Millisecond))
+	}
+	if cfg.OTLPTrace.Batch.MaxQueueSize > 0 {
+		batchOpts = append(batchOpts, trace.WithMaxQueueSize(cfg.OTLPTrace.Batch.MaxQueueSize))
+	}
+	if cfg.OTLPTrace.Batch.MaxExportBatchSize > 0 {
+		batchOpts = append(batchOpts, trace.WithMaxExportBatchSize(cfg.OTLPTrace.Batch.MaxExportBatchSize))
+	}
+
+	// provider
+	providerOpts := []trace.TracerProviderOption{
+		trace.WithBatcher(traceExporter, batchOpts...),
+		trace.WithResource(res),
+	}
+
+	// sampler
+	// OTEL_TRACES_SAMPLER が設定されている場合は SDK が環境変数から組み立てる
+	if os.Getenv("OTEL_TRACES_SAMPLER") == "" {
+		providerOpts = append(providerOpts, trace.WithSampler(
+			trace.ParentBased(trace.TraceIDRatioBased(cfg.OTLPTrace.SamplingRatio)),
+		))
+	}
+
+	tracerProvider := trace.NewTracerProvider(providerOpts...)
+	return tracerProvider, nil
+}
+
+// PrometheusによるPull用エンドポイントのための準備
+func newOTLPMeterProvider(ctx context.Context, res *resource.Resource) (*metric.MeterProvider, error) {
+
+	settings, err := resolveOTLPExporter("METRICS", cfg.OTLPMetric.OTLPExporter)
+	if err != nil {
+		return nil, err
+	}
+
+	// exporter
+	var metricExporter metric.Exporter
+	switch settings.protocol {
+	case otlpProtocolGRPC:
+		var opts []otlpmetricgrpc.Option
+		if settings.endpoint != "" {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(settings.endpoint))
+			if settings.insecure {
+				opts = append(opts, otlpmetricgrpc.WithInsecure())
+			} else {
+				opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(settings.tlsConfig)))
+			}
+		}
+		if len(settings.headers) > 0 {
+			opts = append(opts, otlpmetricgrpc.WithHeaders(settings.headers))
+		}
+		// gRPC の WithCompressor は gzip のみ受け付ける (none は指定しないことで圧縮しない)
+		if settings.compression == "gzip" {
+			opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlpmetricgrpc.WithTimeout(settings.timeout))
+		}
+		opts = append(opts, otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig(settings.retry)))
+		metricExporter, err = otlpmetricgrpc.New(ctx, opts...)
+	default:
+		var opts []otlpmetrichttp.Option
+		if settings.endpoint != "" {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(settings.endpoint))
+			if settings.insecure {
+				opts = append(opts, otlpmetrichttp.WithInsecure())
+			} else {
+				opts = append(opts, otlpmetrichttp.WithTLSClientConfig(settings.tlsConfig))
+			}
+		}
+		if settings.urlPath != "" {
+			opts = append(opts, otlpmetrichttp.WithURLPath(settings.urlPath))
+		}
+		if len(settings.headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(settings.headers))
+		}
+		switch settings.compression {
+		case "gzip":
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+		case "none":
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.NoCompression))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlpmetrichttp.WithTimeout(settings.timeout))
+		}
+		opts = append(opts, otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig(settings.retry)))
+		metricExporter, err = otlpmetrichttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create metric exporter"),
+		)
+	}
+
+	// reader
+	// 0 の項目は OTEL_METRIC_EXPORT_* 環境変数 → SDK のデフォルト値 (60s, 30s) に任せる
+	var readerOpts []metric.PeriodicReaderOption
+	if cfg.OTLPMetric.ExportIntervalSeconds > 0 {
+		readerOpts = append(readerOpts, metric.WithInterval(time.Duration(cfg.OTLPMetric.ExportIntervalSeconds)*time.Second))
+	}
+	if cfg.OTLPMetric.ExportTimeoutSeconds > 0 {
+		readerOpts = append(readerOpts, metric.WithTimeout(time.Duration(cfg.OTLPMetric.ExportTimeoutSeconds)*time.Second))
+	}
+
+	// provider
+	meterProvider := metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(metricExporter, readerOpts...)),
+		metric.WithResource(res),
+	)
+	return meterProvider, nil
+}
+
+func newOTLPLoggerProvider(ctx context.Context, res *resource.Resource) (*log.LoggerProvider, error) {
+
+	settings, err := resolveOTLPExporter("LOGS", cfg.OTLPLog.OTLPExporter)
+	if err != nil {
+		return nil, err
+	}
+
+	// exporter
+	var logExporter log.Exporter
+	switch settings.protocol {
+	case otlpProtocolGRPC:
+		var opts []otlploggrpc.Option
+		if settings.endpoint != "" {
+			opts = append(opts, otlploggrpc.WithEndpoint(settings.endpoint))
+			if settings.insecure {
+				opts = append(opts, otlploggrpc.WithInsecure())
+			} else {
+				opts = append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(settings.tlsConfig)))
+			}
+		}
+		if len(settings.headers) > 0 {
+			opts = append(opts, otlploggrpc.WithHeaders(settings.headers))
+		}
+		// gRPC の WithCompressor は gzip のみ受け付ける (none は指定しないことで圧縮しない)
+		if settings.compression == "gzip" {
+			opts = append(opts, otlploggrpc.WithCompressor("gzip"))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlploggrpc.WithTimeout(settings.timeout))
+		}
+		opts = append(opts, otlploggrpc.WithRetry(otlploggrpc.RetryConfig(settings.retry)))
+		logExporter, err = otlploggrpc.New(ctx, opts...)
+	default:
+		var opts []otlploghttp.Option
+		if settings.endpoint != "" {
+			opts = append(opts, otlploghttp.WithEndpoint(settings.endpoint))
+			if settings.insecure {
+				opts = append(opts, otlploghttp.WithInsecure())
+			} else {
+				opts = append(opts, otlploghttp.WithTLSClientConfig(settings.tlsConfig))
+			}
+		}
+		if settings.urlPath != "" {
+			opts = append(opts, otlploghttp.WithURLPath(settings.urlPath))
+		}
+		if len(settings.headers) > 0 {
+			opts = append(opts, otlploghttp.WithHeaders(settings.headers))
+		}
+		switch settings.compression {
+		case "gzip":
+			opts = append(opts, otlploghttp.WithCompression(otlploghttp.GzipCompression))
+		case "none":
+			opts = append(opts, otlploghttp.WithCompression(otlploghttp.NoCompression))
+		}
+		if settings.timeout > 0 {
+			opts = append(opts, otlploghttp.WithTimeout(settings.timeout))
+		}
+		opts = append(opts, otlploghttp.WithRetry(otlploghttp.RetryConfig(settings.retry)))
+		logExporter, err = otlploghttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create log exporter"),
+		)
+	}
+
+	// batch
+	// 0 の項目は OTEL_BLRP_* 環境変数 → SDK のデフォルト値 (1s, 2048, 512) に任せる
+	var batchOpts []log.BatchProcessorOption
+	if cfg.OTLPLog.Batch.TimeoutMilliseconds > 0 {
+		batchOpts = append(batchOpts, log.WithExportInterval(time.Duration(cfg.OTLPLog.Batch.TimeoutMilliseconds)*time.Millisecond))
+	}
+	if cfg.OTLPLog.Batch.MaxQueueSize > 0 {
+		batchOpts = append(batchOpts, log.WithMaxQueueSize(cfg.OTLPLog.Batch.MaxQueueSize))
+	}
+	if cfg.OTLPLog.Batch.MaxExportBatchSize > 0 {
+		batchOpts = append(batchOpts, log.WithExportMaxBatchSize(cfg.OTLPLog.Batch.MaxExportBatchSize))
+	}
+
+	// provider
+	loggerProvider := log.NewLoggerProvider(
+		log.WithProcessor(log.NewBatchProcessor(logExporter, batchOpts...)),
+		log.WithResource(res),
+	)
+	return loggerProvider, nil
+}
+
+// otlpRetryConfig は各 exporter の RetryConfig (いずれも retry.Config の別名) に変換できる共通の形
+// 常に WithRetry で渡すため, Enabled が false の場合は SDK のデフォルトのリトライも使わずリトライしない
+type otlpRetryConfig struct {
+	Enabled         bool
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+}
+
+// otlpExporterSettings は config.OTLPExporter と OTEL_* 環境変数を解決した結果
+type otlpExporterSettings struct {
+	protocol string
+
+	// 空の場合は exporter が OTEL_EXPORTER_OTLP_(<SIGNAL>_)ENDPOINT を使う
+	endpoint  string
+	insecure  bool
+	tlsConfig *tls.Config
+
+	urlPath     string
+	headers     map[string]string
+	compression string
+	timeout     time.Duration
+	retry       otlpRetryConfig
+}
+
+// resolveOTLPExporter は signal (TRACES|METRICS|LOGS) の exporter 設定を解決する
+func resolveOTLPExporter(signal string, c config.OTLPExporter) (*otlpExporterSettings, error) {
+
+	settings := &otlpExporterSettings{
+		protocol:    c.Protocol,
+		urlPath:     c.URLPath,
+		headers:     c.Headers,
+		compression: c.Compression,
+		timeout:     time.Duration(c.TimeoutSeconds) * time.Second,
+		retry: otlpRetryConfig{
+			Enabled:         c.Retry.Enabled,
+			InitialInterval: time.Duration(c.Retry.InitialIntervalSeconds) * time.Second,
+			MaxInterval:     time.Duration(c.Retry.MaxIntervalSeconds) * time.Second,
+			MaxElapsedTime:  time.Duration(c.Retry.MaxElapsedTimeSeconds) * time.Second,
+		},
+	}
+
+	// protocol
+	if settings.protocol == "" {
+		settings.protocol = firstEnv("OTEL_EXPORTER_OTLP_"+signal+"_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch settings.protocol {
+	case "", otlpProtocolHTTPProtobuf:
+		settings.protocol = otlpProtocolHTTPProtobuf
+	case otlpProtocolGRPC:
+	default:
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("unsupported otlp protocol: %s", settings.protocol),
+		)
+	}
+
+	// endpoint
+	// 環境変数で指定されている場合は exporter 自身に解決させる
+	if firstEnv("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
+		return settings, nil
+	}
+	settings.endpoint = net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port)))
+	settings.insecure = c.Insecure
+	if !settings.insecure {
+		tlsConfig, err := newTLSClientConfig(c.Host, c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		settings.tlsConfig = tlsConfig
+	}
+
+	return settings, nil
+}
+
+// firstEnv は keys のうち最初に空でない環境変数の値を返す
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,225 @@
+// cmd/goapp/storage.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/gomodule/redigo/redis"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/spf13/viper"
+
+	"github.com/aazw/go-base/pkg/api"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/memory"
+	"github.com/aazw/go-base/pkg/db/postgres"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+const storageFlagKey string = "storage"
+
+// 保存先 (--storage)
+const (
+	storagePostgres = "postgres" // PostgreSQL + Valkey
+	storageMemory   = "memory"   // プロセス内のメモリ. 再起動で消える. ローカルでの動作確認用
+)
+
+func init() {
+	// serve (rootCmd) だけのフラグ
+	f := rootCmd.Flags()
+	f.String(storageFlagKey, storagePostgres, "storage backend = (postgres|memory)")
+
+	viper.BindEnv(storageFlagKey, envVarPrefix+"_STORAGE") // GOAPP_STORAGE → storage
+	viper.BindPFlag(storageFlagKey, f.Lookup(storageFlagKey))
+}
+
+// storage は serve が使う保存先一式
+type storage struct {
+	dbHandler db.Handler
+
+	// Valkey. memory の場合は nil (Valkey を使う機能は無効にする)
+	redisPool *redis.Pool
+
+	// API からの PostgreSQL と Valkey の呼び出しを守る. memory の場合と, 設定で無効にした場合は nil
+	postgresGuard *resilience.Guard
+	valkeyGuard   *resilience.Guard
+
+	sessionStore   scs.Store
+	sessionIndex   api.SessionIndex
+	healthCheckers []api.HealthChecker
+
+	closers []func()
+}
+
+// Close は生成した順と逆順に接続を閉じる
+func (p *storage) Close() {
+	for i := len(p.closers) - 1; i >= 0; i-- {
+		p.closers[i]()
+	}
+}
+
+// newStorage は kind (--storage) に応じた保存先を生成する
+func newStorage(ctx context.Context, kind string) (*storage, error) {
+	switch kind {
+	case storagePostgres:
+		return newPostgresStorage(ctx)
+	case storageMemory:
+		return newMemoryStorage()
+	default:
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid storage: %s", kind),
+		)
+	}
+}
+
+// newPostgresStorage は PostgreSQL (プライマリ/レプリカ) と Valkey に接続する
+func newPostgresStorage(ctx context.Context) (_ *storage, err error) {
+
+	s := &storage{}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	// DB (PostgreSQL)
+	queryTracer, err := newPostgresQueryTracer()
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize postgres query tracer"),
+		)
+	}
+
+	dbPool, err := newPostgresPool(ctx, "primary", cfg.Postgres.Host, cfg.Postgres.Port, queryTracer)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize postgres connection"),
+		)
+	}
+	s.closers = append(s.closers, func() {
+		dbPool.Close()
+		logger.Info("postgres connection closed normally")
+	})
+	if err := checkRowLevelSecurity(ctx, dbPool); err != nil {
+		return nil, err
+	}
+
+	// DB (PostgreSQL, read replicas)
+	replicaPools := make([]*pgxpool.Pool, 0, len(cfg.Postgres.Replicas))
+	for i, replica := range cfg.Postgres.Replicas {
+		replicaPool, err := newPostgresPool(ctx, fmt.Sprintf("replica-%d", i), replica.Host, replica.Port, queryTracer)
+		if err != nil {
+			return nil, cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessagef("failed to initialize postgres replica connection: %s", replica.Host),
+			)
+		}
+		s.closers = append(s.closers, replicaPool.Close)
+		if err := checkRowLevelSecurity(ctx, replicaPool); err != nil {
+			return nil, err
+		}
+		replicaPools = append(replicaPools, replicaPool)
+	}
+
+	dbHandler, err := postgres.NewHandler(dbPool,
+		postgres.WithReplicas(replicaPools...),
+		postgres.WithReplicaHealthCheckInterval(time.Duration(cfg.Postgres.ReplicaHealthCheckIntervalSeconds)*time.Second),
+	)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize database handler"),
+		)
+	}
+	s.closers = append(s.closers, dbHandler.Close)
+	s.dbHandler = dbHandler
+
+	// Valkey/Redis
+	redisPool, err := newValkeyPool(ctx)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize redis connection"),
+		)
+	}
+	s.closers = append(s.closers, func() {
+		if err := redisPool.Close(); err != nil {
+			logger.Info("valkey connection closure failed")
+			return
+		}
+		logger.Info("valkey connection closed normally")
+	})
+	s.redisPool = redisPool
+
+	s.sessionStore, err = api.NewValkeySessionStore(redisPool)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize session store"),
+		)
+	}
+	s.sessionIndex, err = api.NewValkeySessionIndex(redisPool, cfg.Session.IndexKeyPrefix)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize session index"),
+		)
+	}
+
+	// Circuit breakers & bulkheads
+	s.postgresGuard, s.valkeyGuard, err = newResilienceGuards()
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize circuit breakers and bulkheads"),
+		)
+	}
+
+	s.healthCheckers = []api.HealthChecker{
+		api.WithCircuitBreaker(api.NewPostgresHealthChecker(dbPool), s.postgresGuard.Breaker()),
+		api.WithCircuitBreaker(api.NewValkeyHealthChecker(redisPool), s.valkeyGuard.Breaker()),
+	}
+	return s, nil
+}
+
+// checkRowLevelSecurity はテナントを分離する場合 (tenancy.enabled) に, pool のロールが Row Level Security を迂回しないことを確かめる
+func checkRowLevelSecurity(ctx context.Context, pool *pgxpool.Pool) error {
+	if !cfg.Tenancy.Enabled {
+		return nil
+	}
+	if err := postgres.CheckRowLevelSecurity(ctx, pool); err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("tenancy requires row level security"),
+		)
+	}
+	return nil
+}
+
+// newMemoryStorage は PostgreSQL と Valkey を使わず, データとセッションをメモリに保存する
+func newMemoryStorage() (*storage, error) {
+
+	dbHandler, err := memory.NewHandler()
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize database handler"),
+		)
+	}
+
+	sessionStore := memstore.New()
+	return &storage{
+		dbHandler:    dbHandler,
+		sessionStore: sessionStore,
+		sessionIndex: api.NewMemorySessionIndex(),
+		closers: []func(){
+			sessionStore.StopCleanup,
+		},
+	}, nil
+}
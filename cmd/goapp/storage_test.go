@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewStorage_Memory(t *testing.T) {
+	st, err := newStorage(context.Background(), storageMemory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	if st.dbHandler == nil || st.sessionStore == nil {
+		t.Errorf("newStorage(memory) = %+v; want db handler and session store", st)
+	}
+	if st.redisPool != nil || len(st.healthCheckers) != 0 {
+		t.Errorf("newStorage(memory) uses valkey or health checkers: %+v", st)
+	}
+}
+
+func TestNewStorage_Invalid(t *testing.T) {
+	if _, err := newStorage(context.Background(), "mysql"); err == nil {
+		t.Error("newStorage(mysql) error = nil; want error")
+	}
+}
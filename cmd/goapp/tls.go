@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+)
+
+// newTLSClientConfig は外部サービス (OTLP, Pyroscope 等) に接続するための tls.Config を生成する
+func newTLSClientConfig(host string, c config.TLSClient) (*tls.Config, error) {
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: host,
+	}
+	if c.ServerName != "" {
+		tlsConfig.ServerName = c.ServerName
+	}
+
+	// CA
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, cerrors.ErrValidation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessagef("failed to read ca file: %s", c.CAFile),
+			)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, cerrors.ErrInvalidFormat.New(
+				cerrors.WithMessagef("no certificates found in ca file: %s", c.CAFile),
+			)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// mTLS
+	if c.CertFile != "" && c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, cerrors.ErrValidation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessagef("failed to load client certificate: %s", c.CertFile),
+			)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
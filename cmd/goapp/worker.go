@@ -0,0 +1,330 @@
+// cmd/goapp/worker.go
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db/postgres"
+	"github.com/aazw/go-base/pkg/jobs"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+// ジョブの種類
+const (
+	jobTypePurge      = "maintenance.purge" // 古い outbox のイベントと webhook の配信を削除する
+	jobTypeAuditPurge = "audit.purge"       // 保持期間を過ぎた監査ログを削除する
+)
+
+// purgePayload は maintenance.purge, audit.purge ジョブの payload
+type purgePayload struct {
+	// 0 の場合は jobs.purge_retention_hours (audit.purge の場合は jobs.audit_retention_hours)
+	RetentionHours uint64 `json:"retention_hours,omitempty"`
+}
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Run background job workers and the job scheduler",
+	RunE:  runWorkerE,
+}
+
+func init() {
+	rootCmd.AddCommand(workerCmd)
+}
+
+func runWorkerE(cmd *cobra.Command, args []string) (err error) {
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// OpenTelemetry
+	// logger を OTLP にも送るものに置き換えるため, ctx に logger を紐付けるより前に置く
+	if cfg.OTLPTrace.Enabled || cfg.OTLPMetric.Enabled || cfg.OTLPLog.Enabled {
+		otelShutdown, err := setupOTelSDK(ctx)
+		if err != nil {
+			return cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize OpenTelemetry SDK"),
+			)
+		}
+		defer func() {
+			err = errors.Join(err, otelShutdown(context.Background()))
+		}()
+	}
+
+	ctx = logging.NewContext(ctx, logger)
+
+	// DB (PostgreSQL)
+	// ジョブは書き込みが主なのでレプリカは使わない
+	queryTracer, err := newPostgresQueryTracer()
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize postgres query tracer"),
+		)
+	}
+	dbPool, err := newPostgresPool(ctx, "primary", cfg.Postgres.Host, cfg.Postgres.Port, queryTracer)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize postgres connection"),
+		)
+	}
+	defer func() {
+		dbPool.Close()
+		logger.Info("postgres connection closed normally")
+	}()
+
+	dbHandler, err := postgres.NewHandler(dbPool)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize database handler"),
+		)
+	}
+	defer dbHandler.Close()
+
+	opsHandler, err := operations.NewHandler(dbHandler)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize operations handler"),
+		)
+	}
+
+	// Valkey/Redis
+	redisPool, err := newValkeyPool(ctx)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize redis connection"),
+		)
+	}
+	defer func() {
+		if err := redisPool.Close(); err != nil {
+			logger.Info("valkey connection closure failed")
+			return
+		}
+		logger.Info("valkey connection closed normally")
+	}()
+
+	// Profiling (Pyroscope)
+	if cfg.Pyroscope.Enabled {
+		stopProfiler, err := newProfiler()
+		if err != nil {
+			return cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize profiler"),
+			)
+		}
+		defer func() {
+			stopProfiler()
+			logger.Info("profiler stopped normally")
+		}()
+	}
+
+	// Jobs
+	queue, err := jobs.NewValkeyQueue(redisPool, cfg.Jobs.KeyPrefix, cfg.Jobs.DeadLetterMaxLen)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize job queue"),
+		)
+	}
+
+	registry, err := newJobRegistry(opsHandler)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to register job handlers"),
+		)
+	}
+
+	jobMetrics, err := jobs.NewMetrics(appName, queue)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize job metrics"),
+		)
+	}
+	defer jobMetrics.Close()
+	if cfg.Prometheus.Enabled {
+		prometheus.MustRegister(jobMetrics)
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = appName
+	}
+	worker, err := jobs.NewWorker(queue, registry, jobs.WorkerConfig{
+		Name:              hostname,
+		Concurrency:       cfg.Jobs.Concurrency,
+		PollTimeout:       time.Duration(cfg.Jobs.PollTimeoutSeconds) * time.Second,
+		JobTimeout:        time.Duration(cfg.Jobs.JobTimeoutSeconds) * time.Second,
+		HeartbeatInterval: time.Duration(cfg.Jobs.HeartbeatIntervalSeconds) * time.Second,
+		RetryPolicy: models.RetryPolicy{
+			MaxAttempts:    cfg.Jobs.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Jobs.InitialBackoffSeconds) * time.Second,
+			MaxBackoff:     time.Duration(cfg.Jobs.MaxBackoffSeconds) * time.Second,
+		},
+	}, jobs.WithMetrics(jobMetrics))
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize job worker"),
+		)
+	}
+
+	// Job Scheduler
+	if cfg.Jobs.Scheduler.Enabled {
+		scheduler, err := newJobScheduler(redisPool, queue)
+		if err != nil {
+			return cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize job scheduler"),
+			)
+		}
+		schedulerDone := make(chan struct{})
+		go func() {
+			defer close(schedulerDone)
+			_ = scheduler.Run(ctx)
+		}()
+		defer func() {
+			stop() // worker がシグナル以外で終了した場合もスケジューラを止める
+			<-schedulerDone
+		}()
+	}
+
+	// Metrics & Health Endpoint
+	srv := newWorkerMetricsServer()
+	go func() {
+		logger.Info("worker metrics server listening", "address", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("failed to start worker metrics server", "error", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	// シグナルを受け取るまで処理し, 受け取ったら処理中のジョブの完了を待って終了する
+	if err := worker.Run(ctx); err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("job worker stopped unexpectedly"),
+		)
+	}
+	return nil
+}
+
+// newJobRegistry はジョブの種類毎のハンドラを登録する
+func newJobRegistry(opsHandler *operations.Handler) (*jobs.Registry, error) {
+
+	registry := jobs.NewRegistry()
+
+	err := jobs.Register(registry, jobTypePurge, func(ctx context.Context, payload purgePayload) error {
+		retentionHours := payload.RetentionHours
+		if retentionHours == 0 {
+			retentionHours = cfg.Jobs.PurgeRetentionHours
+		}
+		_, err := opsHandler.PurgeExpiredRecords(ctx, time.Duration(retentionHours)*time.Hour)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jobs.Register(registry, jobTypeAuditPurge, func(ctx context.Context, payload purgePayload) error {
+		retentionHours := payload.RetentionHours
+		if retentionHours == 0 {
+			retentionHours = cfg.Jobs.AuditRetentionHours
+		}
+		_, err := opsHandler.PurgeExpiredAuditEvents(ctx, time.Duration(retentionHours)*time.Hour)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
+
+// newJobScheduler は設定のスケジュールに従ってジョブを登録するスケジューラを生成する
+func newJobScheduler(redisPool *redis.Pool, queue jobs.Enqueuer) (*jobs.Scheduler, error) {
+
+	location := time.UTC
+	if cfg.Jobs.Scheduler.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Jobs.Scheduler.Timezone)
+		if err != nil {
+			return nil, cerrors.ErrValidation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessagef("invalid timezone: %s", cfg.Jobs.Scheduler.Timezone),
+			)
+		}
+		location = loc
+	}
+
+	entries := make([]jobs.ScheduleEntry, 0, len(cfg.Jobs.Scheduler.Schedules))
+	for _, s := range cfg.Jobs.Scheduler.Schedules {
+		schedule, err := jobs.ParseSchedule(s.Spec)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, jobs.ScheduleEntry{
+			Name:     s.Name,
+			Schedule: schedule,
+			JobType:  s.JobType,
+			Payload:  s.Payload,
+		})
+	}
+
+	ttl := time.Duration(cfg.Jobs.Scheduler.LeaderLockTTLSeconds) * time.Second
+	elector, err := jobs.NewValkeyLeaderElector(redisPool, cfg.Jobs.KeyPrefix+":scheduler:leader", ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	// ロックの期限が切れる前に3回は延長を試みる
+	return jobs.NewScheduler(queue, elector, entries, jobs.SchedulerConfig{
+		TickInterval: ttl / 3,
+		Location:     location,
+	})
+}
+
+// newWorkerMetricsServer は worker のメトリクス (Prometheus) とヘルスチェックを公開するサーバを生成する
+func newWorkerMetricsServer() *http.Server {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health/liveness", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	if cfg.Prometheus.Enabled {
+		mux.Handle(cfg.Prometheus.MetricsPath, promhttp.HandlerFor(
+			prometheus.DefaultGatherer,
+			promhttp.HandlerOpts{EnableOpenMetrics: true},
+		))
+	}
+
+	return &http.Server{
+		Addr:              net.JoinHostPort(cfg.Server.Host, strconv.Itoa(int(cfg.Jobs.MetricsPort))),
+		Handler:           mux,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeoutSeconds) * time.Second,
+	}
+}
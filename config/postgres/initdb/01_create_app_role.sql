@@ -0,0 +1,11 @@
+-- アプリケーション (goapp) が接続するロール
+-- Row Level Security でテナントを分離するため SUPERUSER/BYPASSRLS にしない (db/migrations/000007_create_tenants_table.up.sql)
+-- テーブルの所有者はマイグレーションを実行する postgres のままにし, goapp にはデータの読み書きだけを許可する
+CREATE ROLE goapp LOGIN NOSUPERUSER NOBYPASSRLS NOCREATEDB NOCREATEROLE PASSWORD 'hogehoge';
+
+GRANT CONNECT ON DATABASE test_db TO goapp;
+GRANT USAGE ON SCHEMA public TO goapp;
+
+-- マイグレーションで後から作成するテーブル/シーケンスにも適用する
+ALTER DEFAULT PRIVILEGES FOR ROLE postgres IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO goapp;
+ALTER DEFAULT PRIVILEGES FOR ROLE postgres IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO goapp;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS outbox (
+  id              UUID         PRIMARY KEY,
+  event_type      VARCHAR(100) NOT NULL,
+  aggregate_type  VARCHAR(100) NOT NULL,
+  aggregate_id    UUID         NOT NULL,
+  payload         JSONB        NOT NULL,
+  trace_context   JSONB        NOT NULL DEFAULT '{}',
+  status          VARCHAR(20)  NOT NULL DEFAULT 'pending', -- pending / published / dead
+  attempts        INTEGER      NOT NULL DEFAULT 0,
+  last_error      TEXT,
+  next_attempt_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  occurred_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  published_at    TIMESTAMPTZ,
+  CONSTRAINT outbox_status_check CHECK (status IN ('pending', 'published', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (next_attempt_at, occurred_at) WHERE status = 'pending';
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+  id                   UUID          PRIMARY KEY,
+  url                  VARCHAR(2048) NOT NULL,
+  description          VARCHAR(500)  NOT NULL DEFAULT '',
+  event_types          TEXT[]        NOT NULL DEFAULT '{}', -- 空の場合は全てのイベント
+  secret               VARCHAR(200)  NOT NULL,               -- 署名 (HMAC-SHA256) の鍵
+  enabled              BOOLEAN       NOT NULL DEFAULT TRUE,
+  consecutive_failures INTEGER       NOT NULL DEFAULT 0,
+  disabled_reason      TEXT,
+  created_at           TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+  updated_at           TIMESTAMPTZ   NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id                 UUID         PRIMARY KEY,
+  webhook_id         UUID         NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+  event_id           UUID         NOT NULL,
+  event_type         VARCHAR(100) NOT NULL,
+  payload            JSONB        NOT NULL,
+  status             VARCHAR(20)  NOT NULL DEFAULT 'pending', -- pending / succeeded / failed
+  attempts           INTEGER      NOT NULL DEFAULT 0,
+  next_attempt_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  last_response_code INTEGER,
+  last_error         TEXT,
+  created_at         TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  updated_at         TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  delivered_at       TIMESTAMPTZ,
+  CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'succeeded', 'failed')),
+  CONSTRAINT webhook_deliveries_webhook_event_key UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+  id            BIGINT      GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  delivery_id   UUID        NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+  attempt       INTEGER     NOT NULL,
+  response_code INTEGER,    -- 接続エラー等でレスポンスが無い場合は NULL
+  error         TEXT,
+  duration_ms   INTEGER     NOT NULL,
+  attempted_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_idx ON webhook_delivery_attempts (delivery_id, attempt);
@@ -0,0 +1,14 @@
+-- 類似度検索で使う. 000001 でも作成するが, 既に 000001 を適用済みのデータベース向けにここでも作成する
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- 全文検索 (name を重み A, email を重み B). 言語に依らないよう simple を使う
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+  setweight(to_tsvector('simple', name), 'A') ||
+  setweight(to_tsvector('simple', email), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN (search_vector);
+
+-- 表記の揺れ (typo) に対する類似度検索 (pg_trgm)
+CREATE INDEX IF NOT EXISTS users_name_trgm_idx ON users USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING GIN (email gin_trgm_ops);
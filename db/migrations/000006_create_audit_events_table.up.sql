@@ -0,0 +1,22 @@
+-- 変更操作の監査ログ. 変更と同じトランザクションで書き込む
+CREATE TABLE IF NOT EXISTS audit_events (
+  id          UUID         PRIMARY KEY,                -- UUID v7 (発生順に並ぶ)
+  action      VARCHAR(20)  NOT NULL,                   -- create / update / delete
+  actor_type  VARCHAR(20)  NOT NULL,                   -- oidc / api_key / session / anonymous / system
+  actor_id    VARCHAR(255) NOT NULL DEFAULT '',        -- OIDC の sub, API キーの ID 等
+  target_type VARCHAR(100) NOT NULL,
+  target_id   UUID         NOT NULL,
+  before      JSONB,                                   -- 変更前の値 (変更された項目のみ). 作成の場合は NULL
+  after       JSONB,                                   -- 変更後の値 (変更された項目のみ). 削除の場合は NULL
+  request_id  VARCHAR(128) NOT NULL DEFAULT '',
+  trace_id    VARCHAR(32)  NOT NULL DEFAULT '',
+  client_ip   VARCHAR(45)  NOT NULL DEFAULT '',
+  user_agent  TEXT         NOT NULL DEFAULT '',
+  occurred_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  CONSTRAINT audit_events_action_check CHECK (action IN ('create', 'update', 'delete')),
+  CONSTRAINT audit_events_actor_type_check CHECK (actor_type IN ('oidc', 'api_key', 'session', 'anonymous', 'system'))
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id, id DESC);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_type, actor_id, id DESC);
+CREATE INDEX IF NOT EXISTS audit_events_occurred_at_idx ON audit_events (occurred_at);
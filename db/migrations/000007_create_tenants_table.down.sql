@@ -0,0 +1,10 @@
+DROP POLICY IF EXISTS users_tenant_isolation ON users;
+ALTER TABLE users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+-- 複数のテナントに同じ email がある場合は失敗する
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_tenant_email_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
+DROP FUNCTION IF EXISTS app_cross_tenant();
+DROP FUNCTION IF EXISTS app_current_tenant_id();
+DROP TABLE IF EXISTS tenants;
@@ -0,0 +1,39 @@
+-- 1つのデプロイで複数の組織 (テナント) をホストする
+CREATE TABLE IF NOT EXISTS tenants (
+  id         UUID         PRIMARY KEY,
+  slug       VARCHAR(63)  NOT NULL,                    -- サブドメインに使う識別子
+  name       VARCHAR(500) NOT NULL,
+  created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+  CONSTRAINT tenants_slug_key UNIQUE (slug)
+);
+
+-- 既存のデータは全てデフォルトのテナントに属する
+INSERT INTO tenants (id, slug, name)
+VALUES ('00000000-0000-0000-0000-000000000001', 'default', 'Default')
+ON CONFLICT DO NOTHING;
+
+-- トランザクションごとに SET LOCAL (set_config(..., true)) したテナント. 未設定の場合は NULL
+CREATE OR REPLACE FUNCTION app_current_tenant_id() RETURNS UUID
+  LANGUAGE sql STABLE
+  AS $$ SELECT NULLIF(current_setting('app.tenant_id', true), '')::uuid $$;
+
+-- 全テナントへのアクセス (super-admin, メンテナンス) を許可するか
+CREATE OR REPLACE FUNCTION app_cross_tenant() RETURNS BOOLEAN
+  LANGUAGE sql STABLE
+  AS $$ SELECT COALESCE(NULLIF(current_setting('app.cross_tenant', true), '')::boolean, false) $$;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants (id);
+ALTER TABLE users ALTER COLUMN tenant_id SET DEFAULT app_current_tenant_id();
+
+-- email の一意性はテナントごと
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_email_key UNIQUE (tenant_id, email);
+
+-- Row Level Security でテナントを分離する
+-- テーブルの所有者にも適用するため FORCE する. アプリケーションのロールは SUPERUSER/BYPASSRLS であってはならない
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+CREATE POLICY users_tenant_isolation ON users
+  USING (tenant_id = app_current_tenant_id() OR app_cross_tenant())
+  WITH CHECK (tenant_id = app_current_tenant_id() OR app_cross_tenant());
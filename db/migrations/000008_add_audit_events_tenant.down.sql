@@ -0,0 +1,5 @@
+DROP POLICY IF EXISTS audit_events_tenant_isolation ON audit_events;
+ALTER TABLE audit_events NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE audit_events DISABLE ROW LEVEL SECURITY;
+DROP INDEX IF EXISTS audit_events_tenant_idx;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,11 @@
+-- 監査ログもテナントごとに分離する
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants (id);
+ALTER TABLE audit_events ALTER COLUMN tenant_id SET DEFAULT app_current_tenant_id();
+
+CREATE INDEX IF NOT EXISTS audit_events_tenant_idx ON audit_events (tenant_id, id DESC);
+
+ALTER TABLE audit_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_events FORCE ROW LEVEL SECURITY;
+CREATE POLICY audit_events_tenant_isolation ON audit_events
+  USING (tenant_id = app_current_tenant_id() OR app_cross_tenant())
+  WITH CHECK (tenant_id = app_current_tenant_id() OR app_cross_tenant());
@@ -0,0 +1,28 @@
+-- マシンクライアント (CI, 連携サービス等) の認証に使う API キー
+-- キーそのもの (gbk_<prefix>_<secret>) は発行時に一度だけ返し, 保存するのは検索用の prefix とキー全体の SHA-256 のみ
+CREATE TABLE IF NOT EXISTS api_keys (
+  id               UUID             PRIMARY KEY,
+  tenant_id        UUID             NOT NULL DEFAULT app_current_tenant_id() REFERENCES tenants (id),
+  name             VARCHAR(200)     NOT NULL,
+  prefix           VARCHAR(32)      NOT NULL,
+  secret_hash      BYTEA            NOT NULL,
+  scopes           TEXT[]           NOT NULL DEFAULT '{}',
+  rate_limit_rps   DOUBLE PRECISION,          -- NULL の場合は api_keys.rate_limit の既定値
+  rate_limit_burst INTEGER,
+  expires_at       TIMESTAMPTZ,               -- NULL の場合は無期限
+  last_used_at     TIMESTAMPTZ,
+  revoked_at       TIMESTAMPTZ,
+  rotated_from     UUID,                      -- ローテーションで置き換えたキー
+  created_at       TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+  updated_at       TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+  CONSTRAINT api_keys_prefix_key UNIQUE (prefix)
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_tenant_idx ON api_keys (tenant_id, created_at);
+
+-- 認証ではテナントを特定する前にキーを引くため, 全テナントを対象 (app_cross_tenant) にして prefix で検索する
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+CREATE POLICY api_keys_tenant_isolation ON api_keys
+  USING (tenant_id = app_current_tenant_id() OR app_cross_tenant())
+  WITH CHECK (tenant_id = app_current_tenant_id() OR app_cross_tenant());
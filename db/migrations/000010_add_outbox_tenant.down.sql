@@ -0,0 +1,4 @@
+DROP POLICY IF EXISTS outbox_tenant_isolation ON outbox;
+ALTER TABLE outbox NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE outbox DISABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox DROP COLUMN IF EXISTS tenant_id;
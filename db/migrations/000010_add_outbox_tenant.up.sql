@@ -0,0 +1,10 @@
+-- イベントを発生させたテナント. webhook への配信はこのテナントの webhook だけに行う
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants (id);
+ALTER TABLE outbox ALTER COLUMN tenant_id SET DEFAULT app_current_tenant_id();
+
+-- relay は全てのテナントのイベントを配信するため, app_cross_tenant で取り出す
+ALTER TABLE outbox ENABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox FORCE ROW LEVEL SECURITY;
+CREATE POLICY outbox_tenant_isolation ON outbox
+  USING (tenant_id = app_current_tenant_id() OR app_cross_tenant())
+  WITH CHECK (tenant_id = app_current_tenant_id() OR app_cross_tenant());
@@ -0,0 +1,24 @@
+-- webhook と配信もテナントごとに分離する
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants (id);
+ALTER TABLE webhooks ALTER COLUMN tenant_id SET DEFAULT app_current_tenant_id();
+
+-- 配信の tenant_id は配信先の webhook (= イベント) のテナント
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants (id);
+UPDATE webhook_deliveries d SET tenant_id = w.tenant_id FROM webhooks w WHERE w.id = d.webhook_id AND d.tenant_id <> w.tenant_id;
+ALTER TABLE webhook_deliveries ALTER COLUMN tenant_id SET DEFAULT app_current_tenant_id();
+
+CREATE INDEX IF NOT EXISTS webhooks_tenant_idx ON webhooks (tenant_id, created_at);
+
+-- deliverer は全てのテナントの配信を送信するため, app_cross_tenant で取り出す
+-- webhook_delivery_attempts は配信 (webhook_deliveries) を経由してのみ参照する
+ALTER TABLE webhooks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhooks FORCE ROW LEVEL SECURITY;
+CREATE POLICY webhooks_tenant_isolation ON webhooks
+  USING (tenant_id = app_current_tenant_id() OR app_cross_tenant())
+  WITH CHECK (tenant_id = app_current_tenant_id() OR app_cross_tenant());
+
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+CREATE POLICY webhook_deliveries_tenant_isolation ON webhook_deliveries
+  USING (tenant_id = app_current_tenant_id() OR app_cross_tenant())
+  WITH CHECK (tenant_id = app_current_tenant_id() OR app_cross_tenant());
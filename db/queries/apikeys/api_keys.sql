@@ -0,0 +1,41 @@
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+ORDER BY created_at, id;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+  id, name, prefix, secret_hash, scopes, rate_limit_rps, rate_limit_burst, expires_at, rotated_from
+) VALUES (
+  @id, @name, @prefix, @secret_hash, @scopes, sqlc.narg('rate_limit_rps'), sqlc.narg('rate_limit_burst'), sqlc.narg('expires_at'), sqlc.narg('rotated_from')
+)
+RETURNING *;
+
+-- name: GetAPIKey :one
+SELECT * FROM api_keys
+WHERE id = $1;
+
+-- name: GetAPIKeyByPrefix :one
+SELECT * FROM api_keys
+WHERE prefix = $1;
+
+-- name: RevokeAPIKey :one
+-- 失効済みの場合は失効した日時を変えない
+UPDATE api_keys SET
+  revoked_at = COALESCE(revoked_at, NOW()),
+  updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ExpireAPIKey :one
+-- ローテーションの猶予期間. 既に期限が早い場合はそのまま
+UPDATE api_keys SET
+  expires_at = LEAST(COALESCE(expires_at, @expires_at::timestamptz), @expires_at::timestamptz),
+  updated_at = NOW()
+WHERE id = @id
+RETURNING *;
+
+-- name: TouchAPIKey :exec
+-- 使うたびに書き込まないよう, 前回から interval 以上経った場合だけ更新する
+UPDATE api_keys SET
+  last_used_at = NOW()
+WHERE id = @id AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => @interval_seconds::double precision));
@@ -0,0 +1,26 @@
+-- name: InsertAuditEvent :exec
+INSERT INTO audit_events (
+  id, action, actor_type, actor_id, target_type, target_id, before, after,
+  request_id, trace_id, client_ip, user_agent, occurred_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+);
+
+-- name: ListAuditEvents :many
+-- 新しい順 (id の降順). cursor を指定した場合はその id より古いものを返す (keyset pagination)
+SELECT * FROM audit_events
+WHERE (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action')::text)
+  AND (sqlc.narg('actor_type')::text IS NULL OR actor_type = sqlc.narg('actor_type')::text)
+  AND (sqlc.narg('actor_id')::text IS NULL OR actor_id = sqlc.narg('actor_id')::text)
+  AND (sqlc.narg('target_type')::text IS NULL OR target_type = sqlc.narg('target_type')::text)
+  AND (sqlc.narg('target_id')::uuid IS NULL OR target_id = sqlc.narg('target_id')::uuid)
+  AND (sqlc.narg('since')::timestamptz IS NULL OR occurred_at >= sqlc.narg('since')::timestamptz)
+  AND (sqlc.narg('until')::timestamptz IS NULL OR occurred_at < sqlc.narg('until')::timestamptz)
+  AND (sqlc.narg('cursor')::uuid IS NULL OR id < sqlc.narg('cursor')::uuid)
+ORDER BY id DESC
+LIMIT @row_limit;
+
+-- name: PurgeAuditEvents :execrows
+-- before より前に発生した監査ログを削除する
+DELETE FROM audit_events
+WHERE occurred_at < @before;
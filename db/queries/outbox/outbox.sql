@@ -0,0 +1,45 @@
+-- name: InsertOutboxEvent :exec
+INSERT INTO outbox (
+  id, tenant_id, event_type, aggregate_type, aggregate_id, payload, trace_context, occurred_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+);
+
+-- name: ClaimOutboxEvents :many
+-- 配信待ちのイベントを最大 max_events 件取り出し, next_attempt_at を lease_seconds 秒後にする (リース)
+-- 配信はトランザクションの外で行う. リースの間は他の relay が同じイベントを取り出さず, 結果を記録できなかったイベントはリースが切れた後に再び配信する
+WITH claimed AS (
+  SELECT id FROM outbox
+  WHERE status = 'pending' AND next_attempt_at <= NOW()
+  ORDER BY occurred_at
+  LIMIT @max_events
+  FOR UPDATE SKIP LOCKED
+)
+UPDATE outbox SET
+  next_attempt_at = NOW() + make_interval(secs => @lease_seconds::float8)
+FROM claimed
+WHERE outbox.id = claimed.id
+RETURNING outbox.*;
+
+-- name: MarkOutboxEventPublished :execrows
+-- attempts が取り出した時から変わっていない場合だけ記録する. リースが切れて他の relay が先に記録した場合は 0 件
+UPDATE outbox SET
+  status = 'published',
+  attempts = attempts + 1,
+  last_error = NULL,
+  published_at = NOW()
+WHERE id = $1 AND status = 'pending' AND attempts = $2;
+
+-- name: MarkOutboxEventFailed :execrows
+-- MarkOutboxEventPublished と同じく, attempts が変わっている場合は 0 件
+UPDATE outbox SET
+  status = $2,
+  attempts = attempts + 1,
+  last_error = $3,
+  next_attempt_at = $4
+WHERE id = $1 AND status = 'pending' AND attempts = $5;
+
+-- name: PurgePublishedOutboxEvents :execrows
+-- 配信済みで before より前に配信したイベントを削除する
+DELETE FROM outbox
+WHERE status = 'published' AND published_at < @before;
@@ -0,0 +1,41 @@
+-- name: ImportUsers :many
+-- email が同じテナントの既存のユーザーと重複する行は書き込まない. 書き込んだ行だけを返す
+INSERT INTO users (
+  id, name, email
+)
+SELECT
+  unnest(@ids::uuid[]),
+  unnest(@names::varchar[]),
+  unnest(@emails::varchar[])
+ON CONFLICT (tenant_id, email) DO NOTHING
+RETURNING *;
+
+-- name: UpsertUsers :many
+-- email が同じテナントの既存のユーザーと重複する行はその name を更新する. 書き込んだ行 (name が同じで更新しなかった行を除く) を返す
+-- inserted は新たに作成した行であれば true (更新した行は xmax が 0 でない)
+-- previous_name は更新した行の更新前の name (WITH の中の SELECT は INSERT の前の状態を読む). 作成した行は NULL
+WITH upserted AS (
+  INSERT INTO users (
+    id, name, email
+  )
+  SELECT
+    unnest(@ids::uuid[]),
+    unnest(@names::varchar[]),
+    unnest(@emails::varchar[])
+  ON CONFLICT (tenant_id, email) DO UPDATE SET
+    name = EXCLUDED.name
+  WHERE users.name IS DISTINCT FROM EXCLUDED.name
+  RETURNING *, (xmax = 0)::boolean AS inserted
+), previous AS (
+  SELECT id, name FROM users
+  WHERE email = ANY(@emails::varchar[])
+)
+SELECT upserted.*, previous.name AS previous_name
+FROM upserted
+LEFT JOIN previous ON previous.id = upserted.id;
+
+-- name: ListUsersAfter :many
+SELECT * FROM users
+WHERE (name, id) > (@after_name::varchar, @after_id::uuid)
+ORDER BY name, id
+LIMIT @row_limit;
@@ -2,6 +2,12 @@
 SELECT * FROM users
 WHERE id = $1 LIMIT 1;
 
+-- name: GetUserForUpdate :one
+-- 更新/削除の前の状態を読む. トランザクションが終わるまで他の更新/削除を待たせる
+SELECT * FROM users
+WHERE id = $1 LIMIT 1
+FOR UPDATE;
+
 -- name: ListUsers :many
 SELECT * FROM users
 ORDER BY name;
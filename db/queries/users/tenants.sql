@@ -0,0 +1,7 @@
+-- name: GetTenant :one
+SELECT * FROM tenants
+WHERE id = $1 LIMIT 1;
+
+-- name: GetTenantBySlug :one
+SELECT * FROM tenants
+WHERE slug = $1 LIMIT 1;
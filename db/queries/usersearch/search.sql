@@ -0,0 +1,15 @@
+-- name: SearchUsers :many
+-- query に一致するユーザーを関連度の高い順に返す
+-- 全文検索 (search_vector) に一致するか, name/email の一部と似ている (pg_trgm の word_similarity が pg_trgm.word_similarity_threshold 以上の) ユーザーが対象
+SELECT
+  id, name, email, created_at, updated_at, deleted_at, tenant_id,
+  (
+    ts_rank(search_vector, websearch_to_tsquery('simple', @query::text)) +
+    greatest(word_similarity(@query::text, name), word_similarity(@query::text, email))
+  )::real AS rank
+FROM users
+WHERE search_vector @@ websearch_to_tsquery('simple', @query::text)
+   OR @query::text <% name
+   OR @query::text <% email
+ORDER BY rank DESC, name, id
+LIMIT @row_limit;
@@ -0,0 +1,85 @@
+-- name: InsertWebhookDelivery :execrows
+-- 同じイベントを重複して受け取った場合 (at-least-once) は何もしない
+INSERT INTO webhook_deliveries (
+  id, tenant_id, webhook_id, event_id, event_type, payload
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (webhook_id, event_id) DO NOTHING;
+
+-- name: ClaimWebhookDeliveries :many
+-- 配信待ちの配信を最大 max_deliveries 件取り出し, next_attempt_at を lease_seconds 秒後にする (リース)
+-- 送信はトランザクションの外で行う. リースの間は他の deliverer が同じ配信を取り出さず, 結果を記録できなかった配信はリースが切れた後に再び送信する
+WITH claimed AS (
+  SELECT d.id
+  FROM webhook_deliveries d
+  JOIN webhooks w ON w.id = d.webhook_id
+  WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND w.enabled
+  ORDER BY d.next_attempt_at
+  LIMIT @max_deliveries
+  FOR UPDATE OF d SKIP LOCKED
+)
+UPDATE webhook_deliveries d SET
+  next_attempt_at = NOW() + make_interval(secs => @lease_seconds::float8)
+FROM claimed, webhooks w
+WHERE d.id = claimed.id AND w.id = d.webhook_id
+RETURNING
+  d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.attempts,
+  w.url, w.secret;
+
+-- name: MarkWebhookDeliverySucceeded :execrows
+-- attempts が取り出した時から変わっていない場合だけ記録する. リースが切れて他の deliverer が先に記録した場合は 0 件
+UPDATE webhook_deliveries SET
+  status = 'succeeded',
+  attempts = attempts + 1,
+  last_response_code = $2,
+  last_error = NULL,
+  updated_at = NOW(),
+  delivered_at = NOW()
+WHERE id = $1 AND status = 'pending' AND attempts = $3;
+
+-- name: MarkWebhookDeliveryFailed :execrows
+-- MarkWebhookDeliverySucceeded と同じく, attempts が変わっている場合は 0 件
+UPDATE webhook_deliveries SET
+  status = $2,
+  attempts = attempts + 1,
+  last_response_code = $3,
+  last_error = $4,
+  next_attempt_at = $5,
+  updated_at = NOW()
+WHERE id = $1 AND status = 'pending' AND attempts = $6;
+
+-- name: InsertWebhookDeliveryAttempt :exec
+INSERT INTO webhook_delivery_attempts (
+  delivery_id, attempt, response_code, error, duration_ms
+) VALUES (
+  $1, $2, $3, $4, $5
+);
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND webhook_id = $2;
+
+-- name: ListWebhookDeliveryAttempts :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempt;
+
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries SET
+  status = 'pending',
+  next_attempt_at = NOW(),
+  updated_at = NOW()
+WHERE id = $1 AND webhook_id = $2
+RETURNING *;
+
+-- name: PurgeWebhookDeliveries :execrows
+-- 完了 (succeeded/failed) して before より前に更新された配信を試行の履歴ごと削除する
+DELETE FROM webhook_deliveries
+WHERE status <> 'pending' AND updated_at < @before;
@@ -0,0 +1,56 @@
+-- name: ListWebhooks :many
+SELECT * FROM webhooks
+ORDER BY created_at;
+
+-- name: CreateWebhook :one
+INSERT INTO webhooks (
+  id, url, description, event_types, secret, enabled
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1;
+
+-- name: UpdateWebhook :one
+-- 無効から有効に戻した場合は連続失敗回数をリセットする
+UPDATE webhooks SET
+  url = @url,
+  description = @description,
+  event_types = @event_types,
+  secret = @secret,
+  consecutive_failures = CASE WHEN @enabled::boolean AND NOT enabled THEN 0 ELSE consecutive_failures END,
+  disabled_reason = CASE WHEN @enabled::boolean THEN NULL ELSE disabled_reason END,
+  enabled = @enabled::boolean,
+  updated_at = NOW()
+WHERE id = @id
+RETURNING *;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1;
+
+-- name: ListWebhooksForEvent :many
+-- Row Level Security に加えて, イベントのテナントの webhook に限定する (relay は全てのテナントを対象にしたトランザクションで呼ぶ)
+SELECT * FROM webhooks
+WHERE tenant_id = @tenant_id AND enabled AND (cardinality(event_types) = 0 OR @event_type::text = ANY(event_types));
+
+-- name: ResetWebhookFailures :exec
+UPDATE webhooks SET
+  consecutive_failures = 0
+WHERE id = $1 AND consecutive_failures <> 0;
+
+-- name: IncrementWebhookFailures :one
+-- 連続失敗回数が上限に達したら無効にする
+UPDATE webhooks SET
+  consecutive_failures = consecutive_failures + 1,
+  enabled = enabled AND consecutive_failures + 1 < @max_consecutive_failures::integer,
+  disabled_reason = CASE
+    WHEN enabled AND consecutive_failures + 1 >= @max_consecutive_failures::integer THEN @disabled_reason::text
+    ELSE disabled_reason
+  END,
+  updated_at = NOW()
+WHERE id = @id
+RETURNING *;
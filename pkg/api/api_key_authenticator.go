@@ -0,0 +1,230 @@
+// pkg/api/api_key_authenticator.go
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+const (
+	// gin.Context に保持する認証済みの API キーのキー
+	apiKeyKey = "api_key"
+
+	// API キーを受け取るヘッダ. Authorization: Bearer <key> でも受け取る
+	apiKeyHeader = "X-API-Key"
+
+	// キーの管理のルート (テンプレート) のリソース
+	apiKeysResource = "api-keys"
+
+	// webhook の管理のルート (テンプレート) のリソース
+	webhooksResource = "webhooks"
+
+	// 使われなくなったキーのレート制限の状態を捨てるまでの時間
+	apiKeyRateLimitIdleTTL = 10 * time.Minute
+)
+
+// 管理者に限るルート (テンプレート) のリソースと, エラーの詳細で使う名前
+var adminResources = map[string]string{
+	apiKeysResource:  "API keys",
+	webhooksResource: "webhooks",
+}
+
+// APIKeyAuthenticator は API キーでマシンクライアントを認証し, キーのスコープとレート制限を適用する
+// キーと webhook の管理 (/api-keys, /webhooks) は API キー以外の場合 admin_role または super-admin のロールに限る
+type APIKeyAuthenticator struct {
+	cfg            config.APIKeys
+	superAdminRole string
+	opsHandler     *operations.Handler
+	limiter        *KeyedRateLimiter
+	uriReference   *url.URL
+	logger         *slog.Logger
+}
+
+func NewAPIKeyAuthenticator(cfg config.APIKeys, superAdminRole string, opsHandler *operations.Handler, uriReferenceBase string, logger *slog.Logger) (*APIKeyAuthenticator, error) {
+
+	// uriReferenceBase
+	uriRef, err := url.Parse(uriReferenceBase)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to initialize api key authenticator"),
+			cerrors.WithMessagef("url: %s", uriReferenceBase),
+		)
+	}
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &APIKeyAuthenticator{
+		cfg:            cfg,
+		superAdminRole: superAdminRole,
+		opsHandler:     opsHandler,
+		limiter:        NewKeyedRateLimiter(apiKeyRateLimitIdleTTL),
+		uriReference:   uriRef,
+		logger:         logger,
+	}, nil
+}
+
+// Middleware は X-API-Key または Authorization: Bearer の API キーを認証し, OIDC と同じように主体とテナントのクレームを設定する
+// gbk_ で始まらない Bearer トークンは OIDC の認証ミドルウェアに任せる
+// キーにはルートのリソースのスコープ (GET/HEAD は read, それ以外は write) を要求する
+// OIDC の認証ミドルウェア (SetUserSubject, SetUserRoles) より後ろ, TenantResolver より前に置くこと
+func (p *APIKeyAuthenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		route := routeTemplate(c)
+		if slices.Contains(tenantExemptRoutes, route) {
+			c.Next()
+			return
+		}
+
+		key, found := apiKeyFromRequest(c)
+		if !found {
+			if name, ok := adminResource(route); ok && !p.administrable(c, name) {
+				return
+			}
+			c.Next()
+			return
+		}
+
+		logger := logging.FromContext(c.Request.Context())
+
+		if !p.cfg.Enabled {
+			logger.Warn("api key authentication is disabled")
+			p.abort(c, http.StatusUnauthorized, "/authentication-error", "API keys are not accepted.")
+			return
+		}
+
+		apiKey, err := p.opsHandler.AuthenticateAPIKey(c.Request.Context(), key, time.Duration(p.cfg.LastUsedIntervalSeconds)*time.Second)
+		switch {
+		case errorCodeOf(err) == errorCodeOf(cerrors.ErrAuthentication.New()):
+			logger.Warn("api key authentication failed", "error", err)
+			p.abort(c, http.StatusUnauthorized, "/authentication-error", "The API key is invalid, revoked or expired.")
+			return
+		case err != nil:
+			logger.Error("failed to authenticate api key", "error", err)
+			if rejected, ok := resilience.Rejected(err); ok {
+				setRetryAfter(c, rejected)
+			}
+			p.abort(c, http.StatusServiceUnavailable, "/service-unavailable", "The API key could not be verified.")
+			return
+		}
+
+		c.Set(apiKeyKey, apiKey)
+		setPrincipal(c, models.AuditActor{Type: models.AuditActorTypeAPIKey, ID: apiKey.ID.String()})
+		SetTenantClaim(c, apiKey.TenantID.String())
+
+		if rps, burst, limited := p.rateLimit(apiKey); limited {
+			if ok, delay := p.limiter.Allow(apiKey.ID.String(), rps, burst); !ok {
+				c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(delay.Seconds())))))
+				p.abort(c, http.StatusTooManyRequests, "/rate-limit-error", "The API key has exceeded its rate limit.")
+				return
+			}
+		}
+
+		// ルートに一致しない場合は 404 にするためスコープを確認しない
+		if route != "" {
+			scope := requiredAPIKeyScope(c.Request.Method, route)
+			if !apiKey.HasScope(scope) {
+				logger.Warn("api key lacks scope", "api_key_id", apiKey.ID, "scope", scope)
+				p.abort(c, http.StatusForbidden, "/authorization-error", "The API key does not have the "+string(scope)+" scope.")
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// administrable は API キー以外の主体が name (API keys, webhooks) を管理できるかを確認し, できない場合はリクエストを打ち切る
+func (p *APIKeyAuthenticator) administrable(c *gin.Context, name string) bool {
+
+	roles := UserRoles(c)
+	if slices.Contains(roles, p.cfg.AdminRole) || (p.superAdminRole != "" && slices.Contains(roles, p.superAdminRole)) {
+		return true
+	}
+	if UserSubject(c) == "" {
+		p.abort(c, http.StatusUnauthorized, "/authentication-error", "Authentication is required to manage "+name+".")
+		return false
+	}
+	p.abort(c, http.StatusForbidden, "/authorization-error", "You are not allowed to manage "+name+".")
+	return false
+}
+
+// rateLimit はキーに適用するレート制限を返す. キーに制限が無く既定値も無効の場合は false
+func (p *APIKeyAuthenticator) rateLimit(apiKey *models.APIKey) (rate.Limit, int, bool) {
+	if apiKey.RateLimitRPS > 0 {
+		return rate.Limit(apiKey.RateLimitRPS), apiKey.RateLimitBurst, true
+	}
+	if p.cfg.RateLimit.Enabled {
+		return rate.Limit(p.cfg.RateLimit.RPS), p.cfg.RateLimit.Burst, true
+	}
+	return 0, 0, false
+}
+
+func (p *APIKeyAuthenticator) abort(c *gin.Context, status int, problemType string, detail string) {
+	uriRef := *p.uriReference
+	uriRef.Path = path.Join("/", problemType)
+	c.AbortWithStatusJSON(status, openapi.ProblemDetails{
+		Type:   PtrOrNil(uriRef.String()),
+		Title:  PtrOrNil(http.StatusText(status)),
+		Status: PtrOrNil(int32(status)),
+		Detail: PtrOrNil(detail),
+	})
+}
+
+// AuthenticatedAPIKey は APIKeyAuthenticator が認証したキーを返す. API キーで認証していない場合は nil
+func AuthenticatedAPIKey(c *gin.Context) *models.APIKey {
+	value, ok := c.Get(apiKeyKey)
+	if !ok {
+		return nil
+	}
+	apiKey, _ := value.(*models.APIKey)
+	return apiKey
+}
+
+// apiKeyFromRequest は X-API-Key ヘッダ, または gbk_ で始まる Authorization: Bearer のトークンを返す
+func apiKeyFromRequest(c *gin.Context) (string, bool) {
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		return key, true
+	}
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") && operations.IsAPIKey(token) {
+		return token, true
+	}
+	return "", false
+}
+
+// requiredAPIKeyScope はルート (テンプレート) に必要なスコープを返す. リソースは最初のセグメント (/users:import の users)
+func requiredAPIKeyScope(method string, route string) models.APIKeyScope {
+	resource, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	resource, _, _ = strings.Cut(resource, ":")
+	write := method != http.MethodGet && method != http.MethodHead
+	return models.NewAPIKeyScope(resource, write)
+}
+
+// adminResource はルート (テンプレート) が管理者に限るリソースであれば, エラーの詳細で使う名前を返す
+func adminResource(route string) (string, bool) {
+	resource, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	name, ok := adminResources[resource]
+	return name, ok
+}
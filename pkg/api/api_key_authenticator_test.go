@@ -0,0 +1,205 @@
+// pkg/api/api_key_authenticator_test.go
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/memory"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+func newAPIKeyAuthenticatorRouter(t *testing.T, cfg config.APIKeys) (*gin.Engine, *operations.Handler) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	dbHandler, err := memory.NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opsHandler, err := operations.NewHandler(dbHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := NewAPIKeyAuthenticator(cfg, "super_admin", opsHandler, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	// OIDC の認証ミドルウェアの代わり
+	router.Use(func(c *gin.Context) {
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			SetUserSubject(c, "subject-1")
+			SetUserRoles(c, role)
+		}
+	})
+	router.Use(authenticator.Middleware())
+	handler := func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	}
+	router.GET("/users", handler)
+	router.POST("/users", handler)
+	router.GET("/api-keys", handler)
+	router.GET("/webhooks", handler)
+	router.POST("/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", handler)
+	router.GET("/health/liveness", handler)
+	return router, opsHandler
+}
+
+func issueTestAPIKey(t *testing.T, opsHandler *operations.Handler, prototype *models.APIKeyPrototype) *models.IssuedAPIKey {
+	t.Helper()
+	issued, err := opsHandler.IssueAPIKey(db.WithTenant(context.Background(), models.DefaultTenantID), nil, prototype)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issued
+}
+
+func TestAPIKeyAuthenticator_Authenticate(t *testing.T) {
+	router, opsHandler := newAPIKeyAuthenticatorRouter(t, config.NewConfig().APIKeys)
+
+	valid := issueTestAPIKey(t, opsHandler, &models.APIKeyPrototype{Name: "reader", Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead}}).Secret
+	expired := issueTestAPIKey(t, opsHandler, &models.APIKeyPrototype{Name: "expired", Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead}, ExpiresAt: time.Now().Add(time.Millisecond)}).Secret
+	revoked := issueTestAPIKey(t, opsHandler, &models.APIKeyPrototype{Name: "revoked", Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead}})
+	if _, err := opsHandler.RevokeAPIKey(db.WithTenant(context.Background(), models.DefaultTenantID), revoked.APIKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		value  string
+		want   int
+	}{
+		{name: "x-api-key", method: http.MethodGet, path: "/users", header: "X-API-Key", value: valid, want: http.StatusNoContent},
+		{name: "bearer", method: http.MethodGet, path: "/users", header: "Authorization", value: "Bearer " + valid, want: http.StatusNoContent},
+		{name: "other bearer token", method: http.MethodGet, path: "/users", header: "Authorization", value: "Bearer eyJhbGciOi", want: http.StatusNoContent},
+		{name: "unknown key", method: http.MethodGet, path: "/users", header: "X-API-Key", value: valid[:len(valid)-1] + "x", want: http.StatusUnauthorized},
+		{name: "malformed key", method: http.MethodGet, path: "/users", header: "X-API-Key", value: "gbk_x", want: http.StatusUnauthorized},
+		{name: "expired", method: http.MethodGet, path: "/users", header: "X-API-Key", value: expired, want: http.StatusUnauthorized},
+		{name: "revoked", method: http.MethodGet, path: "/users", header: "X-API-Key", value: revoked.Secret, want: http.StatusUnauthorized},
+		{name: "missing write scope", method: http.MethodPost, path: "/users", header: "X-API-Key", value: valid, want: http.StatusForbidden},
+		{name: "missing api-keys scope", method: http.MethodGet, path: "/api-keys", header: "X-API-Key", value: valid, want: http.StatusForbidden},
+		{name: "missing webhooks scope", method: http.MethodGet, path: "/webhooks", header: "X-API-Key", value: valid, want: http.StatusForbidden},
+		{name: "health is exempt", method: http.MethodGet, path: "/health/liveness", header: "X-API-Key", value: "gbk_x", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestAPIKeyAuthenticator_Disabled(t *testing.T) {
+	cfg := config.NewConfig().APIKeys
+	cfg.Enabled = false
+	router, opsHandler := newAPIKeyAuthenticatorRouter(t, cfg)
+	key := issueTestAPIKey(t, opsHandler, &models.APIKeyPrototype{Name: "reader", Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead}}).Secret
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIKeyAuthenticator_AdminRoutes(t *testing.T) {
+	router, opsHandler := newAPIKeyAuthenticatorRouter(t, config.NewConfig().APIKeys)
+
+	tests := []struct {
+		name string
+		role string
+		want int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "member", role: "member", want: http.StatusForbidden},
+		{name: "admin", role: "admin", want: http.StatusNoContent},
+		{name: "super admin", role: "super_admin", want: http.StatusNoContent},
+	}
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodGet, path: "/api-keys"},
+		{method: http.MethodGet, path: "/webhooks"},
+		{method: http.MethodPost, path: "/webhooks/1/deliveries/2/redeliver"},
+	}
+	for _, route := range routes {
+		for _, tt := range tests {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			if tt.role != "" {
+				req.Header.Set("X-Test-Role", tt.role)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("%s %s %s: status = %d; want %d", tt.name, route.method, route.path, w.Code, tt.want)
+			}
+		}
+	}
+
+	// webhooks:read のキーは webhook を参照できるが, 再送はできない
+	key := issueTestAPIKey(t, opsHandler, &models.APIKeyPrototype{Name: "integrations", Scopes: []models.APIKeyScope{models.APIKeyScopeWebhooksRead}}).Secret
+	for _, tt := range []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{method: http.MethodGet, path: "/webhooks", want: http.StatusNoContent},
+		{method: http.MethodPost, path: "/webhooks/1/deliveries/2/redeliver", want: http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("webhooks:read %s %s: status = %d; want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyAuthenticator_RateLimit(t *testing.T) {
+	router, opsHandler := newAPIKeyAuthenticatorRouter(t, config.NewConfig().APIKeys)
+	limited := issueTestAPIKey(t, opsHandler, &models.APIKeyPrototype{Name: "limited", Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead}, RateLimitRPS: 0.01, RateLimitBurst: 2}).Secret
+	other := issueTestAPIKey(t, opsHandler, &models.APIKeyPrototype{Name: "other", Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead}}).Secret
+
+	for i, want := range []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("X-API-Key", limited)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("request %d: status = %d; want %d", i, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("Retry-After header is missing")
+		}
+	}
+
+	// 制限はキーごと
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-API-Key", other)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("other key: status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,257 @@
+// pkg/api/api_keys.go
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// List all API keys
+// (GET /api-keys)
+func (p *StrictServerImpl) ListApiKeys(ctx context.Context, request openapi.ListApiKeysRequestObject) (openapi.ListApiKeysResponseObject, error) {
+
+	items, err := p.opsHandler.ListAPIKeys(ctx)
+	if err != nil {
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to list api keys"),
+		)
+		return openapi.ListApiKeys500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	}
+
+	retItems := make([]openapi.APIKey, 0, len(items))
+	for _, item := range items {
+		retItems = append(retItems, toAPIAPIKey(item))
+	}
+
+	return openapi.ListApiKeys200JSONResponse{
+		ApiKeys: retItems,
+	}, nil
+}
+
+// Issue a new API key
+// (POST /api-keys)
+func (p *StrictServerImpl) CreateApiKey(ctx context.Context, request openapi.CreateApiKeyRequestObject) (openapi.CreateApiKeyResponseObject, error) {
+
+	prototype := &models.APIKeyPrototype{
+		Name: request.Body.Name,
+	}
+	for _, scope := range request.Body.Scopes {
+		prototype.Scopes = append(prototype.Scopes, models.APIKeyScope(scope))
+	}
+	if request.Body.RateLimit != nil {
+		prototype.RateLimitRPS = request.Body.RateLimit.Rps
+		prototype.RateLimitBurst = int(request.Body.RateLimit.Burst)
+	}
+	if request.Body.ExpiresAt != nil {
+		if !request.Body.ExpiresAt.After(time.Now()) {
+			return openapi.CreateApiKey400JSONResponse{
+				Type:   PtrOrNil("/bad_request"),
+				Title:  PtrOrNil(http.StatusText(400)),
+				Status: PtrOrNil(int32(400)),
+				Detail: PtrOrNil("expires_at must be in the future"),
+			}, cerrors.ErrValidation.New(
+				cerrors.WithMessagef("expires_at is in the past: %s", request.Body.ExpiresAt),
+			)
+		}
+		prototype.ExpiresAt = *request.Body.ExpiresAt
+	}
+
+	issued, err := p.opsHandler.IssueAPIKey(ctx, callerAPIKey(ctx), prototype)
+	switch {
+	case errorCodeOf(err) == errorCodeAuthorization:
+		return openapi.CreateApiKey403JSONResponse(apiKeyScopeProblem()), err
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to issue api key"),
+		)
+		return openapi.CreateApiKey500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.CreateApiKey201JSONResponse{
+			ApiKey: toAPIAPIKey(issued.APIKey),
+			Secret: issued.Secret,
+		}, nil
+	}
+}
+
+// Get an API key by ID
+// (GET /api-keys/{api_key_id})
+func (p *StrictServerImpl) GetApiKeyById(ctx context.Context, request openapi.GetApiKeyByIdRequestObject) (openapi.GetApiKeyByIdResponseObject, error) {
+
+	apiKeyID, err := uuid.Parse(request.ApiKeyId)
+	if err != nil {
+		return openapi.GetApiKeyById404JSONResponse(notFoundProblem()), apiKeyNotFoundError(err)
+	}
+
+	apiKey, err := p.opsHandler.GetAPIKey(ctx, apiKeyID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.GetApiKeyById404JSONResponse(notFoundProblem()), apiKeyNotFoundError(err)
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to get api key"),
+		)
+		return openapi.GetApiKeyById500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.GetApiKeyById200JSONResponse{
+			ApiKey: toAPIAPIKey(apiKey),
+		}, nil
+	}
+}
+
+// Revoke an API key by ID
+// (DELETE /api-keys/{api_key_id})
+func (p *StrictServerImpl) RevokeApiKeyById(ctx context.Context, request openapi.RevokeApiKeyByIdRequestObject) (openapi.RevokeApiKeyByIdResponseObject, error) {
+
+	apiKeyID, err := uuid.Parse(request.ApiKeyId)
+	if err != nil {
+		return openapi.RevokeApiKeyById404JSONResponse(notFoundProblem()), apiKeyNotFoundError(err)
+	}
+
+	_, err = p.opsHandler.RevokeAPIKey(ctx, apiKeyID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.RevokeApiKeyById404JSONResponse(notFoundProblem()), apiKeyNotFoundError(err)
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to revoke api key"),
+		)
+		return openapi.RevokeApiKeyById500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		return openapi.RevokeApiKeyById204Response{}, nil
+	}
+}
+
+// Rotate an API key
+// (POST /api-keys/{api_key_id}/rotate)
+func (p *StrictServerImpl) RotateApiKey(ctx context.Context, request openapi.RotateApiKeyRequestObject) (openapi.RotateApiKeyResponseObject, error) {
+
+	apiKeyID, err := uuid.Parse(request.ApiKeyId)
+	if err != nil {
+		return openapi.RotateApiKey404JSONResponse(notFoundProblem()), apiKeyNotFoundError(err)
+	}
+
+	var gracePeriod time.Duration
+	if request.Body != nil && request.Body.GracePeriodSeconds != nil {
+		gracePeriod = time.Duration(*request.Body.GracePeriodSeconds) * time.Second
+	}
+
+	issued, err := p.opsHandler.RotateAPIKey(ctx, callerAPIKey(ctx), apiKeyID, gracePeriod)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.RotateApiKey404JSONResponse(notFoundProblem()), apiKeyNotFoundError(err)
+	case errorCodeOf(err) == errorCodeAuthorization:
+		return openapi.RotateApiKey403JSONResponse(apiKeyScopeProblem()), err
+	case errorCodeOf(err) == errorCodeInvalidState:
+		return openapi.RotateApiKey409JSONResponse{
+			Type:   PtrOrNil("/conflict"),
+			Title:  PtrOrNil(http.StatusText(409)),
+			Status: PtrOrNil(int32(409)),
+			Detail: PtrOrNil("the api key is revoked or expired"),
+		}, err
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to rotate api key"),
+		)
+		return openapi.RotateApiKey500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.RotateApiKey201JSONResponse{
+			ApiKey: toAPIAPIKey(issued.APIKey),
+			Secret: issued.Secret,
+		}, nil
+	}
+}
+
+func apiKeyNotFoundError(err error) error {
+	return cerrors.ErrDBNotFound.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("api key not found"),
+	)
+}
+
+// callerAPIKey はリクエストを認証した API キーを返す. strict handler の ctx は *gin.Context. API キーで認証していない場合は nil
+func callerAPIKey(ctx context.Context) *models.APIKey {
+	c, ok := ctx.(*gin.Context)
+	if !ok {
+		return nil
+	}
+	return AuthenticatedAPIKey(c)
+}
+
+func apiKeyScopeProblem() openapi.ProblemDetails {
+	return openapi.ProblemDetails{
+		Type:   PtrOrNil("/forbidden"),
+		Title:  PtrOrNil(http.StatusText(403)),
+		Status: PtrOrNil(int32(403)),
+		Detail: PtrOrNil("The API key cannot grant scopes it does not have."),
+	}
+}
+
+// toAPIAPIKey は models.APIKey を API の表現に変換する. ハッシュは含めない
+func toAPIAPIKey(apiKey *models.APIKey) openapi.APIKey {
+	scopes := make([]openapi.APIKeyScope, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		scopes = append(scopes, openapi.APIKeyScope(scope))
+	}
+	ret := openapi.APIKey{
+		Id:          apiKey.ID,
+		TenantId:    apiKey.TenantID,
+		Name:        apiKey.Name,
+		Prefix:      apiKey.Prefix,
+		Scopes:      scopes,
+		RotatedFrom: PtrOrNil(apiKey.RotatedFrom),
+		CreatedAt:   apiKey.CreatedAt,
+		UpdatedAt:   apiKey.UpdatedAt,
+	}
+	if apiKey.RateLimitRPS > 0 {
+		ret.RateLimit = &openapi.APIKeyRateLimit{
+			Rps:   apiKey.RateLimitRPS,
+			Burst: int32(apiKey.RateLimitBurst),
+		}
+	}
+	if !apiKey.ExpiresAt.IsZero() {
+		ret.ExpiresAt = Ptr(apiKey.ExpiresAt)
+	}
+	if !apiKey.LastUsedAt.IsZero() {
+		ret.LastUsedAt = Ptr(apiKey.LastUsedAt)
+	}
+	if !apiKey.RevokedAt.IsZero() {
+		ret.RevokedAt = Ptr(apiKey.RevokedAt)
+	}
+	return ret
+}
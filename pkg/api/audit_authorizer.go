@@ -0,0 +1,87 @@
+// pkg/api/audit_authorizer.go
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+)
+
+// 監査ログの参照のルート (テンプレート)
+const auditEventsRoute = "/audit-events"
+
+// AuditAuthorizer は監査ログの参照 (/audit-events) を audit.admin_role または super-admin のロールに限る
+// API キーのリクエストは APIKeyAuthenticator が audit-events:read のスコープを確認する
+type AuditAuthorizer struct {
+	cfg            config.Audit
+	superAdminRole string
+	uriReference   *url.URL
+	logger         *slog.Logger
+}
+
+func NewAuditAuthorizer(cfg config.Audit, superAdminRole string, uriReferenceBase string, logger *slog.Logger) (*AuditAuthorizer, error) {
+
+	// uriReferenceBase
+	uriRef, err := url.Parse(uriReferenceBase)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to initialize audit authorizer"),
+			cerrors.WithMessagef("url: %s", uriReferenceBase),
+		)
+	}
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &AuditAuthorizer{
+		cfg:            cfg,
+		superAdminRole: superAdminRole,
+		uriReference:   uriRef,
+		logger:         logger,
+	}, nil
+}
+
+// Middleware は監査ログの参照のルートを呼べるかを確認し, 呼べない場合はリクエストを打ち切る
+// OIDC の認証ミドルウェア (SetUserSubject, SetUserRoles), SessionTracker と APIKeyAuthenticator より後ろに置くこと
+func (p *AuditAuthorizer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if routeTemplate(c) != auditEventsRoute || AuthenticatedAPIKey(c) != nil {
+			c.Next()
+			return
+		}
+
+		roles := UserRoles(c)
+		if slices.Contains(roles, p.cfg.AdminRole) || (p.superAdminRole != "" && slices.Contains(roles, p.superAdminRole)) {
+			c.Next()
+			return
+		}
+		if UserSubject(c) == "" {
+			p.abort(c, http.StatusUnauthorized, "/authentication-error", "Authentication is required to read audit events.")
+			return
+		}
+		p.abort(c, http.StatusForbidden, "/authorization-error", "You are not allowed to read audit events.")
+	}
+}
+
+func (p *AuditAuthorizer) abort(c *gin.Context, status int, problemType string, detail string) {
+	uriRef := *p.uriReference
+	uriRef.Path = path.Join("/", problemType)
+	c.AbortWithStatusJSON(status, openapi.ProblemDetails{
+		Type:   PtrOrNil(uriRef.String()),
+		Title:  PtrOrNil(http.StatusText(status)),
+		Status: PtrOrNil(int32(status)),
+		Detail: PtrOrNil(detail),
+	})
+}
@@ -0,0 +1,59 @@
+// pkg/api/audit_authorizer_test.go
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/config"
+)
+
+func TestAuditAuthorizer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authorizer, err := NewAuditAuthorizer(config.NewConfig().Audit, "super_admin", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	// OIDC の認証ミドルウェアの代わり
+	router.Use(func(c *gin.Context) {
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			SetUserSubject(c, "subject-1")
+			SetUserRoles(c, role)
+		}
+	})
+	router.Use(authorizer.Middleware())
+	handler := func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	}
+	router.GET("/audit-events", handler)
+	router.GET("/users", handler)
+
+	tests := []struct {
+		name string
+		path string
+		role string
+		want int
+	}{
+		{name: "anonymous", path: "/audit-events", want: http.StatusUnauthorized},
+		{name: "member", path: "/audit-events", role: "member", want: http.StatusForbidden},
+		{name: "admin", path: "/audit-events", role: "admin", want: http.StatusNoContent},
+		{name: "super admin", path: "/audit-events", role: "super_admin", want: http.StatusNoContent},
+		{name: "other route", path: "/users", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.role != "" {
+			req.Header.Set("X-Test-Role", tt.role)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// pkg/api/audit_events.go
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// List audit events
+// (GET /audit-events)
+func (p *StrictServerImpl) ListAuditEvents(ctx context.Context, request openapi.ListAuditEventsRequestObject) (openapi.ListAuditEventsResponseObject, error) {
+
+	params := models.ListAuditEventsParams{}
+	if request.Params.Action != nil {
+		params.Action = models.AuditAction(*request.Params.Action)
+	}
+	if request.Params.ActorType != nil {
+		params.ActorType = models.AuditActorType(*request.Params.ActorType)
+	}
+	if request.Params.ActorId != nil {
+		params.ActorID = *request.Params.ActorId
+	}
+	if request.Params.TargetType != nil {
+		params.TargetType = *request.Params.TargetType
+	}
+	if request.Params.TargetId != nil {
+		params.TargetID = *request.Params.TargetId
+	}
+	if request.Params.Since != nil {
+		params.Since = *request.Params.Since
+	}
+	if request.Params.Until != nil {
+		params.Until = *request.Params.Until
+	}
+	if request.Params.Cursor != nil {
+		params.Cursor = *request.Params.Cursor
+	}
+	if request.Params.Limit != nil {
+		params.Limit = int(*request.Params.Limit)
+	}
+
+	items, nextCursor, err := p.opsHandler.ListAuditEvents(ctx, params)
+	if err != nil {
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to list audit events"),
+		)
+		return openapi.ListAuditEvents500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	}
+
+	retItems := make([]openapi.AuditEvent, 0, len(items))
+	for _, item := range items {
+		retItem, err := toAPIAuditEvent(item)
+		if err != nil {
+			return openapi.ListAuditEvents500JSONResponse{
+				Type:   PtrOrNil("/internal_server_error"),
+				Title:  PtrOrNil(http.StatusText(500)),
+				Status: PtrOrNil(int32(500)),
+			}, err
+		}
+		retItems = append(retItems, retItem)
+	}
+
+	return openapi.ListAuditEvents200JSONResponse{
+		AuditEvents: retItems,
+		NextCursor:  PtrOrNil(nextCursor),
+	}, nil
+}
+
+func toAPIAuditEvent(event *models.AuditEvent) (openapi.AuditEvent, error) {
+
+	before, err := toAPIAuditState(event.ID, event.Before)
+	if err != nil {
+		return openapi.AuditEvent{}, err
+	}
+	after, err := toAPIAuditState(event.ID, event.After)
+	if err != nil {
+		return openapi.AuditEvent{}, err
+	}
+
+	return openapi.AuditEvent{
+		Id:       event.ID,
+		TenantId: event.TenantID,
+		Action:   openapi.AuditAction(event.Action),
+		Actor: openapi.AuditActor{
+			Type: openapi.AuditActorType(event.Actor.Type),
+			Id:   PtrOrNil(event.Actor.ID),
+		},
+		Target: openapi.AuditTarget{
+			Type: event.TargetType,
+			Id:   event.TargetID,
+		},
+		Before:     before,
+		After:      after,
+		RequestId:  PtrOrNil(event.RequestID),
+		TraceId:    PtrOrNil(event.TraceID),
+		ClientIp:   PtrOrNil(event.ClientIP),
+		UserAgent:  PtrOrNil(event.UserAgent),
+		OccurredAt: event.OccurredAt,
+	}, nil
+}
+
+// toAPIAuditState は監査ログに記録した変更前/変更後の値 (JSON オブジェクト) を返す. 記録されていない場合は nil
+func toAPIAuditState(eventID uuid.UUID, data json.RawMessage) (*map[string]any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	state := map[string]any{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("failed to unmarshal state of audit event %s", eventID),
+		)
+	}
+	return &state, nil
+}
@@ -0,0 +1,206 @@
+// pkg/api/audit_events_test.go
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aazw/go-base/pkg/api"
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+	"github.com/aazw/go-base/pkg/testkit"
+)
+
+// auditReaderKey は監査ログを参照できる (audit-events:read) API キーを発行する
+func auditReaderKey(t *testing.T, s *testkit.Server) string {
+	t.Helper()
+
+	opsHandler, err := operations.NewHandler(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := opsHandler.IssueAPIKey(db.WithTenant(context.Background(), models.DefaultTenantID), nil, &models.APIKeyPrototype{
+		Name:   "audit-reader",
+		Scopes: []models.APIKeyScope{models.APIKeyScopeAuditEventsRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issued.Secret
+}
+
+func listAuditEvents(t *testing.T, s *testkit.Server, params openapi.ListAuditEventsParams) openapi.AuditEventsListResponse {
+	t.Helper()
+
+	key := auditReaderKey(t, s)
+	resp, err := s.Client.ListAuditEventsWithResponse(context.Background(), &params, func(_ context.Context, req *http.Request) error {
+		req.Header.Set("X-API-Key", key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.JSON200 == nil {
+		t.Fatalf("GET /audit-events status = %d; want 200 (body %s)", resp.StatusCode(), resp.Body)
+	}
+	return *resp.JSON200
+}
+
+func TestE2E_AuditEvents(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+
+	withHeaders := func(ctx context.Context, req *http.Request) error {
+		req.Header.Set(api.RequestIDHeader, "req-audit-1")
+		req.Header.Set("User-Agent", "audit-test/1.0")
+		return nil
+	}
+	created, err := s.Client.CreateUserWithResponse(ctx, openapi.CreateUserJSONRequestBody{Name: "bob", Email: "bob@example.com"}, withHeaders)
+	if err != nil || created.JSON201 == nil {
+		t.Fatalf("POST /users = %v %v; want 201", created, err)
+	}
+	bob := created.JSON201.User
+	alice := createUser(t, s, "alice", "alice@example.com")
+
+	name := "robert"
+	if resp, err := s.Client.UpdateUserByIdWithResponse(ctx, bob.Id.String(), openapi.UpdateUserByIdJSONRequestBody{Name: &name, Email: &bob.Email}); err != nil || resp.JSON200 == nil {
+		t.Fatalf("PATCH /users/{id} = %v %v; want 200", resp, err)
+	}
+	if resp, err := s.Client.DeleteUserByIdWithResponse(ctx, bob.Id.String()); err != nil || resp.StatusCode() != http.StatusNoContent {
+		t.Fatalf("DELETE /users/{id} = %v %v; want 204", resp, err)
+	}
+
+	// 失敗した変更 (email の重複) は記録しない
+	carol := createUser(t, s, "carol", "carol@example.com")
+	if resp, err := s.Client.UpdateUserByIdWithResponse(ctx, carol.Id.String(), openapi.UpdateUserByIdJSONRequestBody{Name: &carol.Name, Email: &alice.Email}); err != nil || resp.JSON200 != nil {
+		t.Fatalf("PATCH /users/{id} with a used email = %v %v; want an error", resp, err)
+	}
+
+	t.Run("target", func(t *testing.T) {
+		list := listAuditEvents(t, s, openapi.ListAuditEventsParams{TargetId: &bob.Id})
+		events := list.AuditEvents
+		if len(events) != 3 || list.NextCursor != nil {
+			t.Fatalf("audit_events = %+v; want 3 events of bob", events)
+		}
+
+		// 新しい順
+		deleted, updated, created := events[0], events[1], events[2]
+		if created.Action != openapi.AuditActionCreate || created.Before != nil || (*created.After)["name"] != "bob" || (*created.After)["email"] != "bob@example.com" {
+			t.Errorf("create = %+v; want after with name and email", created)
+		}
+		if created.Actor.Type != openapi.Anonymous || created.Target.Type != "user" || created.Target.Id != bob.Id {
+			t.Errorf("create actor/target = %+v %+v; want anonymous on user %s", created.Actor, created.Target, bob.Id)
+		}
+		// マルチテナントが無効の場合はデフォルトのテナント
+		if created.TenantId != models.DefaultTenantID {
+			t.Errorf("create tenant_id = %s; want %s", created.TenantId, models.DefaultTenantID)
+		}
+		if created.RequestId == nil || *created.RequestId != "req-audit-1" || created.UserAgent == nil || *created.UserAgent != "audit-test/1.0" {
+			t.Errorf("create request = %v %v; want request id and user agent", created.RequestId, created.UserAgent)
+		}
+
+		// 更新は変更された項目のみ
+		if updated.Action != openapi.AuditActionUpdate || len(*updated.Before) != 1 || (*updated.Before)["name"] != "bob" || len(*updated.After) != 1 || (*updated.After)["name"] != "robert" {
+			t.Errorf("update = %+v %+v; want only the name changed", updated.Before, updated.After)
+		}
+		if deleted.Action != openapi.AuditActionDelete || deleted.After != nil || (*deleted.Before)["name"] != "robert" {
+			t.Errorf("delete = %+v; want before with name robert", deleted)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		action := openapi.AuditActionCreate
+		list := listAuditEvents(t, s, openapi.ListAuditEventsParams{Action: &action})
+		if len(list.AuditEvents) != 3 {
+			t.Errorf("len(audit_events) with action=create = %d; want 3", len(list.AuditEvents))
+		}
+
+		list = listAuditEvents(t, s, openapi.ListAuditEventsParams{TargetId: &alice.Id, Action: &action})
+		if len(list.AuditEvents) != 1 || list.AuditEvents[0].Target.Id != alice.Id {
+			t.Errorf("audit_events of alice = %+v; want the create", list.AuditEvents)
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		limit := int32(2)
+		seen := map[string]bool{}
+		params := openapi.ListAuditEventsParams{Limit: &limit}
+		for page := 0; ; page++ {
+			list := listAuditEvents(t, s, params)
+			for _, event := range list.AuditEvents {
+				if seen[event.Id.String()] {
+					t.Fatalf("page %d: event %s returned twice", page, event.Id)
+				}
+				seen[event.Id.String()] = true
+			}
+			if list.NextCursor == nil {
+				break
+			}
+			params.Cursor = list.NextCursor
+		}
+		if len(seen) != 5 {
+			t.Errorf("events over all pages = %d; want 5", len(seen))
+		}
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		tests := []string{
+			"/audit-events?limit=101",
+			"/audit-events?action=restore",
+			"/audit-events?target_id=not-a-uuid",
+			"/audit-events?since=yesterday",
+		}
+		key := auditReaderKey(t, s)
+		for _, target := range tests {
+			req, _ := http.NewRequest(http.MethodGet, testkit.BaseURL+target, nil)
+			req.Header.Set("X-API-Key", key)
+			resp, err := s.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("GET %s status = %d; want 400", target, resp.StatusCode)
+			}
+		}
+	})
+}
+
+func TestE2E_AuditEvents_Authorization(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+
+	opsHandler, err := operations.NewHandler(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := opsHandler.IssueAPIKey(db.WithTenant(ctx, models.DefaultTenantID), nil, &models.APIKeyPrototype{
+		Name:   "users-reader",
+		Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous, err := s.Client.ListAuditEventsWithResponse(ctx, &openapi.ListAuditEventsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymous.JSON401 == nil {
+		t.Errorf("GET /audit-events without credentials = %d %s; want 401", anonymous.StatusCode(), anonymous.Body)
+	}
+
+	forbidden, err := s.Client.ListAuditEventsWithResponse(ctx, &openapi.ListAuditEventsParams{}, func(_ context.Context, req *http.Request) error {
+		req.Header.Set("X-API-Key", reader.Secret)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forbidden.JSON403 == nil {
+		t.Errorf("GET /audit-events without audit-events:read = %d %s; want 403", forbidden.StatusCode(), forbidden.Body)
+	}
+}
@@ -0,0 +1,198 @@
+// pkg/api/csrf.go
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+// CSRF トークンのバイト数
+const csrfTokenBytes = 32
+
+// CSRF の確認が不要な (状態を変えない) メソッド
+var csrfSafeMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// CSRFProtector はセッション (Cookie) で認証したリクエストを CSRF から守る
+// トークンはセッションに保存する (synchronizer token). 主体を記録したときに SessionTracker が破棄するため, ログインごとに変わる
+type CSRFProtector struct {
+	cfg          config.CSRF
+	sm           *scs.SessionManager
+	origins      []string
+	uriReference *url.URL
+	logger       *slog.Logger
+}
+
+// NewCSRFProtector は CSRFProtector を生成する. cors が有効な場合は cors.AllowOrigins の Origin も許可する
+func NewCSRFProtector(cfg config.CSRF, cors config.CORS, sm *scs.SessionManager, uriReferenceBase string, logger *slog.Logger) (*CSRFProtector, error) {
+
+	// uriReferenceBase
+	uriRef, err := url.Parse(uriReferenceBase)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to initialize csrf protector"),
+			cerrors.WithMessagef("url: %s", uriReferenceBase),
+		)
+	}
+
+	// 許可する Origin. ワイルドカードは CSRF の確認には使わない
+	var origins []string
+	if cors.Enabled {
+		for _, origin := range cors.AllowOrigins {
+			if origin != "*" {
+				origins = append(origins, strings.ToLower(strings.TrimSuffix(origin, "/")))
+			}
+		}
+	}
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &CSRFProtector{
+		cfg:          cfg,
+		sm:           sm,
+		origins:      origins,
+		uriReference: uriRef,
+		logger:       logger,
+	}, nil
+}
+
+// HeaderName はトークンを受け取るヘッダの名前を返す
+func (p *CSRFProtector) HeaderName() string {
+	return p.cfg.HeaderName
+}
+
+// Token はセッションの CSRF トークンを返す. セッションにトークンが無い場合は生成して保存する
+func (p *CSRFProtector) Token(ctx context.Context) (string, error) {
+
+	if !hasSession(p.sm, ctx) {
+		return "", cerrors.ErrSystemInternal.New(
+			cerrors.WithMessage("session is not loaded"),
+		)
+	}
+	if token := p.sm.GetString(ctx, sessionCSRFTokenKey); token != "" {
+		return token, nil
+	}
+
+	buf := make([]byte, csrfTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to generate csrf token"),
+		)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	p.sm.Put(ctx, sessionCSRFTokenKey, token)
+	return token, nil
+}
+
+// Middleware は状態を変えるリクエストのうち, セッションに記録した主体で認証したものに
+// 許可した Origin (Origin が無い場合は Referer) と, セッションのトークンと一致するヘッダを要求する
+// API キーで認証したリクエストと, 認証ミドルウェアが Bearer トークンから主体を検証したリクエストはブラウザが自動で付けないため対象外
+// Authorization ヘッダがあっても主体をセッションから設定した (トークンを検証できなかった) 場合は対象にする
+// SessionTracker と APIKeyAuthenticator より後ろに置くこと
+func (p *CSRFProtector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx := c.Request.Context()
+		if slices.Contains(csrfSafeMethods, c.Request.Method) ||
+			!hasSession(p.sm, ctx) ||
+			p.sm.GetString(ctx, sessionSubjectKey) == "" {
+			c.Next()
+			return
+		}
+		if AuthenticatedAPIKey(c) != nil || (UserSubject(c) != "" && !sessionRestored(c)) {
+			c.Next()
+			return
+		}
+
+		logger := logging.FromContext(ctx)
+
+		if origin, ok := requestOrigin(c.Request); ok && !p.allowedOrigin(c.Request, origin) {
+			logger.Warn("csrf origin mismatch", "origin", origin)
+			p.abort(c, "The request origin is not allowed.")
+			return
+		}
+
+		expected := p.sm.GetString(ctx, sessionCSRFTokenKey)
+		actual := c.GetHeader(p.cfg.HeaderName)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+			logger.Warn("csrf token mismatch", "header", p.cfg.HeaderName, "present", actual != "")
+			p.abort(c, "The CSRF token is missing or invalid.")
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowedOrigin は origin がリクエストのホスト自身か, 許可した Origin (URI またはホスト名) に一致するかを返す
+func (p *CSRFProtector) allowedOrigin(r *http.Request, origin string) bool {
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	normalized := strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, allowed := range p.origins {
+		if allowed == normalized || allowed == strings.ToLower(u.Host) || allowed == strings.ToLower(u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CSRFProtector) abort(c *gin.Context, detail string) {
+	uriRef := *p.uriReference
+	uriRef.Path = path.Join("/", "/csrf-error")
+	c.AbortWithStatusJSON(http.StatusForbidden, openapi.ProblemDetails{
+		Type:   PtrOrNil(uriRef.String()),
+		Title:  PtrOrNil(http.StatusText(http.StatusForbidden)),
+		Status: PtrOrNil(int32(http.StatusForbidden)),
+		Detail: PtrOrNil(detail),
+	})
+}
+
+// requestOrigin はリクエストの Origin を返す. Origin が無い場合は Referer の Origin を返す
+// どちらも無い場合 (ブラウザ以外のクライアント) は false. トークンの確認だけを行う
+func requestOrigin(r *http.Request) (string, bool) {
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin, true
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		return "", false
+	}
+	u, err := url.Parse(referer)
+	if err != nil {
+		// 解釈できない Referer は許可しない Origin として扱う
+		return referer, true
+	}
+	return u.Scheme + "://" + u.Host, true
+}
@@ -0,0 +1,86 @@
+// pkg/api/csrf_test.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/config"
+)
+
+func csrfToken(t *testing.T, client *sessionClient) openapi.CSRFToken {
+	t.Helper()
+	w := client.do(t, http.MethodGet, "/auth/csrf", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /auth/csrf status = %d; want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp openapi.CSRFToken
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCSRFProtector_Middleware(t *testing.T) {
+	router := newSessionTrackerRouter(t, &config.CORS{
+		Enabled:      true,
+		AllowOrigins: []string{"https://app.example.com", "admin.example.com", "*"},
+	})
+	admin := &sessionClient{router: router, userAgent: "admin"}
+
+	before := csrfToken(t, admin)
+	admin.login(t, "carol", "admin")
+	token := csrfToken(t, admin)
+	if token.HeaderName != "X-CSRF-Token" || token.Token == "" {
+		t.Fatalf("csrf token = %+v; want token in X-CSRF-Token", token)
+	}
+	// ログインでトークンが変わる
+	if token.Token == before.Token {
+		t.Errorf("csrf token was not rotated on login")
+	}
+	if again := csrfToken(t, admin); again.Token != token.Token {
+		t.Errorf("csrf token changed within the session: %q -> %q", token.Token, again.Token)
+	}
+
+	body := openapi.SessionsRevocation{UserSubject: "nobody"}
+	tests := []struct {
+		name   string
+		header []string
+		want   int
+	}{
+		{name: "no token", want: http.StatusForbidden},
+		{name: "token before login", header: []string{"X-CSRF-Token", before.Token}, want: http.StatusForbidden},
+		{name: "token", header: []string{"X-CSRF-Token", token.Token}, want: http.StatusOK},
+		{name: "same origin", header: []string{"X-CSRF-Token", token.Token, "Origin", "http://example.com"}, want: http.StatusOK},
+		{name: "allowed uri origin", header: []string{"X-CSRF-Token", token.Token, "Origin", "https://app.example.com"}, want: http.StatusOK},
+		{name: "allowed host origin", header: []string{"X-CSRF-Token", token.Token, "Origin", "https://admin.example.com"}, want: http.StatusOK},
+		{name: "cross origin", header: []string{"X-CSRF-Token", token.Token, "Origin", "https://evil.example.net"}, want: http.StatusForbidden},
+		{name: "null origin", header: []string{"X-CSRF-Token", token.Token, "Origin", "null"}, want: http.StatusForbidden},
+		{name: "same origin referer", header: []string{"X-CSRF-Token", token.Token, "Referer", "http://example.com/admin"}, want: http.StatusOK},
+		{name: "cross origin referer", header: []string{"X-CSRF-Token", token.Token, "Referer", "https://evil.example.net/"}, want: http.StatusForbidden},
+		// 認証ミドルウェアが Bearer トークンから主体を検証したリクエストはブラウザが自動で付けない
+		{name: "verified bearer token", header: []string{"Authorization", "Bearer token", "X-Test-Subject", "carol", "X-Test-Role", "admin"}, want: http.StatusOK},
+		// 検証できなかった Authorization ヘッダではセッションの主体になるため対象にする
+		{name: "unverified authorization header", header: []string{"Authorization", "Bearer token"}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := admin.do(t, http.MethodPost, "/sessions:revoke", body, tt.header...)
+			if w.Code != tt.want {
+				t.Fatalf("POST /sessions:revoke status = %d; want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want == http.StatusForbidden && !strings.Contains(w.Body.String(), "https://example.com/csrf-error") {
+				t.Errorf("body = %s; want csrf-error problem", w.Body.String())
+			}
+		})
+	}
+
+	// 主体の無いセッションは対象外
+	anonymous := &sessionClient{router: router}
+	if w := anonymous.do(t, http.MethodPost, "/sessions:revoke", body); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous POST /sessions:revoke status = %d; want 401", w.Code)
+	}
+}
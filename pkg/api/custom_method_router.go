@@ -0,0 +1,114 @@
+// pkg/api/custom_method_router.go
+package api
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// customMethodParam はカスタムメソッドのルートで, メソッド名 (":import" 等) を受け取るパラメータ
+const customMethodParam = "customMethod"
+
+// customMethodRoutes は登録したカスタムメソッドのルート ("POST /users:import" 等). ルートのラベルに使う
+var customMethodRoutes sync.Map
+
+// customMethodRouter はカスタムメソッド (POST /users:import 等. https://google.aip.dev/136) のルートを gin に登録する
+//
+// gin はパスの途中の ':' をパラメータの始まりとして扱うため, /users:import と /users:export を同じメソッドで登録すると衝突し,
+// /usersfoo 等にもマッチしてしまう. 接頭辞 (/users) とメソッド毎に /users:customMethod を 1 つだけ登録し, メソッド名で振り分ける
+// その他のルートはそのまま登録する
+type customMethodRouter struct {
+	gin.IRouter
+	handlers map[string]map[string]gin.HandlersChain // "POST /users" -> ":import" -> handlers
+}
+
+func newCustomMethodRouter(router gin.IRouter) *customMethodRouter {
+	return &customMethodRouter{
+		IRouter:  router,
+		handlers: map[string]map[string]gin.HandlersChain{},
+	}
+}
+
+func (r *customMethodRouter) Handle(httpMethod string, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+
+	prefix, customMethod, ok := splitCustomMethod(relativePath)
+	if !ok {
+		return r.IRouter.Handle(httpMethod, relativePath, handlers...)
+	}
+
+	key := httpMethod + " " + prefix
+	if _, ok := r.handlers[key]; !ok {
+		r.handlers[key] = map[string]gin.HandlersChain{}
+		r.IRouter.Handle(httpMethod, prefix+":"+customMethodParam, r.dispatch(key))
+	}
+	r.handlers[key][customMethod] = handlers
+	customMethodRoutes.Store(httpMethod+" "+relativePath, struct{}{})
+	return r
+}
+
+func (r *customMethodRouter) GET(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (r *customMethodRouter) POST(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (r *customMethodRouter) DELETE(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
+func (r *customMethodRouter) PATCH(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodPatch, relativePath, handlers...)
+}
+
+func (r *customMethodRouter) PUT(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+// dispatch はメソッド名に対応するハンドラを呼ぶ. 登録していないメソッド名は gin と同じく 404 にする
+func (r *customMethodRouter) dispatch(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handlers, ok := r.handlers[key][c.Param(customMethodParam)]
+		if !ok {
+			c.String(http.StatusNotFound, "404 page not found")
+			return
+		}
+		for _, handler := range handlers {
+			if c.IsAborted() {
+				return
+			}
+			handler(c)
+		}
+	}
+}
+
+// splitCustomMethod は /users:import を /users と :import に分ける. 最後のセグメントの途中に ':' が無ければ false を返す
+func splitCustomMethod(path string) (string, string, bool) {
+	segment := path[strings.LastIndexByte(path, '/')+1:]
+	i := strings.IndexByte(segment, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	i += len(path) - len(segment)
+	return path[:i], path[i:], true
+}
+
+// routeTemplate はメトリクスやログのラベルに使うルートを返す. どのルートにもマッチしなかった場合は空
+// カスタムメソッドの場合は /users:customMethod ではなく /users:import を返す
+func routeTemplate(c *gin.Context) string {
+
+	route := c.FullPath()
+	prefix, ok := strings.CutSuffix(route, ":"+customMethodParam)
+	if !ok {
+		return route
+	}
+	route = prefix + c.Param(customMethodParam)
+	if _, ok := customMethodRoutes.Load(c.Request.Method + " " + route); !ok {
+		return ""
+	}
+	return route
+}
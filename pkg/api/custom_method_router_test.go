@@ -0,0 +1,78 @@
+// pkg/api/custom_method_router_test.go
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCustomMethodRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	var gotRoute string
+	router.Use(func(c *gin.Context) {
+		c.Next()
+		gotRoute = routeTemplate(c)
+	})
+	routes := newCustomMethodRouter(router)
+	handler := func(name string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.String(http.StatusOK, name)
+		}
+	}
+	// 同じ接頭辞に GET のカスタムメソッドを 2 つ登録しても衝突しない
+	routes.GET("/users", handler("list"))
+	routes.GET("/users:export", handler("export"))
+	routes.GET("/users:search", handler("search"))
+	routes.POST("/users:import", handler("import"))
+
+	tests := []struct {
+		method    string
+		path      string
+		wantCode  int
+		wantBody  string
+		wantRoute string
+	}{
+		{http.MethodGet, "/users", http.StatusOK, "list", "/users"},
+		{http.MethodGet, "/users:export", http.StatusOK, "export", "/users:export"},
+		{http.MethodGet, "/users:search?q=a", http.StatusOK, "search", "/users:search"},
+		{http.MethodPost, "/users:import", http.StatusOK, "import", "/users:import"},
+		{http.MethodGet, "/users:import", http.StatusNotFound, "404 page not found", ""},
+		{http.MethodGet, "/users:unknown", http.StatusNotFound, "404 page not found", ""},
+		{http.MethodGet, "/usersfoo", http.StatusNotFound, "404 page not found", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.wantCode || w.Body.String() != tt.wantBody {
+			t.Errorf("%s %s = %d %q; want %d %q", tt.method, tt.path, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+		}
+		if gotRoute != tt.wantRoute {
+			t.Errorf("%s %s: routeTemplate() = %q; want %q", tt.method, tt.path, gotRoute, tt.wantRoute)
+		}
+	}
+}
+
+func TestSplitCustomMethod(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantPrefix string
+		wantMethod string
+		wantOK     bool
+	}{
+		{"/users:import", "/users", ":import", true},
+		{"/webhooks/:webhook_id/deliveries:retry", "/webhooks/:webhook_id/deliveries", ":retry", true},
+		{"/users/:user_id", "", "", false},
+		{"/users", "", "", false},
+	}
+	for _, tt := range tests {
+		prefix, method, ok := splitCustomMethod(tt.path)
+		if prefix != tt.wantPrefix || method != tt.wantMethod || ok != tt.wantOK {
+			t.Errorf("splitCustomMethod(%q) = %q, %q, %v; want %q, %q, %v", tt.path, prefix, method, ok, tt.wantPrefix, tt.wantMethod, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// pkg/api/e2e_test.go
+// testkit が api に依存するため, 外部テストパッケージから呼び出す
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aazw/go-base/pkg/api"
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+	"github.com/aazw/go-base/pkg/testkit"
+)
+
+const missingUserID = "0197b0c8-0000-7000-8000-000000000000"
+
+func createUser(t *testing.T, s *testkit.Server, name string, email string) openapi.User {
+	t.Helper()
+
+	resp, err := s.Client.CreateUserWithResponse(context.Background(), openapi.CreateUserJSONRequestBody{
+		Name:  name,
+		Email: email,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.JSON201 == nil {
+		t.Fatalf("POST /users status = %d; want 201 (body %s)", resp.StatusCode(), resp.Body)
+	}
+	return resp.JSON201.User
+}
+
+func TestE2E_Users(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+
+	bob := createUser(t, s, "bob", "bob@example.com")
+	alice := createUser(t, s, "alice", "alice@example.com")
+
+	list, err := s.Client.ListUsersWithResponse(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.JSON200 == nil || len(list.JSON200.Users) != 2 || list.JSON200.Users[0].Id != alice.Id {
+		t.Fatalf("GET /users = %d %s; want [alice bob]", list.StatusCode(), list.Body)
+	}
+
+	name, email := "robert", "robert@example.com"
+	updated, err := s.Client.UpdateUserByIdWithResponse(ctx, bob.Id.String(), openapi.UpdateUserByIdJSONRequestBody{
+		Name:  &name,
+		Email: &email,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.JSON200 == nil || updated.JSON200.User.Name != name {
+		t.Fatalf("PATCH /users/{id} = %d %s; want 200 with name %s", updated.StatusCode(), updated.Body, name)
+	}
+
+	deleted, err := s.Client.DeleteUserByIdWithResponse(ctx, bob.Id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.StatusCode() != http.StatusNoContent {
+		t.Fatalf("DELETE /users/{id} status = %d; want 204", deleted.StatusCode())
+	}
+}
+
+func TestE2E_ProblemDetails(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+	createUser(t, s, "alice", "alice@example.com")
+
+	t.Run("user_not_found", func(t *testing.T) {
+		resp, err := s.Client.GetUserByIdWithResponse(ctx, missingUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSON404 == nil {
+			t.Fatalf("status = %d; want 404", resp.StatusCode())
+		}
+		testkit.AssertGolden(t, "user_not_found", resp.Body)
+	})
+
+	t.Run("user_duplicate_email", func(t *testing.T) {
+		resp, err := s.Client.CreateUserWithResponse(ctx, openapi.CreateUserJSONRequestBody{
+			Name:  "alice2",
+			Email: "alice@example.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSON400 == nil {
+			t.Fatalf("status = %d; want 400", resp.StatusCode())
+		}
+		testkit.AssertGolden(t, "user_duplicate_email", resp.Body)
+	})
+
+	t.Run("user_validation_error", func(t *testing.T) {
+		resp, err := s.Client.CreateUserWithBodyWithResponse(ctx, "application/json", strings.NewReader(`{"name":"","email":"not-an-email"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSON400 == nil {
+			t.Fatalf("status = %d; want 400", resp.StatusCode())
+		}
+		testkit.AssertGolden(t, "user_validation_error", resp.Body)
+	})
+}
+
+func TestE2E_Readiness(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t, testkit.WithHealthCheckers(
+		api.NewHealthChecker("database", func(ctx context.Context) error { return errors.New("connection refused") }),
+	))
+
+	resp, err := s.Client.GetHealthReadinessWithResponse(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.JSON503 == nil || resp.JSON503.Status != openapi.Unavailable {
+		t.Fatalf("GET /health/readiness = %d %s; want 503 unavailable", resp.StatusCode(), resp.Body)
+	}
+}
+
+func TestE2E_OpenAPISpec(t *testing.T) {
+	s := testkit.NewServer(t, testkit.WithConfig(func(cfg *config.Config) {
+		cfg.Server.RateLimit.Enabled = true
+	}))
+
+	// 定義の取得はセッションと rate limiter の対象外
+	for range 20 {
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /openapi.json status = %d; want 200", w.Code)
+		}
+		if w.Header().Get("Vary") != "" || len(w.Result().Cookies()) > 0 {
+			t.Fatalf("GET /openapi.json loaded a session (headers %v)", w.Header())
+		}
+	}
+
+	var doc struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	}
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	// server.host が 0.0.0.0 の場合は localhost にする
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "http://localhost:8080" {
+		t.Errorf("servers = %+v; want [http://localhost:8080]", doc.Servers)
+	}
+}
+
+func TestE2E_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+
+	// 最初のキーは API から発行できないため, CLI (goapp api-key create) と同じく直接発行する
+	opsHandler, err := operations.NewHandler(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := opsHandler.IssueAPIKey(db.WithTenant(ctx, models.DefaultTenantID), nil, &models.APIKeyPrototype{
+		Name: "bootstrap",
+		// 発行するキーのスコープは発行するキー自身も持っている必要がある
+		Scopes: []models.APIKeyScope{models.APIKeyScopeAPIKeysWrite, models.APIKeyScopeUsersRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKey := func(key string) openapi.RequestEditorFn {
+		return func(ctx context.Context, req *http.Request) error {
+			req.Header.Set("X-API-Key", key)
+			return nil
+		}
+	}
+
+	anonymous, err := s.Client.ListApiKeysWithResponse(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymous.JSON401 == nil {
+		t.Fatalf("GET /api-keys without credentials = %d %s; want 401", anonymous.StatusCode(), anonymous.Body)
+	}
+
+	created, err := s.Client.CreateApiKeyWithResponse(ctx, openapi.CreateApiKeyJSONRequestBody{
+		Name:   "reader",
+		Scopes: []openapi.APIKeyScope{openapi.UsersRead},
+	}, withKey(admin.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.JSON201 == nil || !strings.HasPrefix(created.JSON201.Secret, "gbk_"+created.JSON201.ApiKey.Prefix+"_") {
+		t.Fatalf("POST /api-keys = %d %s; want 201 with secret", created.StatusCode(), created.Body)
+	}
+	reader := created.JSON201
+
+	// users:read のキーは一覧を読めるが作成はできず, キーの管理もできない
+	if users, err := s.Client.ListUsersWithResponse(ctx, withKey(reader.Secret)); err != nil || users.StatusCode() != http.StatusOK {
+		t.Fatalf("GET /users with reader key = %v %v; want 200", users.StatusCode(), err)
+	}
+	forbidden, err := s.Client.ListApiKeysWithResponse(ctx, withKey(reader.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forbidden.JSON403 == nil {
+		t.Fatalf("GET /api-keys with reader key = %d %s; want 403", forbidden.StatusCode(), forbidden.Body)
+	}
+
+	rotated, err := s.Client.RotateApiKeyWithResponse(ctx, reader.ApiKey.Id.String(), openapi.RotateApiKeyJSONRequestBody{}, withKey(admin.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.JSON201 == nil || rotated.JSON201.ApiKey.RotatedFrom == nil || *rotated.JSON201.ApiKey.RotatedFrom != reader.ApiKey.Id {
+		t.Fatalf("POST /api-keys/{id}/rotate = %d %s; want 201 rotated from %s", rotated.StatusCode(), rotated.Body, reader.ApiKey.Id)
+	}
+	// 猶予期間なしのローテーションでは古いキーはすぐに使えなくなる
+	stale, err := s.Client.ListApiKeysWithResponse(ctx, withKey(reader.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale.JSON401 == nil {
+		t.Fatalf("GET /api-keys with rotated key = %d %s; want 401", stale.StatusCode(), stale.Body)
+	}
+
+	revoked, err := s.Client.RevokeApiKeyByIdWithResponse(ctx, rotated.JSON201.ApiKey.Id.String(), withKey(admin.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.StatusCode() != http.StatusNoContent {
+		t.Fatalf("DELETE /api-keys/{id} status = %d; want 204", revoked.StatusCode())
+	}
+
+	list, err := s.Client.ListApiKeysWithResponse(ctx, withKey(admin.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.JSON200 == nil || len(list.JSON200.ApiKeys) != 3 {
+		t.Fatalf("GET /api-keys = %d %s; want 3 keys", list.StatusCode(), list.Body)
+	}
+	for _, key := range list.JSON200.ApiKeys {
+		if key.Id != admin.APIKey.ID && key.RevokedAt == nil {
+			t.Errorf("api key %s is not revoked", key.Id)
+		}
+	}
+}
+
+// API キーで発行/ローテーションするキーは, 発行するキーより強く/長く使えるようにはできない
+func TestE2E_APIKeys_Delegation(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+
+	opsHandler, err := operations.NewHandler(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantCtx := db.WithTenant(ctx, models.DefaultTenantID)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	manager, err := opsHandler.IssueAPIKey(tenantCtx, nil, &models.APIKeyPrototype{
+		Name:      "manager",
+		Scopes:    []models.APIKeyScope{models.APIKeyScopeAPIKeysWrite, models.APIKeyScopeUsersRead},
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := opsHandler.IssueAPIKey(tenantCtx, nil, &models.APIKeyPrototype{
+		Name:   "writer",
+		Scopes: []models.APIKeyScope{models.APIKeyScopeUsersWrite},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor := func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("X-API-Key", manager.Secret)
+		return nil
+	}
+
+	// 持っていないスコープ (users:write, api-keys:write を持っていても webhooks:write) は発行できない
+	for _, scope := range []openapi.APIKeyScope{openapi.UsersWrite, openapi.WebhooksWrite} {
+		escalated, err := s.Client.CreateApiKeyWithResponse(ctx, openapi.CreateApiKeyJSONRequestBody{
+			Name:   "escalated",
+			Scopes: []openapi.APIKeyScope{openapi.UsersRead, scope},
+		}, editor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if escalated.JSON403 == nil {
+			t.Errorf("POST /api-keys with %s = %d %s; want 403", scope, escalated.StatusCode(), escalated.Body)
+		}
+	}
+
+	// 期限は発行するキーの期限までに制限する
+	for _, requested := range []*time.Time{nil, api.Ptr(expiresAt.Add(24 * time.Hour))} {
+		created, err := s.Client.CreateApiKeyWithResponse(ctx, openapi.CreateApiKeyJSONRequestBody{
+			Name:      "reader",
+			Scopes:    []openapi.APIKeyScope{openapi.UsersRead},
+			ExpiresAt: requested,
+		}, editor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.JSON201 == nil || created.JSON201.ApiKey.ExpiresAt == nil || !created.JSON201.ApiKey.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("POST /api-keys expires_at=%v = %d %s; want 201 expiring at %s", requested, created.StatusCode(), created.Body, expiresAt)
+		}
+	}
+
+	// 持っていないスコープのキーはローテーションできない (新しいキーを得られるため)
+	rotated, err := s.Client.RotateApiKeyWithResponse(ctx, writer.APIKey.ID.String(), openapi.RotateApiKeyJSONRequestBody{}, editor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.JSON403 == nil {
+		t.Errorf("POST /api-keys/{id}/rotate of users:write key = %d %s; want 403", rotated.StatusCode(), rotated.Body)
+	}
+}
+
+// webhook の配信先は https の外部のホストに限る
+func TestE2E_Webhooks_URLPolicy(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+
+	opsHandler, err := operations.NewHandler(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := opsHandler.IssueAPIKey(db.WithTenant(ctx, models.DefaultTenantID), nil, &models.APIKeyPrototype{
+		Name:   "integrations",
+		Scopes: []models.APIKeyScope{models.APIKeyScopeWebhooksWrite},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor := func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("X-API-Key", key.Secret)
+		return nil
+	}
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{url: "https://hooks.example.com/goapp", want: http.StatusCreated},
+		{url: "http://hooks.example.com/goapp", want: http.StatusBadRequest},
+		{url: "https://127.0.0.1/goapp", want: http.StatusBadRequest},
+		{url: "https://169.254.169.254/latest/meta-data", want: http.StatusBadRequest},
+		{url: "https://localhost:8080/goapp", want: http.StatusBadRequest},
+		{url: "https://metadata.google.internal/goapp", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		created, err := s.Client.CreateWebhookWithResponse(ctx, openapi.CreateWebhookJSONRequestBody{
+			Url:    tt.url,
+			Secret: "whsec_0123456789abcdef",
+		}, editor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.StatusCode() != tt.want {
+			t.Errorf("POST /webhooks url=%s = %d %s; want %d", tt.url, created.StatusCode(), created.Body, tt.want)
+		}
+	}
+}
+
+// webhook の管理は管理者のロールか webhooks:read/webhooks:write のスコープを持つキーに限る
+func TestE2E_Webhooks_Authorization(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+
+	opsHandler, err := operations.NewHandler(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := opsHandler.IssueAPIKey(db.WithTenant(ctx, models.DefaultTenantID), nil, &models.APIKeyPrototype{
+		Name:   "users-reader",
+		Scopes: []models.APIKeyScope{models.APIKeyScopeUsersRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous, err := s.Client.CreateWebhookWithResponse(ctx, openapi.CreateWebhookJSONRequestBody{
+		Url:    "https://hooks.example.com/goapp",
+		Secret: "whsec_0123456789abcdef",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymous.JSON401 == nil {
+		t.Errorf("POST /webhooks without credentials = %d %s; want 401", anonymous.StatusCode(), anonymous.Body)
+	}
+
+	forbidden, err := s.Client.ListWebhooksWithResponse(ctx, func(_ context.Context, req *http.Request) error {
+		req.Header.Set("X-API-Key", reader.Secret)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forbidden.JSON403 == nil {
+		t.Errorf("GET /webhooks without webhooks:read = %d %s; want 403", forbidden.StatusCode(), forbidden.Body)
+	}
+}
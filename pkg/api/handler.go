@@ -3,18 +3,10 @@ package api
 
 import (
 	"context"
-	"database/sql"
-	"errors"
 	"net/http"
 	"strings"
 
-	"github.com/alexedwards/scs/v2"
-	"github.com/gomodule/redigo/redis"
 	"github.com/google/uuid"
-	"github.com/jackc/pgerrcode"
-	"github.com/jackc/pgx"
-	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/aazw/go-base/pkg/api/openapi"
 	"github.com/aazw/go-base/pkg/cerrors"
@@ -24,19 +16,20 @@ import (
 
 // StrictServerInterface の実装用
 type StrictServerImpl struct {
-	opsHandler *operations.Handler
-	dbPool     *pgxpool.Pool
-	redisPool  *redis.Pool
-	sm         *scs.SessionManager
+	opsHandler     *operations.Handler
+	sessions       *SessionTracker
+	csrf           *CSRFProtector
+	healthCheckers []HealthChecker
 }
 
-func NewStrictServerImpl(opsHandler *operations.Handler, dbPool *pgxpool.Pool, redisPool *redis.Pool, sm *scs.SessionManager) openapi.StrictServerInterface {
+// NewStrictServerImpl は StrictServerImpl を生成する. healthCheckers は readiness チェックで順に確認する
+func NewStrictServerImpl(opsHandler *operations.Handler, sessions *SessionTracker, csrf *CSRFProtector, healthCheckers ...HealthChecker) openapi.StrictServerInterface {
 
 	return &StrictServerImpl{
-		opsHandler: opsHandler,
-		dbPool:     dbPool,
-		redisPool:  redisPool,
-		sm:         sm,
+		opsHandler:     opsHandler,
+		sessions:       sessions,
+		csrf:           csrf,
+		healthCheckers: healthCheckers,
 	}
 }
 
@@ -55,33 +48,30 @@ func (p *StrictServerImpl) GetHealthLiveness(ctx context.Context, request openap
 // (GET /health/readiness)
 func (p *StrictServerImpl) GetHealthReadiness(ctx context.Context, request openapi.GetHealthReadinessRequestObject) (openapi.GetHealthReadinessResponseObject, error) {
 
-	// ping to relational database
-	if err := p.dbPool.Ping(ctx); err != nil {
-		cerr := cerrors.ErrServiceUnavailable.New(
-			cerrors.WithCause(err),
-			cerrors.WithMessage("database is not available"),
-		)
-		return openapi.GetHealthReadiness503JSONResponse{
-			Status: openapi.Unavailable,
-		}, cerr
+	// 依存先毎の状態を返すため, 利用できない依存先があっても全て確認する
+	var cerr error
+	dependencies := make([]openapi.DependencyHealth, 0, len(p.healthCheckers))
+	for _, checker := range p.healthCheckers {
+		err := checker.Check(ctx)
+		if err != nil && cerr == nil {
+			cerr = newHealthCheckError(checker, err)
+		}
+		dependencies = append(dependencies, openapi.DependencyHealth{
+			Name:           checker.Name(),
+			Available:      err == nil,
+			CircuitBreaker: circuitBreakerState(checker),
+		})
 	}
 
-	// ping to redis
-	conn := p.redisPool.Get()
-	defer conn.Close()
-	_, err := redis.String(conn.Do("PING"))
-	if err != nil {
-		cerr := cerrors.ErrServiceUnavailable.New(
-			cerrors.WithCause(err),
-			cerrors.WithMessage("redis is not available"),
-		)
+	if cerr != nil {
 		return openapi.GetHealthReadiness503JSONResponse{
-			Status: openapi.Unavailable,
+			Status:       openapi.Unavailable,
+			Dependencies: &dependencies,
 		}, cerr
 	}
-
 	return openapi.GetHealthReadiness200JSONResponse{
-		Status: openapi.Available,
+		Status:       openapi.Available,
+		Dependencies: &dependencies,
 	}, nil
 }
 
@@ -102,7 +92,7 @@ func (p *StrictServerImpl) ListUsers(ctx context.Context, request openapi.ListUs
 		}, cerr
 	}
 
-	var retItems []openapi.User
+	retItems := make([]openapi.User, 0, len(items))
 	for _, item := range items {
 		retItems = append(retItems, openapi.User{
 			Id:    item.ID,
@@ -125,52 +115,38 @@ func (p *StrictServerImpl) CreateUser(ctx context.Context, request openapi.Creat
 		Email: strings.ToLower(string(request.Body.Email)),
 	})
 	if err != nil {
-		var cerr error
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			switch pgErr.Code {
-			case pgerrcode.UniqueViolation:
-				cerr = cerrors.ErrDBDuplicate.New(
-					cerrors.WithCause(err),
-					cerrors.WithMessage("user already exists"),
-				)
-				return openapi.CreateUser400JSONResponse{
-					Type:   PtrOrNil("/bad_request"),
-					Title:  PtrOrNil(http.StatusText(400)),
-					Status: PtrOrNil(int32(400)),
-				}, cerr
-			case pgerrcode.ForeignKeyViolation:
-				cerr = cerrors.ErrDBConstraint.New(
-					cerrors.WithCause(err),
-					cerrors.WithMessage("foreign key constraint violation"),
-				)
-				return openapi.CreateUser400JSONResponse{
-					Type:   PtrOrNil("/bad_request"),
-					Title:  PtrOrNil(http.StatusText(400)),
-					Status: PtrOrNil(int32(400)),
-				}, cerr
-			default:
-				cerr = cerrors.ErrSystemInternal.New(
-					cerrors.WithCause(err),
-					cerrors.WithMessage("database error"),
-				)
-				return openapi.CreateUser500JSONResponse{
-					Type:   PtrOrNil("/internal_server_error"),
-					Title:  PtrOrNil(http.StatusText(500)),
-					Status: PtrOrNil(int32(500)),
-				}, cerr
-			}
+		switch errorCodeOf(err) {
+		case errorCodeDBDuplicate:
+			cerr := cerrors.ErrDBDuplicate.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("user already exists"),
+			)
+			return openapi.CreateUser400JSONResponse{
+				Type:   PtrOrNil("/bad_request"),
+				Title:  PtrOrNil(http.StatusText(400)),
+				Status: PtrOrNil(int32(400)),
+			}, cerr
+		case errorCodeDBConstraint:
+			cerr := cerrors.ErrDBConstraint.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("foreign key constraint violation"),
+			)
+			return openapi.CreateUser400JSONResponse{
+				Type:   PtrOrNil("/bad_request"),
+				Title:  PtrOrNil(http.StatusText(400)),
+				Status: PtrOrNil(int32(400)),
+			}, cerr
+		default:
+			cerr := cerrors.ErrSystemInternal.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to create user"),
+			)
+			return openapi.CreateUser500JSONResponse{
+				Type:   PtrOrNil("/internal_server_error"),
+				Title:  PtrOrNil(http.StatusText(500)),
+				Status: PtrOrNil(int32(500)),
+			}, cerr
 		}
-
-		cerr = cerrors.ErrSystemInternal.New(
-			cerrors.WithCause(err),
-			cerrors.WithMessage("failed to create user"),
-		)
-		return openapi.CreateUser500JSONResponse{
-			Type:   PtrOrNil("/internal_server_error"),
-			Title:  PtrOrNil(http.StatusText(500)),
-			Status: PtrOrNil(int32(500)),
-		}, cerr
 	}
 
 	return openapi.CreateUser201JSONResponse{
@@ -188,7 +164,7 @@ func (p *StrictServerImpl) GetUserById(ctx context.Context, request openapi.GetU
 
 	user, err := p.opsHandler.GetUser(ctx, uuid.MustParse(request.UserId))
 	switch {
-	case errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows):
+	case errorCodeOf(err) == errorCodeDBNotFound:
 		cerr := cerrors.ErrDBNotFound.New(
 			cerrors.WithCause(err),
 			cerrors.WithMessage("user not found"),
@@ -226,7 +202,7 @@ func (p *StrictServerImpl) UpdateUserById(ctx context.Context, request openapi.U
 
 	user, err := p.opsHandler.GetUser(ctx, uuid.MustParse(request.UserId))
 	switch {
-	case errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows):
+	case errorCodeOf(err) == errorCodeDBNotFound:
 		cerr := cerrors.ErrDBNotFound.New(
 			cerrors.WithCause(err),
 			cerrors.WithMessage("user not found"),
@@ -258,7 +234,7 @@ func (p *StrictServerImpl) UpdateUserById(ctx context.Context, request openapi.U
 		Email: user.Email,
 	})
 	switch {
-	case errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows):
+	case errorCodeOf(err) == errorCodeDBNotFound:
 		cerr := cerrors.ErrDBNotFound.New(
 			cerrors.WithCause(err),
 			cerrors.WithMessage("user not found"),
@@ -269,52 +245,38 @@ func (p *StrictServerImpl) UpdateUserById(ctx context.Context, request openapi.U
 			Status: PtrOrNil(int32(404)),
 		}, cerr
 	case err != nil:
-		var cerr error
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			switch pgErr.Code {
-			case pgerrcode.UniqueViolation:
-				cerr = cerrors.ErrDBDuplicate.New(
-					cerrors.WithCause(err),
-					cerrors.WithMessage("user already exists"),
-				)
-				return openapi.UpdateUserById400JSONResponse{
-					Type:   PtrOrNil("/bad_request"),
-					Title:  PtrOrNil(http.StatusText(400)),
-					Status: PtrOrNil(int32(400)),
-				}, cerr
-			case pgerrcode.ForeignKeyViolation:
-				cerr = cerrors.ErrDBConstraint.New(
-					cerrors.WithCause(err),
-					cerrors.WithMessage("foreign key constraint violation"),
-				)
-				return openapi.UpdateUserById400JSONResponse{
-					Type:   PtrOrNil("/bad_request"),
-					Title:  PtrOrNil(http.StatusText(400)),
-					Status: PtrOrNil(int32(400)),
-				}, cerr
-			default:
-				cerr = cerrors.ErrSystemInternal.New(
-					cerrors.WithCause(err),
-					cerrors.WithMessage("database error"),
-				)
-				return openapi.UpdateUserById500JSONResponse{
-					Type:   PtrOrNil("/internal_server_error"),
-					Title:  PtrOrNil(http.StatusText(500)),
-					Status: PtrOrNil(int32(500)),
-				}, cerr
-			}
+		switch errorCodeOf(err) {
+		case errorCodeDBDuplicate:
+			cerr := cerrors.ErrDBDuplicate.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("user already exists"),
+			)
+			return openapi.UpdateUserById400JSONResponse{
+				Type:   PtrOrNil("/bad_request"),
+				Title:  PtrOrNil(http.StatusText(400)),
+				Status: PtrOrNil(int32(400)),
+			}, cerr
+		case errorCodeDBConstraint:
+			cerr := cerrors.ErrDBConstraint.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("foreign key constraint violation"),
+			)
+			return openapi.UpdateUserById400JSONResponse{
+				Type:   PtrOrNil("/bad_request"),
+				Title:  PtrOrNil(http.StatusText(400)),
+				Status: PtrOrNil(int32(400)),
+			}, cerr
+		default:
+			cerr := cerrors.ErrSystemInternal.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to update user"),
+			)
+			return openapi.UpdateUserById500JSONResponse{
+				Type:   PtrOrNil("/internal_server_error"),
+				Title:  PtrOrNil(http.StatusText(500)),
+				Status: PtrOrNil(int32(500)),
+			}, cerr
 		}
-
-		cerr = cerrors.ErrSystemInternal.New(
-			cerrors.WithCause(err),
-			cerrors.WithMessage("failed to update user"),
-		)
-		return openapi.UpdateUserById500JSONResponse{
-			Type:   PtrOrNil("/internal_server_error"),
-			Title:  PtrOrNil(http.StatusText(500)),
-			Status: PtrOrNil(int32(500)),
-		}, cerr
 	default:
 		// 正常
 		return openapi.UpdateUserById200JSONResponse{
@@ -334,7 +296,7 @@ func (p *StrictServerImpl) DeleteUserById(ctx context.Context, request openapi.D
 	ret, err := p.opsHandler.DeleteUser(ctx, uuid.MustParse(request.UserId))
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows):
+		case errorCodeOf(err) == errorCodeDBNotFound:
 			cerr := cerrors.ErrDBNotFound.New(
 				cerrors.WithCause(err),
 				cerrors.WithMessage("user not found"),
@@ -1,2 +1,225 @@
 // pkg/api/handler_test.go
 package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db/memory"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+// newTestServer はメモリ上の db.Handler を使う API のルーターを生成する
+func newTestServer(t *testing.T, healthCheckers ...HealthChecker) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	dbHandler, err := memory.NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opsHandler, err := operations.NewHandler(dbHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := scs.New()
+	sm.Store = memstore.New()
+
+	// NewRouter と同じくテナントを c.Request.Context() から参照できるようにする
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(func(c *gin.Context) {
+		setTenant(c, models.DefaultTenantID)
+	})
+	sessions, err := NewSessionTracker(config.NewConfig().Session, "", sm, NewMemorySessionIndex(), "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrf, err := NewCSRFProtector(config.NewConfig().Server.CSRF, config.CORS{}, sm, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverImpl := NewStrictServerImpl(opsHandler, sessions, csrf, healthCheckers...)
+	openapi.RegisterHandlers(newCustomMethodRouter(router), openapi.NewStrictHandler(serverImpl, []openapi.StrictMiddlewareFunc{StrictErrorRecorder()}))
+	return router
+}
+
+func doJSON(t *testing.T, router *gin.Engine, method string, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func decodeJSON[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+func createUser(t *testing.T, router *gin.Engine, name string, email string) openapi.User {
+	t.Helper()
+
+	w := doJSON(t, router, http.MethodPost, "/users", map[string]string{"name": name, "email": email})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /users status = %d; want 201 (body %s)", w.Code, w.Body.String())
+	}
+	return decodeJSON[struct{ User openapi.User }](t, w).User
+}
+
+func TestStrictServerImpl_Users(t *testing.T) {
+	router := newTestServer(t)
+
+	bob := createUser(t, router, "bob", "Bob@Example.com")
+	if bob.Email != "bob@example.com" {
+		t.Errorf("created email = %q; want lower-cased bob@example.com", bob.Email)
+	}
+	alice := createUser(t, router, "alice", "alice@example.com")
+
+	// name の順
+	w := doJSON(t, router, http.MethodGet, "/users", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /users status = %d; want 200", w.Code)
+	}
+	users := decodeJSON[struct{ Users []openapi.User }](t, w).Users
+	if len(users) != 2 || users[0].Id != alice.Id || users[1].Id != bob.Id {
+		t.Errorf("GET /users = %+v; want [alice bob]", users)
+	}
+
+	w = doJSON(t, router, http.MethodPatch, "/users/"+bob.Id.String(), map[string]string{"name": "robert", "email": "bob@example.com"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("PATCH /users/{id} status = %d; want 200 (body %s)", w.Code, w.Body.String())
+	}
+	if got := decodeJSON[struct{ User openapi.User }](t, w).User; got.Name != "robert" || got.Email != "bob@example.com" {
+		t.Errorf("PATCH /users/{id} = %+v; want name robert", got)
+	}
+
+	w = doJSON(t, router, http.MethodDelete, "/users/"+bob.Id.String(), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /users/{id} status = %d; want 204", w.Code)
+	}
+	w = doJSON(t, router, http.MethodGet, "/users/"+bob.Id.String(), nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /users/{id} after delete status = %d; want 404", w.Code)
+	}
+}
+
+func TestStrictServerImpl_UserErrors(t *testing.T) {
+	router := newTestServer(t)
+
+	alice := createUser(t, router, "alice", "alice@example.com")
+	bob := createUser(t, router, "bob", "bob@example.com")
+	missing := "0197b0c8-0000-7000-8000-000000000000"
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       any
+		wantStatus int
+	}{
+		{"create duplicate email", http.MethodPost, "/users", map[string]string{"name": "alice2", "email": "alice@example.com"}, http.StatusBadRequest},
+		{"update to duplicate email", http.MethodPatch, "/users/" + bob.Id.String(), map[string]string{"name": "bob", "email": "alice@example.com"}, http.StatusBadRequest},
+		{"get missing", http.MethodGet, "/users/" + missing, nil, http.StatusNotFound},
+		{"update missing", http.MethodPatch, "/users/" + missing, map[string]string{"name": "x", "email": "x@example.com"}, http.StatusNotFound},
+		{"delete missing", http.MethodDelete, "/users/" + missing, nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doJSON(t, router, tt.method, tt.target, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			problem := decodeJSON[openapi.ProblemDetails](t, w)
+			if problem.Status == nil || int(*problem.Status) != tt.wantStatus {
+				t.Errorf("problem.status = %v; want %d", problem.Status, tt.wantStatus)
+			}
+		})
+	}
+
+	// 失敗した更新は反映しない
+	w := doJSON(t, router, http.MethodGet, "/users/"+alice.Id.String(), nil)
+	if got := decodeJSON[struct{ User openapi.User }](t, w).User; got != alice {
+		t.Errorf("GET /users/{id} = %+v; want unchanged %+v", got, alice)
+	}
+}
+
+func TestStrictServerImpl_GetHealthReadiness(t *testing.T) {
+	guard, err := resilience.NewGuard("postgres", resilience.Config{Breaker: &resilience.BreakerConfig{
+		Window:              time.Minute,
+		MinRequests:         1,
+		FailureRate:         1,
+		OpenDuration:        time.Minute,
+		HalfOpenMaxRequests: 1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checkErr error
+	router := newTestServer(t,
+		NewHealthChecker("ok", func(ctx context.Context) error { return nil }),
+		WithCircuitBreaker(NewHealthChecker("database", func(ctx context.Context) error { return checkErr }), guard.Breaker()),
+	)
+
+	w := doJSON(t, router, http.MethodGet, "/health/readiness", nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d; want 200", w.Code)
+	}
+
+	// サーキットブレーカーの状態は返すが, 確認が成功していれば利用可能とする
+	_ = guard.Do(context.Background(), func(ctx context.Context) error { return errors.New("connection refused") })
+	w = doJSON(t, router, http.MethodGet, "/health/readiness", nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("status with open circuit breaker = %d; want 200", w.Code)
+	}
+	want := []openapi.DependencyHealth{
+		{Name: "ok", Available: true},
+		{Name: "database", Available: true, CircuitBreaker: PtrOrNil(openapi.Open)},
+	}
+	if got := decodeJSON[openapi.HealthStatus](t, w); got.Dependencies == nil || !reflect.DeepEqual(*got.Dependencies, want) {
+		t.Errorf("dependencies = %+v; want %+v", got.Dependencies, want)
+	}
+
+	checkErr = errors.New("connection refused")
+	w = doJSON(t, router, http.MethodGet, "/health/readiness", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status with failing checker = %d; want 503", w.Code)
+	}
+	got := decodeJSON[openapi.HealthStatus](t, w)
+	if got.Status != openapi.Unavailable {
+		t.Errorf("status = %v; want %v", got.Status, openapi.Unavailable)
+	}
+	if got.Dependencies == nil || len(*got.Dependencies) != 2 || !(*got.Dependencies)[0].Available || (*got.Dependencies)[1].Available {
+		t.Errorf("dependencies = %+v; want only database unavailable", got.Dependencies)
+	}
+}
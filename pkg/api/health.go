@@ -0,0 +1,104 @@
+// pkg/api/health.go
+package api
+
+import (
+	"context"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+// HealthChecker は readiness チェックで確認する依存先
+type HealthChecker interface {
+	// Name はエラーメッセージに使う依存先の名前
+	Name() string
+	// Check は依存先が利用可能でなければエラーを返す
+	Check(ctx context.Context) error
+}
+
+type healthCheckerFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (p *healthCheckerFunc) Name() string {
+	return p.name
+}
+
+func (p *healthCheckerFunc) Check(ctx context.Context) error {
+	return p.check(ctx)
+}
+
+// NewHealthChecker は check を呼ぶ HealthChecker を生成する
+func NewHealthChecker(name string, check func(ctx context.Context) error) HealthChecker {
+	return &healthCheckerFunc{
+		name:  name,
+		check: check,
+	}
+}
+
+// NewPostgresHealthChecker は PostgreSQL に ping する HealthChecker を生成する
+func NewPostgresHealthChecker(pool *pgxpool.Pool) HealthChecker {
+	return NewHealthChecker("database", pool.Ping)
+}
+
+// NewValkeyHealthChecker は Valkey に PING する HealthChecker を生成する
+func NewValkeyHealthChecker(pool *redis.Pool) HealthChecker {
+	return NewHealthChecker("redis", func(ctx context.Context) error {
+		conn, err := pool.GetContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		_, err = redis.String(conn.Do("PING"))
+		return err
+	})
+}
+
+// circuitBreakerHealthChecker は依存先のサーキットブレーカーの状態も readiness チェックの結果に含める HealthChecker
+// 確認 (Check) はサーキットブレーカーを通さずに行う. open の間も依存先が回復したかを確認できるように
+type circuitBreakerHealthChecker struct {
+	HealthChecker
+	breaker *resilience.CircuitBreaker
+}
+
+// WithCircuitBreaker は checker の依存先のサーキットブレーカーの状態を readiness チェックの結果に含める
+func WithCircuitBreaker(checker HealthChecker, breaker *resilience.CircuitBreaker) HealthChecker {
+	if breaker == nil {
+		return checker
+	}
+	return &circuitBreakerHealthChecker{
+		HealthChecker: checker,
+		breaker:       breaker,
+	}
+}
+
+// circuitBreakerState は checker の依存先のサーキットブレーカーの状態を返す. サーキットブレーカーが無い場合は nil
+func circuitBreakerState(checker HealthChecker) *openapi.DependencyHealthCircuitBreaker {
+	p, ok := checker.(*circuitBreakerHealthChecker)
+	if !ok {
+		return nil
+	}
+	var state openapi.DependencyHealthCircuitBreaker
+	switch p.breaker.State() {
+	case resilience.StateOpen:
+		state = openapi.Open
+	case resilience.StateHalfOpen:
+		state = openapi.HalfOpen
+	default:
+		state = openapi.Closed
+	}
+	return &state
+}
+
+func newHealthCheckError(checker HealthChecker, err error) error {
+	return cerrors.ErrServiceUnavailable.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage(checker.Name()+" is not available"),
+	)
+}
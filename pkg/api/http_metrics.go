@@ -0,0 +1,332 @@
+// pkg/api/http_metrics.go
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+const (
+	// どのルートにもマッチしなかったリクエストの http.route. パスをそのまま使うとカーディナリティが爆発するため
+	UnmatchedRoute = "<unmatched>"
+
+	httpMetricsInstrumentationName = "github.com/aazw/go-base/pkg/api"
+)
+
+// ステータスコードから推定する cerrors のエラーコード (CustomError が返されずにエラーレスポンスになった場合用)
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:            errorCodeOf(cerrors.ErrAPIRequest.New()),
+	http.StatusUnauthorized:          errorCodeOf(cerrors.ErrAuthentication.New()),
+	http.StatusForbidden:             errorCodeOf(cerrors.ErrAuthorization.New()),
+	http.StatusNotFound:              errorCodeOf(cerrors.ErrResourceNotFound.New()),
+	http.StatusRequestTimeout:        errorCodeOf(cerrors.ErrTimeout.New()),
+	http.StatusRequestEntityTooLarge: errorCodeOf(cerrors.ErrResourceExhausted.New()),
+	http.StatusTooManyRequests:       errorCodeOf(cerrors.ErrRateLimit.New()),
+	http.StatusServiceUnavailable:    errorCodeOf(cerrors.ErrServiceUnavailable.New()),
+	http.StatusGatewayTimeout:        errorCodeOf(cerrors.ErrTimeout.New()),
+}
+
+var (
+	defaultClientErrorCode = errorCodeOf(cerrors.ErrAPIRequest.New())
+	defaultServerErrorCode = errorCodeOf(cerrors.ErrUnknown.New())
+	validationErrorCode    = errorCodeOf(cerrors.ErrValidation.New())
+)
+
+// HTTPMetrics は HTTP サーバのメトリクスを Prometheus と OTel の両方に記録する
+// メトリクス名は http.server.* のセマンティック規約に従う
+// 処理中のリクエスト数以外には TenantResolver が特定したテナントを tenant_id (OTel は tenant.id) として付与する. テナント数だけ系列が増えることに注意
+// https://opentelemetry.io/docs/specs/semconv/http/http-metrics/#http-server
+type HTTPMetrics struct {
+	// Prometheus
+	activeRequests *prometheus.GaugeVec
+	duration       *prometheus.HistogramVec
+	requestSize    *prometheus.HistogramVec
+	responseSize   *prometheus.HistogramVec
+	errors         *prometheus.CounterVec
+	timeouts       *prometheus.CounterVec
+
+	// OTel
+	otelActiveRequests metric.Int64UpDownCounter
+	otelDuration       metric.Float64Histogram
+	otelRequestSize    metric.Int64Histogram
+	otelResponseSize   metric.Int64Histogram
+	otelErrors         metric.Int64Counter
+	otelTimeouts       metric.Int64Counter
+}
+
+// NewHTTPMetrics は HTTPMetrics を生成する. namespace は Prometheus のメトリクス名の接頭辞
+// OTel の計装はグローバルの MeterProvider から作るため, otlp_metric が無効な場合は何も送られない
+func NewHTTPMetrics(namespace string) (*HTTPMetrics, error) {
+
+	sizeBuckets := prometheus.ExponentialBuckets(64, 4, 8) // 64B 〜 1MiB
+
+	m := &HTTPMetrics{
+		activeRequests: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "http_server",
+				Name:      "active_requests",
+				Help:      "処理中の HTTP リクエスト数",
+			},
+			[]string{"http_request_method"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "http_server",
+				Name:      "request_duration_seconds",
+				Help:      "HTTP リクエストの処理に要した時間（秒）",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"http_route", "http_request_method", "http_response_status_code", "tenant_id"},
+		),
+		requestSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "http_server",
+				Name:      "request_body_size_bytes",
+				Help:      "HTTP リクエストボディのサイズ（バイト）",
+				Buckets:   sizeBuckets,
+			},
+			[]string{"http_route", "http_request_method", "http_response_status_code", "tenant_id"},
+		),
+		responseSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "http_server",
+				Name:      "response_body_size_bytes",
+				Help:      "HTTP レスポンスボディのサイズ（バイト）",
+				Buckets:   sizeBuckets,
+			},
+			[]string{"http_route", "http_request_method", "http_response_status_code", "tenant_id"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "http_server",
+				Name:      "errors_total",
+				Help:      "エラーレスポンス (4xx/5xx) の数",
+			},
+			[]string{"http_route", "http_request_method", "error_code", "tenant_id"},
+		),
+		timeouts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "http_server",
+				Name:      "request_timeouts_total",
+				Help:      "処理時間の上限を超えて 504 にしたリクエストの数 (source は上限を決めたもの: operation または client)",
+			},
+			[]string{"http_route", "http_request_method", "source", "tenant_id"},
+		),
+	}
+
+	// OTel
+	meter := otel.Meter(httpMetricsInstrumentationName)
+	var err error
+	m.otelActiveRequests, err = meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, newHTTPMetricsError(err)
+	}
+	m.otelDuration, err = meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(prometheus.DefBuckets...),
+	)
+	if err != nil {
+		return nil, newHTTPMetricsError(err)
+	}
+	m.otelRequestSize, err = meter.Int64Histogram(
+		"http.server.request.body.size",
+		metric.WithDescription("Size of HTTP server request bodies."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(sizeBuckets...),
+	)
+	if err != nil {
+		return nil, newHTTPMetricsError(err)
+	}
+	m.otelResponseSize, err = meter.Int64Histogram(
+		"http.server.response.body.size",
+		metric.WithDescription("Size of HTTP server response bodies."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(sizeBuckets...),
+	)
+	if err != nil {
+		return nil, newHTTPMetricsError(err)
+	}
+	m.otelErrors, err = meter.Int64Counter(
+		"http.server.errors",
+		metric.WithDescription("Number of HTTP server error responses by error code."),
+		metric.WithUnit("{response}"),
+	)
+	if err != nil {
+		return nil, newHTTPMetricsError(err)
+	}
+	m.otelTimeouts, err = meter.Int64Counter(
+		"http.server.request.timeouts",
+		metric.WithDescription("Number of HTTP server requests that exceeded their timeout."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, newHTTPMetricsError(err)
+	}
+
+	return m, nil
+}
+
+func (m *HTTPMetrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		start := time.Now()
+		ctx := c.Request.Context()
+		method := c.Request.Method
+
+		activeAttrs := metric.WithAttributes(attribute.String("http.request.method", method))
+		m.activeRequests.WithLabelValues(method).Inc()
+		m.otelActiveRequests.Add(ctx, 1, activeAttrs)
+		defer func() {
+			m.activeRequests.WithLabelValues(method).Dec()
+			m.otelActiveRequests.Add(ctx, -1, activeAttrs)
+		}()
+
+		c.Next()
+
+		elapsed := time.Since(start).Seconds()
+		route := routeTemplate(c)
+		if route == "" {
+			route = UnmatchedRoute
+		}
+		status := c.Writer.Status()
+		statusStr := strconv.Itoa(status)
+		tenantID := TenantID(c)
+		requestSize := max(c.Request.ContentLength, 0)
+		responseSize := int64(max(c.Writer.Size(), 0))
+
+		// Prometheus
+		// trace_id を exemplar として付与する (OpenMetrics 形式で公開した場合のみ出力される)
+		observer := m.duration.WithLabelValues(route, method, statusStr, tenantID)
+		if sc := oteltrace.SpanContextFromContext(ctx); sc.IsSampled() {
+			if eo, ok := observer.(prometheus.ExemplarObserver); ok {
+				eo.ObserveWithExemplar(elapsed, prometheus.Labels{"trace_id": sc.TraceID().String()})
+			} else {
+				observer.Observe(elapsed)
+			}
+		} else {
+			observer.Observe(elapsed)
+		}
+		m.requestSize.WithLabelValues(route, method, statusStr, tenantID).Observe(float64(requestSize))
+		m.responseSize.WithLabelValues(route, method, statusStr, tenantID).Observe(float64(responseSize))
+
+		// OTel (exemplar は SDK が context の span から付与する)
+		attrs := metric.WithAttributes(
+			attribute.String("http.route", route),
+			attribute.String("http.request.method", method),
+			attribute.Int("http.response.status_code", status),
+			attribute.String("tenant.id", tenantID),
+		)
+		m.otelDuration.Record(ctx, elapsed, attrs)
+		m.otelRequestSize.Record(ctx, requestSize, attrs)
+		m.otelResponseSize.Record(ctx, responseSize, attrs)
+
+		// errors
+		if code := responseErrorCode(c); code != "" {
+			m.errors.WithLabelValues(route, method, code, tenantID).Inc()
+			m.otelErrors.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("http.route", route),
+				attribute.String("http.request.method", method),
+				attribute.String("error.type", code),
+				attribute.String("tenant.id", tenantID),
+			))
+		}
+
+		// timeouts (RequestTimeoutEnforcer)
+		if source := c.GetString(requestTimeoutKey); source != "" {
+			m.timeouts.WithLabelValues(route, method, source, tenantID).Inc()
+			m.otelTimeouts.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("http.route", route),
+				attribute.String("http.request.method", method),
+				attribute.String("source", source),
+				attribute.String("tenant.id", tenantID),
+			))
+		}
+	}
+}
+
+// Describe は prometheus.Collector の実装
+func (m *HTTPMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.activeRequests.Describe(ch)
+	m.duration.Describe(ch)
+	m.requestSize.Describe(ch)
+	m.responseSize.Describe(ch)
+	m.errors.Describe(ch)
+	m.timeouts.Describe(ch)
+}
+
+// Collect は prometheus.Collector の実装
+func (m *HTTPMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.activeRequests.Collect(ch)
+	m.duration.Collect(ch)
+	m.requestSize.Collect(ch)
+	m.responseSize.Collect(ch)
+	m.errors.Collect(ch)
+	m.timeouts.Collect(ch)
+}
+
+// responseErrorCode はエラーレスポンスの cerrors のエラーコードを返す. エラーレスポンスでなければ空文字
+func responseErrorCode(c *gin.Context) string {
+
+	status := c.Writer.Status()
+	if status < 400 {
+		return ""
+	}
+
+	// ハンドラが返したエラーを優先
+	if ge := c.Errors.Last(); ge != nil {
+		if code := errorCodeOf(ge.Err); code != "" {
+			return code
+		}
+		var verrs validator.ValidationErrors
+		if errors.As(ge.Err, &verrs) {
+			return validationErrorCode
+		}
+	}
+
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return defaultServerErrorCode
+	}
+	return defaultClientErrorCode
+}
+
+func errorCodeOf(err error) string {
+	var cerr *cerrors.CustomError
+	if errors.As(err, &cerr) {
+		return cerr.Code()
+	}
+	return ""
+}
+
+func newHTTPMetricsError(err error) error {
+	return cerrors.ErrSystemInternal.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("failed to create http server instrument"),
+	)
+}
@@ -0,0 +1,106 @@
+// pkg/api/http_metrics_test.go
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+func newHTTPMetricsRouter(t *testing.T) (*gin.Engine, *HTTPMetrics) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	m, err := NewHTTPMetrics("goapp")
+	if err != nil {
+		t.Fatalf("NewHTTPMetrics() error = %v", err)
+	}
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/users/:user_id", func(c *gin.Context) {
+		if c.Param("user_id") == "missing" {
+			_ = c.Error(cerrors.ErrDBNotFound.New())
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	return router, m
+}
+
+func TestHTTPMetrics_UnmatchedRoute(t *testing.T) {
+	router, m := newHTTPMetricsRouter(t)
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// パス毎ではなく <unmatched> の1系列にまとめられること
+	if got := testutil.CollectAndCount(m, "goapp_http_server_request_duration_seconds"); got != 1 {
+		t.Errorf("duration series = %d; want 1", got)
+	}
+	want := `
+# HELP goapp_http_server_errors_total エラーレスポンス (4xx/5xx) の数
+# TYPE goapp_http_server_errors_total counter
+goapp_http_server_errors_total{error_code="RESOURCE_NOT_FOUND",http_request_method="GET",http_route="<unmatched>",tenant_id=""} 3
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want), "goapp_http_server_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHTTPMetrics_ErrorCodeFromCustomError(t *testing.T) {
+	router, m := newHTTPMetricsRouter(t)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/missing", nil))
+
+	want := `
+# HELP goapp_http_server_errors_total エラーレスポンス (4xx/5xx) の数
+# TYPE goapp_http_server_errors_total counter
+goapp_http_server_errors_total{error_code="DB_NOT_FOUND",http_request_method="GET",http_route="/users/:user_id",tenant_id=""} 1
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want), "goapp_http_server_errors_total"); err != nil {
+		t.Error(err)
+	}
+
+	// 処理中のリクエストは残らないこと
+	if got := testutil.ToFloat64(m.activeRequests.WithLabelValues(http.MethodGet)); got != 0 {
+		t.Errorf("active requests = %v; want 0", got)
+	}
+}
+
+func TestHTTPMetrics_TenantLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, err := NewHTTPMetrics("goapp")
+	if err != nil {
+		t.Fatalf("NewHTTPMetrics() error = %v", err)
+	}
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.Use(func(c *gin.Context) {
+		setTenant(c, models.DefaultTenantID)
+	})
+	router.GET("/users", func(c *gin.Context) {
+		c.Status(http.StatusForbidden)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	want := `
+# HELP goapp_http_server_errors_total エラーレスポンス (4xx/5xx) の数
+# TYPE goapp_http_server_errors_total counter
+goapp_http_server_errors_total{error_code="AUTHORIZATION",http_request_method="GET",http_route="/users",tenant_id="00000000-0000-0000-0000-000000000001"} 1
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want), "goapp_http_server_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,3 +2,4 @@
 package openapi
 
 //go:generate oapi-codegen -config oapi-codegen.yaml ../../../.openapi/openapi.yaml
+//go:generate oapi-codegen -config oapi-codegen.spec.yaml ../../../.openapi/openapi.yaml
@@ -0,0 +1,139 @@
+// pkg/api/openapi_docs.go
+package api
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// redoc.standalone.js は scripts/redoc_download.sh で取得する
+//
+//go:embed docs
+var docsAssets embed.FS
+
+const redocScript = "redoc.standalone.js"
+
+// OpenAPIDocs は埋め込まれた OpenAPI の定義 (YAML/JSON) と API ドキュメント (Redoc) を返す
+type OpenAPIDocs struct {
+	specYAML []byte
+	specJSON []byte
+
+	// redoc.standalone.js が埋め込まれていない場合は nil
+	redoc []byte
+	index *template.Template
+}
+
+// NewOpenAPIDocs は spec の servers を serverURLs に差し替えて OpenAPIDocs を生成する
+func NewOpenAPIDocs(spec *openapi3.T, serverURLs []string) (*OpenAPIDocs, error) {
+
+	spec.Servers = make(openapi3.Servers, 0, len(serverURLs))
+	for _, serverURL := range serverURLs {
+		spec.Servers = append(spec.Servers, &openapi3.Server{URL: serverURL})
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to marshal openapi spec to json"),
+		)
+	}
+	specYAML, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to marshal openapi spec to yaml"),
+		)
+	}
+
+	index, err := template.ParseFS(docsAssets, "docs/index.html.tmpl")
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to parse docs template"),
+		)
+	}
+
+	redoc, err := docsAssets.ReadFile(path.Join("docs", redocScript))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to read docs assets"),
+		)
+	}
+
+	return &OpenAPIDocs{
+		specYAML: specYAML,
+		specJSON: specJSON,
+		redoc:    redoc,
+		index:    index,
+	}, nil
+}
+
+// HasUI は API ドキュメントの表示に必要なファイル (redoc.standalone.js) が埋め込まれているかを返す
+func (p *OpenAPIDocs) HasUI() bool {
+	return p.redoc != nil
+}
+
+// SpecYAMLHandler は OpenAPI の定義を YAML で返す
+func (p *OpenAPIDocs) SpecYAMLHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/yaml; charset=utf-8", p.specYAML)
+	}
+}
+
+// SpecJSONHandler は OpenAPI の定義を JSON で返す
+func (p *OpenAPIDocs) SpecJSONHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", p.specJSON)
+	}
+}
+
+// Register は specYAMLPath, specJSONPath に定義を, docsPath が空でなければ API ドキュメントを登録する
+func (p *OpenAPIDocs) Register(router gin.IRoutes, specYAMLPath string, specJSONPath string, docsPath string) error {
+
+	router.GET(specYAMLPath, p.SpecYAMLHandler())
+	router.GET(specJSONPath, p.SpecJSONHandler())
+
+	if docsPath == "" {
+		return nil
+	}
+	if !p.HasUI() {
+		return cerrors.ErrSystemInternal.New(
+			cerrors.WithMessagef("%s is not embedded (run scripts/redoc_download.sh)", redocScript),
+		)
+	}
+
+	scriptPath := path.Join(docsPath, redocScript)
+	var index bytes.Buffer
+	if err := p.index.Execute(&index, map[string]string{
+		"Title":     "API Reference",
+		"SpecURL":   specJSONPath,
+		"ScriptURL": scriptPath,
+	}); err != nil {
+		return cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to render docs page"),
+		)
+	}
+
+	router.GET(docsPath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index.Bytes())
+	})
+	router.GET(scriptPath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/javascript; charset=utf-8", p.redoc)
+	})
+	return nil
+}
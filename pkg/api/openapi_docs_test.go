@@ -0,0 +1,101 @@
+// pkg/api/openapi_docs_test.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+)
+
+func newOpenAPIDocs(t *testing.T, serverURLs ...string) *OpenAPIDocs {
+	t.Helper()
+
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := NewOpenAPIDocs(spec, serverURLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return docs
+}
+
+func TestOpenAPIDocs_Spec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	docs := newOpenAPIDocs(t, "https://api.example.com", "https://api.example.org/v1")
+	if err := docs.Register(router, "/openapi.yaml", "/openapi.json", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path        string
+		contentType string
+		unmarshal   func([]byte, any) error
+	}{
+		{"/openapi.json", "application/json; charset=utf-8", json.Unmarshal},
+		{"/openapi.yaml", "application/yaml; charset=utf-8", yaml.Unmarshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d; want 200", w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q; want %q", got, tt.contentType)
+			}
+
+			var doc struct {
+				OpenAPI string `json:"openapi" yaml:"openapi"`
+				Servers []struct {
+					URL string `json:"url" yaml:"url"`
+				} `json:"servers" yaml:"servers"`
+				Paths map[string]any `json:"paths" yaml:"paths"`
+			}
+			if err := tt.unmarshal(w.Body.Bytes(), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc.OpenAPI == "" || doc.Paths["/users"] == nil {
+				t.Errorf("document does not look like the api spec: openapi=%q paths=%d", doc.OpenAPI, len(doc.Paths))
+			}
+			if len(doc.Servers) != 2 || doc.Servers[0].URL != "https://api.example.com" || doc.Servers[1].URL != "https://api.example.org/v1" {
+				t.Errorf("servers = %+v; want the configured urls", doc.Servers)
+			}
+		})
+	}
+}
+
+func TestOpenAPIDocs_UI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	docs := newOpenAPIDocs(t)
+
+	err := docs.Register(router, "/openapi.yaml", "/openapi.json", "/docs")
+	if !docs.HasUI() {
+		// redoc.standalone.js を取得していない場合は登録できない
+		if err == nil {
+			t.Error("Register() error = nil; want error when docs assets are not embedded")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/docs", "/docs/" + redocScript} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("GET %s = %d (%d bytes); want 200 with body", path, w.Code, w.Body.Len())
+		}
+	}
+}
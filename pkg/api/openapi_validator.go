@@ -0,0 +1,438 @@
+// pkg/api/openapi_validator.go
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+func init() {
+	// kin-openapi は既定では format: email を照合しない
+	openapi3.DefineStringFormatValidator("email", openapi3.NewRegexpFormatValidator(openapi3.FormatOfStringForEmail))
+
+	// kin-openapi は NDJSON を読めない. format: binary の文字列として扱う
+	openapi3filter.RegisterBodyDecoder(mediaTypeNDJSON, openapi3filter.FileBodyDecoder)
+}
+
+// ResponseValidationMode はレスポンスを OpenAPI の定義と照合した結果の扱い
+type ResponseValidationMode string
+
+const (
+	ResponseValidationOff  ResponseValidationMode = "off"  // 照合しない
+	ResponseValidationLog  ResponseValidationMode = "log"  // 定義と合わなければログに出力する
+	ResponseValidationFail ResponseValidationMode = "fail" // 定義と合わなければ 500 に差し替える (開発/テスト用)
+)
+
+// OpenAPIValidator はリクエスト (パス, クエリ, ヘッダ, 本文) とレスポンスを OpenAPI の定義と照合する
+//
+// リクエストが定義に合わない場合は 400 で打ち切り, ProblemDetailsRenderer が invalid_params に変換して返す
+// 定義に無いパスは照合せずに通す (/metrics 等)
+// ミドルウェアは ResponseMiddleware, ProblemDetailsRenderer, RequestMiddleware の順に置く
+type OpenAPIValidator struct {
+	router             routers.Router
+	requestValidation  bool
+	responseValidation ResponseValidationMode
+}
+
+type openAPIValidatorOptions struct {
+	requestValidation  bool
+	responseValidation ResponseValidationMode
+}
+
+type OpenAPIValidatorOption func(*openAPIValidatorOptions)
+
+// WithRequestValidation はリクエストの照合の有無を指定する. 既定では照合する
+func WithRequestValidation(enabled bool) OpenAPIValidatorOption {
+	return func(o *openAPIValidatorOptions) {
+		o.requestValidation = enabled
+	}
+}
+
+// WithResponseValidation はレスポンスの照合の扱いを指定する. 既定では照合しない
+func WithResponseValidation(mode ResponseValidationMode) OpenAPIValidatorOption {
+	return func(o *openAPIValidatorOptions) {
+		o.responseValidation = mode
+	}
+}
+
+func NewOpenAPIValidator(spec *openapi3.T, options ...OpenAPIValidatorOption) (*OpenAPIValidator, error) {
+
+	opts := &openAPIValidatorOptions{
+		requestValidation:  true,
+		responseValidation: ResponseValidationOff,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	switch opts.responseValidation {
+	case ResponseValidationOff, ResponseValidationLog, ResponseValidationFail:
+	default:
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid response validation mode: %s", opts.responseValidation),
+		)
+	}
+
+	// 宛先のホストに関わらず照合する
+	spec.Servers = nil
+	if err := spec.Validate(context.Background()); err != nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("invalid openapi spec"),
+		)
+	}
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create openapi router"),
+		)
+	}
+
+	return &OpenAPIValidator{
+		router:             router,
+		requestValidation:  opts.requestValidation,
+		responseValidation: opts.responseValidation,
+	}, nil
+}
+
+// RequestMiddleware はリクエストを照合する. 定義に合わなければ 400 で打ち切り, エラーを c.Error に積む
+// ProblemDetailsRenderer より後ろに置く
+func (p *OpenAPIValidator) RequestMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !p.requestValidation {
+			c.Next()
+			return
+		}
+
+		input, ok := p.findRoute(c.Request)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		// 本文は読んだ後に読み直せるよう差し替えられる
+		// ストリーミングの本文 (POST /users:import 等) は全体を読み込むことになるため照合しない. ハンドラが 1 行ずつ照合する
+		if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); isStreamingMediaType(mediaType) {
+			input.Options.ExcludeRequestBody = true
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			c.Status(http.StatusBadRequest)
+			_ = c.Error(cerrors.ErrValidation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("request does not match the openapi spec"),
+			))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ResponseMiddleware はレスポンスを照合する. ProblemDetailsRenderer が書くエラーの本文も照合するため, それより前に置く
+func (p *OpenAPIValidator) ResponseMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if p.responseValidation == ResponseValidationOff {
+			c.Next()
+			return
+		}
+
+		input, ok := p.findRoute(c.Request)
+		if !ok || hasStreamingResponse(input.Route.Operation) {
+			// ストリーミングのレスポンス (GET /users:export 等) は溜めずにそのまま書き出す
+			c.Next()
+			return
+		}
+
+		// レスポンスを溜めておき, 照合してから書き出す
+		w := &bufferedResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		options := &openapi3filter.Options{
+			IncludeResponseStatus: true, // 定義に無いステータスコードも検出する
+			MultiError:            true,
+		}
+		options.WithCustomSchemaErrorFunc(compactSchemaError)
+		err := openapi3filter.ValidateResponse(c.Request.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 w.Status(),
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(w.body.Bytes())),
+			Options:                options,
+		})
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("response does not match the openapi spec",
+				"method", c.Request.Method,
+				"route", input.Route.Path,
+				"status", w.Status(),
+				"error", err,
+			)
+			if p.responseValidation == ResponseValidationFail {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, openapi.ProblemDetails{
+					Type:   PtrOrNil("/internal_server_error"),
+					Title:  PtrOrNil(http.StatusText(http.StatusInternalServerError)),
+					Status: PtrOrNil(int32(http.StatusInternalServerError)),
+					Detail: PtrOrNil("response does not match the openapi spec"),
+				})
+				return
+			}
+		}
+		w.flush()
+	}
+}
+
+// findRoute はリクエストに対応する operation を引く. 定義に無いパス/メソッド (404/405 は gin に任せる) の場合は false を返す
+func (p *OpenAPIValidator) findRoute(req *http.Request) (*openapi3filter.RequestValidationInput, bool) {
+
+	route, pathParams, err := p.router.FindRoute(req)
+	if err != nil {
+		return nil, false
+	}
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc, // 認証はミドルウェアで行う
+	}
+	options.WithCustomSchemaErrorFunc(compactSchemaError)
+	return &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    options,
+	}, true
+}
+
+// isStreamingMediaType は 1 行ずつ読み書きする (全体をメモリに載せない) メディアタイプかを返す
+func isStreamingMediaType(mediaType string) bool {
+	switch mediaType {
+	case mediaTypeNDJSON, mediaTypeCSV:
+		return true
+	default:
+		return false
+	}
+}
+
+// hasStreamingResponse は operation のレスポンスにストリーミングのメディアタイプがあるかを返す
+func hasStreamingResponse(operation *openapi3.Operation) bool {
+	if operation == nil || operation.Responses == nil {
+		return false
+	}
+	for _, response := range operation.Responses.Map() {
+		if response.Value == nil {
+			continue
+		}
+		for mediaType := range response.Value.Content {
+			if isStreamingMediaType(mediaType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compactSchemaError はスキーマの照合のエラーを 1 行にする. 既定ではスキーマと値の全体を含み, ログが読みづらい
+func compactSchemaError(err *openapi3.SchemaError) string {
+	return fmt.Sprintf("error at %q: %s", "/"+strings.Join(err.JSONPointer(), "/"), err.Reason)
+}
+
+// bufferedResponseWriter はレスポンスを照合するまで書き出さずに溜めておく
+// ヘッダは元の ResponseWriter と共有する
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.written
+}
+
+// Flush は溜めている間は何もしない (ストリーミングは対象外)
+func (w *bufferedResponseWriter) Flush() {}
+
+// flush は溜めたレスポンスを元の ResponseWriter に書き出す
+func (w *bufferedResponseWriter) flush() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.written {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
+
+// isOpenAPIRequestError は err が OpenAPIValidator のリクエストの照合によるものかを返す
+func isOpenAPIRequestError(err error) bool {
+	var multiErr openapi3.MultiError
+	var reqErr *openapi3filter.RequestError
+	return errors.As(err, &multiErr) || errors.As(err, &reqErr)
+}
+
+// openAPIInvalidParams はリクエストの照合の結果を invalid_params に変換する
+// name はパラメータ名, 本文の場合はフィールドの JSON ポインタを "." で繋いだもの (本文全体の場合は "body")
+func openAPIInvalidParams(err error) []openapi.InvalidParam {
+
+	invalidParams := []openapi.InvalidParam{}
+	add := func(name string, reason string) {
+		invalidParams = append(invalidParams, openapi.InvalidParam{
+			Name:   name,
+			Reason: fmt.Sprintf("'%s' %s", name, reason),
+		})
+	}
+
+	var walk func(err error, name string)
+	walk = func(err error, name string) {
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, child := range e {
+				walk(child, name)
+			}
+		case *openapi3filter.RequestError:
+			switch {
+			case e.Parameter != nil:
+				name = e.Parameter.Name
+			case e.RequestBody != nil:
+				name = "body"
+			}
+			if e.Err == nil {
+				add(name, e.Reason)
+				return
+			}
+			walk(e.Err, name)
+		case *openapi3.SchemaError:
+			// 本文の場合はフィールドを指す
+			if pointer := e.JSONPointer(); len(pointer) > 0 {
+				name = strings.Join(pointer, ".")
+			}
+			add(name, openAPISchemaReason(e))
+		case *openapi3filter.ParseError:
+			add(name, e.Reason)
+		default:
+			switch {
+			case errors.Is(err, openapi3filter.ErrInvalidRequired):
+				add(name, "is required")
+			case errors.Is(err, openapi3filter.ErrInvalidEmptyValue):
+				add(name, "must not be empty")
+			default:
+				add(name, err.Error())
+			}
+		}
+	}
+
+	var multiErr openapi3.MultiError
+	var reqErr *openapi3filter.RequestError
+	switch {
+	case errors.As(err, &multiErr):
+		walk(multiErr, "")
+	case errors.As(err, &reqErr):
+		walk(reqErr, "")
+	}
+	return invalidParams
+}
+
+// openAPISchemaReason はスキーマの照合の結果を validator のタグと同じ言い回しにする. 対応していないものは kin-openapi の文言を使う
+func openAPISchemaReason(e *openapi3.SchemaError) string {
+
+	schema := e.Schema
+	if schema == nil {
+		return e.Reason
+	}
+
+	switch e.SchemaField {
+	case "required":
+		return "is required"
+	case "type":
+		if schema.Type != nil {
+			return fmt.Sprintf("must be of type %s", strings.Join(schema.Type.Slice(), " or "))
+		}
+	case "enum":
+		return "must be one of the allowed values"
+	case "format":
+		switch schema.Format {
+		case "email":
+			return "must be a valid email address"
+		case "uuid":
+			return "must be a valid UUID"
+		case "date-time":
+			return "must be a valid datetime"
+		default:
+			return fmt.Sprintf("must be a valid %s", schema.Format)
+		}
+	case "pattern":
+		return fmt.Sprintf("must match the pattern %s", schema.Pattern)
+	case "minLength":
+		return fmt.Sprintf("must be at least %d characters long", schema.MinLength)
+	case "maxLength":
+		if schema.MaxLength != nil {
+			return fmt.Sprintf("must be at most %d characters long", *schema.MaxLength)
+		}
+	case "minimum":
+		if schema.Min != nil {
+			return fmt.Sprintf("must be greater than or equal to %v", *schema.Min)
+		}
+	case "maximum":
+		if schema.Max != nil {
+			return fmt.Sprintf("must be less than or equal to %v", *schema.Max)
+		}
+	case "minItems":
+		return fmt.Sprintf("must contain at least %d items", schema.MinItems)
+	case "maxItems":
+		if schema.MaxItems != nil {
+			return fmt.Sprintf("must contain at most %d items", *schema.MaxItems)
+		}
+	}
+	return e.Reason
+}
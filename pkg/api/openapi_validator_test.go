@@ -0,0 +1,195 @@
+// pkg/api/openapi_validator_test.go
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+)
+
+const validatorTestUserID = "0197b0c8-0000-7000-8000-000000000000"
+
+// newOpenAPIValidatorRouter は NewRouter と同じ順にミドルウェアを置き, GET /users/{user_id} と POST /users が handler を返すルーターを生成する
+func newOpenAPIValidatorRouter(t *testing.T, mode ResponseValidationMode, handler gin.HandlerFunc) *gin.Engine {
+	t.Helper()
+
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewOpenAPIValidator(spec, WithResponseValidation(mode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer, err := NewProblemDetailsRenderer("https://example.com/", slog.New(slog.NewTextHandler(io.Discard, nil)), tracer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(v.ResponseMiddleware())
+	router.Use(renderer.Middleware())
+	router.Use(v.RequestMiddleware())
+	router.GET("/users/:user_id", handler)
+	router.POST("/users", handler)
+	return router
+}
+
+func TestOpenAPIValidator_Request(t *testing.T) {
+	called := false
+	router := newOpenAPIValidatorRouter(t, ResponseValidationOff, func(c *gin.Context) {
+		called = true
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantParams []openapi.InvalidParam
+	}{
+		{
+			name:       "valid",
+			method:     http.MethodGet,
+			path:       "/users/" + validatorTestUserID,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "path parameter too short",
+			method:     http.MethodGet,
+			path:       "/users/abc",
+			wantStatus: http.StatusBadRequest,
+			wantParams: []openapi.InvalidParam{
+				{Name: "user_id", Reason: "'user_id' must be at least 36 characters long"},
+			},
+		},
+		{
+			name:       "body with missing and invalid fields",
+			method:     http.MethodPost,
+			path:       "/users",
+			body:       `{"email":"not-an-email"}`,
+			wantStatus: http.StatusBadRequest,
+			wantParams: []openapi.InvalidParam{
+				{Name: "email", Reason: "'email' must be a valid email address"},
+				{Name: "name", Reason: "'name' is required"},
+			},
+		},
+		{
+			name:       "missing body",
+			method:     http.MethodPost,
+			path:       "/users",
+			wantStatus: http.StatusBadRequest,
+			wantParams: []openapi.InvalidParam{
+				{Name: "body", Reason: "'body' is required"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantParams == nil {
+				if !called {
+					t.Error("handler was not called for a valid request")
+				}
+				return
+			}
+			if called {
+				t.Error("handler was called for an invalid request")
+			}
+
+			var problem openapi.ProblemDetails
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.InvalidParams == nil {
+				t.Fatalf("invalid_params is missing (body %s)", w.Body)
+			}
+			got := *problem.InvalidParams
+			if len(got) != len(tt.wantParams) {
+				t.Fatalf("invalid_params = %+v; want %+v", got, tt.wantParams)
+			}
+			for i := range got {
+				if got[i] != tt.wantParams[i] {
+					t.Errorf("invalid_params[%d] = %+v; want %+v", i, got[i], tt.wantParams[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPIValidator_Response(t *testing.T) {
+	// email が無く定義に合わない
+	drifted := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user": gin.H{"id": validatorTestUserID, "name": "alice"}})
+	}
+	notFound := func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, openapi.ProblemDetails{Status: PtrOrNil(int32(http.StatusNotFound))})
+	}
+
+	tests := []struct {
+		name       string
+		mode       ResponseValidationMode
+		handler    gin.HandlerFunc
+		wantStatus int
+	}{
+		{"off passes drifted response", ResponseValidationOff, drifted, http.StatusOK},
+		{"log passes drifted response", ResponseValidationLog, drifted, http.StatusOK},
+		{"fail replaces drifted response", ResponseValidationFail, drifted, http.StatusInternalServerError},
+		{"fail passes declared response", ResponseValidationFail, notFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newOpenAPIValidatorRouter(t, tt.mode, tt.handler)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/"+validatorTestUserID, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestOpenAPIValidator_FailValidatesRenderedProblemDetails(t *testing.T) {
+	// 定義に合わないリクエストに対して ProblemDetailsRenderer が書いた 400 も定義と照合され, 通る
+	router := newOpenAPIValidatorRouter(t, ResponseValidationFail, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d; want 400 (body %s)", w.Code, w.Body)
+	}
+}
+
+func TestNewOpenAPIValidator_InvalidMode(t *testing.T) {
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOpenAPIValidator(spec, WithResponseValidation("strict")); err == nil {
+		t.Error("NewOpenAPIValidator() error = nil; want error for unknown mode")
+	}
+}
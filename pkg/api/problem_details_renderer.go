@@ -19,6 +19,7 @@ import (
 
 	"github.com/aazw/go-base/pkg/api/openapi"
 	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
 )
 
 func init() {
@@ -94,6 +95,7 @@ func (p *ProblemDetailsRenderer) Middleware() gin.HandlerFunc {
 		if errors.As(ge.Err, &verrs) {
 			// ここで JSON をまだ書いていなければ上書きする
 			if !c.Writer.Written() {
+				logger := logging.FromContext(c.Request.Context())
 				invalidParams := make([]openapi.InvalidParam, 0, len(verrs))
 
 				for _, fe := range verrs {
@@ -101,7 +103,7 @@ func (p *ProblemDetailsRenderer) Middleware() gin.HandlerFunc {
 					fieldName := fe.Namespace()[strings.IndexByte(fe.Namespace(), '.')+1:]
 
 					// 独自関数でメッセージ生成
-					verb := p.validationMsg(fe)
+					verb := p.validationMsg(logger, fe)
 					errMsg := fmt.Sprintf("'%s' %s", fieldName, verb)
 
 					invalidParams = append(invalidParams, openapi.InvalidParam{
@@ -110,31 +112,47 @@ func (p *ProblemDetailsRenderer) Middleware() gin.HandlerFunc {
 					})
 				}
 
-				status := c.Writer.Status()
-				if status < 400 {
-					status = http.StatusBadRequest
-				}
+				p.abortWithInvalidParams(c, traceID, invalidParams)
+				return
+			}
+		}
 
-				c.AbortWithStatusJSON(status, openapi.ProblemDetails{
-					Type:          PtrOrNil(p.uriReference),
-					Title:         PtrOrNil(http.StatusText(status)),
-					Status:        PtrOrNil(int32(status)),
-					Detail:        PtrOrNil("validation failed for one or more fields"),
-					InvalidParams: &invalidParams,
-					TraceId:       &traceID,
-				})
+		// OpenAPIValidator によるリクエストの照合の結果
+		if isOpenAPIRequestError(ge.Err) {
+			if !c.Writer.Written() {
+				p.abortWithInvalidParams(c, traceID, openAPIInvalidParams(ge.Err))
 				return
 			}
 		}
 	}
 }
 
+func (p *ProblemDetailsRenderer) abortWithInvalidParams(c *gin.Context, traceID string, invalidParams []openapi.InvalidParam) {
+
+	status := c.Writer.Status()
+	if status < 400 {
+		status = http.StatusBadRequest
+	}
+
+	c.AbortWithStatusJSON(status, openapi.ProblemDetails{
+		Type:          PtrOrNil(p.uriReference),
+		Title:         PtrOrNil(http.StatusText(status)),
+		Status:        PtrOrNil(int32(status)),
+		Detail:        PtrOrNil("validation failed for one or more fields"),
+		InvalidParams: &invalidParams,
+		TraceId:       &traceID,
+	})
+}
+
 // Readableなメッセージ生成
-func (p *ProblemDetailsRenderer) validationMsg(fe validator.FieldError) string {
+func (p *ProblemDetailsRenderer) validationMsg(logger *slog.Logger, fe validator.FieldError) string {
 
 	verb, ok := p.verbForTag(fe.Tag())
-	if !ok && p.logger != nil {
-		p.logger.Error("verb_for_tag error", "error", fe)
+	if !ok {
+		if logger == nil {
+			logger = p.logger
+		}
+		logger.Error("unsupported validation pattern error", "tag", fe.Tag(), "error", fe)
 	}
 	return verb
 }
@@ -668,10 +686,6 @@ func (p *ProblemDetailsRenderer) verbForTag(tag string) (string, bool) {
 		verb := "is invalid"
 		return verb, true
 	default:
-		if p.logger != nil {
-			p.logger.Error("unsupported validation pattern error", "tag", tag)
-		}
-
 		return "is invalid", false
 	}
 }
@@ -0,0 +1,31 @@
+// pkg/api/profile_labeler.go
+package api
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grafana/pyroscope-go"
+)
+
+// ProfileLabeler はリクエストの処理を pyroscope.TagWrapper で包み, プロファイルにルートと HTTP メソッドのラベルを付ける
+// Pyroscope 上でエンドポイント単位に絞り込んでフレームグラフを見られるようにするためのもの
+func ProfileLabeler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		// パスをそのまま使うとカーディナリティが爆発するため, ルートテンプレートを使う
+		route := routeTemplate(c)
+		if route == "" {
+			route = UnmatchedRoute
+		}
+
+		labels := pyroscope.Labels(
+			"http_route", route,
+			"http_method", c.Request.Method,
+		)
+		pyroscope.TagWrapper(c.Request.Context(), labels, func(ctx context.Context) {
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+		})
+	}
+}
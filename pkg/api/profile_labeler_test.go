@@ -0,0 +1,33 @@
+// pkg/api/profile_labeler_test.go
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestProfileLabeler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var gotRoute, gotMethod string
+	router := gin.New()
+	router.Use(ProfileLabeler())
+	router.GET("/users/:user_id", func(c *gin.Context) {
+		gotRoute, _ = pprof.Label(c.Request.Context(), "http_route")
+		gotMethod, _ = pprof.Label(c.Request.Context(), "http_method")
+		c.Status(http.StatusNoContent)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/123", nil))
+
+	if gotRoute != "/users/:user_id" {
+		t.Errorf("http_route = %q; want %q", gotRoute, "/users/:user_id")
+	}
+	if gotMethod != http.MethodGet {
+		t.Errorf("http_method = %q; want %q", gotMethod, http.MethodGet)
+	}
+}
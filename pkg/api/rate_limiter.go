@@ -2,6 +2,8 @@ package api
 
 import (
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
@@ -20,3 +22,60 @@ func RateLimiter(rps rate.Limit, burst int) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// KeyedRateLimiter はキー (API キーの ID 等) ごとに別々の制限をかける
+// 一定時間使われなかったキーの状態は捨てる
+type KeyedRateLimiter struct {
+	mu        sync.Mutex
+	limiters  map[string]*keyedLimiter
+	idleTTL   time.Duration
+	lastSweep time.Time
+}
+
+type keyedLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewKeyedRateLimiter は idleTTL の間使われなかったキーの状態を捨てる KeyedRateLimiter を生成する
+func NewKeyedRateLimiter(idleTTL time.Duration) *KeyedRateLimiter {
+	return &KeyedRateLimiter{
+		limiters:  map[string]*keyedLimiter{},
+		idleTTL:   idleTTL,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow は key の制限 (毎秒 rps, バースト burst) の範囲で 1 リクエストを許可するかを返す
+// 許可しない場合は次に許可できるまでの時間も返す. 同じ key の制限が変わった場合は新しい制限で数え直す
+func (p *KeyedRateLimiter) Allow(key string, rps rate.Limit, burst int) (bool, time.Duration) {
+
+	now := time.Now()
+
+	p.mu.Lock()
+	if now.Sub(p.lastSweep) >= p.idleTTL {
+		for k, l := range p.limiters {
+			if now.Sub(l.lastSeen) >= p.idleTTL {
+				delete(p.limiters, k)
+			}
+		}
+		p.lastSweep = now
+	}
+	l, ok := p.limiters[key]
+	if !ok || l.limiter.Limit() != rps || l.limiter.Burst() != burst {
+		l = &keyedLimiter{limiter: rate.NewLimiter(rps, burst)}
+		p.limiters[key] = l
+	}
+	l.lastSeen = now
+	p.mu.Unlock()
+
+	r := l.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return false, 0
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
@@ -0,0 +1,62 @@
+// pkg/api/read_your_writes.go
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/db"
+)
+
+// 同じセッションで最後に書き込みが成功した時刻 (UnixNano) を保存するセッションのキー
+const lastWriteAtSessionKey = "db.last_write_at"
+
+// ReadYourWrites はセッション単位の read-your-writes を実現するミドルウェア
+// 書き込みが成功したらセッションに時刻を記録し, window の間は同じセッションの読み取りをレプリカではなくプライマリに向ける
+// SessionLoadAndSave より後ろに置くこと
+func ReadYourWrites(sm *scs.SessionManager, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx := c.Request.Context()
+
+		// セッション対象外のパスでは同じリクエスト内のみ
+		if !hasSession(sm, ctx) {
+			c.Request = c.Request.WithContext(db.WithReadYourWrites(ctx, false, nil))
+			c.Next()
+			return
+		}
+
+		primary := false
+		if window > 0 {
+			if lastWriteAt := sm.GetInt64(ctx, lastWriteAtSessionKey); lastWriteAt > 0 {
+				primary = time.Since(time.Unix(0, lastWriteAt)) < window
+			}
+		}
+
+		// レスポンスを書く前 (= セッションのコミット前) に書き込みの時刻を記録する
+		var onWrite func(context.Context)
+		if window > 0 {
+			onWrite = func(context.Context) {
+				sm.Put(ctx, lastWriteAtSessionKey, time.Now().UnixNano())
+			}
+		}
+
+		c.Request = c.Request.WithContext(db.WithReadYourWrites(ctx, primary, onWrite))
+		c.Next()
+	}
+}
+
+// hasSession は ctx にセッションが読み込まれているかを返す
+// scs はセッションの無い context に対してパニックするため
+func hasSession(sm *scs.SessionManager, ctx context.Context) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	sm.Token(ctx)
+	return true
+}
@@ -0,0 +1,108 @@
+// pkg/api/read_your_writes_test.go
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/db"
+)
+
+func newReadYourWritesRouter(t *testing.T, window time.Duration, gotPrimary *bool) (*gin.Engine, *scs.SessionManager) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	sm := scs.New()
+	sm.Store = memstore.New()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		var token string
+		if cookie, err := c.Request.Cookie(sm.Cookie.Name); err == nil {
+			token = cookie.Value
+		}
+		ctx, err := sm.Load(c.Request.Context(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		token, expiry, err := sm.Commit(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		http.SetCookie(c.Writer, &http.Cookie{Name: sm.Cookie.Name, Value: token, Expires: expiry})
+	})
+	router.Use(ReadYourWrites(sm, window))
+	router.POST("/users", func(c *gin.Context) {
+		db.MarkWritten(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/users", func(c *gin.Context) {
+		*gotPrimary = db.ReadFromPrimary(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+	return router, sm
+}
+
+func TestReadYourWrites_PrimaryAfterWrite(t *testing.T) {
+	var gotPrimary bool
+	router, sm := newReadYourWritesRouter(t, time.Minute, &gotPrimary)
+
+	// 書き込み前はレプリカ
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if gotPrimary {
+		t.Error("ReadFromPrimary() = true before write; want false")
+	}
+	cookie := w.Result().Cookies()[0]
+
+	// 書き込み
+	req := httptest.NewRequest(http.MethodPost, "/users", nil)
+	req.AddCookie(cookie)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// 同じセッションの読み取りはプライマリ
+	req = httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.AddCookie(cookie)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if !gotPrimary {
+		t.Errorf("ReadFromPrimary() = false after write in same session; want true (cookie %s)", sm.Cookie.Name)
+	}
+
+	// 別のセッションはレプリカ
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	if gotPrimary {
+		t.Error("ReadFromPrimary() = true for another session; want false")
+	}
+}
+
+func TestReadYourWrites_WithoutSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sm := scs.New()
+
+	var gotPrimary bool
+	router := gin.New()
+	router.Use(ReadYourWrites(sm, time.Minute))
+	router.GET("/metrics", func(c *gin.Context) {
+		db.MarkWritten(c.Request.Context())
+		gotPrimary = db.ReadFromPrimary(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	// 同じリクエスト内では書き込み後にプライマリ
+	if !gotPrimary {
+		t.Error("ReadFromPrimary() = false after write in same request; want true")
+	}
+}
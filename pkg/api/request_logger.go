@@ -0,0 +1,157 @@
+// pkg/api/request_logger.go
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/audit"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+const (
+	// RequestIDHeader はリクエストIDを受け渡しするヘッダ名
+	RequestIDHeader = "X-Request-ID"
+
+	// クライアントから受け取るリクエストIDの最大長
+	maxRequestIDLength = 128
+
+	// gin.Context に保持するユーザのサブジェクト (OIDC の sub 等) のキー
+	userSubjectKey = "user_subject"
+)
+
+// RequestLogger はリクエストIDの採番と、request-scoped な logger の context への紐付け、アクセスログ出力を行う
+type RequestLogger struct {
+	logger *slog.Logger
+}
+
+func NewRequestLogger(logger *slog.Logger) (*RequestLogger, error) {
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &RequestLogger{
+		logger: logger,
+	}, nil
+}
+
+// Middleware は X-Request-ID を受け取り(無ければ採番し)レスポンスにも返す
+// trace_id/span_id を拾うため、otelgin.Middleware より後ろに置くこと
+func (p *RequestLogger) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// リクエストIDの受け取り or 採番
+		requestID := c.GetHeader(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			id, err := uuid.NewV7()
+			if err != nil {
+				p.logger.Error("failed to generate request id", "error", cerrors.ErrSystemInternal.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("faild to negerate a new uuid v7"),
+				))
+				id = uuid.New()
+			}
+			requestID = id.String()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		// request-scoped logger
+		route := routeTemplate(c)
+		args := []any{
+			"request_id", requestID,
+			"method", c.Request.Method,
+			"route", route,
+		}
+		spanCtx := oteltrace.SpanContextFromContext(c.Request.Context())
+		if spanCtx.IsValid() {
+			args = append(args,
+				"trace_id", spanCtx.TraceID().String(),
+				"span_id", spanCtx.SpanID().String(),
+			)
+		}
+		logger := p.logger.With(args...)
+
+		ctx := logging.NewContextWithRequestID(c.Request.Context(), requestID)
+		ctx = logging.NewContext(ctx, logger)
+
+		// 監査ログに記録するリクエストの情報
+		ctx = audit.NewContextWithRequest(ctx, audit.Request{
+			ClientIP:  c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		// アクセスログ
+		// https://github.com/gin-gonic/gin/blob/v1.10.0/logger.go#L141-L161
+		latency := time.Since(start)
+		if latency > time.Minute {
+			latency = latency.Truncate(time.Second)
+		}
+		accessArgs := []any{
+			"access_timestamp", start.Format(time.RFC3339Nano),
+			"status_code", c.Writer.Status(),
+			"latency", latency,
+			"client_ip", c.ClientIP(),
+			"path", c.Request.URL.Path,
+		}
+		if errorMessage := c.Errors.ByType(gin.ErrorTypePrivate).String(); errorMessage != "" {
+			accessArgs = append(accessArgs, "error_message", errorMessage)
+		}
+
+		// 後段で user_subject が付与された logger を優先して使う
+		ctx = c.Request.Context()
+		logging.FromContext(ctx).InfoContext(ctx, "gin access log", accessArgs...)
+	}
+}
+
+// SetUserSubject は認証済みユーザのサブジェクトを gin.Context に保持し、request-scoped な logger にも付与する
+// 監査ログには OIDC のサブジェクトとして記録する
+// 認証ミドルウェアから呼ぶことを想定
+func SetUserSubject(c *gin.Context, subject string) {
+	setPrincipal(c, models.AuditActor{Type: models.AuditActorTypeOIDC, ID: subject})
+}
+
+// setPrincipal は認証済みの主体を gin.Context (UserSubject), request-scoped な logger, 監査ログの主体に設定する
+func setPrincipal(c *gin.Context, actor models.AuditActor) {
+	if actor.ID == "" {
+		return
+	}
+	c.Set(userSubjectKey, actor.ID)
+	ctx := logging.With(c.Request.Context(), userSubjectKey, actor.ID)
+	c.Request = c.Request.WithContext(audit.NewContextWithActor(ctx, actor))
+}
+
+// SetAuditActor は監査ログに記録する変更の主体 (API キー, セッション等) を設定する
+// 認証ミドルウェアから呼ぶことを想定
+func SetAuditActor(c *gin.Context, actor models.AuditActor) {
+	c.Request = c.Request.WithContext(audit.NewContextWithActor(c.Request.Context(), actor))
+}
+
+// UserSubject は SetUserSubject で保持されたサブジェクトを返す
+func UserSubject(c *gin.Context) string {
+	return c.GetString(userSubjectKey)
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		// printable ASCII のみ許可 (ログインジェクション対策)
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
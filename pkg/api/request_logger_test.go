@@ -0,0 +1,89 @@
+// pkg/api/request_logger_test.go
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+func newRequestLoggerRouter(t *testing.T, buf *bytes.Buffer) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	requestLogger, err := NewRequestLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+	if err != nil {
+		t.Fatalf("NewRequestLogger() error = %v", err)
+	}
+
+	router := gin.New()
+	router.Use(requestLogger.Middleware())
+	router.GET("/users/:user_id", func(c *gin.Context) {
+		SetUserSubject(c, "subject-1")
+		logging.FromContext(c.Request.Context()).Info("in handler")
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func TestRequestLogger_EchoesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	router := newRequestLoggerRouter(t, &buf)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/123", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "req-123" {
+		t.Errorf("%s = %q; want %q", RequestIDHeader, got, "req-123")
+	}
+
+	// handler 内のログとアクセスログの両方に request_id/route/user_subject が載ること
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log lines = %d; want 2\nraw: %s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("json unmarshal error: %v\nraw: %s", err, line)
+		}
+		if got := rec["request_id"]; got != "req-123" {
+			t.Errorf("request_id = %v; want %q", got, "req-123")
+		}
+		if got := rec["route"]; got != "/users/:user_id" {
+			t.Errorf("route = %v; want %q", got, "/users/:user_id")
+		}
+		if got := rec["user_subject"]; got != "subject-1" {
+			t.Errorf("user_subject = %v; want %q", got, "subject-1")
+		}
+	}
+}
+
+func TestRequestLogger_GeneratesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	router := newRequestLoggerRouter(t, &buf)
+
+	for _, header := range []string{"", "contains space", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/users/123", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		got := w.Header().Get(RequestIDHeader)
+		if got == "" || got == header {
+			t.Errorf("header %q: %s = %q; want newly generated id", header, RequestIDHeader, got)
+		}
+	}
+}
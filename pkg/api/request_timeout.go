@@ -0,0 +1,274 @@
+// pkg/api/request_timeout.go
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+// クライアントが処理時間の上限 (秒) を指定するヘッダ
+const requestTimeoutHeader = "Request-Timeout"
+
+// タイムアウトしたリクエストで, 上限を決めたもの (requestTimeoutSource*) を保持する gin.Context のキー. HTTPMetrics が参照する
+const requestTimeoutKey = "request_timeout"
+
+const (
+	requestTimeoutSourceOperation = "operation" // 既定値または操作毎の上限
+	requestTimeoutSourceClient    = "client"    // Request-Timeout ヘッダ
+)
+
+// OpenAPI のパスのパラメータ ({user_id} 等)
+var openAPIPathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// RequestTimeoutEnforcer は操作 (operationId) ごとの処理時間の上限をリクエストの context の deadline にする
+// context は pgx や Valkey の呼び出しにも渡るため, 上限を超えると実行中のクエリも打ち切られる
+type RequestTimeoutEnforcer struct {
+	cfg          config.Server
+	operations   map[string]string        // "GET /users/:user_id" -> "getuserbyid" (normalizeOperationID)
+	timeouts     map[string]time.Duration // operationId -> 上限
+	uriReference string
+	logger       *slog.Logger
+}
+
+// NewRequestTimeoutEnforcer は spec の operationId とルートの対応から RequestTimeoutEnforcer を生成する
+// cfg.RequestTimeout.Overrides に spec に無い operationId がある場合はエラー
+func NewRequestTimeoutEnforcer(cfg config.Server, spec *openapi3.T, uriReferenceBase string, logger *slog.Logger) (*RequestTimeoutEnforcer, error) {
+
+	// uriReferenceBase
+	uriRef, err := url.Parse(uriReferenceBase)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to initialize request timeout enforcer"),
+			cerrors.WithMessagef("url: %s", uriReferenceBase),
+		)
+	}
+	uriRef.Path = path.Join("/", "/timeout-error")
+
+	// ルート (gin のパスのテンプレート) と operationId の対応
+	operations := map[string]string{}
+	if spec != nil && spec.Paths != nil {
+		for specPath, pathItem := range spec.Paths.Map() {
+			route := openAPIPathParamPattern.ReplaceAllString(specPath, ":$1")
+			for method, operation := range pathItem.Operations() {
+				if operation.OperationID != "" {
+					operations[method+" "+route] = normalizeOperationID(operation.OperationID)
+				}
+			}
+		}
+	}
+
+	timeouts := make(map[string]time.Duration, len(cfg.RequestTimeout.Overrides))
+	for _, override := range cfg.RequestTimeout.Overrides {
+		operationID := normalizeOperationID(override.OperationID)
+		if !slices.Contains(slices.Collect(maps.Values(operations)), operationID) {
+			return nil, cerrors.ErrValidation.New(
+				cerrors.WithMessagef("unknown operation_id in request timeout overrides: %q", override.OperationID),
+			)
+		}
+		timeouts[operationID] = time.Duration(override.Seconds) * time.Second
+	}
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &RequestTimeoutEnforcer{
+		cfg:          cfg,
+		operations:   operations,
+		timeouts:     timeouts,
+		uriReference: uriRef.String(),
+		logger:       logger,
+	}, nil
+}
+
+// Middleware はリクエストの context に上限を設定し, 上限を超えてハンドラがエラー (5xx) になった場合は 504 の ProblemDetails に差し替える
+// 上限を超えても 5xx 以外を返したレスポンスはそのまま返す
+// セッションの保存を上限で打ち切らないよう SessionLoadAndSave より後ろ, DB を使うミドルウェア (APIKeyAuthenticator, TenantResolver 等) より前に置くこと
+func (p *RequestTimeoutEnforcer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		timeout, source := p.timeout(c)
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		if source == requestTimeoutSourceClient {
+			// クライアントが決めた deadline で打ち切られた呼び出しは, サーキットブレーカーの失敗に数えない
+			ctx = resilience.WithClientDeadline(ctx)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		p.extendConnDeadlines(c, start, timeout)
+
+		w := &timeoutResponseWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		// ステータスだけ設定した (204 等) レスポンスも処理を終えたものとして扱う
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) || (!w.timedOut && (w.statusSet || c.Writer.Written())) {
+			return
+		}
+
+		logging.FromContext(ctx).Warn("request timed out",
+			"timeout", timeout.String(),
+			"source", source,
+			"elapsed", time.Since(start).String(),
+		)
+		c.Set(requestTimeoutKey, source)
+		_ = c.Error(cerrors.ErrTimeout.New(
+			cerrors.WithCause(ctx.Err()),
+			cerrors.WithMessagef("request exceeded the timeout of %s", timeout),
+		))
+		c.AbortWithStatusJSON(http.StatusGatewayTimeout, openapi.ProblemDetails{
+			Type:   PtrOrNil(p.uriReference),
+			Title:  PtrOrNil(http.StatusText(http.StatusGatewayTimeout)),
+			Status: PtrOrNil(int32(http.StatusGatewayTimeout)),
+			Detail: PtrOrNil("The request could not be completed in time."),
+		})
+	}
+}
+
+// timeout はリクエストの上限と, それを決めたもの (requestTimeoutSource*) を返す. 0 の場合は制限しない
+// Request-Timeout ヘッダは上限を短くする場合のみ使う. 操作に上限が無い場合は max_client_seconds までを使う
+func (p *RequestTimeoutEnforcer) timeout(c *gin.Context) (time.Duration, string) {
+
+	timeout := time.Duration(p.cfg.RequestTimeout.DefaultSeconds) * time.Second
+	if override, ok := p.timeouts[p.operations[c.Request.Method+" "+routeTemplate(c)]]; ok {
+		timeout = override
+	}
+
+	if p.cfg.RequestTimeout.MaxClientSeconds == 0 {
+		return timeout, requestTimeoutSourceOperation
+	}
+	requested, ok := parseRequestTimeout(c.GetHeader(requestTimeoutHeader))
+	if !ok {
+		return timeout, requestTimeoutSourceOperation
+	}
+	if timeout <= 0 {
+		// 操作に上限が無い場合は max_client_seconds までを使う
+		return min(requested, time.Duration(p.cfg.RequestTimeout.MaxClientSeconds)*time.Second), requestTimeoutSourceClient
+	}
+	if requested >= timeout {
+		// 操作の上限より長い指定は使わない
+		return timeout, requestTimeoutSourceOperation
+	}
+	return requested, requestTimeoutSourceClient
+}
+
+// extendConnDeadlines は上限が http.Server の ReadTimeout / WriteTimeout より長い場合に, 接続の読み書きの期限を延ばす
+// 書き込みの期限は上限に WriteTimeout を足し, 上限を超えた後でも 504 を書き出せるようにする
+func (p *RequestTimeoutEnforcer) extendConnDeadlines(c *gin.Context, start time.Time, timeout time.Duration) {
+
+	rc := http.NewResponseController(c.Writer)
+	readTimeout := time.Duration(p.cfg.ReadTimeoutSeconds) * time.Second
+	if readTimeout > 0 && timeout > readTimeout {
+		if err := rc.SetReadDeadline(start.Add(timeout)); err != nil {
+			logging.FromContext(c.Request.Context()).Debug("failed to extend read deadline", "error", err)
+		}
+	}
+	writeTimeout := time.Duration(p.cfg.WriteTimeoutSeconds) * time.Second
+	if writeTimeout > 0 && timeout > writeTimeout {
+		if err := rc.SetWriteDeadline(start.Add(timeout + writeTimeout)); err != nil {
+			logging.FromContext(c.Request.Context()).Debug("failed to extend write deadline", "error", err)
+		}
+	}
+}
+
+// normalizeOperationID は operationId を比較用に小文字にして '_' を取り除く
+// 埋め込みの定義 (GetSwagger) では operationId が生成コードの名前 (import_users -> ImportUsers) になっているため
+func normalizeOperationID(operationID string) string {
+	return strings.ToLower(strings.ReplaceAll(operationID, "_", ""))
+}
+
+// parseRequestTimeout は Request-Timeout ヘッダ (正の秒数. 小数も可) を解釈する
+func parseRequestTimeout(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || seconds <= 0 || math.IsInf(seconds, 0) || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// timeoutResponseWriter は上限を超えた後にハンドラが書く 5xx のレスポンスを捨てる. 代わりに RequestTimeoutEnforcer が 504 を書く
+type timeoutResponseWriter struct {
+	gin.ResponseWriter
+	ctx       context.Context
+	timedOut  bool
+	statusSet bool
+}
+
+func (w *timeoutResponseWriter) WriteHeader(code int) {
+	if !w.timedOut && !w.ResponseWriter.Written() && code >= 500 && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+	}
+	if w.timedOut {
+		return
+	}
+	w.statusSet = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutResponseWriter) WriteHeaderNow() {
+	if w.timedOut {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutResponseWriter) Write(data []byte) (int, error) {
+	if w.timedOut {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutResponseWriter) WriteString(s string) (int, error) {
+	if w.timedOut {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutResponseWriter) Written() bool {
+	return !w.timedOut && w.ResponseWriter.Written()
+}
+
+func (w *timeoutResponseWriter) Status() int {
+	if w.timedOut {
+		return http.StatusGatewayTimeout
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,240 @@
+// pkg/api/request_timeout_test.go
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+func newRequestTimeoutEnforcer(t *testing.T, cfg config.RequestTimeout) *RequestTimeoutEnforcer {
+	t.Helper()
+
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCfg := config.NewConfig().Server
+	serverCfg.RequestTimeout = cfg
+	enforcer, err := NewRequestTimeoutEnforcer(serverCfg, spec, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enforcer
+}
+
+func TestRequestTimeoutEnforcer_Timeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enforcer := newRequestTimeoutEnforcer(t, config.RequestTimeout{
+		Enabled:        true,
+		DefaultSeconds: 8,
+		Overrides: []config.RequestTimeoutOverride{
+			{OperationID: "export_users", Seconds: 1800},
+			{OperationID: "list_users", Seconds: 0},
+		},
+		MaxClientSeconds: 30,
+	})
+
+	tests := []struct {
+		name       string
+		route      string
+		header     string
+		want       time.Duration
+		wantSource string
+	}{
+		{name: "default", route: "/users/:user_id", want: 8 * time.Second, wantSource: requestTimeoutSourceOperation},
+		{name: "override", route: "/users:export", want: 1800 * time.Second, wantSource: requestTimeoutSourceOperation},
+		{name: "unlimited", route: "/users", want: 0, wantSource: requestTimeoutSourceOperation},
+		{name: "client shorter", route: "/users/:user_id", header: "0.5", want: 500 * time.Millisecond, wantSource: requestTimeoutSourceClient},
+		// 操作の上限より長い指定は使わない (max_client_seconds より短くても)
+		{name: "client longer", route: "/users/:user_id", header: "20", want: 8 * time.Second, wantSource: requestTimeoutSourceOperation},
+		{name: "client capped", route: "/users/:user_id", header: "3600", want: 8 * time.Second, wantSource: requestTimeoutSourceOperation},
+		{name: "client shorter on long operation", route: "/users:export", header: "600", want: 600 * time.Second, wantSource: requestTimeoutSourceClient},
+		{name: "client capped by operation", route: "/users:export", header: "3600", want: 1800 * time.Second, wantSource: requestTimeoutSourceOperation},
+		// 操作に上限が無い場合は max_client_seconds まで
+		{name: "client on unlimited", route: "/users", header: "20", want: 20 * time.Second, wantSource: requestTimeoutSourceClient},
+		{name: "client capped on unlimited", route: "/users", header: "3600", want: 30 * time.Second, wantSource: requestTimeoutSourceClient},
+		{name: "invalid header", route: "/users/:user_id", header: "soon", want: 8 * time.Second, wantSource: requestTimeoutSourceOperation},
+		{name: "negative header", route: "/users/:user_id", header: "-1", want: 8 * time.Second, wantSource: requestTimeoutSourceOperation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got time.Duration
+			var source string
+			router := gin.New()
+			newCustomMethodRouter(router).GET(tt.route, func(c *gin.Context) {
+				got, source = enforcer.timeout(c)
+			})
+			target := strings.ReplaceAll(tt.route, ":user_id", "1")
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			if tt.header != "" {
+				req.Header.Set(requestTimeoutHeader, tt.header)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want || source != tt.wantSource {
+				t.Errorf("timeout() = %v, %q; want %v, %q", got, source, tt.want, tt.wantSource)
+			}
+		})
+	}
+
+	// max_client_seconds が 0 の場合はヘッダを使わない
+	enforcer = newRequestTimeoutEnforcer(t, config.RequestTimeout{Enabled: true, DefaultSeconds: 8})
+	router := gin.New()
+	var got time.Duration
+	router.GET("/users/:user_id", func(c *gin.Context) {
+		got, _ = enforcer.timeout(c)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(requestTimeoutHeader, "1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if got != 8*time.Second {
+		t.Errorf("timeout() with max_client_seconds 0 = %v; want 8s", got)
+	}
+}
+
+func TestRequestTimeoutEnforcer_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enforcer := newRequestTimeoutEnforcer(t, config.RequestTimeout{Enabled: true, DefaultSeconds: 8, MaxClientSeconds: 30})
+	m, err := NewHTTPMetrics("goapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.Use(enforcer.Middleware())
+	// 遅いクエリの代わり. deadline で打ち切られて 500 を返す
+	router.GET("/users/:user_id", func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			_ = c.Error(cerrors.ErrDBOperation.New(cerrors.WithCause(c.Request.Context().Err())))
+			c.JSON(http.StatusInternalServerError, openapi.ProblemDetails{Detail: PtrOrNil("query failed")})
+		case <-time.After(100 * time.Millisecond):
+			c.String(http.StatusOK, "ok")
+		}
+	})
+	// 上限を超えても処理を終えたレスポンスはそのまま返す
+	router.DELETE("/users/:user_id", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.Status(http.StatusNoContent)
+	})
+
+	do := func(method string, timeout string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/users/1", nil)
+		req.Header.Set(requestTimeoutHeader, timeout)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "5"); w.Code != http.StatusOK {
+		t.Errorf("GET within timeout status = %d; want 200", w.Code)
+	}
+
+	w := do(http.MethodGet, "0.01")
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("GET over timeout status = %d; want 504 (%s)", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "https://example.com/timeout-error") || strings.Contains(body, "query failed") {
+		t.Errorf("body = %s; want only the timeout-error problem", body)
+	}
+
+	if w := do(http.MethodDelete, "0.01"); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE over timeout status = %d; want 204", w.Code)
+	}
+
+	want := `
+# HELP goapp_http_server_request_timeouts_total 処理時間の上限を超えて 504 にしたリクエストの数 (source は上限を決めたもの: operation または client)
+# TYPE goapp_http_server_request_timeouts_total counter
+goapp_http_server_request_timeouts_total{http_request_method="GET",http_route="/users/:user_id",source="client",tenant_id=""} 1
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want), "goapp_http_server_request_timeouts_total"); err != nil {
+		t.Error(err)
+	}
+	wantErrors := `
+# HELP goapp_http_server_errors_total エラーレスポンス (4xx/5xx) の数
+# TYPE goapp_http_server_errors_total counter
+goapp_http_server_errors_total{error_code="TIMEOUT",http_request_method="GET",http_route="/users/:user_id",tenant_id=""} 1
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(wantErrors), "goapp_http_server_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestTimeoutEnforcer_Breaker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	enforcer := newRequestTimeoutEnforcer(t, config.RequestTimeout{Enabled: true, DefaultSeconds: 1, MaxClientSeconds: 30})
+	guard, err := resilience.NewGuard("postgres", resilience.Config{Breaker: &resilience.BreakerConfig{
+		Window:              time.Minute,
+		MinRequests:         1,
+		FailureRate:         0.5,
+		OpenDuration:        time.Minute,
+		HalfOpenMaxRequests: 1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(enforcer.Middleware())
+	// 応答しない Postgres の代わり
+	router.GET("/users/:user_id", func(c *gin.Context) {
+		err := guard.Do(c.Request.Context(), func(ctx context.Context) error {
+			<-ctx.Done()
+			return cerrors.ErrDBOperation.New(cerrors.WithCause(ctx.Err()))
+		})
+		_ = c.Error(err)
+		c.JSON(http.StatusInternalServerError, openapi.ProblemDetails{Detail: PtrOrNil("query failed")})
+	})
+
+	do := func(timeout string) int {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		if timeout != "" {
+			req.Header.Set(requestTimeoutHeader, timeout)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// クライアントが決めた deadline で打ち切られた呼び出しは失敗に数えない
+	for range 5 {
+		if code := do("0.01"); code != http.StatusGatewayTimeout {
+			t.Fatalf("GET with Request-Timeout status = %d; want 504", code)
+		}
+	}
+	if got := guard.Breaker().State(); got != resilience.StateClosed {
+		t.Errorf("state after client deadlines = %s; want closed", got)
+	}
+
+	// サーバー側の上限で打ち切られた呼び出しは失敗に数え, サーキットブレーカーを open にする
+	if code := do(""); code != http.StatusGatewayTimeout {
+		t.Fatalf("GET without Request-Timeout status = %d; want 504", code)
+	}
+	if got := guard.Breaker().State(); got != resilience.StateOpen {
+		t.Errorf("state after server deadline = %s; want open", got)
+	}
+}
+
+func TestNewRequestTimeoutEnforcer_UnknownOperation(t *testing.T) {
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.NewConfig().Server
+	cfg.RequestTimeout.Overrides = []config.RequestTimeoutOverride{{OperationID: "no_such_operation", Seconds: 1}}
+	if _, err := NewRequestTimeoutEnforcer(cfg, spec, "https://example.com/", nil); err == nil {
+		t.Error("NewRequestTimeoutEnforcer() with unknown operation_id succeeded; want error")
+	}
+}
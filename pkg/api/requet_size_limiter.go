@@ -10,6 +10,7 @@ import (
 
 	"github.com/aazw/go-base/pkg/api/openapi"
 	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
 )
 
 type RequestSizeLimiter struct {
@@ -42,10 +43,37 @@ func NewRequestSizeLimiter(uriReferenceBase string, logger *slog.Logger) (*Reque
 	}, nil
 }
 
-func (p *RequestSizeLimiter) Middleware(maxBytes int64) gin.HandlerFunc {
+// RequestSizeOverride はルート毎の本文の上限. MaxBytes が 0 以下の場合は制限しない
+type RequestSizeOverride struct {
+	// ルートのテンプレート (/users:import 等)
+	Route    string
+	MaxBytes int64
+}
+
+// Middleware は本文を maxBytes までに制限する. overrides にあるルートはその上限で制限する
+func (p *RequestSizeLimiter) Middleware(maxBytes int64, overrides ...RequestSizeOverride) gin.HandlerFunc {
+
+	routeMaxBytes := make(map[string]int64, len(overrides))
+	for _, override := range overrides {
+		routeMaxBytes[override.Route] = override.MaxBytes
+	}
+
 	return func(c *gin.Context) {
+		maxBytes := maxBytes
+		if override, ok := routeMaxBytes[routeTemplate(c)]; ok {
+			if override <= 0 {
+				c.Next()
+				return
+			}
+			maxBytes = override
+		}
+
 		// Content-Length で事前チェック
 		if c.Request.ContentLength > maxBytes {
+			logging.FromContext(c.Request.Context()).Warn("request body too large",
+				"content_length", c.Request.ContentLength,
+				"max_bytes", maxBytes,
+			)
 			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, openapi.ProblemDetails{
 				Type:   PtrOrNil(p.uriReference),
 				Title:  PtrOrNil(http.StatusText(http.StatusRequestEntityTooLarge)),
@@ -62,7 +90,10 @@ func (p *RequestSizeLimiter) Middleware(maxBytes int64) gin.HandlerFunc {
 		c.Next()
 
 		// Gin が 413 にしてくれた場合にもカスタムJSON
-		if c.Writer.Status() == http.StatusRequestEntityTooLarge {
+		if c.Writer.Status() == http.StatusRequestEntityTooLarge && !c.Writer.Written() {
+			logging.FromContext(c.Request.Context()).Warn("request body too large",
+				"max_bytes", maxBytes,
+			)
 			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, openapi.ProblemDetails{
 				Type:   PtrOrNil(p.uriReference),
 				Title:  PtrOrNil(http.StatusText(http.StatusRequestEntityTooLarge)),
@@ -0,0 +1,409 @@
+// pkg/api/router.go
+package api
+
+import (
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+type routerOptions struct {
+	serviceName    string
+	logger         *slog.Logger
+	tracer         oteltrace.Tracer
+	httpMetrics    *HTTPMetrics
+	healthCheckers []HealthChecker
+	sessionIndex   SessionIndex
+}
+
+type RouterOption func(*routerOptions)
+
+// WithServiceName はトレースに使うサービス名を指定する
+func WithServiceName(name string) RouterOption {
+	return func(o *routerOptions) {
+		o.serviceName = name
+	}
+}
+
+// WithLogger はアクセスログ等の出力先を指定する
+func WithLogger(logger *slog.Logger) RouterOption {
+	return func(o *routerOptions) {
+		o.logger = logger
+	}
+}
+
+// WithTracer は ProblemDetailsRenderer が使う tracer を指定する
+func WithTracer(tracer oteltrace.Tracer) RouterOption {
+	return func(o *routerOptions) {
+		o.tracer = tracer
+	}
+}
+
+// WithHTTPMetrics は HTTP のメトリクスを記録する. 指定しない場合は記録しない
+func WithHTTPMetrics(httpMetrics *HTTPMetrics) RouterOption {
+	return func(o *routerOptions) {
+		o.httpMetrics = httpMetrics
+	}
+}
+
+// WithHealthCheckers は readiness チェックで確認する依存先を指定する
+func WithHealthCheckers(healthCheckers ...HealthChecker) RouterOption {
+	return func(o *routerOptions) {
+		o.healthCheckers = append(o.healthCheckers, healthCheckers...)
+	}
+}
+
+// WithSessionIndex はユーザごとのセッションの索引を指定する. 指定しない場合はプロセス内のメモリに持つ
+func WithSessionIndex(sessionIndex SessionIndex) RouterOption {
+	return func(o *routerOptions) {
+		o.sessionIndex = sessionIndex
+	}
+}
+
+// NewRouter は cfg に応じたミドルウェアを組み込み, opsHandler を使う API のハンドラを登録したルーターを生成する
+func NewRouter(cfg config.Config, opsHandler *operations.Handler, sessionManager *scs.SessionManager, options ...RouterOption) (*gin.Engine, error) {
+
+	opts := &routerOptions{
+		serviceName: "goapp",
+		logger:      slog.Default(),
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.tracer == nil {
+		opts.tracer = otel.Tracer(opts.serviceName)
+	}
+	if opts.sessionIndex == nil {
+		opts.sessionIndex = NewMemorySessionIndex()
+	}
+
+	// https://github.com/gin-gonic/gin/blob/v1.10.0/gin.go#L224C2-L224C34
+	// gin.Default()内では、engine.Use(Logger(), Recovery()) を読んでいる. gin.Logger()が先.
+	// router := gin.Default()
+	router := gin.New()
+
+	// gin.Context を context.Context として渡した際に c.Request.Context() の値 (logger, span, session 等) も参照できるようにする
+	router.ContextWithFallback = true
+
+	// Default recovery
+	router.Use(gin.Recovery())
+
+	// Tracing middleware
+	if cfg.OTLPTrace.Enabled || cfg.OTLPMetric.Enabled || cfg.OTLPLog.Enabled {
+		// HTTP のメトリクスは HTTPMetrics で記録するため, otelgin ではトレースのみ
+		router.Use(otelgin.Middleware(opts.serviceName, otelgin.WithMeterProvider(metricnoop.NewMeterProvider())))
+	}
+
+	// Request ID & request-scoped logger & Access Log
+	// trace_id/span_id を拾うため otelgin より後ろ、それ以外のミドルウェアより前に置く
+	requestLogger, err := NewRequestLogger(opts.logger)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to init request logger"),
+		)
+	}
+	router.Use(requestLogger.Middleware())
+
+	// Metrics middleware
+	// rate limiter 等で打ち切られたリクエストも記録するため, それらより前に置く
+	if opts.httpMetrics != nil {
+		router.Use(opts.httpMetrics.Middleware())
+	}
+
+	// Profiling labels (Pyroscope)
+	// otelgin より後ろに置き, span_id のラベルと併せてプロファイルに載せる
+	if cfg.Pyroscope.Enabled {
+		router.Use(ProfileLabeler())
+	}
+
+	// OpenAPI spec & docs
+	// セッションと rate limiter の対象外にするため, それらより前に登録する
+	if cfg.OpenAPI.SpecEnabled {
+		if err := registerOpenAPIDocs(router, cfg, opts.logger); err != nil {
+			return nil, err
+		}
+	}
+
+	// rate limiter
+	if cfg.Server.RateLimit.Enabled {
+		router.Use(RateLimiter(1, 5))
+	}
+
+	// max request tize
+	if cfg.Server.MaxRequestSize > 0 {
+		sizeLimiter, err := NewRequestSizeLimiter("https://example.com/", opts.logger)
+		if err != nil {
+			return nil, cerrors.ErrSystemInternal.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to init request size limiter"),
+			)
+		}
+		overrides := make([]RequestSizeOverride, 0, len(cfg.Server.MaxRequestSizeOverrides))
+		for _, override := range cfg.Server.MaxRequestSizeOverrides {
+			overrides = append(overrides, RequestSizeOverride{Route: override.Route, MaxBytes: override.MaxRequestSize})
+		}
+		router.Use(sizeLimiter.Middleware(cfg.Server.MaxRequestSize, overrides...))
+	}
+
+	// Metrics Endpoint: (Prometheus)
+	// exemplar (trace_id) を出力するため OpenMetrics 形式を有効にする
+	if cfg.Prometheus.Enabled {
+		router.GET(cfg.Prometheus.MetricsPath, gin.WrapH(promhttp.HandlerFor(
+			prometheus.DefaultGatherer,
+			promhttp.HandlerOpts{EnableOpenMetrics: true},
+		)))
+	}
+
+	// add Custom Headers
+	if len(cfg.Server.CustomHeaders) > 0 {
+		router.Use(func(c *gin.Context) {
+			for _, customHeader := range cfg.Server.CustomHeaders {
+				if customHeader.Enabled && customHeader.Name != "" && customHeader.Value != "" {
+					responseHeader := c.Writer.Header()
+					if _, ok := responseHeader[customHeader.Name]; ok {
+						if customHeader.Override {
+							c.Header(customHeader.Name, customHeader.Value)
+						}
+					} else {
+						c.Header(customHeader.Name, customHeader.Value)
+					}
+				}
+			}
+			c.Next()
+		})
+	}
+
+	// Session Load
+	// designed by https://github.com/alexedwards/scs/blob/v2.8.0/session.go#L132
+	router.Use(SessionLoadAndSave(sessionManager))
+
+	// Request timeout
+	// セッションの保存を打ち切らないよう SessionLoadAndSave より後ろ, DB や Valkey を使うミドルウェアとハンドラより前に置く
+	if cfg.Server.RequestTimeout.Enabled {
+		spec, err := openapi.GetSwagger()
+		if err != nil {
+			return nil, cerrors.ErrSystemInternal.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to load openapi spec"),
+			)
+		}
+		timeoutEnforcer, err := NewRequestTimeoutEnforcer(cfg.Server, spec, "https://example.com/", opts.logger)
+		if err != nil {
+			return nil, cerrors.AppendCheckpoint(
+				err,
+				cerrors.WithCheckpointMessage("failed to initialize request timeout enforcer"),
+			)
+		}
+		router.Use(timeoutEnforcer.Middleware())
+	}
+
+	// Service unavailable
+	// 依存先のサーキットブレーカーやバルクヘッドが断った 5xx を Retry-After 付きの 503 にする. OpenAPIValidator より外側に置く
+	serviceUnavailableResponder, err := NewServiceUnavailableResponder("https://example.com/", opts.logger)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize service unavailable responder"),
+		)
+	}
+	router.Use(serviceUnavailableResponder.Middleware())
+
+	// Read-your-writes (PostgreSQL replicas)
+	// 書き込み後の同じセッションの読み取りをプライマリに向ける
+	router.Use(ReadYourWrites(sessionManager, time.Duration(cfg.Postgres.ReadYourWritesWindowSeconds)*time.Second))
+
+	// CORS
+	if cfg.Server.CORS.Enabled {
+		// https://github.com/gin-contrib/cors
+		router.Use(cors.New(cors.Config{
+			AllowOrigins:     cfg.Server.CORS.AllowOrigins,
+			AllowMethods:     cfg.Server.CORS.AllowMethods,
+			AllowHeaders:     cfg.Server.CORS.AllowHeaders,
+			ExposeHeaders:    cfg.Server.CORS.ExposeHeaders,
+			AllowCredentials: cfg.Server.CORS.AllowCredentials,
+			MaxAge:           time.Hour * time.Duration(cfg.Server.CORS.MaxAgeHour),
+		}))
+	}
+
+	// Sessions
+	// 認証した主体をセッションに記録し, Cookie だけのリクエストには記録した主体を設定する
+	// OIDC の認証ミドルウェアより後ろ, セッションの主体を使う APIKeyAuthenticator (/api-keys, /webhooks の管理者の確認) と TenantResolver より前に置く
+	sessionTracker, err := NewSessionTracker(cfg.Session, cfg.Tenancy.SuperAdminRole, sessionManager, opts.sessionIndex, "https://example.com/", opts.logger)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize session tracker"),
+		)
+	}
+	router.Use(sessionTracker.Middleware())
+
+	// API keys
+	// CORS の preflight を認証の対象にしないため CORS より後ろ, キーのテナントをクレームとして渡すため TenantResolver より前に置く
+	apiKeyAuthenticator, err := NewAPIKeyAuthenticator(cfg.APIKeys, cfg.Tenancy.SuperAdminRole, opsHandler, "https://example.com/", opts.logger)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize api key authenticator"),
+		)
+	}
+	router.Use(apiKeyAuthenticator.Middleware())
+
+	// CSRF
+	// セッションに記録した主体と認証した API キーを使うため SessionTracker と APIKeyAuthenticator より後ろに置く. トークンは GET /auth/csrf で渡すため無効でも生成する
+	csrfProtector, err := NewCSRFProtector(cfg.Server.CSRF, cfg.Server.CORS, sessionManager, "https://example.com/", opts.logger)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize csrf protector"),
+		)
+	}
+	if cfg.Server.CSRF.Enabled {
+		router.Use(csrfProtector.Middleware())
+	}
+
+	// Audit
+	// API キーで認証したリクエストを区別するため APIKeyAuthenticator より後ろに置く
+	auditAuthorizer, err := NewAuditAuthorizer(cfg.Audit, cfg.Tenancy.SuperAdminRole, "https://example.com/", opts.logger)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize audit authorizer"),
+		)
+	}
+	router.Use(auditAuthorizer.Middleware())
+
+	// Tenant
+	// 認証ミドルウェア (SetTenantClaim, SetUserRoles) より後ろ, API のハンドラより前に置く
+	tenantResolver, err := NewTenantResolver(cfg.Tenancy, opsHandler, "https://example.com/", opts.logger)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize tenant resolver"),
+		)
+	}
+	router.Use(tenantResolver.Middleware())
+
+	// Add openapi handler
+	problemDetailsRenderer, err := NewProblemDetailsRenderer("https://example.com/", opts.logger, opts.tracer)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize problem details renderer"),
+		)
+	}
+
+	// OpenAPI validation
+	// レスポンスの照合は ProblemDetailsRenderer が書く本文も対象にするため外側, リクエストの照合は結果を ProblemDetailsRenderer に渡すため内側に置く
+	openAPIValidator, err := newOpenAPIValidator(cfg.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
+	router.Use(openAPIValidator.ResponseMiddleware())
+	router.Use(problemDetailsRenderer.Middleware())
+	router.Use(openAPIValidator.RequestMiddleware())
+
+	serverImpl := NewStrictServerImpl(opsHandler, sessionTracker, csrfProtector, opts.healthCheckers...)
+	handler := openapi.NewStrictHandler(serverImpl, []openapi.StrictMiddlewareFunc{StrictErrorRecorder()})
+	routes := newCustomMethodRouter(router)
+	openapi.RegisterHandlers(routes, handler)
+
+	// strict server に含めていない操作 (pkg/api/openapi/oapi-codegen.yaml)
+	userImportHandler, err := NewUserImportHandler(opsHandler)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize user import handler"),
+		)
+	}
+	routes.POST("/users:import", userImportHandler.Handler())
+
+	return router, nil
+}
+
+func newOpenAPIValidator(cfg config.OpenAPI) (*OpenAPIValidator, error) {
+
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to load openapi spec"),
+		)
+	}
+
+	responseValidation := ResponseValidationMode(cfg.ResponseValidation)
+	if responseValidation == "" {
+		responseValidation = ResponseValidationOff
+	}
+	openAPIValidator, err := NewOpenAPIValidator(spec,
+		WithRequestValidation(cfg.RequestValidation),
+		WithResponseValidation(responseValidation),
+	)
+	if err != nil {
+		return nil, cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize openapi validator"),
+		)
+	}
+	return openAPIValidator, nil
+}
+
+func registerOpenAPIDocs(router *gin.Engine, cfg config.Config, logger *slog.Logger) error {
+
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		return cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to load openapi spec"),
+		)
+	}
+
+	serverURLs := cfg.OpenAPI.ServerURLs
+	if len(serverURLs) == 0 {
+		host := cfg.Server.Host
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			host = "localhost"
+		}
+		serverURLs = []string{"http://" + net.JoinHostPort(host, strconv.FormatUint(uint64(cfg.Server.Port), 10))}
+	}
+
+	docs, err := NewOpenAPIDocs(spec, serverURLs)
+	if err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to initialize openapi docs"),
+		)
+	}
+
+	docsPath := ""
+	if cfg.OpenAPI.DocsEnabled {
+		if docs.HasUI() {
+			docsPath = cfg.OpenAPI.DocsPath
+		} else {
+			logger.Warn("docs assets are not embedded, API docs are disabled (run scripts/redoc_download.sh)")
+		}
+	}
+	if err := docs.Register(router, "/openapi.yaml", "/openapi.json", docsPath); err != nil {
+		return cerrors.AppendCheckpoint(
+			err,
+			cerrors.WithCheckpointMessage("failed to register openapi docs"),
+		)
+	}
+	return nil
+}
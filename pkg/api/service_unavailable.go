@@ -0,0 +1,151 @@
+// pkg/api/service_unavailable.go
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+// ServiceUnavailableResponder は依存先 (Postgres, Valkey) のサーキットブレーカーやバルクヘッドが呼び出しを断ったことで
+// ハンドラがエラー (5xx) になったレスポンスを, Retry-After 付きの 503 の ProblemDetails に差し替える
+type ServiceUnavailableResponder struct {
+	uriReference string
+	logger       *slog.Logger
+}
+
+func NewServiceUnavailableResponder(uriReferenceBase string, logger *slog.Logger) (*ServiceUnavailableResponder, error) {
+
+	// uriReferenceBase
+	uriRef, err := url.Parse(uriReferenceBase)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to initialize service unavailable responder"),
+			cerrors.WithMessagef("url: %s", uriReferenceBase),
+		)
+	}
+	uriRef.Path = path.Join("/", "/service-unavailable")
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &ServiceUnavailableResponder{
+		uriReference: uriRef.String(),
+		logger:       logger,
+	}, nil
+}
+
+// Middleware はハンドラが c.Error に記録したエラーの cause に resilience.RejectedError があれば, 5xx のレスポンスを捨てて 503 を書く
+// ハンドラのレスポンス (500) を OpenAPI の定義と照合させるため OpenAPIValidator より外側に置くこと
+func (p *ServiceUnavailableResponder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		w := &serviceUnavailableResponseWriter{ResponseWriter: c.Writer, c: c}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.rejected == nil {
+			return
+		}
+
+		logging.FromContext(c.Request.Context()).Warn("dependency unavailable",
+			"dependency", w.rejected.Dependency,
+			"reason", w.rejected.Reason,
+			"retry_after", w.rejected.RetryAfter.String(),
+		)
+		_ = c.Error(cerrors.ErrServiceUnavailable.New(
+			cerrors.WithCause(w.rejected),
+			cerrors.WithMessagef("%s is temporarily unavailable", w.rejected.Dependency),
+		))
+		setRetryAfter(c, w.rejected)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, openapi.ProblemDetails{
+			Type:   PtrOrNil(p.uriReference),
+			Title:  PtrOrNil(http.StatusText(http.StatusServiceUnavailable)),
+			Status: PtrOrNil(int32(http.StatusServiceUnavailable)),
+			Detail: PtrOrNil("The service is temporarily unavailable. Please retry later."),
+		})
+	}
+}
+
+// rejectedError は c に記録されたエラーのうち, 依存先の呼び出しを断ったものを返す
+func rejectedError(c *gin.Context) (*resilience.RejectedError, bool) {
+	for i := len(c.Errors) - 1; i >= 0; i-- {
+		if rejected, ok := resilience.Rejected(c.Errors[i].Err); ok {
+			return rejected, true
+		}
+	}
+	return nil, false
+}
+
+// setRetryAfter は依存先が回復を試すまでの時間を Retry-After (秒. 最小 1) に設定する
+func setRetryAfter(c *gin.Context, rejected *resilience.RejectedError) {
+	c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(rejected.RetryAfter.Seconds())))))
+}
+
+// serviceUnavailableResponseWriter は依存先の呼び出しを断ったことでハンドラが書く 5xx のレスポンスを捨てる
+// 自身で 503 を書くもの (APIKeyAuthenticator, TenantResolver) はそのまま書かせる
+type serviceUnavailableResponseWriter struct {
+	gin.ResponseWriter
+	c        *gin.Context
+	rejected *resilience.RejectedError
+}
+
+func (w *serviceUnavailableResponseWriter) WriteHeader(code int) {
+	if w.rejected == nil && !w.ResponseWriter.Written() && code >= 500 && code != http.StatusServiceUnavailable {
+		w.rejected, _ = rejectedError(w.c)
+	}
+	if w.rejected != nil {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serviceUnavailableResponseWriter) WriteHeaderNow() {
+	if w.rejected != nil {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *serviceUnavailableResponseWriter) Write(data []byte) (int, error) {
+	if w.rejected != nil {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *serviceUnavailableResponseWriter) WriteString(s string) (int, error) {
+	if w.rejected != nil {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *serviceUnavailableResponseWriter) Written() bool {
+	return w.rejected == nil && w.ResponseWriter.Written()
+}
+
+func (w *serviceUnavailableResponseWriter) Status() int {
+	if w.rejected != nil {
+		return http.StatusServiceUnavailable
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *serviceUnavailableResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,86 @@
+// pkg/api/service_unavailable_test.go
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+func TestServiceUnavailableResponder_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	responder, err := NewServiceUnavailableResponder("https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewHTTPMetrics("goapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard, err := resilience.NewGuard("postgres", resilience.Config{Breaker: &resilience.BreakerConfig{
+		Window:              time.Minute,
+		MinRequests:         1,
+		FailureRate:         1,
+		OpenDuration:        10*time.Second + 500*time.Millisecond,
+		HalfOpenMaxRequests: 1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.Use(responder.Middleware())
+	// ハンドラと同じく DB のエラーを 500 にする
+	router.GET("/users/:user_id", func(c *gin.Context) {
+		err := guard.Do(c.Request.Context(), func(ctx context.Context) error {
+			return cerrors.ErrDBConnection.New(cerrors.WithCause(errors.New("connection refused")))
+		})
+		_ = c.Error(cerrors.ErrSystemInternal.New(cerrors.WithCause(err)))
+		c.JSON(http.StatusInternalServerError, openapi.ProblemDetails{Detail: PtrOrNil("failed to get user")})
+	})
+
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+		return w
+	}
+
+	// 依存先を呼んで失敗したエラーはそのまま返す
+	if w := do(); w.Code != http.StatusInternalServerError || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("first call status = %d, Retry-After = %q; want 500 without Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// open の間は 503 にして, half-open になるまでの秒数 (切り上げ) を Retry-After にする
+	w := do()
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status while open = %d; want 503 (%s)", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "11" {
+		t.Errorf("Retry-After = %q; want 11", got)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "https://example.com/service-unavailable") || strings.Contains(body, "failed to get user") {
+		t.Errorf("body = %s; want only the service-unavailable problem", body)
+	}
+
+	want := `
+# HELP goapp_http_server_errors_total エラーレスポンス (4xx/5xx) の数
+# TYPE goapp_http_server_errors_total counter
+goapp_http_server_errors_total{error_code="SERVICE_UNAVAILABLE",http_request_method="GET",http_route="/users/:user_id",tenant_id=""} 1
+goapp_http_server_errors_total{error_code="SYSTEM_INTERNAL",http_request_method="GET",http_route="/users/:user_id",tenant_id=""} 1
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want), "goapp_http_server_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
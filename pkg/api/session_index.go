@@ -0,0 +1,165 @@
+// pkg/api/session_index.go
+package api
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// SessionIndex はユーザ (主体) ごとのセッションの索引. セッションの ID からトークンを引く
+// セッションの失効は索引に反映しないため, 使う側 (SessionTracker) が失効したセッションを取り除く
+type SessionIndex interface {
+	// Add は subject のセッションを追加する. ttl は subject の索引全体を残す時間 (セッションの有効期間)
+	Add(ctx context.Context, subject string, sessionID string, token string, ttl time.Duration) error
+
+	// Remove は subject のセッションを取り除く. sessionIDs が空の場合は subject の全てのセッションを取り除く
+	Remove(ctx context.Context, subject string, sessionIDs ...string) error
+
+	// Tokens は subject のセッションの ID とトークンを返す
+	Tokens(ctx context.Context, subject string) (map[string]string, error)
+}
+
+// ValkeySessionIndex は Valkey のハッシュ (<keyPrefix>:<subject>) による SessionIndex の実装
+type ValkeySessionIndex struct {
+	pool      *redis.Pool
+	keyPrefix string
+}
+
+func NewValkeySessionIndex(pool *redis.Pool, keyPrefix string) (*ValkeySessionIndex, error) {
+	if pool == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("valkey pool is required"),
+		)
+	}
+	return &ValkeySessionIndex{
+		pool:      pool,
+		keyPrefix: keyPrefix,
+	}, nil
+}
+
+func (p *ValkeySessionIndex) Add(ctx context.Context, subject string, sessionID string, token string, ttl time.Duration) error {
+
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return newSessionIndexError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	// 後から追加したセッションほど期限が遅いため, 索引の期限は最後に追加したセッションに合わせる
+	key := p.key(subject)
+	if err := conn.Send("MULTI"); err != nil {
+		return newSessionIndexError(err, "failed to add session to index")
+	}
+	if err := conn.Send("HSET", key, sessionID, token); err != nil {
+		return newSessionIndexError(err, "failed to add session to index")
+	}
+	if err := conn.Send("PEXPIRE", key, ttl.Milliseconds()); err != nil {
+		return newSessionIndexError(err, "failed to add session to index")
+	}
+	if _, err := redis.DoContext(conn, ctx, "EXEC"); err != nil {
+		return newSessionIndexError(err, "failed to add session to index")
+	}
+	return nil
+}
+
+func (p *ValkeySessionIndex) Remove(ctx context.Context, subject string, sessionIDs ...string) error {
+
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return newSessionIndexError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	if len(sessionIDs) == 0 {
+		_, err = redis.DoContext(conn, ctx, "DEL", p.key(subject))
+	} else {
+		_, err = redis.DoContext(conn, ctx, "HDEL", redis.Args{}.Add(p.key(subject)).AddFlat(sessionIDs)...)
+	}
+	if err != nil {
+		return newSessionIndexError(err, "failed to remove session from index")
+	}
+	return nil
+}
+
+func (p *ValkeySessionIndex) Tokens(ctx context.Context, subject string) (map[string]string, error) {
+
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return nil, newSessionIndexError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	tokens, err := redis.StringMap(redis.DoContext(conn, ctx, "HGETALL", p.key(subject)))
+	if err != nil {
+		return nil, newSessionIndexError(err, "failed to get sessions from index")
+	}
+	return tokens, nil
+}
+
+func (p *ValkeySessionIndex) key(subject string) string {
+	return p.keyPrefix + ":" + subject
+}
+
+// MemorySessionIndex はプロセス内のメモリによる SessionIndex の実装. 複数のインスタンスでは使えない
+// ttl は使わず, 失効したセッションは SessionTracker が取り除くまで残る
+type MemorySessionIndex struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]string
+}
+
+func NewMemorySessionIndex() *MemorySessionIndex {
+	return &MemorySessionIndex{
+		sessions: map[string]map[string]string{},
+	}
+}
+
+func (p *MemorySessionIndex) Add(ctx context.Context, subject string, sessionID string, token string, ttl time.Duration) error {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessions[subject] == nil {
+		p.sessions[subject] = map[string]string{}
+	}
+	p.sessions[subject][sessionID] = token
+	return nil
+}
+
+func (p *MemorySessionIndex) Remove(ctx context.Context, subject string, sessionIDs ...string) error {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(sessionIDs) == 0 {
+		delete(p.sessions, subject)
+		return nil
+	}
+	for _, sessionID := range sessionIDs {
+		delete(p.sessions[subject], sessionID)
+	}
+	if len(p.sessions[subject]) == 0 {
+		delete(p.sessions, subject)
+	}
+	return nil
+}
+
+func (p *MemorySessionIndex) Tokens(ctx context.Context, subject string) (map[string]string, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return maps.Clone(p.sessions[subject]), nil
+}
+
+func newSessionIndexError(err error, msg string) error {
+	return cerrors.ErrDBOperation.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage(msg),
+	)
+}
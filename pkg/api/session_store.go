@@ -0,0 +1,147 @@
+// pkg/api/session_store.go
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// セッションのキーの接頭辞. scs の redisstore と同じにして, 保存済みのセッションを引き継ぐ
+const valkeySessionKeyPrefix = "scs:session:"
+
+// SCAN で 1 回に走査するキーの数の目安
+const valkeySessionScanCount = 1000
+
+// ValkeySessionStore は Valkey にセッションを保存する scs.CtxStore (scs.IterableCtxStore) の実装
+// scs の redisstore は context を受け取らないため, リクエストの deadline (RequestTimeoutEnforcer) を Valkey の呼び出しに渡せるよう置き換える
+type ValkeySessionStore struct {
+	pool *redis.Pool
+}
+
+func NewValkeySessionStore(pool *redis.Pool) (*ValkeySessionStore, error) {
+	if pool == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("valkey pool is required"),
+		)
+	}
+	return &ValkeySessionStore{
+		pool: pool,
+	}, nil
+}
+
+func (p *ValkeySessionStore) Find(token string) ([]byte, bool, error) {
+	return p.FindCtx(context.Background(), token)
+}
+
+func (p *ValkeySessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	return p.CommitCtx(context.Background(), token, b, expiry)
+}
+
+func (p *ValkeySessionStore) Delete(token string) error {
+	return p.DeleteCtx(context.Background(), token)
+}
+
+func (p *ValkeySessionStore) All() (map[string][]byte, error) {
+	return p.AllCtx(context.Background())
+}
+
+func (p *ValkeySessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	b, err := redis.Bytes(redis.DoContext(conn, ctx, "GET", valkeySessionKeyPrefix+token))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (p *ValkeySessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = redis.DoContext(conn, ctx, "SET", valkeySessionKeyPrefix+token, b, "PXAT", expiry.UnixMilli())
+	return err
+}
+
+func (p *ValkeySessionStore) DeleteCtx(ctx context.Context, token string) error {
+
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = redis.DoContext(conn, ctx, "DEL", valkeySessionKeyPrefix+token)
+	return err
+}
+
+// AllCtx は全てのセッションを返す. KEYS はサーバを止めるため SCAN で走査する
+func (p *ValkeySessionStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+
+	conn, err := p.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sessions := map[string][]byte{}
+	cursor := "0"
+	for {
+		reply, err := redis.Values(redis.DoContext(conn, ctx, "SCAN", cursor, "MATCH", valkeySessionKeyPrefix+"*", "COUNT", valkeySessionScanCount))
+		if err != nil {
+			return nil, err
+		}
+		var keys []string
+		if _, err := redis.Scan(reply, &cursor, &keys); err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			values, err := redis.ByteSlices(redis.DoContext(conn, ctx, "MGET", redis.Args{}.AddFlat(keys)...))
+			if err != nil {
+				return nil, err
+			}
+			for i, key := range keys {
+				// 走査の間に失効したセッションは nil
+				if values[i] != nil {
+					sessions[key[len(valkeySessionKeyPrefix):]] = values[i]
+				}
+			}
+		}
+		if cursor == "0" {
+			return sessions, nil
+		}
+	}
+}
+
+// findSessionData は store から token のセッションを読む. store が scs.CtxStore の場合は ctx を渡す
+func findSessionData(ctx context.Context, store scs.Store, token string) ([]byte, bool, error) {
+	if cs, ok := store.(scs.CtxStore); ok {
+		return cs.FindCtx(ctx, token)
+	}
+	return store.Find(token)
+}
+
+// deleteSessionData は store から token のセッションを削除する. store が scs.CtxStore の場合は ctx を渡す
+func deleteSessionData(ctx context.Context, store scs.Store, token string) error {
+	if cs, ok := store.(scs.CtxStore); ok {
+		return cs.DeleteCtx(ctx, token)
+	}
+	return store.Delete(token)
+}
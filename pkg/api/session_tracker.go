@@ -0,0 +1,420 @@
+// pkg/api/session_tracker.go
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/audit"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// セッションに保持する値のキー
+const (
+	sessionIDKey          = "session.id"
+	sessionSubjectKey     = "session.user_subject"
+	sessionRolesKey       = "session.user_roles"
+	sessionTenantClaimKey = "session.tenant_claim"
+	sessionDeviceKey      = "session.device"
+	sessionIPKey          = "session.ip"
+	sessionCreatedAtKey   = "session.created_at"
+	sessionLastSeenAtKey  = "session.last_seen_at"
+	sessionCSRFTokenKey   = "session.csrf_token"
+)
+
+// gin.Context に保持する, 主体をセッションから設定したか (Cookie だけで認証したか) のキー
+const sessionRestoredKey = "session_restored"
+
+// 記録する User-Agent の最大長
+const maxSessionDeviceLength = 512
+
+// NewSessionManager は cfg の有効期間と Cookie の属性で store にセッションを保存する SessionManager を生成する
+func NewSessionManager(cfg config.Session, store scs.Store) (*scs.SessionManager, error) {
+
+	sameSite := map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}[strings.ToLower(cfg.Cookie.SameSite)]
+	if sameSite == 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid session cookie same_site: %q", cfg.Cookie.SameSite),
+		)
+	}
+	if sameSite == http.SameSiteNoneMode && !cfg.Cookie.Secure {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("session cookie with same_site none must be secure"),
+		)
+	}
+
+	sm := scs.New()
+	sm.Store = store
+	sm.Lifetime = time.Duration(cfg.LifetimeSeconds) * time.Second
+	sm.IdleTimeout = time.Duration(cfg.IdleTimeoutSeconds) * time.Second
+	sm.Cookie.Name = cfg.Cookie.Name
+	sm.Cookie.Domain = cfg.Cookie.Domain
+	sm.Cookie.Secure = cfg.Cookie.Secure
+	sm.Cookie.SameSite = sameSite
+	return sm, nil
+}
+
+// SessionTracker はログインセッションに認証した主体と端末の情報を記録し, ユーザごとの索引 (SessionIndex) を管理する
+// 主体を記録したセッションは, 以降 Cookie だけのリクエストでもその主体として扱う (セッションの破棄でログアウトさせる)
+type SessionTracker struct {
+	cfg            config.Session
+	superAdminRole string
+	sm             *scs.SessionManager
+	index          SessionIndex
+	uriReference   *url.URL
+	logger         *slog.Logger
+}
+
+func NewSessionTracker(cfg config.Session, superAdminRole string, sm *scs.SessionManager, index SessionIndex, uriReferenceBase string, logger *slog.Logger) (*SessionTracker, error) {
+
+	// uriReferenceBase
+	uriRef, err := url.Parse(uriReferenceBase)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to initialize session tracker"),
+			cerrors.WithMessagef("url: %s", uriReferenceBase),
+		)
+	}
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SessionTracker{
+		cfg:            cfg,
+		superAdminRole: superAdminRole,
+		sm:             sm,
+		index:          index,
+		uriReference:   uriRef,
+		logger:         logger,
+	}, nil
+}
+
+// Middleware は認証した主体 (SetUserSubject) をセッションに記録し, 主体の無いリクエストにはセッションに記録した主体を設定する
+// 主体を新しく記録する場合は固定化攻撃を防ぐためセッションのトークンを作り直す
+// /me/sessions には主体, /sessions:revoke には session.admin_role または super-admin のロールを要求する
+// API キーのリクエストはセッションと結び付けない
+// SessionLoadAndSave と OIDC の認証ミドルウェア (SetUserSubject, SetUserRoles) より後ろ, APIKeyAuthenticator より前に置くこと
+func (p *SessionTracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		ctx := c.Request.Context()
+		if !hasSession(p.sm, ctx) {
+			c.Next()
+			return
+		}
+		if _, found := apiKeyFromRequest(c); found {
+			c.Next()
+			return
+		}
+
+		subject := UserSubject(c)
+		bound := p.sm.GetString(ctx, sessionSubjectKey)
+		switch {
+		case subject == "" && bound != "":
+			p.restore(c)
+		case subject != "" && subject != bound:
+			if err := p.bind(c, subject); err != nil {
+				// セッションに記録できなくても認証済みのリクエストは処理する
+				logging.FromContext(ctx).Warn("failed to bind session", "error", err)
+			}
+		case subject != "":
+			p.sm.Put(ctx, sessionRolesKey, UserRoles(c))
+			p.sm.Put(ctx, sessionTenantClaimKey, c.GetString(tenantClaimKey))
+		}
+		if UserSubject(c) != "" {
+			p.sm.Put(ctx, sessionIPKey, c.ClientIP())
+			p.sm.Put(ctx, sessionLastSeenAtKey, time.Now().UnixNano())
+		}
+
+		if !p.authorize(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// bind はセッションに subject を記録し, 索引に追加する
+func (p *SessionTracker) bind(c *gin.Context, subject string) error {
+
+	ctx := c.Request.Context()
+
+	if bound := p.sm.GetString(ctx, sessionSubjectKey); bound != "" {
+		if err := p.index.Remove(ctx, bound, p.sm.GetString(ctx, sessionIDKey)); err != nil {
+			return err
+		}
+	}
+	if err := p.sm.RenewToken(ctx); err != nil {
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to renew session token"),
+		)
+	}
+
+	uuidV7, err := uuid.NewV7()
+	if err != nil {
+		return cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("faild to negerate a new uuid v7"),
+		)
+	}
+	device := c.Request.UserAgent()
+	if len(device) > maxSessionDeviceLength {
+		device = device[:maxSessionDeviceLength]
+	}
+	p.sm.Put(ctx, sessionIDKey, uuidV7.String())
+	p.sm.Put(ctx, sessionSubjectKey, subject)
+	p.sm.Put(ctx, sessionRolesKey, UserRoles(c))
+	p.sm.Put(ctx, sessionTenantClaimKey, c.GetString(tenantClaimKey))
+	p.sm.Put(ctx, sessionDeviceKey, device)
+	p.sm.Put(ctx, sessionCreatedAtKey, time.Now().UnixNano())
+	// ログイン前に発行した CSRF トークンは使わせない
+	p.sm.Remove(ctx, sessionCSRFTokenKey)
+
+	return p.index.Add(ctx, subject, uuidV7.String(), p.sm.Token(ctx), p.sm.Lifetime)
+}
+
+// restore はセッションに記録した主体, ロール, テナントのクレームをリクエストに設定する
+func (p *SessionTracker) restore(c *gin.Context) {
+
+	ctx := c.Request.Context()
+	c.Set(sessionRestoredKey, true)
+	SetUserSubject(c, p.sm.GetString(ctx, sessionSubjectKey))
+	if roles, ok := p.sm.Get(ctx, sessionRolesKey).([]string); ok {
+		SetUserRoles(c, roles...)
+	}
+	SetTenantClaim(c, p.sm.GetString(ctx, sessionTenantClaimKey))
+}
+
+// authorize はセッションの管理のルートを呼べるかを確認し, 呼べない場合はリクエストを打ち切る
+func (p *SessionTracker) authorize(c *gin.Context) bool {
+
+	route := routeTemplate(c)
+	switch {
+	case route == "/me/sessions" || strings.HasPrefix(route, "/me/sessions/"):
+		if UserSubject(c) == "" {
+			p.abort(c, http.StatusUnauthorized, "/authentication-error", "Authentication is required to manage sessions.")
+			return false
+		}
+	case route == "/sessions:revoke":
+		roles := UserRoles(c)
+		if slices.Contains(roles, p.cfg.AdminRole) || (p.superAdminRole != "" && slices.Contains(roles, p.superAdminRole)) {
+			return true
+		}
+		if UserSubject(c) == "" {
+			p.abort(c, http.StatusUnauthorized, "/authentication-error", "Authentication is required to manage sessions.")
+			return false
+		}
+		p.abort(c, http.StatusForbidden, "/authorization-error", "You are not allowed to manage sessions of other users.")
+		return false
+	}
+	return true
+}
+
+// sessionRestored は主体をセッションから設定した (認証ミドルウェアが主体を検証していない) かを返す
+func sessionRestored(c *gin.Context) bool {
+	return c.GetBool(sessionRestoredKey)
+}
+
+func (p *SessionTracker) abort(c *gin.Context, status int, problemType string, detail string) {
+	uriRef := *p.uriReference
+	uriRef.Path = path.Join("/", problemType)
+	c.AbortWithStatusJSON(status, openapi.ProblemDetails{
+		Type:   PtrOrNil(uriRef.String()),
+		Title:  PtrOrNil(http.StatusText(status)),
+		Status: PtrOrNil(int32(status)),
+		Detail: PtrOrNil(detail),
+	})
+}
+
+// ListSessions は ctx の主体のセッションを作成日時の順に返す. 失効したセッションは索引から取り除く
+func (p *SessionTracker) ListSessions(ctx context.Context) ([]*models.Session, error) {
+
+	subject, err := sessionSubject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := p.index.Tokens(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	current := p.sm.GetString(ctx, sessionIDKey)
+	var sessions []*models.Session
+	var stale []string
+	for sessionID, token := range tokens {
+		session, err := p.findSession(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if session == nil || session.UserSubject != subject || session.ID.String() != sessionID {
+			stale = append(stale, sessionID)
+			continue
+		}
+		session.Current = sessionID == current
+		sessions = append(sessions, session)
+	}
+	if len(stale) > 0 {
+		if err := p.index.Remove(ctx, subject, stale...); err != nil {
+			logging.FromContext(ctx).Warn("failed to remove expired sessions from index", "error", err)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b *models.Session) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return sessions, nil
+}
+
+// RevokeSession は ctx の主体のセッションを破棄する. 主体のセッションでない場合は ErrDBNotFound
+// リクエストのセッションを破棄した場合, リクエストは新しい (主体の無い) セッションで応答する
+func (p *SessionTracker) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+
+	subject, err := sessionSubject(ctx)
+	if err != nil {
+		return err
+	}
+	tokens, err := p.index.Tokens(ctx, subject)
+	if err != nil {
+		return err
+	}
+	token, ok := tokens[sessionID.String()]
+	if !ok {
+		return cerrors.ErrDBNotFound.New(
+			cerrors.WithMessagef("session not found: %s", sessionID),
+		)
+	}
+
+	if p.sm.GetString(ctx, sessionIDKey) == sessionID.String() {
+		err = p.sm.Destroy(ctx)
+	} else {
+		err = deleteSessionData(ctx, p.sm.Store, token)
+	}
+	if err != nil {
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to delete session"),
+		)
+	}
+	return p.index.Remove(ctx, subject, sessionID.String())
+}
+
+// RevokeUserSessions は subject の全てのセッションを破棄し, 破棄した数を返す (全ての端末からのログアウト)
+// 索引に漏れがあっても破棄できるよう, 全てのセッションを走査する (scs の Iterate)
+func (p *SessionTracker) RevokeUserSessions(ctx context.Context, subject string) (int, error) {
+
+	revoked := 0
+	err := p.sm.Iterate(ctx, func(ctx context.Context) error {
+		if p.sm.GetString(ctx, sessionSubjectKey) != subject {
+			return nil
+		}
+		revoked++
+		return p.sm.Destroy(ctx)
+	})
+	if err != nil {
+		return revoked, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("failed to revoke sessions: %s", subject),
+		)
+	}
+
+	// 自分のセッションは応答時に保存し直されるため, リクエストのセッションとしても破棄する
+	if hasSession(p.sm, ctx) && p.sm.GetString(ctx, sessionSubjectKey) == subject {
+		if err := p.sm.Destroy(ctx); err != nil {
+			return revoked, cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to delete session"),
+			)
+		}
+	}
+	return revoked, p.index.Remove(ctx, subject)
+}
+
+// findSession は token のセッションを返す. 失効している場合は nil
+func (p *SessionTracker) findSession(ctx context.Context, token string) (*models.Session, error) {
+
+	b, found, err := findSessionData(ctx, p.sm.Store, token)
+	if err != nil {
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to find session"),
+		)
+	}
+	if !found {
+		return nil, nil
+	}
+	deadline, values, err := p.sm.Codec.Decode(b)
+	if err != nil {
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to decode session"),
+		)
+	}
+
+	id, err := uuid.Parse(stringValue(values, sessionIDKey))
+	if err != nil {
+		return nil, nil
+	}
+	session := &models.Session{
+		ID:          id,
+		UserSubject: stringValue(values, sessionSubjectKey),
+		Device:      stringValue(values, sessionDeviceKey),
+		IPAddress:   stringValue(values, sessionIPKey),
+		CreatedAt:   timeValue(values, sessionCreatedAtKey),
+		LastSeenAt:  timeValue(values, sessionLastSeenAtKey),
+		ExpiresAt:   deadline,
+	}
+	if p.sm.IdleTimeout > 0 {
+		if idle := session.LastSeenAt.Add(p.sm.IdleTimeout); idle.Before(session.ExpiresAt) {
+			session.ExpiresAt = idle
+		}
+	}
+	return session, nil
+}
+
+// sessionSubject は ctx の主体 (OIDC のサブジェクト) を返す
+func sessionSubject(ctx context.Context) (string, error) {
+	actor := audit.ActorFromContext(ctx)
+	if actor.Type != models.AuditActorTypeOIDC || actor.ID == "" {
+		return "", cerrors.ErrAuthentication.New(
+			cerrors.WithMessage("sessions are only available to authenticated users"),
+		)
+	}
+	return actor.ID, nil
+}
+
+func stringValue(values map[string]any, key string) string {
+	value, _ := values[key].(string)
+	return value
+}
+
+func timeValue(values map[string]any, key string) time.Time {
+	value, ok := values[key].(int64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(0, value).UTC()
+}
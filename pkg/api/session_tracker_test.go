@@ -0,0 +1,268 @@
+// pkg/api/session_tracker_test.go
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db/memory"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+// newSessionTrackerRouter は SessionTracker を通すルータを生成する. cors が nil でない場合は CSRFProtector も通す
+func newSessionTrackerRouter(t *testing.T, cors *config.CORS) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	dbHandler, err := memory.NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opsHandler, err := operations.NewHandler(dbHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memstore.New()
+	t.Cleanup(store.StopCleanup)
+	cfg := config.NewConfig().Session
+	sm, err := NewSessionManager(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker, err := NewSessionTracker(cfg, "super_admin", sm, NewMemorySessionIndex(), "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(SessionLoadAndSave(sm))
+	// OIDC の認証ミドルウェアの代わり
+	router.Use(func(c *gin.Context) {
+		if subject := c.GetHeader("X-Test-Subject"); subject != "" {
+			SetUserSubject(c, subject)
+			SetUserRoles(c, c.GetHeader("X-Test-Role"))
+		}
+	})
+	router.Use(tracker.Middleware())
+	corsCfg := config.CORS{}
+	if cors != nil {
+		corsCfg = *cors
+	}
+	csrf, err := NewCSRFProtector(config.NewConfig().Server.CSRF, corsCfg, sm, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cors != nil {
+		router.Use(csrf.Middleware())
+	}
+	router.GET("/whoami", func(c *gin.Context) {
+		c.String(http.StatusOK, UserSubject(c))
+	})
+	serverImpl := NewStrictServerImpl(opsHandler, tracker, csrf)
+	openapi.RegisterHandlers(newCustomMethodRouter(router), openapi.NewStrictHandler(serverImpl, []openapi.StrictMiddlewareFunc{StrictErrorRecorder()}))
+	return router
+}
+
+// sessionClient は Cookie を保持してリクエストする端末
+type sessionClient struct {
+	router    *gin.Engine
+	userAgent string
+	cookie    *http.Cookie
+}
+
+func (p *sessionClient) do(t *testing.T, method string, target string, body any, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", p.userAgent)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	if p.cookie != nil {
+		req.AddCookie(p.cookie)
+	}
+	w := httptest.NewRecorder()
+	p.router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "session" {
+			p.cookie = cookie
+		}
+	}
+	return w
+}
+
+// login は OIDC で認証したリクエストでセッションに主体を記録する
+func (p *sessionClient) login(t *testing.T, subject string, role string) {
+	t.Helper()
+	if w := p.do(t, http.MethodGet, "/whoami", nil, "X-Test-Subject", subject, "X-Test-Role", role); w.Code != http.StatusOK {
+		t.Fatalf("login status = %d; want 200", w.Code)
+	}
+}
+
+func (p *sessionClient) whoami(t *testing.T) string {
+	t.Helper()
+	return p.do(t, http.MethodGet, "/whoami", nil).Body.String()
+}
+
+func listSessions(t *testing.T, client *sessionClient) []openapi.LoginSession {
+	t.Helper()
+	w := client.do(t, http.MethodGet, "/me/sessions", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /me/sessions status = %d; want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp openapi.SessionsListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Sessions
+}
+
+func TestSessionTracker_BindAndRestore(t *testing.T) {
+	router := newSessionTrackerRouter(t, nil)
+	client := &sessionClient{router: router, userAgent: "laptop"}
+
+	if got := client.whoami(t); got != "" {
+		t.Fatalf("anonymous whoami = %q; want empty", got)
+	}
+	anonymousCookie := client.cookie
+
+	client.login(t, "alice", "")
+	// 主体を記録したセッションはトークンを作り直す
+	if client.cookie == nil || anonymousCookie == nil || client.cookie.Value == anonymousCookie.Value {
+		t.Fatalf("session token was not renewed on login")
+	}
+	if got := client.whoami(t); got != "alice" {
+		t.Errorf("whoami with session = %q; want alice", got)
+	}
+
+	// 作り直す前のトークンは使えない
+	stale := &sessionClient{router: router, cookie: anonymousCookie}
+	if got := stale.whoami(t); got != "" {
+		t.Errorf("whoami with the old token = %q; want empty", got)
+	}
+}
+
+func TestSessionTracker_MySessions(t *testing.T) {
+	router := newSessionTrackerRouter(t, nil)
+	laptop := &sessionClient{router: router, userAgent: "laptop"}
+	phone := &sessionClient{router: router, userAgent: "phone"}
+	other := &sessionClient{router: router, userAgent: "other"}
+	laptop.login(t, "alice", "")
+	phone.login(t, "alice", "")
+	other.login(t, "bob", "")
+
+	anonymous := &sessionClient{router: router}
+	if w := anonymous.do(t, http.MethodGet, "/me/sessions", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET /me/sessions status = %d; want 401", w.Code)
+	}
+
+	sessions := listSessions(t, laptop)
+	if len(sessions) != 2 {
+		t.Fatalf("len(sessions) = %d; want 2", len(sessions))
+	}
+	if !sessions[0].Current || sessions[1].Current || *sessions[0].Device != "laptop" || *sessions[1].Device != "phone" {
+		t.Errorf("sessions = %+v; want [laptop (current), phone]", sessions)
+	}
+	if sessions[0].IpAddress == nil || sessions[0].ExpiresAt.IsZero() {
+		t.Errorf("session = %+v; want ip_address and expires_at", sessions[0])
+	}
+
+	// 他のユーザのセッションは破棄できない
+	bobSessions := listSessions(t, other)
+	if w := laptop.do(t, http.MethodDelete, "/me/sessions/"+bobSessions[0].Id.String(), nil); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE other user's session status = %d; want 404", w.Code)
+	}
+
+	if w := laptop.do(t, http.MethodDelete, "/me/sessions/"+sessions[1].Id.String(), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /me/sessions/{id} status = %d; want 204", w.Code)
+	}
+	if got := phone.whoami(t); got != "" {
+		t.Errorf("whoami with revoked session = %q; want empty", got)
+	}
+	if got := listSessions(t, laptop); len(got) != 1 {
+		t.Errorf("len(sessions) after revoke = %d; want 1", len(got))
+	}
+
+	// 自分のセッションを破棄するとログアウトする
+	if w := laptop.do(t, http.MethodDelete, "/me/sessions/"+sessions[0].Id.String(), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE current session status = %d; want 204", w.Code)
+	}
+	if got := laptop.whoami(t); got != "" {
+		t.Errorf("whoami after logout = %q; want empty", got)
+	}
+}
+
+func TestSessionTracker_RevokeUserSessions(t *testing.T) {
+	router := newSessionTrackerRouter(t, nil)
+	laptop := &sessionClient{router: router, userAgent: "laptop"}
+	phone := &sessionClient{router: router, userAgent: "phone"}
+	admin := &sessionClient{router: router, userAgent: "admin"}
+	member := &sessionClient{router: router, userAgent: "member"}
+	laptop.login(t, "alice", "")
+	phone.login(t, "alice", "")
+	admin.login(t, "carol", "admin")
+	member.login(t, "dave", "member")
+
+	body := openapi.SessionsRevocation{UserSubject: "alice"}
+	if w := (&sessionClient{router: router}).do(t, http.MethodPost, "/sessions:revoke", body); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous POST /sessions:revoke status = %d; want 401", w.Code)
+	}
+	if w := member.do(t, http.MethodPost, "/sessions:revoke", body); w.Code != http.StatusForbidden {
+		t.Errorf("member POST /sessions:revoke status = %d; want 403", w.Code)
+	}
+
+	w := admin.do(t, http.MethodPost, "/sessions:revoke", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /sessions:revoke status = %d; want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp openapi.SessionsRevocationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Revoked != 2 {
+		t.Errorf("revoked = %d; want 2", resp.Revoked)
+	}
+	for _, client := range []*sessionClient{laptop, phone} {
+		if got := client.whoami(t); got != "" {
+			t.Errorf("%s: whoami after revoke = %q; want empty", client.userAgent, got)
+		}
+	}
+	if got := admin.whoami(t); got != "carol" {
+		t.Errorf("admin whoami = %q; want carol", got)
+	}
+}
+
+func TestNewSessionManager(t *testing.T) {
+	cfg := config.NewConfig().Session
+	cfg.Cookie.Name = "goapp_session"
+	cfg.Cookie.SameSite = "strict"
+	sm, err := NewSessionManager(cfg, memstore.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Cookie.Name != "goapp_session" || sm.Cookie.SameSite != http.SameSiteStrictMode || sm.IdleTimeout == 0 {
+		t.Errorf("session manager = %+v; want configured cookie and idle timeout", sm.Cookie)
+	}
+
+	// SameSite=None は Secure が必要
+	cfg.Cookie.SameSite = "none"
+	if _, err := NewSessionManager(cfg, memstore.New()); err == nil {
+		t.Error("NewSessionManager() with same_site none and insecure cookie succeeded; want error")
+	}
+}
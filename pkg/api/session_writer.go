@@ -1,4 +1,5 @@
-package main
+// pkg/api/session_writer.go
+package api
 
 import (
 	"context"
@@ -60,6 +61,11 @@ func (sw *sessionWriter) WriteString(s string) (int, error) {
 	return sw.ResponseWriter.WriteString(s)
 }
 
+// Unwrap は http.ResponseController が接続の期限を設定できるよう元の ResponseWriter を返す
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
 func SessionLoadAndSave(sm *scs.SessionManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -0,0 +1,2 @@
+// pkg/api/session_writer_test.go
+package api
@@ -0,0 +1,146 @@
+// pkg/api/sessions.go
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// Get CSRF token
+// (GET /auth/csrf)
+func (p *StrictServerImpl) GetCsrfToken(ctx context.Context, request openapi.GetCsrfTokenRequestObject) (openapi.GetCsrfTokenResponseObject, error) {
+
+	token, err := p.csrf.Token(ctx)
+	if err != nil {
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to get csrf token"),
+		)
+		return openapi.GetCsrfToken500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	}
+
+	return openapi.GetCsrfToken200JSONResponse{
+		Token:      token,
+		HeaderName: p.csrf.HeaderName(),
+	}, nil
+}
+
+// List my sessions
+// (GET /me/sessions)
+func (p *StrictServerImpl) ListMySessions(ctx context.Context, request openapi.ListMySessionsRequestObject) (openapi.ListMySessionsResponseObject, error) {
+
+	sessions, err := p.sessions.ListSessions(ctx)
+	switch {
+	case errorCodeOf(err) == errorCodeOf(cerrors.ErrAuthentication.New()):
+		return openapi.ListMySessions401JSONResponse(unauthenticatedSessionProblem()), err
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to list sessions"),
+		)
+		return openapi.ListMySessions500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	}
+
+	retItems := make([]openapi.LoginSession, 0, len(sessions))
+	for _, session := range sessions {
+		retItems = append(retItems, toAPISession(session))
+	}
+
+	return openapi.ListMySessions200JSONResponse{
+		Sessions: retItems,
+	}, nil
+}
+
+// Revoke one of my sessions
+// (DELETE /me/sessions/{session_id})
+func (p *StrictServerImpl) RevokeMySession(ctx context.Context, request openapi.RevokeMySessionRequestObject) (openapi.RevokeMySessionResponseObject, error) {
+
+	sessionID, err := uuid.Parse(request.SessionId)
+	if err != nil {
+		return openapi.RevokeMySession404JSONResponse(notFoundProblem()), sessionNotFoundError(err)
+	}
+
+	err = p.sessions.RevokeSession(ctx, sessionID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.RevokeMySession404JSONResponse(notFoundProblem()), sessionNotFoundError(err)
+	case errorCodeOf(err) == errorCodeOf(cerrors.ErrAuthentication.New()):
+		return openapi.RevokeMySession401JSONResponse(unauthenticatedSessionProblem()), err
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to revoke session"),
+		)
+		return openapi.RevokeMySession500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		return openapi.RevokeMySession204Response{}, nil
+	}
+}
+
+// Log a user out everywhere
+// (POST /sessions:revoke)
+func (p *StrictServerImpl) RevokeUserSessions(ctx context.Context, request openapi.RevokeUserSessionsRequestObject) (openapi.RevokeUserSessionsResponseObject, error) {
+
+	revoked, err := p.sessions.RevokeUserSessions(ctx, request.Body.UserSubject)
+	if err != nil {
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to revoke user sessions"),
+		)
+		return openapi.RevokeUserSessions500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	}
+
+	return openapi.RevokeUserSessions200JSONResponse{
+		Revoked: int32(revoked),
+	}, nil
+}
+
+func sessionNotFoundError(err error) error {
+	return cerrors.ErrDBNotFound.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("session not found"),
+	)
+}
+
+func unauthenticatedSessionProblem() openapi.ProblemDetails {
+	return openapi.ProblemDetails{
+		Type:   PtrOrNil("/authentication-error"),
+		Title:  PtrOrNil(http.StatusText(401)),
+		Status: PtrOrNil(int32(401)),
+		Detail: PtrOrNil("Authentication is required to manage sessions."),
+	}
+}
+
+func toAPISession(session *models.Session) openapi.LoginSession {
+	return openapi.LoginSession{
+		Id:         session.ID,
+		Device:     PtrOrNil(session.Device),
+		IpAddress:  PtrOrNil(session.IPAddress),
+		Current:    session.Current,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+	}
+}
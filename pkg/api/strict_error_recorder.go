@@ -0,0 +1,26 @@
+// pkg/api/strict_error_recorder.go
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+)
+
+// StrictErrorRecorder は StrictServerImpl がレスポンスと共に返したエラーを gin.Context に記録し, レスポンスはそのまま書き出させる
+//
+// 生成コードの strict handler はエラーが返るとレスポンスを捨てて本文無しの 500 にするため,
+// 404/400 等の ProblemDetails を返せるようにエラーだけを ctx.Error に移す (ログ/メトリクスは c.Errors から拾う)
+// レスポンスが無い場合は従来通り 500 にする
+func StrictErrorRecorder() openapi.StrictMiddlewareFunc {
+	return func(f openapi.StrictHandlerFunc, operationID string) openapi.StrictHandlerFunc {
+		return func(ctx *gin.Context, request any) (any, error) {
+			response, err := f(ctx, request)
+			if err != nil && response != nil {
+				_ = ctx.Error(err)
+				return response, nil
+			}
+			return response, err
+		}
+	}
+}
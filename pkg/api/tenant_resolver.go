@@ -0,0 +1,272 @@
+// pkg/api/tenant_resolver.go
+package api
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+const (
+	// gin.Context に保持する認証のクレームのテナントのキー
+	tenantClaimKey = "tenant_claim"
+
+	// gin.Context に保持するユーザのロールのキー
+	userRolesKey = "user_roles"
+
+	// gin.Context に保持するリクエストのテナントのキー. HTTPMetrics のラベルに使う
+	tenantIDKey = "tenant_id"
+
+	// 全てのテナントを対象にしたリクエストの tenant_id
+	crossTenantLabel = "*"
+)
+
+// テナントを特定せずに処理するルート (プローブ等)
+var tenantExemptRoutes = []string{
+	"/health/liveness",
+	"/health/readiness",
+}
+
+// TenantResolver はリクエストのテナントを特定し, 以降の処理 (db.Handler) をそのテナントに限定する
+type TenantResolver struct {
+	cfg          config.Tenancy
+	opsHandler   *operations.Handler
+	uriReference string
+	logger       *slog.Logger
+}
+
+func NewTenantResolver(cfg config.Tenancy, opsHandler *operations.Handler, uriReferenceBase string, logger *slog.Logger) (*TenantResolver, error) {
+
+	// uriReferenceBase
+	uriRef, err := url.Parse(uriReferenceBase)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to initialize tenant resolver"),
+			cerrors.WithMessagef("url: %s", uriReferenceBase),
+		)
+	}
+	uriRef.Path = path.Join("/", "/tenant-error")
+
+	// logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &TenantResolver{
+		cfg:          cfg,
+		opsHandler:   opsHandler,
+		uriReference: uriRef.String(),
+		logger:       logger,
+	}, nil
+}
+
+// Middleware はテナントを 認証のクレーム → ヘッダ → サブドメイン の順に特定し, ctx に紐付ける
+// クレームと異なるテナントを指定できるのは super-admin のみ. クレームが無い場合も allow_unauthenticated_selection が無効であれば super-admin のみ
+// super-admin が admin_routes でテナントを指定しなかった場合は全てのテナントを対象にする
+// マルチテナントが無効の場合はデフォルトのテナントを紐付ける
+// 特定したテナントは logger, span の属性, HTTPMetrics のラベルにも付与する
+// 認証ミドルウェア (SetUserSubject, SetTenantClaim, SetUserRoles) より後ろに置くこと
+func (p *TenantResolver) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if slices.Contains(tenantExemptRoutes, routeTemplate(c)) {
+			c.Next()
+			return
+		}
+
+		if !p.cfg.Enabled {
+			setTenant(c, models.DefaultTenantID)
+			c.Next()
+			return
+		}
+
+		logger := logging.FromContext(c.Request.Context())
+
+		claimed, hasClaim, err := tenantClaim(c)
+		if err != nil {
+			logger.Warn("invalid tenant claim", "error", err)
+			p.abort(c, http.StatusUnauthorized, "The tenant in your credentials is invalid.")
+			return
+		}
+		requested, hasRequested, rejection := p.requestedTenant(c)
+		if rejection != nil {
+			p.abort(c, rejection.status, rejection.detail)
+			return
+		}
+		superAdmin := p.cfg.SuperAdminRole != "" && slices.Contains(UserRoles(c), p.cfg.SuperAdminRole)
+
+		switch {
+		case hasRequested:
+			switch {
+			case superAdmin || (hasClaim && requested == claimed):
+			case hasClaim:
+				logger.Warn("tenant does not match credentials", "tenant_id", requested, "tenant_claim", claimed)
+				p.abort(c, http.StatusForbidden, "You are not allowed to access the tenant.")
+				return
+			case p.cfg.AllowUnauthenticatedSelection:
+			case UserSubject(c) == "":
+				logger.Warn("tenant selected without credentials", "tenant_id", requested)
+				p.abort(c, http.StatusUnauthorized, "Authentication is required to access the tenant.")
+				return
+			default:
+				logger.Warn("tenant selected without a tenant claim", "tenant_id", requested)
+				p.abort(c, http.StatusForbidden, "You are not allowed to access the tenant.")
+				return
+			}
+			setTenant(c, requested)
+		case hasClaim:
+			setTenant(c, claimed)
+		case superAdmin && slices.Contains(p.cfg.AdminRoutes, routeTemplate(c)):
+			setCrossTenant(c)
+		default:
+			p.abort(c, http.StatusBadRequest, "The tenant is not specified.")
+			return
+		}
+		c.Next()
+	}
+}
+
+// tenantRejection はテナントを特定できずにリクエストを打ち切る場合のレスポンス
+type tenantRejection struct {
+	status int
+	detail string
+}
+
+// requestedTenant はヘッダまたはサブドメインで指定されたテナントを返す
+func (p *TenantResolver) requestedTenant(c *gin.Context) (uuid.UUID, bool, *tenantRejection) {
+
+	ctx := c.Request.Context()
+
+	if p.cfg.Header != "" {
+		if value := c.GetHeader(p.cfg.Header); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return uuid.Nil, false, &tenantRejection{http.StatusBadRequest, "The tenant header is not a valid UUID."}
+			}
+			tenant, err := p.opsHandler.GetTenant(ctx, id)
+			if err != nil {
+				return uuid.Nil, false, lookupRejection(c, err)
+			}
+			return tenant.ID, true, nil
+		}
+	}
+
+	if slug, found := subdomain(c.Request.Host, p.cfg.SubdomainBase); found {
+		tenant, err := p.opsHandler.GetTenantBySlug(ctx, slug)
+		if err != nil {
+			return uuid.Nil, false, lookupRejection(c, err)
+		}
+		return tenant.ID, true, nil
+	}
+	return uuid.Nil, false, nil
+}
+
+func lookupRejection(c *gin.Context, err error) *tenantRejection {
+	if errorCodeOf(err) == errorCodeOf(cerrors.ErrDBNotFound.New()) {
+		return &tenantRejection{http.StatusBadRequest, "The tenant does not exist."}
+	}
+	logging.FromContext(c.Request.Context()).Error("failed to resolve tenant", "error", err)
+	if rejected, ok := resilience.Rejected(err); ok {
+		setRetryAfter(c, rejected)
+	}
+	return &tenantRejection{http.StatusServiceUnavailable, "The tenant could not be resolved."}
+}
+
+func (p *TenantResolver) abort(c *gin.Context, status int, detail string) {
+	c.AbortWithStatusJSON(status, openapi.ProblemDetails{
+		Type:   PtrOrNil(p.uriReference),
+		Title:  PtrOrNil(http.StatusText(status)),
+		Status: PtrOrNil(int32(status)),
+		Detail: PtrOrNil(detail),
+	})
+}
+
+// subdomain は host が base のサブドメインであればその最も左のラベルを返す (acme.example.com → acme)
+func subdomain(host string, base string) (string, bool) {
+	if base == "" {
+		return "", false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	prefix, found := strings.CutSuffix(host, "."+strings.ToLower(base))
+	if !found || prefix == "" {
+		return "", false
+	}
+	label, _, _ := strings.Cut(prefix, ".")
+	return label, true
+}
+
+func setTenant(c *gin.Context, tenantID uuid.UUID) {
+	c.Set(tenantIDKey, tenantID.String())
+	ctx := logging.With(db.WithTenant(c.Request.Context(), tenantID), tenantIDKey, tenantID.String())
+	oteltrace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", tenantID.String()))
+	c.Request = c.Request.WithContext(ctx)
+}
+
+func setCrossTenant(c *gin.Context) {
+	c.Set(tenantIDKey, crossTenantLabel)
+	ctx := logging.With(db.WithCrossTenant(c.Request.Context()), tenantIDKey, crossTenantLabel)
+	oteltrace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.id", crossTenantLabel))
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// SetTenantClaim は認証済みのトークンのテナントのクレーム (テナントの ID) を gin.Context に保持する
+// 認証ミドルウェアから呼ぶことを想定
+func SetTenantClaim(c *gin.Context, tenantID string) {
+	if tenantID == "" {
+		return
+	}
+	c.Set(tenantClaimKey, tenantID)
+}
+
+// SetUserRoles は認証済みユーザのロールを gin.Context に保持する
+// 認証ミドルウェアから呼ぶことを想定
+func SetUserRoles(c *gin.Context, roles ...string) {
+	c.Set(userRolesKey, roles)
+}
+
+// UserRoles は SetUserRoles で保持されたロールを返す
+func UserRoles(c *gin.Context) []string {
+	return c.GetStringSlice(userRolesKey)
+}
+
+// TenantID は TenantResolver が特定したテナントを返す. 全てのテナントを対象にする場合は "*", 特定していない場合は空文字
+func TenantID(c *gin.Context) string {
+	return c.GetString(tenantIDKey)
+}
+
+func tenantClaim(c *gin.Context) (uuid.UUID, bool, error) {
+	value := c.GetString(tenantClaimKey)
+	if value == "" {
+		return uuid.Nil, false, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, false, cerrors.ErrAuthentication.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("invalid tenant claim: %q", value),
+		)
+	}
+	return id, true, nil
+}
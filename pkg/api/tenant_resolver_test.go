@@ -0,0 +1,186 @@
+// pkg/api/tenant_resolver_test.go
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/memory"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+// resolvedTenant はハンドラから見えたテナント
+type resolvedTenant struct {
+	tenantID    uuid.UUID
+	crossTenant bool
+}
+
+var testTenant = &models.Tenant{ID: uuid.MustParse("0197a6b2-6c4d-7def-8a12-000000000001"), Slug: "acme", Name: "Acme"}
+
+func newTenantResolverRouter(t *testing.T, cfg config.Tenancy, got *resolvedTenant) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	dbHandler, err := memory.NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbHandler.AddTenant(context.Background(), testTenant); err != nil {
+		t.Fatal(err)
+	}
+	opsHandler, err := operations.NewHandler(dbHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := NewTenantResolver(cfg, opsHandler, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	// 認証ミドルウェアの代わり
+	router.Use(func(c *gin.Context) {
+		if subject := c.GetHeader("X-Test-Subject"); subject != "" {
+			SetUserSubject(c, subject)
+		}
+		SetTenantClaim(c, c.GetHeader("X-Test-Tenant-Claim"))
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			SetUserRoles(c, role)
+		}
+	})
+	router.Use(resolver.Middleware())
+	handler := func(c *gin.Context) {
+		ctx := c.Request.Context()
+		got.tenantID, _ = db.TenantFromContext(ctx)
+		got.crossTenant = db.IsCrossTenant(ctx)
+		c.Status(http.StatusNoContent)
+	}
+	router.GET("/users", handler)
+	router.GET("/audit-events", handler)
+	router.GET("/health/liveness", handler)
+	return router
+}
+
+func testTenancyConfig() config.Tenancy {
+	cfg := config.NewConfig().Tenancy
+	cfg.Enabled = true
+	cfg.SubdomainBase = "example.com"
+	return cfg
+}
+
+func TestTenantResolver_Disabled(t *testing.T) {
+	var got resolvedTenant
+	router := newTenantResolverRouter(t, config.NewConfig().Tenancy, &got)
+
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("X-Tenant-ID", testTenant.ID.String())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent || got.tenantID != models.DefaultTenantID {
+		t.Errorf("status = %d, tenant = %s; want 204, %s", w.Code, got.tenantID, models.DefaultTenantID)
+	}
+}
+
+func TestTenantResolver_Resolve(t *testing.T) {
+	other := uuid.MustParse("0197a6b2-6c4d-7def-8a12-000000000002")
+
+	tests := []struct {
+		name                 string
+		path                 string
+		host                 string
+		header               string
+		subject              string
+		claim                string
+		role                 string
+		allowUnauthenticated bool
+		wantStatus           int
+		want                 resolvedTenant
+	}{
+		// クレームが無い場合はヘッダやサブドメインのテナントを使わない
+		{name: "anonymous header", path: "/users", header: testTenant.ID.String(), wantStatus: http.StatusUnauthorized},
+		{name: "anonymous subdomain", path: "/users", host: "acme.example.com:8080", wantStatus: http.StatusUnauthorized},
+		{name: "header without claim", path: "/users", header: testTenant.ID.String(), subject: "subject-1", wantStatus: http.StatusForbidden},
+		{name: "header with unauthenticated selection", path: "/users", header: testTenant.ID.String(), allowUnauthenticated: true, wantStatus: http.StatusNoContent, want: resolvedTenant{tenantID: testTenant.ID}},
+		{name: "subdomain with unauthenticated selection", path: "/users", host: "acme.example.com:8080", allowUnauthenticated: true, wantStatus: http.StatusNoContent, want: resolvedTenant{tenantID: testTenant.ID}},
+		{name: "subdomain matches claim", path: "/users", host: "acme.example.com", claim: testTenant.ID.String(), wantStatus: http.StatusNoContent, want: resolvedTenant{tenantID: testTenant.ID}},
+		{name: "super-admin without claim", path: "/users", header: testTenant.ID.String(), role: "super_admin", wantStatus: http.StatusNoContent, want: resolvedTenant{tenantID: testTenant.ID}},
+		{name: "claim", path: "/users", claim: testTenant.ID.String(), wantStatus: http.StatusNoContent, want: resolvedTenant{tenantID: testTenant.ID}},
+		{name: "header matches claim", path: "/users", header: testTenant.ID.String(), claim: testTenant.ID.String(), wantStatus: http.StatusNoContent, want: resolvedTenant{tenantID: testTenant.ID}},
+		{name: "header differs from claim", path: "/users", header: testTenant.ID.String(), claim: other.String(), wantStatus: http.StatusForbidden},
+		{name: "super-admin selects tenant", path: "/users", header: testTenant.ID.String(), claim: other.String(), role: "super_admin", wantStatus: http.StatusNoContent, want: resolvedTenant{tenantID: testTenant.ID}},
+		{name: "super-admin on admin route", path: "/audit-events", role: "super_admin", wantStatus: http.StatusNoContent, want: resolvedTenant{crossTenant: true}},
+		{name: "super-admin outside admin routes", path: "/users", role: "super_admin", wantStatus: http.StatusBadRequest},
+		{name: "admin route without super-admin", path: "/audit-events", role: "viewer", wantStatus: http.StatusBadRequest},
+		{name: "not specified", path: "/users", wantStatus: http.StatusBadRequest},
+		{name: "unknown tenant", path: "/users", header: other.String(), wantStatus: http.StatusBadRequest},
+		{name: "unknown subdomain", path: "/users", host: "unknown.example.com", wantStatus: http.StatusBadRequest},
+		{name: "invalid header", path: "/users", header: "acme", wantStatus: http.StatusBadRequest},
+		{name: "invalid claim", path: "/users", claim: "acme", wantStatus: http.StatusUnauthorized},
+		{name: "exempt route", path: "/health/liveness", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got resolvedTenant
+			cfg := testTenancyConfig()
+			cfg.AllowUnauthenticatedSelection = tt.allowUnauthenticated
+			router := newTenantResolverRouter(t, cfg, &got)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Tenant-ID", tt.header)
+			}
+			if tt.subject != "" {
+				req.Header.Set("X-Test-Subject", tt.subject)
+			}
+			if tt.claim != "" {
+				req.Header.Set("X-Test-Tenant-Claim", tt.claim)
+			}
+			if tt.role != "" {
+				req.Header.Set("X-Test-Role", tt.role)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got != tt.want {
+				t.Errorf("resolved = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubdomain(t *testing.T) {
+	tests := []struct {
+		host string
+		base string
+		want string
+		ok   bool
+	}{
+		{host: "acme.example.com", base: "example.com", want: "acme", ok: true},
+		{host: "ACME.Example.com.:443", base: "example.com", want: "acme", ok: true},
+		{host: "a.b.example.com", base: "example.com", want: "a", ok: true},
+		{host: "example.com", base: "example.com", ok: false},
+		{host: "acme.example.org", base: "example.com", ok: false},
+		{host: "acme.example.com", base: "", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := subdomain(tt.host, tt.base)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("subdomain(%q, %q) = %q, %v; want %q, %v", tt.host, tt.base, got, ok, tt.want, tt.ok)
+		}
+	}
+}
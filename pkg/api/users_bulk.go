@@ -0,0 +1,504 @@
+// pkg/api/users_bulk.go
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+const (
+	mediaTypeNDJSON = "application/x-ndjson"
+	mediaTypeCSV    = "text/csv"
+
+	// NDJSON の 1 行の最大長
+	maxImportLineSize = 1 << 20
+
+	// 書き出しの途中で失敗した場合に, その理由を返す trailer
+	exportErrorTrailer = "X-Export-Error"
+)
+
+// UserImportHandler は POST /users:import (NDJSON/CSV の一括取り込み) を処理する
+//
+// strict server では生成できないため (pkg/api/openapi/oapi-codegen.yaml), gin のハンドラとして実装する
+// 本文は 1 行ずつ読み, 各行を OpenAPI の UserPrototype と照合してから operations.Handler に渡す
+type UserImportHandler struct {
+	opsHandler *operations.Handler
+	rowSchema  *openapi3.Schema
+}
+
+func NewUserImportHandler(opsHandler *operations.Handler) (*UserImportHandler, error) {
+
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to load openapi spec"),
+		)
+	}
+	rowSchema, ok := spec.Components.Schemas["UserPrototype"]
+	if !ok || rowSchema.Value == nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithMessage("UserPrototype is not defined in openapi spec"),
+		)
+	}
+
+	return &UserImportHandler{
+		opsHandler: opsHandler,
+		rowSchema:  rowSchema.Value,
+	}, nil
+}
+
+// Handler は取り込みの結果を返す. 変更を確定した場合と dry run は 200, 重複でロールバックした場合は 409
+func (p *UserImportHandler) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		params, invalidParams := importUsersParams(c)
+
+		var rows iter.Seq2[*models.UserImportRow, error]
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		switch mediaType {
+		case mediaTypeNDJSON:
+			rows = p.ndjsonRows(c.Request.Body)
+		case mediaTypeCSV:
+			rows = p.csvRows(c.Request.Body)
+		default:
+			invalidParams = append(invalidParams, newInvalidParam("Content-Type", fmt.Sprintf("must be %s or %s", mediaTypeNDJSON, mediaTypeCSV)))
+		}
+		if len(invalidParams) > 0 {
+			abortImportUsers(c, http.StatusBadRequest, invalidParams, cerrors.ErrValidation.New(
+				cerrors.WithMessage("invalid import request"),
+			))
+			return
+		}
+
+		result, err := p.opsHandler.ImportUsers(c, params, rows)
+		var maxBytesErr *http.MaxBytesError
+		var formatErr *userImportFormatError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			// 本文は RequestSizeLimiter が書く
+			_ = c.Error(cerrors.ErrResourceExhausted.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("import request body too large"),
+			))
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		case errors.As(err, &formatErr):
+			abortImportUsers(c, http.StatusBadRequest, []openapi.InvalidParam{newInvalidParam("body", formatErr.Error())}, cerrors.ErrValidation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("invalid import request body"),
+			))
+			return
+		case err != nil:
+			_ = c.Error(cerrors.ErrSystemInternal.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to import users"),
+			))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openapi.ProblemDetails{
+				Type:   PtrOrNil("/internal_server_error"),
+				Title:  PtrOrNil(http.StatusText(500)),
+				Status: PtrOrNil(int32(500)),
+			})
+			return
+		}
+
+		logging.FromContext(c).Info("users imported",
+			"dry_run", result.DryRun,
+			"on_duplicate", result.OnDuplicate,
+			"committed", result.Committed,
+			"total", result.Total,
+			"created", result.Created,
+			"updated", result.Updated,
+			"skipped", result.Skipped,
+			"failed", result.Failed,
+		)
+
+		status := http.StatusOK
+		if !result.Committed && !result.DryRun {
+			status = http.StatusConflict
+		}
+		c.JSON(status, toAPIUserImportResult(result))
+	}
+}
+
+func importUsersParams(c *gin.Context) (models.ImportUsersParams, []openapi.InvalidParam) {
+
+	params := models.ImportUsersParams{
+		OnDuplicate: models.UserImportOnDuplicateFail,
+	}
+	invalidParams := []openapi.InvalidParam{}
+
+	if value, ok := c.GetQuery("dry_run"); ok {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			invalidParams = append(invalidParams, newInvalidParam("dry_run", "must be of type boolean"))
+		}
+		params.DryRun = dryRun
+	}
+	if value, ok := c.GetQuery("on_duplicate"); ok {
+		switch onDuplicate := openapi.UserImportOnDuplicate(value); onDuplicate {
+		case openapi.UserImportOnDuplicateFail, openapi.UserImportOnDuplicateSkip, openapi.UserImportOnDuplicateUpdate:
+			params.OnDuplicate = models.UserImportOnDuplicate(onDuplicate)
+		default:
+			invalidParams = append(invalidParams, newInvalidParam("on_duplicate", "must be one of the allowed values"))
+		}
+	}
+	return params, invalidParams
+}
+
+func abortImportUsers(c *gin.Context, status int, invalidParams []openapi.InvalidParam, err error) {
+	_ = c.Error(err)
+	c.AbortWithStatusJSON(status, openapi.ProblemDetails{
+		Type:          PtrOrNil("/bad_request"),
+		Title:         PtrOrNil(http.StatusText(status)),
+		Status:        PtrOrNil(int32(status)),
+		Detail:        PtrOrNil("validation failed for one or more fields"),
+		InvalidParams: &invalidParams,
+	})
+}
+
+// newInvalidParam は ProblemDetailsRenderer と同じ形式 ('name' reason) の InvalidParam を作る
+func newInvalidParam(name string, reason string) openapi.InvalidParam {
+	return openapi.InvalidParam{
+		Name:   name,
+		Reason: fmt.Sprintf("'%s' %s", name, reason),
+	}
+}
+
+// userImportFormatError は本文の形式の誤り. 行の入力の誤りとは違い, 取り込みを中断する
+type userImportFormatError struct {
+	line   int
+	reason string
+}
+
+func (e *userImportFormatError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.reason)
+}
+
+// ndjsonRows は NDJSON を 1 行ずつ読む. 空行は読み飛ばす
+func (p *UserImportHandler) ndjsonRows(body io.Reader) iter.Seq2[*models.UserImportRow, error] {
+	return func(yield func(*models.UserImportRow, error) bool) {
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64<<10), maxImportLineSize)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+
+			var value any
+			if err := json.Unmarshal(text, &value); err != nil {
+				row := &models.UserImportRow{
+					Line:   line,
+					Errors: []models.FieldError{{Name: "body", Reason: "must be a valid JSON object"}},
+				}
+				if !yield(row, nil) {
+					return
+				}
+				continue
+			}
+			if !yield(p.newRow(line, value), nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				err = &userImportFormatError{line: line + 1, reason: fmt.Sprintf("must not be longer than %d bytes", maxImportLineSize)}
+			}
+			yield(nil, err)
+		}
+	}
+}
+
+// csvRows は CSV を 1 行ずつ読む. 1 行目はヘッダで, name と email の列を含むこと (大文字小文字は区別しない. 他の列は無視する)
+func (p *UserImportHandler) csvRows(body io.Reader) iter.Seq2[*models.UserImportRow, error] {
+	return func(yield func(*models.UserImportRow, error) bool) {
+
+		reader := csv.NewReader(body)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = true
+
+		header, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			yield(nil, csvError(err))
+			return
+		}
+		nameIndex, emailIndex := -1, -1
+		for i, column := range header {
+			switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))) {
+			case "name":
+				nameIndex = i
+			case "email":
+				emailIndex = i
+			}
+		}
+		if nameIndex < 0 || emailIndex < 0 {
+			yield(nil, &userImportFormatError{line: 1, reason: "header must have name and email columns"})
+			return
+		}
+
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(nil, csvError(err))
+				return
+			}
+			line, _ := reader.FieldPos(0)
+
+			// 列が足りない行は required の誤りにする
+			value := map[string]any{}
+			if nameIndex < len(record) {
+				value["name"] = record[nameIndex]
+			}
+			if emailIndex < len(record) {
+				value["email"] = record[emailIndex]
+			}
+			if !yield(p.newRow(line, value), nil) {
+				return
+			}
+		}
+	}
+}
+
+// csvError は CSV の構文の誤りを userImportFormatError にする. 読み込みのエラーはそのまま返す
+func csvError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &userImportFormatError{line: parseErr.Line, reason: parseErr.Err.Error()}
+	}
+	return err
+}
+
+// newRow は value を UserPrototype と照合して取り込む行を作る. email は POST /users と同じく小文字にする
+func (p *UserImportHandler) newRow(line int, value any) *models.UserImportRow {
+
+	row := &models.UserImportRow{Line: line}
+	if err := p.rowSchema.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		row.Errors = schemaFieldErrors(err)
+		return row
+	}
+
+	object, _ := value.(map[string]any)
+	name, _ := object["name"].(string)
+	email, _ := object["email"].(string)
+	row.Name = name
+	row.Email = strings.ToLower(email)
+	return row
+}
+
+// schemaFieldErrors はスキーマの照合のエラーを入力の誤りに変換する. 理由は OpenAPIValidator と同じ表現にする
+func schemaFieldErrors(err error) []models.FieldError {
+
+	fieldErrors := []models.FieldError{}
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, child := range e {
+				walk(child)
+			}
+		case *openapi3.SchemaError:
+			name := strings.Join(e.JSONPointer(), ".")
+			if name == "" {
+				name = "body"
+			}
+			fieldErrors = append(fieldErrors, models.FieldError{Name: name, Reason: openAPISchemaReason(e)})
+		default:
+			fieldErrors = append(fieldErrors, models.FieldError{Name: "body", Reason: err.Error()})
+		}
+	}
+	walk(err)
+	return fieldErrors
+}
+
+func toAPIUserImportResult(result *models.UserImportResult) openapi.UserImportResult {
+
+	errs := make([]openapi.UserImportRowError, 0, len(result.Errors))
+	for _, rowError := range result.Errors {
+		invalidParams := make([]openapi.InvalidParam, 0, len(rowError.Errors))
+		for _, fieldError := range rowError.Errors {
+			invalidParams = append(invalidParams, newInvalidParam(fieldError.Name, fieldError.Reason))
+		}
+		errs = append(errs, openapi.UserImportRowError{
+			Line:          rowError.Line,
+			Status:        openapi.UserImportRowErrorStatus(rowError.Status),
+			InvalidParams: invalidParams,
+		})
+	}
+
+	return openapi.UserImportResult{
+		DryRun:          result.DryRun,
+		OnDuplicate:     openapi.UserImportOnDuplicate(result.OnDuplicate),
+		Committed:       result.Committed,
+		Total:           result.Total,
+		Created:         result.Created,
+		Updated:         result.Updated,
+		Skipped:         result.Skipped,
+		Failed:          result.Failed,
+		Errors:          errs,
+		ErrorsTruncated: result.ErrorsTruncated,
+	}
+}
+
+// Export users
+// (GET /users:export)
+func (p *StrictServerImpl) ExportUsers(ctx context.Context, request openapi.ExportUsersRequestObject) (openapi.ExportUsersResponseObject, error) {
+
+	format := openapi.Ndjson
+	if request.Params.Format != nil {
+		format = *request.Params.Format
+	}
+	switch format {
+	case openapi.Ndjson, openapi.Csv:
+	default:
+		invalidParams := []openapi.InvalidParam{newInvalidParam("format", "must be one of the allowed values")}
+		return openapi.ExportUsers400JSONResponse{
+			Type:          PtrOrNil("/bad_request"),
+			Title:         PtrOrNil(http.StatusText(400)),
+			Status:        PtrOrNil(int32(400)),
+			InvalidParams: &invalidParams,
+		}, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid export format: %s", format),
+		)
+	}
+
+	return &exportUsersResponse{
+		ctx:        ctx,
+		opsHandler: p.opsHandler,
+		format:     format,
+	}, nil
+}
+
+// exportUsersResponse はユーザーを 1 ページずつ読み出しながら書き出す (生成される型は本文を io.Reader で受け取るため使わない)
+// 最初のページを読み出す前に失敗した場合は 500 を返す. 書き出し始めた後に失敗した場合は X-Export-Error trailer で知らせる
+type exportUsersResponse struct {
+	ctx        context.Context
+	opsHandler *operations.Handler
+	format     openapi.UserExportFormat
+}
+
+func (response *exportUsersResponse) VisitExportUsersResponse(w http.ResponseWriter) error {
+
+	var header []string
+	var write func(user *models.User) error
+	var flush func() error
+	switch response.format {
+	case openapi.Csv:
+		csvWriter := csv.NewWriter(w)
+		header = []string{"id", "name", "email"}
+		write = func(user *models.User) error {
+			return csvWriter.Write([]string{user.ID.String(), user.Name, user.Email})
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	default:
+		encoder := json.NewEncoder(w)
+		write = func(user *models.User) error {
+			return encoder.Encode(openapi.User{
+				Id:    user.ID,
+				Name:  user.Name,
+				Email: user.Email,
+			})
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+
+	controller := http.NewResponseController(w)
+	started := false
+	start := func() error {
+		started = true
+		contentType := mediaTypeNDJSON
+		if response.format == openapi.Csv {
+			contentType = mediaTypeCSV + "; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Trailer", exportErrorTrailer)
+		w.WriteHeader(http.StatusOK)
+		if header != nil {
+			csvWriter := csv.NewWriter(w)
+			if err := csvWriter.Write(header); err != nil {
+				return err
+			}
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+		return nil
+	}
+
+	// 1 ページ毎に書き出して送る. メモリに載るのは 1 ページ分だけ
+	err := response.opsHandler.ExportUsers(response.ctx, func(users []*models.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		for _, user := range users {
+			if err := write(user); err != nil {
+				return err
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		return nil
+	}
+
+	if !started {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(openapi.ProblemDetails{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		})
+	} else {
+		// ステータスは送信済みのため, 途中で終わったことを trailer で知らせる
+		w.Header().Set(exportErrorTrailer, "export aborted")
+	}
+	return cerrors.ErrSystemInternal.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("failed to export users"),
+	)
+}
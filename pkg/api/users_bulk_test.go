@@ -0,0 +1,261 @@
+// pkg/api/users_bulk_test.go
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/testkit"
+)
+
+// importUsers は POST /users:import を送る. 生成されたクライアントには含まれない (pkg/api/openapi/oapi-codegen.yaml)
+func importUsers(t *testing.T, s *testkit.Server, query string, contentType string, body string) (int, openapi.UserImportResult, []byte) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, testkit.BaseURL+"/users:import?"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result openapi.UserImportResult
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusConflict {
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, result, data
+}
+
+func listUserEmails(t *testing.T, s *testkit.Server) map[string]string {
+	t.Helper()
+
+	resp, err := s.Client.ListUsersWithResponse(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.JSON200 == nil {
+		t.Fatalf("GET /users status = %d; want 200", resp.StatusCode())
+	}
+	users := map[string]string{}
+	for _, user := range resp.JSON200.Users {
+		users[user.Email] = user.Name
+	}
+	return users
+}
+
+func TestE2E_ImportUsers(t *testing.T) {
+
+	ndjson := strings.Join([]string{
+		`{"name":"bob","email":"Bob@Example.com"}`,
+		``,
+		`{"name":"carol","email":"not-an-email"}`,
+		`{"name":"alice2","email":"alice@example.com"}`,
+		`not json`,
+	}, "\n")
+
+	t.Run("skip", func(t *testing.T) {
+		s := testkit.NewServer(t)
+		createUser(t, s, "alice", "alice@example.com")
+
+		status, result, body := importUsers(t, s, "on_duplicate=skip", "application/x-ndjson", ndjson)
+		if status != http.StatusOK || !result.Committed {
+			t.Fatalf("status = %d %s; want 200 committed", status, body)
+		}
+		if result.Total != 4 || result.Created != 1 || result.Skipped != 1 || result.Failed != 2 {
+			t.Errorf("result = %+v; want total 4, created 1, skipped 1, failed 2", result)
+		}
+		if len(result.Errors) != 2 || result.Errors[0].Line != 3 || result.Errors[1].Line != 5 {
+			t.Fatalf("errors = %+v; want lines 3 and 5", result.Errors)
+		}
+		if got := result.Errors[0].InvalidParams[0]; got.Name != "email" || got.Reason != "'email' must be a valid email address" {
+			t.Errorf("line 3 invalid_params = %+v; want invalid email", got)
+		}
+
+		users := listUserEmails(t, s)
+		if len(users) != 2 || users["bob@example.com"] != "bob" || users["alice@example.com"] != "alice" {
+			t.Errorf("users = %v; want alice and bob", users)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		s := testkit.NewServer(t)
+		createUser(t, s, "alice", "alice@example.com")
+
+		status, result, body := importUsers(t, s, "on_duplicate=update", "application/x-ndjson", ndjson)
+		if status != http.StatusOK || result.Created != 1 || result.Updated != 1 {
+			t.Fatalf("status = %d %s; want 200 with created 1, updated 1", status, body)
+		}
+		if users := listUserEmails(t, s); users["alice@example.com"] != "alice2" {
+			t.Errorf("users = %v; want alice renamed to alice2", users)
+		}
+
+		// 取り込みでの変更も監査ログに記録する
+		action := openapi.AuditActionUpdate
+		events := listAuditEvents(t, s, openapi.ListAuditEventsParams{Action: &action}).AuditEvents
+		if len(events) != 1 || (*events[0].Before)["name"] != "alice" || (*events[0].After)["name"] != "alice2" {
+			t.Errorf("update audit events = %+v; want alice renamed to alice2", events)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		s := testkit.NewServer(t)
+		createUser(t, s, "alice", "alice@example.com")
+
+		status, result, body := importUsers(t, s, "", "application/x-ndjson", ndjson)
+		if status != http.StatusConflict || result.Committed {
+			t.Fatalf("status = %d %s; want 409 not committed", status, body)
+		}
+		if len(result.Errors) != 3 || result.Errors[1].Status != openapi.Duplicate || result.Errors[1].Line != 4 {
+			t.Errorf("errors = %+v; want a duplicate on line 4", result.Errors)
+		}
+		if users := listUserEmails(t, s); len(users) != 1 {
+			t.Errorf("users = %v; want the import rolled back", users)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		s := testkit.NewServer(t)
+
+		status, result, body := importUsers(t, s, "dry_run=true&on_duplicate=skip", "application/x-ndjson", ndjson)
+		if status != http.StatusOK || !result.DryRun || result.Committed || result.Created != 2 {
+			t.Fatalf("status = %d %s; want 200 dry run with created 2", status, body)
+		}
+		if users := listUserEmails(t, s); len(users) != 0 {
+			t.Errorf("users = %v; want nothing written", users)
+		}
+	})
+
+	t.Run("duplicates within the body", func(t *testing.T) {
+		s := testkit.NewServer(t)
+
+		status, result, body := importUsers(t, s, "on_duplicate=skip", "application/x-ndjson",
+			`{"name":"dave","email":"dave@example.com"}`+"\n"+`{"name":"dave2","email":"dave@example.com"}`)
+		if status != http.StatusOK || result.Created != 1 || result.Skipped != 1 {
+			t.Fatalf("status = %d %s; want 200 with created 1, skipped 1", status, body)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		s := testkit.NewServer(t)
+
+		csv := "\ufeffEmail,Note,Name\r\n" +
+			"erin@example.com,,\"Erin, Jr.\"\r\n" +
+			"frank@example.com\r\n"
+		status, result, body := importUsers(t, s, "", "text/csv; charset=utf-8", csv)
+		if status != http.StatusOK || result.Created != 1 || result.Failed != 1 {
+			t.Fatalf("status = %d %s; want 200 with created 1, failed 1", status, body)
+		}
+		if got := result.Errors[0]; got.Line != 3 || got.InvalidParams[0].Name != "name" {
+			t.Errorf("errors = %+v; want name required on line 3", result.Errors)
+		}
+		if users := listUserEmails(t, s); users["erin@example.com"] != "Erin, Jr." {
+			t.Errorf("users = %v; want erin", users)
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		s := testkit.NewServer(t)
+
+		tests := []struct {
+			name        string
+			query       string
+			contentType string
+			body        string
+		}{
+			{"unsupported content type", "", "application/json", `{"name":"a","email":"a@example.com"}`},
+			{"missing csv columns", "", "text/csv", "name,mail\r\na,a@example.com\r\n"},
+			{"invalid on_duplicate", "on_duplicate=overwrite", "application/x-ndjson", ""},
+			{"line too long", "", "application/x-ndjson", `{"name":"` + strings.Repeat("a", 2<<20) + `"}`},
+		}
+		for _, tt := range tests {
+			status, _, body := importUsers(t, s, tt.query, tt.contentType, tt.body)
+			if status != http.StatusBadRequest {
+				t.Errorf("%s: status = %d %s; want 400", tt.name, status, body)
+			}
+		}
+	})
+
+	t.Run("request size override", func(t *testing.T) {
+		s := testkit.NewServer(t, testkit.WithConfig(func(cfg *config.Config) {
+			cfg.Server.MaxRequestSize = 16
+			cfg.Server.MaxRequestSizeOverrides = []config.MaxRequestSizeOverride{{Route: "/users:import", MaxRequestSize: 128}}
+		}))
+
+		status, _, body := importUsers(t, s, "", "application/x-ndjson", `{"name":"bob","email":"bob@example.com"}`)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d %s; want 200 within the route limit", status, body)
+		}
+
+		// Content-Length を付けずに送り, 読み込み中に上限を超えさせる
+		req := httptest.NewRequest(http.MethodPost, testkit.BaseURL+"/users:import", io.MultiReader(strings.NewReader(strings.Repeat(`{"name":"bob","email":"bob@example.com"}`+"\n", 10))))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.ContentLength = -1
+		resp, err := s.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("status = %d; want 413 over the route limit", resp.StatusCode)
+		}
+	})
+}
+
+func TestE2E_ExportUsers(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+	bob := createUser(t, s, "bob", "bob@example.com")
+	alice := createUser(t, s, "alice", "alice@example.com")
+
+	t.Run("ndjson", func(t *testing.T) {
+		resp, err := s.Client.ExportUsersWithResponse(ctx, &openapi.ExportUsersParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode() != http.StatusOK || resp.HTTPResponse.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("status = %d %v; want 200 ndjson", resp.StatusCode(), resp.HTTPResponse.Header)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(resp.Body), "\n"), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("body = %s; want 2 lines", resp.Body)
+		}
+		var first openapi.User
+		if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first != alice {
+			t.Errorf("first line = %s; want %+v", lines[0], alice)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		format := openapi.Csv
+		resp, err := s.Client.ExportUsersWithResponse(ctx, &openapi.ExportUsersParams{Format: &format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "id,name,email\n" +
+			alice.Id.String() + ",alice,alice@example.com\n" +
+			bob.Id.String() + ",bob,bob@example.com\n"
+		if resp.StatusCode() != http.StatusOK || string(resp.Body) != want {
+			t.Errorf("GET /users:export?format=csv = %d %q; want %q", resp.StatusCode(), resp.Body, want)
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users:export?format=xml", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d; want 400", w.Code)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+// pkg/api/users_search.go
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// Search users
+// (GET /users:search)
+func (p *StrictServerImpl) SearchUsers(ctx context.Context, request openapi.SearchUsersRequestObject) (openapi.SearchUsersResponseObject, error) {
+
+	params := models.SearchUsersParams{
+		Query: request.Params.Q,
+	}
+	if request.Params.Limit != nil {
+		params.Limit = int(*request.Params.Limit)
+	}
+
+	items, err := p.opsHandler.SearchUsers(ctx, params)
+	if err != nil {
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to search users"),
+		)
+		return openapi.SearchUsers500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	}
+
+	retItems := make([]openapi.UserSearchResult, 0, len(items))
+	for _, item := range items {
+		retItems = append(retItems, openapi.UserSearchResult{
+			User: openapi.User{
+				Id:    item.User.ID,
+				Name:  item.User.Name,
+				Email: item.User.Email,
+			},
+			Rank: item.Rank,
+			Highlights: openapi.UserSearchHighlights{
+				Name:  PtrOrNil(item.Highlights.Name),
+				Email: PtrOrNil(item.Highlights.Email),
+			},
+		})
+	}
+
+	return openapi.SearchUsers200JSONResponse{
+		Results: retItems,
+	}, nil
+}
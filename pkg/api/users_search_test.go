@@ -0,0 +1,70 @@
+// pkg/api/users_search_test.go
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/testkit"
+)
+
+func TestE2E_SearchUsers(t *testing.T) {
+	ctx := context.Background()
+	s := testkit.NewServer(t)
+	john := createUser(t, s, "John <Doe>", "john.doe@example.com")
+	createUser(t, s, "Jane Roe", "jane@example.com")
+
+	t.Run("highlights", func(t *testing.T) {
+		resp, err := s.Client.SearchUsersWithResponse(ctx, &openapi.SearchUsersParams{Q: "JOHN"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSON200 == nil || len(resp.JSON200.Results) != 1 || resp.JSON200.Results[0].User != john {
+			t.Fatalf("GET /users:search = %d %s; want john", resp.StatusCode(), resp.Body)
+		}
+		highlights := resp.JSON200.Results[0].Highlights
+		if highlights.Name == nil || *highlights.Name != "<mark>John</mark> &lt;Doe&gt;" {
+			t.Errorf("highlights.name = %v; want escaped name with john marked", highlights.Name)
+		}
+		if highlights.Email == nil || *highlights.Email != "<mark>john</mark>.doe@example.com" {
+			t.Errorf("highlights.email = %v; want email with john marked", highlights.Email)
+		}
+	})
+
+	t.Run("typo", func(t *testing.T) {
+		resp, err := s.Client.SearchUsersWithResponse(ctx, &openapi.SearchUsersParams{Q: "Johnn"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSON200 == nil || len(resp.JSON200.Results) != 1 || resp.JSON200.Results[0].User.Id != john.Id {
+			t.Fatalf("GET /users:search = %d %s; want john", resp.StatusCode(), resp.Body)
+		}
+		// 似た語での一致は強調しない
+		if highlights := resp.JSON200.Results[0].Highlights; highlights.Name != nil || highlights.Email != nil {
+			t.Errorf("highlights = %+v; want none", highlights)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		limit := int32(1)
+		resp, err := s.Client.SearchUsersWithResponse(ctx, &openapi.SearchUsersParams{Q: "example.com", Limit: &limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSON200 == nil || len(resp.JSON200.Results) != 1 {
+			t.Fatalf("GET /users:search?limit=1 = %d %s; want 1 result", resp.StatusCode(), resp.Body)
+		}
+	})
+
+	t.Run("q is required", func(t *testing.T) {
+		resp, err := s.Client.SearchUsersWithResponse(ctx, &openapi.SearchUsersParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode() != http.StatusBadRequest {
+			t.Fatalf("GET /users:search = %d %s; want 400", resp.StatusCode(), resp.Body)
+		}
+	})
+}
@@ -0,0 +1,429 @@
+// pkg/api/webhooks.go
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// operations/db から返るエラーの判別用
+var (
+	errorCodeDBNotFound    = errorCodeOf(cerrors.ErrDBNotFound.New())
+	errorCodeDBDuplicate   = errorCodeOf(cerrors.ErrDBDuplicate.New())
+	errorCodeDBConstraint  = errorCodeOf(cerrors.ErrDBConstraint.New())
+	errorCodeInvalidState  = errorCodeOf(cerrors.ErrInvalidState.New())
+	errorCodeAuthorization = errorCodeOf(cerrors.ErrAuthorization.New())
+	errorCodeValidation    = errorCodeOf(cerrors.ErrValidation.New())
+)
+
+// List all webhooks
+// (GET /webhooks)
+func (p *StrictServerImpl) ListWebhooks(ctx context.Context, request openapi.ListWebhooksRequestObject) (openapi.ListWebhooksResponseObject, error) {
+
+	items, err := p.opsHandler.ListWebhooks(ctx)
+	if err != nil {
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to list webhooks"),
+		)
+		return openapi.ListWebhooks500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	}
+
+	retItems := []openapi.Webhook{}
+	for _, item := range items {
+		retItems = append(retItems, toAPIWebhook(item))
+	}
+
+	return openapi.ListWebhooks200JSONResponse{
+		Webhooks: retItems,
+	}, nil
+}
+
+// Register a new webhook
+// (POST /webhooks)
+func (p *StrictServerImpl) CreateWebhook(ctx context.Context, request openapi.CreateWebhookRequestObject) (openapi.CreateWebhookResponseObject, error) {
+
+	prototype := &models.WebhookPrototype{
+		URL:     request.Body.Url,
+		Secret:  request.Body.Secret,
+		Enabled: true,
+	}
+	if request.Body.Description != nil {
+		prototype.Description = *request.Body.Description
+	}
+	if request.Body.EventTypes != nil {
+		prototype.EventTypes = fromAPIWebhookEventTypes(*request.Body.EventTypes)
+	}
+	if request.Body.Enabled != nil {
+		prototype.Enabled = *request.Body.Enabled
+	}
+
+	webhook, err := p.opsHandler.CreateWebhook(ctx, prototype)
+	switch {
+	case errorCodeOf(err) == errorCodeValidation:
+		return openapi.CreateWebhook400JSONResponse(webhookURLProblem()), err
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create webhook"),
+		)
+		return openapi.CreateWebhook500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.CreateWebhook201JSONResponse{
+			Webhook: toAPIWebhook(webhook),
+		}, nil
+	}
+}
+
+// Get a webhook by ID
+// (GET /webhooks/{webhook_id})
+func (p *StrictServerImpl) GetWebhookById(ctx context.Context, request openapi.GetWebhookByIdRequestObject) (openapi.GetWebhookByIdResponseObject, error) {
+
+	webhookID, err := uuid.Parse(request.WebhookId)
+	if err != nil {
+		return openapi.GetWebhookById404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	}
+
+	webhook, err := p.opsHandler.GetWebhook(ctx, webhookID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.GetWebhookById404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to get webhook"),
+		)
+		return openapi.GetWebhookById500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.GetWebhookById200JSONResponse{
+			Webhook: toAPIWebhook(webhook),
+		}, nil
+	}
+}
+
+// Update a webhook by ID
+// (PATCH /webhooks/{webhook_id})
+func (p *StrictServerImpl) UpdateWebhookById(ctx context.Context, request openapi.UpdateWebhookByIdRequestObject) (openapi.UpdateWebhookByIdResponseObject, error) {
+
+	webhookID, err := uuid.Parse(request.WebhookId)
+	if err != nil {
+		return openapi.UpdateWebhookById404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	}
+
+	webhook, err := p.opsHandler.GetWebhook(ctx, webhookID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.UpdateWebhookById404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to get webhook"),
+		)
+		return openapi.UpdateWebhookById500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// nothing
+	}
+
+	prototype := &models.WebhookPrototype{
+		URL:         UpdateOrKeep(webhook.URL, request.Body.Url),
+		Description: webhook.Description,
+		EventTypes:  webhook.EventTypes,
+		Secret:      UpdateOrKeep(webhook.Secret, request.Body.Secret),
+		Enabled:     webhook.Enabled,
+	}
+	// 空文字/空配列/false も有効な値なので UpdateOrKeep は使わない
+	if request.Body.Description != nil {
+		prototype.Description = *request.Body.Description
+	}
+	if request.Body.EventTypes != nil {
+		prototype.EventTypes = fromAPIWebhookEventTypes(*request.Body.EventTypes)
+	}
+	if request.Body.Enabled != nil {
+		prototype.Enabled = *request.Body.Enabled
+	}
+
+	webhook, err = p.opsHandler.UpdateWebhook(ctx, webhookID, prototype)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.UpdateWebhookById404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	case errorCodeOf(err) == errorCodeValidation:
+		return openapi.UpdateWebhookById400JSONResponse(webhookURLProblem()), err
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to update webhook"),
+		)
+		return openapi.UpdateWebhookById500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.UpdateWebhookById200JSONResponse{
+			Webhook: toAPIWebhook(webhook),
+		}, nil
+	}
+}
+
+// Delete a webhook by ID
+// (DELETE /webhooks/{webhook_id})
+func (p *StrictServerImpl) DeleteWebhookById(ctx context.Context, request openapi.DeleteWebhookByIdRequestObject) (openapi.DeleteWebhookByIdResponseObject, error) {
+
+	webhookID, err := uuid.Parse(request.WebhookId)
+	if err != nil {
+		return openapi.DeleteWebhookById404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	}
+
+	err = p.opsHandler.DeleteWebhook(ctx, webhookID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.DeleteWebhookById404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to delete webhook"),
+		)
+		return openapi.DeleteWebhookById500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		return openapi.DeleteWebhookById204Response{}, nil
+	}
+}
+
+// List deliveries of a webhook
+// (GET /webhooks/{webhook_id}/deliveries)
+func (p *StrictServerImpl) ListWebhookDeliveries(ctx context.Context, request openapi.ListWebhookDeliveriesRequestObject) (openapi.ListWebhookDeliveriesResponseObject, error) {
+
+	webhookID, err := uuid.Parse(request.WebhookId)
+	if err != nil {
+		return openapi.ListWebhookDeliveries404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	}
+
+	params := models.ListWebhookDeliveriesParams{}
+	if request.Params.Limit != nil {
+		params.Limit = int(*request.Params.Limit)
+	}
+
+	items, err := p.opsHandler.ListWebhookDeliveries(ctx, webhookID, params)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.ListWebhookDeliveries404JSONResponse(notFoundProblem()), webhookNotFoundError(err)
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to list webhook deliveries"),
+		)
+		return openapi.ListWebhookDeliveries500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// nothing
+	}
+
+	retItems := []openapi.WebhookDelivery{}
+	for _, item := range items {
+		retItems = append(retItems, toAPIWebhookDelivery(item))
+	}
+
+	return openapi.ListWebhookDeliveries200JSONResponse{
+		Deliveries: retItems,
+	}, nil
+}
+
+// Get a delivery of a webhook by ID
+// (GET /webhooks/{webhook_id}/deliveries/{delivery_id})
+func (p *StrictServerImpl) GetWebhookDeliveryById(ctx context.Context, request openapi.GetWebhookDeliveryByIdRequestObject) (openapi.GetWebhookDeliveryByIdResponseObject, error) {
+
+	webhookID, err := uuid.Parse(request.WebhookId)
+	if err != nil {
+		return openapi.GetWebhookDeliveryById404JSONResponse(notFoundProblem()), webhookDeliveryNotFoundError(err)
+	}
+	deliveryID, err := uuid.Parse(request.DeliveryId)
+	if err != nil {
+		return openapi.GetWebhookDeliveryById404JSONResponse(notFoundProblem()), webhookDeliveryNotFoundError(err)
+	}
+
+	delivery, err := p.opsHandler.GetWebhookDelivery(ctx, webhookID, deliveryID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.GetWebhookDeliveryById404JSONResponse(notFoundProblem()), webhookDeliveryNotFoundError(err)
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to get webhook delivery"),
+		)
+		return openapi.GetWebhookDeliveryById500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.GetWebhookDeliveryById200JSONResponse{
+			Delivery: toAPIWebhookDelivery(delivery),
+		}, nil
+	}
+}
+
+// Redeliver a delivery of a webhook
+// (POST /webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver)
+func (p *StrictServerImpl) RedeliverWebhookDelivery(ctx context.Context, request openapi.RedeliverWebhookDeliveryRequestObject) (openapi.RedeliverWebhookDeliveryResponseObject, error) {
+
+	webhookID, err := uuid.Parse(request.WebhookId)
+	if err != nil {
+		return openapi.RedeliverWebhookDelivery404JSONResponse(notFoundProblem()), webhookDeliveryNotFoundError(err)
+	}
+	deliveryID, err := uuid.Parse(request.DeliveryId)
+	if err != nil {
+		return openapi.RedeliverWebhookDelivery404JSONResponse(notFoundProblem()), webhookDeliveryNotFoundError(err)
+	}
+
+	delivery, err := p.opsHandler.RedeliverWebhookDelivery(ctx, webhookID, deliveryID)
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return openapi.RedeliverWebhookDelivery404JSONResponse(notFoundProblem()), webhookDeliveryNotFoundError(err)
+	case errorCodeOf(err) == errorCodeInvalidState:
+		return openapi.RedeliverWebhookDelivery409JSONResponse{
+			Type:   PtrOrNil("/conflict"),
+			Title:  PtrOrNil(http.StatusText(409)),
+			Status: PtrOrNil(int32(409)),
+			Detail: PtrOrNil("the webhook is disabled. enable it before redelivering"),
+		}, err
+	case err != nil:
+		cerr := cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to redeliver webhook delivery"),
+		)
+		return openapi.RedeliverWebhookDelivery500JSONResponse{
+			Type:   PtrOrNil("/internal_server_error"),
+			Title:  PtrOrNil(http.StatusText(500)),
+			Status: PtrOrNil(int32(500)),
+		}, cerr
+	default:
+		// 正常
+		return openapi.RedeliverWebhookDelivery202JSONResponse{
+			Delivery: toAPIWebhookDelivery(delivery),
+		}, nil
+	}
+}
+
+func notFoundProblem() openapi.ProblemDetails {
+	return openapi.ProblemDetails{
+		Type:   PtrOrNil("/resource_not_found"),
+		Title:  PtrOrNil(http.StatusText(404)),
+		Status: PtrOrNil(int32(404)),
+	}
+}
+
+func webhookURLProblem() openapi.ProblemDetails {
+	return openapi.ProblemDetails{
+		Type:   PtrOrNil("/bad_request"),
+		Title:  PtrOrNil(http.StatusText(400)),
+		Status: PtrOrNil(int32(400)),
+		Detail: PtrOrNil("url must be an https url of a public host"),
+	}
+}
+
+func webhookNotFoundError(err error) error {
+	return cerrors.ErrDBNotFound.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("webhook not found"),
+	)
+}
+
+func webhookDeliveryNotFoundError(err error) error {
+	return cerrors.ErrDBNotFound.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("webhook delivery not found"),
+	)
+}
+
+// toAPIWebhook は models.Webhook を API の表現に変換する. secret は含めない
+func toAPIWebhook(webhook *models.Webhook) openapi.Webhook {
+	eventTypes := []openapi.WebhookEventType{}
+	for _, t := range webhook.EventTypes {
+		eventTypes = append(eventTypes, openapi.WebhookEventType(t))
+	}
+	return openapi.Webhook{
+		Id:                  webhook.ID,
+		Url:                 webhook.URL,
+		Description:         webhook.Description,
+		EventTypes:          eventTypes,
+		Enabled:             webhook.Enabled,
+		ConsecutiveFailures: int32(webhook.ConsecutiveFailures),
+		DisabledReason:      PtrOrNil(webhook.DisabledReason),
+		CreatedAt:           webhook.CreatedAt,
+		UpdatedAt:           webhook.UpdatedAt,
+	}
+}
+
+func toAPIWebhookDelivery(delivery *models.WebhookDelivery) openapi.WebhookDelivery {
+	ret := openapi.WebhookDelivery{
+		Id:               delivery.ID,
+		WebhookId:        delivery.WebhookID,
+		EventId:          delivery.EventID,
+		EventType:        string(delivery.EventType),
+		Status:           openapi.WebhookDeliveryStatus(delivery.Status),
+		Attempts:         int32(delivery.Attempts),
+		NextAttemptAt:    delivery.NextAttemptAt,
+		LastResponseCode: PtrOrNil(int32(delivery.LastResponseCode)),
+		LastError:        PtrOrNil(delivery.LastError),
+		CreatedAt:        delivery.CreatedAt,
+		UpdatedAt:        delivery.UpdatedAt,
+	}
+	if !delivery.DeliveredAt.IsZero() {
+		ret.DeliveredAt = Ptr(delivery.DeliveredAt)
+	}
+	if delivery.AttemptLog != nil {
+		attemptLog := []openapi.WebhookDeliveryAttempt{}
+		for _, attempt := range delivery.AttemptLog {
+			attemptLog = append(attemptLog, openapi.WebhookDeliveryAttempt{
+				Attempt:      int32(attempt.Attempt),
+				ResponseCode: PtrOrNil(int32(attempt.ResponseCode)),
+				Error:        PtrOrNil(attempt.Error),
+				DurationMs:   attempt.Duration.Milliseconds(),
+				AttemptedAt:  attempt.AttemptedAt,
+			})
+		}
+		ret.AttemptLog = &attemptLog
+	}
+	return ret
+}
+
+func fromAPIWebhookEventTypes(eventTypes []openapi.WebhookEventType) []models.EventType {
+	ret := []models.EventType{}
+	for _, t := range eventTypes {
+		ret = append(ret, models.EventType(t))
+	}
+	return ret
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// Request は監査ログに記録するリクエストの情報
+type Request struct {
+	ClientIP  string
+	UserAgent string
+}
+
+type requestKey struct{}
+
+type actorKey struct{}
+
+// NewContextWithRequest は ctx にリクエストの情報を紐付けた context を返す
+func NewContextWithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFromContext は ctx に紐付けられたリクエストの情報を返す. 紐付けられていない場合は false を返す
+func RequestFromContext(ctx context.Context) (Request, bool) {
+	request, ok := ctx.Value(requestKey{}).(Request)
+	return request, ok
+}
+
+// NewContextWithActor は ctx に変更を行う主体を紐付けた context を返す. 認証ミドルウェアから呼ぶことを想定
+func NewContextWithActor(ctx context.Context, actor models.AuditActor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext は ctx に紐付けられた主体を返す
+// 紐付けられていない場合, リクエストの処理中であれば anonymous, それ以外 (worker のジョブ等) は system を返す
+func ActorFromContext(ctx context.Context) models.AuditActor {
+	if actor, ok := ctx.Value(actorKey{}).(models.AuditActor); ok {
+		return actor
+	}
+	if _, ok := RequestFromContext(ctx); ok {
+		return models.AuditActor{Type: models.AuditActorTypeAnonymous}
+	}
+	return models.AuditActor{Type: models.AuditActorTypeSystem}
+}
@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// TargetTypeUser はユーザーに対する操作の target_type
+const TargetTypeUser = "user"
+
+// userState は監査ログに記録するユーザーの項目
+type userState struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// New は監査ログを生成する. ctx の主体, リクエストID, trace ID, リクエストの情報を記録する
+// before, after は JSON オブジェクトに変換できる値で, 作成の場合 before, 削除の場合 after は nil を渡す
+// 更新の場合は変更された項目のみを記録する
+func New(ctx context.Context, action models.AuditAction, targetType string, targetID uuid.UUID, before any, after any) (*models.AuditEvent, error) {
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to generate audit event id"),
+		)
+	}
+
+	beforeDiff, afterDiff, err := diff(before, after)
+	if err != nil {
+		return nil, cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("failed to marshal audit state of %s %s", targetType, targetID),
+		)
+	}
+
+	event := &models.AuditEvent{
+		ID:         id,
+		Action:     action,
+		Actor:      ActorFromContext(ctx),
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     beforeDiff,
+		After:      afterDiff,
+		RequestID:  logging.RequestIDFromContext(ctx),
+		OccurredAt: time.Now().UTC(),
+	}
+	if spanCtx := oteltrace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		event.TraceID = spanCtx.TraceID().String()
+	}
+	if request, ok := RequestFromContext(ctx); ok {
+		event.ClientIP = request.ClientIP
+		event.UserAgent = request.UserAgent
+	}
+	return event, nil
+}
+
+// NewUserEvent はユーザーに対する操作の監査ログを生成する. 作成の場合 before, 削除の場合 after は nil を渡す
+func NewUserEvent(ctx context.Context, action models.AuditAction, before *models.User, after *models.User) (*models.AuditEvent, error) {
+
+	var targetID uuid.UUID
+	var beforeState, afterState any
+	if before != nil {
+		targetID = before.ID
+		beforeState = userState{Name: before.Name, Email: before.Email}
+	}
+	if after != nil {
+		targetID = after.ID
+		afterState = userState{Name: after.Name, Email: after.Email}
+	}
+	return New(ctx, action, TargetTypeUser, targetID, beforeState, afterState)
+}
+
+// diff は before, after を JSON オブジェクトに変換し, 両方ある場合は値が異なる項目のみを残して返す
+func diff(before any, after any) (json.RawMessage, json.RawMessage, error) {
+
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if beforeFields != nil && afterFields != nil {
+		for key, value := range beforeFields {
+			if other, ok := afterFields[key]; ok && bytes.Equal(value, other) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	beforeDiff, err := fromFields(beforeFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterDiff, err := fromFields(afterFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beforeDiff, afterDiff, nil
+}
+
+func toFields(v any) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func fromFields(fields map[string]json.RawMessage) (json.RawMessage, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+func TestNewUserEvent_Diff(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.Must(uuid.NewV7())
+	bob := &models.User{ID: id, Name: "bob", Email: "bob@example.com"}
+	robert := &models.User{ID: id, Name: "robert", Email: "bob@example.com"}
+
+	tests := []struct {
+		name       string
+		action     models.AuditAction
+		before     *models.User
+		after      *models.User
+		wantBefore string
+		wantAfter  string
+	}{
+		{"create", models.AuditActionCreate, nil, bob, "", `{"email":"bob@example.com","name":"bob"}`},
+		{"update", models.AuditActionUpdate, bob, robert, `{"name":"bob"}`, `{"name":"robert"}`},
+		{"update without changes", models.AuditActionUpdate, bob, bob, `{}`, `{}`},
+		{"delete", models.AuditActionDelete, robert, nil, `{"email":"bob@example.com","name":"robert"}`, ""},
+	}
+	for _, tt := range tests {
+		event, err := NewUserEvent(ctx, tt.action, tt.before, tt.after)
+		if err != nil {
+			t.Fatalf("%s: NewUserEvent() error = %v", tt.name, err)
+		}
+		if string(event.Before) != tt.wantBefore || string(event.After) != tt.wantAfter {
+			t.Errorf("%s: before, after = %s, %s; want %s, %s", tt.name, event.Before, event.After, tt.wantBefore, tt.wantAfter)
+		}
+		if event.TargetType != TargetTypeUser || event.TargetID != id {
+			t.Errorf("%s: target = %s %s; want user %s", tt.name, event.TargetType, event.TargetID, id)
+		}
+	}
+}
+
+func TestNew_Context(t *testing.T) {
+	id := uuid.Must(uuid.NewV7())
+
+	// リクエストによらない操作は system
+	event, err := New(context.Background(), models.AuditActionCreate, TargetTypeUser, id, nil, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Actor.Type != models.AuditActorTypeSystem {
+		t.Errorf("actor = %+v; want system", event.Actor)
+	}
+
+	// 認証されていないリクエストは anonymous
+	ctx := logging.NewContextWithRequestID(context.Background(), "req-1")
+	ctx = NewContextWithRequest(ctx, Request{ClientIP: "203.0.113.10", UserAgent: "test"})
+	event, err = New(ctx, models.AuditActionCreate, TargetTypeUser, id, nil, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Actor.Type != models.AuditActorTypeAnonymous || event.RequestID != "req-1" || event.ClientIP != "203.0.113.10" || event.UserAgent != "test" {
+		t.Errorf("event = %+v; want anonymous with the request", event)
+	}
+
+	ctx = NewContextWithActor(ctx, models.AuditActor{Type: models.AuditActorTypeOIDC, ID: "subject-1"})
+	event, err = New(ctx, models.AuditActionCreate, TargetTypeUser, id, nil, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Actor != (models.AuditActor{Type: models.AuditActorTypeOIDC, ID: "subject-1"}) {
+		t.Errorf("actor = %+v; want oidc subject-1", event.Actor)
+	}
+}
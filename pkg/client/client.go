@@ -0,0 +1,140 @@
+// pkg/client/client.go
+
+// Package client は API のクライアント (SDK)
+//
+// client.gen.go は OpenAPI の定義から oapi-codegen で生成する (go generate ./pkg/client/).
+// New で生成する APIClient は生成されたクライアントに以下を加える
+//   - 接続エラーと 429/502/503/504 の再試行 (Retry-After に従う. POST/PATCH は再試行しない)
+//   - OpenTelemetry の trace context の伝播
+//   - アクセストークン (Authorization: Bearer) の付与
+//   - エラーレスポンス (problem details) の *ProblemError への変換
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// APIClient は API のクライアント. 4xx/5xx のレスポンスは *ProblemError として返す
+type APIClient struct {
+	*ClientWithResponses
+}
+
+type apiClientOptions struct {
+	transport   http.RoundTripper
+	timeout     time.Duration
+	retryPolicy RetryPolicy
+	tokenSource TokenSource
+	userAgent   string
+}
+
+type Option func(*apiClientOptions)
+
+// WithTransport は送信に使う http.RoundTripper を指定する. 既定では http.DefaultTransport
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *apiClientOptions) {
+		o.transport = transport
+	}
+}
+
+// WithTimeout は 1 回の呼び出し (再試行を含む) のタイムアウトを指定する. 0 の場合はタイムアウトしない (既定)
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *apiClientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetryPolicy は再試行の設定を指定する. 既定は DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *apiClientOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithTokenSource はリクエストに付けるアクセストークンを指定する
+func WithTokenSource(source TokenSource) Option {
+	return func(o *apiClientOptions) {
+		o.tokenSource = source
+	}
+}
+
+// WithUserAgent は User-Agent を指定する
+func WithUserAgent(userAgent string) Option {
+	return func(o *apiClientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+func New(baseURL string, options ...Option) (*APIClient, error) {
+
+	opts := &apiClientOptions{
+		retryPolicy: DefaultRetryPolicy,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.retryPolicy.MaxAttempts < 1 || opts.retryPolicy.InitialBackoff < 0 || opts.retryPolicy.MaxBackoff < opts.retryPolicy.InitialBackoff {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid retry policy: max_attempts=%d, initial_backoff=%s, max_backoff=%s",
+				opts.retryPolicy.MaxAttempts, opts.retryPolicy.InitialBackoff, opts.retryPolicy.MaxBackoff),
+		)
+	}
+
+	// 再試行 -> 認証 -> トレース -> 送信 の順に通る. 送信毎にトークンを取り直し, span を作る
+	transport := opts.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	transport = &tracingTransport{next: transport, tracer: otel.Tracer(instrumentationName)}
+	if opts.tokenSource != nil {
+		transport = &authTransport{next: transport, source: opts.tokenSource}
+	}
+	transport = &retryTransport{next: transport, policy: opts.retryPolicy}
+
+	doer := &problemDoer{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.timeout,
+		},
+	}
+
+	genOptions := []ClientOption{WithHTTPClient(doer)}
+	if opts.userAgent != "" {
+		userAgent := opts.userAgent
+		genOptions = append(genOptions, WithRequestEditorFn(func(_ context.Context, req *http.Request) error {
+			req.Header.Set("User-Agent", userAgent)
+			return nil
+		}))
+	}
+
+	c, err := NewClientWithResponses(baseURL, genOptions...)
+	if err != nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("invalid base url: %s", baseURL),
+		)
+	}
+	return &APIClient{ClientWithResponses: c}, nil
+}
+
+// problemDoer は 4xx/5xx のレスポンスを *ProblemError に変換する
+type problemDoer struct {
+	client *http.Client
+}
+
+func (d *problemDoer) Do(req *http.Request) (*http.Response, error) {
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, newProblemError(req, resp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,265 @@
+// pkg/client/client_test.go
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/testkit"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// routerTransport は testkit のルーターでリクエストを処理する. レスポンスは OpenAPI の定義と照合される
+func routerTransport(s *testkit.Server) http.RoundTripper {
+	return roundTripperFunc(s.Do)
+}
+
+// noWait は待たずに再試行する
+var noWait = RetryPolicy{MaxAttempts: 3, InitialBackoff: 0, MaxBackoff: time.Second}
+
+func newClient(t *testing.T, transport http.RoundTripper, options ...Option) *APIClient {
+	t.Helper()
+
+	c, err := New(testkit.BaseURL, append([]Option{WithTransport(transport), WithRetryPolicy(noWait)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func codeOf(err error) string {
+	var cerr *cerrors.CustomError
+	if errors.As(err, &cerr) {
+		return cerr.Code()
+	}
+	return ""
+}
+
+func TestAPIClient_Users(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, routerTransport(testkit.NewServer(t)))
+
+	created, err := c.CreateUserWithResponse(ctx, CreateUserJSONRequestBody{Name: "alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.JSON201 == nil {
+		t.Fatalf("POST /users status = %d; want 201", created.StatusCode())
+	}
+
+	got, err := c.GetUserByIdWithResponse(ctx, created.JSON201.User.Id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.JSON200 == nil || got.JSON200.User.Email != "alice@example.com" {
+		t.Fatalf("GET /users/{id} = %d %s; want alice", got.StatusCode(), got.Body)
+	}
+}
+
+func TestAPIClient_ProblemError(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, routerTransport(testkit.NewServer(t)))
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := c.GetUserByIdWithResponse(ctx, "0197b0c8-0000-7000-8000-000000000000")
+
+		var pe *ProblemError
+		if !errors.As(err, &pe) {
+			t.Fatalf("error = %v; want *ProblemError", err)
+		}
+		if pe.StatusCode != http.StatusNotFound || pe.Problem.Title == nil || *pe.Problem.Title != "Not Found" {
+			t.Errorf("ProblemError = %+v; want 404 problem details", pe)
+		}
+		if code := codeOf(err); code != codeOf(cerrors.ErrResourceNotFound.New()) {
+			t.Errorf("cerrors code = %q; want RESOURCE_NOT_FOUND", code)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := c.CreateUserWithBodyWithResponse(ctx, "application/json", strings.NewReader(`{"name":"","email":"not-an-email"}`))
+
+		var pe *ProblemError
+		if !errors.As(err, &pe) {
+			t.Fatalf("error = %v; want *ProblemError", err)
+		}
+		if len(pe.InvalidParams()) != 2 {
+			t.Errorf("InvalidParams() = %+v; want email and name", pe.InvalidParams())
+		}
+		if code := codeOf(err); code != codeOf(cerrors.ErrValidation.New()) {
+			t.Errorf("cerrors code = %q; want VALIDATION", code)
+		}
+	})
+}
+
+func TestAPIClient_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	// 最初の failures 回は 503 を返し, その後はルーターで処理する
+	newFlakyTransport := func(s *testkit.Server, failures int32, calls *atomic.Int32) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if calls.Add(1) <= failures {
+				w := httptest.NewRecorder()
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return w.Result(), nil
+			}
+			return s.Do(req)
+		})
+	}
+
+	t.Run("get is retried", func(t *testing.T) {
+		var calls atomic.Int32
+		c := newClient(t, newFlakyTransport(testkit.NewServer(t), 2, &calls))
+
+		resp, err := c.ListUsersWithResponse(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSON200 == nil || calls.Load() != 3 {
+			t.Errorf("status = %d after %d calls; want 200 after 3 calls", resp.StatusCode(), calls.Load())
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		var calls atomic.Int32
+		c := newClient(t, newFlakyTransport(testkit.NewServer(t), 10, &calls))
+
+		_, err := c.ListUsersWithResponse(ctx)
+		var pe *ProblemError
+		if !errors.As(err, &pe) || pe.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("error = %v; want 503 *ProblemError", err)
+		}
+		if calls.Load() != 3 {
+			t.Errorf("calls = %d; want 3", calls.Load())
+		}
+	})
+
+	t.Run("post is not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		c := newClient(t, newFlakyTransport(testkit.NewServer(t), 1, &calls))
+
+		_, err := c.CreateUserWithResponse(ctx, CreateUserJSONRequestBody{Name: "alice", Email: "alice@example.com"})
+		if err == nil || calls.Load() != 1 {
+			t.Errorf("error = %v after %d calls; want 503 after 1 call", err, calls.Load())
+		}
+	})
+
+	t.Run("post with idempotency-key header is not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		c := newClient(t, newFlakyTransport(testkit.NewServer(t), 1, &calls))
+
+		setKey := func(_ context.Context, req *http.Request) error {
+			req.Header.Set("Idempotency-Key", "key-1")
+			return nil
+		}
+		_, err := c.CreateUserWithResponse(ctx, CreateUserJSONRequestBody{Name: "alice", Email: "alice@example.com"}, setKey)
+		if err == nil || calls.Load() != 1 {
+			t.Errorf("error = %v after %d calls; want 503 after 1 call", err, calls.Load())
+		}
+	})
+
+	t.Run("retry-after longer than max backoff", func(t *testing.T) {
+		var calls atomic.Int32
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			w := httptest.NewRecorder()
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return w.Result(), nil
+		})
+		c := newClient(t, transport)
+
+		_, err := c.ListUsersWithResponse(ctx)
+		if code := codeOf(err); code != codeOf(cerrors.ErrRateLimit.New()) || calls.Load() != 1 {
+			t.Errorf("error = %v after %d calls; want RATE_LIMIT after 1 call", err, calls.Load())
+		}
+	})
+}
+
+func TestAPIClient_Headers(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tp := sdktrace.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	s := testkit.NewServer(t)
+	var tokens atomic.Int32
+	var got []http.Header
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		got = append(got, req.Header.Clone())
+		if len(got) == 1 {
+			w := httptest.NewRecorder()
+			w.WriteHeader(http.StatusBadGateway)
+			return w.Result(), nil
+		}
+		return s.Do(req)
+	})
+	c := newClient(t, transport,
+		WithUserAgent("client-test"),
+		// 送信毎に取り直す
+		WithTokenSource(TokenSourceFunc(func(context.Context) (string, error) {
+			return "token-" + strconv.Itoa(int(tokens.Add(1))), nil
+		})),
+	)
+
+	if _, err := c.ListUsersWithResponse(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("calls = %d; want 2", len(got))
+	}
+	for i, header := range got {
+		if want := "Bearer token-" + strconv.Itoa(i+1); header.Get("Authorization") != want {
+			t.Errorf("call %d: Authorization = %q; want %q", i+1, header.Get("Authorization"), want)
+		}
+		if header.Get("Traceparent") == "" {
+			t.Errorf("call %d: traceparent is missing", i+1)
+		}
+		if header.Get("User-Agent") != "client-test" {
+			t.Errorf("call %d: User-Agent = %q; want client-test", i+1, header.Get("User-Agent"))
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"Mon, 01 Jan 2001 00:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestNew_InvalidRetryPolicy(t *testing.T) {
+	if _, err := New(testkit.BaseURL, WithRetryPolicy(RetryPolicy{MaxAttempts: 0})); err == nil {
+		t.Error("New() error = nil; want error for max_attempts 0")
+	}
+}
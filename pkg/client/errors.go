@@ -0,0 +1,126 @@
+// pkg/client/errors.go
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// 読み込むエラーレスポンスの本文の最大長
+const maxErrorBodySize = 64 << 10
+
+// ProblemError は API がエラー (4xx/5xx) を返したことを表す
+// 本文が problem details (RFC 7807) でない場合も, ステータスコードから Problem を組み立てる
+//
+// errors.As で *cerrors.CustomError を取り出すと, ステータスコードに対応する種別 (Code) を参照できる
+//
+//	var pe *client.ProblemError
+//	if errors.As(err, &pe) && pe.StatusCode == http.StatusNotFound { ... }
+type ProblemError struct {
+	StatusCode int
+	Problem    ProblemDetails
+
+	// リクエストの送信先
+	Method string
+	URL    string
+
+	cause error
+}
+
+func (e *ProblemError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Problem.Detail != nil && *e.Problem.Detail != "" {
+		msg += ": " + *e.Problem.Detail
+	}
+	return msg
+}
+
+// Unwrap はステータスコードに対応する cerrors の種別のエラーを返す
+func (e *ProblemError) Unwrap() error {
+	return e.cause
+}
+
+// InvalidParams は入力の誤りの一覧を返す. 無い場合は nil
+func (e *ProblemError) InvalidParams() []InvalidParam {
+	if e.Problem.InvalidParams == nil {
+		return nil
+	}
+	return *e.Problem.InvalidParams
+}
+
+// newProblemError はエラーレスポンスの本文を読み込み ProblemError を生成する. resp.Body は閉じる
+func newProblemError(req *http.Request, resp *http.Response) *ProblemError {
+	defer resp.Body.Close()
+
+	e := &ProblemError{
+		StatusCode: resp.StatusCode,
+		Method:     req.Method,
+		URL:        req.URL.Redacted(),
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err == nil && isJSON(resp.Header.Get("Content-Type")) {
+		_ = json.Unmarshal(body, &e.Problem)
+	}
+	if e.Problem.Status == nil {
+		status := int32(resp.StatusCode)
+		e.Problem.Status = &status
+	}
+	if e.Problem.Title == nil {
+		title := http.StatusText(resp.StatusCode)
+		e.Problem.Title = &title
+	}
+
+	detail := "api returned an error response"
+	if e.Problem.Detail != nil && *e.Problem.Detail != "" {
+		detail = *e.Problem.Detail
+	}
+	e.cause = newErrorFor(resp.StatusCode, e.InvalidParams() != nil)(
+		cerrors.WithMessagef("%s %s: %d", e.Method, e.URL, e.StatusCode),
+		cerrors.WithMessage(detail),
+	)
+	return e
+}
+
+// newErrorFor はステータスコードに対応する cerrors の種別のコンストラクタを返す. サーバー (pkg/api) での対応付けの逆
+func newErrorFor(status int, hasInvalidParams bool) func(options ...cerrors.Option) error {
+	switch {
+	case status == http.StatusBadRequest && hasInvalidParams:
+		return cerrors.ErrValidation.New
+	case status == http.StatusBadRequest:
+		return cerrors.ErrAPIRequest.New
+	case status == http.StatusUnauthorized:
+		return cerrors.ErrAuthentication.New
+	case status == http.StatusForbidden:
+		return cerrors.ErrAuthorization.New
+	case status == http.StatusNotFound:
+		return cerrors.ErrResourceNotFound.New
+	case status == http.StatusConflict:
+		return cerrors.ErrInvalidState.New
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return cerrors.ErrTimeout.New
+	case status == http.StatusRequestEntityTooLarge:
+		return cerrors.ErrResourceExhausted.New
+	case status == http.StatusTooManyRequests:
+		return cerrors.ErrRateLimit.New
+	case status == http.StatusServiceUnavailable, status == http.StatusBadGateway:
+		return cerrors.ErrServiceUnavailable.New
+	case status >= 500:
+		return cerrors.ErrAPIResponse.New
+	default:
+		return cerrors.ErrAPIRequest.New
+	}
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "application/problem+json"
+}
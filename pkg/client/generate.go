@@ -0,0 +1,4 @@
+// pkg/client/generate.go
+package client
+
+//go:generate oapi-codegen -config oapi-codegen.yaml ../../.openapi/openapi.yaml
@@ -2,6 +2,7 @@
 package config
 
 type Config struct {
+	App        App        `mapstructure:"app"         json:"app"         yaml:"app"`
 	Server     Server     `mapstructure:"server"      json:"server"      yaml:"server"      validate:"required"`
 	Postgres   Postgres   `mapstructure:"postgres"    json:"postgres"    yaml:"postgres"    validate:"required"`
 	Valkey     Valkey     `mapstructure:"valkey"      json:"valkey"      yaml:"valkey"`
@@ -10,12 +11,28 @@ type Config struct {
 	OTLPLog    OTLPLog    `mapstructure:"otlp_log"    json:"otlp_log"    yaml:"otlp_log"`
 	Prometheus Prometheus `mapstructure:"prometheus"  json:"prometheus"  yaml:"prometheus"`
 	Pyroscope  Pyroscope  `mapstructure:"pyroscope"   json:"pyroscope"   yaml:"pyroscope"`
+	Outbox     Outbox     `mapstructure:"outbox"      json:"outbox"      yaml:"outbox"`
+	Webhooks   Webhooks   `mapstructure:"webhooks"    json:"webhooks"    yaml:"webhooks"`
+	Jobs       Jobs       `mapstructure:"jobs"        json:"jobs"        yaml:"jobs"`
+	Audit      Audit      `mapstructure:"audit"       json:"audit"       yaml:"audit"`
+	UserCache  UserCache  `mapstructure:"user_cache"  json:"user_cache"  yaml:"user_cache"`
+	OpenAPI    OpenAPI    `mapstructure:"openapi"     json:"openapi"     yaml:"openapi"`
+	Tenancy    Tenancy    `mapstructure:"tenancy"     json:"tenancy"     yaml:"tenancy"`
+	APIKeys    APIKeys    `mapstructure:"api_keys"    json:"api_keys"    yaml:"api_keys"`
+	Session    Session    `mapstructure:"session"     json:"session"     yaml:"session"`
+	Resilience Resilience `mapstructure:"resilience"  json:"resilience"  yaml:"resilience"`
+}
+
+type App struct {
+	// デプロイ環境名 (production, staging 等). OpenTelemetry の resource 属性 deployment.environment に使う
+	Environment string `mapstructure:"environment" json:"environment" yaml:"environment" validate:"omitempty,printascii"`
 }
 
 type Server struct {
 	Host string `mapstructure:"host" json:"host" yaml:"host" validate:"required,hostname|ip"`
 	Port uint   `mapstructure:"port" json:"port" yaml:"port" validate:"required,gt=0,lte=65535"`
 	CORS CORS   `mapstructure:"cors" json:"cors" yaml:"cors"`
+	CSRF CSRF   `mapstructure:"csrf" json:"csrf" yaml:"csrf"`
 	OIDC OIDC   `mapstructure:"oidc" json:"oidc" yaml:"oidc"`
 
 	RateLimit RateLimit `mapstructure:"rate_limit" json:"rate_limit" yaml:"rate_limit"`
@@ -35,10 +52,48 @@ type Server struct {
 	// リクエストボディサイズ制限
 	MaxRequestSize int64 `mapstructure:"max_request_size" json:"max_request_size" yaml:"max_request_size"`
 
+	// ルート毎のリクエストボディサイズ制限 (max_request_size より優先する)
+	MaxRequestSizeOverrides []MaxRequestSizeOverride `mapstructure:"max_request_size_overrides" json:"max_request_size_overrides" yaml:"max_request_size_overrides" validate:"omitempty,dive"`
+
+	// 操作 (operationId) ごとのリクエストの処理時間の上限
+	RequestTimeout RequestTimeout `mapstructure:"request_timeout" json:"request_timeout" yaml:"request_timeout"`
+
 	// カスタムヘッダ挿入 (セキュリティ関連のヘッダなど)
 	CustomHeaders []CustomHeader `mapstructure:"custom_headers" json:"custom_headers" yaml:"custom_headers" validate:"omitempty,dive"`
 }
 
+// RequestTimeout はリクエストの処理時間の上限. 上限は context の deadline として PostgreSQL や Valkey の呼び出しにも渡し, 超えた場合は 504 を返す
+// 上限が read_timeout_seconds / write_timeout_seconds より長い操作は, その分だけ接続の読み書きの期限も延ばす
+type RequestTimeout struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// 既定の上限. 504 を書き出せるよう write_timeout_seconds より短くする. 0 の場合は制限しない
+	DefaultSeconds uint64 `mapstructure:"default_seconds" json:"default_seconds" yaml:"default_seconds" validate:"gte=0"`
+
+	// 操作毎の上限 (default_seconds より優先する)
+	Overrides []RequestTimeoutOverride `mapstructure:"overrides" json:"overrides" yaml:"overrides" validate:"omitempty,dive"`
+
+	// クライアントが Request-Timeout ヘッダ (秒) で上限を短くすることを許す. 0 の場合はヘッダを使わない
+	// 操作の上限より長い指定は使わない. 操作に上限が無い場合は, ヘッダの指定をこの秒数までに制限して使う
+	MaxClientSeconds uint64 `mapstructure:"max_client_seconds" json:"max_client_seconds" yaml:"max_client_seconds" validate:"gte=0"`
+}
+
+type RequestTimeoutOverride struct {
+	// OpenAPI の operationId (export_users 等)
+	OperationID string `mapstructure:"operation_id" json:"operation_id" yaml:"operation_id" validate:"required"`
+
+	// 0 の場合は制限しない
+	Seconds uint64 `mapstructure:"seconds" json:"seconds" yaml:"seconds" validate:"gte=0"`
+}
+
+type MaxRequestSizeOverride struct {
+	// ルートのテンプレート (/users:import 等)
+	Route string `mapstructure:"route" json:"route" yaml:"route" validate:"required"`
+
+	// 0 以下の場合は制限しない
+	MaxRequestSize int64 `mapstructure:"max_request_size" json:"max_request_size" yaml:"max_request_size"`
+}
+
 type CustomHeader struct {
 	Enabled  bool   `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
 	Name     string `mapstructure:"name"    json:"name"    yaml:"name"    validate:"required_if=Enabled true"`
@@ -78,6 +133,16 @@ type CORS struct {
 	MaxAgeHour int32 `mapstructure:"max_age_hour" json:"max_age_hour" yaml:"max_age_hour" validate:"gte=0,lte=24"`
 }
 
+// CSRF はセッション (Cookie) で認証したリクエストの CSRF 対策の設定
+// API キーや Bearer トークンで認証した (主体を検証できた) リクエストは対象外
+// Authorization ヘッダ (Bearer トークン) や API キーのリクエストは対象外
+type CSRF struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// トークンを受け取るヘッダ. CORS を使う場合は cors.allow_headers にも加えること
+	HeaderName string `mapstructure:"header_name" json:"header_name" yaml:"header_name" validate:"required_if=Enabled true,omitempty,printascii"`
+}
+
 type OIDC struct {
 	// https://www.keycloak.org/securing-apps/oidc-layers
 	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
@@ -122,6 +187,23 @@ type Postgres struct {
 	MaxConns                 int32  `mapstructure:"max_conns"                   json:"max_conns"                   yaml:"max_conns"                   validate:"gte=1,gtfield=MinConns"`
 	MaxConnLifetimeSeconds   uint64 `mapstructure:"max_conn_lifetime_seconds"   json:"max_conn_lifetime_seconds"   yaml:"max_conn_lifetime_seconds"   validate:"-"`
 	HealthCheckPeriodSeconds uint64 `mapstructure:"health_check_period_seconds" json:"health_check_period_seconds" yaml:"health_check_period_seconds" validate:"-"`
+
+	// この時間を超えたクエリをスロークエリとしてログに出す (引数は伏せ字). 0 の場合は出さない
+	SlowQueryThresholdMilliseconds uint64 `mapstructure:"slow_query_threshold_milliseconds" json:"slow_query_threshold_milliseconds" yaml:"slow_query_threshold_milliseconds" validate:"gte=0"`
+
+	// 読み取り専用の操作を振り分けるレプリカ. User/Password/Database/SslMode 等はプライマリと共通
+	Replicas []PostgresReplica `mapstructure:"replicas" json:"replicas" yaml:"replicas" validate:"omitempty,dive"`
+
+	// 異常と判定したレプリカの復帰を確認する間隔
+	ReplicaHealthCheckIntervalSeconds uint64 `mapstructure:"replica_health_check_interval_seconds" json:"replica_health_check_interval_seconds" yaml:"replica_health_check_interval_seconds" validate:"required_with=Replicas,omitempty,gt=0"`
+
+	// 書き込み後, 同じセッションの読み取りをプライマリで行う期間 (read-your-writes). 0 の場合は同じリクエスト内のみ
+	ReadYourWritesWindowSeconds uint64 `mapstructure:"read_your_writes_window_seconds" json:"read_your_writes_window_seconds" yaml:"read_your_writes_window_seconds" validate:"gte=0"`
+}
+
+type PostgresReplica struct {
+	Host string `mapstructure:"host" json:"host" yaml:"host" validate:"required,hostname|ip"`
+	Port uint   `mapstructure:"port" json:"port" yaml:"port" validate:"required,gt=0,lte=65535"`
 }
 
 type Valkey struct {
@@ -133,17 +215,53 @@ type Valkey struct {
 	DialWriteTimeoutSeconds   uint64 `mapstructure:"dial_write_timeout_seconds"   json:"dial_write_timeout_seconds"   yaml:"dial_write_timeout_seconds"   validate:"gte=0"`
 }
 
-type OTLPTrace struct {
+// OTLPExporter は OTLP Exporter (Trace/Metric/Log) の共通設定
+// ゼロ値の項目は OTEL_EXPORTER_OTLP_* 環境変数 → SDK のデフォルト値の順に解決される
+// また OTEL_EXPORTER_OTLP_ENDPOINT (シグナル別含む) が設定されている場合は Host/Port/Insecure/TLS より環境変数を優先する
+// https://opentelemetry.io/docs/languages/sdk-configuration/otlp-exporter/
+type OTLPExporter struct {
 	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
 
 	Host string `mapstructure:"host" json:"host" yaml:"host" validate:"required_if=Enabled true,omitempty,hostname|ip"`
 	Port uint   `mapstructure:"port" json:"port" yaml:"port" validate:"required_if=Enabled true,omitempty,gt=0,lte=65535"`
 
-	TimeoutSeconds uint64         `mapstructure:"timeout_seconds" json:"timeout_seconds" yaml:"timeout_seconds" validate:"gte=0"`
-	Retry          OTLPTraceRetry `mapstructure:"retry"           json:"retry"           yaml:"retry"`
+	// 送信プロトコル. 空の場合は OTEL_EXPORTER_OTLP_PROTOCOL → http/protobuf
+	Protocol string `mapstructure:"protocol" json:"protocol" yaml:"protocol" validate:"omitempty,oneof=http/protobuf grpc"`
+
+	// URL パス (http/protobuf のみ). 空の場合は /v1/traces 等のデフォルト
+	URLPath string `mapstructure:"url_path" json:"url_path" yaml:"url_path" validate:"omitempty,startswith=/"`
+
+	// TLS なしで接続する
+	Insecure bool      `mapstructure:"insecure" json:"insecure" yaml:"insecure"`
+	TLS      TLSClient `mapstructure:"tls"      json:"tls"      yaml:"tls"`
+
+	// 認証ヘッダ等 (例: Authorization: Bearer xxx)
+	Headers map[string]string `mapstructure:"headers" json:"headers" yaml:"headers" validate:"omitempty,dive,keys,printascii,endkeys,printascii"`
+
+	// 空の場合は OTEL_EXPORTER_OTLP_COMPRESSION → 圧縮なし
+	Compression string `mapstructure:"compression" json:"compression" yaml:"compression" validate:"omitempty,oneof=none gzip"`
+
+	// 0 の場合は OTEL_EXPORTER_OTLP_TIMEOUT → 10秒
+	TimeoutSeconds uint64 `mapstructure:"timeout_seconds" json:"timeout_seconds" yaml:"timeout_seconds" validate:"gte=0"`
+
+	// Enabled==false の場合はリトライしない
+	Retry OTLPRetry `mapstructure:"retry" json:"retry" yaml:"retry"`
+}
+
+// TLSClient は外部サービスへ TLS で接続する際のクライアント側の設定
+type TLSClient struct {
+	// サーバ証明書を検証する CA 証明書 (PEM). 空の場合はシステムの証明書ストア
+	CAFile string `mapstructure:"ca_file" json:"ca_file" yaml:"ca_file" validate:"omitempty,file"`
+
+	// mTLS 用のクライアント証明書と秘密鍵 (PEM)
+	CertFile string `mapstructure:"cert_file" json:"cert_file" yaml:"cert_file" validate:"omitempty,file,required_with=KeyFile"`
+	KeyFile  string `mapstructure:"key_file"  json:"key_file"  yaml:"key_file"  validate:"omitempty,file,required_with=CertFile"`
+
+	// 接続先のサーバ名 (SNI). 空の場合は Host
+	ServerName string `mapstructure:"server_name" json:"server_name" yaml:"server_name" validate:"omitempty,hostname"`
 }
 
-type OTLPTraceRetry struct {
+type OTLPRetry struct {
 	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
 
 	InitialIntervalSeconds uint64 `mapstructure:"initial_interval_seconds" json:"initial_interval_seconds" yaml:"initial_interval_seconds" validate:"required_if=Enabled true,omitempty,gt=0"`
@@ -151,18 +269,341 @@ type OTLPTraceRetry struct {
 	MaxElapsedTimeSeconds  uint64 `mapstructure:"max_elapsed_time_seconds" json:"max_elapsed_time_seconds" yaml:"max_elapsed_time_seconds" validate:"required_if=Enabled true,omitempty,gtefield=MaxIntervalSeconds"`
 }
 
+// OTLPBatch は BatchSpanProcessor / BatchLogRecordProcessor の設定
+// 0 の場合は OTEL_BSP_* / OTEL_BLRP_* 環境変数 → SDK のデフォルト値
+type OTLPBatch struct {
+	// バッチを送信するまでの最大待ち時間
+	TimeoutMilliseconds uint64 `mapstructure:"timeout_milliseconds" json:"timeout_milliseconds" yaml:"timeout_milliseconds" validate:"gte=0"`
+
+	// キューの最大長. 超えた分は破棄される
+	MaxQueueSize int `mapstructure:"max_queue_size" json:"max_queue_size" yaml:"max_queue_size" validate:"gte=0"`
+
+	// 1回の送信の最大件数
+	MaxExportBatchSize int `mapstructure:"max_export_batch_size" json:"max_export_batch_size" yaml:"max_export_batch_size" validate:"gte=0"`
+}
+
+type OTLPTrace struct {
+	OTLPExporter `mapstructure:",squash" json:",inline" yaml:",inline"`
+
+	// 親 span が無い場合に記録する割合 (ParentBased(TraceIDRatioBased)). OTEL_TRACES_SAMPLER が設定されている場合はそちらを優先
+	SamplingRatio float64 `mapstructure:"sampling_ratio" json:"sampling_ratio" yaml:"sampling_ratio" validate:"gte=0,lte=1"`
+
+	Batch OTLPBatch `mapstructure:"batch" json:"batch" yaml:"batch"`
+}
+
 type OTLPMetric struct {
-	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+	OTLPExporter `mapstructure:",squash" json:",inline" yaml:",inline"`
 
-	Host string `mapstructure:"host" json:"host" yaml:"host" validate:"required_if=Enabled true,omitempty,hostname|ip"`
-	Port uint   `mapstructure:"port" json:"port" yaml:"port" validate:"required_if=Enabled true,omitempty,gt=0,lte=65535"`
+	// 送信間隔. 0 の場合は OTEL_METRIC_EXPORT_INTERVAL → 60秒
+	ExportIntervalSeconds uint64 `mapstructure:"export_interval_seconds" json:"export_interval_seconds" yaml:"export_interval_seconds" validate:"gte=0"`
+
+	// 1回の送信のタイムアウト. 0 の場合は OTEL_METRIC_EXPORT_TIMEOUT → 30秒
+	ExportTimeoutSeconds uint64 `mapstructure:"export_timeout_seconds" json:"export_timeout_seconds" yaml:"export_timeout_seconds" validate:"gte=0"`
 }
 
 type OTLPLog struct {
+	OTLPExporter `mapstructure:",squash" json:",inline" yaml:",inline"`
+
+	// OTLP に送る最低ログレベル (ローカル出力の --log_level とは独立)
+	Level string `mapstructure:"level" json:"level" yaml:"level" validate:"omitempty,oneof=debug info warn error"`
+
+	// WARN 未満のログを OTLP に送る割合 (0.0〜1.0). WARN 以上は常に送る
+	SamplingRatio float64 `mapstructure:"sampling_ratio" json:"sampling_ratio" yaml:"sampling_ratio" validate:"gte=0,lte=1"`
+
+	Batch OTLPBatch `mapstructure:"batch" json:"batch" yaml:"batch"`
+}
+
+// Outbox は outbox テーブルに書き込まれたドメインイベントを配信する relay の設定
+type Outbox struct {
+	// relay をこのプロセスで動かす. イベントの outbox への書き込みはこの設定に関係なく常に行われる
+	RelayEnabled bool `mapstructure:"relay_enabled" json:"relay_enabled" yaml:"relay_enabled"`
+
+	PollIntervalMilliseconds uint64 `mapstructure:"poll_interval_milliseconds" json:"poll_interval_milliseconds" yaml:"poll_interval_milliseconds" validate:"required_if=RelayEnabled true,omitempty,gt=0"`
+	BatchSize                int    `mapstructure:"batch_size"                 json:"batch_size"                 yaml:"batch_size"                 validate:"required_if=RelayEnabled true,omitempty,gt=0"`
+
+	// 取り出したイベントを他のインスタンスから隠しておく時間. 1バッチを配信し終えるまでの時間より長くする
+	// 結果を記録する前に停止したインスタンスのイベントは, この時間が経ってから再び配信する
+	LeaseSeconds uint64 `mapstructure:"lease_seconds" json:"lease_seconds" yaml:"lease_seconds" validate:"required_if=RelayEnabled true,omitempty,gt=0"`
+
+	// この回数配信に失敗したら dead (dead-letter) にする
+	MaxAttempts           int    `mapstructure:"max_attempts"            json:"max_attempts"            yaml:"max_attempts"            validate:"required_if=RelayEnabled true,omitempty,gt=0"`
+	InitialBackoffSeconds uint64 `mapstructure:"initial_backoff_seconds" json:"initial_backoff_seconds" yaml:"initial_backoff_seconds" validate:"required_if=RelayEnabled true,omitempty,gt=0"`
+	MaxBackoffSeconds     uint64 `mapstructure:"max_backoff_seconds"     json:"max_backoff_seconds"     yaml:"max_backoff_seconds"     validate:"omitempty,gtefield=InitialBackoffSeconds"`
+
+	Sinks OutboxSinks `mapstructure:"sinks" json:"sinks" yaml:"sinks"`
+}
+
+// OutboxSinks は配信先. 複数有効にした場合は全てに配信し, 1つでも失敗したら再試行する
+type OutboxSinks struct {
+	Stdout  OutboxStdoutSink  `mapstructure:"stdout"  json:"stdout"  yaml:"stdout"`
+	Valkey  OutboxValkeySink  `mapstructure:"valkey"  json:"valkey"  yaml:"valkey"`
+	Webhook OutboxWebhookSink `mapstructure:"webhook" json:"webhook" yaml:"webhook"`
+}
+
+type OutboxStdoutSink struct {
 	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+}
 
-	Host string `mapstructure:"host" json:"host" yaml:"host" validate:"required_if=Enabled true,omitempty,hostname|ip"`
-	Port uint   `mapstructure:"port" json:"port" yaml:"port" validate:"required_if=Enabled true,omitempty,gt=0,lte=65535"`
+type OutboxValkeySink struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// XADD するストリーム名
+	Stream string `mapstructure:"stream" json:"stream" yaml:"stream" validate:"required_if=Enabled true"`
+
+	// ストリームのおおよその最大長 (MAXLEN ~). 0 の場合は無制限
+	MaxLen int64 `mapstructure:"max_len" json:"max_len" yaml:"max_len" validate:"gte=0"`
+}
+
+type OutboxWebhookSink struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	URL            string            `mapstructure:"url"             json:"url"             yaml:"url"             validate:"required_if=Enabled true,omitempty,http_url"`
+	TimeoutSeconds uint64            `mapstructure:"timeout_seconds" json:"timeout_seconds" yaml:"timeout_seconds" validate:"required_if=Enabled true,omitempty,gt=0"`
+	Headers        map[string]string `mapstructure:"headers"         json:"headers"         yaml:"headers"         validate:"omitempty,dive,keys,printascii,endkeys,printascii"`
+}
+
+// Webhooks は API で登録された webhook への配信の設定
+// 配信の登録は outbox relay の sink として行われるため, relay も有効にする必要がある
+type Webhooks struct {
+	// 登録された webhook への配信をこのプロセスで行う
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	PollIntervalMilliseconds uint64 `mapstructure:"poll_interval_milliseconds" json:"poll_interval_milliseconds" yaml:"poll_interval_milliseconds" validate:"required_if=Enabled true,omitempty,gt=0"`
+	BatchSize                int    `mapstructure:"batch_size"                 json:"batch_size"                 yaml:"batch_size"                 validate:"required_if=Enabled true,omitempty,gt=0"`
+	TimeoutSeconds           uint64 `mapstructure:"timeout_seconds"            json:"timeout_seconds"            yaml:"timeout_seconds"            validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	// 取り出した配信を他のインスタンスから隠しておく時間. batch_size * timeout_seconds 以上にする
+	// 結果を記録する前に停止したインスタンスの配信は, この時間が経ってから再び送信する
+	LeaseSeconds uint64 `mapstructure:"lease_seconds" json:"lease_seconds" yaml:"lease_seconds" validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	// この回数配信に失敗したら failed にする
+	MaxAttempts           int    `mapstructure:"max_attempts"            json:"max_attempts"            yaml:"max_attempts"            validate:"required_if=Enabled true,omitempty,gt=0"`
+	InitialBackoffSeconds uint64 `mapstructure:"initial_backoff_seconds" json:"initial_backoff_seconds" yaml:"initial_backoff_seconds" validate:"required_if=Enabled true,omitempty,gt=0"`
+	MaxBackoffSeconds     uint64 `mapstructure:"max_backoff_seconds"     json:"max_backoff_seconds"     yaml:"max_backoff_seconds"     validate:"omitempty,gtefield=InitialBackoffSeconds"`
+
+	// この回数続けて配信に失敗した webhook は自動的に無効にする
+	MaxConsecutiveFailures int `mapstructure:"max_consecutive_failures" json:"max_consecutive_failures" yaml:"max_consecutive_failures" validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	// 配信先に http の URL や, IP アドレス/ループバック/プライベートネットワークのホストも受け付ける. 開発環境向け
+	// 登録 (API) と送信の両方に適用する
+	AllowHTTP            bool `mapstructure:"allow_http"             json:"allow_http"             yaml:"allow_http"`
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks" json:"allow_private_networks" yaml:"allow_private_networks"`
+}
+
+// UserCache は GetUser の結果を Valkey にキャッシュする設定
+type UserCache struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// Valkey のキーの接頭辞
+	KeyPrefix string `mapstructure:"key_prefix" json:"key_prefix" yaml:"key_prefix" validate:"required_if=Enabled true"`
+
+	// キャッシュの有効期間. 0〜ttl_jitter_seconds 秒をランダムに足す
+	TTLSeconds       uint64 `mapstructure:"ttl_seconds"        json:"ttl_seconds"        yaml:"ttl_seconds"        validate:"required_if=Enabled true,omitempty,gt=0"`
+	TTLJitterSeconds uint64 `mapstructure:"ttl_jitter_seconds" json:"ttl_jitter_seconds" yaml:"ttl_jitter_seconds" validate:"gte=0"`
+
+	// 存在しないユーザーをキャッシュする期間. 0 の場合はキャッシュしない
+	NegativeTTLSeconds uint64 `mapstructure:"negative_ttl_seconds" json:"negative_ttl_seconds" yaml:"negative_ttl_seconds" validate:"gte=0"`
+
+	// 無効化の後, この時間が経ってからもう一度無効化する (レプリカの遅延に備える). 0 の場合はしない
+	InvalidationDelayMilliseconds uint64 `mapstructure:"invalidation_delay_milliseconds" json:"invalidation_delay_milliseconds" yaml:"invalidation_delay_milliseconds" validate:"gte=0"`
+
+	// プロセス内のキャッシュ (LRU) の件数と有効期間. local_size が 0 の場合は使わない
+	// 他のインスタンスでの変更は invalidation_channel (Valkey Pub/Sub) への通知で反映する
+	LocalSize           int    `mapstructure:"local_size"           json:"local_size"           yaml:"local_size"           validate:"gte=0"`
+	LocalTTLSeconds     uint64 `mapstructure:"local_ttl_seconds"    json:"local_ttl_seconds"    yaml:"local_ttl_seconds"    validate:"required_unless=LocalSize 0,omitempty,gt=0"`
+	InvalidationChannel string `mapstructure:"invalidation_channel" json:"invalidation_channel" yaml:"invalidation_channel" validate:"required_unless=LocalSize 0"`
+}
+
+// Resilience は依存先 (PostgreSQL, Valkey) の呼び出しを守るサーキットブレーカーとバルクヘッドの設定
+// 依存先を断った呼び出しは Retry-After 付きの 503 になる
+type Resilience struct {
+	Postgres ResilienceDependency `mapstructure:"postgres" json:"postgres" yaml:"postgres"`
+	Valkey   ResilienceDependency `mapstructure:"valkey"   json:"valkey"   yaml:"valkey"`
+}
+
+type ResilienceDependency struct {
+	CircuitBreaker CircuitBreaker `mapstructure:"circuit_breaker" json:"circuit_breaker" yaml:"circuit_breaker"`
+	Bulkhead       Bulkhead       `mapstructure:"bulkhead"        json:"bulkhead"        yaml:"bulkhead"`
+}
+
+// CircuitBreaker は直近 window_seconds の失敗率が failure_rate_percent 以上になると open にし, open_seconds の間は依存先を呼ばない
+// その後 half-open で half_open_max_requests 件を試し, 全て成功すれば closed に, 1 件でも失敗すれば open に戻す
+type CircuitBreaker struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// 失敗率を数える期間
+	WindowSeconds uint64 `mapstructure:"window_seconds" json:"window_seconds" yaml:"window_seconds" validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	// 失敗率を判定する最小の呼び出し数. 少ない呼び出しの失敗で open にしないため
+	MinRequests uint64 `mapstructure:"min_requests" json:"min_requests" yaml:"min_requests" validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	FailureRatePercent uint64 `mapstructure:"failure_rate_percent" json:"failure_rate_percent" yaml:"failure_rate_percent" validate:"required_if=Enabled true,omitempty,gt=0,lte=100"`
+
+	OpenSeconds uint64 `mapstructure:"open_seconds" json:"open_seconds" yaml:"open_seconds" validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	HalfOpenMaxRequests uint64 `mapstructure:"half_open_max_requests" json:"half_open_max_requests" yaml:"half_open_max_requests" validate:"required_if=Enabled true,omitempty,gt=0"`
+}
+
+// Bulkhead は依存先を同時に呼ぶ数を max_concurrent までに制限する. 空きを max_wait_milliseconds 待っても空かない呼び出しは断る
+type Bulkhead struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	MaxConcurrent int `mapstructure:"max_concurrent" json:"max_concurrent" yaml:"max_concurrent" validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	// 0 の場合は待たない
+	MaxWaitMilliseconds uint64 `mapstructure:"max_wait_milliseconds" json:"max_wait_milliseconds" yaml:"max_wait_milliseconds" validate:"gte=0"`
+}
+
+// Jobs は goapp worker で動かすバックグラウンドジョブの設定
+type Jobs struct {
+	// Valkey のキーの接頭辞
+	KeyPrefix string `mapstructure:"key_prefix" json:"key_prefix" yaml:"key_prefix" validate:"required"`
+
+	// 同時に処理するジョブの数
+	Concurrency int `mapstructure:"concurrency" json:"concurrency" yaml:"concurrency" validate:"gt=0"`
+
+	PollTimeoutSeconds       uint64 `mapstructure:"poll_timeout_seconds"       json:"poll_timeout_seconds"       yaml:"poll_timeout_seconds"       validate:"gt=0"`
+	JobTimeoutSeconds        uint64 `mapstructure:"job_timeout_seconds"        json:"job_timeout_seconds"        yaml:"job_timeout_seconds"        validate:"gt=0"`
+	HeartbeatIntervalSeconds uint64 `mapstructure:"heartbeat_interval_seconds" json:"heartbeat_interval_seconds" yaml:"heartbeat_interval_seconds" validate:"gt=0"`
+
+	// この回数失敗したら dead-letter に移す
+	MaxAttempts           int    `mapstructure:"max_attempts"            json:"max_attempts"            yaml:"max_attempts"            validate:"gt=0"`
+	InitialBackoffSeconds uint64 `mapstructure:"initial_backoff_seconds" json:"initial_backoff_seconds" yaml:"initial_backoff_seconds" validate:"gt=0"`
+	MaxBackoffSeconds     uint64 `mapstructure:"max_backoff_seconds"     json:"max_backoff_seconds"     yaml:"max_backoff_seconds"     validate:"omitempty,gtefield=InitialBackoffSeconds"`
+
+	// dead-letter に残すジョブの最大数. 0 の場合は無制限
+	DeadLetterMaxLen int64 `mapstructure:"dead_letter_max_len" json:"dead_letter_max_len" yaml:"dead_letter_max_len" validate:"gte=0"`
+
+	// メトリクス (Prometheus) とヘルスチェックを公開するポート. host は server.host を使う
+	MetricsPort uint `mapstructure:"metrics_port" json:"metrics_port" yaml:"metrics_port" validate:"required,gt=0,lte=65535"`
+
+	Scheduler JobsScheduler `mapstructure:"scheduler" json:"scheduler" yaml:"scheduler"`
+
+	// maintenance.purge ジョブで削除するまでの保持期間
+	PurgeRetentionHours uint64 `mapstructure:"purge_retention_hours" json:"purge_retention_hours" yaml:"purge_retention_hours" validate:"gt=0"`
+
+	// audit.purge ジョブで監査ログを削除するまでの保持期間
+	AuditRetentionHours uint64 `mapstructure:"audit_retention_hours" json:"audit_retention_hours" yaml:"audit_retention_hours" validate:"gt=0"`
+}
+
+// JobsScheduler は定期的にジョブを登録するスケジューラの設定. 複数の worker のうちリーダーだけが登録する
+type JobsScheduler struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// リーダーのロックの有効期間. リーダーが停止した場合はこの時間が過ぎると他の worker がリーダーになる
+	LeaderLockTTLSeconds uint64 `mapstructure:"leader_lock_ttl_seconds" json:"leader_lock_ttl_seconds" yaml:"leader_lock_ttl_seconds" validate:"required_if=Enabled true,omitempty,gt=0"`
+
+	// cron の時刻を解釈するタイムゾーン (IANA Time Zone database の名前)
+	Timezone string `mapstructure:"timezone" json:"timezone" yaml:"timezone" validate:"omitempty,timezone"`
+
+	Schedules []JobSchedule `mapstructure:"schedules" json:"schedules" yaml:"schedules" validate:"dive"`
+}
+
+type JobSchedule struct {
+	Name string `mapstructure:"name" json:"name" yaml:"name" validate:"required"`
+
+	// cron 形式 (分 時 日 月 曜日) または @daily, @every 1h 等
+	Spec string `mapstructure:"spec" json:"spec" yaml:"spec" validate:"required"`
+
+	JobType string         `mapstructure:"job_type" json:"job_type" yaml:"job_type" validate:"required"`
+	Payload map[string]any `mapstructure:"payload"  json:"payload"  yaml:"payload"`
+}
+
+// Audit は監査ログの参照の設定. 保持期間は jobs.audit_retention_hours
+type Audit struct {
+	// 監査ログの参照 (GET /audit-events) を許可するロール (api.SetUserRoles). tenancy.super_admin_role のロールも許可する
+	// API キーで参照する場合は audit-events:read のスコープが必要
+	AdminRole string `mapstructure:"admin_role" json:"admin_role" yaml:"admin_role" validate:"required"`
+}
+
+// OpenAPI はリクエスト/レスポンスを OpenAPI の定義と照合する設定
+type OpenAPI struct {
+	// リクエスト (パス, クエリ, ヘッダ, 本文) を照合し, 定義に合わなければ 400 を返す
+	RequestValidation bool `mapstructure:"request_validation" json:"request_validation" yaml:"request_validation"`
+
+	// レスポンスを照合する. off: 照合しない, log: 定義と合わなければログに出力する, fail: 定義と合わなければ 500 に差し替える
+	// レスポンスを溜めてから書き出すため, 開発/テスト環境向け
+	ResponseValidation string `mapstructure:"response_validation" json:"response_validation" yaml:"response_validation" validate:"omitempty,oneof=off log fail"`
+
+	// /openapi.yaml, /openapi.json で定義を返す
+	SpecEnabled bool `mapstructure:"spec_enabled" json:"spec_enabled" yaml:"spec_enabled"`
+
+	// 返す定義の servers. 空の場合は server.host, server.port から組み立てる
+	ServerURLs []string `mapstructure:"server_urls" json:"server_urls" yaml:"server_urls" validate:"omitempty,dive,url"`
+
+	// API ドキュメント (Redoc) を docs_path で返す. spec_enabled が必要
+	DocsEnabled bool   `mapstructure:"docs_enabled" json:"docs_enabled" yaml:"docs_enabled"`
+	DocsPath    string `mapstructure:"docs_path"    json:"docs_path"    yaml:"docs_path"    validate:"required_if=DocsEnabled true,omitempty,startswith=/"`
+}
+
+// Tenancy はマルチテナントの設定
+// リクエストのテナントは 認証のクレーム (api.SetTenantClaim) → header → サブドメイン の順に特定する
+type Tenancy struct {
+	// 無効の場合は全てのリクエストをデフォルトのテナントで処理する
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// テナントの ID を受け取るヘッダ. 空の場合はヘッダから受け取らない
+	Header string `mapstructure:"header" json:"header" yaml:"header" validate:"omitempty,printascii"`
+
+	// サブドメインからテナント (slug) を特定する場合のドメイン. acme.example.com の acme を使う場合は example.com. 空の場合は使わない
+	SubdomainBase string `mapstructure:"subdomain_base" json:"subdomain_base" yaml:"subdomain_base" validate:"omitempty,hostname_rfc1123"`
+
+	// 全てのテナントにアクセスできるロール (api.SetUserRoles)
+	SuperAdminRole string `mapstructure:"super_admin_role" json:"super_admin_role" yaml:"super_admin_role" validate:"required_if=Enabled true"`
+
+	// super-admin がテナントを指定せずに全てのテナントを対象にできるルート (テンプレート)
+	AdminRoutes []string `mapstructure:"admin_routes" json:"admin_routes" yaml:"admin_routes" validate:"omitempty,dive,startswith=/"`
+
+	// テナントのクレームを持たないリクエスト (認証していないリクエストを含む) にも, ヘッダやサブドメインでのテナントの指定を許す
+	// 無効の場合, ヘッダやサブドメインで指定したテナントはクレームと一致する場合か super-admin の場合のみ使う
+	AllowUnauthenticatedSelection bool `mapstructure:"allow_unauthenticated_selection" json:"allow_unauthenticated_selection" yaml:"allow_unauthenticated_selection"`
+}
+
+// APIKeys はマシンクライアントの API キーの設定
+// キーは Authorization: Bearer <key> または X-API-Key ヘッダで受け取る
+type APIKeys struct {
+	// 無効の場合は API キーでの認証を受け付けない. キーと webhook の管理 (/api-keys, /webhooks) はできる
+	Enabled bool `mapstructure:"enabled" json:"enabled" yaml:"enabled"`
+
+	// キーと webhook の管理 (/api-keys, /webhooks) を許可するロール (api.SetUserRoles). tenancy.super_admin_role のロールも許可する
+	// API キーで管理する場合は api-keys:read/api-keys:write (webhooks:read/webhooks:write) のスコープが必要
+	AdminRole string `mapstructure:"admin_role" json:"admin_role" yaml:"admin_role" validate:"required"`
+
+	// 最終使用日時を記録する間隔. 認証のたびに書き込まないよう, 前回の記録からこの時間が経った場合だけ記録する
+	LastUsedIntervalSeconds uint `mapstructure:"last_used_interval_seconds" json:"last_used_interval_seconds" yaml:"last_used_interval_seconds"`
+
+	// キーごとのレート制限の既定値. キーに制限を指定した場合はそちらを使う
+	RateLimit RateLimit `mapstructure:"rate_limit" json:"rate_limit" yaml:"rate_limit"`
+}
+
+// Session はログインセッション (scs) の設定
+type Session struct {
+	// 作成からこの時間が経つとセッションは失効する (絶対的な期限)
+	LifetimeSeconds uint `mapstructure:"lifetime_seconds" json:"lifetime_seconds" yaml:"lifetime_seconds" validate:"required,gt=0"`
+
+	// この時間リクエストが無いとセッションは失効する. 0 の場合は lifetime_seconds まで失効しない
+	IdleTimeoutSeconds uint `mapstructure:"idle_timeout_seconds" json:"idle_timeout_seconds" yaml:"idle_timeout_seconds"`
+
+	Cookie SessionCookie `mapstructure:"cookie" json:"cookie" yaml:"cookie"`
+
+	// ユーザの全てのセッションの破棄 (POST /sessions:revoke) を許可するロール (api.SetUserRoles). tenancy.super_admin_role のロールも許可する
+	AdminRole string `mapstructure:"admin_role" json:"admin_role" yaml:"admin_role" validate:"required"`
+
+	// ユーザごとのセッションの索引 (Valkey) のキーの接頭辞
+	IndexKeyPrefix string `mapstructure:"index_key_prefix" json:"index_key_prefix" yaml:"index_key_prefix" validate:"required"`
+}
+
+type SessionCookie struct {
+	Name string `mapstructure:"name" json:"name" yaml:"name" validate:"required,printascii"`
+
+	// 空の場合は Domain 属性を付けない (発行したホストのみ)
+	Domain string `mapstructure:"domain" json:"domain" yaml:"domain" validate:"omitempty,hostname_rfc1123"`
+
+	// HTTPS でのみ送る. 本番では有効にすること
+	Secure bool `mapstructure:"secure" json:"secure" yaml:"secure"`
+
+	// none の場合は secure が必要
+	SameSite string `mapstructure:"same_site" json:"same_site" yaml:"same_site" validate:"required,oneof=lax strict none"`
 }
 
 type Prometheus struct {
@@ -177,17 +618,47 @@ type Pyroscope struct {
 	Host string `mapstructure:"host" json:"host" yaml:"host" validate:"required_if=Enabled true,omitempty,hostname|ip"`
 	Port uint   `mapstructure:"port" json:"port" yaml:"port" validate:"required_if=Enabled true,omitempty,gt=0,lte=65535"`
 
+	// TLS なし (http) で接続する
+	Insecure bool      `mapstructure:"insecure" json:"insecure" yaml:"insecure"`
+	TLS      TLSClient `mapstructure:"tls"      json:"tls"      yaml:"tls"`
+
+	// マルチテナント構成の場合のテナント ID (X-Scope-OrgID)
 	TenantID string `mapstructure:"tenant_id" json:"tenant_id" yaml:"tenant_id" validate:"omitempty,printascii"`
+
+	BasicAuthUser     string `mapstructure:"basic_auth_user"     json:"basic_auth_user"     yaml:"basic_auth_user"     validate:"required_with=BasicAuthPassword"`
+	BasicAuthPassword string `mapstructure:"basic_auth_password" json:"basic_auth_password" yaml:"basic_auth_password" validate:"required_with=BasicAuthUser"`
+
+	// 追加のヘッダ
+	Headers map[string]string `mapstructure:"headers" json:"headers" yaml:"headers" validate:"omitempty,dive,keys,printascii,endkeys,printascii"`
+
+	// プロファイルの送信間隔. 0 の場合は SDK のデフォルト (15秒)
+	UploadRateSeconds uint64 `mapstructure:"upload_rate_seconds" json:"upload_rate_seconds" yaml:"upload_rate_seconds" validate:"gte=0"`
+
+	// 取得するプロファイルの種類. 空の場合は SDK のデフォルト (cpu, alloc_*, inuse_*)
+	ProfileTypes []string `mapstructure:"profile_types" json:"profile_types" yaml:"profile_types" validate:"omitempty,unique,dive,oneof=cpu inuse_objects alloc_objects inuse_space alloc_space goroutines mutex_count mutex_duration block_count block_duration"`
+
+	// runtime.SetMutexProfileFraction に渡す値. 0 の場合は mutex プロファイルを取らない
+	MutexProfileFraction int `mapstructure:"mutex_profile_fraction" json:"mutex_profile_fraction" yaml:"mutex_profile_fraction" validate:"gte=0"`
+
+	// runtime.SetBlockProfileRate に渡す値 (ナノ秒). 0 の場合は block プロファイルを取らない
+	BlockProfileRate int `mapstructure:"block_profile_rate" json:"block_profile_rate" yaml:"block_profile_rate" validate:"gte=0"`
 }
 
 func NewConfig() Config {
 	return Config{
+		App: App{
+			Environment: "development",
+		},
 		Server: Server{
 			Host: "0.0.0.0", //
 			Port: 8080,      //
 			CORS: CORS{
 				Enabled: false,
 			},
+			CSRF: CSRF{
+				Enabled:    true,
+				HeaderName: "X-CSRF-Token",
+			},
 			OIDC: OIDC{
 				Enabled: false,
 			},
@@ -201,6 +672,20 @@ func NewConfig() Config {
 			IdleTimeoutSeconds:       120,
 			ReadHeaderTimeoutSeconds: 2,
 			MaxRequestSize:           1024 * 1024 * 10, // 10MB
+			MaxRequestSizeOverrides: []MaxRequestSizeOverride{
+				// ユーザーの一括取り込み (本文は逐次読み込むため大きくてもメモリは増えない)
+				{Route: "/users:import", MaxRequestSize: 1024 * 1024 * 1024}, // 1GB
+			},
+			RequestTimeout: RequestTimeout{
+				Enabled:        true,
+				DefaultSeconds: 8, // write_timeout_seconds より短く
+				Overrides: []RequestTimeoutOverride{
+					// ユーザーの一括取り込み/書き出し (件数に比例して長くなる)
+					{OperationID: "import_users", Seconds: 1800}, // 30m
+					{OperationID: "export_users", Seconds: 1800}, // 30m
+				},
+				MaxClientSeconds: 30,
+			},
 			CustomHeaders: []CustomHeader{
 				// https://gin-gonic.com/ja/docs/examples/security-headers/
 				{
@@ -251,6 +736,11 @@ func NewConfig() Config {
 			MaxConns:                 10,         // 10
 			MaxConnLifetimeSeconds:   3600,       // time.Hour
 			HealthCheckPeriodSeconds: 60,         // time.Minute
+
+			SlowQueryThresholdMilliseconds: 500, // 500ms
+
+			ReplicaHealthCheckIntervalSeconds: 5, // 5s
+			ReadYourWritesWindowSeconds:       5, // 5s
 		},
 		Valkey: Valkey{
 			Host:                      "valkey", //
@@ -260,28 +750,211 @@ func NewConfig() Config {
 			DialWriteTimeoutSeconds:   3,        // 3*time.Second
 		},
 		OTLPTrace: OTLPTrace{
-			Enabled: false,
-			Host:    "opentelemetry-collector", //
-			Port:    4318,                      //
+			OTLPExporter: OTLPExporter{
+				Enabled:  false,
+				Host:     "opentelemetry-collector", //
+				Port:     4318,                      //
+				Insecure: true,                      // TLS なし
+				Retry: OTLPRetry{
+					Enabled:                true,
+					InitialIntervalSeconds: 5,  // 5s
+					MaxIntervalSeconds:     30, // 30s
+					MaxElapsedTimeSeconds:  60, // 1m
+				},
+			},
+			SamplingRatio: 1.0, // 全件
 		},
 		OTLPMetric: OTLPMetric{
-			Enabled: false,
-			Host:    "opentelemetry-collector", //
-			Port:    4318,                      //
+			OTLPExporter: OTLPExporter{
+				Enabled:  false,
+				Host:     "opentelemetry-collector", //
+				Port:     4318,                      //
+				Insecure: true,                      // TLS なし
+				Retry: OTLPRetry{
+					Enabled:                true,
+					InitialIntervalSeconds: 5,  // 5s
+					MaxIntervalSeconds:     30, // 30s
+					MaxElapsedTimeSeconds:  60, // 1m
+				},
+			},
 		},
 		OTLPLog: OTLPLog{
-			Enabled: false,
-			Host:    "opentelemetry-collector", //
-			Port:    4318,                      //
+			OTLPExporter: OTLPExporter{
+				Enabled:  false,
+				Host:     "opentelemetry-collector", //
+				Port:     4318,                      //
+				Insecure: true,                      // TLS なし
+				Retry: OTLPRetry{
+					Enabled:                true,
+					InitialIntervalSeconds: 5,  // 5s
+					MaxIntervalSeconds:     30, // 30s
+					MaxElapsedTimeSeconds:  60, // 1m
+				},
+			},
+			Level:         "info", //
+			SamplingRatio: 1.0,    // 全件
 		},
 		Prometheus: Prometheus{
 			Enabled:     false,
 			MetricsPath: "/metrics",
 		},
+		Outbox: Outbox{
+			RelayEnabled:             false,
+			PollIntervalMilliseconds: 1000, // 1s
+			BatchSize:                100,  //
+			LeaseSeconds:             300,  // 5m
+			MaxAttempts:              10,   //
+			InitialBackoffSeconds:    1,    // 1s
+			MaxBackoffSeconds:        300,  // 5m
+			Sinks: OutboxSinks{
+				Stdout: OutboxStdoutSink{
+					Enabled: true,
+				},
+				Valkey: OutboxValkeySink{
+					Stream: "goapp:events",
+					MaxLen: 100000,
+				},
+				Webhook: OutboxWebhookSink{
+					TimeoutSeconds: 10,
+				},
+			},
+		},
+		Webhooks: Webhooks{
+			Enabled:                  false,
+			PollIntervalMilliseconds: 1000, // 1s
+			BatchSize:                20,   //
+			TimeoutSeconds:           10,   // 10s
+			LeaseSeconds:             300,  // 5m
+			MaxAttempts:              8,    //
+			InitialBackoffSeconds:    10,   // 10s
+			MaxBackoffSeconds:        3600, // 1h
+			MaxConsecutiveFailures:   20,   //
+			AllowHTTP:                false,
+			AllowPrivateNetworks:     false,
+		},
+		Jobs: Jobs{
+			KeyPrefix:                "goapp:jobs",
+			Concurrency:              4,
+			PollTimeoutSeconds:       1,    // 1s
+			JobTimeoutSeconds:        300,  // 5m
+			HeartbeatIntervalSeconds: 5,    // 5s
+			MaxAttempts:              10,   //
+			InitialBackoffSeconds:    5,    // 5s
+			MaxBackoffSeconds:        3600, // 1h
+			DeadLetterMaxLen:         10000,
+			MetricsPort:              9091,
+			Scheduler: JobsScheduler{
+				Enabled:              true,
+				LeaderLockTTLSeconds: 15, // 15s
+				Timezone:             "UTC",
+				Schedules: []JobSchedule{
+					{
+						Name:    "purge",
+						Spec:    "0 3 * * *", // 毎日 3:00
+						JobType: "maintenance.purge",
+					},
+					{
+						Name:    "audit_purge",
+						Spec:    "30 3 * * *", // 毎日 3:30
+						JobType: "audit.purge",
+					},
+				},
+			},
+			PurgeRetentionHours: 24 * 30,  // 30日
+			AuditRetentionHours: 24 * 400, // 400日 (1年分を下回らないよう余裕を持たせる)
+		},
+		Audit: Audit{
+			AdminRole: "admin",
+		},
+		UserCache: UserCache{
+			Enabled:                       false,
+			KeyPrefix:                     "goapp:cache:users",
+			TTLSeconds:                    300,  // 5m
+			TTLJitterSeconds:              60,   // 1m
+			NegativeTTLSeconds:            30,   // 30s
+			InvalidationDelayMilliseconds: 2000, // 2s
+			LocalSize:                     10000,
+			LocalTTLSeconds:               10, // 10s
+			InvalidationChannel:           "goapp:cache:users:invalidate",
+		},
+		OpenAPI: OpenAPI{
+			RequestValidation:  true,
+			ResponseValidation: "off",
+			SpecEnabled:        true,
+			DocsEnabled:        false,
+			DocsPath:           "/docs",
+		},
+		Tenancy: Tenancy{
+			Enabled:                       false,
+			Header:                        "X-Tenant-ID",
+			SuperAdminRole:                "super_admin",
+			AdminRoutes:                   []string{"/audit-events"},
+			AllowUnauthenticatedSelection: false,
+		},
+		APIKeys: APIKeys{
+			Enabled:                 true,
+			AdminRole:               "admin",
+			LastUsedIntervalSeconds: 60, // 1m
+			RateLimit: RateLimit{
+				Enabled: true,
+				RPS:     50,  // 適当
+				Burst:   100, // 適当
+			},
+		},
+		Session: Session{
+			LifetimeSeconds:    86400, // 24h
+			IdleTimeoutSeconds: 7200,  // 2h
+			Cookie: SessionCookie{
+				Name:     "session",
+				Secure:   false,
+				SameSite: "lax",
+			},
+			AdminRole:      "admin",
+			IndexKeyPrefix: "goapp:sessions",
+		},
+		Resilience: Resilience{
+			Postgres: ResilienceDependency{
+				CircuitBreaker: CircuitBreaker{
+					Enabled:             true,
+					WindowSeconds:       30, // 30s
+					MinRequests:         20,
+					FailureRatePercent:  50,
+					OpenSeconds:         10, // 10s
+					HalfOpenMaxRequests: 5,
+				},
+				Bulkhead: Bulkhead{
+					Enabled:             true,
+					MaxConcurrent:       20,  // postgres.max_conns の2倍. それ以上は pgxpool で待たせずに断る
+					MaxWaitMilliseconds: 500, // 500ms
+				},
+			},
+			Valkey: ResilienceDependency{
+				CircuitBreaker: CircuitBreaker{
+					Enabled:             true,
+					WindowSeconds:       30, // 30s
+					MinRequests:         20,
+					FailureRatePercent:  50,
+					OpenSeconds:         5, // 5s
+					HalfOpenMaxRequests: 5,
+				},
+				Bulkhead: Bulkhead{
+					Enabled:             true,
+					MaxConcurrent:       50,
+					MaxWaitMilliseconds: 100, // 100ms
+				},
+			},
+		},
 		Pyroscope: Pyroscope{
-			Enabled: false,
-			Host:    "pyroscope", //
-			Port:    4040,        //
+			Enabled:  false,
+			Host:     "pyroscope", //
+			Port:     4040,        //
+			Insecure: true,        //
+			ProfileTypes: []string{
+				"cpu", "alloc_objects", "alloc_space", "inuse_objects", "inuse_space",
+				"goroutines", "mutex_count", "mutex_duration", "block_count", "block_duration",
+			},
+			MutexProfileFraction: 5, //
+			BlockProfileRate:     5, //
 		},
 	}
 }
@@ -0,0 +1,456 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+const instrumentationName = "github.com/aazw/go-base/pkg/db/cache"
+
+// metrics の cache ラベル
+const cacheNameUsers = "users"
+
+// キャッシュに無い場合の DB からの読み込みのタイムアウト
+// 読み込みは同じキーを待つ全ての呼び出しで共有するため, 最初の呼び出し元の ctx のキャンセルでは止めない
+const loadTimeout = 10 * time.Second
+
+// 購読が切れた場合に再接続するまでの待ち時間の上限
+const maxResubscribeBackoff = 30 * time.Second
+
+// 無効化したキーに書き込む値 (tombstone). JSON の entry と区別できる値にする
+// tombstone がある間は SetNX で書き込めないため, 無効化の前に DB から読んでいた古い値が後からキャッシュされることは無い
+// 有効期間は読み込みのタイムアウトと同じにする (それより前に始まった読み込みは, それまでに書き込みを終えるか諦める)
+var tombstone = []byte("tombstone")
+
+var errorCodeDBNotFound = errorCodeOf(cerrors.ErrDBNotFound.New())
+
+type Config struct {
+	// Valkey のキーの接頭辞
+	KeyPrefix string
+
+	// キャッシュの有効期間. 同時に期限切れになるのを避けるため 0〜TTLJitter の時間をランダムに足す
+	TTL       time.Duration
+	TTLJitter time.Duration
+
+	// 存在しないユーザーをキャッシュする期間. 0 の場合はキャッシュしない
+	NegativeTTL time.Duration
+
+	// 無効化の後, この時間が経ってからもう一度無効化する. 0 の場合はしない
+	// 無効化の直後に遅延のあるレプリカから読んだ古い値がキャッシュされた場合に備える
+	InvalidationDelay time.Duration
+
+	// プロセス内のキャッシュ (LRU) の件数と有効期間. LocalSize が 0 の場合は使わない
+	// 他のインスタンスでの変更は InvalidationChannel への通知で反映する
+	LocalSize           int
+	LocalTTL            time.Duration
+	InvalidationChannel string
+}
+
+type handlerOptions struct {
+	metrics *Metrics
+}
+
+type HandlerOption func(*handlerOptions)
+
+// WithMetrics はキャッシュのヒット/ミスを metrics に記録する
+func WithMetrics(metrics *Metrics) HandlerOption {
+	return func(o *handlerOptions) {
+		o.metrics = metrics
+	}
+}
+
+// Handler は db.Handler の GetUser の結果を Valkey (と任意でプロセス内の LRU) にキャッシュする
+// UpdateUser/DeleteUSer/ImportUsers ではキャッシュを無効化する. トランザクション中の場合はコミットした後に無効化する
+// その他の操作はそのまま db.Handler に委ねる
+type Handler struct {
+	db.Handler
+
+	store   Store
+	config  Config
+	metrics *Metrics
+	local   *lru
+	group   singleflight.Group
+}
+
+func NewHandler(next db.Handler, store Store, config Config, options ...HandlerOption) (*Handler, error) {
+	if next == nil || store == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("database handler and cache store are required"),
+		)
+	}
+	if config.KeyPrefix == "" || config.TTL <= 0 || config.TTLJitter < 0 || config.NegativeTTL < 0 || config.InvalidationDelay < 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid cache config: key_prefix=%q, ttl=%s, ttl_jitter=%s, negative_ttl=%s, invalidation_delay=%s",
+				config.KeyPrefix, config.TTL, config.TTLJitter, config.NegativeTTL, config.InvalidationDelay),
+		)
+	}
+	if config.LocalSize > 0 && (config.LocalTTL <= 0 || config.InvalidationChannel == "") {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid local cache config: local_ttl=%s, invalidation_channel=%q", config.LocalTTL, config.InvalidationChannel),
+		)
+	}
+
+	opts := &handlerOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	h := &Handler{
+		Handler: next,
+		store:   store,
+		config:  config,
+		metrics: opts.metrics,
+	}
+	if config.LocalSize > 0 {
+		h.local = newLRU(config.LocalSize, config.LocalTTL)
+	}
+	return h, nil
+}
+
+// entry はキャッシュする値. User が nil の場合はユーザーが存在しないことを表す (negative cache)
+type entry struct {
+	User *userRecord `json:"user"`
+}
+
+type userRecord struct {
+	ID        uuid.UUID `json:"id"`
+	TenantID  uuid.UUID `json:"tenant_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// user はキャッシュした値から呼び出し元に返す値を作る (呼び出し元での変更がキャッシュに影響しないよう毎回新しく作る)
+func (e *entry) user() (*models.User, error) {
+	if e.User == nil {
+		return nil, cerrors.ErrDBNotFound.New(
+			cerrors.WithMessage("record not found"),
+		)
+	}
+	return &models.User{
+		ID:        e.User.ID,
+		TenantID:  e.User.TenantID,
+		Name:      e.User.Name,
+		Email:     e.User.Email,
+		CreatedAt: e.User.CreatedAt,
+		UpdatedAt: e.User.UpdatedAt,
+	}, nil
+}
+
+// key はキャッシュのキー. 他のテナントからは見えない (negative cache になる) ため, テナントごとに分ける
+func (h *Handler) key(tenantID uuid.UUID, userID uuid.UUID) string {
+	return h.config.KeyPrefix + ":" + tenantID.String() + ":" + userID.String()
+}
+
+// GetUser はキャッシュ (プロセス内 → Valkey の順) にあればそれを, 無ければ db.Handler から読んでキャッシュする
+// 同じユーザーへの同時の読み込みは1つにまとめる
+// トランザクション中や read-your-writes でプライマリから読むべき場合, テナントが1つに定まらない場合はキャッシュを使わない
+func (h *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok || db.IsCrossTenant(ctx) {
+		return h.Handler.GetUser(ctx, userID)
+	}
+	if _, ok := pendingFromContext(ctx); ok || db.ReadFromPrimary(ctx) {
+		return h.Handler.GetUser(ctx, userID)
+	}
+
+	key := h.key(tenantID, userID)
+	if h.local != nil {
+		if e, ok := h.local.get(key); ok {
+			h.metrics.observe(ctx, cacheNameUsers, tierLocal, resultHit)
+			return e.user()
+		}
+		h.metrics.observe(ctx, cacheNameUsers, tierLocal, resultMiss)
+	}
+
+	ch := h.group.DoChan(key, func() (any, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		return h.load(loadCtx, userID, key)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*entry).user()
+	}
+}
+
+// load は Valkey から, 無ければ db.Handler から読み, 読んだ値をキャッシュする
+// Valkey が使えない場合はキャッシュ無しで db.Handler から読む
+func (h *Handler) load(ctx context.Context, userID uuid.UUID, key string) (*entry, error) {
+
+	logger := logging.FromContext(ctx)
+
+	var generation uint64
+	if h.local != nil {
+		generation = h.local.currentGeneration()
+	}
+
+	data, err := h.store.Get(ctx, key)
+	if err != nil {
+		logger.Warn("failed to read user cache", "user_id", userID, "error", err)
+	}
+	if data != nil && !bytes.Equal(data, tombstone) {
+		var e entry
+		if err := json.Unmarshal(data, &e); err == nil {
+			h.metrics.observe(ctx, cacheNameUsers, tierValkey, resultHit)
+			if h.local != nil {
+				h.local.set(key, &e, generation)
+			}
+			return &e, nil
+		}
+		logger.Warn("failed to decode user cache", "user_id", userID, "error", err)
+	}
+	h.metrics.observe(ctx, cacheNameUsers, tierValkey, resultMiss)
+
+	e := &entry{}
+	ttl := h.config.NegativeTTL
+	user, err := h.Handler.GetUser(ctx, userID)
+	switch {
+	case err == nil:
+		e.User = &userRecord{
+			ID:        user.ID,
+			TenantID:  user.TenantID,
+			Name:      user.Name,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		}
+		ttl = h.config.TTL
+		if h.config.TTLJitter > 0 {
+			ttl += rand.N(h.config.TTLJitter)
+		}
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		if ttl == 0 {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	data, err = json.Marshal(e)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to encode user cache"),
+		)
+	}
+	// 読んでいる間に無効化された (tombstone がある) 場合は, 読んだ値が古い可能性があるためキャッシュしない
+	stored, err := h.store.SetNX(ctx, key, data, ttl)
+	if err != nil {
+		logger.Warn("failed to write user cache", "user_id", userID, "error", err)
+	}
+	if stored && h.local != nil {
+		h.local.set(key, e, generation)
+	}
+	return e, nil
+}
+
+func (h *Handler) UpdateUser(ctx context.Context, userID uuid.UUID, prototype *models.UserPrototype) (*models.User, error) {
+
+	user, err := h.Handler.UpdateUser(ctx, userID, prototype)
+	if err != nil {
+		return nil, err
+	}
+	h.afterWrite(ctx, h.key(user.TenantID, userID))
+	return user, nil
+}
+
+func (h *Handler) DeleteUSer(ctx context.Context, userID uuid.UUID) error {
+
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok || db.IsCrossTenant(ctx) {
+		// キャッシュのキーを決めるため, 削除する前にユーザーのテナントを調べる
+		user, err := h.Handler.GetUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		tenantID = user.TenantID
+	}
+	if err := h.Handler.DeleteUSer(ctx, userID); err != nil {
+		return err
+	}
+	h.afterWrite(ctx, h.key(tenantID, userID))
+	return nil
+}
+
+// ImportUsers は更新したユーザーのキャッシュを無効化する. 作成したユーザーは新しい ID のためキャッシュに無い
+func (h *Handler) ImportUsers(ctx context.Context, prototypes []*models.UserPrototype, updateDuplicates bool) ([]*models.User, []*models.UserImportUpdate, error) {
+
+	created, updated, err := h.Handler.ImportUsers(ctx, prototypes, updateDuplicates)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, update := range updated {
+		h.afterWrite(ctx, h.key(update.After.TenantID, update.After.ID))
+	}
+	return created, updated, nil
+}
+
+// RunInTx は db.Handler の RunInTx を呼び, コミットした後にトランザクション中に変更したユーザーのキャッシュを無効化する
+// (コミット前に無効化すると, その間に読んだ古い値が再びキャッシュされるため)
+func (h *Handler) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	if _, ok := pendingFromContext(ctx); ok {
+		return h.Handler.RunInTx(ctx, fn)
+	}
+
+	pending := &pendingInvalidations{}
+	if err := h.Handler.RunInTx(context.WithValue(ctx, pendingKey{}, pending), fn); err != nil {
+		return err
+	}
+	h.invalidate(ctx, pending.keys()...)
+	return nil
+}
+
+// afterWrite はトランザクション中であればコミット後の無効化を予約し, そうでなければすぐに無効化する
+func (h *Handler) afterWrite(ctx context.Context, key string) {
+	if pending, ok := pendingFromContext(ctx); ok {
+		pending.add(key)
+		return
+	}
+	h.invalidate(ctx, key)
+}
+
+// invalidate はプロセス内のキャッシュを削除して Valkey のキャッシュを tombstone に置き換え, 他のインスタンスにプロセス内のキャッシュの削除を通知する
+// 変更は既に確定しているため失敗してもエラーにはしない (キャッシュの有効期間が過ぎれば解消する)
+func (h *Handler) invalidate(ctx context.Context, keys ...string) {
+
+	if len(keys) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	h.evict(ctx, keys)
+
+	if h.config.InvalidationDelay > 0 {
+		time.AfterFunc(h.config.InvalidationDelay, func() {
+			h.evict(ctx, keys)
+		})
+	}
+}
+
+func (h *Handler) evict(ctx context.Context, keys []string) {
+
+	logger := logging.FromContext(ctx)
+
+	if h.local != nil {
+		for _, key := range keys {
+			h.local.remove(key)
+		}
+	}
+	for _, key := range keys {
+		if err := h.store.Set(ctx, key, tombstone, loadTimeout); err != nil {
+			logger.Error("failed to invalidate user cache", "key", key, "error", err)
+		}
+	}
+	if h.local != nil {
+		for _, key := range keys {
+			if err := h.store.Publish(ctx, h.config.InvalidationChannel, key); err != nil {
+				logger.Error("failed to publish user cache invalidation", "key", key, "error", err)
+			}
+		}
+	}
+}
+
+// Run は ctx がキャンセルされるまで他のインスタンスからの無効化の通知を購読し, プロセス内のキャッシュから削除する
+// プロセス内のキャッシュを使わない場合は何もせずに返る
+// 購読が切れた場合は通知を取りこぼした可能性があるため, 再接続した時点でプロセス内のキャッシュを全て捨てる
+func (h *Handler) Run(ctx context.Context) error {
+
+	if h.local == nil {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx).With("component", "user_cache")
+	logger.Info("user cache invalidation subscriber started", "channel", h.config.InvalidationChannel)
+
+	backoff := time.Second
+	for {
+		subscribed := false
+		err := h.store.Subscribe(ctx, h.config.InvalidationChannel,
+			func() {
+				subscribed = true
+				backoff = time.Second
+				h.local.purge()
+			},
+			func(key string) {
+				h.local.remove(key)
+			},
+		)
+		if ctx.Err() != nil {
+			logger.Info("user cache invalidation subscriber stopped")
+			return nil
+		}
+
+		// 購読できない間は古い値を使い続けないようにする
+		h.local.purge()
+		logger.Warn("user cache invalidation subscription lost", "subscribed", subscribed, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			logger.Info("user cache invalidation subscriber stopped")
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxResubscribeBackoff)
+	}
+}
+
+type pendingKey struct{}
+
+// pendingInvalidations はトランザクション中に変更したユーザーのキャッシュのキー. コミット後に無効化する
+type pendingInvalidations struct {
+	mu     sync.Mutex
+	values map[string]struct{}
+}
+
+func (p *pendingInvalidations) add(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.values == nil {
+		p.values = map[string]struct{}{}
+	}
+	p.values[key] = struct{}{}
+}
+
+func (p *pendingInvalidations) keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]string, 0, len(p.values))
+	for key := range p.values {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func pendingFromContext(ctx context.Context) (*pendingInvalidations, bool) {
+	pending, ok := ctx.Value(pendingKey{}).(*pendingInvalidations)
+	return pending, ok
+}
+
+func errorCodeOf(err error) string {
+	var cerr *cerrors.CustomError
+	if errors.As(err, &cerr) {
+		return cerr.Code()
+	}
+	return ""
+}
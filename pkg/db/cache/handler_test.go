@@ -0,0 +1,543 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// fakeDB は GetUser の呼び出し回数を数える db.Handler
+type fakeDB struct {
+	db.Handler
+
+	mu    sync.Mutex
+	users map[uuid.UUID]*models.User
+	gets  atomic.Int32
+
+	// GetUser の中で, 読んだ後に待つ (同時の呼び出しをまとめられること, 読み込み中の無効化の確認用)
+	block chan struct{}
+}
+
+func newFakeDB(users ...*models.User) *fakeDB {
+	f := &fakeDB{users: map[uuid.UUID]*models.User{}}
+	for _, u := range users {
+		f.users[u.ID] = u
+	}
+	return f
+}
+
+func (f *fakeDB) GetUser(_ context.Context, userID uuid.UUID) (*models.User, error) {
+	f.mu.Lock()
+	u, ok := f.users[userID]
+	var copied models.User
+	if ok {
+		copied = *u
+	}
+	f.mu.Unlock()
+	f.gets.Add(1)
+	if f.block != nil {
+		<-f.block
+	}
+	if !ok {
+		return nil, cerrors.ErrDBNotFound.New(cerrors.WithMessage("record not found"))
+	}
+	return &copied, nil
+}
+
+func (f *fakeDB) UpdateUser(_ context.Context, userID uuid.UUID, prototype *models.UserPrototype) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u, ok := f.users[userID]
+	if !ok {
+		return nil, cerrors.ErrDBNotFound.New(cerrors.WithMessage("record not found"))
+	}
+	u.Name = prototype.Name
+	u.Email = prototype.Email
+	copied := *u
+	return &copied, nil
+}
+
+func (f *fakeDB) DeleteUSer(_ context.Context, userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.users[userID]; !ok {
+		return cerrors.ErrDBNotFound.New(cerrors.WithMessage("record not found"))
+	}
+	delete(f.users, userID)
+	return nil
+}
+
+func (f *fakeDB) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// fakeStore はメモリ上の Store. 通知は購読中の全ての onMessage に同期的に渡す
+type fakeStore struct {
+	mu          sync.Mutex
+	values      map[string][]byte
+	ttls        map[string]time.Duration
+	published   []string
+	subscribers []func(string)
+	failGet     bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		values: map[string][]byte{},
+		ttls:   map[string]time.Duration{},
+	}
+}
+
+func (s *fakeStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failGet {
+		return nil, errors.New("connection refused")
+	}
+	return s.values[key], nil
+}
+
+func (s *fakeStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func (s *fakeStore) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		return false, nil
+	}
+	s.values[key] = value
+	s.ttls[key] = ttl
+	return true, nil
+}
+
+func (s *fakeStore) Publish(_ context.Context, _ string, message string) error {
+	s.mu.Lock()
+	s.published = append(s.published, message)
+	subscribers := append([]func(string){}, s.subscribers...)
+	s.mu.Unlock()
+	for _, onMessage := range subscribers {
+		onMessage(message)
+	}
+	return nil
+}
+
+func (s *fakeStore) Subscribe(ctx context.Context, _ string, onSubscribe func(), onMessage func(string)) error {
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, onMessage)
+	s.mu.Unlock()
+	onSubscribe()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// has は key にキャッシュした値 (tombstone 以外) があるかを返す
+func (s *fakeStore) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return ok && !bytes.Equal(value, tombstone)
+}
+
+// expire は key の値 (tombstone も) を有効期間が過ぎたものとして消す
+func (s *fakeStore) expire(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+func testConfig() Config {
+	return Config{
+		KeyPrefix:   "test:users",
+		TTL:         time.Minute,
+		TTLJitter:   10 * time.Second,
+		NegativeTTL: 5 * time.Second,
+	}
+}
+
+// testContext はデフォルトのテナントに紐付けた ctx を返す. テナントが紐付けられていない場合はキャッシュを使わない
+func testContext() context.Context {
+	return db.WithTenant(context.Background(), models.DefaultTenantID)
+}
+
+func newTestUser() *models.User {
+	return &models.User{
+		ID:        uuid.New(),
+		TenantID:  models.DefaultTenantID,
+		Name:      "alice",
+		Email:     "alice@example.com",
+		CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func newTestHandler(t *testing.T, next db.Handler, store Store, config Config) *Handler {
+	t.Helper()
+	h, err := NewHandler(next, store, config)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	return h
+}
+
+func TestHandler_GetUser_ReadThrough(t *testing.T) {
+	user := newTestUser()
+	fdb := newFakeDB(user)
+	store := newFakeStore()
+	h := newTestHandler(t, fdb, store, testConfig())
+	ctx := testContext()
+
+	for i := range 3 {
+		got, err := h.GetUser(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("GetUser() #%d error = %v", i, err)
+		}
+		if got.ID != user.ID || got.Name != user.Name || got.Email != user.Email || !got.CreatedAt.Equal(user.CreatedAt) || !got.UpdatedAt.Equal(user.UpdatedAt) {
+			t.Fatalf("GetUser() #%d = %+v, want %+v", i, got, user)
+		}
+	}
+	if n := fdb.gets.Load(); n != 1 {
+		t.Errorf("database reads = %d, want 1", n)
+	}
+
+	ttl := store.ttls[h.key(models.DefaultTenantID, user.ID)]
+	if ttl < time.Minute || ttl > time.Minute+10*time.Second {
+		t.Errorf("ttl = %s, want between 1m and 1m10s", ttl)
+	}
+}
+
+func TestHandler_GetUser_NegativeCache(t *testing.T) {
+	fdb := newFakeDB()
+	store := newFakeStore()
+	h := newTestHandler(t, fdb, store, testConfig())
+	ctx := testContext()
+	userID := uuid.New()
+
+	for range 2 {
+		_, err := h.GetUser(ctx, userID)
+		if errorCodeOf(err) != errorCodeDBNotFound {
+			t.Fatalf("GetUser() error = %v, want not found", err)
+		}
+	}
+	if n := fdb.gets.Load(); n != 1 {
+		t.Errorf("database reads = %d, want 1", n)
+	}
+	if ttl := store.ttls[h.key(models.DefaultTenantID, userID)]; ttl != 5*time.Second {
+		t.Errorf("ttl = %s, want 5s", ttl)
+	}
+
+	// negative_ttl が 0 の場合はキャッシュしない
+	config := testConfig()
+	config.NegativeTTL = 0
+	h = newTestHandler(t, fdb, newFakeStore(), config)
+	for range 2 {
+		if _, err := h.GetUser(ctx, userID); errorCodeOf(err) != errorCodeDBNotFound {
+			t.Fatalf("GetUser() error = %v, want not found", err)
+		}
+	}
+	if n := fdb.gets.Load(); n != 3 {
+		t.Errorf("database reads = %d, want 3", n)
+	}
+}
+
+func TestHandler_GetUser_Singleflight(t *testing.T) {
+	user := newTestUser()
+	fdb := newFakeDB(user)
+	fdb.block = make(chan struct{})
+	h := newTestHandler(t, fdb, newFakeStore(), testConfig())
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := h.GetUser(testContext(), user.ID)
+			errs <- err
+		}()
+	}
+
+	// 全員が待ち始めるまで DB の読み込みを止めておく
+	deadline := time.Now().Add(5 * time.Second)
+	for fdb.gets.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(fdb.block)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("GetUser() error = %v", err)
+		}
+	}
+	if n := fdb.gets.Load(); n != 1 {
+		t.Errorf("database reads = %d, want 1", n)
+	}
+}
+
+func TestHandler_GetUser_StoreUnavailable(t *testing.T) {
+	user := newTestUser()
+	fdb := newFakeDB(user)
+	store := newFakeStore()
+	store.failGet = true
+	h := newTestHandler(t, fdb, store, testConfig())
+
+	got, err := h.GetUser(testContext(), user.ID)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("GetUser() = %+v, want %+v", got, user)
+	}
+}
+
+func TestHandler_GetUser_Bypass(t *testing.T) {
+	user := newTestUser()
+	fdb := newFakeDB(user)
+	store := newFakeStore()
+	h := newTestHandler(t, fdb, store, testConfig())
+
+	// read-your-writes でプライマリから読む場合
+	ctx := db.WithPrimary(testContext())
+	for range 2 {
+		if _, err := h.GetUser(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// トランザクション中
+	err := h.RunInTx(testContext(), func(ctx context.Context) error {
+		_, err := h.GetUser(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// テナントが紐付けられていない場合と, 全てのテナントを扱う場合
+	for _, ctx := range []context.Context{context.Background(), db.WithCrossTenant(testContext())} {
+		if _, err := h.GetUser(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := fdb.gets.Load(); n != 5 {
+		t.Errorf("database reads = %d, want 5", n)
+	}
+	if store.has(h.key(models.DefaultTenantID, user.ID)) {
+		t.Error("user is cached, want not cached")
+	}
+}
+
+func TestHandler_Invalidate(t *testing.T) {
+	user := newTestUser()
+	fdb := newFakeDB(user)
+	store := newFakeStore()
+	h := newTestHandler(t, fdb, store, testConfig())
+	ctx := testContext()
+	key := h.key(models.DefaultTenantID, user.ID)
+
+	if _, err := h.GetUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// トランザクション中の変更はコミットした後に無効化する
+	err := h.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := h.UpdateUser(ctx, user.ID, &models.UserPrototype{Name: "bob", Email: "bob@example.com"}); err != nil {
+			return err
+		}
+		if !store.has(key) {
+			t.Error("cache invalidated before commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.has(key) {
+		t.Fatal("cache not invalidated after commit")
+	}
+	// tombstone の有効期間が過ぎた後に読み直してキャッシュする
+	store.expire(key)
+	got, err := h.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "bob" {
+		t.Errorf("Name = %q, want bob", got.Name)
+	}
+
+	// ロールバックした場合は無効化しない
+	err = h.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := h.UpdateUser(ctx, user.ID, &models.UserPrototype{Name: "dave", Email: "dave@example.com"}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("RunInTx() error = nil, want error")
+	}
+	if !store.has(key) {
+		t.Error("cache invalidated after rollback")
+	}
+
+	// トランザクション外の変更はすぐに無効化する
+	if err := h.DeleteUSer(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if store.has(key) {
+		t.Error("cache not invalidated after delete")
+	}
+	if _, err := h.GetUser(ctx, user.ID); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetUser() error = %v, want not found", err)
+	}
+}
+
+func TestHandler_InvalidateDuringLoad(t *testing.T) {
+	user := newTestUser()
+	fdb := newFakeDB(user)
+	fdb.block = make(chan struct{})
+	store := newFakeStore()
+	h := newTestHandler(t, fdb, store, testConfig())
+	ctx := testContext()
+	key := h.key(models.DefaultTenantID, user.ID)
+
+	// 変更前の値を読んだ後, キャッシュに書き込む前に変更して無効化する
+	loaded := make(chan *models.User)
+	go func() {
+		got, err := h.GetUser(ctx, user.ID)
+		if err != nil {
+			t.Error(err)
+		}
+		loaded <- got
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for fdb.gets.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := h.UpdateUser(ctx, user.ID, &models.UserPrototype{Name: "bob", Email: "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	close(fdb.block)
+	if got := <-loaded; got != nil && got.Name != "alice" {
+		t.Fatalf("Name = %q, want alice (read before the update)", got.Name)
+	}
+
+	// 古い値はキャッシュしない
+	if store.has(key) {
+		t.Fatal("stale user is cached after invalidation")
+	}
+	got, err := h.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "bob" {
+		t.Errorf("Name = %q, want bob", got.Name)
+	}
+
+	// tombstone の有効期間が過ぎればキャッシュする
+	store.expire(key)
+	if _, err := h.GetUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !store.has(key) {
+		t.Error("user is not cached after the tombstone expired")
+	}
+}
+
+func TestHandler_LocalTier(t *testing.T) {
+	user := newTestUser()
+	fdb := newFakeDB(user)
+	store := newFakeStore()
+	config := testConfig()
+	config.LocalSize = 10
+	config.LocalTTL = time.Minute
+	config.InvalidationChannel = "test:users:invalidate"
+
+	// 同じ Valkey を共有する2つのインスタンス
+	h1 := newTestHandler(t, fdb, store, config)
+	h2 := newTestHandler(t, fdb, store, config)
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+	for _, h := range []*Handler{h1, h2} {
+		go func() { _ = h.Run(ctx) }()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		store.mu.Lock()
+		n := len(store.subscribers)
+		store.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscribers not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, h := range []*Handler{h1, h2} {
+		if _, err := h.GetUser(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Valkey から消えてもプロセス内のキャッシュから返す
+	store.expire(h2.key(models.DefaultTenantID, user.ID))
+	if _, err := h2.GetUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := fdb.gets.Load(); n != 1 {
+		t.Fatalf("database reads = %d, want 1", n)
+	}
+
+	// h1 での変更の通知で h2 のプロセス内のキャッシュも消える
+	if _, err := h1.UpdateUser(ctx, user.ID, &models.UserPrototype{Name: "carol", Email: "carol@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := h2.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "carol" {
+		t.Errorf("Name = %q, want carol", got.Name)
+	}
+}
+
+func TestNewHandler_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(c *Config)
+	}{
+		{name: "no key prefix", config: func(c *Config) { c.KeyPrefix = "" }},
+		{name: "zero ttl", config: func(c *Config) { c.TTL = 0 }},
+		{name: "negative jitter", config: func(c *Config) { c.TTLJitter = -time.Second }},
+		{name: "local without ttl", config: func(c *Config) { c.LocalSize = 10; c.InvalidationChannel = "ch" }},
+		{name: "local without channel", config: func(c *Config) { c.LocalSize = 10; c.LocalTTL = time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			tt.config(&config)
+			if _, err := NewHandler(newFakeDB(), newFakeStore(), config); err == nil {
+				t.Error("NewHandler() error = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru はプロセス内のキャッシュ. 容量を超えたら最も古く使われたものから捨てる
+//
+// 無効化 (remove/purge) の度に世代を進め, 読み込みを始めた時点から世代が変わっていれば set しない
+// (無効化より前に DB から読んだ古い値で上書きしないため)
+type lru struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	ll         *list.List
+	items      map[string]*list.Element
+	generation uint64
+}
+
+type lruItem struct {
+	key       string
+	value     *entry
+	expiresAt time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lru) get(key string) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*lruItem)
+	if time.Now().After(item.expiresAt) {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return item.value, true
+}
+
+// currentGeneration は set に渡す世代を返す. 値の読み込みを始める前に呼ぶ
+func (c *lru) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// set は generation 以降に無効化が無かった場合だけ value を保存する
+func (c *lru) set(key string, value *entry, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	expiresAt := time.Now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		item := elem.Value.(*lruItem)
+		item.value = value
+		item.expiresAt = expiresAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruItem{key: key, value: value, expiresAt: expiresAt})
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+func (c *lru) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.items[key]; ok {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// purge は全て捨てる. 無効化の通知を取りこぼした可能性がある場合 (購読の再接続時) に使う
+func (c *lru) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.ll.Init()
+	clear(c.items)
+}
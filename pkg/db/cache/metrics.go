@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// キャッシュの階層 (tier ラベル)
+const (
+	tierLocal  = "local"  // プロセス内の LRU
+	tierValkey = "valkey" // インスタンス間で共有する Valkey
+)
+
+// 参照の結果 (result ラベル)
+const (
+	resultHit  = "hit"
+	resultMiss = "miss"
+)
+
+// Metrics はキャッシュのヒット/ミスの回数を Prometheus と OTel の両方に記録する
+type Metrics struct {
+	// Prometheus
+	requests *prometheus.CounterVec
+
+	// OTel
+	otelRequests metric.Int64Counter
+}
+
+// NewMetrics は Metrics を生成する. namespace は Prometheus のメトリクス名の接頭辞
+func NewMetrics(namespace string) (*Metrics, error) {
+
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "cache",
+				Name:      "requests_total",
+				Help:      "キャッシュの参照回数. cache (対象), tier (階層), result (hit/miss) 別",
+			},
+			[]string{"cache", "tier", "result"},
+		),
+	}
+
+	var err error
+	m.otelRequests, err = otel.Meter(instrumentationName).Int64Counter(
+		"cache.requests",
+		metric.WithDescription("Number of cache lookups by cache, tier and result."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create cache metrics instrument"),
+		)
+	}
+
+	return m, nil
+}
+
+// observe は1回の参照の結果を記録する
+func (m *Metrics) observe(ctx context.Context, cache string, tier string, result string) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(cache, tier, result).Inc()
+	m.otelRequests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("cache", cache),
+		attribute.String("tier", tier),
+		attribute.String("result", result),
+	))
+}
+
+// Describe は prometheus.Collector の実装
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+}
+
+// Collect は prometheus.Collector の実装
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+}
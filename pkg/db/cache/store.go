@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// 購読中の接続の死活確認 (PING) の間隔. この2倍の時間応答が無ければ接続を張り直す
+const subscribePingInterval = 10 * time.Second
+
+// Store は共有キャッシュ (Valkey) とインスタンス間の無効化の通知のためのインターフェース
+type Store interface {
+	// Get は key の値を返す. 無い場合は nil, nil
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set は key に値を書き込む. 既にある値も上書きする
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// SetNX は key が無い場合のみ値を書き込む. 書き込んだ場合は true
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	Publish(ctx context.Context, channel string, message string) error
+
+	// Subscribe は ctx がキャンセルされるか接続が切れるまで channel を購読し, 受け取ったメッセージを onMessage に渡す
+	// onSubscribe は購読を開始した時点で呼ばれる
+	Subscribe(ctx context.Context, channel string, onSubscribe func(), onMessage func(message string)) error
+}
+
+// ValkeyStore は Valkey による Store の実装
+type ValkeyStore struct {
+	pool *redis.Pool
+}
+
+func NewValkeyStore(pool *redis.Pool) (*ValkeyStore, error) {
+	if pool == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("valkey pool is required"),
+		)
+	}
+	return &ValkeyStore{
+		pool: pool,
+	}, nil
+}
+
+func (s *ValkeyStore) Get(ctx context.Context, key string) ([]byte, error) {
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, newStoreError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	value, err := redis.Bytes(redis.DoContext(conn, ctx, "GET", key))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, newStoreError(err, "failed to get cache entry")
+	}
+	return value, nil
+}
+
+func (s *ValkeyStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return newStoreError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "SET", key, value, "PX", ttl.Milliseconds()); err != nil {
+		return newStoreError(err, "failed to set cache entry")
+	}
+	return nil
+}
+
+func (s *ValkeyStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return false, newStoreError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	// 既に値がある場合は nil が返る
+	_, err = redis.String(redis.DoContext(conn, ctx, "SET", key, value, "PX", ttl.Milliseconds(), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, newStoreError(err, "failed to set cache entry")
+	}
+	return true, nil
+}
+
+func (s *ValkeyStore) Publish(ctx context.Context, channel string, message string) error {
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return newStoreError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "PUBLISH", channel, message); err != nil {
+		return newStoreError(err, "failed to publish cache invalidation")
+	}
+	return nil
+}
+
+func (s *ValkeyStore) Subscribe(ctx context.Context, channel string, onSubscribe func(), onMessage func(message string)) error {
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return newStoreError(err, "failed to get valkey connection")
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err := psc.Subscribe(channel); err != nil {
+		return newStoreError(err, "failed to subscribe cache invalidations")
+	}
+
+	// 受信 (このゴルーチン) と並行して書き込めるのは1つのゴルーチンだけなので, PING と購読の解除は同じゴルーチンで送る
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(subscribePingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				_ = psc.Unsubscribe()
+				return
+			case <-ticker.C:
+				if err := psc.Ping(""); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * subscribePingInterval).(type) {
+		case redis.Message:
+			onMessage(string(v.Data))
+		case redis.Subscription:
+			switch {
+			case v.Kind == "subscribe":
+				onSubscribe()
+			case v.Count == 0:
+				return ctx.Err()
+			}
+		case error:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return newStoreError(v, "cache invalidation subscription failed")
+		}
+	}
+}
+
+func newStoreError(err error, msg string) error {
+	return cerrors.ErrDBOperation.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage(msg),
+	)
+}
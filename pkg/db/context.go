@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// readYourWrites はレプリカ構成での read-your-writes のための状態
+// 1つのリクエスト (context) の中で共有し, 書き込み後の読み取りをプライマリに向ける
+type readYourWrites struct {
+	primary atomic.Bool
+	onWrite func(ctx context.Context)
+}
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites は ctx に read-your-writes の状態を持たせる
+// primary が true の場合は最初から読み取りをプライマリで行う (直前のリクエストで書き込みがあった場合等)
+// onWrite は書き込みが成功した直後に呼ばれる (セッションへの記録等). nil でもよい
+func WithReadYourWrites(ctx context.Context, primary bool, onWrite func(ctx context.Context)) context.Context {
+	state := &readYourWrites{onWrite: onWrite}
+	state.primary.Store(primary)
+	return context.WithValue(ctx, readYourWritesKey{}, state)
+}
+
+// WithPrimary は以降の読み取りをプライマリで行うよう ctx に印を付ける
+func WithPrimary(ctx context.Context) context.Context {
+	if state, ok := ctx.Value(readYourWritesKey{}).(*readYourWrites); ok {
+		state.primary.Store(true)
+		return ctx
+	}
+	return WithReadYourWrites(ctx, true, nil)
+}
+
+// ReadFromPrimary は読み取りをプライマリで行うべきかを返す
+func ReadFromPrimary(ctx context.Context) bool {
+	state, ok := ctx.Value(readYourWritesKey{}).(*readYourWrites)
+	return ok && state.primary.Load()
+}
+
+// MarkWritten は書き込みの成功を記録する. Handler の実装が書き込みの直後に呼ぶ
+// 以降の同じ ctx での読み取りはプライマリで行う
+func MarkWritten(ctx context.Context) {
+	state, ok := ctx.Value(readYourWritesKey{}).(*readYourWrites)
+	if !ok {
+		return
+	}
+	state.primary.Store(true)
+	if state.onWrite != nil {
+		state.onWrite(ctx)
+	}
+}
@@ -2,16 +2,98 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/aazw/go-base/pkg/models"
 )
 
+// Handler はデータの読み書きを行う
+// ユーザー, 監査ログ, outbox, webhook の操作は ctx に紐付けられたテナント (WithTenant) の範囲で行い, テナントが紐付けられていない場合は何も見えない
+// 全てのテナントを対象にする場合は WithCrossTenant を使う
 type Handler interface {
+	// GetTenant, GetTenantBySlug はテナントを返す. リクエストのテナントを特定するために使うため, ctx のテナントによらない
+	GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.Tenant, error)
+	GetTenantBySlug(ctx context.Context, slug string) (*models.Tenant, error)
+
 	ListUsers(ctx context.Context, params models.ListUsersParams) ([]*models.User, error)
 	CreateUser(ctx context.Context, prototype *models.UserPrototype) (*models.User, error)
 	GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error)
+
+	// GetUserForUpdate はユーザーを読み, トランザクションが終わるまで他の更新/削除を待たせる. RunInTx の中で呼ぶこと
+	// 更新/削除の前の状態 (監査ログ等) を読むために使う. キャッシュやレプリカからは読まない
+	GetUserForUpdate(ctx context.Context, userID uuid.UUID) (*models.User, error)
+
 	UpdateUser(ctx context.Context, userID uuid.UUID, prototype *models.UserPrototype) (*models.User, error)
 	DeleteUSer(ctx context.Context, userID uuid.UUID) error
+
+	// ListUsersAfter は name, id の順で params の位置より後のユーザーを最大 params.Limit 件返す
+	ListUsersAfter(ctx context.Context, params models.ListUsersAfterParams) ([]*models.User, error)
+
+	// SearchUsers は params.Query に一致するユーザーを関連度 (Rank) の高い順に最大 params.Limit 件返す. Highlights は設定しない
+	SearchUsers(ctx context.Context, params models.SearchUsersParams) ([]*models.UserSearchResult, error)
+
+	// ImportUsers は prototypes をまとめて作成する. prototypes の email は互いに重複していないこと
+	// email が既存のユーザーと重複する行は作成せず, updateDuplicates が true の場合は既存のユーザーの name を更新する (同じ name であれば更新しない)
+	// 作成したユーザーと更新したユーザー (更新前の状態と共に) を返す. どちらにも含まれない行は重複して書き込まなかった行
+	ImportUsers(ctx context.Context, prototypes []*models.UserPrototype, updateDuplicates bool) (created []*models.User, updated []*models.UserImportUpdate, err error)
+
+	// RunInTx は fn を1つのトランザクションで実行する. fn に渡される ctx で呼んだ操作は同じトランザクションに含まれる
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+
+	// AppendEvent はイベントを outbox に書き込む. RunInTx の中で呼ぶと変更と同じトランザクションで記録される
+	AppendEvent(ctx context.Context, event *models.Event) error
+
+	// ProcessOutbox は配信待ちのイベントを最大 limit 件取り出して publish に渡し, 結果を記録する. 処理した件数を返す
+	// 取り出したイベントは lease の間は他から取り出されない. publish はトランザクションの外で呼ぶ
+	ProcessOutbox(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, publish func(ctx context.Context, event *models.Event) error) (int, error)
+
+	// AppendAuditEvent は監査ログを書き込む. RunInTx の中で呼ぶと変更と同じトランザクションで記録される
+	AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error
+
+	// ListAuditEvents は params に一致する監査ログを新しい順に最大 params.Limit 件返す
+	ListAuditEvents(ctx context.Context, params models.ListAuditEventsParams) ([]*models.AuditEvent, error)
+
+	// PurgeAuditEvents は before より前に発生した監査ログを削除する. 削除した件数を返す
+	PurgeAuditEvents(ctx context.Context, before time.Time) (int64, error)
+
+	// PurgeOutboxEvents は before より前に配信済みになったイベントを削除する. 削除した件数を返す
+	PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+
+	ListWebhooks(ctx context.Context) ([]*models.Webhook, error)
+	CreateWebhook(ctx context.Context, prototype *models.WebhookPrototype) (*models.Webhook, error)
+	GetWebhook(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhookID uuid.UUID, prototype *models.WebhookPrototype) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error
+
+	// EnqueueWebhookDeliveries は event を配信対象の全ての webhook への配信として登録する. 登録した件数を返す
+	// 配信対象は ctx によらず event.TenantID のテナントの webhook に限る
+	EnqueueWebhookDeliveries(ctx context.Context, event *models.Event, payload []byte) (int, error)
+
+	// ProcessWebhookDeliveries は配信待ちの配信を最大 limit 件取り出して deliver に渡し, 試行と結果を記録する. 処理した件数を返す
+	// 取り出した配信は lease の間は他から取り出されない. deliver はトランザクションの外で呼ぶ
+	ProcessWebhookDeliveries(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, maxConsecutiveFailures int, deliver func(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt) (int, error)
+
+	ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, params models.ListWebhookDeliveriesParams) ([]*models.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error)
+	RedeliverWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error)
+
+	// PurgeWebhookDeliveries は before より前に完了した配信を削除する. 削除した件数を返す
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+	// API キーの操作は ctx のテナントの範囲で行う. 認証でキーを引く場合は WithCrossTenant を使う
+	ListAPIKeys(ctx context.Context) ([]*models.APIKey, error)
+	CreateAPIKey(ctx context.Context, prototype *models.APIKeyPrototype) (*models.APIKey, error)
+	GetAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+
+	// RevokeAPIKey はキーを失効させる. 失効済みの場合は何もせずにそのキーを返す
+	RevokeAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error)
+
+	// ExpireAPIKey はキーの期限を expiresAt までに短くする. 既に期限が早い場合はそのまま
+	ExpireAPIKey(ctx context.Context, apiKeyID uuid.UUID, expiresAt time.Time) (*models.APIKey, error)
+
+	// TouchAPIKey はキーの最終使用日時を記録する. 前回の記録から interval が経っていない場合は何もしない
+	TouchAPIKey(ctx context.Context, apiKeyID uuid.UUID, interval time.Duration) error
 }
@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+func (p *Handler) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+
+	var records []apiKeyRecord
+	_ = p.read(ctx, func(s *state) error {
+		for _, r := range s.apiKeys {
+			if visible(ctx, r.apiKey.TenantID) {
+				records = append(records, *r)
+			}
+		}
+		return nil
+	})
+
+	// ORDER BY created_at, id
+	slices.SortFunc(records, func(a, b apiKeyRecord) int {
+		return cmp.Or(a.apiKey.CreatedAt.Compare(b.apiKey.CreatedAt), cmp.Compare(a.seq, b.seq))
+	})
+	items := make([]*models.APIKey, 0, len(records))
+	for _, r := range records {
+		items = append(items, copyAPIKey(&r.apiKey))
+	}
+	return items, nil
+}
+
+// CreateAPIKey は ctx のテナントのキーとして書き込む
+func (p *Handler) CreateAPIKey(ctx context.Context, prototype *models.APIKeyPrototype) (*models.APIKey, error) {
+
+	tenantID, err := currentTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiKey *models.APIKey
+	err = p.write(ctx, func(s *state) error {
+		if _, ok := s.apiKeys[prototype.ID]; ok {
+			return cerrors.ErrDBDuplicate.New(
+				cerrors.WithMessage("duplicate api key id"),
+			)
+		}
+		for _, r := range s.apiKeys {
+			if r.apiKey.Prefix == prototype.Prefix {
+				return cerrors.ErrDBDuplicate.New(
+					cerrors.WithMessage("duplicate api key prefix"),
+				)
+			}
+		}
+		t := now()
+		r := &apiKeyRecord{
+			apiKey: models.APIKey{
+				ID:          prototype.ID,
+				TenantID:    tenantID,
+				Name:        prototype.Name,
+				Prefix:      prototype.Prefix,
+				SecretHash:  slices.Clone(prototype.SecretHash),
+				Scopes:      slices.Clone(prototype.Scopes),
+				ExpiresAt:   prototype.ExpiresAt.Truncate(time.Microsecond),
+				RotatedFrom: prototype.RotatedFrom,
+				CreatedAt:   t,
+				UpdatedAt:   t,
+			},
+			seq: p.seq.Add(1),
+		}
+		// rate_limit_rps が NULL の場合は burst も使わない (PostgreSQL の実装と同じ)
+		if prototype.RateLimitRPS > 0 {
+			r.apiKey.RateLimitRPS = prototype.RateLimitRPS
+			r.apiKey.RateLimitBurst = prototype.RateLimitBurst
+		}
+		s.apiKeys[r.apiKey.ID] = r
+		apiKey = copyAPIKey(&r.apiKey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func (p *Handler) GetAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+
+	var apiKey *models.APIKey
+	err := p.read(ctx, func(s *state) error {
+		r, ok := s.apiKeys[apiKeyID]
+		if !ok || !visible(ctx, r.apiKey.TenantID) {
+			return newNotFoundError()
+		}
+		apiKey = copyAPIKey(&r.apiKey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func (p *Handler) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+
+	var apiKey *models.APIKey
+	err := p.read(ctx, func(s *state) error {
+		for _, r := range s.apiKeys {
+			if r.apiKey.Prefix == prefix && visible(ctx, r.apiKey.TenantID) {
+				apiKey = copyAPIKey(&r.apiKey)
+				return nil
+			}
+		}
+		return newNotFoundError()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func (p *Handler) RevokeAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+
+	return p.updateAPIKey(ctx, apiKeyID, func(k *models.APIKey, t time.Time) {
+		if k.RevokedAt.IsZero() {
+			k.RevokedAt = t
+		}
+	})
+}
+
+func (p *Handler) ExpireAPIKey(ctx context.Context, apiKeyID uuid.UUID, expiresAt time.Time) (*models.APIKey, error) {
+
+	expiresAt = expiresAt.Truncate(time.Microsecond)
+	return p.updateAPIKey(ctx, apiKeyID, func(k *models.APIKey, t time.Time) {
+		if k.ExpiresAt.IsZero() || expiresAt.Before(k.ExpiresAt) {
+			k.ExpiresAt = expiresAt
+		}
+	})
+}
+
+func (p *Handler) TouchAPIKey(ctx context.Context, apiKeyID uuid.UUID, interval time.Duration) error {
+
+	_ = p.write(ctx, func(s *state) error {
+		r, ok := s.apiKeys[apiKeyID]
+		if !ok || !visible(ctx, r.apiKey.TenantID) {
+			return nil
+		}
+		t := now()
+		if r.apiKey.LastUsedAt.IsZero() || r.apiKey.LastUsedAt.Before(t.Add(-interval)) {
+			r.apiKey.LastUsedAt = t
+		}
+		return nil
+	})
+	return nil
+}
+
+// updateAPIKey は fn でキーを変更し, updated_at を更新する
+func (p *Handler) updateAPIKey(ctx context.Context, apiKeyID uuid.UUID, fn func(k *models.APIKey, t time.Time)) (*models.APIKey, error) {
+
+	var apiKey *models.APIKey
+	err := p.write(ctx, func(s *state) error {
+		r, ok := s.apiKeys[apiKeyID]
+		if !ok || !visible(ctx, r.apiKey.TenantID) {
+			return newNotFoundError()
+		}
+		t := now()
+		fn(&r.apiKey, t)
+		r.apiKey.UpdatedAt = t
+		apiKey = copyAPIKey(&r.apiKey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func copyAPIKey(k *models.APIKey) *models.APIKey {
+	copied := *k
+	copied.SecretHash = slices.Clone(k.SecretHash)
+	copied.Scopes = slices.Clone(k.Scopes)
+	return &copied
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// AppendAuditEvent は ctx のテナントの監査ログとして書き込む
+func (p *Handler) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+
+	tenantID, err := currentTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	return p.write(ctx, func(s *state) error {
+		if _, ok := s.auditEvents[event.ID]; ok {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithMessage("duplicate audit event id"),
+			)
+		}
+		copied := *event
+		copied.TenantID = tenantID
+		copied.Before = slices.Clone(event.Before)
+		copied.After = slices.Clone(event.After)
+		s.auditEvents[event.ID] = &copied
+		return nil
+	})
+}
+
+// ListAuditEvents は params に一致する監査ログを id の降順に最大 params.Limit 件返す
+func (p *Handler) ListAuditEvents(ctx context.Context, params models.ListAuditEventsParams) ([]*models.AuditEvent, error) {
+
+	items := []*models.AuditEvent{}
+	_ = p.read(ctx, func(s *state) error {
+		for _, event := range s.auditEvents {
+			if visible(ctx, event.TenantID) && matchAuditEvent(event, params) {
+				copied := *event
+				items = append(items, &copied)
+			}
+		}
+		return nil
+	})
+
+	// ORDER BY id DESC
+	slices.SortFunc(items, func(a, b *models.AuditEvent) int {
+		return bytes.Compare(b.ID[:], a.ID[:])
+	})
+	if len(items) > params.Limit {
+		items = items[:params.Limit]
+	}
+	return items, nil
+}
+
+func matchAuditEvent(event *models.AuditEvent, params models.ListAuditEventsParams) bool {
+	switch {
+	case params.Action != "" && event.Action != params.Action,
+		params.ActorType != "" && event.Actor.Type != params.ActorType,
+		params.ActorID != "" && event.Actor.ID != params.ActorID,
+		params.TargetType != "" && event.TargetType != params.TargetType,
+		params.TargetID != uuid.Nil && event.TargetID != params.TargetID,
+		!params.Since.IsZero() && event.OccurredAt.Before(params.Since),
+		!params.Until.IsZero() && !event.OccurredAt.Before(params.Until),
+		params.Cursor != uuid.Nil && bytes.Compare(event.ID[:], params.Cursor[:]) >= 0:
+		return false
+	}
+	return true
+}
+
+func (p *Handler) PurgeAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+
+	var n int64
+	_ = p.write(ctx, func(s *state) error {
+		for id, event := range s.auditEvents {
+			if visible(ctx, event.TenantID) && event.OccurredAt.Before(before) {
+				delete(s.auditEvents, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, nil
+}
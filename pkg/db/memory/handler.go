@@ -0,0 +1,972 @@
+// Package memory はメモリ上に保存する db.Handler の実装. テストとローカルでの実行 (goapp --storage=memory) 用
+//
+// PostgreSQL の実装と同じエラー (存在しない場合の ErrDBNotFound, email の重複の ErrDBDuplicate 等) と並び順を再現する
+// トランザクションは Handler 全体のロックで直列に実行し, fn がエラーを返した場合は開始時点の状態に戻す
+// ユーザー, 監査ログ, API キー, outbox, webhook は Row Level Security と同じく ctx のテナント (db.WithTenant, db.WithCrossTenant) の範囲だけを扱う
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// last_error 等に保存するエラーメッセージの最大長 (PostgreSQL の実装と同じ)
+const maxErrorLength = 1000
+
+const (
+	outboxStatusPending   = "pending"
+	outboxStatusPublished = "published"
+	outboxStatusDead      = "dead"
+)
+
+type Handler struct {
+	mu    sync.RWMutex
+	state *state
+
+	// 作成順 (created_at が同じ場合の並び順) を決めるための連番
+	seq atomic.Int64
+}
+
+var _ db.Handler = (*Handler)(nil)
+
+func NewHandler() (*Handler, error) {
+
+	s := newState()
+	t := now()
+	s.tenants[models.DefaultTenantID] = &models.Tenant{
+		ID:        models.DefaultTenantID,
+		Slug:      "default",
+		Name:      "Default",
+		CreatedAt: t,
+		UpdatedAt: t,
+	}
+	return &Handler{
+		state: s,
+	}, nil
+}
+
+// state は保存しているデータ. トランザクションの開始時に複製し, ロールバックでは複製に差し替える
+type state struct {
+	users      map[uuid.UUID]*userRecord
+	outbox     map[uuid.UUID]*outboxRecord
+	webhooks   map[uuid.UUID]*webhookRecord
+	deliveries map[uuid.UUID]*deliveryRecord
+	apiKeys    map[uuid.UUID]*apiKeyRecord
+
+	// 監査ログとテナントは書き込んだ後に変更しないため, 複製でも同じものを共有する
+	auditEvents map[uuid.UUID]*models.AuditEvent
+	tenants     map[uuid.UUID]*models.Tenant
+}
+
+type userRecord struct {
+	user models.User
+}
+
+type outboxRecord struct {
+	event         models.Event
+	status        string
+	lastError     string
+	nextAttemptAt time.Time
+	publishedAt   time.Time
+	seq           int64
+}
+
+type webhookRecord struct {
+	webhook models.Webhook
+	seq     int64
+}
+
+type deliveryRecord struct {
+	delivery models.WebhookDelivery
+	seq      int64
+}
+
+type apiKeyRecord struct {
+	apiKey models.APIKey
+	seq    int64
+}
+
+func newState() *state {
+	return &state{
+		users:      map[uuid.UUID]*userRecord{},
+		outbox:     map[uuid.UUID]*outboxRecord{},
+		webhooks:   map[uuid.UUID]*webhookRecord{},
+		deliveries: map[uuid.UUID]*deliveryRecord{},
+		apiKeys:    map[uuid.UUID]*apiKeyRecord{},
+
+		auditEvents: map[uuid.UUID]*models.AuditEvent{},
+		tenants:     map[uuid.UUID]*models.Tenant{},
+	}
+}
+
+func (s *state) clone() *state {
+	c := newState()
+	for id, r := range s.users {
+		copied := *r
+		c.users[id] = &copied
+	}
+	for id, r := range s.outbox {
+		copied := *r
+		copied.event.TraceContext = cloneMap(r.event.TraceContext)
+		c.outbox[id] = &copied
+	}
+	for id, r := range s.webhooks {
+		copied := *r
+		copied.webhook.EventTypes = slices.Clone(r.webhook.EventTypes)
+		c.webhooks[id] = &copied
+	}
+	for id, r := range s.deliveries {
+		copied := *r
+		copied.delivery.AttemptLog = slices.Clone(r.delivery.AttemptLog)
+		c.deliveries[id] = &copied
+	}
+	for id, r := range s.apiKeys {
+		copied := *r
+		copied.apiKey.Scopes = slices.Clone(r.apiKey.Scopes)
+		c.apiKeys[id] = &copied
+	}
+	maps.Copy(c.auditEvents, s.auditEvents)
+	maps.Copy(c.tenants, s.tenants)
+	return c
+}
+
+type txKey struct{}
+
+// tx は実行中のトランザクション. 終了後にその ctx が使われてもロック無しで操作しないよう done で区別する
+type tx struct {
+	handler *Handler
+	done    atomic.Bool
+}
+
+func (p *Handler) inTx(ctx context.Context) bool {
+	t, ok := ctx.Value(txKey{}).(*tx)
+	return ok && t.handler == p && !t.done.Load()
+}
+
+// RunInTx は fn を1つのトランザクションで実行する. 実行中は他の操作を待たせ, fn がエラーを返すと変更を取り消す
+// 既にトランザクション中の ctx で呼ばれた場合はそのトランザクションに合流する
+func (p *Handler) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	if p.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := &tx{handler: p}
+	defer t.done.Store(true)
+
+	snapshot := p.state.clone()
+	if err := fn(context.WithValue(ctx, txKey{}, t)); err != nil {
+		p.state = snapshot
+		return err
+	}
+	return nil
+}
+
+// read は読み取りの操作を実行する. トランザクション中であればそのトランザクションで実行する
+func (p *Handler) read(ctx context.Context, fn func(s *state) error) error {
+	if p.inTx(ctx) {
+		return fn(p.state)
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return fn(p.state)
+}
+
+// write は書き込みの操作を実行する. トランザクション中であればそのトランザクションで実行する
+func (p *Handler) write(ctx context.Context, fn func(s *state) error) error {
+	if p.inTx(ctx) {
+		return fn(p.state)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fn(p.state)
+}
+
+// now は PostgreSQL の timestamptz と同じ精度 (マイクロ秒) の現在時刻を返す
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func newNotFoundError() error {
+	return cerrors.ErrDBNotFound.New(
+		cerrors.WithMessage("record not found"),
+	)
+}
+
+// visible は tenantID の行が ctx から見えるかを返す (Row Level Security のポリシーと同じ)
+func visible(ctx context.Context, tenantID uuid.UUID) bool {
+	if db.IsCrossTenant(ctx) {
+		return true
+	}
+	id, ok := db.TenantFromContext(ctx)
+	return ok && id == tenantID
+}
+
+// currentTenant は書き込む行のテナントを返す. PostgreSQL の実装では tenant_id が NULL になり NOT NULL 制約で失敗する
+func currentTenant(ctx context.Context) (uuid.UUID, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return uuid.Nil, cerrors.ErrDBOperation.New(
+			cerrors.WithMessage("tenant is not set"),
+		)
+	}
+	return tenantID, nil
+}
+
+func (p *Handler) ListUsers(ctx context.Context, params models.ListUsersParams) ([]*models.User, error) {
+
+	users := []*models.User{}
+	_ = p.read(ctx, func(s *state) error {
+		for _, r := range s.users {
+			if !visible(ctx, r.user.TenantID) {
+				continue
+			}
+			user := r.user
+			users = append(users, &user)
+		}
+		return nil
+	})
+
+	// ORDER BY name
+	slices.SortFunc(users, func(a, b *models.User) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID.String(), b.ID.String()))
+	})
+	return users, nil
+}
+
+func (p *Handler) CreateUser(ctx context.Context, prototype *models.UserPrototype) (*models.User, error) {
+
+	tenantID, err := currentTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = p.write(ctx, func(s *state) error {
+		if _, ok := s.users[prototype.ID]; ok {
+			return cerrors.ErrDBDuplicate.New(
+				cerrors.WithMessage("duplicate user id"),
+			)
+		}
+		if emailTaken(s, tenantID, prototype.Email, uuid.Nil) {
+			return cerrors.ErrDBDuplicate.New(
+				cerrors.WithMessage("duplicate email"),
+			)
+		}
+		t := now()
+		user = models.User{
+			ID:        prototype.ID,
+			TenantID:  tenantID,
+			Name:      prototype.Name,
+			Email:     prototype.Email,
+			CreatedAt: t,
+			UpdatedAt: t,
+		}
+		s.users[user.ID] = &userRecord{user: user}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return &user, nil
+}
+
+func (p *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+
+	var user models.User
+	err := p.read(ctx, func(s *state) error {
+		r, ok := s.users[userID]
+		if !ok || !visible(ctx, r.user.TenantID) {
+			return newNotFoundError()
+		}
+		user = r.user
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserForUpdate は GetUser と同じ. トランザクション (RunInTx) は他の読み書きを待たせるため, 行のロックは要らない
+func (p *Handler) GetUserForUpdate(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	return p.GetUser(ctx, userID)
+}
+
+// UpdateUser は name と email を更新する. PostgreSQL の実装と同じく updated_at は変えない
+func (p *Handler) UpdateUser(ctx context.Context, userID uuid.UUID, prototype *models.UserPrototype) (*models.User, error) {
+
+	var user models.User
+	err := p.write(ctx, func(s *state) error {
+		r, ok := s.users[userID]
+		if !ok || !visible(ctx, r.user.TenantID) {
+			return newNotFoundError()
+		}
+		if emailTaken(s, r.user.TenantID, prototype.Email, userID) {
+			return cerrors.ErrDBDuplicate.New(
+				cerrors.WithMessage("duplicate email"),
+			)
+		}
+		r.user.Name = prototype.Name
+		r.user.Email = prototype.Email
+		user = r.user
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return &user, nil
+}
+
+func (p *Handler) DeleteUSer(ctx context.Context, userID uuid.UUID) error {
+
+	err := p.write(ctx, func(s *state) error {
+		if r, ok := s.users[userID]; !ok || !visible(ctx, r.user.TenantID) {
+			return newNotFoundError()
+		}
+		delete(s.users, userID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.MarkWritten(ctx)
+	return nil
+}
+
+func (p *Handler) ListUsersAfter(ctx context.Context, params models.ListUsersAfterParams) ([]*models.User, error) {
+
+	users, _ := p.ListUsers(ctx, models.ListUsersParams{})
+
+	// WHERE (name, id) > (after_name, after_id) ORDER BY name, id LIMIT row_limit
+	i, _ := slices.BinarySearchFunc(users, params, func(u *models.User, params models.ListUsersAfterParams) int {
+		return cmp.Or(cmp.Compare(u.Name, params.AfterName), cmp.Compare(u.ID.String(), params.AfterID.String()))
+	})
+	if i < len(users) && users[i].Name == params.AfterName && users[i].ID == params.AfterID {
+		i++
+	}
+	users = users[i:]
+	if len(users) > params.Limit {
+		users = users[:params.Limit]
+	}
+	return users, nil
+}
+
+func (p *Handler) ImportUsers(ctx context.Context, prototypes []*models.UserPrototype, updateDuplicates bool) ([]*models.User, []*models.UserImportUpdate, error) {
+
+	tenantID, err := currentTenant(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	created := []*models.User{}
+	updated := []*models.UserImportUpdate{}
+	err = p.write(ctx, func(s *state) error {
+		byEmail := make(map[string]*userRecord, len(s.users))
+		for _, r := range s.users {
+			if r.user.TenantID == tenantID {
+				byEmail[r.user.Email] = r
+			}
+		}
+
+		// 途中で失敗した場合は何も書き込まない (1 つの INSERT と同じ)
+		records := map[uuid.UUID]*userRecord{}
+		t := now()
+		for _, prototype := range prototypes {
+			if r, ok := byEmail[prototype.Email]; ok {
+				// ON CONFLICT (tenant_id, email) DO UPDATE ... WHERE users.name IS DISTINCT FROM EXCLUDED.name
+				if updateDuplicates && r.user.Name != prototype.Name {
+					copied := *r
+					copied.user.Name = prototype.Name
+					records[copied.user.ID] = &copied
+					before, after := r.user, copied.user
+					updated = append(updated, &models.UserImportUpdate{Before: &before, After: &after})
+				}
+				continue
+			}
+			if _, ok := s.users[prototype.ID]; ok {
+				return cerrors.ErrDBDuplicate.New(
+					cerrors.WithMessage("duplicate user id"),
+				)
+			}
+			user := models.User{
+				ID:        prototype.ID,
+				TenantID:  tenantID,
+				Name:      prototype.Name,
+				Email:     prototype.Email,
+				CreatedAt: t,
+				UpdatedAt: t,
+			}
+			records[user.ID] = &userRecord{user: user}
+			created = append(created, &user)
+		}
+		for id, r := range records {
+			s.users[id] = r
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(created) > 0 || len(updated) > 0 {
+		db.MarkWritten(ctx)
+	}
+	return created, updated, nil
+}
+
+// emailTaken は tenantID のテナントで exceptID 以外のユーザーが email を使っているかを返す (users_tenant_email_key)
+func emailTaken(s *state, tenantID uuid.UUID, email string, exceptID uuid.UUID) bool {
+	for id, r := range s.users {
+		if id != exceptID && r.user.TenantID == tenantID && r.user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Handler) AppendEvent(ctx context.Context, event *models.Event) error {
+
+	// WITH CHECK (tenant_id = app_current_tenant_id() OR app_cross_tenant())
+	if !visible(ctx, event.TenantID) {
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithMessagef("event tenant %s is not the current tenant", event.TenantID),
+		)
+	}
+	return p.write(ctx, func(s *state) error {
+		if _, ok := s.outbox[event.ID]; ok {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithMessage("duplicate event id"),
+			)
+		}
+		copied := *event
+		copied.TraceContext = cloneMap(event.TraceContext)
+		copied.Attempts = 0
+		s.outbox[event.ID] = &outboxRecord{
+			event:         copied,
+			status:        outboxStatusPending,
+			nextAttemptAt: now(),
+			seq:           p.seq.Add(1),
+		}
+		return nil
+	})
+}
+
+// ProcessOutbox は配信待ちのイベントを古い順に最大 limit 件 publish に渡し, 結果を記録する. 処理した件数を返す
+// PostgreSQL と同じく, 取り出したイベントの next_attempt_at を lease の後にしてからロックの外で publish を呼び, 結果を1件ずつ記録する
+func (p *Handler) ProcessOutbox(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, publish func(ctx context.Context, event *models.Event) error) (int, error) {
+
+	var claims []models.Event
+	err := p.RunInTx(ctx, func(ctx context.Context) error {
+
+		t := now()
+		var records []*outboxRecord
+		for _, r := range p.state.outbox {
+			if visible(ctx, r.event.TenantID) && r.status == outboxStatusPending && !r.nextAttemptAt.After(t) {
+				records = append(records, r)
+			}
+		}
+		slices.SortFunc(records, func(a, b *outboxRecord) int {
+			return cmp.Or(a.event.OccurredAt.Compare(b.event.OccurredAt), cmp.Compare(a.seq, b.seq))
+		})
+		if len(records) > limit {
+			records = records[:limit]
+		}
+		for _, r := range records {
+			r.nextAttemptAt = t.Add(lease)
+			event := r.event
+			event.TraceContext = cloneMap(r.event.TraceContext)
+			claims = append(claims, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, event := range claims {
+		if ctx.Err() != nil {
+			break
+		}
+
+		pubErr := publish(ctx, &event)
+		_ = p.write(ctx, func(s *state) error {
+			r, ok := s.outbox[event.ID]
+			// リースが切れて他で記録済み
+			if !ok || r.status != outboxStatusPending || r.event.Attempts != event.Attempts {
+				return nil
+			}
+			r.event.Attempts++
+			if pubErr != nil {
+				backoff, dead := policy.Next(r.event.Attempts)
+				if dead {
+					r.status = outboxStatusDead
+				}
+				r.lastError = truncateError(pubErr.Error())
+				r.nextAttemptAt = now().Add(backoff)
+			} else {
+				r.status = outboxStatusPublished
+				r.lastError = ""
+				r.publishedAt = now()
+			}
+			return nil
+		})
+		processed++
+	}
+	return processed, nil
+}
+
+// PurgeOutboxEvents は before より前に配信済みになったイベントを削除する. 削除した件数を返す
+func (p *Handler) PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+
+	var n int64
+	_ = p.write(ctx, func(s *state) error {
+		for id, r := range s.outbox {
+			if visible(ctx, r.event.TenantID) && r.status == outboxStatusPublished && r.publishedAt.Before(before) {
+				delete(s.outbox, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, nil
+}
+
+func (p *Handler) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+
+	var records []webhookRecord
+	_ = p.read(ctx, func(s *state) error {
+		for _, r := range s.webhooks {
+			if visible(ctx, r.webhook.TenantID) {
+				records = append(records, *r)
+			}
+		}
+		return nil
+	})
+
+	// ORDER BY created_at
+	slices.SortFunc(records, func(a, b webhookRecord) int {
+		return cmp.Or(a.webhook.CreatedAt.Compare(b.webhook.CreatedAt), cmp.Compare(a.seq, b.seq))
+	})
+	items := []*models.Webhook{}
+	for _, r := range records {
+		items = append(items, copyWebhook(&r.webhook))
+	}
+	return items, nil
+}
+
+func (p *Handler) CreateWebhook(ctx context.Context, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+
+	tenantID, err := currentTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook *models.Webhook
+	err = p.write(ctx, func(s *state) error {
+		if _, ok := s.webhooks[prototype.ID]; ok {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithMessage("duplicate webhook id"),
+			)
+		}
+		t := now()
+		r := &webhookRecord{
+			webhook: models.Webhook{
+				ID:          prototype.ID,
+				TenantID:    tenantID,
+				URL:         prototype.URL,
+				Description: prototype.Description,
+				EventTypes:  slices.Clone(prototype.EventTypes),
+				Secret:      prototype.Secret,
+				Enabled:     prototype.Enabled,
+				CreatedAt:   t,
+				UpdatedAt:   t,
+			},
+			seq: p.seq.Add(1),
+		}
+		s.webhooks[r.webhook.ID] = r
+		webhook = copyWebhook(&r.webhook)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return webhook, nil
+}
+
+func (p *Handler) GetWebhook(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error) {
+
+	var webhook *models.Webhook
+	err := p.read(ctx, func(s *state) error {
+		r, ok := s.webhooks[webhookID]
+		if !ok || !visible(ctx, r.webhook.TenantID) {
+			return newNotFoundError()
+		}
+		webhook = copyWebhook(&r.webhook)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// UpdateWebhook は webhook を更新する. 無効から有効に戻した場合は連続失敗回数をリセットする
+func (p *Handler) UpdateWebhook(ctx context.Context, webhookID uuid.UUID, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+
+	var webhook *models.Webhook
+	err := p.write(ctx, func(s *state) error {
+		r, ok := s.webhooks[webhookID]
+		if !ok || !visible(ctx, r.webhook.TenantID) {
+			return newNotFoundError()
+		}
+		w := &r.webhook
+		w.URL = prototype.URL
+		w.Description = prototype.Description
+		w.EventTypes = slices.Clone(prototype.EventTypes)
+		w.Secret = prototype.Secret
+		if prototype.Enabled && !w.Enabled {
+			w.ConsecutiveFailures = 0
+		}
+		if prototype.Enabled {
+			w.DisabledReason = ""
+		}
+		w.Enabled = prototype.Enabled
+		w.UpdatedAt = now()
+		webhook = copyWebhook(w)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return webhook, nil
+}
+
+// DeleteWebhook は webhook を配信ごと削除する
+func (p *Handler) DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error {
+
+	err := p.write(ctx, func(s *state) error {
+		if r, ok := s.webhooks[webhookID]; !ok || !visible(ctx, r.webhook.TenantID) {
+			return newNotFoundError()
+		}
+		delete(s.webhooks, webhookID)
+		for id, r := range s.deliveries {
+			if r.delivery.WebhookID == webhookID {
+				delete(s.deliveries, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.MarkWritten(ctx)
+	return nil
+}
+
+// EnqueueWebhookDeliveries は event を配信対象の全ての webhook への配信として登録する. 登録した件数を返す
+// 配信対象は event のテナントの webhook に限る. 同じイベントが複数回渡された場合は重複して登録しない
+func (p *Handler) EnqueueWebhookDeliveries(ctx context.Context, event *models.Event, payload []byte) (int, error) {
+
+	enqueued := 0
+	err := p.write(ctx, func(s *state) error {
+		for _, w := range s.webhooks {
+			if w.webhook.TenantID != event.TenantID || !visible(ctx, w.webhook.TenantID) || !w.webhook.Enabled || !w.webhook.Matches(event.Type) {
+				continue
+			}
+			if hasDelivery(s, w.webhook.ID, event.ID) {
+				continue
+			}
+			id, err := uuid.NewV7()
+			if err != nil {
+				return cerrors.ErrSystemInternal.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("failed to generate delivery id"),
+				)
+			}
+			t := now()
+			s.deliveries[id] = &deliveryRecord{
+				delivery: models.WebhookDelivery{
+					ID:            id,
+					TenantID:      event.TenantID,
+					WebhookID:     w.webhook.ID,
+					EventID:       event.ID,
+					EventType:     event.Type,
+					Payload:       slices.Clone(payload),
+					Status:        models.WebhookDeliveryStatusPending,
+					NextAttemptAt: t,
+					CreatedAt:     t,
+					UpdatedAt:     t,
+				},
+				seq: p.seq.Add(1),
+			}
+			enqueued++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return enqueued, nil
+}
+
+// hasDelivery は webhook への event の配信が登録済みかを返す (webhook_deliveries_webhook_event_key)
+func hasDelivery(s *state, webhookID uuid.UUID, eventID uuid.UUID) bool {
+	for _, r := range s.deliveries {
+		if r.delivery.WebhookID == webhookID && r.delivery.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// ProcessWebhookDeliveries は配信待ちの配信を next_attempt_at の順に最大 limit 件 deliver に渡し, 試行と結果を記録する. 処理した件数を返す
+// PostgreSQL と同じく, 取り出した配信の next_attempt_at を lease の後にしてからロックの外で deliver を呼び, 結果を1件ずつ記録する
+// 失敗が maxConsecutiveFailures 回続いた webhook は無効にし, 同じバッチの残りの配信も行わない
+func (p *Handler) ProcessWebhookDeliveries(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, maxConsecutiveFailures int, deliver func(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt) (int, error) {
+
+	type claimed struct {
+		delivery *models.WebhookDelivery
+		webhook  *models.Webhook
+	}
+	var claims []claimed
+	err := p.RunInTx(ctx, func(ctx context.Context) error {
+
+		t := now()
+		var records []*deliveryRecord
+		for _, r := range p.state.deliveries {
+			w, ok := p.state.webhooks[r.delivery.WebhookID]
+			if ok && visible(ctx, r.delivery.TenantID) && w.webhook.Enabled && r.delivery.Status == models.WebhookDeliveryStatusPending && !r.delivery.NextAttemptAt.After(t) {
+				records = append(records, r)
+			}
+		}
+		slices.SortFunc(records, func(a, b *deliveryRecord) int {
+			return cmp.Or(a.delivery.NextAttemptAt.Compare(b.delivery.NextAttemptAt), cmp.Compare(a.seq, b.seq))
+		})
+		if len(records) > limit {
+			records = records[:limit]
+		}
+		for _, r := range records {
+			r.delivery.NextAttemptAt = t.Add(lease)
+			claims = append(claims, claimed{
+				delivery: copyDelivery(&r.delivery),
+				webhook:  copyWebhook(&p.state.webhooks[r.delivery.WebhookID].webhook),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	disabled := map[uuid.UUID]bool{}
+	for _, c := range claims {
+		if ctx.Err() != nil {
+			break
+		}
+		if disabled[c.webhook.ID] {
+			continue
+		}
+
+		attempt := deliver(ctx, c.delivery, c.webhook)
+		attempt.Attempt = c.delivery.Attempts + 1
+		attempt.Error = truncateError(attempt.Error)
+		_ = p.write(ctx, func(s *state) error {
+			r, ok := s.deliveries[c.delivery.ID]
+			// リースが切れて他で記録済み
+			if !ok || r.delivery.Status != models.WebhookDeliveryStatusPending || r.delivery.Attempts != c.delivery.Attempts {
+				return nil
+			}
+			d := &r.delivery
+			attempt.AttemptedAt = now()
+			d.AttemptLog = append(d.AttemptLog, attempt)
+			d.Attempts++
+			d.LastResponseCode = attempt.ResponseCode
+			d.UpdatedAt = attempt.AttemptedAt
+
+			w := &s.webhooks[d.WebhookID].webhook
+			if attempt.Succeeded() {
+				d.Status = models.WebhookDeliveryStatusSucceeded
+				d.LastError = ""
+				d.DeliveredAt = attempt.AttemptedAt
+				w.ConsecutiveFailures = 0
+				return nil
+			}
+			backoff, dead := policy.Next(attempt.Attempt)
+			if dead {
+				d.Status = models.WebhookDeliveryStatusFailed
+			}
+			d.LastError = attempt.Error
+			d.NextAttemptAt = attempt.AttemptedAt.Add(backoff)
+
+			w.ConsecutiveFailures++
+			if w.Enabled && w.ConsecutiveFailures >= maxConsecutiveFailures {
+				w.Enabled = false
+				w.DisabledReason = disabledReason(maxConsecutiveFailures)
+				disabled[w.ID] = true
+			}
+			w.UpdatedAt = attempt.AttemptedAt
+			return nil
+		})
+		processed++
+	}
+	return processed, nil
+}
+
+// ListWebhookDeliveries は webhook への配信を新しい順に最大 params.Limit 件返す
+func (p *Handler) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, params models.ListWebhookDeliveriesParams) ([]*models.WebhookDelivery, error) {
+
+	var records []deliveryRecord
+	_ = p.read(ctx, func(s *state) error {
+		for _, r := range s.deliveries {
+			if r.delivery.WebhookID == webhookID && visible(ctx, r.delivery.TenantID) {
+				records = append(records, *r)
+			}
+		}
+		return nil
+	})
+
+	// ORDER BY created_at DESC
+	slices.SortFunc(records, func(a, b deliveryRecord) int {
+		return cmp.Or(b.delivery.CreatedAt.Compare(a.delivery.CreatedAt), cmp.Compare(b.seq, a.seq))
+	})
+	if len(records) > params.Limit {
+		records = records[:params.Limit]
+	}
+	items := []*models.WebhookDelivery{}
+	for _, r := range records {
+		item := copyDelivery(&r.delivery)
+		item.AttemptLog = nil
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// GetWebhookDelivery は配信を試行の履歴と共に返す
+func (p *Handler) GetWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+
+	var delivery *models.WebhookDelivery
+	err := p.read(ctx, func(s *state) error {
+		r, ok := s.deliveries[deliveryID]
+		if !ok || r.delivery.WebhookID != webhookID || !visible(ctx, r.delivery.TenantID) {
+			return newNotFoundError()
+		}
+		delivery = copyDelivery(&r.delivery)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if delivery.AttemptLog == nil {
+		delivery.AttemptLog = []*models.WebhookDeliveryAttempt{}
+	}
+	return delivery, nil
+}
+
+// RedeliverWebhookDelivery は配信を配信待ちに戻し, 直ちに再送させる
+func (p *Handler) RedeliverWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+
+	var delivery *models.WebhookDelivery
+	err := p.write(ctx, func(s *state) error {
+		r, ok := s.deliveries[deliveryID]
+		if !ok || r.delivery.WebhookID != webhookID || !visible(ctx, r.delivery.TenantID) {
+			return newNotFoundError()
+		}
+		t := now()
+		r.delivery.Status = models.WebhookDeliveryStatusPending
+		r.delivery.NextAttemptAt = t
+		r.delivery.UpdatedAt = t
+		delivery = copyDelivery(&r.delivery)
+		delivery.AttemptLog = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return delivery, nil
+}
+
+// PurgeWebhookDeliveries は before より前に完了 (succeeded/failed) した配信を試行の履歴ごと削除する. 削除した件数を返す
+func (p *Handler) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+
+	var n int64
+	_ = p.write(ctx, func(s *state) error {
+		for id, r := range s.deliveries {
+			if visible(ctx, r.delivery.TenantID) && r.delivery.Status != models.WebhookDeliveryStatusPending && r.delivery.UpdatedAt.Before(before) {
+				delete(s.deliveries, id)
+				n++
+			}
+		}
+		return nil
+	})
+	return n, nil
+}
+
+func copyWebhook(w *models.Webhook) *models.Webhook {
+	copied := *w
+	copied.EventTypes = slices.Clone(w.EventTypes)
+	if copied.EventTypes == nil {
+		copied.EventTypes = []models.EventType{}
+	}
+	return &copied
+}
+
+func copyDelivery(d *models.WebhookDelivery) *models.WebhookDelivery {
+	copied := *d
+	copied.Payload = slices.Clone(d.Payload)
+	copied.AttemptLog = make([]*models.WebhookDeliveryAttempt, 0, len(d.AttemptLog))
+	for _, a := range d.AttemptLog {
+		attempt := *a
+		copied.AttemptLog = append(copied.AttemptLog, &attempt)
+	}
+	return &copied
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func disabledReason(maxConsecutiveFailures int) string {
+	return fmt.Sprintf("disabled after %d consecutive failed deliveries", maxConsecutiveFailures)
+}
+
+// truncateError はエラーメッセージを保存できる長さに切り詰める
+func truncateError(msg string) string {
+	if len(msg) > maxErrorLength {
+		return msg[:maxErrorLength]
+	}
+	return msg
+}
@@ -0,0 +1,674 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+func errorCodeOf(err error) string {
+	var cerr *cerrors.CustomError
+	if errors.As(err, &cerr) {
+		return cerr.Code()
+	}
+	return ""
+}
+
+var (
+	errorCodeDBNotFound  = errorCodeOf(cerrors.ErrDBNotFound.New())
+	errorCodeDBDuplicate = errorCodeOf(cerrors.ErrDBDuplicate.New())
+)
+
+// testContext はデフォルトのテナントに紐付けた ctx を返す
+func testContext() context.Context {
+	return db.WithTenant(context.Background(), models.DefaultTenantID)
+}
+
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	h, err := NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func createTestUser(t *testing.T, h *Handler, name string, email string) *models.User {
+	t.Helper()
+	user, err := h.CreateUser(testContext(), &models.UserPrototype{
+		ID:    uuid.Must(uuid.NewV7()),
+		Name:  name,
+		Email: email,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestHandler_Users(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+
+	bob := createTestUser(t, h, "bob", "bob@example.com")
+	alice := createTestUser(t, h, "alice", "alice@example.com")
+
+	// name の順
+	users, err := h.ListUsers(ctx, models.ListUsersParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != alice.ID || users[1].ID != bob.ID {
+		t.Fatalf("ListUsers() = %v; want [alice bob]", users)
+	}
+
+	got, err := h.GetUser(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *bob {
+		t.Errorf("GetUser() = %+v; want %+v", got, bob)
+	}
+
+	// 返した値を変更しても保存している値は変わらない
+	got.Name = "changed"
+	if got, _ := h.GetUser(ctx, bob.ID); got.Name != "bob" {
+		t.Errorf("GetUser().Name = %q after modifying returned value; want bob", got.Name)
+	}
+
+	updated, err := h.UpdateUser(ctx, bob.ID, &models.UserPrototype{Name: "robert", Email: "robert@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "robert" || updated.Email != "robert@example.com" || !updated.CreatedAt.Equal(bob.CreatedAt) {
+		t.Errorf("UpdateUser() = %+v", updated)
+	}
+
+	if err := h.DeleteUSer(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.GetUser(ctx, bob.ID); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetUser() after delete error = %v; want ErrDBNotFound", err)
+	}
+}
+
+func TestHandler_NotFound(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+	id := uuid.Must(uuid.NewV7())
+
+	if _, err := h.GetUser(ctx, id); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetUser() error = %v; want ErrDBNotFound", err)
+	}
+	if _, err := h.UpdateUser(ctx, id, &models.UserPrototype{Name: "a", Email: "a@example.com"}); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("UpdateUser() error = %v; want ErrDBNotFound", err)
+	}
+	if err := h.DeleteUSer(ctx, id); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("DeleteUSer() error = %v; want ErrDBNotFound", err)
+	}
+	if _, err := h.GetWebhook(ctx, id); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetWebhook() error = %v; want ErrDBNotFound", err)
+	}
+}
+
+func TestHandler_UniqueEmail(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+
+	alice := createTestUser(t, h, "alice", "alice@example.com")
+	bob := createTestUser(t, h, "bob", "bob@example.com")
+
+	_, err := h.CreateUser(ctx, &models.UserPrototype{ID: uuid.Must(uuid.NewV7()), Name: "alice2", Email: "alice@example.com"})
+	if errorCodeOf(err) != errorCodeDBDuplicate {
+		t.Errorf("CreateUser() with duplicate email error = %v; want ErrDBDuplicate", err)
+	}
+	_, err = h.UpdateUser(ctx, bob.ID, &models.UserPrototype{Name: "bob", Email: "alice@example.com"})
+	if errorCodeOf(err) != errorCodeDBDuplicate {
+		t.Errorf("UpdateUser() with duplicate email error = %v; want ErrDBDuplicate", err)
+	}
+
+	// 自分自身の email のままの更新は重複にならない
+	if _, err := h.UpdateUser(ctx, alice.ID, &models.UserPrototype{Name: "alice", Email: "alice@example.com"}); err != nil {
+		t.Errorf("UpdateUser() with own email error = %v; want nil", err)
+	}
+}
+
+func TestHandler_RunInTx_Rollback(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "alice@example.com")
+
+	errTest := errors.New("test")
+	err := h.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := h.UpdateUser(ctx, alice.ID, &models.UserPrototype{Name: "changed", Email: "changed@example.com"}); err != nil {
+			return err
+		}
+		if _, err := h.CreateUser(ctx, &models.UserPrototype{ID: uuid.Must(uuid.NewV7()), Name: "bob", Email: "bob@example.com"}); err != nil {
+			return err
+		}
+		// トランザクション中は変更が見える
+		if got, _ := h.GetUser(ctx, alice.ID); got.Name != "changed" {
+			t.Errorf("GetUser().Name in tx = %q; want changed", got.Name)
+		}
+		return errTest
+	})
+	if !errors.Is(err, errTest) {
+		t.Fatalf("RunInTx() error = %v; want %v", err, errTest)
+	}
+
+	got, err := h.GetUser(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "alice" {
+		t.Errorf("GetUser().Name after rollback = %q; want alice", got.Name)
+	}
+	if users, _ := h.ListUsers(ctx, models.ListUsersParams{}); len(users) != 1 {
+		t.Errorf("len(ListUsers()) after rollback = %d; want 1", len(users))
+	}
+}
+
+func TestHandler_Concurrent(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+
+	// 同じ email での同時作成は1件だけ成功する
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = h.RunInTx(ctx, func(ctx context.Context) error {
+				_, err := h.CreateUser(ctx, &models.UserPrototype{
+					ID:    uuid.Must(uuid.NewV7()),
+					Name:  fmt.Sprintf("user-%d", i),
+					Email: "same@example.com",
+				})
+				return err
+			})
+			_, _ = h.ListUsers(ctx, models.ListUsersParams{})
+		}()
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errorCodeOf(err) != errorCodeDBDuplicate:
+			t.Errorf("CreateUser() error = %v; want nil or ErrDBDuplicate", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("succeeded = %d; want 1", succeeded)
+	}
+}
+
+func TestHandler_ProcessOutbox(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+
+	base := time.Now().Add(-time.Minute)
+	ids := make([]uuid.UUID, 3)
+	for i := range ids {
+		ids[i] = uuid.Must(uuid.NewV7())
+		// 逆順に発生したことにする
+		err := h.AppendEvent(ctx, &models.Event{
+			ID:         ids[i],
+			TenantID:   models.DefaultTenantID,
+			Type:       models.EventTypeUserCreated,
+			OccurredAt: base.Add(-time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy := models.RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Second, MaxBackoff: time.Second}
+	var published, concurrent []uuid.UUID
+	n, err := h.ProcessOutbox(ctx, 2, time.Minute, policy, func(ctx context.Context, event *models.Event) error {
+		// 配信はロックの外で行い, 配信中のイベントはリースの間は他から取り出されない (残りの1件だけを取り出して失敗させる)
+		_, err := h.ProcessOutbox(ctx, 10, time.Minute, policy, func(ctx context.Context, event *models.Event) error {
+			concurrent = append(concurrent, event.ID)
+			return errors.New("unavailable")
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		published = append(published, event.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(published) != 2 || published[0] != ids[2] || published[1] != ids[1] {
+		t.Fatalf("ProcessOutbox() = %d, published %v; want oldest 2 events [%s %s]", n, published, ids[2], ids[1])
+	}
+	if !slices.Equal(concurrent, []uuid.UUID{ids[0]}) {
+		t.Errorf("ProcessOutbox() while publishing = %v; want the unclaimed event [%s]", concurrent, ids[0])
+	}
+
+	// 配信済みは再度配信しない. 失敗は最大試行回数で dead になり再度配信しない
+	for range 2 {
+		published = nil
+		if _, err := h.ProcessOutbox(ctx, 10, time.Minute, policy, func(ctx context.Context, event *models.Event) error {
+			published = append(published, event.ID)
+			return errors.New("unavailable")
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(published) != 0 {
+		t.Errorf("published after dead = %v; want none", published)
+	}
+
+	purged, err := h.PurgeOutboxEvents(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("PurgeOutboxEvents() = %d; want 2", purged)
+	}
+}
+
+func TestHandler_WebhookDeliveries(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+
+	webhook, err := h.CreateWebhook(ctx, &models.WebhookPrototype{
+		ID:         uuid.Must(uuid.NewV7()),
+		URL:        "https://example.com/hook",
+		EventTypes: []models.EventType{models.EventTypeUserCreated},
+		Secret:     "secret",
+		Enabled:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 他のテナントからは見えない
+	if _, err := h.GetWebhook(db.WithTenant(context.Background(), uuid.New()), webhook.ID); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetWebhook() from another tenant = %v; want DB_NOT_FOUND", err)
+	}
+
+	event := &models.Event{ID: uuid.Must(uuid.NewV7()), TenantID: models.DefaultTenantID, Type: models.EventTypeUserCreated, OccurredAt: time.Now()}
+	for range 2 {
+		// 同じイベントは重複して登録しない
+		if _, err := h.EnqueueWebhookDeliveries(ctx, event, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, _ := h.EnqueueWebhookDeliveries(ctx, &models.Event{ID: uuid.Must(uuid.NewV7()), TenantID: models.DefaultTenantID, Type: models.EventTypeUserDeleted}, []byte(`{}`)); n != 0 {
+		t.Errorf("EnqueueWebhookDeliveries() for unsubscribed event type = %d; want 0", n)
+	}
+
+	// 他のテナントのイベントは, relay と同じく全てのテナントを対象にした ctx でも配信しない
+	if n, _ := h.EnqueueWebhookDeliveries(db.WithCrossTenant(context.Background()), &models.Event{ID: uuid.Must(uuid.NewV7()), TenantID: uuid.New(), Type: models.EventTypeUserCreated}, []byte(`{}`)); n != 0 {
+		t.Errorf("EnqueueWebhookDeliveries() for another tenant's event = %d; want 0", n)
+	}
+
+	// 失敗が続くと webhook を無効にする
+	policy := models.RetryPolicy{MaxAttempts: 10, InitialBackoff: 0, MaxBackoff: 0}
+	processed, err := h.ProcessWebhookDeliveries(ctx, 10, time.Minute, policy, 1, func(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt {
+		// 送信はロックの外で行い, 送信中の配信はリースの間は他から取り出されない
+		if n, err := h.ProcessWebhookDeliveries(ctx, 10, time.Minute, policy, 1, nil); err != nil || n != 0 {
+			t.Errorf("ProcessWebhookDeliveries() while delivering = %d, %v; want 0", n, err)
+		}
+		return &models.WebhookDeliveryAttempt{ResponseCode: 500, Error: "internal server error"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed != 1 {
+		t.Errorf("ProcessWebhookDeliveries() = %d; want 1", processed)
+	}
+	got, err := h.GetWebhook(ctx, webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Enabled || got.ConsecutiveFailures != 1 || got.DisabledReason == "" {
+		t.Errorf("GetWebhook() = %+v; want disabled after 1 failure", got)
+	}
+
+	deliveries, err := h.ListWebhookDeliveries(ctx, webhook.ID, models.ListWebhookDeliveriesParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("len(ListWebhookDeliveries()) = %d; want 1", len(deliveries))
+	}
+	delivery, err := h.GetWebhookDelivery(ctx, webhook.ID, deliveries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivery.AttemptLog) != 1 || delivery.AttemptLog[0].Attempt != 1 {
+		t.Errorf("GetWebhookDelivery().AttemptLog = %+v; want 1 attempt", delivery.AttemptLog)
+	}
+
+	// webhook の削除で配信も消える
+	if err := h.DeleteWebhook(ctx, webhook.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.GetWebhookDelivery(ctx, webhook.ID, delivery.ID); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetWebhookDelivery() after webhook delete error = %v; want ErrDBNotFound", err)
+	}
+}
+
+func TestHandler_ImportUsers(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+	alice := createTestUser(t, h, "alice", "alice@example.com")
+
+	prototypes := []*models.UserPrototype{
+		{ID: uuid.Must(uuid.NewV7()), Name: "alice2", Email: "alice@example.com"},
+		{ID: uuid.Must(uuid.NewV7()), Name: "bob", Email: "bob@example.com"},
+	}
+
+	// 重複する行は書き込まない
+	created, updated, err := h.ImportUsers(ctx, prototypes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].Email != "bob@example.com" || len(updated) != 0 {
+		t.Fatalf("ImportUsers() = %v, %v; want bob created", created, updated)
+	}
+	if got, _ := h.GetUser(ctx, alice.ID); got.Name != "alice" {
+		t.Errorf("GetUser().Name = %q; want alice", got.Name)
+	}
+
+	// 重複する行は name を更新する. name が同じ行は更新しない
+	prototypes[1].ID = uuid.Must(uuid.NewV7())
+	created, updated, err = h.ImportUsers(ctx, prototypes, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 0 || len(updated) != 1 || updated[0].After.ID != alice.ID || updated[0].After.Name != "alice2" || updated[0].Before.Name != "alice" {
+		t.Fatalf("ImportUsers() with update = %v, %v; want alice updated", created, updated)
+	}
+	if users, _ := h.ListUsers(ctx, models.ListUsersParams{}); len(users) != 2 {
+		t.Errorf("len(ListUsers()) = %d; want 2", len(users))
+	}
+}
+
+func TestHandler_ListUsersAfter(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+	for i := range 5 {
+		createTestUser(t, h, fmt.Sprintf("user%d", i%3), fmt.Sprintf("user%d@example.com", i))
+	}
+	all, _ := h.ListUsers(ctx, models.ListUsersParams{})
+
+	// name が同じユーザーも id の順に漏れなく辿る
+	got := []*models.User{}
+	params := models.ListUsersAfterParams{Limit: 2}
+	for {
+		users, err := h.ListUsersAfter(ctx, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, users...)
+		if len(users) < params.Limit {
+			break
+		}
+		last := users[len(users)-1]
+		params.AfterName, params.AfterID = last.Name, last.ID
+	}
+	if len(got) != len(all) {
+		t.Fatalf("len(ListUsersAfter() pages) = %d; want %d", len(got), len(all))
+	}
+	for i := range all {
+		if got[i].ID != all[i].ID {
+			t.Errorf("ListUsersAfter() pages[%d] = %s; want %s", i, got[i].ID, all[i].ID)
+		}
+	}
+}
+
+func TestHandler_SearchUsers(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+	john := createTestUser(t, h, "John Doe", "john.doe@example.com")
+	johnny := createTestUser(t, h, "Johnny Smith", "johnny@example.com")
+	createTestUser(t, h, "Jane Roe", "jane@example.com")
+
+	tests := []struct {
+		query string
+		want  []*models.User
+	}{
+		// 全文検索での一致が類似度のみの一致より上
+		{"john", []*models.User{john, johnny}},
+		{"john doe", []*models.User{john}},
+		// email は 1 語. 似ている johnny@example.com にも一致する
+		{"john.doe@example.com", []*models.User{john, johnny}},
+		// typo. 類似度が同じ場合は name の順
+		{"Johny", []*models.User{john, johnny}},
+		{"nobody", []*models.User{}},
+	}
+	for _, tt := range tests {
+		results, err := h.SearchUsers(ctx, models.SearchUsersParams{Query: tt.query, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]*models.User, 0, len(results))
+		for _, result := range results {
+			got = append(got, result.User)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("SearchUsers(%q) = %v; want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].ID != tt.want[i].ID {
+				t.Errorf("SearchUsers(%q)[%d] = %s; want %s", tt.query, i, got[i].Name, tt.want[i].Name)
+			}
+		}
+	}
+
+	if results, _ := h.SearchUsers(ctx, models.SearchUsersParams{Query: "j", Limit: 1}); len(results) > 1 {
+		t.Errorf("len(SearchUsers()) with limit 1 = %d; want <= 1", len(results))
+	}
+}
+
+func TestHandler_AuditEvents(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+
+	bob, alice := uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7())
+	t0 := time.Now().UTC()
+	appended := []*models.AuditEvent{}
+	for i, targetID := range []uuid.UUID{bob, alice, bob} {
+		event := &models.AuditEvent{
+			ID:         uuid.Must(uuid.NewV7()),
+			Action:     models.AuditActionUpdate,
+			Actor:      models.AuditActor{Type: models.AuditActorTypeSystem},
+			TargetType: "user",
+			TargetID:   targetID,
+			OccurredAt: t0.Add(time.Duration(i) * time.Hour),
+		}
+		if err := h.AppendAuditEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+		appended = append(appended, event)
+	}
+
+	// 新しい順. Cursor より古いもの
+	events, _ := h.ListAuditEvents(ctx, models.ListAuditEventsParams{Limit: 10})
+	if len(events) != 3 || events[0].ID != appended[2].ID || events[2].ID != appended[0].ID {
+		t.Fatalf("ListAuditEvents() = %v; want newest first", events)
+	}
+	events, _ = h.ListAuditEvents(ctx, models.ListAuditEventsParams{Cursor: appended[2].ID, Limit: 1})
+	if len(events) != 1 || events[0].ID != appended[1].ID {
+		t.Errorf("ListAuditEvents() after cursor = %v; want the second", events)
+	}
+	events, _ = h.ListAuditEvents(ctx, models.ListAuditEventsParams{TargetID: bob, Since: t0.Add(time.Minute), Limit: 10})
+	if len(events) != 1 || events[0].ID != appended[2].ID {
+		t.Errorf("ListAuditEvents() of bob since t0+1m = %v; want the last", events)
+	}
+
+	// ロールバックしたトランザクションで書き込んだものは残らない
+	_ = h.RunInTx(ctx, func(ctx context.Context) error {
+		_ = h.AppendAuditEvent(ctx, &models.AuditEvent{ID: uuid.Must(uuid.NewV7()), OccurredAt: t0})
+		return errors.New("rollback")
+	})
+
+	if n, _ := h.PurgeAuditEvents(ctx, t0.Add(90*time.Minute)); n != 2 {
+		t.Errorf("PurgeAuditEvents() = %d; want 2", n)
+	}
+	if events, _ := h.ListAuditEvents(ctx, models.ListAuditEventsParams{Limit: 10}); len(events) != 1 {
+		t.Errorf("len(ListAuditEvents()) after purge = %d; want 1", len(events))
+	}
+}
+
+func TestHandler_Tenants(t *testing.T) {
+	h := newTestHandler(t)
+
+	other := &models.Tenant{ID: uuid.New(), Slug: "other", Name: "Other"}
+	if err := h.AddTenant(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := h.GetTenantBySlug(context.Background(), "other"); err != nil || got.ID != other.ID {
+		t.Fatalf("GetTenantBySlug() = %+v, %v; want %s", got, err, other.ID)
+	}
+	if _, err := h.GetTenant(context.Background(), uuid.New()); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Fatalf("GetTenant() error = %v, want not found", err)
+	}
+
+	defaultCtx := testContext()
+	otherCtx := db.WithTenant(context.Background(), other.ID)
+	alice := createTestUser(t, h, "alice", "alice@example.com")
+	if alice.TenantID != models.DefaultTenantID {
+		t.Errorf("TenantID = %s, want %s", alice.TenantID, models.DefaultTenantID)
+	}
+
+	// email の一意性はテナントごと
+	bob, err := h.CreateUser(otherCtx, &models.UserPrototype{ID: uuid.New(), Name: "bob", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("CreateUser() in other tenant error = %v", err)
+	}
+
+	// 他のテナントのユーザーは見えない
+	if _, err := h.GetUser(otherCtx, alice.ID); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetUser() across tenants error = %v, want not found", err)
+	}
+	if _, err := h.UpdateUser(otherCtx, alice.ID, &models.UserPrototype{Name: "x", Email: "x@example.com"}); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("UpdateUser() across tenants error = %v, want not found", err)
+	}
+	if err := h.DeleteUSer(otherCtx, alice.ID); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("DeleteUSer() across tenants error = %v, want not found", err)
+	}
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want []uuid.UUID
+	}{
+		{name: "default", ctx: defaultCtx, want: []uuid.UUID{alice.ID}},
+		{name: "other", ctx: otherCtx, want: []uuid.UUID{bob.ID}},
+		{name: "no tenant", ctx: context.Background(), want: []uuid.UUID{}},
+		{name: "cross tenant", ctx: db.WithCrossTenant(context.Background()), want: []uuid.UUID{alice.ID, bob.ID}},
+	} {
+		users, err := h.ListUsers(tc.ctx, models.ListUsersParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []uuid.UUID{}
+		for _, u := range users {
+			got = append(got, u.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: ListUsers() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// テナントが紐付けられていない場合は書き込めない
+	if _, err := h.CreateUser(context.Background(), &models.UserPrototype{ID: uuid.New(), Name: "carol", Email: "carol@example.com"}); err == nil {
+		t.Error("CreateUser() without tenant succeeded, want error")
+	}
+}
+
+func TestHandler_APIKeys(t *testing.T) {
+	ctx := testContext()
+	h := newTestHandler(t)
+
+	other := &models.Tenant{ID: uuid.New(), Slug: "other", Name: "Other"}
+	if err := h.AddTenant(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := h.CreateAPIKey(ctx, &models.APIKeyPrototype{
+		ID:         uuid.New(),
+		Name:       "ci",
+		Prefix:     "0123456789abcdef",
+		SecretHash: []byte("hash"),
+		Scopes:     []models.APIKeyScope{models.APIKeyScopeUsersRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.TenantID != models.DefaultTenantID {
+		t.Errorf("TenantID = %s, want %s", key.TenantID, models.DefaultTenantID)
+	}
+
+	// prefix は全てのテナントで一意
+	_, err = h.CreateAPIKey(db.WithTenant(context.Background(), other.ID), &models.APIKeyPrototype{ID: uuid.New(), Name: "dup", Prefix: key.Prefix})
+	if errorCodeOf(err) != errorCodeDBDuplicate {
+		t.Errorf("CreateAPIKey() with duplicate prefix error = %v, want duplicate", err)
+	}
+
+	// 認証ではテナントを特定する前に探す
+	if _, err := h.GetAPIKeyByPrefix(context.Background(), key.Prefix); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetAPIKeyByPrefix() without tenant error = %v, want not found", err)
+	}
+	if got, err := h.GetAPIKeyByPrefix(db.WithCrossTenant(context.Background()), key.Prefix); err != nil || got.ID != key.ID {
+		t.Errorf("GetAPIKeyByPrefix() = %+v, %v; want %s", got, err, key.ID)
+	}
+	if _, err := h.GetAPIKey(db.WithTenant(context.Background(), other.ID), key.ID); errorCodeOf(err) != errorCodeDBNotFound {
+		t.Errorf("GetAPIKey() across tenants error = %v, want not found", err)
+	}
+
+	// 期限は早める方向にしか変えない
+	expiresAt := time.Now().Add(time.Hour)
+	if got, err := h.ExpireAPIKey(ctx, key.ID, expiresAt); err != nil || !got.ExpiresAt.Equal(expiresAt.Truncate(time.Microsecond)) {
+		t.Errorf("ExpireAPIKey() = %+v, %v; want expires_at %s", got, err, expiresAt)
+	}
+	if got, err := h.ExpireAPIKey(ctx, key.ID, expiresAt.Add(time.Hour)); err != nil || !got.ExpiresAt.Equal(expiresAt.Truncate(time.Microsecond)) {
+		t.Errorf("ExpireAPIKey() later = %+v, %v; want expires_at %s", got, err, expiresAt)
+	}
+
+	// 最終使用日時は interval の間は更新しない
+	if err := h.TouchAPIKey(ctx, key.ID, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	touched, _ := h.GetAPIKey(ctx, key.ID)
+	if touched.LastUsedAt.IsZero() {
+		t.Fatal("LastUsedAt is zero after TouchAPIKey()")
+	}
+	if err := h.TouchAPIKey(ctx, key.ID, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := h.GetAPIKey(ctx, key.ID); !got.LastUsedAt.Equal(touched.LastUsedAt) {
+		t.Errorf("LastUsedAt = %s, want %s", got.LastUsedAt, touched.LastUsedAt)
+	}
+
+	revoked, err := h.RevokeAPIKey(ctx, key.ID)
+	if err != nil || revoked.RevokedAt.IsZero() {
+		t.Fatalf("RevokeAPIKey() = %+v, %v", revoked, err)
+	}
+	if again, err := h.RevokeAPIKey(ctx, key.ID); err != nil || !again.RevokedAt.Equal(revoked.RevokedAt) {
+		t.Errorf("RevokeAPIKey() again = %+v, %v; want revoked_at %s", again, err, revoked.RevokedAt)
+	}
+	if keys, _ := h.ListAPIKeys(ctx); len(keys) != 1 {
+		t.Errorf("len(ListAPIKeys()) = %d, want 1", len(keys))
+	}
+}
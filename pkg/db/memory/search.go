@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// PostgreSQL の pg_trgm.word_similarity_threshold の既定値
+const wordSimilarityThreshold = 0.6
+
+// searchFullTextRank は全文検索に一致した場合に関連度に加える値 (ts_rank の近似)
+const searchFullTextRank = 0.1
+
+// SearchUsers は PostgreSQL の実装 (search_vector の全文検索と pg_trgm の word_similarity) を近似して検索する
+// 一致するユーザーと並び順 (関連度, name, id) は同じになるようにしているが, Rank の値は一致しない
+func (p *Handler) SearchUsers(ctx context.Context, params models.SearchUsersParams) ([]*models.UserSearchResult, error) {
+
+	users, _ := p.ListUsers(ctx, models.ListUsersParams{})
+
+	results := []*models.UserSearchResult{}
+	for _, user := range users {
+		rank := max(wordSimilarity(params.Query, user.Name), wordSimilarity(params.Query, user.Email))
+		fullText := matchFullText(params.Query, user)
+		if !fullText && rank < wordSimilarityThreshold {
+			continue
+		}
+		if fullText {
+			rank += searchFullTextRank
+		}
+		results = append(results, &models.UserSearchResult{User: user, Rank: rank})
+	}
+
+	// ORDER BY rank DESC, name, id (users は name, id の順)
+	slices.SortStableFunc(results, func(a, b *models.UserSearchResult) int {
+		return cmp.Compare(b.Rank, a.Rank)
+	})
+	if len(results) > params.Limit {
+		results = results[:params.Limit]
+	}
+	return results, nil
+}
+
+// matchFullText は websearch_to_tsquery の近似. 検索語の語が全て name の語か email (simple の構文解析では email は 1 語) と一致し,
+// '-' で始まる語とは一致しないかを返す. or は無視する (AND として扱う)
+func matchFullText(query string, user *models.User) bool {
+
+	tokens := map[string]bool{strings.ToLower(user.Email): true}
+	for _, word := range trigramWords(user.Name) {
+		tokens[word] = true
+	}
+
+	matched := false
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if word == "or" {
+			continue
+		}
+		negated := strings.HasPrefix(word, "-")
+		word = strings.Trim(word, `"-`)
+		if !strings.Contains(word, "@") {
+			word = strings.TrimFunc(word, func(r rune) bool { return !isTrigramRune(r) })
+		}
+		if word == "" {
+			continue
+		}
+		if tokens[word] == negated {
+			return false
+		}
+		matched = matched || !negated
+	}
+	return matched
+}
+
+// wordSimilarity は pg_trgm の word_similarity(query, text)
+// text の trigram の並びの連続する範囲のうち, query の trigram の集合と最も似ているもの (Jaccard 係数) の類似度を返す
+func wordSimilarity(query string, text string) float64 {
+
+	queryTrigrams := map[string]bool{}
+	for _, key := range trigrams(query) {
+		queryTrigrams[key] = true
+	}
+	if len(queryTrigrams) == 0 {
+		return 0
+	}
+
+	keys := trigrams(text)
+	best := 0.0
+	for i := range keys {
+		extent := map[string]bool{}
+		shared := 0
+		for _, key := range keys[i:] {
+			if !extent[key] {
+				extent[key] = true
+				if queryTrigrams[key] {
+					shared++
+				}
+			}
+			best = max(best, float64(shared)/float64(len(queryTrigrams)+len(extent)-shared))
+		}
+	}
+	return best
+}
+
+// trigrams は text の語毎に, 前に空白 2 つ, 後ろに空白 1 つを補った 3 文字の並びを順に返す
+func trigrams(text string) []string {
+	keys := []string{}
+	for _, word := range trigramWords(text) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			keys = append(keys, string(runes[i:i+3]))
+		}
+	}
+	return keys
+}
+
+// trigramWords は text を pg_trgm と同じく英数字の並びの語に分け, 小文字にする
+func trigramWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isTrigramRune(r)
+	})
+}
+
+func isTrigramRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
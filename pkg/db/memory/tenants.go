@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+func (p *Handler) GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.Tenant, error) {
+
+	var tenant models.Tenant
+	err := p.read(ctx, func(s *state) error {
+		t, ok := s.tenants[tenantID]
+		if !ok {
+			return newNotFoundError()
+		}
+		tenant = *t
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (p *Handler) GetTenantBySlug(ctx context.Context, slug string) (*models.Tenant, error) {
+
+	var tenant models.Tenant
+	err := p.read(ctx, func(s *state) error {
+		for _, t := range s.tenants {
+			if t.Slug == slug {
+				tenant = *t
+				return nil
+			}
+		}
+		return newNotFoundError()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// AddTenant はテナントを追加する. テナントの管理は API に含めていないため, テスト等で使う
+func (p *Handler) AddTenant(ctx context.Context, tenant *models.Tenant) error {
+
+	return p.write(ctx, func(s *state) error {
+		copied := *tenant
+		s.tenants[tenant.ID] = &copied
+		return nil
+	})
+}
@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/postgres/apikeys"
+	"github.com/aazw/go-base/pkg/db/postgres/users"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// API キーは Row Level Security の対象のため, 書き込みはトランザクション中でなければトランザクションを開始してテナントを設定する
+// RunInTx は fn が返した cerrors のエラーをそのまま返すため, エラーの変換は fn の中で行う
+
+func (p *Handler) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+
+	var records []apikeys.ApiKey
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		records, err = apikeys.New(conn).ListAPIKeys(ctx)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to list api keys", "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	items := make([]*models.APIKey, 0, len(records))
+	for _, record := range records {
+		items = append(items, toAPIKey(record))
+	}
+	return items, nil
+}
+
+func (p *Handler) CreateAPIKey(ctx context.Context, prototype *models.APIKeyPrototype) (*models.APIKey, error) {
+
+	var record apikeys.ApiKey
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		record, err = p.apiKeys(ctx).CreateAPIKey(ctx, apikeys.CreateAPIKeyParams{
+			ID:             prototype.ID,
+			Name:           prototype.Name,
+			Prefix:         prototype.Prefix,
+			SecretHash:     prototype.SecretHash,
+			Scopes:         fromAPIKeyScopes(prototype.Scopes),
+			RateLimitRps:   pgtype.Float8{Float64: prototype.RateLimitRPS, Valid: prototype.RateLimitRPS > 0},
+			RateLimitBurst: pgtype.Int4{Int32: int32(prototype.RateLimitBurst), Valid: prototype.RateLimitRPS > 0},
+			ExpiresAt:      toTimestamptz(prototype.ExpiresAt),
+			RotatedFrom:    toUUID(prototype.RotatedFrom),
+		})
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to create api key", "api_key_id", prototype.ID, "error", err)
+			if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" { // unique_violation
+				return cerrors.ErrDBDuplicate.New(
+					cerrors.WithCause(err),
+				)
+			}
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return toAPIKey(record), nil
+}
+
+func (p *Handler) GetAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+
+	var record apikeys.ApiKey
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		record, err = apikeys.New(conn).GetAPIKey(ctx, apiKeyID)
+		return err
+	})
+	if err != nil {
+		return nil, apiKeyError(ctx, err, "api_key_id", apiKeyID)
+	}
+	return toAPIKey(record), nil
+}
+
+// GetAPIKeyByPrefix は prefix のキーを返す. 認証でテナントを特定する前に使うため, 呼び出し元で db.WithCrossTenant を使う
+func (p *Handler) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+
+	var record apikeys.ApiKey
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		record, err = apikeys.New(conn).GetAPIKeyByPrefix(ctx, prefix)
+		return err
+	})
+	if err != nil {
+		return nil, apiKeyError(ctx, err, "api_key_prefix", prefix)
+	}
+	return toAPIKey(record), nil
+}
+
+func (p *Handler) RevokeAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+
+	var record apikeys.ApiKey
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		record, err = p.apiKeys(ctx).RevokeAPIKey(ctx, apiKeyID)
+		if err != nil {
+			return apiKeyError(ctx, err, "api_key_id", apiKeyID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return toAPIKey(record), nil
+}
+
+func (p *Handler) ExpireAPIKey(ctx context.Context, apiKeyID uuid.UUID, expiresAt time.Time) (*models.APIKey, error) {
+
+	var record apikeys.ApiKey
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		record, err = p.apiKeys(ctx).ExpireAPIKey(ctx, apikeys.ExpireAPIKeyParams{
+			ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+			ID:        apiKeyID,
+		})
+		if err != nil {
+			return apiKeyError(ctx, err, "api_key_id", apiKeyID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return toAPIKey(record), nil
+}
+
+// TouchAPIKey は最終使用日時を記録する. 認証のたびに呼ばれるため, read-your-writes の対象 (db.MarkWritten) にはしない
+func (p *Handler) TouchAPIKey(ctx context.Context, apiKeyID uuid.UUID, interval time.Duration) error {
+
+	err := p.RunInTx(ctx, func(ctx context.Context) error {
+		return p.apiKeys(ctx).TouchAPIKey(ctx, apikeys.TouchAPIKeyParams{
+			ID:              apiKeyID,
+			IntervalSeconds: interval.Seconds(),
+		})
+	})
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to touch api key", "api_key_id", apiKeyID, "error", err)
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+	return nil
+}
+
+func apiKeyError(ctx context.Context, err error, key string, value any) error {
+
+	if err == pgx.ErrNoRows {
+		logging.FromContext(ctx).Debug("api key not found", key, value)
+		return cerrors.ErrDBNotFound.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("record not found"),
+		)
+	}
+	logging.FromContext(ctx).Error("failed to access api key", key, value, "error", err)
+	return cerrors.ErrDBOperation.New(
+		cerrors.WithCause(err),
+	)
+}
+
+func toAPIKey(record apikeys.ApiKey) *models.APIKey {
+	key := &models.APIKey{
+		ID:          record.ID,
+		TenantID:    record.TenantID,
+		Name:        record.Name,
+		Prefix:      record.Prefix,
+		SecretHash:  record.SecretHash,
+		Scopes:      make([]models.APIKeyScope, 0, len(record.Scopes)),
+		ExpiresAt:   record.ExpiresAt.Time,
+		LastUsedAt:  record.LastUsedAt.Time,
+		RevokedAt:   record.RevokedAt.Time,
+		RotatedFrom: uuid.UUID(record.RotatedFrom.Bytes),
+		CreatedAt:   record.CreatedAt.Time,
+		UpdatedAt:   record.UpdatedAt.Time,
+	}
+	for _, scope := range record.Scopes {
+		key.Scopes = append(key.Scopes, models.APIKeyScope(scope))
+	}
+	if record.RateLimitRps.Valid {
+		key.RateLimitRPS = record.RateLimitRps.Float64
+		key.RateLimitBurst = int(record.RateLimitBurst.Int32)
+	}
+	return key
+}
+
+func fromAPIKeyScopes(scopes []models.APIKeyScope) []string {
+	ret := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		ret = append(ret, string(scope))
+	}
+	return ret
+}
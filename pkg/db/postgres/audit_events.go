@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db/postgres/audit"
+	"github.com/aazw/go-base/pkg/db/postgres/users"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// AppendAuditEvent は監査ログを audit_events テーブルに書き込む
+// RunInTx の中で呼ぶと, 変更と同じトランザクションで記録される
+func (p *Handler) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+
+	err := p.audit(ctx).InsertAuditEvent(ctx, audit.InsertAuditEventParams{
+		ID:         event.ID,
+		Action:     string(event.Action),
+		ActorType:  string(event.Actor.Type),
+		ActorID:    event.Actor.ID,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Before:     event.Before,
+		After:      event.After,
+		RequestID:  event.RequestID,
+		TraceID:    event.TraceID,
+		ClientIp:   event.ClientIP,
+		UserAgent:  event.UserAgent,
+		OccurredAt: pgtype.Timestamptz{Time: event.OccurredAt, Valid: true},
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to append audit event", "audit_event_id", event.ID, "action", event.Action, "error", err)
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+	return nil
+}
+
+func (p *Handler) ListAuditEvents(ctx context.Context, params models.ListAuditEventsParams) ([]*models.AuditEvent, error) {
+
+	var records []audit.AuditEvent
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		records, err = audit.New(conn).ListAuditEvents(ctx, audit.ListAuditEventsParams{
+			Action:     toText(string(params.Action)),
+			ActorType:  toText(string(params.ActorType)),
+			ActorID:    toText(params.ActorID),
+			TargetType: toText(params.TargetType),
+			TargetID:   toUUID(params.TargetID),
+			Since:      toTimestamptz(params.Since),
+			Until:      toTimestamptz(params.Until),
+			Cursor:     toUUID(params.Cursor),
+			RowLimit:   int32(params.Limit),
+		})
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to list audit events", "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	items := make([]*models.AuditEvent, 0, len(records))
+	for _, record := range records {
+		items = append(items, &models.AuditEvent{
+			ID:       record.ID,
+			TenantID: record.TenantID,
+			Action:   models.AuditAction(record.Action),
+			Actor: models.AuditActor{
+				Type: models.AuditActorType(record.ActorType),
+				ID:   record.ActorID,
+			},
+			TargetType: record.TargetType,
+			TargetID:   record.TargetID,
+			Before:     record.Before,
+			After:      record.After,
+			RequestID:  record.RequestID,
+			TraceID:    record.TraceID,
+			ClientIP:   record.ClientIp,
+			UserAgent:  record.UserAgent,
+			OccurredAt: record.OccurredAt.Time,
+		})
+	}
+	return items, nil
+}
+
+// PurgeAuditEvents は ctx のテナントの監査ログを削除する. 全てのテナントを対象にする場合は db.WithCrossTenant を使う
+// Row Level Security の対象になるよう, トランザクション中でなければトランザクションを開始する
+func (p *Handler) PurgeAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+
+	var n int64
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		n, err = p.audit(ctx).PurgeAuditEvents(ctx, pgtype.Timestamptz{Time: before, Valid: true})
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to purge audit events", "error", err)
+		return 0, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+	return n, nil
+}
+
+// toText は空文字を NULL (条件を指定しない) として扱う
+func toText(s string) pgtype.Text {
+	return pgtype.Text{String: s, Valid: s != ""}
+}
+
+// toUUID は uuid.Nil を NULL (条件を指定しない) として扱う
+func toUUID(id uuid.UUID) pgtype.UUID {
+	return pgtype.UUID{Bytes: id, Valid: id != uuid.Nil}
+}
+
+// toTimestamptz はゼロ値を NULL (条件を指定しない) として扱う
+func toTimestamptz(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: t, Valid: !t.IsZero()}
+}
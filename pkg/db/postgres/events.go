@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db/postgres/outbox"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+const (
+	outboxStatusPending = "pending"
+	outboxStatusDead    = "dead"
+
+	// last_error 等に保存するエラーメッセージの最大長
+	maxErrorLength = 1000
+)
+
+// AppendEvent はイベントを outbox テーブルに書き込む
+// RunInTx の中で呼ぶと, 変更と同じトランザクションで記録される
+func (p *Handler) AppendEvent(ctx context.Context, event *models.Event) error {
+
+	traceContext, err := json.Marshal(event.TraceContext)
+	if err != nil {
+		return cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to marshal trace context"),
+		)
+	}
+	if event.TraceContext == nil {
+		traceContext = []byte("{}")
+	}
+
+	err = p.outbox(ctx).InsertOutboxEvent(ctx, outbox.InsertOutboxEventParams{
+		ID:            event.ID,
+		TenantID:      event.TenantID,
+		EventType:     string(event.Type),
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Payload:       event.Payload,
+		TraceContext:  traceContext,
+		OccurredAt:    pgtype.Timestamptz{Time: event.OccurredAt, Valid: true},
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to append event", "event_id", event.ID, "event_type", event.Type, "error", err)
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+	return nil
+}
+
+// ProcessOutbox は配信待ちのイベントを最大 limit 件取り出して古い順に1件ずつ publish に渡し, その結果 (配信済み / 再試行待ち / dead) を記録する. 処理した件数を返す
+// 取り出しは短いトランザクションで行い, next_attempt_at を lease の後にして他の relay から隠す (リース). 配信はトランザクションの外で行い,
+// 結果は1件ずつ別のトランザクションで記録する. lease は1バッチの配信にかかる時間より長くすること
+// ctx のテナントのイベントが対象. 全てのテナントのイベントを配信する場合は db.WithCrossTenant を使う
+func (p *Handler) ProcessOutbox(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, publish func(ctx context.Context, event *models.Event) error) (int, error) {
+
+	var records []outbox.Outbox
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		records, err = p.outbox(ctx).ClaimOutboxEvents(ctx, outbox.ClaimOutboxEventsParams{
+			MaxEvents:    int32(limit),
+			LeaseSeconds: lease.Seconds(),
+		})
+		if err != nil {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to claim outbox events"),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// UPDATE ... RETURNING は順序を保証しない
+	slices.SortFunc(records, func(a, b outbox.Outbox) int {
+		return a.OccurredAt.Time.Compare(b.OccurredAt.Time)
+	})
+
+	processed := 0
+	for _, record := range records {
+		// 停止する場合, 残りのイベントはリースが切れた後に配信する
+		if ctx.Err() != nil {
+			break
+		}
+
+		event := &models.Event{
+			ID:            record.ID,
+			TenantID:      record.TenantID,
+			Type:          models.EventType(record.EventType),
+			AggregateType: record.AggregateType,
+			AggregateID:   record.AggregateID,
+			Payload:       record.Payload,
+			OccurredAt:    record.OccurredAt.Time,
+			Attempts:      int(record.Attempts),
+		}
+		if err := json.Unmarshal(record.TraceContext, &event.TraceContext); err != nil {
+			logging.FromContext(ctx).Warn("invalid trace context in outbox", "event_id", record.ID, "error", err)
+		}
+
+		pubErr := publish(ctx, event)
+		err := p.RunInTx(ctx, func(ctx context.Context) error {
+			return p.recordOutboxResult(ctx, record, pubErr, policy)
+		})
+		if err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// recordOutboxResult は配信の結果を記録する. リースが切れて他の relay が先に記録していた場合は何もしない
+func (p *Handler) recordOutboxResult(ctx context.Context, record outbox.Outbox, pubErr error, policy models.RetryPolicy) error {
+
+	var marked int64
+	if pubErr == nil {
+		var err error
+		marked, err = p.outbox(ctx).MarkOutboxEventPublished(ctx, outbox.MarkOutboxEventPublishedParams{
+			ID:       record.ID,
+			Attempts: record.Attempts,
+		})
+		if err != nil {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to mark outbox event as published"),
+			)
+		}
+	} else {
+		attempts := int(record.Attempts) + 1
+		backoff, dead := policy.Next(attempts)
+		status := outboxStatusPending
+		if dead {
+			status = outboxStatusDead
+			logging.FromContext(ctx).Error("outbox event moved to dead letter", "event_id", record.ID, "event_type", record.EventType, "attempts", attempts, "error", pubErr)
+		} else {
+			logging.FromContext(ctx).Warn("failed to publish outbox event", "event_id", record.ID, "event_type", record.EventType, "attempts", attempts, "retry_in", backoff, "error", pubErr)
+		}
+
+		var err error
+		marked, err = p.outbox(ctx).MarkOutboxEventFailed(ctx, outbox.MarkOutboxEventFailedParams{
+			ID:            record.ID,
+			Status:        status,
+			LastError:     pgtype.Text{String: truncateError(pubErr.Error()), Valid: true},
+			NextAttemptAt: pgtype.Timestamptz{Time: time.Now().Add(backoff), Valid: true},
+			Attempts:      record.Attempts,
+		})
+		if err != nil {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to mark outbox event as failed"),
+			)
+		}
+	}
+	if marked == 0 {
+		logging.FromContext(ctx).Warn("outbox event was already recorded by another relay", "event_id", record.ID, "event_type", record.EventType)
+	}
+	return nil
+}
+
+// PurgeOutboxEvents は before より前に配信済みになったイベントを削除する. 削除した件数を返す
+// dead のイベントは調査のため残す. ctx のテナントのイベントが対象. 全てのテナントを対象にする場合は db.WithCrossTenant を使う
+func (p *Handler) PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+
+	var n int64
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		n, err = p.outbox(ctx).PurgePublishedOutboxEvents(ctx, pgtype.Timestamptz{Time: before, Valid: true})
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to purge outbox events", "before", before, "error", err)
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// truncateError はエラーメッセージを保存できる長さに切り詰める
+func truncateError(msg string) string {
+	if len(msg) > maxErrorLength {
+		return msg[:maxErrorLength]
+	}
+	return msg
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"time"
 
 	"github.com/aazw/go-base/pkg/cerrors"
 	"github.com/google/uuid"
@@ -9,27 +10,129 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/postgres/apikeys"
+	"github.com/aazw/go-base/pkg/db/postgres/audit"
+	"github.com/aazw/go-base/pkg/db/postgres/outbox"
 	"github.com/aazw/go-base/pkg/db/postgres/users"
+	"github.com/aazw/go-base/pkg/db/postgres/usersearch"
+	"github.com/aazw/go-base/pkg/db/postgres/webhooks"
+	"github.com/aazw/go-base/pkg/logging"
 	"github.com/aazw/go-base/pkg/models"
 )
 
 type Handler struct {
-	pgPool       *pgxpool.Pool
-	usersQueries *users.Queries
+	pgPool          *pgxpool.Pool
+	usersQueries    *users.Queries
+	outboxQueries   *outbox.Queries
+	webhooksQueries *webhooks.Queries
+	auditQueries    *audit.Queries
+	apiKeysQueries  *apikeys.Queries
+	replicas        *replicaSet
 }
 
-func NewHandler(pgPool *pgxpool.Pool) (*Handler, error) {
+type handlerOptions struct {
+	replicas                   []*pgxpool.Pool
+	replicaHealthCheckInterval time.Duration
+}
+
+type HandlerOption func(*handlerOptions)
+
+// WithReplicas は読み取り専用の操作 (ListUsers, GetUser) を振り分けるレプリカを指定する
+func WithReplicas(pools ...*pgxpool.Pool) HandlerOption {
+	return func(o *handlerOptions) {
+		o.replicas = append(o.replicas, pools...)
+	}
+}
+
+// WithReplicaHealthCheckInterval は異常と判定したレプリカの復帰を確認する間隔を指定する
+func WithReplicaHealthCheckInterval(interval time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.replicaHealthCheckInterval = interval
+	}
+}
+
+func NewHandler(pgPool *pgxpool.Pool, options ...HandlerOption) (*Handler, error) {
+
+	opts := &handlerOptions{
+		replicaHealthCheckInterval: 5 * time.Second,
+	}
+	for _, option := range options {
+		option(opts)
+	}
 
 	return &Handler{
-		pgPool:       pgPool,
-		usersQueries: users.New(pgPool),
+		pgPool:          pgPool,
+		usersQueries:    users.New(pgPool),
+		outboxQueries:   outbox.New(pgPool),
+		webhooksQueries: webhooks.New(pgPool),
+		auditQueries:    audit.New(pgPool),
+		apiKeysQueries:  apikeys.New(pgPool),
+		replicas:        newReplicaSet(opts.replicas, opts.replicaHealthCheckInterval),
 	}, nil
 }
 
+// Close はレプリカのヘルスチェックを止める. プールは呼び出し元で閉じる
+func (p *Handler) Close() {
+	p.replicas.close()
+}
+
+// read は読み取り専用の操作を正常なレプリカで実行する
+// レプリカが無い/全て異常/read-your-writes が必要な場合, またはレプリカで接続エラーか該当なしになった場合はプライマリで実行する
+// トランザクション中はそのトランザクションで実行する
+func (p *Handler) read(ctx context.Context, fn func(q *users.Queries) error) error {
+	return p.readConn(ctx, func(conn users.DBTX) error {
+		return fn(users.New(conn))
+	})
+}
+
+// readConn は read と同じ振り分けで選んだ接続 (プール/トランザクション) を fn に渡す. users 以外のクエリ (usersearch 等) に使う
+// ctx にテナントが紐付けられている場合は, テナントを設定するため読み取り専用のトランザクションで実行する
+func (p *Handler) readConn(ctx context.Context, fn func(conn users.DBTX) error) error {
+
+	if tx, ok := txFromContext(ctx); ok {
+		return fn(tx)
+	}
+
+	if !db.ReadFromPrimary(ctx) {
+		if r := p.replicas.pick(); r != nil {
+			err := readInPool(ctx, r.pool, fn)
+			switch {
+			case isReplicaMiss(ctx, err):
+				// 遅れているレプリカにはまだ無い行かもしれないため, プライマリで確かめる
+			case !isReplicaFailure(ctx, err):
+				return err
+			default:
+				p.replicas.markUnhealthy(ctx, r, err)
+			}
+		}
+	}
+	return readInPool(ctx, p.pgPool, fn)
+}
+
+// readInPool は pool で fn を実行する. ctx にテナントが紐付けられている場合はトランザクションを開始してテナントを設定する
+func readInPool(ctx context.Context, pool *pgxpool.Pool, fn func(conn users.DBTX) error) error {
+
+	if !tenantScoped(ctx) {
+		return fn(pool)
+	}
+	return pgx.BeginTxFunc(ctx, pool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		if err := setTenant(ctx, tx); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
 func (p *Handler) ListUsers(ctx context.Context, params models.ListUsersParams) ([]*models.User, error) {
 
-	records, err := p.usersQueries.ListUsers(ctx)
+	var records []users.User
+	err := p.read(ctx, func(q *users.Queries) (err error) {
+		records, err = q.ListUsers(ctx)
+		return err
+	})
 	if err != nil {
+		logging.FromContext(ctx).Error("failed to list users", "error", err)
 		return nil, cerrors.ErrDBOperation.New(
 			cerrors.WithCause(err),
 		)
@@ -39,6 +142,7 @@ func (p *Handler) ListUsers(ctx context.Context, params models.ListUsersParams)
 	for _, record := range records {
 		users = append(users, &models.User{
 			ID:        record.ID,
+			TenantID:  record.TenantID,
 			Name:      record.Name,
 			Email:     record.Email,
 			CreatedAt: record.CreatedAt.Time,
@@ -50,12 +154,13 @@ func (p *Handler) ListUsers(ctx context.Context, params models.ListUsersParams)
 
 func (p *Handler) CreateUser(ctx context.Context, prototype *models.UserPrototype) (*models.User, error) {
 
-	record, err := p.usersQueries.CreateUser(ctx, users.CreateUserParams{
+	record, err := p.users(ctx).CreateUser(ctx, users.CreateUserParams{
 		ID:    prototype.ID,
 		Name:  prototype.Name,
 		Email: prototype.Email,
 	})
 	if err != nil {
+		logging.FromContext(ctx).Warn("failed to create user", "user_id", prototype.ID, "error", err)
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			switch pgErr.Code {
 			case "23505": // unique_violation
@@ -72,9 +177,11 @@ func (p *Handler) CreateUser(ctx context.Context, prototype *models.UserPrototyp
 			cerrors.WithCause(err),
 		)
 	}
+	db.MarkWritten(ctx)
 
 	return &models.User{
 		ID:        record.ID,
+		TenantID:  record.TenantID,
 		Name:      record.Name,
 		Email:     record.Email,
 		CreatedAt: record.CreatedAt.Time,
@@ -84,14 +191,48 @@ func (p *Handler) CreateUser(ctx context.Context, prototype *models.UserPrototyp
 
 func (p *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
 
-	record, err := p.usersQueries.GetUser(ctx, userID)
+	var record users.User
+	err := p.read(ctx, func(q *users.Queries) (err error) {
+		record, err = q.GetUser(ctx, userID)
+		return err
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			logging.FromContext(ctx).Debug("user not found", "user_id", userID)
+			return nil, cerrors.ErrDBNotFound.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("record not found"),
+			)
+		}
+		logging.FromContext(ctx).Error("failed to get user", "user_id", userID, "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	return &models.User{
+		ID:        record.ID,
+		TenantID:  record.TenantID,
+		Name:      record.Name,
+		Email:     record.Email,
+		CreatedAt: record.CreatedAt.Time,
+		UpdatedAt: record.UpdatedAt.Time,
+	}, nil
+}
+
+// GetUserForUpdate はトランザクション (RunInTx) の中で SELECT ... FOR UPDATE で読む. レプリカからは読まない
+func (p *Handler) GetUserForUpdate(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+
+	record, err := p.users(ctx).GetUserForUpdate(ctx, userID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
+			logging.FromContext(ctx).Debug("user not found", "user_id", userID)
 			return nil, cerrors.ErrDBNotFound.New(
 				cerrors.WithCause(err),
 				cerrors.WithMessage("record not found"),
 			)
 		}
+		logging.FromContext(ctx).Error("failed to get user for update", "user_id", userID, "error", err)
 		return nil, cerrors.ErrDBOperation.New(
 			cerrors.WithCause(err),
 		)
@@ -99,6 +240,7 @@ func (p *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User,
 
 	return &models.User{
 		ID:        record.ID,
+		TenantID:  record.TenantID,
 		Name:      record.Name,
 		Email:     record.Email,
 		CreatedAt: record.CreatedAt.Time,
@@ -108,12 +250,13 @@ func (p *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User,
 
 func (p *Handler) UpdateUser(ctx context.Context, userID uuid.UUID, prototype *models.UserPrototype) (*models.User, error) {
 
-	record, err := p.usersQueries.UpdateUser(ctx, users.UpdateUserParams{
+	record, err := p.users(ctx).UpdateUser(ctx, users.UpdateUserParams{
 		ID:    userID,
 		Name:  prototype.Name,
 		Email: prototype.Email,
 	})
 	if err != nil {
+		logging.FromContext(ctx).Warn("failed to update user", "user_id", userID, "error", err)
 		if err == pgx.ErrNoRows {
 			return nil, cerrors.ErrDBNotFound.New(
 				cerrors.WithCause(err),
@@ -136,9 +279,11 @@ func (p *Handler) UpdateUser(ctx context.Context, userID uuid.UUID, prototype *m
 			cerrors.WithCause(err),
 		)
 	}
+	db.MarkWritten(ctx)
 
 	return &models.User{
 		ID:        record.ID,
+		TenantID:  record.TenantID,
 		Name:      record.Name,
 		Email:     record.Email,
 		CreatedAt: record.CreatedAt.Time,
@@ -148,8 +293,9 @@ func (p *Handler) UpdateUser(ctx context.Context, userID uuid.UUID, prototype *m
 
 func (p *Handler) DeleteUSer(ctx context.Context, userID uuid.UUID) error {
 
-	ret, err := p.usersQueries.DeleteUser(ctx, userID)
+	ret, err := p.users(ctx).DeleteUser(ctx, userID)
 	if err != nil {
+		logging.FromContext(ctx).Error("failed to delete user", "user_id", userID, "error", err)
 		return cerrors.ErrDBOperation.New(
 			cerrors.WithCause(err),
 		)
@@ -160,5 +306,138 @@ func (p *Handler) DeleteUSer(ctx context.Context, userID uuid.UUID) error {
 			cerrors.WithMessage("record not found"),
 		)
 	}
+	db.MarkWritten(ctx)
 	return nil
 }
+
+func (p *Handler) ListUsersAfter(ctx context.Context, params models.ListUsersAfterParams) ([]*models.User, error) {
+
+	var records []users.User
+	err := p.read(ctx, func(q *users.Queries) (err error) {
+		records, err = q.ListUsersAfter(ctx, users.ListUsersAfterParams{
+			AfterName: params.AfterName,
+			AfterID:   params.AfterID,
+			RowLimit:  int32(params.Limit),
+		})
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to list users", "after_id", params.AfterID, "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	users := make([]*models.User, 0, len(records))
+	for _, record := range records {
+		users = append(users, &models.User{
+			ID:        record.ID,
+			TenantID:  record.TenantID,
+			Name:      record.Name,
+			Email:     record.Email,
+			CreatedAt: record.CreatedAt.Time,
+			UpdatedAt: record.UpdatedAt.Time,
+		})
+	}
+	return users, nil
+}
+
+// ImportUsers は prototypes を 1 つの INSERT (unnest) で書き込む
+func (p *Handler) SearchUsers(ctx context.Context, params models.SearchUsersParams) ([]*models.UserSearchResult, error) {
+
+	var records []usersearch.SearchUsersRow
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		records, err = usersearch.New(conn).SearchUsers(ctx, usersearch.SearchUsersParams{
+			Query:    params.Query,
+			RowLimit: int32(params.Limit),
+		})
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to search users", "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	results := make([]*models.UserSearchResult, 0, len(records))
+	for _, record := range records {
+		results = append(results, &models.UserSearchResult{
+			User: &models.User{
+				ID:        record.ID,
+				TenantID:  record.TenantID,
+				Name:      record.Name,
+				Email:     record.Email,
+				CreatedAt: record.CreatedAt.Time,
+				UpdatedAt: record.UpdatedAt.Time,
+			},
+			Rank: float64(record.Rank),
+		})
+	}
+	return results, nil
+}
+
+func (p *Handler) ImportUsers(ctx context.Context, prototypes []*models.UserPrototype, updateDuplicates bool) ([]*models.User, []*models.UserImportUpdate, error) {
+
+	ids := make([]uuid.UUID, 0, len(prototypes))
+	names := make([]string, 0, len(prototypes))
+	emails := make([]string, 0, len(prototypes))
+	for _, prototype := range prototypes {
+		ids = append(ids, prototype.ID)
+		names = append(names, prototype.Name)
+		emails = append(emails, prototype.Email)
+	}
+
+	created := []*models.User{}
+	updated := []*models.UserImportUpdate{}
+	var err error
+	if updateDuplicates {
+		var records []users.UpsertUsersRow
+		records, err = p.users(ctx).UpsertUsers(ctx, users.UpsertUsersParams{Ids: ids, Names: names, Emails: emails})
+		for _, record := range records {
+			user := &models.User{
+				ID:        record.ID,
+				TenantID:  record.TenantID,
+				Name:      record.Name,
+				Email:     record.Email,
+				CreatedAt: record.CreatedAt.Time,
+				UpdatedAt: record.UpdatedAt.Time,
+			}
+			if record.Inserted {
+				created = append(created, user)
+			} else {
+				before := *user
+				before.Name = record.PreviousName.String
+				updated = append(updated, &models.UserImportUpdate{Before: &before, After: user})
+			}
+		}
+	} else {
+		var records []users.User
+		records, err = p.users(ctx).ImportUsers(ctx, users.ImportUsersParams{Ids: ids, Names: names, Emails: emails})
+		for _, record := range records {
+			created = append(created, &models.User{
+				ID:        record.ID,
+				TenantID:  record.TenantID,
+				Name:      record.Name,
+				Email:     record.Email,
+				CreatedAt: record.CreatedAt.Time,
+				UpdatedAt: record.UpdatedAt.Time,
+			})
+		}
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to import users", "rows", len(prototypes), "error", err)
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" { // unique_violation (id)
+			return nil, nil, cerrors.ErrDBDuplicate.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil, nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+	if len(created) > 0 || len(updated) > 0 {
+		db.MarkWritten(ctx)
+	}
+	return created, updated, nil
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// PoolStatsCollector は pgxpool.Stat を Prometheus と OTel のメトリクスとして公開する
+// Prometheus へは Collector として, OTel へは Observable Instrument のコールバックとして, いずれも収集時に pool.Stat() を読む
+type PoolStatsCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns   *prometheus.Desc
+	idleConns       *prometheus.Desc
+	totalConns      *prometheus.Desc
+	maxConns        *prometheus.Desc
+	acquireCount    *prometheus.Desc
+	acquireDuration *prometheus.Desc
+	emptyAcquire    *prometheus.Desc
+
+	registration metric.Registration
+}
+
+// NewPoolStatsCollector は PoolStatsCollector を生成し, OTel のグローバル MeterProvider にゲージを登録する
+// namespace は Prometheus のメトリクス名の接頭辞. poolName はプールの識別名 (primary, replica-0 等) で pool ラベルに載る
+func NewPoolStatsCollector(namespace string, poolName string, pool *pgxpool.Pool) (*PoolStatsCollector, error) {
+
+	fqName := func(name string) string {
+		return prometheus.BuildFQName(namespace, "db_pool", name)
+	}
+	constLabels := prometheus.Labels{"pool": poolName}
+	c := &PoolStatsCollector{
+		pool:            pool,
+		acquiredConns:   prometheus.NewDesc(fqName("acquired_conns"), "使用中のコネクション数", nil, constLabels),
+		idleConns:       prometheus.NewDesc(fqName("idle_conns"), "アイドル状態のコネクション数", nil, constLabels),
+		totalConns:      prometheus.NewDesc(fqName("total_conns"), "プール内のコネクションの総数", nil, constLabels),
+		maxConns:        prometheus.NewDesc(fqName("max_conns"), "プールの最大コネクション数", nil, constLabels),
+		acquireCount:    prometheus.NewDesc(fqName("acquire_total"), "コネクションの取得に成功した回数", nil, constLabels),
+		acquireDuration: prometheus.NewDesc(fqName("acquire_wait_seconds_total"), "コネクションの取得に要した時間の合計（秒）", nil, constLabels),
+		emptyAcquire:    prometheus.NewDesc(fqName("empty_acquire_total"), "空きコネクションが無く待たされた取得の回数", nil, constLabels),
+	}
+
+	// OTel
+	// https://opentelemetry.io/docs/specs/semconv/database/database-metrics/#connection-pools
+	meter := otel.Meter(instrumentationName)
+	connCount, err := meter.Int64ObservableGauge(
+		"db.client.connection.count",
+		metric.WithDescription("The number of connections that are currently in state described by the state attribute."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return nil, newPoolStatsError(err)
+	}
+	connMax, err := meter.Int64ObservableGauge(
+		"db.client.connection.max",
+		metric.WithDescription("The maximum number of open connections allowed."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return nil, newPoolStatsError(err)
+	}
+	acquireWait, err := meter.Float64ObservableCounter(
+		"db.client.connection.wait_time.total",
+		metric.WithDescription("The cumulative time it took to obtain open connections from the pool."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, newPoolStatsError(err)
+	}
+
+	poolNameAttr := attribute.String("db.client.connection.pool.name", poolName)
+	stateUsed := metric.WithAttributes(poolNameAttr, attribute.String("db.client.connection.state", "used"))
+	stateIdle := metric.WithAttributes(poolNameAttr, attribute.String("db.client.connection.state", "idle"))
+	poolOnly := metric.WithAttributes(poolNameAttr)
+	c.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stat := pool.Stat()
+		o.ObserveInt64(connCount, int64(stat.AcquiredConns()), stateUsed)
+		o.ObserveInt64(connCount, int64(stat.IdleConns()), stateIdle)
+		o.ObserveInt64(connMax, int64(stat.MaxConns()), poolOnly)
+		o.ObserveFloat64(acquireWait, stat.AcquireDuration().Seconds(), poolOnly)
+		return nil
+	}, connCount, connMax, acquireWait)
+	if err != nil {
+		return nil, newPoolStatsError(err)
+	}
+
+	return c, nil
+}
+
+// Close は OTel のコールバックの登録を解除する
+func (c *PoolStatsCollector) Close() error {
+	if c.registration == nil {
+		return nil
+	}
+	return c.registration.Unregister()
+}
+
+// Describe は prometheus.Collector の実装
+func (c *PoolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquire
+}
+
+// Collect は prometheus.Collector の実装
+func (c *PoolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+}
+
+func newPoolStatsError(err error) error {
+	return cerrors.ErrSystemInternal.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("failed to create pool stats instrument"),
+	)
+}
@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+const instrumentationName = "github.com/aazw/go-base/pkg/db/postgres"
+
+const (
+	outcomeSuccess = "success"
+	outcomeError   = "error"
+)
+
+// sqlc が生成するクエリの先頭コメント (例: -- name: GetUser :one)
+var sqlcQueryNamePattern = regexp.MustCompile(`^\s*--\s*name:\s*(\w+)`)
+
+// QueryTracer は pgx.QueryTracer の実装
+// クエリ毎に span を作成し, 実行時間をヒストグラムに記録し, 閾値を超えたクエリをスロークエリとしてログに出す
+// Prometheus の Collector も兼ねる
+type QueryTracer struct {
+	tracer       trace.Tracer
+	duration     metric.Float64Histogram
+	promDuration *prometheus.HistogramVec
+
+	slowQueryThreshold time.Duration
+}
+
+type queryTracerContextKey struct{}
+
+// 1クエリ分の TraceQueryStart から TraceQueryEnd までの状態
+type queryTrace struct {
+	name  string
+	sql   string
+	args  []any
+	start time.Time
+	span  trace.Span
+}
+
+// NewQueryTracer は QueryTracer を生成する
+// namespace は Prometheus のメトリクス名の接頭辞. slowQueryThreshold が 0 の場合はスロークエリのログを出さない
+func NewQueryTracer(namespace string, slowQueryThreshold time.Duration) (*QueryTracer, error) {
+
+	// OTel
+	// グローバルの MeterProvider/TracerProvider が後から設定された場合もそちらに委譲される
+	duration, err := otel.Meter(instrumentationName).Float64Histogram(
+		"db.client.operation.duration",
+		metric.WithDescription("Duration of database client operations."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to create query duration histogram"),
+		)
+	}
+
+	// Prometheus
+	promDuration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "db_client",
+			Name:      "query_duration_seconds",
+			Help:      "PostgreSQL のクエリの実行に要した時間（秒）",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"query", "outcome"},
+	)
+
+	return &QueryTracer{
+		tracer:             otel.Tracer(instrumentationName),
+		duration:           duration,
+		promDuration:       promDuration,
+		slowQueryThreshold: slowQueryThreshold,
+	}, nil
+}
+
+// TraceQueryStart は pgx.QueryTracer の実装
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+
+	name := queryName(data.SQL)
+
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.statement", data.SQL),
+		attribute.String("db.operation", name),
+	}
+	if conn != nil {
+		if cfg := conn.Config(); cfg != nil {
+			attrs = append(attrs,
+				attribute.String("db.name", cfg.Database),
+				attribute.String("server.address", cfg.Host), // プライマリとレプリカの区別用
+			)
+		}
+	}
+
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+
+	return context.WithValue(ctx, queryTracerContextKey{}, &queryTrace{
+		name:  name,
+		sql:   data.SQL,
+		args:  data.Args,
+		start: time.Now(),
+		span:  span,
+	})
+}
+
+// TraceQueryEnd は pgx.QueryTracer の実装
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+
+	qt, ok := ctx.Value(queryTracerContextKey{}).(*queryTrace)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(qt.start)
+
+	outcome := outcomeSuccess
+	if data.Err != nil {
+		outcome = outcomeError
+		qt.span.RecordError(data.Err)
+		qt.span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		qt.span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	qt.span.End()
+
+	// metrics
+	t.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", qt.name),
+		attribute.String("outcome", outcome),
+	))
+	t.promDuration.WithLabelValues(qt.name, outcome).Observe(elapsed.Seconds())
+
+	// slow query
+	if t.slowQueryThreshold > 0 && elapsed >= t.slowQueryThreshold {
+		logging.FromContext(ctx).WarnContext(ctx, "slow query",
+			"query", qt.name,
+			"duration", elapsed,
+			"threshold", t.slowQueryThreshold,
+			"statement", qt.sql,
+			"args", redactArgs(qt.args),
+			"outcome", outcome,
+		)
+	}
+}
+
+// Describe は prometheus.Collector の実装
+func (t *QueryTracer) Describe(ch chan<- *prometheus.Desc) {
+	t.promDuration.Describe(ch)
+}
+
+// Collect は prometheus.Collector の実装
+func (t *QueryTracer) Collect(ch chan<- prometheus.Metric) {
+	t.promDuration.Collect(ch)
+}
+
+// queryName は sqlc のクエリ名を返す. sqlc 以外のクエリは先頭のキーワード (SELECT 等) を返す
+func queryName(sql string) string {
+	if m := sqlcQueryNamePattern.FindStringSubmatch(sql); m != nil {
+		return m[1]
+	}
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// redactArgs はクエリの引数を型名だけに置き換える (個人情報等をログに残さないため)
+func redactArgs(args []any) []string {
+	redacted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == nil {
+			redacted = append(redacted, "<nil>")
+			continue
+		}
+		redacted = append(redacted, fmt.Sprintf("<redacted:%T>", arg))
+	}
+	return redacted
+}
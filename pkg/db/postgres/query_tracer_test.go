@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{sql: "-- name: GetUser :one\nSELECT * FROM users WHERE id = $1", want: "GetUser"},
+		{sql: "  --name:ListUsers :many\nSELECT * FROM users", want: "ListUsers"},
+		{sql: "select 1", want: "SELECT"},
+		{sql: "", want: "unknown"},
+	}
+	for _, tt := range tests {
+		if got := queryName(tt.sql); got != tt.want {
+			t.Errorf("queryName(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	got := redactArgs([]any{"alice@example.com", 42, nil})
+	want := []string{"<redacted:string>", "<redacted:int>", "<nil>"}
+	if len(got) != len(want) {
+		t.Fatalf("redactArgs() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("redactArgs()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestQueryTracer_RecordsDurationByOutcome(t *testing.T) {
+	tracer, err := NewQueryTracer("test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "-- name: GetUser :one\nSELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "-- name: GetUser :one\nSELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	// query × outcome の2系列
+	if got := testutil.CollectAndCount(tracer); got != 2 {
+		t.Errorf("series = %d, want 2", got)
+	}
+}
+
+func TestQueryTracer_EndWithoutStart(t *testing.T) {
+	tracer, err := NewQueryTracer("test", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// TraceQueryStart を経ていない context では何もしない
+	tracer.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+	if got := testutil.CollectAndCount(tracer); got != 0 {
+		t.Errorf("series = %d, want 0", got)
+	}
+}
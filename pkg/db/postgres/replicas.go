@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+// replica は読み取り専用のレプリカ 1台分
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// replicaSet は正常なレプリカの中からラウンドロビンで選ぶロードバランサ
+// 接続エラーになったレプリカは異常として外し, バックグラウンドで ping が通れば戻す
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newReplicaSet(pools []*pgxpool.Pool, interval time.Duration) *replicaSet {
+
+	rs := &replicaSet{
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	for _, pool := range pools {
+		r := &replica{
+			pool: pool,
+		}
+		r.healthy.Store(true)
+		rs.replicas = append(rs.replicas, r)
+	}
+
+	if len(rs.replicas) > 0 && rs.interval > 0 {
+		rs.wg.Add(1)
+		go rs.healthCheckLoop()
+	}
+	return rs
+}
+
+// pick は正常なレプリカを1台返す. 正常なレプリカが無ければ nil
+func (rs *replicaSet) pick() *replica {
+	healthy := make([]*replica, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return healthy[rs.next.Add(1)%uint64(len(healthy))]
+}
+
+func (rs *replicaSet) markUnhealthy(ctx context.Context, r *replica, err error) {
+	if r.healthy.CompareAndSwap(true, false) {
+		logging.FromContext(ctx).Warn("postgres replica marked unhealthy", "host", r.pool.Config().ConnConfig.Host, "error", err)
+	}
+}
+
+func (rs *replicaSet) healthCheckLoop() {
+	defer rs.wg.Done()
+
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			rs.checkUnhealthy()
+		}
+	}
+}
+
+// checkUnhealthy は異常と判定したレプリカに ping し, 通れば正常に戻す
+func (rs *replicaSet) checkUnhealthy() {
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), rs.interval)
+		err := r.pool.Ping(ctx)
+		cancel()
+		if err == nil {
+			r.healthy.Store(true)
+			logging.FromContext(ctx).Info("postgres replica recovered", "host", r.pool.Config().ConnConfig.Host)
+		}
+	}
+}
+
+func (rs *replicaSet) close() {
+	close(rs.stop)
+	rs.wg.Wait()
+}
+
+// isReplicaMiss はレプリカでの該当なし (pgx.ErrNoRows) かを返す. レプリカは正常のままプライマリで再試行する
+// 他のセッションが作成した直後の行は遅れているレプリカにまだ無いことがあり, そのまま返すと該当なしがキャッシュ (negative cache) にも残るため
+func isReplicaMiss(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && errors.Is(err, pgx.ErrNoRows)
+}
+
+// isReplicaFailure はレプリカを切り離してプライマリで再試行すべきエラーかを返す
+// SQL としてのエラー (制約違反等) はプライマリでも同じ結果になるため対象外. 該当なしは isReplicaMiss
+func isReplicaFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08: Connection Exception, 57P: admin_shutdown / crash_shutdown / cannot_connect_now 等
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	return true
+}
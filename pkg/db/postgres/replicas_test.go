@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestReplicaSet_PickSkipsUnhealthy(t *testing.T) {
+	rs := &replicaSet{replicas: []*replica{{}, {}, {}}}
+	for _, r := range rs.replicas {
+		r.healthy.Store(true)
+	}
+	rs.replicas[1].healthy.Store(false)
+
+	seen := map[*replica]int{}
+	for range 6 {
+		seen[rs.pick()]++
+	}
+	if seen[rs.replicas[1]] != 0 {
+		t.Errorf("unhealthy replica picked %d times; want 0", seen[rs.replicas[1]])
+	}
+	if seen[rs.replicas[0]] != 3 || seen[rs.replicas[2]] != 3 {
+		t.Errorf("picks = %d/%d; want 3/3", seen[rs.replicas[0]], seen[rs.replicas[2]])
+	}
+
+	// 全て異常ならプライマリ (nil)
+	rs.replicas[0].healthy.Store(false)
+	rs.replicas[2].healthy.Store(false)
+	if r := rs.pick(); r != nil {
+		t.Error("pick() returned a replica while all replicas are unhealthy")
+	}
+}
+
+func TestIsReplicaMiss(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{name: "nil", ctx: context.Background(), err: nil, want: false},
+		{name: "no rows", ctx: context.Background(), err: pgx.ErrNoRows, want: true},
+		{name: "wrapped no rows", ctx: context.Background(), err: fmt.Errorf("get user: %w", pgx.ErrNoRows), want: true},
+		{name: "connection failure", ctx: context.Background(), err: &pgconn.PgError{Code: "08006"}, want: false},
+		{name: "canceled by caller", ctx: canceled, err: pgx.ErrNoRows, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isReplicaMiss(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("isReplicaMiss() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsReplicaFailure(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{name: "nil", ctx: context.Background(), err: nil, want: false},
+		{name: "no rows", ctx: context.Background(), err: pgx.ErrNoRows, want: false},
+		{name: "unique violation", ctx: context.Background(), err: &pgconn.PgError{Code: "23505"}, want: false},
+		{name: "connection failure", ctx: context.Background(), err: &pgconn.PgError{Code: "08006"}, want: true},
+		{name: "admin shutdown", ctx: context.Background(), err: &pgconn.PgError{Code: "57P01"}, want: true},
+		{name: "network error", ctx: context.Background(), err: errors.New("dial tcp: connection refused"), want: true},
+		{name: "canceled by caller", ctx: canceled, err: context.Canceled, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isReplicaFailure(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("isReplicaFailure() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db/postgres/users"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// GetTenant は tenantID のテナントを返す
+// tenants テーブルはテナントを特定する前に参照するため Row Level Security の対象外
+func (p *Handler) GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.Tenant, error) {
+
+	var record users.Tenant
+	err := p.read(ctx, func(q *users.Queries) (err error) {
+		record, err = q.GetTenant(ctx, tenantID)
+		return err
+	})
+	if err != nil {
+		return nil, tenantError(ctx, err, "tenant_id", tenantID)
+	}
+	return toTenant(record), nil
+}
+
+// GetTenantBySlug は slug (サブドメイン) のテナントを返す
+func (p *Handler) GetTenantBySlug(ctx context.Context, slug string) (*models.Tenant, error) {
+
+	var record users.Tenant
+	err := p.read(ctx, func(q *users.Queries) (err error) {
+		record, err = q.GetTenantBySlug(ctx, slug)
+		return err
+	})
+	if err != nil {
+		return nil, tenantError(ctx, err, "tenant_slug", slug)
+	}
+	return toTenant(record), nil
+}
+
+// 接続しているロールが Row Level Security を迂回するか (SUPERUSER または BYPASSRLS)
+const bypassRowLevelSecurityQuery = `SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`
+
+// CheckRowLevelSecurity は pool の接続に Row Level Security が適用されることを確かめる
+// SUPERUSER/BYPASSRLS のロールには FORCE ROW LEVEL SECURITY も効かず, 全てのテナントの行が見えてしまうためエラーを返す
+func CheckRowLevelSecurity(ctx context.Context, pool *pgxpool.Pool) error {
+
+	var bypass bool
+	if err := pool.QueryRow(ctx, bypassRowLevelSecurityQuery).Scan(&bypass); err != nil {
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to check the role of the connection"),
+		)
+	}
+	if bypass {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessagef("role %q bypasses row level security (superuser or bypassrls); connect as a role without them to isolate tenants", pool.Config().ConnConfig.User),
+		)
+	}
+	return nil
+}
+
+func tenantError(ctx context.Context, err error, key string, value any) error {
+
+	if err == pgx.ErrNoRows {
+		logging.FromContext(ctx).Debug("tenant not found", key, value)
+		return cerrors.ErrDBNotFound.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("record not found"),
+		)
+	}
+	logging.FromContext(ctx).Error("failed to get tenant", key, value, "error", err)
+	return cerrors.ErrDBOperation.New(
+		cerrors.WithCause(err),
+	)
+}
+
+func toTenant(record users.Tenant) *models.Tenant {
+	return &models.Tenant{
+		ID:        record.ID,
+		Slug:      record.Slug,
+		Name:      record.Name,
+		CreatedAt: record.CreatedAt.Time,
+		UpdatedAt: record.UpdatedAt.Time,
+	}
+}
@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/postgres/apikeys"
+	"github.com/aazw/go-base/pkg/db/postgres/audit"
+	"github.com/aazw/go-base/pkg/db/postgres/outbox"
+	"github.com/aazw/go-base/pkg/db/postgres/users"
+	"github.com/aazw/go-base/pkg/db/postgres/webhooks"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+type txKey struct{}
+
+// トランザクション内でのみ有効な設定 (SET LOCAL 相当) としてテナントを設定する. Row Level Security のポリシーが参照する
+// (db/migrations/000007_create_tenants_table.up.sql)
+const setTenantQuery = `SELECT set_config('app.tenant_id', $1, true), set_config('app.cross_tenant', $2, true)`
+
+// RunInTx は fn を1つのトランザクションで実行する
+// fn に渡される ctx で呼んだ Handler の操作は全て同じトランザクションに含まれ, fn がエラーを返すとロールバックされる
+// 既にトランザクション中の ctx で呼ばれた場合はそのトランザクションに合流する
+// ctx にテナント (db.WithTenant, db.WithCrossTenant) が紐付けられている場合はトランザクションの開始時に設定する
+func (p *Handler) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	if _, ok := txFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	err := pgx.BeginFunc(ctx, p.pgPool, func(tx pgx.Tx) error {
+		if err := setTenant(ctx, tx); err != nil {
+			return err
+		}
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+	if err != nil {
+		var cerr *cerrors.CustomError
+		if errors.As(err, &cerr) {
+			return err
+		}
+		logging.FromContext(ctx).Error("transaction failed", "error", err)
+		return cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("transaction failed"),
+		)
+	}
+	return nil
+}
+
+// tenantScoped は ctx にテナントが紐付けられているか (トランザクションでテナントを設定する必要があるか) を返す
+func tenantScoped(ctx context.Context) bool {
+	_, ok := db.TenantFromContext(ctx)
+	return ok || db.IsCrossTenant(ctx)
+}
+
+// setTenant は ctx に紐付けられたテナントを tx に設定する. 紐付けられていない場合は何もしない
+func setTenant(ctx context.Context, tx pgx.Tx) error {
+
+	if !tenantScoped(ctx) {
+		return nil
+	}
+	tenant := ""
+	if tenantID, ok := db.TenantFromContext(ctx); ok {
+		tenant = tenantID.String()
+	}
+	_, err := tx.Exec(ctx, setTenantQuery, tenant, strconv.FormatBool(db.IsCrossTenant(ctx)))
+	return err
+}
+
+func txFromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// users はトランザクション中であればそのトランザクションの users.Queries を返す
+func (p *Handler) users(ctx context.Context) *users.Queries {
+	if tx, ok := txFromContext(ctx); ok {
+		return p.usersQueries.WithTx(tx)
+	}
+	return p.usersQueries
+}
+
+// outbox はトランザクション中であればそのトランザクションの outbox.Queries を返す
+func (p *Handler) outbox(ctx context.Context) *outbox.Queries {
+	if tx, ok := txFromContext(ctx); ok {
+		return p.outboxQueries.WithTx(tx)
+	}
+	return p.outboxQueries
+}
+
+// webhooks はトランザクション中であればそのトランザクションの webhooks.Queries を返す
+func (p *Handler) webhooks(ctx context.Context) *webhooks.Queries {
+	if tx, ok := txFromContext(ctx); ok {
+		return p.webhooksQueries.WithTx(tx)
+	}
+	return p.webhooksQueries
+}
+
+// audit はトランザクション中であればそのトランザクションの audit.Queries を返す
+func (p *Handler) audit(ctx context.Context) *audit.Queries {
+	if tx, ok := txFromContext(ctx); ok {
+		return p.auditQueries.WithTx(tx)
+	}
+	return p.auditQueries
+}
+
+// apiKeys はトランザクション中であればそのトランザクションの apikeys.Queries を返す
+func (p *Handler) apiKeys(ctx context.Context) *apikeys.Queries {
+	if tx, ok := txFromContext(ctx); ok {
+		return p.apiKeysQueries.WithTx(tx)
+	}
+	return p.apiKeysQueries
+}
@@ -17,7 +17,7 @@ INSERT INTO users (
 ) VALUES (
   $1, $2, $3
 )
-RETURNING id, name, email, created_at, updated_at, deleted_at
+RETURNING id, name, email, created_at, updated_at, deleted_at, tenant_id
 `
 
 type CreateUserParams struct {
@@ -36,6 +36,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
@@ -54,7 +55,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, name, email, created_at, updated_at, deleted_at FROM users
+SELECT id, name, email, created_at, updated_at, deleted_at, tenant_id FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -68,12 +69,35 @@ func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.TenantID,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT id, name, email, created_at, updated_at, deleted_at, tenant_id FROM users
+WHERE id = $1 LIMIT 1
+FOR UPDATE
+`
+
+// 更新/削除の前の状態を読む. トランザクションが終わるまで他の更新/削除を待たせる
+func (q *Queries) GetUserForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, getUserForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, name, email, created_at, updated_at, deleted_at FROM users
+SELECT id, name, email, created_at, updated_at, deleted_at, tenant_id FROM users
 ORDER BY name
 `
 
@@ -93,6 +117,7 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.DeletedAt,
+			&i.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -109,7 +134,7 @@ UPDATE users SET
   name = $2,
   email = $3
 WHERE id = $1
-RETURNING id, name, email, created_at, updated_at, deleted_at
+RETURNING id, name, email, created_at, updated_at, deleted_at, tenant_id
 `
 
 type UpdateUserParams struct {
@@ -128,6 +153,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.DeletedAt,
+		&i.TenantID,
 	)
 	return i, err
 }
@@ -0,0 +1,538 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/postgres/users"
+	"github.com/aazw/go-base/pkg/db/postgres/webhooks"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// webhook と配信は Row Level Security の対象のため, トランザクション中でなければ読み取りは readConn, 書き込みは RunInTx でテナントを設定する
+// RunInTx は fn が返した cerrors のエラーをそのまま返すため, エラーの変換は fn の中で行う
+
+func (p *Handler) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+
+	var records []webhooks.Webhook
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		records, err = webhooks.New(conn).ListWebhooks(ctx)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to list webhooks", "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	items := []*models.Webhook{}
+	for _, record := range records {
+		items = append(items, toWebhook(record))
+	}
+	return items, nil
+}
+
+func (p *Handler) CreateWebhook(ctx context.Context, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+
+	var record webhooks.Webhook
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		record, err = p.webhooks(ctx).CreateWebhook(ctx, webhooks.CreateWebhookParams{
+			ID:          prototype.ID,
+			Url:         prototype.URL,
+			Description: prototype.Description,
+			EventTypes:  fromEventTypes(prototype.EventTypes),
+			Secret:      prototype.Secret,
+			Enabled:     prototype.Enabled,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to create webhook", "webhook_id", prototype.ID, "error", err)
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return toWebhook(record), nil
+}
+
+func (p *Handler) GetWebhook(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error) {
+
+	var record webhooks.Webhook
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		record, err = webhooks.New(conn).GetWebhook(ctx, webhookID)
+		return err
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			logging.FromContext(ctx).Debug("webhook not found", "webhook_id", webhookID)
+			return nil, cerrors.ErrDBNotFound.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("record not found"),
+			)
+		}
+		logging.FromContext(ctx).Error("failed to get webhook", "webhook_id", webhookID, "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	return toWebhook(record), nil
+}
+
+func (p *Handler) UpdateWebhook(ctx context.Context, webhookID uuid.UUID, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+
+	var record webhooks.Webhook
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		record, err = p.webhooks(ctx).UpdateWebhook(ctx, webhooks.UpdateWebhookParams{
+			ID:          webhookID,
+			Url:         prototype.URL,
+			Description: prototype.Description,
+			EventTypes:  fromEventTypes(prototype.EventTypes),
+			Secret:      prototype.Secret,
+			Enabled:     prototype.Enabled,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to update webhook", "webhook_id", webhookID, "error", err)
+			if err == pgx.ErrNoRows {
+				return cerrors.ErrDBNotFound.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("record not found"),
+				)
+			}
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return toWebhook(record), nil
+}
+
+func (p *Handler) DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error {
+
+	err := p.RunInTx(ctx, func(ctx context.Context) error {
+		ret, err := p.webhooks(ctx).DeleteWebhook(ctx, webhookID)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to delete webhook", "webhook_id", webhookID, "error", err)
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		if ret == 0 {
+			return cerrors.ErrDBNotFound.New(
+				cerrors.WithMessage("record not found"),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.MarkWritten(ctx)
+	return nil
+}
+
+// EnqueueWebhookDeliveries は event を配信対象の全ての webhook への配信として登録する. 登録した件数を返す
+// 配信対象は event のテナントの webhook に限る. 同じイベントが複数回渡された場合 (at-least-once) は重複して登録しない
+func (p *Handler) EnqueueWebhookDeliveries(ctx context.Context, event *models.Event, payload []byte) (int, error) {
+
+	enqueued := 0
+	err := p.RunInTx(ctx, func(ctx context.Context) error {
+
+		targets, err := p.webhooks(ctx).ListWebhooksForEvent(ctx, webhooks.ListWebhooksForEventParams{
+			TenantID:  event.TenantID,
+			EventType: string(event.Type),
+		})
+		if err != nil {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to list webhooks for event"),
+			)
+		}
+
+		for _, target := range targets {
+			id, err := uuid.NewV7()
+			if err != nil {
+				return cerrors.ErrSystemInternal.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("failed to generate delivery id"),
+				)
+			}
+			n, err := p.webhooks(ctx).InsertWebhookDelivery(ctx, webhooks.InsertWebhookDeliveryParams{
+				ID:        id,
+				TenantID:  event.TenantID,
+				WebhookID: target.ID,
+				EventID:   event.ID,
+				EventType: string(event.Type),
+				Payload:   payload,
+			})
+			if err != nil {
+				return cerrors.ErrDBOperation.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("failed to insert webhook delivery"),
+				)
+			}
+			enqueued += int(n)
+		}
+		return nil
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to enqueue webhook deliveries", "event_id", event.ID, "event_type", event.Type, "error", err)
+		return 0, err
+	}
+	return enqueued, nil
+}
+
+// ProcessWebhookDeliveries は配信待ちの配信を最大 limit 件取り出して1件ずつ deliver に渡し, 試行と結果 (成功 / 再試行待ち / 失敗) を記録する. 処理した件数を返す
+// 取り出しは短いトランザクションで行い, next_attempt_at を lease の後にして他の deliverer から隠す (リース). 送信はトランザクションの外で行い,
+// 結果は1件ずつ別のトランザクションで記録する. lease は1バッチの送信にかかる時間より長くすること
+// 失敗が maxConsecutiveFailures 回続いた webhook は無効にし, 同じバッチの残りの配信も行わない
+// ctx のテナントの配信が対象. 全てのテナントの配信を送信する場合は db.WithCrossTenant を使う
+func (p *Handler) ProcessWebhookDeliveries(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, maxConsecutiveFailures int, deliver func(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt) (int, error) {
+
+	var records []webhooks.ClaimWebhookDeliveriesRow
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		records, err = p.webhooks(ctx).ClaimWebhookDeliveries(ctx, webhooks.ClaimWebhookDeliveriesParams{
+			MaxDeliveries: int32(limit),
+			LeaseSeconds:  lease.Seconds(),
+		})
+		if err != nil {
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to claim webhook deliveries"),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	disabled := map[uuid.UUID]bool{}
+	for _, record := range records {
+		// 停止する場合, 残りの配信はリースが切れた後に送信する
+		if ctx.Err() != nil {
+			break
+		}
+		if disabled[record.WebhookID] {
+			continue
+		}
+
+		delivery := &models.WebhookDelivery{
+			ID:        record.ID,
+			WebhookID: record.WebhookID,
+			EventID:   record.EventID,
+			EventType: models.EventType(record.EventType),
+			Payload:   record.Payload,
+			Status:    models.WebhookDeliveryStatusPending,
+			Attempts:  int(record.Attempts),
+		}
+		webhook := &models.Webhook{
+			ID:      record.WebhookID,
+			URL:     record.Url,
+			Secret:  record.Secret,
+			Enabled: true,
+		}
+
+		attempt := deliver(ctx, delivery, webhook)
+		attempt.Attempt = delivery.Attempts + 1
+		err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+			disabled[webhook.ID], err = p.recordWebhookDeliveryAttempt(ctx, delivery, attempt, policy, maxConsecutiveFailures)
+			return err
+		})
+		if err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// recordWebhookDeliveryAttempt は配信の状態を更新して試行の履歴を書き込み, webhook の連続失敗数を更新する. webhook を無効にした場合は true
+// リースが切れて他の deliverer が先に記録していた場合は何もしない
+func (p *Handler) recordWebhookDeliveryAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt, policy models.RetryPolicy, maxConsecutiveFailures int) (bool, error) {
+
+	responseCode := pgtype.Int4{Int32: int32(attempt.ResponseCode), Valid: attempt.ResponseCode != 0}
+	lastError := pgtype.Text{String: truncateError(attempt.Error), Valid: attempt.Error != ""}
+
+	var marked int64
+	if attempt.Succeeded() {
+		var err error
+		marked, err = p.webhooks(ctx).MarkWebhookDeliverySucceeded(ctx, webhooks.MarkWebhookDeliverySucceededParams{
+			ID:               delivery.ID,
+			LastResponseCode: responseCode,
+			Attempts:         int32(delivery.Attempts),
+		})
+		if err != nil {
+			return false, cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to mark webhook delivery as succeeded"),
+			)
+		}
+	} else {
+		backoff, dead := policy.Next(attempt.Attempt)
+		status := models.WebhookDeliveryStatusPending
+		if dead {
+			status = models.WebhookDeliveryStatusFailed
+			logging.FromContext(ctx).Error("webhook delivery failed", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "attempts", attempt.Attempt, "response_code", attempt.ResponseCode, "error", attempt.Error)
+		} else {
+			logging.FromContext(ctx).Warn("failed to deliver webhook", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "attempts", attempt.Attempt, "response_code", attempt.ResponseCode, "retry_in", backoff, "error", attempt.Error)
+		}
+		var err error
+		marked, err = p.webhooks(ctx).MarkWebhookDeliveryFailed(ctx, webhooks.MarkWebhookDeliveryFailedParams{
+			ID:               delivery.ID,
+			Status:           string(status),
+			LastResponseCode: responseCode,
+			LastError:        lastError,
+			NextAttemptAt:    pgtype.Timestamptz{Time: time.Now().Add(backoff), Valid: true},
+			Attempts:         int32(delivery.Attempts),
+		})
+		if err != nil {
+			return false, cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to mark webhook delivery as failed"),
+			)
+		}
+	}
+	if marked == 0 {
+		logging.FromContext(ctx).Warn("webhook delivery was already recorded by another deliverer", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "attempts", attempt.Attempt)
+		return false, nil
+	}
+
+	err := p.webhooks(ctx).InsertWebhookDeliveryAttempt(ctx, webhooks.InsertWebhookDeliveryAttemptParams{
+		DeliveryID:   delivery.ID,
+		Attempt:      int32(attempt.Attempt),
+		ResponseCode: responseCode,
+		Error:        lastError,
+		DurationMs:   int32(attempt.Duration.Milliseconds()),
+	})
+	if err != nil {
+		return false, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to insert webhook delivery attempt"),
+		)
+	}
+
+	if attempt.Succeeded() {
+		if err := p.webhooks(ctx).ResetWebhookFailures(ctx, delivery.WebhookID); err != nil {
+			return false, cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessage("failed to reset webhook failures"),
+			)
+		}
+		return false, nil
+	}
+
+	updated, err := p.webhooks(ctx).IncrementWebhookFailures(ctx, webhooks.IncrementWebhookFailuresParams{
+		ID:                     delivery.WebhookID,
+		MaxConsecutiveFailures: int32(maxConsecutiveFailures),
+		DisabledReason:         fmt.Sprintf("disabled after %d consecutive failed deliveries", maxConsecutiveFailures),
+	})
+	if err != nil {
+		return false, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to increment webhook failures"),
+		)
+	}
+	if !updated.Enabled {
+		logging.FromContext(ctx).Warn("webhook disabled", "webhook_id", delivery.WebhookID, "consecutive_failures", updated.ConsecutiveFailures)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *Handler) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, params models.ListWebhookDeliveriesParams) ([]*models.WebhookDelivery, error) {
+
+	var records []webhooks.WebhookDelivery
+	err := p.readConn(ctx, func(conn users.DBTX) (err error) {
+		records, err = webhooks.New(conn).ListWebhookDeliveries(ctx, webhooks.ListWebhookDeliveriesParams{
+			WebhookID: webhookID,
+			Limit:     int32(params.Limit),
+		})
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to list webhook deliveries", "webhook_id", webhookID, "error", err)
+		return nil, cerrors.ErrDBOperation.New(
+			cerrors.WithCause(err),
+		)
+	}
+
+	items := []*models.WebhookDelivery{}
+	for _, record := range records {
+		items = append(items, toWebhookDelivery(record))
+	}
+	return items, nil
+}
+
+// GetWebhookDelivery は配信を試行の履歴と共に返す
+func (p *Handler) GetWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+
+	var record webhooks.WebhookDelivery
+	var attempts []webhooks.WebhookDeliveryAttempt
+	err := p.readConn(ctx, func(conn users.DBTX) error {
+		q := webhooks.New(conn)
+		var err error
+		record, err = q.GetWebhookDelivery(ctx, webhooks.GetWebhookDeliveryParams{
+			ID:        deliveryID,
+			WebhookID: webhookID,
+		})
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				logging.FromContext(ctx).Debug("webhook delivery not found", "webhook_id", webhookID, "delivery_id", deliveryID)
+				return cerrors.ErrDBNotFound.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("record not found"),
+				)
+			}
+			logging.FromContext(ctx).Error("failed to get webhook delivery", "webhook_id", webhookID, "delivery_id", deliveryID, "error", err)
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+
+		attempts, err = q.ListWebhookDeliveryAttempts(ctx, deliveryID)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to list webhook delivery attempts", "delivery_id", deliveryID, "error", err)
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := toWebhookDelivery(record)
+	delivery.AttemptLog = []*models.WebhookDeliveryAttempt{}
+	for _, attempt := range attempts {
+		delivery.AttemptLog = append(delivery.AttemptLog, &models.WebhookDeliveryAttempt{
+			Attempt:      int(attempt.Attempt),
+			ResponseCode: int(attempt.ResponseCode.Int32),
+			Error:        attempt.Error.String,
+			Duration:     time.Duration(attempt.DurationMs) * time.Millisecond,
+			AttemptedAt:  attempt.AttemptedAt.Time,
+		})
+	}
+	return delivery, nil
+}
+
+// RedeliverWebhookDelivery は配信を配信待ちに戻し, 直ちに再送させる
+func (p *Handler) RedeliverWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+
+	var record webhooks.WebhookDelivery
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		record, err = p.webhooks(ctx).RedeliverWebhookDelivery(ctx, webhooks.RedeliverWebhookDeliveryParams{
+			ID:        deliveryID,
+			WebhookID: webhookID,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to redeliver webhook delivery", "webhook_id", webhookID, "delivery_id", deliveryID, "error", err)
+			if err == pgx.ErrNoRows {
+				return cerrors.ErrDBNotFound.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("record not found"),
+				)
+			}
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.MarkWritten(ctx)
+
+	return toWebhookDelivery(record), nil
+}
+
+// PurgeWebhookDeliveries は before より前に完了 (succeeded/failed) した配信を試行の履歴ごと削除する. 削除した件数を返す
+// ctx のテナントの配信が対象. 全てのテナントを対象にする場合は db.WithCrossTenant を使う
+func (p *Handler) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+
+	var n int64
+	err := p.RunInTx(ctx, func(ctx context.Context) (err error) {
+		n, err = p.webhooks(ctx).PurgeWebhookDeliveries(ctx, pgtype.Timestamptz{Time: before, Valid: true})
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to purge webhook deliveries", "before", before, "error", err)
+			return cerrors.ErrDBOperation.New(
+				cerrors.WithCause(err),
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func toWebhook(record webhooks.Webhook) *models.Webhook {
+	eventTypes := make([]models.EventType, 0, len(record.EventTypes))
+	for _, t := range record.EventTypes {
+		eventTypes = append(eventTypes, models.EventType(t))
+	}
+	return &models.Webhook{
+		ID:                  record.ID,
+		TenantID:            record.TenantID,
+		URL:                 record.Url,
+		Description:         record.Description,
+		EventTypes:          eventTypes,
+		Secret:              record.Secret,
+		Enabled:             record.Enabled,
+		ConsecutiveFailures: int(record.ConsecutiveFailures),
+		DisabledReason:      record.DisabledReason.String,
+		CreatedAt:           record.CreatedAt.Time,
+		UpdatedAt:           record.UpdatedAt.Time,
+	}
+}
+
+func toWebhookDelivery(record webhooks.WebhookDelivery) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		ID:               record.ID,
+		TenantID:         record.TenantID,
+		WebhookID:        record.WebhookID,
+		EventID:          record.EventID,
+		EventType:        models.EventType(record.EventType),
+		Payload:          record.Payload,
+		Status:           models.WebhookDeliveryStatus(record.Status),
+		Attempts:         int(record.Attempts),
+		NextAttemptAt:    record.NextAttemptAt.Time,
+		LastResponseCode: int(record.LastResponseCode.Int32),
+		LastError:        record.LastError.String,
+		CreatedAt:        record.CreatedAt.Time,
+		UpdatedAt:        record.UpdatedAt.Time,
+		DeliveredAt:      record.DeliveredAt.Time,
+	}
+}
+
+func fromEventTypes(eventTypes []models.EventType) []string {
+	ret := make([]string, 0, len(eventTypes))
+	for _, t := range eventTypes {
+		ret = append(ret, string(t))
+	}
+	return ret
+}
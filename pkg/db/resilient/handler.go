@@ -0,0 +1,268 @@
+// Package resilient は db.Handler と cache.Store の呼び出しを resilience.Guard (サーキットブレーカーとバルクヘッド) で保護する
+//
+// 依存先が落ちている間は待たずに cerrors.ErrServiceUnavailable (cause は resilience.RejectedError) を返し,
+// リクエストがコネクションの空きや deadline を待って積み上がらないようにする
+package resilient
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+// Handler は db.Handler の各操作を guard の中で実行する
+// RunInTx の中で Handler を通る操作は同じ guard の枠の中で実行する (resilience.Guard.Do の再入)
+type Handler struct {
+	next  db.Handler
+	guard *resilience.Guard
+}
+
+var _ db.Handler = (*Handler)(nil)
+
+func NewHandler(next db.Handler, guard *resilience.Guard) (*Handler, error) {
+	if next == nil || guard == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("database handler and guard are required"),
+		)
+	}
+	return &Handler{
+		next:  next,
+		guard: guard,
+	}, nil
+}
+
+// call は fn を guard の中で実行して結果を返す
+func call[T any](ctx context.Context, guard *resilience.Guard, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := guard.Do(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (h *Handler) GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.Tenant, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.Tenant, error) {
+		return h.next.GetTenant(ctx, tenantID)
+	})
+}
+
+func (h *Handler) GetTenantBySlug(ctx context.Context, slug string) (*models.Tenant, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.Tenant, error) {
+		return h.next.GetTenantBySlug(ctx, slug)
+	})
+}
+
+func (h *Handler) ListUsers(ctx context.Context, params models.ListUsersParams) ([]*models.User, error) {
+	return call(ctx, h.guard, func(ctx context.Context) ([]*models.User, error) {
+		return h.next.ListUsers(ctx, params)
+	})
+}
+
+func (h *Handler) CreateUser(ctx context.Context, prototype *models.UserPrototype) (*models.User, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.User, error) {
+		return h.next.CreateUser(ctx, prototype)
+	})
+}
+
+func (h *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.User, error) {
+		return h.next.GetUser(ctx, userID)
+	})
+}
+
+func (h *Handler) GetUserForUpdate(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.User, error) {
+		return h.next.GetUserForUpdate(ctx, userID)
+	})
+}
+
+func (h *Handler) UpdateUser(ctx context.Context, userID uuid.UUID, prototype *models.UserPrototype) (*models.User, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.User, error) {
+		return h.next.UpdateUser(ctx, userID, prototype)
+	})
+}
+
+func (h *Handler) DeleteUSer(ctx context.Context, userID uuid.UUID) error {
+	return h.guard.Do(ctx, func(ctx context.Context) error {
+		return h.next.DeleteUSer(ctx, userID)
+	})
+}
+
+func (h *Handler) ListUsersAfter(ctx context.Context, params models.ListUsersAfterParams) ([]*models.User, error) {
+	return call(ctx, h.guard, func(ctx context.Context) ([]*models.User, error) {
+		return h.next.ListUsersAfter(ctx, params)
+	})
+}
+
+func (h *Handler) SearchUsers(ctx context.Context, params models.SearchUsersParams) ([]*models.UserSearchResult, error) {
+	return call(ctx, h.guard, func(ctx context.Context) ([]*models.UserSearchResult, error) {
+		return h.next.SearchUsers(ctx, params)
+	})
+}
+
+func (h *Handler) ImportUsers(ctx context.Context, prototypes []*models.UserPrototype, updateDuplicates bool) ([]*models.User, []*models.UserImportUpdate, error) {
+	var created []*models.User
+	var updated []*models.UserImportUpdate
+	err := h.guard.Do(ctx, func(ctx context.Context) error {
+		var err error
+		created, updated, err = h.next.ImportUsers(ctx, prototypes, updateDuplicates)
+		return err
+	})
+	return created, updated, err
+}
+
+func (h *Handler) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return h.guard.Do(ctx, func(ctx context.Context) error {
+		return h.next.RunInTx(ctx, fn)
+	})
+}
+
+func (h *Handler) AppendEvent(ctx context.Context, event *models.Event) error {
+	return h.guard.Do(ctx, func(ctx context.Context) error {
+		return h.next.AppendEvent(ctx, event)
+	})
+}
+
+// ProcessOutbox は保護しない. publish (ブローカーへの送信) の失敗を DB の障害に数えず, 長く掛かる処理でバルクヘッドの枠を塞がないため
+func (h *Handler) ProcessOutbox(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, publish func(ctx context.Context, event *models.Event) error) (int, error) {
+	return h.next.ProcessOutbox(ctx, limit, lease, policy, publish)
+}
+
+func (h *Handler) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return h.guard.Do(ctx, func(ctx context.Context) error {
+		return h.next.AppendAuditEvent(ctx, event)
+	})
+}
+
+func (h *Handler) ListAuditEvents(ctx context.Context, params models.ListAuditEventsParams) ([]*models.AuditEvent, error) {
+	return call(ctx, h.guard, func(ctx context.Context) ([]*models.AuditEvent, error) {
+		return h.next.ListAuditEvents(ctx, params)
+	})
+}
+
+func (h *Handler) PurgeAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (int64, error) {
+		return h.next.PurgeAuditEvents(ctx, before)
+	})
+}
+
+func (h *Handler) PurgeOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (int64, error) {
+		return h.next.PurgeOutboxEvents(ctx, before)
+	})
+}
+
+func (h *Handler) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+	return call(ctx, h.guard, func(ctx context.Context) ([]*models.Webhook, error) {
+		return h.next.ListWebhooks(ctx)
+	})
+}
+
+func (h *Handler) CreateWebhook(ctx context.Context, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.Webhook, error) {
+		return h.next.CreateWebhook(ctx, prototype)
+	})
+}
+
+func (h *Handler) GetWebhook(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.Webhook, error) {
+		return h.next.GetWebhook(ctx, webhookID)
+	})
+}
+
+func (h *Handler) UpdateWebhook(ctx context.Context, webhookID uuid.UUID, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.Webhook, error) {
+		return h.next.UpdateWebhook(ctx, webhookID, prototype)
+	})
+}
+
+func (h *Handler) DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error {
+	return h.guard.Do(ctx, func(ctx context.Context) error {
+		return h.next.DeleteWebhook(ctx, webhookID)
+	})
+}
+
+func (h *Handler) EnqueueWebhookDeliveries(ctx context.Context, event *models.Event, payload []byte) (int, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (int, error) {
+		return h.next.EnqueueWebhookDeliveries(ctx, event, payload)
+	})
+}
+
+// ProcessWebhookDeliveries は ProcessOutbox と同じ理由で保護しない
+func (h *Handler) ProcessWebhookDeliveries(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, maxConsecutiveFailures int, deliver func(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt) (int, error) {
+	return h.next.ProcessWebhookDeliveries(ctx, limit, lease, policy, maxConsecutiveFailures, deliver)
+}
+
+func (h *Handler) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, params models.ListWebhookDeliveriesParams) ([]*models.WebhookDelivery, error) {
+	return call(ctx, h.guard, func(ctx context.Context) ([]*models.WebhookDelivery, error) {
+		return h.next.ListWebhookDeliveries(ctx, webhookID, params)
+	})
+}
+
+func (h *Handler) GetWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.WebhookDelivery, error) {
+		return h.next.GetWebhookDelivery(ctx, webhookID, deliveryID)
+	})
+}
+
+func (h *Handler) RedeliverWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.WebhookDelivery, error) {
+		return h.next.RedeliverWebhookDelivery(ctx, webhookID, deliveryID)
+	})
+}
+
+func (h *Handler) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (int64, error) {
+		return h.next.PurgeWebhookDeliveries(ctx, before)
+	})
+}
+
+func (h *Handler) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	return call(ctx, h.guard, func(ctx context.Context) ([]*models.APIKey, error) {
+		return h.next.ListAPIKeys(ctx)
+	})
+}
+
+func (h *Handler) CreateAPIKey(ctx context.Context, prototype *models.APIKeyPrototype) (*models.APIKey, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.APIKey, error) {
+		return h.next.CreateAPIKey(ctx, prototype)
+	})
+}
+
+func (h *Handler) GetAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.APIKey, error) {
+		return h.next.GetAPIKey(ctx, apiKeyID)
+	})
+}
+
+func (h *Handler) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.APIKey, error) {
+		return h.next.GetAPIKeyByPrefix(ctx, prefix)
+	})
+}
+
+func (h *Handler) RevokeAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.APIKey, error) {
+		return h.next.RevokeAPIKey(ctx, apiKeyID)
+	})
+}
+
+func (h *Handler) ExpireAPIKey(ctx context.Context, apiKeyID uuid.UUID, expiresAt time.Time) (*models.APIKey, error) {
+	return call(ctx, h.guard, func(ctx context.Context) (*models.APIKey, error) {
+		return h.next.ExpireAPIKey(ctx, apiKeyID, expiresAt)
+	})
+}
+
+func (h *Handler) TouchAPIKey(ctx context.Context, apiKeyID uuid.UUID, interval time.Duration) error {
+	return h.guard.Do(ctx, func(ctx context.Context) error {
+		return h.next.TouchAPIKey(ctx, apiKeyID, interval)
+	})
+}
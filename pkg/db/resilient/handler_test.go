@@ -0,0 +1,84 @@
+package resilient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/db/memory"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+// failingDB は GetTenant が down の間は接続エラーを返す db.Handler
+type failingDB struct {
+	*memory.Handler
+	down bool
+}
+
+func (f *failingDB) GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.Tenant, error) {
+	if f.down {
+		return nil, cerrors.ErrDBConnection.New(cerrors.WithMessage("connection refused"))
+	}
+	return f.Handler.GetTenant(ctx, tenantID)
+}
+
+func TestHandler(t *testing.T) {
+	mem, err := memory.NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &failingDB{Handler: mem}
+	guard, err := resilience.NewGuard("postgres", resilience.Config{
+		Breaker: &resilience.BreakerConfig{
+			Window:              time.Minute,
+			MinRequests:         2,
+			FailureRate:         0.5,
+			OpenDuration:        time.Minute,
+			HalfOpenMaxRequests: 1,
+		},
+		Bulkhead: &resilience.BulkheadConfig{MaxConcurrent: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandler(next, guard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := db.WithCrossTenant(context.Background())
+
+	// トランザクションの中の操作は同じ枠の中で実行する (バルクヘッドの上限が 1 でも待たない)
+	err = h.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := h.ListUsers(ctx, models.ListUsersParams{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("RunInTx() = %v; want nil", err)
+	}
+
+	// 存在しないレコードは障害に数えない
+	for range 2 {
+		if _, err := h.GetUser(ctx, uuid.New()); err == nil {
+			t.Fatal("GetUser() of unknown user succeeded; want DB_NOT_FOUND")
+		}
+	}
+	if got := guard.Breaker().State(); got != resilience.StateClosed {
+		t.Fatalf("state after not found = %s; want closed", got)
+	}
+
+	// 接続エラーが続くと open になり (3/6), 以降は呼ばずに断る
+	next.down = true
+	for range 3 {
+		_, _ = h.GetTenant(ctx, uuid.New())
+	}
+	next.down = false
+	_, err = h.ListUsers(ctx, models.ListUsersParams{})
+	if rejected, ok := resilience.Rejected(err); !ok || rejected.Reason != resilience.ReasonCircuitOpen {
+		t.Fatalf("ListUsers() while open = %v; want circuit_open", err)
+	}
+}
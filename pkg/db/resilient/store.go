@@ -0,0 +1,60 @@
+package resilient
+
+import (
+	"context"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db/cache"
+	"github.com/aazw/go-base/pkg/resilience"
+)
+
+// Store は cache.Store の各操作を guard の中で実行する
+// キャッシュは読み書きに失敗しても DB にフォールバックするため, Valkey が落ちている間は待たずに諦めさせる
+type Store struct {
+	next  cache.Store
+	guard *resilience.Guard
+}
+
+var _ cache.Store = (*Store)(nil)
+
+func NewStore(next cache.Store, guard *resilience.Guard) (*Store, error) {
+	if next == nil || guard == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("cache store and guard are required"),
+		)
+	}
+	return &Store{
+		next:  next,
+		guard: guard,
+	}, nil
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	return call(ctx, s.guard, func(ctx context.Context) ([]byte, error) {
+		return s.next.Get(ctx, key)
+	})
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.guard.Do(ctx, func(ctx context.Context) error {
+		return s.next.Set(ctx, key, value, ttl)
+	})
+}
+
+func (s *Store) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return call(ctx, s.guard, func(ctx context.Context) (bool, error) {
+		return s.next.SetNX(ctx, key, value, ttl)
+	})
+}
+
+func (s *Store) Publish(ctx context.Context, channel string, message string) error {
+	return s.guard.Do(ctx, func(ctx context.Context) error {
+		return s.next.Publish(ctx, channel, message)
+	})
+}
+
+// Subscribe は保護しない. 接続を張り続ける呼び出しでバルクヘッドの枠を塞がないため (切れた場合は cache.Handler が張り直す)
+func (s *Store) Subscribe(ctx context.Context, channel string, onSubscribe func(), onMessage func(message string)) error {
+	return s.next.Subscribe(ctx, channel, onSubscribe, onMessage)
+}
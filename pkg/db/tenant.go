@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type tenantKey struct{}
+
+type crossTenantKey struct{}
+
+// WithTenant は以降の操作を tenantID のテナントに限定するよう ctx に紐付ける
+// PostgreSQL ではトランザクションごとに app.tenant_id を設定し, Row Level Security で他のテナントの行を見えなくする
+func WithTenant(ctx context.Context, tenantID uuid.UUID) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext は ctx に紐付けられたテナントを返す. 紐付けられていない場合は false を返す
+func TenantFromContext(ctx context.Context) (uuid.UUID, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(uuid.UUID)
+	return tenantID, ok && tenantID != uuid.Nil
+}
+
+// WithCrossTenant は以降の操作で全てのテナントの行を扱えるよう ctx に印を付ける
+// super-admin の管理用 API や, テナントによらないメンテナンス (監査ログの削除等) に限って使う
+func WithCrossTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, crossTenantKey{}, true)
+}
+
+// IsCrossTenant は ctx が全てのテナントの行を扱えるかを返す
+func IsCrossTenant(ctx context.Context) bool {
+	crossTenant, _ := ctx.Value(crossTenantKey{}).(bool)
+	return crossTenant
+}
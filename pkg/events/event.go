@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// Message は sink に送るイベントの JSON 表現
+type Message struct {
+	ID            uuid.UUID         `json:"id"`
+	TenantID      uuid.UUID         `json:"tenant_id"`
+	Type          models.EventType  `json:"type"`
+	AggregateType string            `json:"aggregate_type"`
+	AggregateID   uuid.UUID         `json:"aggregate_id"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+	Payload       json.RawMessage   `json:"payload"`
+	TraceContext  map[string]string `json:"trace_context,omitempty"`
+}
+
+// UserPayload は user.* イベントの payload
+type UserPayload struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Email     string     `json:"email,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// New は tenantID のテナントで発生したイベントを生成する. ctx の trace context (traceparent 等) をイベントに記録する
+func New(ctx context.Context, tenantID uuid.UUID, eventType models.EventType, aggregateType string, aggregateID uuid.UUID, payload any) (*models.Event, error) {
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to generate event id"),
+		)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("failed to marshal payload of %s", eventType),
+		)
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return &models.Event{
+		ID:            id,
+		TenantID:      tenantID,
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       data,
+		OccurredAt:    time.Now().UTC(),
+		TraceContext:  carrier,
+	}, nil
+}
+
+// NewUserEvent は user.* イベントを user のテナントで生成する. user.deleted の場合 payload は ID のみ
+func NewUserEvent(ctx context.Context, eventType models.EventType, user *models.User) (*models.Event, error) {
+
+	payload := UserPayload{ID: user.ID}
+	if eventType != models.EventTypeUserDeleted {
+		payload.Name = user.Name
+		payload.Email = user.Email
+		payload.CreatedAt = &user.CreatedAt
+		payload.UpdatedAt = &user.UpdatedAt
+	}
+	return New(ctx, user.TenantID, eventType, models.AggregateTypeUser, user.ID, payload)
+}
+
+// NewMessage はイベントを sink に送る形に変換する
+func NewMessage(event *models.Event) *Message {
+	return &Message{
+		ID:            event.ID,
+		TenantID:      event.TenantID,
+		Type:          event.Type,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		OccurredAt:    event.OccurredAt,
+		Payload:       event.Payload,
+		TraceContext:  event.TraceContext,
+	}
+}
+
+// ContextWithTraceContext はイベントに記録された trace context を ctx に復元する
+func ContextWithTraceContext(ctx context.Context, event *models.Event) context.Context {
+	if len(event.TraceContext) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(event.TraceContext))
+}
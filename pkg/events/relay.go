@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/poll"
+)
+
+const instrumentationName = "github.com/aazw/go-base/pkg/events"
+
+// OutboxStore は relay が outbox を読み書きするためのインターフェース (db.Handler が満たす)
+type OutboxStore interface {
+	ProcessOutbox(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, publish func(ctx context.Context, event *models.Event) error) (int, error)
+}
+
+type RelayConfig struct {
+	// outbox を確認する間隔. 1回で BatchSize 件取り出せた場合は待たずに続けて処理し, 失敗が続く場合は間隔を空ける (poll.Run)
+	PollInterval time.Duration
+	BatchSize    int
+	RetryPolicy  models.RetryPolicy
+
+	// 取り出したイベントを他の relay から隠しておく時間. 結果を記録する前に停止したイベントはこの後に再び配信する
+	// 1バッチを配信し終えるまでの時間より長くする
+	Lease time.Duration
+}
+
+// Relay は outbox に書き込まれたイベントを sink に配信する
+type Relay struct {
+	store  OutboxStore
+	sink   Sink
+	config RelayConfig
+	tracer trace.Tracer
+}
+
+func NewRelay(store OutboxStore, sink Sink, config RelayConfig) (*Relay, error) {
+	if store == nil || sink == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("outbox store and sink are required"),
+		)
+	}
+	if config.PollInterval <= 0 || config.BatchSize <= 0 || config.Lease <= 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid relay config: poll_interval=%s, batch_size=%d, lease=%s", config.PollInterval, config.BatchSize, config.Lease),
+		)
+	}
+	return &Relay{
+		store:  store,
+		sink:   sink,
+		config: config,
+		tracer: otel.Tracer(instrumentationName),
+	}, nil
+}
+
+// Run は ctx がキャンセルされるまで outbox を監視して配信し続ける
+func (r *Relay) Run(ctx context.Context) error {
+
+	logger := logging.FromContext(ctx).With("component", "outbox_relay", "sink", r.sink.Name())
+	logger.Info("outbox relay started")
+
+	poll.Run(ctx, r.config.PollInterval, r.config.BatchSize, r.RunOnce, func(err error, retryIn time.Duration) {
+		logger.Error("failed to process outbox", "retry_in", retryIn, "error", err)
+	})
+
+	logger.Info("outbox relay stopped")
+	return nil
+}
+
+// RunOnce は outbox から1バッチ分を配信する. 処理した件数を返す
+// 全てのテナントのイベントを配信する. 配信先 (webhook 等) はイベントのテナント (models.Event.TenantID) で絞り込む
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	return r.store.ProcessOutbox(db.WithCrossTenant(ctx), r.config.BatchSize, r.config.Lease, r.config.RetryPolicy, r.publish)
+}
+
+func (r *Relay) publish(ctx context.Context, event *models.Event) error {
+
+	// イベントを発生させたリクエストの trace に繋げる
+	ctx = ContextWithTraceContext(ctx, event)
+	ctx, span := r.tracer.Start(ctx, "publish "+string(event.Type),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", r.sink.Name()),
+			attribute.String("messaging.operation.type", "send"),
+			attribute.String("messaging.message.id", event.ID.String()),
+			attribute.String("event.type", string(event.Type)),
+			attribute.Int("event.attempts", event.Attempts+1),
+		),
+	)
+	defer span.End()
+
+	if err := r.sink.Publish(ctx, event); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// fakeOutboxStore は events を1回だけ publish に渡し, 失敗したイベントを記録する
+type fakeOutboxStore struct {
+	events []*models.Event
+	failed map[uuid.UUID]error
+}
+
+func (s *fakeOutboxStore) ProcessOutbox(ctx context.Context, limit int, _ time.Duration, _ models.RetryPolicy, publish func(ctx context.Context, event *models.Event) error) (int, error) {
+	n := 0
+	for len(s.events) > 0 && n < limit {
+		event := s.events[0]
+		s.events = s.events[1:]
+		if err := publish(ctx, event); err != nil {
+			s.failed[event.ID] = err
+		}
+		n++
+	}
+	return n, nil
+}
+
+type recordingSink struct {
+	name      string
+	err       error
+	published []*models.Event
+}
+
+func (s *recordingSink) Name() string {
+	return s.name
+}
+
+func (s *recordingSink) Publish(_ context.Context, event *models.Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.published = append(s.published, event)
+	return nil
+}
+
+func newTestUserEvent(t *testing.T) *models.Event {
+	t.Helper()
+	event, err := NewUserEvent(context.Background(), models.EventTypeUserCreated, &models.User{
+		ID:    uuid.New(),
+		Name:  "test",
+		Email: "test@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestRelay_RunOnce(t *testing.T) {
+	ok := &recordingSink{name: "ok"}
+	ng := &recordingSink{name: "ng", err: errors.New("unavailable")}
+	store := &fakeOutboxStore{failed: map[uuid.UUID]error{}}
+	for range 3 {
+		store.events = append(store.events, newTestUserEvent(t))
+	}
+
+	relay, err := NewRelay(store, MultiSink{ok, ng}, RelayConfig{PollInterval: time.Second, BatchSize: 2, Lease: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := relay.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("RunOnce() = %d; want 2 (batch size)", n)
+	}
+	if len(ok.published) != 2 {
+		t.Errorf("published to ok sink = %d; want 2", len(ok.published))
+	}
+	// 1つの sink の失敗でイベント全体が失敗になる
+	if len(store.failed) != 2 {
+		t.Errorf("failed events = %d; want 2", len(store.failed))
+	}
+}
+
+func TestNewRelay_InvalidConfig(t *testing.T) {
+	store := &fakeOutboxStore{}
+	sink := &recordingSink{name: "ok"}
+	if _, err := NewRelay(store, sink, RelayConfig{}); err == nil {
+		t.Error("NewRelay() with zero config: error = nil; want error")
+	}
+	if _, err := NewRelay(nil, sink, RelayConfig{PollInterval: time.Second, BatchSize: 1, Lease: time.Minute}); err == nil {
+		t.Error("NewRelay() without store: error = nil; want error")
+	}
+}
+
+func TestStdoutSink_Publish(t *testing.T) {
+	var buf bytes.Buffer
+	sink, err := NewStdoutSink(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := newTestUserEvent(t)
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg Message
+	if err := json.Unmarshal(buf.Bytes(), &msg); err != nil {
+		t.Fatalf("output is not JSON: %v: %s", err, buf.String())
+	}
+	if msg.ID != event.ID || msg.Type != models.EventTypeUserCreated || msg.AggregateID != event.AggregateID {
+		t.Errorf("message = %+v; want event %s", msg, event.ID)
+	}
+	var payload UserPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.Email != "test@example.com" {
+		t.Errorf("payload = %s; want user payload", msg.Payload)
+	}
+}
+
+func TestWebhookSink_Publish(t *testing.T) {
+	var gotHeader http.Header
+	var gotMessage Message
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		_ = json.NewDecoder(r.Body).Decode(&gotMessage)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink, err := NewWebhookSink(srv.URL, map[string]string{"Authorization": "Bearer token"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := newTestUserEvent(t)
+
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if gotHeader.Get("X-Event-ID") != event.ID.String() || gotHeader.Get("X-Event-Type") != string(event.Type) {
+		t.Errorf("event headers = %v", gotHeader)
+	}
+	if gotHeader.Get("Authorization") != "Bearer token" {
+		t.Errorf("Authorization = %q; want configured header", gotHeader.Get("Authorization"))
+	}
+	if gotMessage.ID != event.ID {
+		t.Errorf("message id = %s; want %s", gotMessage.ID, event.ID)
+	}
+
+	// 2xx 以外は失敗
+	status = http.StatusServiceUnavailable
+	if err := sink.Publish(context.Background(), event); err == nil {
+		t.Error("Publish() error = nil for 503; want error")
+	}
+}
+
+func TestNewWebhookSink_InvalidURL(t *testing.T) {
+	if _, err := NewWebhookSink("ftp://example.com", nil, time.Second); err == nil {
+		t.Error("NewWebhookSink() error = nil for ftp url; want error")
+	}
+}
@@ -0,0 +1,33 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// Sink はイベントの配信先
+// 配信は at-least-once であり, 同じイベントが複数回届くことがある (受信側は ID で重複を除くこと)
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event *models.Event) error
+}
+
+// MultiSink は複数の sink に配信する. 1つでも失敗したらエラーを返し, イベント全体が再試行される
+type MultiSink []Sink
+
+func (s MultiSink) Name() string {
+	return "multi"
+}
+
+func (s MultiSink) Publish(ctx context.Context, event *models.Event) error {
+	var errs error
+	for _, sink := range s {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// StdoutSink はイベントを JSON Lines で書き出す. 開発用
+type StdoutSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutSink は StdoutSink を生成する. w が nil の場合は os.Stdout
+func NewStdoutSink(w io.Writer) (*StdoutSink, error) {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &StdoutSink{w: w}, nil
+}
+
+func (s *StdoutSink) Name() string {
+	return "stdout"
+}
+
+func (s *StdoutSink) Publish(_ context.Context, event *models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.NewEncoder(s.w).Encode(NewMessage(event))
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// ValkeySink はイベントを Valkey Streams に XADD する
+// エントリのフィールドは type (イベント種別) と event (Message の JSON)
+type ValkeySink struct {
+	pool   *redis.Pool
+	stream string
+	maxLen int64
+}
+
+// NewValkeySink は ValkeySink を生成する. maxLen が 0 より大きい場合はストリームをおおよそその長さに保つ (MAXLEN ~)
+func NewValkeySink(pool *redis.Pool, stream string, maxLen int64) (*ValkeySink, error) {
+	if pool == nil || stream == "" {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("valkey pool and stream are required"),
+		)
+	}
+	return &ValkeySink{
+		pool:   pool,
+		stream: stream,
+		maxLen: maxLen,
+	}, nil
+}
+
+func (s *ValkeySink) Name() string {
+	return "valkey"
+}
+
+func (s *ValkeySink) Publish(ctx context.Context, event *models.Event) error {
+
+	data, err := json.Marshal(NewMessage(event))
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := redis.Args{s.stream}
+	if s.maxLen > 0 {
+		args = args.Add("MAXLEN", "~", s.maxLen)
+	}
+	args = args.Add("*", "type", string(event.Type), "event", data)
+	_, err = redis.DoContext(conn, ctx, "XADD", args...)
+	return err
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+const instrumentationName = "github.com/aazw/go-base/pkg/jobs"
+
+// Job はキューに積むジョブ. そのまま JSON でキューに保存する
+type Job struct {
+	ID      uuid.UUID       `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+
+	// これまでに失敗した回数
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+
+	EnqueuedAt time.Time `json:"enqueued_at"`
+
+	// ジョブを登録したリクエストの trace context (traceparent 等)
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+
+	// キューから取り出したときの値. Ack 等でキューから取り除く際に使う
+	raw string
+}
+
+// NewJob はジョブを生成する. payload は JSON にして保存し, ctx の trace context をジョブに記録する
+func NewJob(ctx context.Context, jobType string, payload any) (*Job, error) {
+
+	if jobType == "" {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("job type is required"),
+		)
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to generate job id"),
+		)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("failed to marshal payload of job %s", jobType),
+		)
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return &Job{
+		ID:           id,
+		Type:         jobType,
+		Payload:      body,
+		EnqueuedAt:   time.Now(),
+		TraceContext: carrier,
+	}, nil
+}
+
+func decodeJob(raw string) (*Job, error) {
+	job := &Job{}
+	if err := json.Unmarshal([]byte(raw), job); err != nil {
+		return nil, cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to unmarshal job"),
+		)
+	}
+	job.raw = raw
+	return job, nil
+}
+
+func encodeJob(job *Job) (string, error) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return "", cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("failed to marshal job %s", job.ID),
+		)
+	}
+	return string(body), nil
+}
+
+// permanentError は再試行しても成功しないエラー
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent は err を再試行しないエラーにする. ハンドラがこれを返すとジョブは直ちに dead-letter に移る
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent は err が Permanent で包まれているかを返す
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
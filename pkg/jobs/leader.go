@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// LeaderElector は複数のプロセスのうち1つだけをリーダーにする
+type LeaderElector interface {
+	// TryAcquire はリーダーになるか, 既にリーダーであればその期限を延ばす. リーダーであるかを返す
+	TryAcquire(ctx context.Context) (bool, error)
+
+	// Release はリーダーを降りる
+	Release(ctx context.Context) error
+}
+
+// ロックを持っていれば期限を延ばし, 誰も持っていなければ取得する
+var acquireLockScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+  return 1
+end
+return 0
+`)
+
+// 自分が持っているロックだけを解放する
+var releaseLockScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// ValkeyLeaderElector は Valkey のキー (SET NX PX) によるロックでリーダーを選ぶ
+// リーダーのプロセスが停止した場合は ttl が過ぎると他のプロセスがリーダーになる
+type ValkeyLeaderElector struct {
+	pool  *redis.Pool
+	key   string
+	ttl   time.Duration
+	token string
+}
+
+func NewValkeyLeaderElector(pool *redis.Pool, key string, ttl time.Duration) (*ValkeyLeaderElector, error) {
+	if pool == nil || key == "" || ttl <= 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid leader elector config: key=%q, ttl=%s", key, ttl),
+		)
+	}
+	return &ValkeyLeaderElector{
+		pool:  pool,
+		key:   key,
+		ttl:   ttl,
+		token: uuid.NewString(),
+	}, nil
+}
+
+func (e *ValkeyLeaderElector) TryAcquire(ctx context.Context) (bool, error) {
+
+	conn, err := e.pool.GetContext(ctx)
+	if err != nil {
+		return false, newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	ok, err := redis.Bool(acquireLockScript.DoContext(ctx, conn, e.key, e.token, e.ttl.Milliseconds()))
+	if err != nil {
+		return false, newQueueError(err, "failed to acquire leader lock")
+	}
+	return ok, nil
+}
+
+func (e *ValkeyLeaderElector) Release(ctx context.Context) error {
+
+	conn, err := e.pool.GetContext(ctx)
+	if err != nil {
+		return newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	if _, err := releaseLockScript.DoContext(ctx, conn, e.key, e.token); err != nil {
+		return newQueueError(err, "failed to release leader lock")
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+// ジョブの処理結果 (outcome ラベル)
+const (
+	outcomeSuccess = "success" // 成功
+	outcomeRetry   = "retry"   // 失敗して再試行待ちになった
+	outcomeDead    = "dead"    // 失敗して dead-letter に移った
+)
+
+// キューの件数の取得のタイムアウト (収集を止めないため)
+const depthTimeout = 2 * time.Second
+
+// Metrics はジョブの処理時間とキューの件数を Prometheus と OTel の両方に記録する
+// キューの件数は Prometheus へは Collector として, OTel へは Observable Instrument のコールバックとして, いずれも収集時に読む
+type Metrics struct {
+	depths DepthReader
+
+	// Prometheus
+	duration   *prometheus.HistogramVec
+	queueDepth *prometheus.Desc
+
+	// OTel
+	otelDuration metric.Float64Histogram
+	registration metric.Registration
+}
+
+// NewMetrics は Metrics を生成する. namespace は Prometheus のメトリクス名の接頭辞
+func NewMetrics(namespace string, depths DepthReader) (*Metrics, error) {
+
+	if depths == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("depth reader is required"),
+		)
+	}
+
+	m := &Metrics{
+		depths: depths,
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: "jobs",
+				Name:      "duration_seconds",
+				Help:      "ジョブの処理に要した時間（秒）",
+				Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+			},
+			[]string{"job_type", "outcome"},
+		),
+		queueDepth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "queue_depth"),
+			"キューの状態 (ready/processing/delayed/dead) 毎のジョブの数",
+			[]string{"state"}, nil,
+		),
+	}
+
+	// OTel
+	meter := otel.Meter(instrumentationName)
+	var err error
+	m.otelDuration, err = meter.Float64Histogram(
+		"jobs.duration",
+		metric.WithDescription("Duration of background jobs."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, newMetricsError(err)
+	}
+	depth, err := meter.Int64ObservableGauge(
+		"jobs.queue.depth",
+		metric.WithDescription("Number of jobs in the queue by state."),
+		metric.WithUnit("{job}"),
+	)
+	if err != nil {
+		return nil, newMetricsError(err)
+	}
+	m.registration, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		d, err := m.readDepths(ctx)
+		if err != nil {
+			return err
+		}
+		for state, n := range d.byState() {
+			o.ObserveInt64(depth, n, metric.WithAttributes(attribute.String("state", state)))
+		}
+		return nil
+	}, depth)
+	if err != nil {
+		return nil, newMetricsError(err)
+	}
+
+	return m, nil
+}
+
+// Close は OTel のコールバックの登録を解除する
+func (m *Metrics) Close() error {
+	if m.registration == nil {
+		return nil
+	}
+	return m.registration.Unregister()
+}
+
+// observe は1件のジョブの処理時間を記録する
+func (m *Metrics) observe(ctx context.Context, jobType string, outcome string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.duration.WithLabelValues(jobType, outcome).Observe(elapsed.Seconds())
+	m.otelDuration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(
+		attribute.String("job.type", jobType),
+		attribute.String("outcome", outcome),
+	))
+}
+
+func (m *Metrics) readDepths(ctx context.Context) (Depths, error) {
+	ctx, cancel := context.WithTimeout(ctx, depthTimeout)
+	defer cancel()
+	return m.depths.Depths(ctx)
+}
+
+// Describe は prometheus.Collector の実装
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.duration.Describe(ch)
+	ch <- m.queueDepth
+}
+
+// Collect は prometheus.Collector の実装
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.duration.Collect(ch)
+
+	d, err := m.readDepths(context.Background())
+	if err != nil {
+		logging.FromContext(context.Background()).Warn("failed to read job queue depths", "error", err)
+		return
+	}
+	for state, n := range d.byState() {
+		ch <- prometheus.MustNewConstMetric(m.queueDepth, prometheus.GaugeValue, float64(n), state)
+	}
+}
+
+func (d Depths) byState() map[string]int64 {
+	return map[string]int64{
+		"ready":      d.Ready,
+		"processing": d.Processing,
+		"delayed":    d.Delayed,
+		"dead":       d.Dead,
+	}
+}
+
+func newMetricsError(err error) error {
+	return cerrors.ErrSystemInternal.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("failed to create job metrics instrument"),
+	)
+}
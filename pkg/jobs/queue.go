@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+// Queue は Worker がジョブを取り出し, 結果を記録するためのキュー (ValkeyQueue が満たす)
+// ジョブは取り出したワーカー (consumer) 毎の処理中リストに移り, Ack/Retry/Bury されるまで残る
+type Queue interface {
+	Enqueue(ctx context.Context, job *Job) error
+
+	// Dequeue は最大 timeout 待ってジョブを1件取り出し, consumer の処理中リストに移す. ジョブが無かった場合は nil を返す
+	Dequeue(ctx context.Context, consumer string, timeout time.Duration) (*Job, error)
+
+	// Ack は処理が完了したジョブを consumer の処理中リストから取り除く
+	Ack(ctx context.Context, consumer string, job *Job) error
+
+	// Retry はジョブを処理中リストから取り除き, at に再び取り出せるようにする
+	Retry(ctx context.Context, consumer string, job *Job, at time.Time) error
+
+	// Bury はジョブを処理中リストから dead-letter に移す
+	Bury(ctx context.Context, consumer string, job *Job) error
+
+	// Heartbeat は consumers が生きていることを記録する
+	Heartbeat(ctx context.Context, consumers ...string) error
+
+	// Unregister は終了した consumers の記録を消す
+	Unregister(ctx context.Context, consumers ...string) error
+
+	// PromoteDue は再試行の時刻 (now) になったジョブを取り出せるようにする. 移した件数を返す
+	PromoteDue(ctx context.Context, now time.Time) (int, error)
+
+	// RequeueOrphans は staleBefore 以降に Heartbeat の無い consumer の処理中のジョブをキューに戻す. 戻した件数を返す
+	// 異常終了したワーカーのジョブを回収するためのもので, ジョブは少なくとも1回 (at-least-once) 実行される
+	RequeueOrphans(ctx context.Context, staleBefore time.Time) (int, error)
+}
+
+// Depths はキューの状態毎のジョブの件数
+type Depths struct {
+	Ready      int64 // 取り出し待ち
+	Processing int64 // 処理中
+	Delayed    int64 // 再試行待ち
+	Dead       int64 // dead-letter
+}
+
+// DepthReader はキューの件数を返す (ValkeyQueue が満たす)
+type DepthReader interface {
+	Depths(ctx context.Context) (Depths, error)
+}
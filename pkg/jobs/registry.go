@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// HandlerFunc はジョブを処理する. エラーを返すと RetryPolicy に従って再試行する
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// Registry はジョブの種類とハンドラの対応
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: map[string]HandlerFunc{},
+	}
+}
+
+// Handle は jobType のハンドラを登録する. 同じ jobType を2回登録した場合はエラー
+func (r *Registry) Handle(jobType string, handler HandlerFunc) error {
+	if jobType == "" || handler == nil {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessage("job type and handler are required"),
+		)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.handlers[jobType]; ok {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessagef("handler for job %s is already registered", jobType),
+		)
+	}
+	r.handlers[jobType] = handler
+	return nil
+}
+
+// Register は payload を T として受け取るハンドラを登録する
+// payload を T に変換できないジョブは再試行せずに dead-letter に移す
+func Register[T any](r *Registry, jobType string, handler func(ctx context.Context, payload T) error) error {
+	if handler == nil {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessage("job handler is required"),
+		)
+	}
+	return r.Handle(jobType, func(ctx context.Context, job *Job) error {
+		var payload T
+		if len(job.Payload) > 0 {
+			if err := json.Unmarshal(job.Payload, &payload); err != nil {
+				return Permanent(cerrors.ErrInvalidFormat.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessagef("invalid payload of job %s", job.Type),
+				))
+			}
+		}
+		return handler(ctx, payload)
+	})
+}
+
+// Lookup は jobType のハンドラを返す
+func (r *Registry) Lookup(jobType string) (HandlerFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[jobType]
+	return handler, ok
+}
+
+// Types は登録されている jobType を返す
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
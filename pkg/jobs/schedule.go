@@ -0,0 +1,182 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// Schedule はジョブを定期的に登録する時刻
+type Schedule interface {
+	// Next は t より後の最初の時刻を返す
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule は cron 形式の spec を解析する
+//
+// 対応する形式:
+//
+//	分 時 日 月 曜日 (5フィールド. *, a-b, */n, a-b/n, カンマ区切りのリスト. 曜日は 0-7 で 0 と 7 が日曜日)
+//	@yearly (@annually), @monthly, @weekly, @daily (@midnight), @hourly
+//	@every <duration> (例: @every 10m. 1秒以上)
+func ParseSchedule(spec string) (Schedule, error) {
+
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, newScheduleError(spec, "invalid duration")
+		}
+		return everySchedule(d), nil
+	}
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, newScheduleError(spec, "expected 5 fields")
+	}
+
+	s := &cronSchedule{}
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, newScheduleError(spec, "minute: "+err.Error())
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, newScheduleError(spec, "hour: "+err.Error())
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, newScheduleError(spec, "day of month: "+err.Error())
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, newScheduleError(spec, "month: "+err.Error())
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, newScheduleError(spec, "day of week: "+err.Error())
+	}
+	// 7 は日曜日 (0) として扱う
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domRestricted = fields[2] != "*"
+	s.dowRestricted = fields[4] != "*"
+	return s, nil
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule の各フィールドは, 該当する値のビットを立てたもの
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// 日と曜日の両方が指定された場合は, どちらかに該当すればよい (cron の仕様)
+	domRestricted, dowRestricted bool
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// 該当する日時が無い spec (2月30日等) で止まらないように上限を設ける
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// parseField は1つのフィールドを解析し, 該当する値のビットを立てて返す
+func parseField(field string, min, max int) (uint64, error) {
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = min, max
+		case strings.Contains(rangePart, "-"):
+			loPart, hiPart, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(loPart)
+			hi, err2 = strconv.Atoi(hiPart)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			lo, hi = n, n
+			// 5/15 は 5 から最大値まで15毎
+			if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func newScheduleError(spec string, reason string) error {
+	return cerrors.ErrValidation.New(
+		cerrors.WithMessagef("invalid schedule %q: %s", spec, reason),
+	)
+}
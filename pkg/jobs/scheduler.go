@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+// Enqueuer はジョブを登録する (ValkeyQueue が満たす)
+type Enqueuer interface {
+	Enqueue(ctx context.Context, job *Job) error
+}
+
+// ScheduleEntry は定期的に登録するジョブ
+type ScheduleEntry struct {
+	Name     string
+	Schedule Schedule
+	JobType  string
+	Payload  any
+}
+
+type SchedulerConfig struct {
+	// リーダーとスケジュールを確認する間隔. リーダーのロックの ttl より十分短くする
+	TickInterval time.Duration
+
+	// cron の時刻を解釈するタイムゾーン. nil の場合は UTC
+	Location *time.Location
+}
+
+// Scheduler は ScheduleEntry に従ってジョブを登録する
+// 複数のプロセスで動かしてもリーダーのプロセスだけが登録する. リーダーが替わる前後の時刻のジョブは登録されないことがある
+type Scheduler struct {
+	queue   Enqueuer
+	elector LeaderElector
+	entries []ScheduleEntry
+	config  SchedulerConfig
+
+	leader bool
+	next   map[string]time.Time
+}
+
+func NewScheduler(queue Enqueuer, elector LeaderElector, entries []ScheduleEntry, config SchedulerConfig) (*Scheduler, error) {
+	if queue == nil || elector == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("job queue and leader elector are required"),
+		)
+	}
+	if config.TickInterval <= 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid scheduler config: tick_interval=%s", config.TickInterval),
+		)
+	}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Name == "" || entry.Schedule == nil || entry.JobType == "" {
+			return nil, cerrors.ErrValidation.New(
+				cerrors.WithMessagef("invalid schedule entry: name=%q, job_type=%q", entry.Name, entry.JobType),
+			)
+		}
+		if names[entry.Name] {
+			return nil, cerrors.ErrValidation.New(
+				cerrors.WithMessagef("duplicate schedule entry: %s", entry.Name),
+			)
+		}
+		names[entry.Name] = true
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	return &Scheduler{
+		queue:   queue,
+		elector: elector,
+		entries: entries,
+		config:  config,
+		next:    map[string]time.Time{},
+	}, nil
+}
+
+// Run は ctx がキャンセルされるまでスケジュールに従ってジョブを登録し続ける. 終了時にリーダーを降りる
+func (s *Scheduler) Run(ctx context.Context) error {
+
+	logger := logging.FromContext(ctx).With("component", "job_scheduler")
+	logger.Info("job scheduler started", "entries", len(s.entries))
+
+	ticker := time.NewTicker(s.config.TickInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RunOnce(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			logger.Error("failed to run job scheduler", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if s.leader {
+				releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+				if err := s.elector.Release(releaseCtx); err != nil {
+					logger.Warn("failed to release leadership", "error", err)
+				}
+				cancel()
+			}
+			logger.Info("job scheduler stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce はリーダーであれば now までに時刻になったジョブを登録する. 登録した件数を返す
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) (int, error) {
+
+	logger := logging.FromContext(ctx).With("component", "job_scheduler")
+	now = now.In(s.config.Location)
+
+	leader, err := s.elector.TryAcquire(ctx)
+	if err != nil {
+		// ロックの期限を延ばせたか分からないため, リーダーではないものとして扱う
+		leader = false
+	}
+	if !leader {
+		if s.leader {
+			logger.Warn("lost leadership")
+		}
+		s.leader = false
+		clear(s.next)
+		return 0, err
+	}
+	if !s.leader {
+		logger.Info("became leader")
+		s.leader = true
+		for _, entry := range s.entries {
+			s.next[entry.Name] = entry.Schedule.Next(now)
+		}
+	}
+
+	enqueued := 0
+	for _, entry := range s.entries {
+		next := s.next[entry.Name]
+		if next.IsZero() || now.Before(next) {
+			continue
+		}
+
+		job, err := NewJob(ctx, entry.JobType, entry.Payload)
+		if err != nil {
+			return enqueued, err
+		}
+		if err := s.queue.Enqueue(ctx, job); err != nil {
+			// 次の Tick で再び登録を試みる
+			return enqueued, err
+		}
+		logger.Info("scheduled job enqueued", "schedule", entry.Name, "job_id", job.ID, "job_type", job.Type, "scheduled_at", next)
+		s.next[entry.Name] = entry.Schedule.Next(now)
+		enqueued++
+	}
+	return enqueued, nil
+}
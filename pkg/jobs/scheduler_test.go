@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeElector struct {
+	leader bool
+}
+
+func (e *fakeElector) TryAcquire(context.Context) (bool, error) {
+	return e.leader, nil
+}
+
+func (e *fakeElector) Release(context.Context) error {
+	e.leader = false
+	return nil
+}
+
+func TestScheduler_RunOnce(t *testing.T) {
+	schedule, err := ParseSchedule("*/10 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := newFakeQueue()
+	elector := &fakeElector{}
+	scheduler, err := NewScheduler(queue, elector, []ScheduleEntry{
+		{Name: "test", Schedule: schedule, JobType: "test.job", Payload: testPayload{Value: "x"}},
+	}, SchedulerConfig{TickInterval: time.Second})
+	if err != nil {
+		t.Fatalf("NewScheduler() error = %v", err)
+	}
+
+	ctx := context.Background()
+	base := time.Date(2025, 1, 15, 10, 5, 0, 0, time.UTC)
+
+	// リーダーでなければ登録しない
+	if n, _ := scheduler.RunOnce(ctx, base.Add(10*time.Minute)); n != 0 {
+		t.Fatalf("RunOnce() as follower = %d, want 0", n)
+	}
+
+	// リーダーになった時点から次の時刻 (10:10) を数える
+	elector.leader = true
+	steps := []struct {
+		now  time.Time
+		want int
+	}{
+		{base, 0},
+		{base.Add(4 * time.Minute), 0},
+		{base.Add(5 * time.Minute), 1},
+		{base.Add(6 * time.Minute), 0},
+		{base.Add(15 * time.Minute), 1},
+	}
+	for _, step := range steps {
+		n, err := scheduler.RunOnce(ctx, step.now)
+		if err != nil {
+			t.Fatalf("RunOnce(%s) error = %v", step.now, err)
+		}
+		if n != step.want {
+			t.Errorf("RunOnce(%s) = %d, want %d", step.now, n, step.want)
+		}
+	}
+	if len(queue.ready) != 2 || queue.ready[0].Type != "test.job" {
+		t.Errorf("enqueued = %d jobs, want 2 test.job", len(queue.ready))
+	}
+
+	// リーダーでなくなったら登録しない
+	elector.leader = false
+	if n, _ := scheduler.RunOnce(ctx, base.Add(30*time.Minute)); n != 0 {
+		t.Errorf("RunOnce() after losing leadership = %d, want 0", n)
+	}
+}
+
+func TestNewScheduler_Invalid(t *testing.T) {
+	schedule, err := ParseSchedule("@hourly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := ScheduleEntry{Name: "a", Schedule: schedule, JobType: "test.job"}
+
+	if _, err := NewScheduler(newFakeQueue(), &fakeElector{}, []ScheduleEntry{entry, entry}, SchedulerConfig{TickInterval: time.Second}); err == nil {
+		t.Error("NewScheduler() with duplicate entries error = nil, want error")
+	}
+	if _, err := NewScheduler(newFakeQueue(), &fakeElector{}, nil, SchedulerConfig{}); err == nil {
+		t.Error("NewScheduler() with zero tick interval error = nil, want error")
+	}
+}
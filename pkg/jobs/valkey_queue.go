@@ -0,0 +1,341 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// BRPOPLPUSH の待ち時間に加える読み取りタイムアウトの余裕
+const blockingReadMargin = 5 * time.Second
+
+// 1回の PromoteDue で移す最大件数
+const promoteBatchSize = 100
+
+// 再試行の時刻になったジョブを再試行待ち (ZSET) からキューに移す
+var promoteScript = redis.NewScript(2, `
+local jobs = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, job in ipairs(jobs) do
+  redis.call('ZREM', KEYS[1], job)
+  redis.call('LPUSH', KEYS[2], job)
+end
+return #jobs
+`)
+
+// ValkeyQueue は Valkey のリストによる信頼性のあるキュー (reliable queue)
+// ジョブは BRPOPLPUSH でキューから consumer 毎の処理中リストに移して取り出すため, ワーカーが異常終了しても失われない
+//
+// キー (prefix が goapp:jobs の場合):
+//
+//	goapp:jobs:ready                 取り出し待ちのジョブ (LIST)
+//	goapp:jobs:processing:<consumer> consumer が処理中のジョブ (LIST)
+//	goapp:jobs:delayed               再試行待ちのジョブ. score は再試行の時刻 (ZSET)
+//	goapp:jobs:dead                  dead-letter (LIST)
+//	goapp:jobs:consumers             consumer 毎の最後の Heartbeat の時刻 (ZSET)
+type ValkeyQueue struct {
+	pool       *redis.Pool
+	prefix     string
+	deadMaxLen int64
+}
+
+// NewValkeyQueue は ValkeyQueue を生成する
+// deadMaxLen が 0 より大きい場合は dead-letter を新しいものからその件数に保つ
+func NewValkeyQueue(pool *redis.Pool, prefix string, deadMaxLen int64) (*ValkeyQueue, error) {
+	if pool == nil || prefix == "" {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("valkey pool and key prefix are required"),
+		)
+	}
+	return &ValkeyQueue{
+		pool:       pool,
+		prefix:     prefix,
+		deadMaxLen: deadMaxLen,
+	}, nil
+}
+
+func (q *ValkeyQueue) readyKey() string {
+	return q.prefix + ":ready"
+}
+
+func (q *ValkeyQueue) processingKey(consumer string) string {
+	return q.prefix + ":processing:" + consumer
+}
+
+func (q *ValkeyQueue) delayedKey() string {
+	return q.prefix + ":delayed"
+}
+
+func (q *ValkeyQueue) deadKey() string {
+	return q.prefix + ":dead"
+}
+
+func (q *ValkeyQueue) consumersKey() string {
+	return q.prefix + ":consumers"
+}
+
+func (q *ValkeyQueue) Enqueue(ctx context.Context, job *Job) error {
+
+	raw, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "LPUSH", q.readyKey(), raw); err != nil {
+		return newQueueError(err, "failed to enqueue job")
+	}
+	return nil
+}
+
+func (q *ValkeyQueue) Dequeue(ctx context.Context, consumer string, timeout time.Duration) (*Job, error) {
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return nil, newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	// BRPOPLPUSH のタイムアウトは秒単位 (0 は無期限なので最低1秒)
+	seconds := int(timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	raw, err := redis.String(redis.DoWithTimeout(conn, time.Duration(seconds)*time.Second+blockingReadMargin,
+		"BRPOPLPUSH", q.readyKey(), q.processingKey(consumer), seconds))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, newQueueError(err, "failed to dequeue job")
+	}
+
+	job, err := decodeJob(raw)
+	if err != nil {
+		// 読めないジョブは処理中リストに残さず dead-letter に移す
+		if _, buryErr := q.exec(ctx, conn, func(conn redis.Conn) {
+			q.sendBury(conn, consumer, raw, raw)
+		}); buryErr != nil {
+			return nil, buryErr
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *ValkeyQueue) Ack(ctx context.Context, consumer string, job *Job) error {
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "LREM", q.processingKey(consumer), 1, job.raw); err != nil {
+		return newQueueError(err, "failed to ack job")
+	}
+	return nil
+}
+
+func (q *ValkeyQueue) Retry(ctx context.Context, consumer string, job *Job, at time.Time) error {
+
+	raw, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	_, err = q.exec(ctx, conn, func(conn redis.Conn) {
+		_ = conn.Send("LREM", q.processingKey(consumer), 1, job.raw)
+		_ = conn.Send("ZADD", q.delayedKey(), at.UnixMilli(), raw)
+	})
+	return err
+}
+
+func (q *ValkeyQueue) Bury(ctx context.Context, consumer string, job *Job) error {
+
+	raw, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	_, err = q.exec(ctx, conn, func(conn redis.Conn) {
+		q.sendBury(conn, consumer, job.raw, raw)
+	})
+	return err
+}
+
+func (q *ValkeyQueue) sendBury(conn redis.Conn, consumer string, processingRaw string, deadRaw string) {
+	_ = conn.Send("LREM", q.processingKey(consumer), 1, processingRaw)
+	_ = conn.Send("LPUSH", q.deadKey(), deadRaw)
+	if q.deadMaxLen > 0 {
+		_ = conn.Send("LTRIM", q.deadKey(), 0, q.deadMaxLen-1)
+	}
+}
+
+func (q *ValkeyQueue) Heartbeat(ctx context.Context, consumers ...string) error {
+
+	if len(consumers) == 0 {
+		return nil
+	}
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	now := time.Now().UnixMilli()
+	args := redis.Args{q.consumersKey()}
+	for _, consumer := range consumers {
+		args = args.Add(now, consumer)
+	}
+	if _, err := redis.DoContext(conn, ctx, "ZADD", args...); err != nil {
+		return newQueueError(err, "failed to record heartbeat")
+	}
+	return nil
+}
+
+func (q *ValkeyQueue) Unregister(ctx context.Context, consumers ...string) error {
+
+	if len(consumers) == 0 {
+		return nil
+	}
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "ZREM", redis.Args{q.consumersKey()}.AddFlat(consumers)...); err != nil {
+		return newQueueError(err, "failed to unregister consumers")
+	}
+	return nil
+}
+
+func (q *ValkeyQueue) PromoteDue(ctx context.Context, now time.Time) (int, error) {
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return 0, newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	n, err := redis.Int(promoteScript.DoContext(ctx, conn, q.delayedKey(), q.readyKey(), now.UnixMilli(), promoteBatchSize))
+	if err != nil {
+		return 0, newQueueError(err, "failed to promote delayed jobs")
+	}
+	return n, nil
+}
+
+func (q *ValkeyQueue) RequeueOrphans(ctx context.Context, staleBefore time.Time) (int, error) {
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return 0, newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	consumers, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGEBYSCORE", q.consumersKey(), "-inf", staleBefore.UnixMilli()))
+	if err != nil {
+		return 0, newQueueError(err, "failed to list stale consumers")
+	}
+
+	requeued := 0
+	for _, consumer := range consumers {
+		for {
+			_, err := redis.String(redis.DoContext(conn, ctx, "RPOPLPUSH", q.processingKey(consumer), q.readyKey()))
+			if err == redis.ErrNil {
+				break
+			}
+			if err != nil {
+				return requeued, newQueueError(err, "failed to requeue orphaned job")
+			}
+			requeued++
+		}
+		if _, err := redis.DoContext(conn, ctx, "ZREM", q.consumersKey(), consumer); err != nil {
+			return requeued, newQueueError(err, "failed to remove stale consumer")
+		}
+	}
+	return requeued, nil
+}
+
+func (q *ValkeyQueue) Depths(ctx context.Context) (Depths, error) {
+
+	conn, err := q.pool.GetContext(ctx)
+	if err != nil {
+		return Depths{}, newQueueError(err, "failed to get valkey connection")
+	}
+	defer conn.Close()
+
+	consumers, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGE", q.consumersKey(), 0, -1))
+	if err != nil {
+		return Depths{}, newQueueError(err, "failed to list consumers")
+	}
+
+	_ = conn.Send("LLEN", q.readyKey())
+	_ = conn.Send("ZCARD", q.delayedKey())
+	_ = conn.Send("LLEN", q.deadKey())
+	for _, consumer := range consumers {
+		_ = conn.Send("LLEN", q.processingKey(consumer))
+	}
+	if err := conn.Flush(); err != nil {
+		return Depths{}, newQueueError(err, "failed to count jobs")
+	}
+
+	counts := make([]int64, 0, 3+len(consumers))
+	for range 3 + len(consumers) {
+		n, err := redis.Int64(conn.Receive())
+		if err != nil {
+			return Depths{}, newQueueError(err, "failed to count jobs")
+		}
+		counts = append(counts, n)
+	}
+
+	depths := Depths{
+		Ready:   counts[0],
+		Delayed: counts[1],
+		Dead:    counts[2],
+	}
+	for _, n := range counts[3:] {
+		depths.Processing += n
+	}
+	return depths, nil
+}
+
+// exec は send で送ったコマンドを MULTI/EXEC で1つのトランザクションとして実行する
+func (q *ValkeyQueue) exec(ctx context.Context, conn redis.Conn, send func(conn redis.Conn)) (any, error) {
+	_ = conn.Send("MULTI")
+	send(conn)
+	reply, err := redis.DoContext(conn, ctx, "EXEC")
+	if err != nil {
+		return nil, newQueueError(err, "failed to execute queue transaction")
+	}
+	return reply, nil
+}
+
+func newQueueError(err error, msg string) error {
+	return cerrors.ErrDBOperation.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage(msg),
+	)
+}
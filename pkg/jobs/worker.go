@@ -0,0 +1,283 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// last_error に保存するエラーメッセージの最大長
+const maxErrorLength = 1000
+
+// Heartbeat がこの回数分途絶えた consumer は異常終了したものとみなす
+const staleHeartbeats = 3
+
+type WorkerConfig struct {
+	// consumer 名の接頭辞. プロセス毎に一意な値を付け足して使う
+	Name string
+
+	// 同時に処理するジョブの数
+	Concurrency int
+
+	// キューが空のときに1回の取り出しで待つ時間
+	PollTimeout time.Duration
+
+	// 1件のジョブの処理のタイムアウト. 終了時は処理中のジョブの完了をこの時間まで待つ
+	JobTimeout time.Duration
+
+	RetryPolicy models.RetryPolicy
+
+	// Heartbeat と再試行待ちのジョブの確認の間隔
+	HeartbeatInterval time.Duration
+}
+
+type workerOptions struct {
+	metrics *Metrics
+}
+
+type WorkerOption func(*workerOptions)
+
+// WithMetrics はジョブの処理時間を metrics に記録する
+func WithMetrics(metrics *Metrics) WorkerOption {
+	return func(o *workerOptions) {
+		o.metrics = metrics
+	}
+}
+
+// Worker はキューからジョブを取り出し, Registry のハンドラで処理する
+// 失敗したジョブは RetryPolicy に従って再試行し, 上限に達したもの (または Permanent なエラー) は dead-letter に移す
+type Worker struct {
+	queue    Queue
+	registry *Registry
+	config   WorkerConfig
+	metrics  *Metrics
+	tracer   trace.Tracer
+
+	consumers []string
+}
+
+func NewWorker(queue Queue, registry *Registry, config WorkerConfig, options ...WorkerOption) (*Worker, error) {
+	if queue == nil || registry == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("job queue and registry are required"),
+		)
+	}
+	if config.Name == "" || config.Concurrency <= 0 || config.PollTimeout <= 0 || config.JobTimeout <= 0 || config.HeartbeatInterval <= 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid worker config: name=%q, concurrency=%d, poll_timeout=%s, job_timeout=%s, heartbeat_interval=%s",
+				config.Name, config.Concurrency, config.PollTimeout, config.JobTimeout, config.HeartbeatInterval),
+		)
+	}
+
+	opts := &workerOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	instance := uuid.NewString()[:8]
+	consumers := make([]string, 0, config.Concurrency)
+	for i := range config.Concurrency {
+		consumers = append(consumers, fmt.Sprintf("%s-%s-%d", config.Name, instance, i))
+	}
+
+	return &Worker{
+		queue:     queue,
+		registry:  registry,
+		config:    config,
+		metrics:   opts.metrics,
+		tracer:    otel.Tracer(instrumentationName),
+		consumers: consumers,
+	}, nil
+}
+
+// Run は ctx がキャンセルされるまでジョブを処理し続ける. キャンセル後は処理中のジョブの完了を待って返る
+func (w *Worker) Run(ctx context.Context) error {
+
+	logger := logging.FromContext(ctx).With("component", "job_worker")
+	logger.Info("job worker started", "concurrency", w.config.Concurrency, "job_types", w.registry.Types())
+
+	if err := w.queue.Heartbeat(ctx, w.consumers...); err != nil {
+		return err
+	}
+
+	// Heartbeat は処理中のジョブが終わるまで続ける (他のワーカーに回収されないように)
+	maintenanceCtx, stopMaintenance := context.WithCancel(context.WithoutCancel(ctx))
+	maintenanceDone := make(chan struct{})
+	go func() {
+		defer close(maintenanceDone)
+		w.maintain(maintenanceCtx)
+	}()
+
+	var wg sync.WaitGroup
+	for _, consumer := range w.consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx, consumer)
+		}()
+	}
+	wg.Wait()
+
+	stopMaintenance()
+	<-maintenanceDone
+
+	unregisterCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := w.queue.Unregister(unregisterCtx, w.consumers...); err != nil {
+		logger.Warn("failed to unregister consumers", "error", err)
+	}
+	logger.Info("job worker stopped")
+	return nil
+}
+
+// maintain は定期的に Heartbeat を記録し, 再試行の時刻になったジョブと異常終了したワーカーのジョブをキューに戻す
+func (w *Worker) maintain(ctx context.Context) {
+
+	logger := logging.FromContext(ctx).With("component", "job_worker")
+
+	ticker := time.NewTicker(w.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := w.queue.Heartbeat(ctx, w.consumers...); err != nil && ctx.Err() == nil {
+			logger.Error("failed to record heartbeat", "error", err)
+		}
+		if _, err := w.queue.PromoteDue(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			logger.Error("failed to promote delayed jobs", "error", err)
+		}
+		n, err := w.queue.RequeueOrphans(ctx, time.Now().Add(-staleHeartbeats*w.config.HeartbeatInterval))
+		if err != nil && ctx.Err() == nil {
+			logger.Error("failed to requeue orphaned jobs", "error", err)
+		}
+		if n > 0 {
+			logger.Warn("requeued jobs of stale workers", "jobs", n)
+		}
+	}
+}
+
+func (w *Worker) consume(ctx context.Context, consumer string) {
+
+	logger := logging.FromContext(ctx).With("component", "job_worker", "consumer", consumer)
+
+	for ctx.Err() == nil {
+		job, err := w.queue.Dequeue(ctx, consumer, w.config.PollTimeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("failed to dequeue job", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.config.PollTimeout):
+			}
+			continue
+		}
+		if job == nil {
+			continue
+		}
+		w.process(ctx, consumer, job)
+	}
+}
+
+// process は1件のジョブを処理し, 結果をキューに記録する
+// ctx がキャンセルされても処理中のジョブは JobTimeout まで続ける
+func (w *Worker) process(ctx context.Context, consumer string, job *Job) {
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.config.JobTimeout)
+	defer cancel()
+
+	// ジョブを登録したリクエストの trace に繋げる
+	if len(job.TraceContext) > 0 {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(job.TraceContext))
+	}
+	ctx, span := w.tracer.Start(ctx, "process "+job.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "valkey"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.message.id", job.ID.String()),
+			attribute.String("job.type", job.Type),
+			attribute.Int("job.attempt", job.Attempts+1),
+		),
+	)
+	defer span.End()
+
+	logger := logging.FromContext(ctx).With("job_id", job.ID, "job_type", job.Type, "attempt", job.Attempts+1)
+	ctx = logging.NewContext(ctx, logger)
+
+	start := time.Now()
+	err := w.handle(ctx, job)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		w.metrics.observe(ctx, job.Type, outcomeSuccess, elapsed)
+		if err := w.queue.Ack(ctx, consumer, job); err != nil {
+			logger.Error("failed to ack job", "error", err)
+		}
+		logger.Debug("job succeeded", "duration", elapsed)
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	job.Attempts++
+	job.LastError = err.Error()
+	if len(job.LastError) > maxErrorLength {
+		job.LastError = job.LastError[:maxErrorLength]
+	}
+
+	backoff, dead := w.config.RetryPolicy.Next(job.Attempts)
+	if dead || IsPermanent(err) {
+		w.metrics.observe(ctx, job.Type, outcomeDead, elapsed)
+		logger.Error("job moved to dead letter", "duration", elapsed, "error", err)
+		if err := w.queue.Bury(ctx, consumer, job); err != nil {
+			logger.Error("failed to move job to dead letter", "error", err)
+		}
+		return
+	}
+
+	w.metrics.observe(ctx, job.Type, outcomeRetry, elapsed)
+	logger.Warn("job failed", "duration", elapsed, "retry_in", backoff, "error", err)
+	if err := w.queue.Retry(ctx, consumer, job, time.Now().Add(backoff)); err != nil {
+		logger.Error("failed to schedule job retry", "error", err)
+	}
+}
+
+// handle はジョブのハンドラを呼ぶ. ハンドラの panic はエラーとして扱う
+func (w *Worker) handle(ctx context.Context, job *Job) (err error) {
+
+	handler, ok := w.registry.Lookup(job.Type)
+	if !ok {
+		return Permanent(cerrors.ErrInvalidState.New(
+			cerrors.WithMessagef("no handler registered for job %s", job.Type),
+		))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = cerrors.ErrSystemInternal.New(
+				cerrors.WithMessagef("job handler panicked: %v", r),
+			)
+		}
+	}()
+	return handler(ctx, job)
+}
@@ -0,0 +1,255 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// fakeQueue はメモリ上のキュー. 取り出したジョブを consumer 毎に保持し, 結果を記録する
+type fakeQueue struct {
+	mu         sync.Mutex
+	ready      []*Job
+	processing map[string][]*Job
+	retried    []*Job
+	retryAt    []time.Time
+	dead       []*Job
+	acked      []*Job
+}
+
+func newFakeQueue(jobs ...*Job) *fakeQueue {
+	return &fakeQueue{
+		ready:      jobs,
+		processing: map[string][]*Job{},
+	}
+}
+
+func (q *fakeQueue) Enqueue(_ context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ready = append(q.ready, job)
+	return nil
+}
+
+func (q *fakeQueue) Dequeue(ctx context.Context, consumer string, timeout time.Duration) (*Job, error) {
+	q.mu.Lock()
+	if len(q.ready) > 0 {
+		job := q.ready[0]
+		q.ready = q.ready[1:]
+		q.processing[consumer] = append(q.processing[consumer], job)
+		q.mu.Unlock()
+		return job, nil
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(timeout):
+		return nil, nil
+	}
+}
+
+func (q *fakeQueue) remove(consumer string, job *Job) {
+	jobs := q.processing[consumer]
+	for i, j := range jobs {
+		if j == job {
+			q.processing[consumer] = append(jobs[:i], jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (q *fakeQueue) Ack(_ context.Context, consumer string, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(consumer, job)
+	q.acked = append(q.acked, job)
+	return nil
+}
+
+func (q *fakeQueue) Retry(_ context.Context, consumer string, job *Job, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(consumer, job)
+	q.retried = append(q.retried, job)
+	q.retryAt = append(q.retryAt, at)
+	return nil
+}
+
+func (q *fakeQueue) Bury(_ context.Context, consumer string, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(consumer, job)
+	q.dead = append(q.dead, job)
+	return nil
+}
+
+func (q *fakeQueue) Heartbeat(context.Context, ...string) error  { return nil }
+func (q *fakeQueue) Unregister(context.Context, ...string) error { return nil }
+
+func (q *fakeQueue) PromoteDue(context.Context, time.Time) (int, error) { return 0, nil }
+
+func (q *fakeQueue) RequeueOrphans(context.Context, time.Time) (int, error) { return 0, nil }
+
+type testPayload struct {
+	Value string `json:"value"`
+}
+
+func newTestWorker(t *testing.T, queue Queue, registry *Registry) *Worker {
+	t.Helper()
+	w, err := NewWorker(queue, registry, WorkerConfig{
+		Name:              "test",
+		Concurrency:       1,
+		PollTimeout:       10 * time.Millisecond,
+		JobTimeout:        time.Second,
+		HeartbeatInterval: time.Second,
+		RetryPolicy:       models.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("NewWorker() error = %v", err)
+	}
+	return w
+}
+
+func newTestJob(t *testing.T, jobType string, payload any) *Job {
+	t.Helper()
+	job, err := NewJob(context.Background(), jobType, payload)
+	if err != nil {
+		t.Fatalf("NewJob() error = %v", err)
+	}
+	return job
+}
+
+func TestWorker_Process(t *testing.T) {
+	errTemporary := errors.New("temporary failure")
+
+	tests := []struct {
+		name        string
+		jobType     string
+		payload     any
+		attempts    int // これまでに失敗した回数
+		handlerErr  error
+		panics      bool
+		wantAcked   bool
+		wantRetried bool
+		wantDead    bool
+	}{
+		{name: "success", jobType: "test.job", payload: testPayload{Value: "ok"}, wantAcked: true},
+		{name: "retry", jobType: "test.job", payload: testPayload{}, handlerErr: errTemporary, wantRetried: true},
+		{name: "max attempts", jobType: "test.job", payload: testPayload{}, attempts: 2, handlerErr: errTemporary, wantDead: true},
+		{name: "permanent", jobType: "test.job", payload: testPayload{}, handlerErr: Permanent(errTemporary), wantDead: true},
+		{name: "panic", jobType: "test.job", payload: testPayload{}, panics: true, wantRetried: true},
+		{name: "invalid payload", jobType: "test.job", payload: "not an object", wantDead: true},
+		{name: "unknown job type", jobType: "test.unknown", payload: testPayload{}, wantDead: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testPayload
+			registry := NewRegistry()
+			err := Register(registry, "test.job", func(_ context.Context, payload testPayload) error {
+				if tt.panics {
+					panic("boom")
+				}
+				got = payload
+				return tt.handlerErr
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			job := newTestJob(t, tt.jobType, tt.payload)
+			job.Attempts = tt.attempts
+			queue := newFakeQueue()
+			queue.processing["c"] = []*Job{job}
+
+			newTestWorker(t, queue, registry).process(context.Background(), "c", job)
+
+			if len(queue.processing["c"]) != 0 {
+				t.Errorf("job is still processing")
+			}
+			if (len(queue.acked) == 1) != tt.wantAcked || (len(queue.retried) == 1) != tt.wantRetried || (len(queue.dead) == 1) != tt.wantDead {
+				t.Fatalf("acked=%d, retried=%d, dead=%d, want acked=%v, retried=%v, dead=%v",
+					len(queue.acked), len(queue.retried), len(queue.dead), tt.wantAcked, tt.wantRetried, tt.wantDead)
+			}
+			if tt.wantAcked {
+				if want := tt.payload.(testPayload); got != want {
+					t.Errorf("payload = %+v, want %+v", got, want)
+				}
+				return
+			}
+			if job.Attempts != tt.attempts+1 || job.LastError == "" {
+				t.Errorf("Attempts = %d, LastError = %q, want %d and an error", job.Attempts, job.LastError, tt.attempts+1)
+			}
+			if tt.wantRetried {
+				// 1回目の失敗の後は InitialBackoff 待つ
+				if d := time.Until(queue.retryAt[0]); d < 59*time.Second || d > time.Minute {
+					t.Errorf("retry in %s, want about 1m", d)
+				}
+			}
+		})
+	}
+}
+
+func TestWorker_Run(t *testing.T) {
+	var mu sync.Mutex
+	var values []string
+	registry := NewRegistry()
+	err := Register(registry, "test.job", func(_ context.Context, payload testPayload) error {
+		mu.Lock()
+		defer mu.Unlock()
+		values = append(values, payload.Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := newFakeQueue(
+		newTestJob(t, "test.job", testPayload{Value: "a"}),
+		newTestJob(t, "test.job", testPayload{Value: "b"}),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- newTestWorker(t, queue, registry).Run(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		queue.mu.Lock()
+		n := len(queue.acked)
+		queue.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("acked %d jobs, want 2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("processed = %v, want [a b]", values)
+	}
+}
+
+func TestRegistry_Handle_Duplicate(t *testing.T) {
+	registry := NewRegistry()
+	handler := func(context.Context, *Job) error { return nil }
+	if err := registry.Handle("test.job", handler); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Handle("test.job", handler); err == nil {
+		t.Error("Handle() error = nil, want error for duplicate job type")
+	}
+}
@@ -0,0 +1,49 @@
+// pkg/logging/context.go
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// NewContext は ctx に request-scoped な logger を紐付けた context を返す
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext は ctx に紐付けられた logger を返す
+// 紐付けられていない場合は slog.Default() を返すため、常に non-nil
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// With は ctx に紐付けられた logger に属性を追加し、それを紐付け直した context を返す
+// 認証ミドルウェアなど、後段で判明した情報をリクエストのログに載せたい場合に使う
+func With(ctx context.Context, args ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(args...))
+}
+
+type requestIDKey struct{}
+
+// NewContextWithRequestID は ctx にリクエストIDを紐付けた context を返す
+func NewContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext は ctx に紐付けられたリクエストIDを返す
+// 紐付けられていない場合は空文字を返す
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx != nil {
+		if requestID, ok := ctx.Value(requestIDKey{}).(string); ok {
+			return requestID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+// pkg/logging/context_test.go
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestFromContext_Default(t *testing.T) {
+	if got := FromContext(context.Background()); got != slog.Default() {
+		t.Errorf("FromContext(empty) = %p; want slog.Default() %p", got, slog.Default())
+	}
+}
+
+func TestFromContext_With(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	ctx := NewContext(context.Background(), logger.With("request_id", "abc"))
+	ctx = With(ctx, "user_subject", "user-1")
+	FromContext(ctx).Info("hello")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("json unmarshal error: %v\nraw: %s", err, buf.String())
+	}
+	if got := rec["request_id"]; got != "abc" {
+		t.Errorf("request_id = %v; want %q", got, "abc")
+	}
+	if got := rec["user_subject"]; got != "user-1" {
+		t.Errorf("user_subject = %v; want %q", got, "user-1")
+	}
+}
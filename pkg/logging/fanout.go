@@ -0,0 +1,104 @@
+// pkg/logging/fanout.go
+package logging
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Sink は FanoutHandler の出力先 1 つ分の設定
+type Sink struct {
+	// 出力先の slog.Handler
+	Handler slog.Handler
+
+	// この出力先に流す最低レベル. nil の場合は Handler 側の判定に任せる
+	Level slog.Leveler
+
+	// WARN 未満のレコードを出力する割合 (0.0〜1.0). 1 以上で全件、0 以下で WARN 未満を全て捨てる
+	// WARN 以上のレコードはサンプリングしない
+	SamplingRatio float64
+}
+
+func (s Sink) enabled(ctx context.Context, level slog.Level) bool {
+	if s.Level != nil && level < s.Level.Level() {
+		return false
+	}
+	return s.Handler.Enabled(ctx, level)
+}
+
+func (s Sink) sampled(ctx context.Context, level slog.Level) bool {
+	if level >= slog.LevelWarn || s.SamplingRatio >= 1 {
+		return true
+	}
+	if s.SamplingRatio <= 0 {
+		return false
+	}
+
+	// 同一トレースのログはまとめて残す/捨てるよう、trace_id があればそれを元に判定する
+	// (sdk/trace の TraceIDRatioBased と同じ考え方)
+	if spanCtx := oteltrace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		traceID := spanCtx.TraceID()
+		x := binary.BigEndian.Uint64(traceID[8:16]) >> 1
+		return x < uint64(s.SamplingRatio*(1<<63))
+	}
+	return rand.Float64() < s.SamplingRatio
+}
+
+// FanoutHandler は 1 つのログレコードを複数の slog.Handler に振り分ける slog.Handler
+// 出力先ごとにレベルの閾値とサンプリング割合を設定できる
+type FanoutHandler struct {
+	sinks []Sink
+}
+
+// NewFanoutHandler は sinks を出力先とする FanoutHandler を生成する
+func NewFanoutHandler(sinks ...Sink) *FanoutHandler {
+	return &FanoutHandler{
+		sinks: sinks,
+	}
+}
+
+func (h *FanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, s := range h.sinks {
+		if s.enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *FanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, s := range h.sinks {
+		if !s.enabled(ctx, r.Level) || !s.sampled(ctx, r.Level) {
+			continue
+		}
+		// Handler 側で Record を変更されても他の出力先に影響しないよう Clone して渡す
+		if err := s.Handler.Handle(ctx, r.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *FanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	sinks := make([]Sink, 0, len(h.sinks))
+	for _, s := range h.sinks {
+		s.Handler = s.Handler.WithAttrs(attrs)
+		sinks = append(sinks, s)
+	}
+	return &FanoutHandler{sinks: sinks}
+}
+
+func (h *FanoutHandler) WithGroup(name string) slog.Handler {
+	sinks := make([]Sink, 0, len(h.sinks))
+	for _, s := range h.sinks {
+		s.Handler = s.Handler.WithGroup(name)
+		sinks = append(sinks, s)
+	}
+	return &FanoutHandler{sinks: sinks}
+}
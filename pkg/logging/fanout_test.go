@@ -0,0 +1,70 @@
+// pkg/logging/fanout_test.go
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFanoutHandler_LevelPerSink(t *testing.T) {
+	var debugBuf, warnBuf bytes.Buffer
+	logger := slog.New(NewFanoutHandler(
+		Sink{
+			Handler:       slog.NewTextHandler(&debugBuf, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			SamplingRatio: 1,
+		},
+		Sink{
+			Handler:       slog.NewTextHandler(&warnBuf, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			Level:         slog.LevelWarn,
+			SamplingRatio: 1,
+		},
+	))
+
+	logger.Debug("debug message")
+	logger.Warn("warn message")
+
+	if got := strings.Count(debugBuf.String(), "\n"); got != 2 {
+		t.Errorf("debug sink lines = %d; want 2\nraw: %s", got, debugBuf.String())
+	}
+	if got := warnBuf.String(); strings.Contains(got, "debug message") || !strings.Contains(got, "warn message") {
+		t.Errorf("warn sink output = %q; want only warn message", got)
+	}
+}
+
+func TestFanoutHandler_Sampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewFanoutHandler(Sink{
+		Handler:       slog.NewTextHandler(&buf, nil),
+		SamplingRatio: 0,
+	})).With("component", "test")
+
+	// WARN 未満は全て捨てられ、WARN 以上はサンプリングされない
+	for range 10 {
+		logger.Info("info message")
+	}
+	logger.Error("error message")
+
+	got := buf.String()
+	if strings.Contains(got, "info message") {
+		t.Errorf("output contains sampled out record: %q", got)
+	}
+	if !strings.Contains(got, "error message") || !strings.Contains(got, "component=test") {
+		t.Errorf("output = %q; want error message with attrs", got)
+	}
+}
+
+func TestFanoutHandler_Enabled(t *testing.T) {
+	h := NewFanoutHandler(Sink{
+		Handler: slog.NewTextHandler(&bytes.Buffer{}, nil),
+		Level:   slog.LevelError,
+	})
+	if h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("Enabled(WARN) = true; want false")
+	}
+	if !h.Enabled(context.Background(), slog.LevelError) {
+		t.Error("Enabled(ERROR) = false; want true")
+	}
+}
@@ -0,0 +1,217 @@
+// pkg/logging/otel_handler.go
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+const (
+	traceIDKey = "trace_id"
+	spanIDKey  = "span_id"
+)
+
+// OTelHandler は slog のログレコードを OpenTelemetry Logs Bridge API の LogRecord に変換して送る slog.Handler
+// https://opentelemetry.io/docs/specs/otel/logs/bridge-api/
+//
+// trace/span の紐付けは以下の優先順で行う
+//  1. Handle に渡された ctx 上の span (InfoContext 等)
+//  2. 属性の trace_id/span_id (RequestLogger が付与したもの)
+type OTelHandler struct {
+	logger otellog.Logger
+
+	attrs   []otellog.KeyValue
+	prefix  string // WithGroup によるキーのプレフィックス ("group." 形式)
+	traceID oteltrace.TraceID
+	spanID  oteltrace.SpanID
+}
+
+// NewOTelHandler は provider から name の Logger を取得し、それに送る OTelHandler を生成する
+func NewOTelHandler(provider otellog.LoggerProvider, name string) *OTelHandler {
+	return &OTelHandler{
+		logger: provider.Logger(name),
+	}
+}
+
+func (h *OTelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.Enabled(ctx, otellog.EnabledParameters{
+		Severity: severity(level),
+	})
+}
+
+func (h *OTelHandler) Handle(ctx context.Context, r slog.Record) error {
+
+	var record otellog.Record
+	record.SetTimestamp(r.Time)
+	record.SetObservedTimestamp(time.Now())
+	record.SetSeverity(severity(r.Level))
+	record.SetSeverityText(r.Level.String())
+	record.SetBody(otellog.StringValue(r.Message))
+
+	attrs := make([]otellog.KeyValue, 0, len(h.attrs)+r.NumAttrs())
+	attrs = append(attrs, h.attrs...)
+
+	traceID, spanID := h.traceID, h.spanID
+	r.Attrs(func(a slog.Attr) bool {
+		if h.prefix == "" {
+			traceID, spanID = lookupTraceIDs(a, traceID, spanID)
+		}
+		attrs = appendAttr(attrs, h.prefix, a)
+		return true
+	})
+	record.AddAttributes(attrs...)
+
+	// ctx に span が無い場合、属性の trace_id/span_id から紐付ける
+	if !oteltrace.SpanContextFromContext(ctx).IsValid() && traceID.IsValid() && spanID.IsValid() {
+		ctx = oteltrace.ContextWithSpanContext(ctx, oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: oteltrace.FlagsSampled,
+			Remote:     true,
+		}))
+	}
+
+	h.logger.Emit(ctx, record)
+	return nil
+}
+
+func (h *OTelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = make([]otellog.KeyValue, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+	for _, a := range attrs {
+		if h.prefix == "" {
+			h2.traceID, h2.spanID = lookupTraceIDs(a, h2.traceID, h2.spanID)
+		}
+		h2.attrs = appendAttr(h2.attrs, h.prefix, a)
+	}
+	return &h2
+}
+
+func (h *OTelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// slog.Level と OpenTelemetry の SeverityNumber はどちらも 4 刻みなので、オフセットだけで変換できる
+// slog.LevelInfo(0) → SeverityInfo(9)
+func severity(level slog.Level) otellog.Severity {
+	return otellog.Severity(level + 9)
+}
+
+func lookupTraceIDs(a slog.Attr, traceID oteltrace.TraceID, spanID oteltrace.SpanID) (oteltrace.TraceID, oteltrace.SpanID) {
+	if a.Value.Kind() != slog.KindString {
+		return traceID, spanID
+	}
+	switch a.Key {
+	case traceIDKey:
+		if id, err := oteltrace.TraceIDFromHex(a.Value.String()); err == nil {
+			traceID = id
+		}
+	case spanIDKey:
+		if id, err := oteltrace.SpanIDFromHex(a.Value.String()); err == nil {
+			spanID = id
+		}
+	}
+	return traceID, spanID
+}
+
+// appendAttr は slog.Attr を OpenTelemetry の KeyValue に変換して dst に追加する
+// グループはキーを "." で連結してフラットに展開する
+func appendAttr(dst []otellog.KeyValue, prefix string, a slog.Attr) []otellog.KeyValue {
+
+	// error は LogValuer (CustomError) を解決する前に判定する
+	if k := a.Value.Kind(); k == slog.KindAny || k == slog.KindLogValuer {
+		if err, ok := a.Value.Any().(error); ok {
+			return appendError(dst, prefix+a.Key, err)
+		}
+	}
+
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return dst
+	}
+	key := prefix + a.Key
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			dst = appendAttr(dst, groupPrefix, ga)
+		}
+		return dst
+	case slog.KindString:
+		return append(dst, otellog.String(key, a.Value.String()))
+	case slog.KindInt64:
+		return append(dst, otellog.Int64(key, a.Value.Int64()))
+	case slog.KindUint64:
+		return append(dst, otellog.Int64(key, int64(a.Value.Uint64())))
+	case slog.KindFloat64:
+		return append(dst, otellog.Float64(key, a.Value.Float64()))
+	case slog.KindBool:
+		return append(dst, otellog.Bool(key, a.Value.Bool()))
+	case slog.KindDuration:
+		return append(dst, otellog.String(key, a.Value.Duration().String()))
+	case slog.KindTime:
+		return append(dst, otellog.String(key, a.Value.Time().Format(time.RFC3339Nano)))
+	default:
+		if err, ok := a.Value.Any().(error); ok {
+			return appendError(dst, key, err)
+		}
+		return append(dst, otellog.String(key, fmt.Sprintf("%+v", a.Value.Any())))
+	}
+}
+
+// appendError は error を属性に変換する. CustomError の場合は中身を平坦な属性として展開する
+func appendError(dst []otellog.KeyValue, key string, err error) []otellog.KeyValue {
+	if err == nil {
+		return dst
+	}
+
+	var ce *cerrors.CustomError
+	if !errors.As(err, &ce) {
+		return append(dst, otellog.String(key, err.Error()))
+	}
+
+	// code, detail
+	dst = append(dst,
+		otellog.String(key+".code", ce.Code()),
+		otellog.String(key+".detail", ce.Detail()),
+	)
+
+	// cause (スタックを含む場合があるので先頭行のみ)
+	if ca := ce.Unwrap(); ca != nil {
+		causeStr := ca.Error()
+		if idx := strings.Index(causeStr, "\n"); idx >= 0 {
+			causeStr = causeStr[:idx]
+		}
+		dst = append(dst, otellog.String(key+".cause", causeStr))
+	}
+
+	// messages
+	if msgs := ce.Messages(); len(msgs) > 0 {
+		values := make([]otellog.Value, 0, len(msgs))
+		for _, msg := range msgs {
+			values = append(values, otellog.StringValue(fmt.Sprintf("%s (%s:%d)", msg.Message, msg.Filename, msg.Lineno)))
+		}
+		dst = append(dst, otellog.Slice(key+".messages", values...))
+	}
+
+	return dst
+}
@@ -0,0 +1,100 @@
+// pkg/logging/otel_handler_test.go
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/embedded"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+type recordingProvider struct {
+	embedded.LoggerProvider
+	logger *recordingLogger
+}
+
+func (p *recordingProvider) Logger(string, ...otellog.LoggerOption) otellog.Logger {
+	return p.logger
+}
+
+type recordingLogger struct {
+	embedded.Logger
+	records []otellog.Record
+	ctxs    []context.Context
+}
+
+func (l *recordingLogger) Emit(ctx context.Context, r otellog.Record) {
+	l.records = append(l.records, r)
+	l.ctxs = append(l.ctxs, ctx)
+}
+
+func (l *recordingLogger) Enabled(context.Context, otellog.EnabledParameters) bool {
+	return true
+}
+
+func attributes(r otellog.Record) map[string]otellog.Value {
+	attrs := map[string]otellog.Value{}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	return attrs
+}
+
+func TestOTelHandler_TraceCorrelationFromAttrs(t *testing.T) {
+	rec := &recordingLogger{}
+	logger := slog.New(NewOTelHandler(&recordingProvider{logger: rec}, "test")).With(
+		"trace_id", "0102030405060708090a0b0c0d0e0f10",
+		"span_id", "0102030405060708",
+	)
+
+	logger.Warn("hello", "count", 3)
+
+	if len(rec.records) != 1 {
+		t.Fatalf("records = %d; want 1", len(rec.records))
+	}
+	r := rec.records[0]
+	if got := r.Severity(); got != otellog.SeverityWarn {
+		t.Errorf("Severity() = %v; want %v", got, otellog.SeverityWarn)
+	}
+	if got := r.Body().AsString(); got != "hello" {
+		t.Errorf("Body() = %q; want %q", got, "hello")
+	}
+	if got := attributes(r)["count"].AsInt64(); got != 3 {
+		t.Errorf("count = %d; want 3", got)
+	}
+
+	spanCtx := oteltrace.SpanContextFromContext(rec.ctxs[0])
+	if got := spanCtx.TraceID().String(); got != "0102030405060708090a0b0c0d0e0f10" {
+		t.Errorf("TraceID = %s; want from attrs", got)
+	}
+	if got := spanCtx.SpanID().String(); got != "0102030405060708" {
+		t.Errorf("SpanID = %s; want from attrs", got)
+	}
+}
+
+func TestOTelHandler_FlattenCustomError(t *testing.T) {
+	rec := &recordingLogger{}
+	logger := slog.New(NewOTelHandler(&recordingProvider{logger: rec}, "test"))
+
+	err := cerrors.ErrDBNotFound.New(
+		cerrors.WithMessage("user not found"),
+	)
+	logger.WithGroup("db").Error("failed", "error", err)
+
+	attrs := attributes(rec.records[0])
+	if got := attrs["db.error.code"].AsString(); got != "DB_NOT_FOUND" {
+		t.Errorf("db.error.code = %q; want %q", got, "DB_NOT_FOUND")
+	}
+	if got := attrs["db.error.detail"].AsString(); got == "" {
+		t.Error("db.error.detail is empty")
+	}
+	if got := attrs["db.error.messages"].AsSlice(); len(got) != 1 {
+		t.Errorf("db.error.messages len = %d; want 1", len(got))
+	}
+}
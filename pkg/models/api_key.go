@@ -0,0 +1,116 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyScope は API キーで操作できる範囲. <リソース>:<read|write> の形式で, リソースはルートの最初のセグメント (/users/{user_id} の users)
+// write は同じリソースの read を含む
+type APIKeyScope string
+
+const (
+	APIKeyScopeUsersRead       APIKeyScope = "users:read"
+	APIKeyScopeUsersWrite      APIKeyScope = "users:write"
+	APIKeyScopeAuditEventsRead APIKeyScope = "audit-events:read"
+	APIKeyScopeWebhooksRead    APIKeyScope = "webhooks:read"
+	APIKeyScopeWebhooksWrite   APIKeyScope = "webhooks:write"
+	APIKeyScopeAPIKeysRead     APIKeyScope = "api-keys:read"
+	APIKeyScopeAPIKeysWrite    APIKeyScope = "api-keys:write"
+)
+
+// 発行できるスコープ (openapi/specs/api_keys.yaml の APIKeyScope と同じ)
+var apiKeyScopes = []APIKeyScope{
+	APIKeyScopeUsersRead,
+	APIKeyScopeUsersWrite,
+	APIKeyScopeAuditEventsRead,
+	APIKeyScopeWebhooksRead,
+	APIKeyScopeWebhooksWrite,
+	APIKeyScopeAPIKeysRead,
+	APIKeyScopeAPIKeysWrite,
+}
+
+const (
+	apiKeyScopeReadSuffix  = ":read"
+	apiKeyScopeWriteSuffix = ":write"
+)
+
+// NewAPIKeyScope はリソースへの読み取り (write が false) または書き込みに必要なスコープを返す
+func NewAPIKeyScope(resource string, write bool) APIKeyScope {
+	if write {
+		return APIKeyScope(resource + apiKeyScopeWriteSuffix)
+	}
+	return APIKeyScope(resource + apiKeyScopeReadSuffix)
+}
+
+// Valid は発行できるスコープかを返す
+func (s APIKeyScope) Valid() bool {
+	return slices.Contains(apiKeyScopes, s)
+}
+
+// APIKey はマシンクライアントの認証に使うキー
+// キーそのものは発行時に一度だけ返し, 保存するのは検索用の Prefix とキー全体のハッシュ (SHA-256) のみ
+type APIKey struct {
+	ID       uuid.UUID
+	TenantID uuid.UUID
+	Name     string
+
+	// キーに含まれる検索用の識別子. キーの持ち主が一覧から見分けるのにも使う
+	Prefix     string
+	SecretHash []byte
+
+	Scopes []APIKeyScope
+
+	// キーごとのレート制限. RateLimitRPS が 0 の場合は api_keys.rate_limit の既定値
+	RateLimitRPS   float64
+	RateLimitBurst int
+
+	// ゼロ値の場合は無期限/未使用/有効
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+
+	// ローテーションで置き換えたキー. 無い場合は uuid.Nil
+	RotatedFrom uuid.UUID
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type APIKeyPrototype struct {
+	ID             uuid.UUID
+	Name           string
+	Prefix         string
+	SecretHash     []byte
+	Scopes         []APIKeyScope
+	RateLimitRPS   float64
+	RateLimitBurst int
+	ExpiresAt      time.Time
+	RotatedFrom    uuid.UUID
+}
+
+// Active は now の時点でキーが使えるか (失効しておらず期限内か) を返す
+func (k *APIKey) Active(now time.Time) bool {
+	if !k.RevokedAt.IsZero() {
+		return false
+	}
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// HasScope はキーが scope を持つかを返す. <リソース>:read は同じリソースの write でも満たす
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	if slices.Contains(k.Scopes, scope) {
+		return true
+	}
+	resource, found := strings.CutSuffix(string(scope), apiKeyScopeReadSuffix)
+	return found && slices.Contains(k.Scopes, NewAPIKeyScope(resource, true))
+}
+
+// IssuedAPIKey は発行したキー. Secret (キーそのもの) はこの時だけ得られる
+type IssuedAPIKey struct {
+	APIKey *APIKey
+	Secret string
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKey_HasScope(t *testing.T) {
+	key := &APIKey{Scopes: []APIKeyScope{APIKeyScopeUsersWrite, APIKeyScopeAuditEventsRead}}
+
+	tests := []struct {
+		scope APIKeyScope
+		want  bool
+	}{
+		{scope: APIKeyScopeUsersWrite, want: true},
+		{scope: APIKeyScopeUsersRead, want: true}, // write は read を含む
+		{scope: APIKeyScopeAuditEventsRead, want: true},
+		{scope: NewAPIKeyScope("audit-events", true), want: false},
+		{scope: APIKeyScopeWebhooksRead, want: false},
+	}
+	for _, tt := range tests {
+		if got := key.HasScope(tt.scope); got != tt.want {
+			t.Errorf("HasScope(%q) = %v; want %v", tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKey_Active(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		key  APIKey
+		want bool
+	}{
+		{name: "no expiry", key: APIKey{}, want: true},
+		{name: "before expiry", key: APIKey{ExpiresAt: now.Add(time.Minute)}, want: true},
+		{name: "expired", key: APIKey{ExpiresAt: now}, want: false},
+		{name: "revoked", key: APIKey{RevokedAt: now.Add(-time.Minute)}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.key.Active(now); got != tt.want {
+			t.Errorf("%s: Active() = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+)
+
+type AuditActorType string
+
+const (
+	AuditActorTypeOIDC    AuditActorType = "oidc"    // OIDC の sub
+	AuditActorTypeAPIKey  AuditActorType = "api_key" // API キーの ID
+	AuditActorTypeSession AuditActorType = "session" // セッションのユーザー
+	// 認証されていないリクエスト
+	AuditActorTypeAnonymous AuditActorType = "anonymous"
+	// リクエストによらない操作 (worker のジョブ等)
+	AuditActorTypeSystem AuditActorType = "system"
+)
+
+// AuditActor は変更を行った主体
+type AuditActor struct {
+	Type AuditActorType
+	ID   string
+}
+
+// AuditEvent は変更操作の監査ログ. 変更と同じトランザクションで記録される
+type AuditEvent struct {
+	ID         uuid.UUID
+	TenantID   uuid.UUID
+	Action     AuditAction
+	Actor      AuditActor
+	TargetType string
+	TargetID   uuid.UUID
+
+	// 変更された項目の変更前/変更後の値 (JSON オブジェクト). 作成の場合 Before, 削除の場合 After は nil
+	Before json.RawMessage
+	After  json.RawMessage
+
+	RequestID string
+	TraceID   string
+	ClientIP  string
+	UserAgent string
+
+	OccurredAt time.Time
+}
+
+// ListAuditEventsParams は監査ログの取得条件. ゼロ値の条件は指定しないものとして扱う
+// 新しい順に返し, Cursor を指定した場合はその ID より古いものを返す (keyset pagination)
+type ListAuditEventsParams struct {
+	Action     AuditAction
+	ActorType  AuditActorType
+	ActorID    string
+	TargetType string
+	TargetID   uuid.UUID
+
+	// OccurredAt が Since 以降, Until より前のもの
+	Since time.Time
+	Until time.Time
+
+	Cursor uuid.UUID
+	Limit  int
+}
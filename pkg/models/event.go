@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	EventTypeUserCreated EventType = "user.created"
+	EventTypeUserUpdated EventType = "user.updated"
+	EventTypeUserDeleted EventType = "user.deleted"
+)
+
+const AggregateTypeUser = "user"
+
+// Event はドメインイベント. outbox テーブルを経由して外部に配信される
+type Event struct {
+	ID uuid.UUID
+
+	// イベントを発生させたテナント. webhook にはこのテナントの webhook だけに配信する
+	TenantID uuid.UUID
+
+	Type          EventType
+	AggregateType string
+	AggregateID   uuid.UUID
+	Payload       json.RawMessage
+	OccurredAt    time.Time
+
+	// W3C Trace Context (traceparent, tracestate) 等. 配信時に親 span として復元する
+	TraceContext map[string]string
+
+	// 配信の試行回数 (outbox から読み出した場合のみ)
+	Attempts int
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// RetryPolicy は配信に失敗したイベントや webhook の再試行の方針 (指数バックオフ)
+type RetryPolicy struct {
+	// この回数失敗したら dead (dead-letter) にして再試行しない
+	MaxAttempts int
+
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Next は attempts 回目の失敗の後, 次に試行するまでの待ち時間を返す. dead が true の場合は再試行しない
+func (p RetryPolicy) Next(attempts int) (backoff time.Duration, dead bool) {
+	if p.MaxAttempts > 0 && attempts >= p.MaxAttempts {
+		return 0, true
+	}
+	backoff = p.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff >= p.MaxBackoff {
+			return p.MaxBackoff, false
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff, false
+}
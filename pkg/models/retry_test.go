@@ -0,0 +1,32 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Next(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+	}
+
+	tests := []struct {
+		attempts    int
+		wantBackoff time.Duration
+		wantDead    bool
+	}{
+		{attempts: 1, wantBackoff: time.Second},
+		{attempts: 2, wantBackoff: 2 * time.Second},
+		{attempts: 3, wantBackoff: 4 * time.Second},
+		{attempts: 4, wantBackoff: 5 * time.Second}, // MaxBackoff で頭打ち
+		{attempts: 5, wantDead: true},
+	}
+	for _, tt := range tests {
+		backoff, dead := policy.Next(tt.attempts)
+		if backoff != tt.wantBackoff || dead != tt.wantDead {
+			t.Errorf("Next(%d) = (%s, %v); want (%s, %v)", tt.attempts, backoff, dead, tt.wantBackoff, tt.wantDead)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session はユーザのログインセッション. トークンは含めない
+type Session struct {
+	ID          uuid.UUID
+	UserSubject string
+
+	// ログインした端末の User-Agent
+	Device string
+	// 最後のリクエストの IP アドレス
+	IPAddress string
+
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// 有効期間と無操作時の期限の早い方
+	ExpiresAt time.Time
+
+	// リクエストのセッションか
+	Current bool
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultTenantID はマルチテナントを有効にする前のデータが属するテナント (db/migrations/000007_create_tenants_table.up.sql)
+// マルチテナントを無効にしている場合は全てのリクエストがこのテナントで処理される
+var DefaultTenantID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// Tenant は1つのデプロイでホストする組織
+type Tenant struct {
+	ID        uuid.UUID
+	Slug      string // サブドメインに使う識別子
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
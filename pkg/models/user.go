@@ -9,6 +9,7 @@ import (
 type User struct {
 	UserPrototype
 	ID        uuid.UUID
+	TenantID  uuid.UUID
 	Name      string
 	Email     string
 	CreatedAt time.Time
@@ -24,3 +25,11 @@ type UserPrototype struct {
 
 type ListUsersParams struct {
 }
+
+// ListUsersAfterParams は name, id の順で (AfterName, AfterID) より後のユーザーを取得する条件 (keyset pagination)
+// AfterName が空の場合は先頭から取得する
+type ListUsersAfterParams struct {
+	AfterName string
+	AfterID   uuid.UUID
+	Limit     int
+}
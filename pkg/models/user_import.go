@@ -0,0 +1,70 @@
+package models
+
+// UserImportOnDuplicate は取り込む行の email が既存のユーザーと重複した場合の扱い
+type UserImportOnDuplicate string
+
+const (
+	UserImportOnDuplicateFail   UserImportOnDuplicate = "fail"   // 行を誤りとして報告し, 取り込み全体をロールバックする
+	UserImportOnDuplicateSkip   UserImportOnDuplicate = "skip"   // 既存のユーザーはそのままにする
+	UserImportOnDuplicateUpdate UserImportOnDuplicate = "update" // 既存のユーザーの name を更新する
+)
+
+type ImportUsersParams struct {
+	// 結果を返すだけで書き込まない
+	DryRun      bool
+	OnDuplicate UserImportOnDuplicate
+}
+
+// UserImportUpdate は取り込みで name を更新したユーザーと, その更新前の状態
+type UserImportUpdate struct {
+	Before *User
+	After  *User
+}
+
+// UserImportRow は取り込む 1 行. 入力の誤りは Errors に入れ, その行は書き込まずに結果として報告する
+type UserImportRow struct {
+	// 本文での行番号 (1〜)
+	Line   int
+	Name   string
+	Email  string
+	Errors []FieldError
+}
+
+// FieldError は入力の誤り
+type FieldError struct {
+	Name   string
+	Reason string
+}
+
+type UserImportRowErrorStatus string
+
+const (
+	UserImportRowErrorStatusInvalid   UserImportRowErrorStatus = "invalid"   // 入力の誤り
+	UserImportRowErrorStatusDuplicate UserImportRowErrorStatus = "duplicate" // email の重複 (OnDuplicate が fail の場合)
+)
+
+// UserImportRowError は取り込めなかった行
+type UserImportRowError struct {
+	Line   int
+	Status UserImportRowErrorStatus
+	Errors []FieldError
+}
+
+// UserImportResult は取り込みの結果
+type UserImportResult struct {
+	DryRun      bool
+	OnDuplicate UserImportOnDuplicate
+
+	// 変更を確定したか. dry run とロールバックした場合は false
+	Committed bool
+
+	Total   int
+	Created int
+	Updated int
+	Skipped int
+	Failed  int
+
+	// 取り込めなかった行 (入力順). 上限を超えた分は含めず ErrorsTruncated にする
+	Errors          []UserImportRowError
+	ErrorsTruncated bool
+}
@@ -0,0 +1,22 @@
+package models
+
+// SearchUsersParams はユーザーの検索条件
+type SearchUsersParams struct {
+	// 検索語. 空白区切りの語は全て含むもの (AND) を探す. 似た語 (typo) にも一致する
+	Query string
+	Limit int
+}
+
+// UserSearchResult は検索に一致したユーザー
+type UserSearchResult struct {
+	User *User
+	// 関連度. 大きいほど検索語との関連が高い
+	Rank float64
+	// 検索語と一致した箇所を <mark> で囲んだ name/email (HTML エスケープ済み). 似た語での一致のみの場合は空
+	Highlights UserSearchHighlights
+}
+
+type UserSearchHighlights struct {
+	Name  string
+	Email string
+}
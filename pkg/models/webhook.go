@@ -0,0 +1,109 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook は外部の受信者 (integrator) が登録した配信先
+type Webhook struct {
+	ID          uuid.UUID
+	TenantID    uuid.UUID
+	URL         string
+	Description string
+
+	// 配信するイベントの種類. 空の場合は全てのイベント
+	EventTypes []EventType
+
+	// 署名 (HMAC-SHA256) の鍵. API のレスポンスには含めない
+	Secret string
+
+	Enabled bool
+
+	// 連続して配信に失敗した回数. 上限に達すると自動的に無効になる
+	ConsecutiveFailures int
+	DisabledReason      string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type WebhookPrototype struct {
+	ID          uuid.UUID
+	URL         string
+	Description string
+	EventTypes  []EventType
+	Secret      string
+	Enabled     bool
+}
+
+// Matches は event を配信する対象かを返す
+func (w *Webhook) Matches(eventType EventType) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed" // 再試行の上限に達した
+)
+
+// WebhookDelivery は1つの webhook への1つのイベントの配信
+type WebhookDelivery struct {
+	ID        uuid.UUID
+	TenantID  uuid.UUID
+	WebhookID uuid.UUID
+	EventID   uuid.UUID
+	EventType EventType
+
+	// 送信する body
+	Payload json.RawMessage
+
+	Status        WebhookDeliveryStatus
+	Attempts      int
+	NextAttemptAt time.Time
+
+	// 最後の試行の結果. レスポンスが無かった場合 LastResponseCode は 0
+	LastResponseCode int
+	LastError        string
+
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeliveredAt time.Time
+
+	// 試行の履歴 (GetWebhookDelivery の場合のみ)
+	AttemptLog []*WebhookDeliveryAttempt
+}
+
+// WebhookDeliveryAttempt は配信の1回の試行の記録
+type WebhookDeliveryAttempt struct {
+	Attempt int
+
+	// レスポンスが無かった場合 (接続エラー, タイムアウト等) は 0
+	ResponseCode int
+	Error        string
+	Duration     time.Duration
+	AttemptedAt  time.Time
+}
+
+// Succeeded は試行が成功 (2xx) したかを返す
+func (a *WebhookDeliveryAttempt) Succeeded() bool {
+	return a.Error == "" && a.ResponseCode >= 200 && a.ResponseCode < 300
+}
+
+// ListWebhookDeliveriesParams は配信履歴の取得条件
+type ListWebhookDeliveriesParams struct {
+	Limit int
+}
@@ -0,0 +1,236 @@
+// pkg/operations/api_keys.go
+package operations
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// API キーの形式: gbk_<prefix>_<secret>
+// prefix (16 桁の 16 進数) は検索用でキーの持ち主にも見せる. secret は 32 バイトの乱数 (base64url)
+// 保存するのは prefix とキー全体の SHA-256 のみ. secret は十分な長さの乱数なので, パスワードのような遅いハッシュは使わない
+const (
+	apiKeyScheme      = "gbk_"
+	apiKeyPrefixBytes = 8
+	apiKeySecretBytes = 32
+)
+
+var errorCodeDBNotFound = errorCodeOf(cerrors.ErrDBNotFound.New())
+
+func (p *Handler) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+
+	return p.dbHandler.ListAPIKeys(ctx)
+}
+
+func (p *Handler) GetAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+
+	return p.dbHandler.GetAPIKey(ctx, apiKeyID)
+}
+
+// IssueAPIKey は ctx のテナントのキーを発行する. prototype の ID, Prefix, SecretHash は上書きする
+// issuer は API キーで認証した呼び出し元のキー (それ以外は nil). issuer が持たないスコープは ErrAuthorization, 期限は issuer の期限までに制限する
+// 返したキー (IssuedAPIKey.Secret) は保存しないため, 呼び出し元が一度だけ持ち主に渡す
+func (p *Handler) IssueAPIKey(ctx context.Context, issuer *models.APIKey, prototype *models.APIKeyPrototype) (*models.IssuedAPIKey, error) {
+
+	if err := delegateAPIKey(issuer, prototype); err != nil {
+		return nil, err
+	}
+
+	uuidV7, err := uuid.NewV7()
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("faild to negerate a new uuid v7"),
+		)
+	}
+	prototype.ID = uuidV7
+
+	secret, prefix, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	prototype.Prefix = prefix
+	prototype.SecretHash = hashAPIKey(secret)
+
+	apiKey, err := p.dbHandler.CreateAPIKey(ctx, prototype)
+	if err != nil {
+		return nil, err
+	}
+	return &models.IssuedAPIKey{APIKey: apiKey, Secret: secret}, nil
+}
+
+// RevokeAPIKey はキーを失効させる. 失効済みの場合はそのまま返す
+func (p *Handler) RevokeAPIKey(ctx context.Context, apiKeyID uuid.UUID) (*models.APIKey, error) {
+
+	return p.dbHandler.RevokeAPIKey(ctx, apiKeyID)
+}
+
+// RotateAPIKey は同じ名前, スコープ, 制限, 期限の新しいキーを発行し, 古いキーを gracePeriod の後に期限切れにする
+// gracePeriod が 0 の場合は古いキーをすぐに失効させる. 失効済みのキーは ErrInvalidState
+// issuer は IssueAPIKey と同じ. 新しいキーを得られるため, issuer は古いキーの全てのスコープを持っている必要がある
+func (p *Handler) RotateAPIKey(ctx context.Context, issuer *models.APIKey, apiKeyID uuid.UUID, gracePeriod time.Duration) (*models.IssuedAPIKey, error) {
+
+	var issued *models.IssuedAPIKey
+	err := p.dbHandler.RunInTx(ctx, func(ctx context.Context) error {
+		old, err := p.dbHandler.GetAPIKey(ctx, apiKeyID)
+		if err != nil {
+			return err
+		}
+		if !old.Active(time.Now()) {
+			return cerrors.ErrInvalidState.New(
+				cerrors.WithMessagef("api key is revoked or expired: %s", apiKeyID),
+			)
+		}
+
+		issued, err = p.IssueAPIKey(ctx, issuer, &models.APIKeyPrototype{
+			Name:           old.Name,
+			Scopes:         old.Scopes,
+			RateLimitRPS:   old.RateLimitRPS,
+			RateLimitBurst: old.RateLimitBurst,
+			ExpiresAt:      old.ExpiresAt,
+			RotatedFrom:    old.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if gracePeriod <= 0 {
+			_, err = p.dbHandler.RevokeAPIKey(ctx, old.ID)
+		} else {
+			_, err = p.dbHandler.ExpireAPIKey(ctx, old.ID, time.Now().Add(gracePeriod))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// AuthenticateAPIKey は key (gbk_<prefix>_<secret>) に一致する有効なキーを返す. 一致しない/失効/期限切れの場合は ErrAuthentication
+// テナントを特定する前に呼ぶため, 全てのテナントから探す. 最終使用日時は前回の記録から touchInterval 以上経った場合に記録する
+func (p *Handler) AuthenticateAPIKey(ctx context.Context, key string, touchInterval time.Duration) (*models.APIKey, error) {
+
+	prefix, ok := parseAPIKey(key)
+	if !ok {
+		return nil, cerrors.ErrAuthentication.New(
+			cerrors.WithMessage("malformed api key"),
+		)
+	}
+
+	ctx = db.WithCrossTenant(ctx)
+	apiKey, err := p.dbHandler.GetAPIKeyByPrefix(ctx, prefix)
+	if errorCodeOf(err) == errorCodeDBNotFound {
+		// 発行した直後でレプリカに届いていない場合に備えてプライマリでも探す
+		apiKey, err = p.dbHandler.GetAPIKeyByPrefix(db.WithPrimary(ctx), prefix)
+	}
+	switch {
+	case errorCodeOf(err) == errorCodeDBNotFound:
+		return nil, cerrors.ErrAuthentication.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("unknown api key: %s", prefix),
+		)
+	case err != nil:
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(hashAPIKey(key), apiKey.SecretHash) != 1 {
+		return nil, cerrors.ErrAuthentication.New(
+			cerrors.WithMessagef("api key secret mismatch: %s", prefix),
+		)
+	}
+	if !apiKey.Active(time.Now()) {
+		return nil, cerrors.ErrAuthentication.New(
+			cerrors.WithMessagef("api key is revoked or expired: %s", prefix),
+		)
+	}
+
+	// 記録に失敗しても認証は成功させる
+	if err := p.dbHandler.TouchAPIKey(ctx, apiKey.ID, touchInterval); err != nil {
+		logging.FromContext(ctx).Warn("failed to record api key usage", "api_key_id", apiKey.ID, "error", err)
+	}
+	return apiKey, nil
+}
+
+// delegateAPIKey は issuer が prototype のキーを発行できるかを確認し, 期限を issuer の期限までに制限する. issuer が nil の場合は何もしない
+// API キーで自分より強いキーや長く使えるキーを発行できないようにする
+func delegateAPIKey(issuer *models.APIKey, prototype *models.APIKeyPrototype) error {
+	if issuer == nil {
+		return nil
+	}
+	for _, scope := range prototype.Scopes {
+		if !issuer.HasScope(scope) {
+			return cerrors.ErrAuthorization.New(
+				cerrors.WithMessagef("api key %s does not have the %s scope", issuer.ID, scope),
+			)
+		}
+	}
+	if !issuer.ExpiresAt.IsZero() && (prototype.ExpiresAt.IsZero() || prototype.ExpiresAt.After(issuer.ExpiresAt)) {
+		prototype.ExpiresAt = issuer.ExpiresAt
+	}
+	return nil
+}
+
+// IsAPIKey は value が API キーの形式 (gbk_ で始まる) かを返す. Authorization: Bearer のトークンを OIDC のトークンと見分けるのに使う
+func IsAPIKey(value string) bool {
+	return strings.HasPrefix(value, apiKeyScheme)
+}
+
+// generateAPIKey は新しいキーとその prefix を返す
+func generateAPIKey() (string, string, error) {
+
+	buf := make([]byte, apiKeyPrefixBytes+apiKeySecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("failed to generate api key"),
+		)
+	}
+	prefix := hex.EncodeToString(buf[:apiKeyPrefixBytes])
+	secret := base64.RawURLEncoding.EncodeToString(buf[apiKeyPrefixBytes:])
+	return apiKeyScheme + prefix + "_" + secret, prefix, nil
+}
+
+// parseAPIKey は key の prefix を返す. 形式が正しくない場合は false
+func parseAPIKey(key string) (string, bool) {
+
+	rest, ok := strings.CutPrefix(key, apiKeyScheme)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != hex.EncodedLen(apiKeyPrefixBytes) || len(secret) != base64.RawURLEncoding.EncodedLen(apiKeySecretBytes) {
+		return "", false
+	}
+	if _, err := hex.DecodeString(prefix); err != nil {
+		return "", false
+	}
+	return prefix, true
+}
+
+func hashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+func errorCodeOf(err error) string {
+	var cerr *cerrors.CustomError
+	if errors.As(err, &cerr) {
+		return cerr.Code()
+	}
+	return ""
+}
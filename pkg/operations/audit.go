@@ -0,0 +1,41 @@
+// pkg/operations/audit.go
+package operations
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// 監査ログの取得件数の既定値と上限
+const (
+	defaultAuditEventsLimit = 50
+	maxAuditEventsLimit     = 100
+)
+
+// ListAuditEvents は params に一致する監査ログを新しい順に返す
+// 続きがある場合は次のページの params.Cursor に指定する ID を返す. 最後のページの場合は uuid.Nil
+func (p *Handler) ListAuditEvents(ctx context.Context, params models.ListAuditEventsParams) ([]*models.AuditEvent, uuid.UUID, error) {
+
+	switch {
+	case params.Limit <= 0:
+		params.Limit = defaultAuditEventsLimit
+	case params.Limit > maxAuditEventsLimit:
+		params.Limit = maxAuditEventsLimit
+	}
+	limit := params.Limit
+
+	// 続きがあるかを知るため 1 件多く取得する
+	params.Limit++
+	items, err := p.dbHandler.ListAuditEvents(ctx, params)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if len(items) <= limit {
+		return items, uuid.Nil, nil
+	}
+	items = items[:limit]
+	return items, items[limit-1].ID, nil
+}
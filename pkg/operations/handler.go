@@ -4,20 +4,43 @@ package operations
 import (
 	"context"
 
+	"github.com/aazw/go-base/pkg/audit"
 	"github.com/aazw/go-base/pkg/cerrors"
 	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/events"
 	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/webhooks"
 	"github.com/google/uuid"
 )
 
 type Handler struct {
-	dbHandler db.Handler
+	dbHandler        db.Handler
+	webhookURLPolicy webhooks.URLPolicy
 }
 
-func NewHandler(dbHandler db.Handler) (*Handler, error) {
+type handlerOptions struct {
+	webhookURLPolicy webhooks.URLPolicy
+}
+
+type HandlerOption func(*handlerOptions)
+
+// WithWebhookURLPolicy は webhook の配信先として登録できる URL の条件を指定する. 指定しない場合は https の外部のホストのみ
+func WithWebhookURLPolicy(policy webhooks.URLPolicy) HandlerOption {
+	return func(o *handlerOptions) {
+		o.webhookURLPolicy = policy
+	}
+}
+
+func NewHandler(dbHandler db.Handler, options ...HandlerOption) (*Handler, error) {
+
+	opts := &handlerOptions{}
+	for _, option := range options {
+		option(opts)
+	}
 
 	return &Handler{
-		dbHandler: dbHandler,
+		dbHandler:        dbHandler,
+		webhookURLPolicy: opts.webhookURLPolicy,
 	}, nil
 }
 
@@ -38,7 +61,23 @@ func (p *Handler) CreateUser(ctx context.Context, prototype *models.UserPrototyp
 	}
 	prototype.ID = uuidV7
 
-	return p.dbHandler.CreateUser(ctx, prototype)
+	// 変更とイベント, 監査ログを同じトランザクションで書き込む (transactional outbox)
+	var user *models.User
+	err = p.dbHandler.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = p.dbHandler.CreateUser(ctx, prototype)
+		if err != nil {
+			return err
+		}
+		if err := p.appendUserEvent(ctx, models.EventTypeUserCreated, user); err != nil {
+			return err
+		}
+		return p.appendUserAuditEvent(ctx, models.AuditActionCreate, nil, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 func (p *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
@@ -49,10 +88,66 @@ func (p *Handler) GetUser(ctx context.Context, userID uuid.UUID) (*models.User,
 func (p *Handler) UpdateUser(ctx context.Context, userID uuid.UUID, prototype *models.UserPrototype) (*models.User, error) {
 
 	prototype.ID = userID
-	return p.dbHandler.UpdateUser(ctx, userID, prototype)
+
+	var user *models.User
+	err := p.dbHandler.RunInTx(ctx, func(ctx context.Context) error {
+		// 監査ログに記録する変更前の状態. 同時の更新で食い違わないよう, 変更が終わるまで行をロックする
+		before, err := p.dbHandler.GetUserForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		user, err = p.dbHandler.UpdateUser(ctx, userID, prototype)
+		if err != nil {
+			return err
+		}
+		if err := p.appendUserEvent(ctx, models.EventTypeUserUpdated, user); err != nil {
+			return err
+		}
+		return p.appendUserAuditEvent(ctx, models.AuditActionUpdate, before, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 func (p *Handler) DeleteUser(ctx context.Context, userID uuid.UUID) (int, error) {
 
-	return 1, p.dbHandler.DeleteUSer(ctx, userID)
+	err := p.dbHandler.RunInTx(ctx, func(ctx context.Context) error {
+		// 監査ログに記録する削除前の状態. 同時の更新で食い違わないよう, 削除が終わるまで行をロックする
+		before, err := p.dbHandler.GetUserForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := p.dbHandler.DeleteUSer(ctx, userID); err != nil {
+			return err
+		}
+		if err := p.appendUserEvent(ctx, models.EventTypeUserDeleted, before); err != nil {
+			return err
+		}
+		return p.appendUserAuditEvent(ctx, models.AuditActionDelete, before, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (p *Handler) appendUserEvent(ctx context.Context, eventType models.EventType, user *models.User) error {
+
+	event, err := events.NewUserEvent(ctx, eventType, user)
+	if err != nil {
+		return err
+	}
+	return p.dbHandler.AppendEvent(ctx, event)
+}
+
+// appendUserAuditEvent はユーザーに対する操作の監査ログを書き込む. 作成の場合 before, 削除の場合 after は nil を渡す
+func (p *Handler) appendUserAuditEvent(ctx context.Context, action models.AuditAction, before *models.User, after *models.User) error {
+
+	event, err := audit.NewUserEvent(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+	return p.dbHandler.AppendAuditEvent(ctx, event)
 }
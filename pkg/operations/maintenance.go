@@ -0,0 +1,70 @@
+// pkg/operations/maintenance.go
+package operations
+
+import (
+	"context"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/logging"
+)
+
+// PurgeResult は PurgeExpiredRecords で削除した件数
+type PurgeResult struct {
+	OutboxEvents      int64
+	WebhookDeliveries int64
+}
+
+// PurgeExpiredRecords は全てのテナントの retention より古い配信済みのイベントと完了した webhook の配信を削除する
+func (p *Handler) PurgeExpiredRecords(ctx context.Context, retention time.Duration) (*PurgeResult, error) {
+
+	if retention <= 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid retention: %s", retention),
+		)
+	}
+	before := time.Now().Add(-retention)
+
+	result := &PurgeResult{}
+	var err error
+	ctx = db.WithCrossTenant(ctx)
+	result.OutboxEvents, err = p.dbHandler.PurgeOutboxEvents(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	result.WebhookDeliveries, err = p.dbHandler.PurgeWebhookDeliveries(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).Info("purged expired records",
+		"before", before,
+		"outbox_events", result.OutboxEvents,
+		"webhook_deliveries", result.WebhookDeliveries,
+	)
+	return result, nil
+}
+
+// PurgeExpiredAuditEvents は全てのテナントの retention より古い監査ログを削除する. 削除した件数を返す
+// 監査ログは他の記録と保持期間が異なるため, PurgeExpiredRecords とは別に削除する
+func (p *Handler) PurgeExpiredAuditEvents(ctx context.Context, retention time.Duration) (int64, error) {
+
+	if retention <= 0 {
+		return 0, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid retention: %s", retention),
+		)
+	}
+	before := time.Now().Add(-retention)
+
+	n, err := p.dbHandler.PurgeAuditEvents(db.WithCrossTenant(ctx), before)
+	if err != nil {
+		return 0, err
+	}
+
+	logging.FromContext(ctx).Info("purged expired audit events",
+		"before", before,
+		"audit_events", n,
+	)
+	return n, nil
+}
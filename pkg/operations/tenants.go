@@ -0,0 +1,20 @@
+// pkg/operations/tenants.go
+package operations
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+func (p *Handler) GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.Tenant, error) {
+
+	return p.dbHandler.GetTenant(ctx, tenantID)
+}
+
+func (p *Handler) GetTenantBySlug(ctx context.Context, slug string) (*models.Tenant, error) {
+
+	return p.dbHandler.GetTenantBySlug(ctx, slug)
+}
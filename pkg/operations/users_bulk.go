@@ -0,0 +1,219 @@
+// pkg/operations/users_bulk.go
+package operations
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"iter"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+const (
+	// 取り込みで 1 度に書き込む件数
+	importUsersBatchSize = 500
+
+	// 取り込みの結果に含める, 取り込めなかった行の上限
+	maxImportUsersErrors = 1000
+
+	// 書き出しで 1 度に読み出す件数
+	exportUsersPageSize = 500
+)
+
+// errImportRolledBack は取り込みのトランザクションをロールバックさせるためのエラー. 呼び出し元には返さない
+var errImportRolledBack = errors.New("user import rolled back")
+
+// ImportUsers は rows を importUsersBatchSize 件ずつまとめて書き込み, 行ごとのイベントを outbox に, 監査ログを audit_events に書き込む
+// 全体を 1 つのトランザクションで実行し, dry run の場合と, OnDuplicate が fail で重複があった場合はロールバックする
+// 入力の誤り (row.Errors) と重複は結果として返す. rows がエラーを返した場合 (本文の読み込みの失敗等) はロールバックしてそのエラーを返す
+func (p *Handler) ImportUsers(ctx context.Context, params models.ImportUsersParams, rows iter.Seq2[*models.UserImportRow, error]) (*models.UserImportResult, error) {
+
+	if params.OnDuplicate == "" {
+		params.OnDuplicate = models.UserImportOnDuplicateFail
+	}
+	result := &models.UserImportResult{
+		DryRun:      params.DryRun,
+		OnDuplicate: params.OnDuplicate,
+		Errors:      []models.UserImportRowError{},
+	}
+
+	err := p.dbHandler.RunInTx(ctx, func(ctx context.Context) error {
+		batch := &userImportBatch{emails: map[string]bool{}}
+		duplicates := 0
+		for row, err := range rows {
+			if err != nil {
+				return err
+			}
+			result.Total++
+
+			if len(row.Errors) > 0 {
+				addImportUsersError(result, models.UserImportRowError{
+					Line:   row.Line,
+					Status: models.UserImportRowErrorStatusInvalid,
+					Errors: row.Errors,
+				})
+				continue
+			}
+
+			// 同じ email の行を 1 つの INSERT に含めない (後の行は先の行との重複として扱う)
+			if batch.emails[row.Email] || len(batch.prototypes) >= importUsersBatchSize {
+				n, err := p.flushImportUsersBatch(ctx, params, batch, result)
+				if err != nil {
+					return err
+				}
+				duplicates += n
+			}
+
+			uuidV7, err := uuid.NewV7()
+			if err != nil {
+				return cerrors.ErrSystemInternal.New(
+					cerrors.WithCause(err),
+					cerrors.WithMessage("faild to negerate a new uuid v7"),
+				)
+			}
+			batch.add(row.Line, &models.UserPrototype{
+				ID:    uuidV7,
+				Name:  row.Name,
+				Email: row.Email,
+			})
+		}
+		n, err := p.flushImportUsersBatch(ctx, params, batch, result)
+		if err != nil {
+			return err
+		}
+		duplicates += n
+
+		if params.DryRun || (params.OnDuplicate == models.UserImportOnDuplicateFail && duplicates > 0) {
+			return cerrors.ErrInvalidState.New(
+				cerrors.WithCause(errImportRolledBack),
+			)
+		}
+		return nil
+	})
+	// 重複はまとめて書き込んだ時に分かるため, 行の順に並べ直す
+	slices.SortStableFunc(result.Errors, func(a, b models.UserImportRowError) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+
+	switch {
+	case errors.Is(err, errImportRolledBack):
+		// dry run または重複による取り消し
+	case err != nil:
+		return nil, err
+	default:
+		result.Committed = true
+	}
+	return result, nil
+}
+
+// userImportBatch はまとめて書き込む行
+type userImportBatch struct {
+	lines      []int
+	prototypes []*models.UserPrototype
+	emails     map[string]bool
+}
+
+func (b *userImportBatch) add(line int, prototype *models.UserPrototype) {
+	b.lines = append(b.lines, line)
+	b.prototypes = append(b.prototypes, prototype)
+	b.emails[prototype.Email] = true
+}
+
+func (b *userImportBatch) reset() {
+	b.lines = b.lines[:0]
+	b.prototypes = b.prototypes[:0]
+	clear(b.emails)
+}
+
+// flushImportUsersBatch は batch を書き込んで結果に数え, 重複して書き込まなかった行の数を返す
+func (p *Handler) flushImportUsersBatch(ctx context.Context, params models.ImportUsersParams, batch *userImportBatch, result *models.UserImportResult) (int, error) {
+
+	if len(batch.prototypes) == 0 {
+		return 0, nil
+	}
+	defer batch.reset()
+
+	created, updated, err := p.dbHandler.ImportUsers(ctx, batch.prototypes, params.OnDuplicate == models.UserImportOnDuplicateUpdate)
+	if err != nil {
+		return 0, err
+	}
+
+	written := make(map[string]bool, len(created)+len(updated))
+	for _, user := range created {
+		written[user.Email] = true
+		if err := p.appendUserEvent(ctx, models.EventTypeUserCreated, user); err != nil {
+			return 0, err
+		}
+		if err := p.appendUserAuditEvent(ctx, models.AuditActionCreate, nil, user); err != nil {
+			return 0, err
+		}
+	}
+	for _, update := range updated {
+		written[update.After.Email] = true
+		if err := p.appendUserEvent(ctx, models.EventTypeUserUpdated, update.After); err != nil {
+			return 0, err
+		}
+		if err := p.appendUserAuditEvent(ctx, models.AuditActionUpdate, update.Before, update.After); err != nil {
+			return 0, err
+		}
+	}
+	result.Created += len(created)
+	result.Updated += len(updated)
+
+	// 書き込まなかった行は既存のユーザーとの重複
+	duplicates := 0
+	for i, prototype := range batch.prototypes {
+		if written[prototype.Email] {
+			continue
+		}
+		duplicates++
+		if params.OnDuplicate != models.UserImportOnDuplicateFail {
+			result.Skipped++
+			continue
+		}
+		addImportUsersError(result, models.UserImportRowError{
+			Line:   batch.lines[i],
+			Status: models.UserImportRowErrorStatusDuplicate,
+			Errors: []models.FieldError{{Name: "email", Reason: "is already used"}},
+		})
+	}
+	return duplicates, nil
+}
+
+// addImportUsersError は取り込めなかった行を数え, 上限まで結果に含める
+func addImportUsersError(result *models.UserImportResult, rowError models.UserImportRowError) {
+	result.Failed++
+	if len(result.Errors) >= maxImportUsersErrors {
+		result.ErrorsTruncated = true
+		return
+	}
+	result.Errors = append(result.Errors, rowError)
+}
+
+// ExportUsers は全てのユーザーを name, id の順に exportUsersPageSize 件ずつ読み出して fn に渡す. fn がエラーを返すと中断する
+// 1 ページずつ読み出すため, 件数に関わらず使うメモリは一定
+func (p *Handler) ExportUsers(ctx context.Context, fn func(users []*models.User) error) error {
+
+	params := models.ListUsersAfterParams{Limit: exportUsersPageSize}
+	for {
+		users, err := p.dbHandler.ListUsersAfter(ctx, params)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			if err := fn(users); err != nil {
+				return err
+			}
+		}
+		if len(users) < params.Limit {
+			return nil
+		}
+		last := users[len(users)-1]
+		params.AfterName, params.AfterID = last.Name, last.ID
+	}
+}
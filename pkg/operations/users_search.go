@@ -0,0 +1,113 @@
+// pkg/operations/users_search.go
+package operations
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// 検索結果の件数の既定値と上限
+const (
+	defaultSearchUsersLimit = 20
+	maxSearchUsersLimit     = 100
+)
+
+// SearchUsers は params.Query に一致するユーザーを関連度の高い順に返し, 検索語と一致した箇所を強調する
+func (p *Handler) SearchUsers(ctx context.Context, params models.SearchUsersParams) ([]*models.UserSearchResult, error) {
+
+	params.Query = strings.TrimSpace(params.Query)
+	switch {
+	case params.Limit <= 0:
+		params.Limit = defaultSearchUsersLimit
+	case params.Limit > maxSearchUsersLimit:
+		params.Limit = maxSearchUsersLimit
+	}
+
+	if params.Query == "" {
+		return []*models.UserSearchResult{}, nil
+	}
+
+	results, err := p.dbHandler.SearchUsers(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(params.Query)
+	for _, result := range results {
+		result.Highlights = models.UserSearchHighlights{
+			Name:  highlight(result.User.Name, terms),
+			Email: highlight(result.User.Email, terms),
+		}
+	}
+	return results, nil
+}
+
+// searchTerms は検索語を強調する語に分ける. websearch_to_tsquery の構文 (引用符, 除外の '-', or) は語として扱わない
+func searchTerms(query string) []string {
+	terms := []string{}
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") || strings.EqualFold(field, "or") {
+			continue
+		}
+		if term := strings.Trim(field, `"`); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// highlight は text のうち terms のいずれかと一致する (大文字小文字を区別しない) 箇所を <mark> で囲み, その他を HTML エスケープして返す
+// 一致する箇所が無ければ空を返す
+func highlight(text string, terms []string) string {
+
+	// 一致する箇所 (重なるものはまとめる)
+	marked := make([]bool, len(text))
+	found := false
+	for i := 0; i < len(text); {
+		for _, term := range terms {
+			if n, ok := hasPrefixFold(text[i:], term); ok {
+				for j := i; j < i+n; j++ {
+					marked[j] = true
+				}
+				found = true
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	if !found {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		j := i
+		for j < len(text) && marked[j] == marked[i] {
+			j++
+		}
+		if marked[i] {
+			b.WriteString("<mark>" + html.EscapeString(text[i:j]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(text[i:j]))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// hasPrefixFold は s が prefix で始まるか (大文字小文字を区別しない) と, s での prefix の長さ (バイト数) を返す
+func hasPrefixFold(s string, prefix string) (int, bool) {
+	n := 0
+	for _, want := range prefix {
+		got, size := utf8.DecodeRuneInString(s[n:])
+		if size == 0 || !strings.EqualFold(string(got), string(want)) {
+			return 0, false
+		}
+		n += size
+	}
+	return n, n > 0
+}
@@ -0,0 +1,108 @@
+// pkg/operations/webhooks.go
+package operations
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// 配信履歴の取得件数の既定値と上限
+const (
+	defaultWebhookDeliveriesLimit = 50
+	maxWebhookDeliveriesLimit     = 100
+)
+
+func (p *Handler) ListWebhooks(ctx context.Context) ([]*models.Webhook, error) {
+
+	return p.dbHandler.ListWebhooks(ctx)
+}
+
+// CreateWebhook は webhook を登録する. 配信先の URL が WithWebhookURLPolicy の条件を満たさない場合は ErrValidation
+func (p *Handler) CreateWebhook(ctx context.Context, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+
+	if err := p.webhookURLPolicy.Validate(prototype.URL); err != nil {
+		return nil, err
+	}
+
+	uuidV7, err := uuid.NewV7()
+	if err != nil {
+		return nil, cerrors.ErrSystemInternal.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("faild to negerate a new uuid v7"),
+		)
+	}
+	prototype.ID = uuidV7
+
+	return p.dbHandler.CreateWebhook(ctx, prototype)
+}
+
+func (p *Handler) GetWebhook(ctx context.Context, webhookID uuid.UUID) (*models.Webhook, error) {
+
+	return p.dbHandler.GetWebhook(ctx, webhookID)
+}
+
+// UpdateWebhook は webhook を更新する. 配信先の URL は CreateWebhook と同じく確認する
+func (p *Handler) UpdateWebhook(ctx context.Context, webhookID uuid.UUID, prototype *models.WebhookPrototype) (*models.Webhook, error) {
+
+	if err := p.webhookURLPolicy.Validate(prototype.URL); err != nil {
+		return nil, err
+	}
+
+	prototype.ID = webhookID
+
+	return p.dbHandler.UpdateWebhook(ctx, webhookID, prototype)
+}
+
+func (p *Handler) DeleteWebhook(ctx context.Context, webhookID uuid.UUID) error {
+
+	return p.dbHandler.DeleteWebhook(ctx, webhookID)
+}
+
+// ListWebhookDeliveries は webhook の配信履歴を新しい順に返す. webhook が存在しない場合は ErrDBNotFound
+func (p *Handler) ListWebhookDeliveries(ctx context.Context, webhookID uuid.UUID, params models.ListWebhookDeliveriesParams) ([]*models.WebhookDelivery, error) {
+
+	if _, err := p.dbHandler.GetWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case params.Limit <= 0:
+		params.Limit = defaultWebhookDeliveriesLimit
+	case params.Limit > maxWebhookDeliveriesLimit:
+		params.Limit = maxWebhookDeliveriesLimit
+	}
+	return p.dbHandler.ListWebhookDeliveries(ctx, webhookID, params)
+}
+
+func (p *Handler) GetWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+
+	return p.dbHandler.GetWebhookDelivery(ctx, webhookID, deliveryID)
+}
+
+// RedeliverWebhookDelivery は配信を直ちに再送させる
+// 無効になっている webhook の配信は再送できない (ErrInvalidState). 先に webhook を有効に戻す必要がある
+func (p *Handler) RedeliverWebhookDelivery(ctx context.Context, webhookID uuid.UUID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+
+	var delivery *models.WebhookDelivery
+	err := p.dbHandler.RunInTx(ctx, func(ctx context.Context) error {
+		webhook, err := p.dbHandler.GetWebhook(ctx, webhookID)
+		if err != nil {
+			return err
+		}
+		if !webhook.Enabled {
+			return cerrors.ErrInvalidState.New(
+				cerrors.WithMessagef("webhook %s is disabled", webhookID),
+			)
+		}
+		delivery, err = p.dbHandler.RedeliverWebhookDelivery(ctx, webhookID, deliveryID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
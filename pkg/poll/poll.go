@@ -0,0 +1,53 @@
+package poll
+
+import (
+	"context"
+	"time"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// 失敗が続いた場合に次の呼び出しまで空ける時間の上限 (interval の方が長い場合は interval)
+const maxPollBackoff = time.Minute
+
+// Run は ctx がキャンセルされるまで runOnce を繰り返し呼ぶ. runOnce は処理した件数を返す
+// batchSize 件以上処理できた場合はまだ残っていそうなため待たずに続け, それ以外は interval 待つ
+// 失敗が続く場合は interval から倍々に maxPollBackoff まで間隔を空け, 失敗と次の呼び出しまでの時間を onError に渡す (ctx のキャンセルによる失敗は渡さない)
+// outbox の relay や webhook の配信のように, DB をポーリングして1バッチずつ処理するループに使う
+func Run(ctx context.Context, interval time.Duration, batchSize int, runOnce func(ctx context.Context) (int, error), onError func(err error, retryIn time.Duration)) {
+
+	backoff := models.RetryPolicy{
+		InitialBackoff: interval,
+		MaxBackoff:     max(interval, maxPollBackoff),
+	}
+	failures := 0
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		n, err := runOnce(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			failures++
+			wait, _ := backoff.Next(failures)
+			if onError != nil {
+				onError(err, wait)
+			}
+			timer.Reset(wait)
+		case n >= batchSize:
+			failures = 0
+			timer.Reset(0)
+		default:
+			failures = 0
+			timer.Reset(interval)
+		}
+	}
+}
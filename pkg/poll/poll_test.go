@@ -0,0 +1,66 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 1回目は1バッチ分 (待たずに続ける), 2回目と3回目は失敗 (間隔を倍にする), 4回目は残り, 5回目で止める
+	results := []struct {
+		n   int
+		err error
+	}{
+		{n: 10},
+		{err: errors.New("connection refused")},
+		{err: errors.New("connection refused")},
+		{n: 3},
+	}
+	var calls []time.Time
+	var retryIns []time.Duration
+	runOnce := func(ctx context.Context) (int, error) {
+		calls = append(calls, time.Now())
+		if len(calls) > len(results) {
+			cancel()
+			return 0, ctx.Err()
+		}
+		r := results[len(calls)-1]
+		return r.n, r.err
+	}
+	onError := func(err error, retryIn time.Duration) {
+		retryIns = append(retryIns, retryIn)
+	}
+
+	const interval = 50 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, interval, 10, runOnce, onError)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after cancel")
+	}
+
+	if len(calls) != 5 {
+		t.Fatalf("calls = %d, want 5", len(calls))
+	}
+	if len(retryIns) != 2 || retryIns[0] != interval || retryIns[1] != 2*interval {
+		t.Errorf("retry_in = %v, want [%s %s] (the error after cancel is not reported)", retryIns, interval, 2*interval)
+	}
+	if gap := calls[1].Sub(calls[0]); gap >= interval {
+		t.Errorf("gap after a full batch = %s, want less than %s", gap, interval)
+	}
+	if gap := calls[3].Sub(calls[2]); gap < 2*interval {
+		t.Errorf("gap after the second failure = %s, want at least %s", gap, 2*interval)
+	}
+	if gap := calls[4].Sub(calls[3]); gap < interval {
+		t.Errorf("gap after a partial batch = %s, want at least %s", gap, interval)
+	}
+}
@@ -0,0 +1,238 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// State はサーキットブレーカーの状態
+type State int
+
+const (
+	StateClosed   State = iota // 依存先を呼ぶ
+	StateOpen                  // 依存先を呼ばずに断る
+	StateHalfOpen              // 一部の呼び出しで依存先の回復を試す
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// 失敗率を数える期間を分割する数. 期間の古い側から 1/windowBuckets ずつ捨てる
+const windowBuckets = 10
+
+// half-open で試す枠を使い切った呼び出しに返す Retry-After
+const halfOpenRetryAfter = time.Second
+
+type BreakerConfig struct {
+	// 失敗率を数える期間
+	Window time.Duration
+
+	// 失敗率を判定する最小の呼び出し数
+	MinRequests int
+
+	// open にする失敗率 (0 < FailureRate <= 1)
+	FailureRate float64
+
+	// open を続ける時間. 過ぎると half-open にする
+	OpenDuration time.Duration
+
+	// half-open で試す呼び出しの数. 全て成功すれば closed にする
+	HalfOpenMaxRequests int
+}
+
+// bucket は期間の一部での呼び出しの結果の数
+type bucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// CircuitBreaker は直近 Window の失敗率が FailureRate 以上になると open にし, OpenDuration の間は依存先を呼ばずに断る
+// その後 half-open で HalfOpenMaxRequests 件を試し, 全て成功すれば closed に, 1 件でも失敗すれば open に戻す
+type CircuitBreaker struct {
+	name   string
+	config BreakerConfig
+	now    func() time.Time
+
+	// onStateChange は状態が変わると (ロックを持ったまま) 呼ばれる
+	onStateChange func(from State, to State)
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	buckets  [windowBuckets]bucket
+
+	// generation は状態が変わる度に増やす. 前の状態で始めた呼び出しの結果を数えないため
+	generation uint64
+
+	// half-open で始めた呼び出しと成功した呼び出しの数
+	halfOpenRequests  int
+	halfOpenSuccesses int
+}
+
+func NewCircuitBreaker(name string, config BreakerConfig) (*CircuitBreaker, error) {
+	if config.Window <= 0 || config.MinRequests <= 0 || config.FailureRate <= 0 || config.FailureRate > 1 ||
+		config.OpenDuration <= 0 || config.HalfOpenMaxRequests <= 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid circuit breaker config: %s: window=%s, min_requests=%d, failure_rate=%v, open_duration=%s, half_open_max_requests=%d",
+				name, config.Window, config.MinRequests, config.FailureRate, config.OpenDuration, config.HalfOpenMaxRequests),
+		)
+	}
+	return &CircuitBreaker{
+		name:   name,
+		config: config,
+		now:    time.Now,
+	}, nil
+}
+
+// Name は依存先の名前を返す
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+// State は現在の状態を返す. open の期間を過ぎている場合は half-open を返す
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expireOpen(b.now())
+	return b.state
+}
+
+// openFor は open であれば, half-open になるまでの時間を返す
+func (b *CircuitBreaker) openFor() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.expireOpen(now)
+	if b.state != StateOpen {
+		return 0, false
+	}
+	return b.openedAt.Add(b.config.OpenDuration).Sub(now), true
+}
+
+// allow は呼び出しを始めてよいかを返す. 断る場合は Retry-After にする時間を返す
+// 始めた呼び出しは generation と共に done で結果を記録すること
+func (b *CircuitBreaker) allow() (generation uint64, retryAfter time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.expireOpen(now)
+
+	switch b.state {
+	case StateOpen:
+		return 0, b.openedAt.Add(b.config.OpenDuration).Sub(now), false
+	case StateHalfOpen:
+		if b.halfOpenRequests >= b.config.HalfOpenMaxRequests {
+			return 0, halfOpenRetryAfter, false
+		}
+		b.halfOpenRequests++
+	}
+	return b.generation, 0, true
+}
+
+// done は allow で始めた呼び出しの結果を記録する
+func (b *CircuitBreaker) done(generation uint64, failure bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	now := b.now()
+
+	switch b.state {
+	case StateClosed:
+		current := b.bucket(now)
+		if failure {
+			current.failures++
+		} else {
+			current.successes++
+		}
+		successes, failures := b.counts(now)
+		total := successes + failures
+		if total >= b.config.MinRequests && float64(failures) >= b.config.FailureRate*float64(total) {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failure {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.config.HalfOpenMaxRequests {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// cancel は allow で始めた呼び出しを結果を数えずに終える. half-open の試行枠を空ける
+func (b *CircuitBreaker) cancel(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == StateHalfOpen {
+		b.halfOpenRequests--
+	}
+}
+
+// expireOpen は open の期間を過ぎていれば half-open にする
+func (b *CircuitBreaker) expireOpen(now time.Time) {
+	if b.state == StateOpen && !now.Before(b.openedAt.Add(b.config.OpenDuration)) {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *CircuitBreaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.halfOpenRequests = 0
+	b.halfOpenSuccesses = 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.buckets = [windowBuckets]bucket{}
+	}
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+}
+
+// bucket は now を含むバケットを返す. 期間より古いバケットは空にして使い回す
+func (b *CircuitBreaker) bucket(now time.Time) *bucket {
+	width := b.config.Window / windowBuckets
+	start := now.Truncate(width)
+	current := &b.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	return current
+}
+
+// counts は直近 Window の成功と失敗の数を返す
+func (b *CircuitBreaker) counts(now time.Time) (successes int, failures int) {
+	since := now.Add(-b.config.Window)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(since) {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	return successes, failures
+}
@@ -0,0 +1,284 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// fakeClock はテストで進める時計
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestGuard(t *testing.T, config Config) (*Guard, *fakeClock) {
+	t.Helper()
+	g, err := NewGuard("postgres", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if g.breaker != nil {
+		g.breaker.now = clock.Now
+	}
+	return g, clock
+}
+
+var errDependency = cerrors.ErrDBOperation.New(cerrors.WithMessage("connection refused"))
+
+func call(g *Guard, err error) error {
+	return g.Do(context.Background(), func(ctx context.Context) error {
+		return err
+	})
+}
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	g, clock := newTestGuard(t, Config{Breaker: &BreakerConfig{
+		Window:              10 * time.Second,
+		MinRequests:         4,
+		FailureRate:         0.6,
+		OpenDuration:        5 * time.Second,
+		HalfOpenMaxRequests: 2,
+	}})
+	breaker := g.Breaker()
+
+	// 入力やデータによるエラーは失敗に数えない
+	_ = call(g, cerrors.ErrDBNotFound.New())
+	_ = call(g, cerrors.ErrDBDuplicate.New())
+	_ = call(g, nil)
+	for range 3 {
+		_ = call(g, errDependency)
+	}
+	if got := breaker.State(); got != StateClosed {
+		t.Fatalf("state after 3/6 failures = %s; want closed below 60%%", got)
+	}
+	clock.Advance(time.Second)
+	_ = call(g, errDependency)
+	if got := breaker.State(); got != StateClosed {
+		t.Fatalf("state after 4/7 failures = %s; want closed below 60%%", got)
+	}
+	_ = call(g, errDependency)
+	if got := breaker.State(); got != StateOpen {
+		t.Fatalf("state after 5/8 failures = %s; want open", got)
+	}
+
+	// open の間は呼ばずに断る
+	called := false
+	err := g.Do(context.Background(), func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	rejected, ok := Rejected(err)
+	if called || !ok || rejected.Reason != ReasonCircuitOpen || rejected.RetryAfter != 5*time.Second {
+		t.Fatalf("Do() while open = %v (called=%v); want circuit_open with retry after 5s", err, called)
+	}
+	if code := errorCodeOf(err); code != "SERVICE_UNAVAILABLE" {
+		t.Errorf("error code = %q; want SERVICE_UNAVAILABLE", code)
+	}
+
+	// open の期間を過ぎると half-open で試す. 失敗すると open に戻る
+	clock.Advance(5 * time.Second)
+	if got := breaker.State(); got != StateHalfOpen {
+		t.Fatalf("state after open duration = %s; want half_open", got)
+	}
+	_ = call(g, errDependency)
+	if got := breaker.State(); got != StateOpen {
+		t.Fatalf("state after failed probe = %s; want open", got)
+	}
+
+	// 試行が全て成功すると closed に戻り, それまでの失敗は数えない
+	clock.Advance(5 * time.Second)
+	_ = call(g, nil)
+	if got := breaker.State(); got != StateHalfOpen {
+		t.Fatalf("state after 1 successful probe = %s; want half_open", got)
+	}
+	_ = call(g, nil)
+	if got := breaker.State(); got != StateClosed {
+		t.Fatalf("state after 2 successful probes = %s; want closed", got)
+	}
+	_ = call(g, errDependency)
+	if got := breaker.State(); got != StateClosed {
+		t.Fatalf("state after a failure on reset window = %s; want closed", got)
+	}
+}
+
+func TestCircuitBreaker_Window(t *testing.T) {
+	g, clock := newTestGuard(t, Config{Breaker: &BreakerConfig{
+		Window:              10 * time.Second,
+		MinRequests:         2,
+		FailureRate:         1,
+		OpenDuration:        time.Second,
+		HalfOpenMaxRequests: 1,
+	}})
+
+	// 最小の呼び出し数に達するまでは open にしない
+	_ = call(g, errDependency)
+	if got := g.Breaker().State(); got != StateClosed {
+		t.Fatalf("state after 1 failure = %s; want closed", got)
+	}
+
+	// 期間を過ぎた失敗は数えない
+	clock.Advance(11 * time.Second)
+	_ = call(g, errDependency)
+	if got := g.Breaker().State(); got != StateClosed {
+		t.Fatalf("state with failures in different windows = %s; want closed", got)
+	}
+	clock.Advance(time.Second)
+	_ = call(g, errDependency)
+	if got := g.Breaker().State(); got != StateOpen {
+		t.Fatalf("state with 2 failures in window = %s; want open", got)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenLimit(t *testing.T) {
+	g, clock := newTestGuard(t, Config{Breaker: &BreakerConfig{
+		Window:              10 * time.Second,
+		MinRequests:         1,
+		FailureRate:         1,
+		OpenDuration:        time.Second,
+		HalfOpenMaxRequests: 1,
+	}})
+	_ = call(g, errDependency)
+	clock.Advance(time.Second)
+
+	// 試行中は他の呼び出しを断る
+	probing := make(chan struct{})
+	finish := make(chan error)
+	done := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- g.Do(ctx, func(ctx context.Context) error {
+			close(probing)
+			return <-finish
+		})
+	}()
+	<-probing
+	if rejected, ok := Rejected(call(g, nil)); !ok || rejected.Reason != ReasonCircuitOpen {
+		t.Fatalf("Do() during probe = %v; want circuit_open", rejected)
+	}
+
+	// キャンセルされた試行は数えずに枠を空ける
+	cancel()
+	finish <- context.Canceled
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("probe error = %v; want context.Canceled", err)
+	}
+	if got := g.Breaker().State(); got != StateHalfOpen {
+		t.Fatalf("state after canceled probe = %s; want half_open", got)
+	}
+	if err := call(g, nil); err != nil {
+		t.Fatalf("Do() after canceled probe = %v; want nil", err)
+	}
+	if got := g.Breaker().State(); got != StateClosed {
+		t.Errorf("state after successful probe = %s; want closed", got)
+	}
+}
+
+func TestCircuitBreaker_CallerDeadline(t *testing.T) {
+	g, _ := newTestGuard(t, Config{Breaker: &BreakerConfig{
+		Window:              10 * time.Second,
+		MinRequests:         20,
+		FailureRate:         0.5,
+		OpenDuration:        10 * time.Second,
+		HalfOpenMaxRequests: 1,
+	}})
+
+	// クライアントが決めた短い deadline (Request-Timeout: 0.000001) で打ち切られた呼び出しは失敗に数えない
+	for range 40 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Microsecond)
+		ctx = WithClientDeadline(ctx)
+		err := g.Do(ctx, func(ctx context.Context) error {
+			<-ctx.Done()
+			return cerrors.ErrDBOperation.New(cerrors.WithCause(ctx.Err()))
+		})
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Do() = %v; want context.DeadlineExceeded", err)
+		}
+	}
+	if got := g.Breaker().State(); got != StateClosed {
+		t.Errorf("state after calls over the caller's deadline = %s; want closed", got)
+	}
+}
+
+func TestCircuitBreaker_ServerDeadline(t *testing.T) {
+	g, _ := newTestGuard(t, Config{Breaker: &BreakerConfig{
+		Window:              10 * time.Second,
+		MinRequests:         20,
+		FailureRate:         0.5,
+		OpenDuration:        10 * time.Second,
+		HalfOpenMaxRequests: 1,
+	}})
+
+	// 応答しない依存先がサーバー側の deadline (既定値や操作毎の上限) で打ち切られた呼び出しは失敗に数える
+	for range 20 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		err := g.Do(ctx, func(ctx context.Context) error {
+			<-ctx.Done()
+			return cerrors.ErrDBOperation.New(cerrors.WithCause(ctx.Err()))
+		})
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Do() = %v; want context.DeadlineExceeded", err)
+		}
+	}
+	if got := g.Breaker().State(); got != StateOpen {
+		t.Errorf("state after calls over the server's deadline = %s; want open", got)
+	}
+
+	// 呼び出し側のキャンセルは数えない
+	g, _ = newTestGuard(t, Config{Breaker: &BreakerConfig{
+		Window:              10 * time.Second,
+		MinRequests:         20,
+		FailureRate:         0.5,
+		OpenDuration:        10 * time.Second,
+		HalfOpenMaxRequests: 1,
+	}})
+	for range 40 {
+		ctx, cancel := context.WithCancel(context.Background())
+		err := g.Do(ctx, func(ctx context.Context) error {
+			cancel()
+			return cerrors.ErrDBOperation.New(cerrors.WithCause(ctx.Err()))
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Do() = %v; want context.Canceled", err)
+		}
+	}
+	if got := g.Breaker().State(); got != StateClosed {
+		t.Errorf("state after canceled calls = %s; want closed", got)
+	}
+}
+
+func TestGuard_Reentrant(t *testing.T) {
+	g, _ := newTestGuard(t, Config{Bulkhead: &BulkheadConfig{MaxConcurrent: 1}})
+
+	// トランザクションの中で同じ依存先を呼んでも枠を二重に取らない
+	err := g.Do(context.Background(), func(ctx context.Context) error {
+		return g.Do(ctx, func(ctx context.Context) error {
+			return nil
+		})
+	})
+	if err != nil {
+		t.Errorf("nested Do() = %v; want nil", err)
+	}
+}
+
+func TestNewGuard_InvalidConfig(t *testing.T) {
+	if _, err := NewGuard("postgres", Config{Breaker: &BreakerConfig{Window: time.Second, MinRequests: 1, FailureRate: 1.5, OpenDuration: time.Second, HalfOpenMaxRequests: 1}}); err == nil {
+		t.Error("NewGuard() with failure rate 1.5 succeeded; want error")
+	}
+	if _, err := NewGuard("postgres", Config{Bulkhead: &BulkheadConfig{MaxConcurrent: 0}}); err == nil {
+		t.Error("NewGuard() with max concurrent 0 succeeded; want error")
+	}
+}
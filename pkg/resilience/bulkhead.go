@@ -0,0 +1,76 @@
+package resilience
+
+import (
+	"context"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+type BulkheadConfig struct {
+	// 同時に実行できる呼び出しの数
+	MaxConcurrent int
+
+	// 空きを待つ時間の上限. 0 の場合は待たずに断る
+	MaxWait time.Duration
+}
+
+// Bulkhead は依存先への同時の呼び出しを MaxConcurrent に制限する
+// 依存先が遅くなっても, 待ちの呼び出しがコネクションや goroutine を使い切らないよう MaxWait を超えたら断る
+type Bulkhead struct {
+	name   string
+	config BulkheadConfig
+	slots  chan struct{}
+}
+
+func NewBulkhead(name string, config BulkheadConfig) (*Bulkhead, error) {
+	if config.MaxConcurrent <= 0 || config.MaxWait < 0 {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid bulkhead config: %s: max_concurrent=%d, max_wait=%s", name, config.MaxConcurrent, config.MaxWait),
+		)
+	}
+	return &Bulkhead{
+		name:   name,
+		config: config,
+		slots:  make(chan struct{}, config.MaxConcurrent),
+	}, nil
+}
+
+// Name は依存先の名前を返す
+func (b *Bulkhead) Name() string {
+	return b.name
+}
+
+// InFlight は実行中の呼び出しの数を返す
+func (b *Bulkhead) InFlight() int {
+	return len(b.slots)
+}
+
+// acquire は空きを待って確保する. 空かない場合は false, ctx が終わった場合は ctx のエラーを返す
+// 確保した場合は release を呼ぶこと
+func (b *Bulkhead) acquire(ctx context.Context) (bool, error) {
+
+	select {
+	case b.slots <- struct{}{}:
+		return true, nil
+	default:
+	}
+	if b.config.MaxWait <= 0 {
+		return false, nil
+	}
+
+	timer := time.NewTimer(b.config.MaxWait)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return true, nil
+	case <-timer.C:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (b *Bulkhead) release() {
+	<-b.slots
+}
@@ -0,0 +1,85 @@
+package resilience
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBulkhead(t *testing.T) {
+	m, err := NewMetrics("goapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGuard("valkey", Config{Bulkhead: &BulkheadConfig{MaxConcurrent: 2, MaxWait: 20 * time.Millisecond}}, WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 上限まで実行中にする
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 2)
+	for range 2 {
+		go func() {
+			done <- g.Do(context.Background(), func(ctx context.Context) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+		<-started
+	}
+
+	// 空きを待ちきれない呼び出しは断る
+	err = call(g, nil)
+	rejected, ok := Rejected(err)
+	if !ok || rejected.Reason != ReasonBulkheadFull || rejected.Dependency != "valkey" {
+		t.Fatalf("Do() when full = %v; want bulkhead_full", err)
+	}
+
+	// 待っている間に ctx が終わった場合は ctx のエラー
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := g.Do(ctx, func(ctx context.Context) error { return nil }); err == nil || errorCodeOf(err) != "TIMEOUT" {
+		t.Fatalf("Do() with expiring ctx = %v; want TIMEOUT", err)
+	}
+
+	want := `
+# HELP goapp_resilience_bulkhead_in_flight バルクヘッドの中で実行中の呼び出しの数. dependency (依存先) 別
+# TYPE goapp_resilience_bulkhead_in_flight gauge
+goapp_resilience_bulkhead_in_flight{dependency="valkey"} 2
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want), "goapp_resilience_bulkhead_in_flight"); err != nil {
+		t.Error(err)
+	}
+
+	// 空きができると待っていた呼び出しが実行される
+	waiting := make(chan error)
+	go func() {
+		waiting <- g.Do(context.Background(), func(ctx context.Context) error { return nil })
+	}()
+	release <- struct{}{}
+	if err := <-waiting; err != nil {
+		t.Errorf("Do() after release = %v; want nil", err)
+	}
+	close(release)
+	for range 2 {
+		if err := <-done; err != nil {
+			t.Errorf("Do() = %v; want nil", err)
+		}
+	}
+
+	wantCalls := `
+# HELP goapp_resilience_calls_total 依存先の呼び出し回数. dependency (依存先), result (success/failure/circuit_open/bulkhead_full) 別
+# TYPE goapp_resilience_calls_total counter
+goapp_resilience_calls_total{dependency="valkey",result="bulkhead_full"} 1
+goapp_resilience_calls_total{dependency="valkey",result="success"} 3
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(wantCalls), "goapp_resilience_calls_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,88 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// 呼び出しを断った理由
+const (
+	ReasonCircuitOpen  = "circuit_open"  // サーキットブレーカーが open (または half-open の試行枠が埋まっている)
+	ReasonBulkheadFull = "bulkhead_full" // 同時実行数の上限で空きを待ちきれなかった
+)
+
+// RejectedError は依存先を呼ばずに断ったことを表す. cerrors.ErrServiceUnavailable の cause になる
+type RejectedError struct {
+	Dependency string
+	Reason     string
+
+	// 再試行までに待つ時間の目安
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s call rejected: %s (retry after %s)", e.Dependency, e.Reason, e.RetryAfter)
+}
+
+func newRejectedError(dependency string, reason string, retryAfter time.Duration) error {
+	return cerrors.ErrServiceUnavailable.New(
+		cerrors.WithCause(&RejectedError{
+			Dependency: dependency,
+			Reason:     reason,
+			RetryAfter: retryAfter,
+		}),
+		cerrors.WithMessagef("%s is temporarily unavailable", dependency),
+	)
+}
+
+// Rejected は err が依存先を呼ばずに断ったものであれば, その RejectedError を返す
+func Rejected(err error) (*RejectedError, bool) {
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		return rejected, true
+	}
+	return nil, false
+}
+
+// 依存先の障害ではなく, 呼び出し側の入力やデータによるエラー. サーキットブレーカーの失敗に数えない
+var expectedErrorCodes = map[string]bool{
+	errorCodeOf(cerrors.ErrDBNotFound.New()):       true,
+	errorCodeOf(cerrors.ErrDBDuplicate.New()):      true,
+	errorCodeOf(cerrors.ErrDBConstraint.New()):     true,
+	errorCodeOf(cerrors.ErrAuthentication.New()):   true,
+	errorCodeOf(cerrors.ErrAuthorization.New()):    true,
+	errorCodeOf(cerrors.ErrTokenExpired.New()):     true,
+	errorCodeOf(cerrors.ErrTokenInvalid.New()):     true,
+	errorCodeOf(cerrors.ErrValidation.New()):       true,
+	errorCodeOf(cerrors.ErrInvalidFormat.New()):    true,
+	errorCodeOf(cerrors.ErrMissingField.New()):     true,
+	errorCodeOf(cerrors.ErrInvalidState.New()):     true,
+	errorCodeOf(cerrors.ErrBusinessRule.New()):     true,
+	errorCodeOf(cerrors.ErrInvalidOperation.New()): true,
+	errorCodeOf(cerrors.ErrResourceNotFound.New()): true,
+}
+
+// IsFailure は err を依存先の障害としてサーキットブレーカーの失敗に数えるかを返す
+// 呼び出し側のキャンセル, 入力やデータによるエラー, 内側の Guard が断ったエラーは数えない
+// クライアントが決めた deadline (WithClientDeadline) を超えたものは Guard.Do が数えない
+func IsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if _, ok := Rejected(err); ok {
+		return false
+	}
+	return !expectedErrorCodes[errorCodeOf(err)]
+}
+
+func errorCodeOf(err error) string {
+	var cerr *cerrors.CustomError
+	if errors.As(err, &cerr) {
+		return cerr.Code()
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+type Config struct {
+	// nil の場合はサーキットブレーカーを使わない
+	Breaker *BreakerConfig
+
+	// nil の場合は同時実行数を制限しない
+	Bulkhead *BulkheadConfig
+}
+
+type guardOptions struct {
+	metrics *Metrics
+}
+
+type GuardOption func(*guardOptions)
+
+// WithMetrics はサーキットブレーカーの状態と呼び出しの結果を metrics に記録する
+func WithMetrics(metrics *Metrics) GuardOption {
+	return func(o *guardOptions) {
+		o.metrics = metrics
+	}
+}
+
+// guardContextKey は Guard の中で実行中であることを示す context のキー
+type guardContextKey struct {
+	guard *Guard
+}
+
+// clientDeadlineContextKey は context の deadline をクライアントが決めたことを示す context のキー
+type clientDeadlineContextKey struct{}
+
+// WithClientDeadline は ctx の deadline をクライアントが (Request-Timeout ヘッダ等で) 決めたものとして印を付ける
+// 印の付いた deadline を超えた呼び出しは, サーキットブレーカーの成功にも失敗にも数えない
+func WithClientDeadline(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clientDeadlineContextKey{}, struct{}{})
+}
+
+// callerGaveUp は呼び出し側がキャンセルしたか, クライアントが決めた deadline を超えたかを返す
+// サーバー側で決めた deadline (既定値や操作毎の上限) を超えたものは依存先の遅延として扱うため含めない
+func callerGaveUp(ctx context.Context) bool {
+	switch err := ctx.Err(); {
+	case errors.Is(err, context.Canceled):
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return ctx.Value(clientDeadlineContextKey{}) != nil
+	default:
+		return false
+	}
+}
+
+// Guard は1つの依存先 (Postgres, Valkey 等) への呼び出しをサーキットブレーカーとバルクヘッドで保護する
+type Guard struct {
+	name     string
+	breaker  *CircuitBreaker
+	bulkhead *Bulkhead
+	metrics  *Metrics
+}
+
+func NewGuard(name string, config Config, options ...GuardOption) (*Guard, error) {
+
+	o := &guardOptions{}
+	for _, option := range options {
+		option(o)
+	}
+
+	g := &Guard{
+		name:    name,
+		metrics: o.metrics,
+	}
+	if config.Breaker != nil {
+		breaker, err := NewCircuitBreaker(name, *config.Breaker)
+		if err != nil {
+			return nil, err
+		}
+		breaker.onStateChange = func(_ State, to State) {
+			g.metrics.observeState(name, to, true)
+		}
+		g.breaker = breaker
+		g.metrics.observeState(name, StateClosed, false)
+	}
+	if config.Bulkhead != nil {
+		bulkhead, err := NewBulkhead(name, *config.Bulkhead)
+		if err != nil {
+			return nil, err
+		}
+		g.bulkhead = bulkhead
+		g.metrics.observeInFlight(name, 0)
+	}
+	return g, nil
+}
+
+// Name は依存先の名前を返す
+func (g *Guard) Name() string {
+	return g.name
+}
+
+// Breaker はサーキットブレーカーを返す. 使わない場合 (g が nil の場合も) は nil
+func (g *Guard) Breaker() *CircuitBreaker {
+	if g == nil {
+		return nil
+	}
+	return g.breaker
+}
+
+// Do は fn を保護して実行する. 断った場合は fn を呼ばずに cerrors.ErrServiceUnavailable (cause は RejectedError) を返す
+// fn の中 (RunInTx のトランザクション等) で同じ Guard を通る呼び出しは, 枠を二重に取らないようそのまま実行する
+func (g *Guard) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	if g == nil || ctx.Value(guardContextKey{g}) != nil {
+		return fn(ctx)
+	}
+
+	// open の間はバルクヘッドの空きを待たずに断る
+	if g.breaker != nil {
+		if retryAfter, open := g.breaker.openFor(); open {
+			return g.reject(ctx, ReasonCircuitOpen, retryAfter)
+		}
+	}
+
+	if g.bulkhead != nil {
+		ok, err := g.bulkhead.acquire(ctx)
+		if err != nil {
+			return cerrors.ErrTimeout.New(
+				cerrors.WithCause(err),
+				cerrors.WithMessagef("gave up waiting for %s", g.name),
+			)
+		}
+		if !ok {
+			return g.reject(ctx, ReasonBulkheadFull, g.bulkhead.config.MaxWait)
+		}
+		g.metrics.observeInFlight(g.name, g.bulkhead.InFlight())
+		defer func() {
+			g.bulkhead.release()
+			g.metrics.observeInFlight(g.name, g.bulkhead.InFlight())
+		}()
+	}
+
+	var generation uint64
+	if g.breaker != nil {
+		var retryAfter time.Duration
+		var ok bool
+		generation, retryAfter, ok = g.breaker.allow()
+		if !ok {
+			return g.reject(ctx, ReasonCircuitOpen, retryAfter)
+		}
+	}
+
+	// fn が panic した場合も失敗として記録する. 記録しないと half-open の試行枠が空かない
+	failure, canceled := true, false
+	defer func() {
+		if g.breaker != nil {
+			if canceled {
+				g.breaker.cancel(generation)
+			} else {
+				g.breaker.done(generation, failure)
+			}
+		}
+		result := resultSuccess
+		if failure {
+			result = resultFailure
+		}
+		g.metrics.observeCall(ctx, g.name, result)
+	}()
+
+	err := fn(context.WithValue(ctx, guardContextKey{g}, struct{}{}))
+
+	// 呼び出し側がキャンセルした場合やクライアントが決めた deadline を超えた場合は, 依存先の状態が分からないため成功にも失敗にも数えない
+	// クライアントの deadline (Request-Timeout ヘッダ) を数えると, 誰でもサーキットブレーカーを open にできてしまう
+	canceled = err != nil && callerGaveUp(ctx)
+	failure = !canceled && IsFailure(err)
+	return err
+}
+
+func (g *Guard) reject(ctx context.Context, reason string, retryAfter time.Duration) error {
+	g.metrics.observeCall(ctx, g.name, reason)
+	return newRejectedError(g.name, reason, retryAfter)
+}
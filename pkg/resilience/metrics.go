@@ -0,0 +1,148 @@
+package resilience
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+const instrumentationName = "github.com/aazw/go-base/pkg/resilience"
+
+// 呼び出しの結果 (result ラベル)
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// Metrics はサーキットブレーカーの状態と呼び出しの結果を Prometheus と OTel の両方に記録する
+type Metrics struct {
+	// Prometheus
+	state    *prometheus.GaugeVec
+	calls    *prometheus.CounterVec
+	inFlight *prometheus.GaugeVec
+
+	// OTel
+	otelCalls       metric.Int64Counter
+	otelTransitions metric.Int64Counter
+}
+
+// NewMetrics は Metrics を生成する. namespace は Prometheus のメトリクス名の接頭辞
+func NewMetrics(namespace string) (*Metrics, error) {
+
+	m := &Metrics{
+		state: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "resilience",
+				Name:      "circuit_breaker_state",
+				Help:      "サーキットブレーカーの状態. dependency (依存先) 毎に現在の state (closed/open/half_open) が 1",
+			},
+			[]string{"dependency", "state"},
+		),
+		calls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "resilience",
+				Name:      "calls_total",
+				Help:      "依存先の呼び出し回数. dependency (依存先), result (success/failure/circuit_open/bulkhead_full) 別",
+			},
+			[]string{"dependency", "result"},
+		),
+		inFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "resilience",
+				Name:      "bulkhead_in_flight",
+				Help:      "バルクヘッドの中で実行中の呼び出しの数. dependency (依存先) 別",
+			},
+			[]string{"dependency"},
+		),
+	}
+
+	var err error
+	meter := otel.Meter(instrumentationName)
+	m.otelCalls, err = meter.Int64Counter(
+		"resilience.calls",
+		metric.WithDescription("Number of dependency calls by dependency and result."),
+		metric.WithUnit("{call}"),
+	)
+	if err != nil {
+		return nil, newMetricsError(err)
+	}
+	m.otelTransitions, err = meter.Int64Counter(
+		"resilience.circuit_breaker.transitions",
+		metric.WithDescription("Number of circuit breaker state transitions by dependency and new state."),
+		metric.WithUnit("{transition}"),
+	)
+	if err != nil {
+		return nil, newMetricsError(err)
+	}
+
+	return m, nil
+}
+
+// observeCall は1回の呼び出しの結果を記録する
+func (m *Metrics) observeCall(ctx context.Context, dependency string, result string) {
+	if m == nil {
+		return
+	}
+	m.calls.WithLabelValues(dependency, result).Inc()
+	m.otelCalls.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("dependency", dependency),
+		attribute.String("result", result),
+	))
+}
+
+// observeState はサーキットブレーカーの現在の状態を記録する. transition が true の場合は状態の遷移も数える
+func (m *Metrics) observeState(dependency string, state State, transition bool) {
+	if m == nil {
+		return
+	}
+	for _, s := range []State{StateClosed, StateOpen, StateHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		m.state.WithLabelValues(dependency, s.String()).Set(value)
+	}
+	if transition {
+		m.otelTransitions.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("dependency", dependency),
+			attribute.String("state", state.String()),
+		))
+	}
+}
+
+// observeInFlight はバルクヘッドの中で実行中の呼び出しの数を記録する
+func (m *Metrics) observeInFlight(dependency string, inFlight int) {
+	if m == nil {
+		return
+	}
+	m.inFlight.WithLabelValues(dependency).Set(float64(inFlight))
+}
+
+// Describe は prometheus.Collector の実装
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.state.Describe(ch)
+	m.calls.Describe(ch)
+	m.inFlight.Describe(ch)
+}
+
+// Collect は prometheus.Collector の実装
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.state.Collect(ch)
+	m.calls.Collect(ch)
+	m.inFlight.Collect(ch)
+}
+
+func newMetricsError(err error) error {
+	return cerrors.ErrSystemInternal.New(
+		cerrors.WithCause(err),
+		cerrors.WithMessage("failed to create resilience metrics instrument"),
+	)
+}
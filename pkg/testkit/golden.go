@@ -0,0 +1,83 @@
+package testkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testkit を使うパッケージで go test -update を実行するとゴールデンファイルを書き換える (例: go test ./pkg/api/ -update)
+var update = flag.Bool("update", false, "update golden files under testdata")
+
+// 実行毎に変わる値. ゴールデンファイルでは固定の値に置き換える
+var volatileKeys = map[string]string{
+	"trace_id": "<trace_id>",
+}
+
+// AssertGolden は JSON の本文 (主に problem details) が testdata/<name>.golden と一致するかを確認する
+// キーの順序と空白は正規化し, trace_id 等の実行毎に変わる値は置き換えてから比較する
+func AssertGolden(t testing.TB, name string, body []byte) {
+	t.Helper()
+
+	got, err := normalizeJSON(body)
+	if err != nil {
+		t.Fatalf("testkit: body is not valid json: %v\nbody: %s", err, body)
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("testkit: failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("testkit: body does not match %s (run with -update to accept)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func normalizeJSON(body []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	maskVolatile(v)
+
+	// map は encoding/json がキーの順に出力する
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func maskVolatile(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if masked, ok := volatileKeys[k]; ok {
+				v[k] = masked
+				continue
+			}
+			maskVolatile(child)
+		}
+	case []any:
+		for _, child := range v {
+			maskVolatile(child)
+		}
+	}
+}
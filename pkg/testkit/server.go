@@ -0,0 +1,195 @@
+// Package testkit は API の E2E テスト用のハーネス
+//
+// 本番と同じミドルウェアを組み込んだルーター (api.NewRouter) をメモリ上の依存先で組み立て,
+// OpenAPI の定義から生成したクライアントでプロセス内から呼び出す. 全てのレスポンスを定義 (スキーマとステータスコード) と照合し,
+// 定義に無いステータスコードやスキーマに合わない本文を返した場合はテストを失敗させる
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+
+	"github.com/aazw/go-base/pkg/api"
+	"github.com/aazw/go-base/pkg/api/openapi"
+	"github.com/aazw/go-base/pkg/config"
+	"github.com/aazw/go-base/pkg/db/memory"
+	"github.com/aazw/go-base/pkg/operations"
+)
+
+// BaseURL は Server に送るリクエストの宛先. リクエストはネットワークを通らずルーターに直接渡す
+// Server.Do を他のクライアントから使う場合もこの宛先に送る
+const BaseURL = "http://testkit.invalid"
+
+// Server はメモリ上の依存先で動く API
+type Server struct {
+	// Router は本番と同じミドルウェアを組み込んだルーター
+	Router *gin.Engine
+	// DB は API が使う db.Handler. テストの前提となるデータの投入や結果の確認に使う
+	DB *memory.Handler
+	// Client は OpenAPI の定義から生成したクライアント. レスポンスは全て定義と照合する
+	Client *openapi.ClientWithResponses
+
+	t          testing.TB
+	specRouter routers.Router
+}
+
+type serverOptions struct {
+	configure      []func(cfg *config.Config)
+	healthCheckers []api.HealthChecker
+	logger         *slog.Logger
+}
+
+type Option func(*serverOptions)
+
+// WithConfig は config.NewConfig() の既定値から設定を変更する
+func WithConfig(configure func(cfg *config.Config)) Option {
+	return func(o *serverOptions) {
+		o.configure = append(o.configure, configure)
+	}
+}
+
+// WithHealthCheckers は readiness チェックで確認する依存先を指定する
+func WithHealthCheckers(healthCheckers ...api.HealthChecker) Option {
+	return func(o *serverOptions) {
+		o.healthCheckers = append(o.healthCheckers, healthCheckers...)
+	}
+}
+
+// WithLogger はアクセスログ等の出力先を指定する. 既定では捨てる
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *serverOptions) {
+		o.logger = logger
+	}
+}
+
+// NewServer は Server を生成する. 生成に失敗した場合は t.Fatal で終了する
+func NewServer(t testing.TB, options ...Option) *Server {
+	t.Helper()
+
+	opts := &serverOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	cfg := config.NewConfig()
+	for _, configure := range opts.configure {
+		configure(&cfg)
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	dbHandler, err := memory.NewHandler()
+	if err != nil {
+		t.Fatalf("testkit: failed to create db handler: %v", err)
+	}
+	opsHandler, err := operations.NewHandler(dbHandler)
+	if err != nil {
+		t.Fatalf("testkit: failed to create operations handler: %v", err)
+	}
+
+	sessionStore := memstore.New()
+	t.Cleanup(sessionStore.StopCleanup)
+	sessionManager, err := api.NewSessionManager(cfg.Session, sessionStore)
+	if err != nil {
+		t.Fatalf("testkit: failed to create session manager: %v", err)
+	}
+
+	router, err := api.NewRouter(cfg, opsHandler, sessionManager,
+		api.WithLogger(opts.logger),
+		api.WithHealthCheckers(opts.healthCheckers...),
+	)
+	if err != nil {
+		t.Fatalf("testkit: failed to create router: %v", err)
+	}
+
+	specRouter, err := newSpecRouter()
+	if err != nil {
+		t.Fatalf("testkit: failed to load openapi spec: %v", err)
+	}
+
+	s := &Server{
+		Router:     router,
+		DB:         dbHandler,
+		t:          t,
+		specRouter: specRouter,
+	}
+	s.Client, err = openapi.NewClientWithResponses(BaseURL, openapi.WithHTTPClient(s))
+	if err != nil {
+		t.Fatalf("testkit: failed to create client: %v", err)
+	}
+	return s
+}
+
+// newSpecRouter は埋め込まれた OpenAPI の定義からリクエストに対応する operation を引くルーターを生成する
+func newSpecRouter() (routers.Router, error) {
+
+	spec, err := openapi.GetSwagger()
+	if err != nil {
+		return nil, err
+	}
+	// 宛先のホストに関わらず照合する
+	spec.Servers = openapi3.Servers{{URL: BaseURL}}
+	if err := spec.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return gorillamux.NewRouter(spec)
+}
+
+// Do はリクエストをルーターで処理し, レスポンスを定義と照合する. openapi.HttpRequestDoer の実装
+func (p *Server) Do(req *http.Request) (*http.Response, error) {
+	p.t.Helper()
+
+	w := httptest.NewRecorder()
+	p.Router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := p.ValidateResponse(req, resp.StatusCode, resp.Header, body); err != nil {
+		p.t.Errorf("testkit: %s %s returned a response that does not match the openapi spec: %v\nstatus: %d\nbody: %s",
+			req.Method, req.URL.Path, err, resp.StatusCode, body)
+	}
+	return resp, nil
+}
+
+// ValidateResponse はリクエストに対するレスポンスが OpenAPI の定義に合っているかを確認する
+// 定義に無いパス/メソッド, 定義に無いステータスコード, スキーマに合わない本文はエラーにする
+func (p *Server) ValidateResponse(req *http.Request, status int, header http.Header, body []byte) error {
+
+	route, pathParams, err := p.specRouter.FindRoute(req)
+	if err != nil {
+		return err
+	}
+	return openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+		},
+		Status: status,
+		Header: header,
+		Body:   io.NopCloser(bytes.NewReader(body)),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true, // 定義に無いステータスコードはエラー
+			MultiError:            true,
+		},
+	})
+}
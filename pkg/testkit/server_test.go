@@ -0,0 +1,93 @@
+package testkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingTB は Errorf の呼び出しを記録し, テストを失敗させない
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (p *recordingTB) Errorf(format string, args ...any) {
+	p.errors = append(p.errors, fmt.Sprintf(format, args...))
+}
+
+func TestServer_ValidateResponse(t *testing.T) {
+	s := NewServer(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"declared status and valid body", http.MethodGet, "/health/liveness", http.StatusOK, `{"status":"available"}`, false},
+		{"undeclared status", http.MethodGet, "/health/liveness", http.StatusBadRequest, `{"status":400}`, true},
+		{"body does not match schema", http.MethodGet, "/health/liveness", http.StatusOK, `{"status":"unknown"}`, true},
+		{"declared problem details", http.MethodGet, "/users/" + "0197b0c8-0000-7000-8000-000000000000", http.StatusNotFound, `{"status":404}`, false},
+		{"undeclared path", http.MethodGet, "/no-such-path", http.StatusOK, `{}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, BaseURL+tt.path, nil)
+			header := http.Header{"Content-Type": []string{"application/json"}}
+			err := s.ValidateResponse(req, tt.status, header, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateResponse() error = %v; wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServer_Do_FailsOnSpecDrift(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	s := NewServer(tb)
+
+	// 定義に無い 400 を返すハンドラに差し替える
+	s.Router = gin.New()
+	s.Router.GET("/health/liveness", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": 400})
+	})
+
+	resp, err := s.Client.GetHealthLivenessWithResponse(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode() != http.StatusBadRequest {
+		t.Fatalf("status = %d; want 400", resp.StatusCode())
+	}
+	if len(tb.errors) != 1 {
+		t.Errorf("reported errors = %q; want 1 error for the undeclared status", tb.errors)
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	got, err := normalizeJSON([]byte(`{"type":"/x","trace_id":"abc","invalid_params":[{"name":"a","trace_id":"def"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "invalid_params": [
+    {
+      "name": "a",
+      "trace_id": "<trace_id>"
+    }
+  ],
+  "trace_id": "<trace_id>",
+  "type": "/x"
+}
+`
+	if string(got) != want {
+		t.Errorf("normalizeJSON() =\n%s\nwant:\n%s", got, want)
+	}
+}
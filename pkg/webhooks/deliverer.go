@@ -0,0 +1,200 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/db"
+	"github.com/aazw/go-base/pkg/events"
+	"github.com/aazw/go-base/pkg/logging"
+	"github.com/aazw/go-base/pkg/models"
+	"github.com/aazw/go-base/pkg/poll"
+)
+
+const instrumentationName = "github.com/aazw/go-base/pkg/webhooks"
+
+// 読み捨てるレスポンスボディの最大長
+const maxResponseBodySize = 64 << 10
+
+// DeliveryStore は Deliverer が配信を読み書きするためのインターフェース (db.Handler が満たす)
+type DeliveryStore interface {
+	ProcessWebhookDeliveries(ctx context.Context, limit int, lease time.Duration, policy models.RetryPolicy, maxConsecutiveFailures int, deliver func(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt) (int, error)
+}
+
+type DelivererConfig struct {
+	// 配信待ちを確認する間隔. 1回で BatchSize 件取り出せた場合は待たずに続けて処理し, 失敗が続く場合は間隔を空ける (poll.Run)
+	PollInterval time.Duration
+	BatchSize    int
+
+	// 1回の送信のタイムアウト
+	Timeout time.Duration
+
+	// 取り出した配信を他の deliverer から隠しておく時間. 結果を記録する前に停止した配信はこの後に再び送信する
+	// 1バッチを送信し終えるまでの時間 (BatchSize * Timeout) 以上にする
+	Lease time.Duration
+
+	RetryPolicy models.RetryPolicy
+
+	// この回数続けて失敗した webhook は自動的に無効にする
+	MaxConsecutiveFailures int
+
+	// 送信する URL の条件. 登録の後に条件を変えた場合に備えて送信の前にも確認する
+	URLPolicy URLPolicy
+}
+
+// Deliverer は配信待ちの webhook の配信を署名付きで送信する
+// 2xx 以外のレスポンス (リダイレクトを含む) や接続エラーは失敗として扱い, RetryPolicy に従って再試行する
+// 内部のネットワークに送信させられないように, リダイレクトは辿らず, 名前解決の後のアドレスがループバック/プライベート/リンクローカル等の場合は接続しない
+type Deliverer struct {
+	store  DeliveryStore
+	config DelivererConfig
+	client *http.Client
+	tracer trace.Tracer
+}
+
+func NewDeliverer(store DeliveryStore, config DelivererConfig) (*Deliverer, error) {
+	if store == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("webhook delivery store is required"),
+		)
+	}
+	if config.PollInterval <= 0 || config.BatchSize <= 0 || config.Timeout <= 0 || config.MaxConsecutiveFailures <= 0 ||
+		config.Lease < time.Duration(config.BatchSize)*config.Timeout {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessagef("invalid deliverer config: poll_interval=%s, batch_size=%d, timeout=%s, lease=%s, max_consecutive_failures=%d",
+				config.PollInterval, config.BatchSize, config.Timeout, config.Lease, config.MaxConsecutiveFailures),
+		)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// プロキシを経由すると接続先のアドレスを確認できない
+	transport.Proxy = nil
+	if !config.URLPolicy.AllowPrivateNetworks {
+		dialer := &net.Dialer{
+			Timeout:   config.Timeout,
+			KeepAlive: 30 * time.Second,
+			Control:   dialControl,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &Deliverer{
+		store:  store,
+		config: config,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		tracer: otel.Tracer(instrumentationName),
+	}, nil
+}
+
+// Run は ctx がキャンセルされるまで配信待ちを監視して送信し続ける
+func (d *Deliverer) Run(ctx context.Context) error {
+
+	logger := logging.FromContext(ctx).With("component", "webhook_deliverer")
+	logger.Info("webhook deliverer started")
+
+	poll.Run(ctx, d.config.PollInterval, d.config.BatchSize, d.RunOnce, func(err error, retryIn time.Duration) {
+		logger.Error("failed to process webhook deliveries", "retry_in", retryIn, "error", err)
+	})
+
+	logger.Info("webhook deliverer stopped")
+	return nil
+}
+
+// RunOnce は配信待ちから1バッチ分を送信する. 処理した件数を返す
+// 全てのテナントの配信を送信する
+func (d *Deliverer) RunOnce(ctx context.Context) (int, error) {
+	return d.store.ProcessWebhookDeliveries(db.WithCrossTenant(ctx), d.config.BatchSize, d.config.Lease, d.config.RetryPolicy, d.config.MaxConsecutiveFailures, d.deliver)
+}
+
+// deliver は1件の配信を送信し, その結果を返す
+func (d *Deliverer) deliver(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt {
+
+	// イベントを発生させたリクエストの trace に繋げる
+	var message events.Message
+	if err := json.Unmarshal(delivery.Payload, &message); err == nil && len(message.TraceContext) > 0 {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(message.TraceContext))
+	}
+	ctx, span := d.tracer.Start(ctx, "deliver "+string(delivery.EventType),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "webhook"),
+			attribute.String("messaging.operation.type", "send"),
+			attribute.String("messaging.message.id", delivery.ID.String()),
+			attribute.String("webhook.id", webhook.ID.String()),
+			attribute.String("event.type", string(delivery.EventType)),
+			attribute.Int("webhook.delivery.attempt", delivery.Attempts+1),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	attempt := &models.WebhookDeliveryAttempt{
+		AttemptedAt: start,
+	}
+	responseCode, err := d.send(ctx, delivery, webhook, start)
+	attempt.Duration = time.Since(start)
+	attempt.ResponseCode = responseCode
+	if responseCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", responseCode))
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return attempt
+}
+
+// send は署名付きで POST し, レスポンスのステータスコードを返す. レスポンスが無い場合は 0
+func (d *Deliverer) send(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook, now time.Time) (int, error) {
+
+	// 試行の記録 (配信履歴) に残すため, cerrors ではなく理由だけを返す
+	if err := d.config.URLPolicy.Validate(webhook.URL); err != nil {
+		return 0, errors.New("webhook url is not allowed")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goapp-webhooks/1.0")
+	req.Header.Set(HeaderDeliveryID, delivery.ID.String())
+	req.Header.Set(HeaderEventType, string(delivery.EventType))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, now, delivery.Payload))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodySize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,247 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// fakeDeliveryStore は deliveries を1回だけ deliver に渡し, 試行の結果を記録する
+type fakeDeliveryStore struct {
+	webhook    *models.Webhook
+	deliveries []*models.WebhookDelivery
+	attempts   []*models.WebhookDeliveryAttempt
+}
+
+func (s *fakeDeliveryStore) ProcessWebhookDeliveries(ctx context.Context, limit int, _ time.Duration, _ models.RetryPolicy, _ int, deliver func(ctx context.Context, delivery *models.WebhookDelivery, webhook *models.Webhook) *models.WebhookDeliveryAttempt) (int, error) {
+	n := 0
+	for len(s.deliveries) > 0 && n < limit {
+		delivery := s.deliveries[0]
+		s.deliveries = s.deliveries[1:]
+		s.attempts = append(s.attempts, deliver(ctx, delivery, s.webhook))
+		n++
+	}
+	return n, nil
+}
+
+func newTestDeliverer(t *testing.T, store DeliveryStore) *Deliverer {
+	t.Helper()
+	d, err := NewDeliverer(store, DelivererConfig{
+		PollInterval:           time.Second,
+		BatchSize:              10,
+		Timeout:                5 * time.Second,
+		Lease:                  time.Minute,
+		RetryPolicy:            models.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+		MaxConsecutiveFailures: 5,
+		// httptest のサーバ (http://127.0.0.1) に送信する
+		URLPolicy: URLPolicy{AllowHTTP: true, AllowPrivateNetworks: true},
+	})
+	if err != nil {
+		t.Fatalf("NewDeliverer() error = %v", err)
+	}
+	return d
+}
+
+func newTestDelivery(t *testing.T) *models.WebhookDelivery {
+	t.Helper()
+	payload, err := json.Marshal(map[string]any{"id": uuid.NewString(), "type": "user.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.WebhookDelivery{
+		ID:        uuid.New(),
+		EventID:   uuid.New(),
+		EventType: models.EventTypeUserCreated,
+		Payload:   payload,
+		Status:    models.WebhookDeliveryStatusPending,
+	}
+}
+
+func TestDeliverer_RunOnce_SignedDelivery(t *testing.T) {
+	delivery := newTestDelivery(t)
+
+	var verifyErr error
+	var gotDeliveryID, gotEventType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotDeliveryID = r.Header.Get(HeaderDeliveryID)
+		gotEventType = r.Header.Get(HeaderEventType)
+		verifyErr = Verify(testSecret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, 5*time.Minute, time.Now())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := &fakeDeliveryStore{
+		webhook:    &models.Webhook{ID: uuid.New(), URL: server.URL, Secret: testSecret, Enabled: true},
+		deliveries: []*models.WebhookDelivery{delivery},
+	}
+	n, err := newTestDeliverer(t, store).RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if n != 1 || len(store.attempts) != 1 {
+		t.Fatalf("RunOnce() = %d, attempts = %d, want 1", n, len(store.attempts))
+	}
+
+	if verifyErr != nil {
+		t.Errorf("receiver failed to verify signature: %v", verifyErr)
+	}
+	if gotDeliveryID != delivery.ID.String() {
+		t.Errorf("%s = %q, want %q", HeaderDeliveryID, gotDeliveryID, delivery.ID)
+	}
+	if gotEventType != string(models.EventTypeUserCreated) {
+		t.Errorf("%s = %q, want %q", HeaderEventType, gotEventType, models.EventTypeUserCreated)
+	}
+
+	attempt := store.attempts[0]
+	if !attempt.Succeeded() || attempt.ResponseCode != http.StatusNoContent {
+		t.Errorf("attempt = %+v, want succeeded with 204", attempt)
+	}
+}
+
+func TestDeliverer_RunOnce_Failures(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantCode int
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name: "client error",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusGone)
+			},
+			wantCode: http.StatusGone,
+		},
+		{
+			// リダイレクトは追わずに失敗として扱う
+			name: "redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			},
+			wantCode: http.StatusFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			store := &fakeDeliveryStore{
+				webhook:    &models.Webhook{ID: uuid.New(), URL: server.URL, Secret: testSecret, Enabled: true},
+				deliveries: []*models.WebhookDelivery{newTestDelivery(t)},
+			}
+			if _, err := newTestDeliverer(t, store).RunOnce(context.Background()); err != nil {
+				t.Fatalf("RunOnce() error = %v", err)
+			}
+
+			attempt := store.attempts[0]
+			if attempt.Succeeded() {
+				t.Fatalf("attempt succeeded, want failure")
+			}
+			if attempt.ResponseCode != tt.wantCode {
+				t.Errorf("ResponseCode = %d, want %d", attempt.ResponseCode, tt.wantCode)
+			}
+			if attempt.Error == "" {
+				t.Errorf("Error is empty, want a reason")
+			}
+		})
+	}
+}
+
+func TestDeliverer_RunOnce_ConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	store := &fakeDeliveryStore{
+		webhook:    &models.Webhook{ID: uuid.New(), URL: url, Secret: testSecret, Enabled: true},
+		deliveries: []*models.WebhookDelivery{newTestDelivery(t)},
+	}
+	if _, err := newTestDeliverer(t, store).RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+
+	attempt := store.attempts[0]
+	if attempt.Succeeded() || attempt.ResponseCode != 0 || attempt.Error == "" {
+		t.Errorf("attempt = %+v, want failure without response", attempt)
+	}
+}
+
+func TestDeliverer_PrivateDestination(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := &fakeDeliveryStore{
+		webhook:    &models.Webhook{ID: uuid.New(), URL: server.URL, Secret: testSecret, Enabled: true},
+		deliveries: []*models.WebhookDelivery{newTestDelivery(t)},
+	}
+	d, err := NewDeliverer(store, DelivererConfig{
+		PollInterval:           time.Second,
+		BatchSize:              10,
+		Timeout:                5 * time.Second,
+		Lease:                  time.Minute,
+		RetryPolicy:            models.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+		MaxConsecutiveFailures: 5,
+		URLPolicy:              URLPolicy{AllowHTTP: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IP アドレスの URL は送信しない
+	if _, err := d.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if attempt := store.attempts[0]; attempt.Succeeded() || attempt.Error == "" {
+		t.Errorf("attempt = %+v, want failure", attempt)
+	}
+
+	// 名前解決の後のアドレスがループバックの場合も接続しない
+	resp, err := d.client.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Errorf("GET %s error = nil, want the destination to be refused", server.URL)
+	}
+	if called {
+		t.Error("webhook was delivered to a loopback address")
+	}
+}
+
+func TestNewDeliverer_InvalidConfig(t *testing.T) {
+	if _, err := NewDeliverer(nil, DelivererConfig{}); err == nil {
+		t.Error("NewDeliverer(nil) error = nil, want error")
+	}
+	if _, err := NewDeliverer(&fakeDeliveryStore{}, DelivererConfig{}); err == nil {
+		t.Error("NewDeliverer(zero config) error = nil, want error")
+	}
+	// リースが1バッチの送信にかかる時間より短いと, 送信中の配信を他の deliverer が取り出してしまう
+	if _, err := NewDeliverer(&fakeDeliveryStore{}, DelivererConfig{
+		PollInterval:           time.Second,
+		BatchSize:              10,
+		Timeout:                5 * time.Second,
+		Lease:                  49 * time.Second,
+		MaxConsecutiveFailures: 5,
+	}); err == nil {
+		t.Error("NewDeliverer(short lease) error = nil, want error")
+	}
+}
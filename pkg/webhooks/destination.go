@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// 配信先として受け付けないホスト名 (の接尾辞). 組織内の名前解決で内部のホストを指すことが多い
+var internalHostSuffixes = []string{".localhost", ".local", ".localdomain", ".internal", ".home.arpa"}
+
+// IsPrivate/IsLoopback 等で判定できない, 配信先として接続しないアドレスの範囲
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // Shared Address Space (CGNAT, クラウドのメタデータ等)
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF Protocol Assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64 (IPv4 のアドレスを埋め込める)
+	netip.MustParsePrefix("2002::/16"),     // 6to4 (IPv4 のアドレスを埋め込める)
+}
+
+// URLPolicy は webhook の配信先として受け付ける URL の条件
+type URLPolicy struct {
+	// http の URL も受け付ける. 開発環境向け
+	AllowHTTP bool
+
+	// IP アドレスやループバック/プライベートネットワークのホストも受け付け, 接続する. 開発環境とテスト向け
+	AllowPrivateNetworks bool
+}
+
+// Validate は rawURL を webhook の配信先として登録できるかを確認する. 登録できない場合は ErrValidation
+// https (AllowHTTP の場合は http も) のみ受け付け, IP アドレスや内部のホスト名 (localhost, .internal 等) は受け付けない
+// 登録の後に DNS の向き先を変えられる場合に備えて, 送信の際にも接続先のアドレスを確認する (dialControl)
+func (p URLPolicy) Validate(rawURL string) error {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return cerrors.ErrValidation.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessage("webhook url is malformed"),
+		)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && p.AllowHTTP) {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessagef("webhook url must use https: %s", u.Scheme),
+		)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessage("webhook url has no host"),
+		)
+	}
+	if p.AllowPrivateNetworks {
+		return nil
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessagef("webhook url must not be an ip address: %s", host),
+		)
+	}
+	if host == "localhost" || !strings.Contains(host, ".") || slices.ContainsFunc(internalHostSuffixes, func(suffix string) bool {
+		return strings.HasSuffix(host, suffix)
+	}) {
+		return cerrors.ErrValidation.New(
+			cerrors.WithMessagef("webhook url must not be an internal host: %s", host),
+		)
+	}
+	return nil
+}
+
+// dialControl は名前解決の後の接続先のアドレスを確認し, 配信先として接続しないアドレスへの接続を拒否する (net.Dialer.Control)
+func dialControl(network string, address string, _ syscall.RawConn) error {
+
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if blockedAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook destination %s is not allowed", addrPort.Addr())
+	}
+	return nil
+}
+
+// blockedAddr は配信先として接続しないアドレス (ループバック, プライベート, リンクローカル等) かを返す
+func blockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return true
+	}
+	return slices.ContainsFunc(blockedPrefixes, func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	})
+}
@@ -0,0 +1,66 @@
+package webhooks
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestURLPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  URLPolicy
+		url     string
+		wantErr bool
+	}{
+		{name: "https", url: "https://hooks.example.com/goapp"},
+		{name: "https with port", url: "https://hooks.example.com:8443/goapp"},
+		{name: "http", url: "http://hooks.example.com/goapp", wantErr: true},
+		{name: "http allowed", policy: URLPolicy{AllowHTTP: true}, url: "http://hooks.example.com/goapp"},
+		{name: "other scheme", policy: URLPolicy{AllowHTTP: true}, url: "ftp://hooks.example.com/goapp", wantErr: true},
+		{name: "no host", url: "https:///goapp", wantErr: true},
+		{name: "ipv4", url: "https://203.0.113.10/goapp", wantErr: true},
+		{name: "ipv6", url: "https://[2001:db8::1]/goapp", wantErr: true},
+		{name: "localhost", url: "https://localhost/goapp", wantErr: true},
+		{name: "localhost trailing dot", url: "https://LOCALHOST./goapp", wantErr: true},
+		{name: "single label", url: "https://postgres/goapp", wantErr: true},
+		{name: "internal", url: "https://metadata.google.internal/goapp", wantErr: true},
+		{name: "mdns", url: "https://printer.local/goapp", wantErr: true},
+		{name: "private allowed", policy: URLPolicy{AllowHTTP: true, AllowPrivateNetworks: true}, url: "http://127.0.0.1:8080/goapp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.215.14", want: false},
+		{addr: "2606:2800:21f:cb07:6820:80da:af6b:8b2c", want: false},
+		{addr: "127.0.0.1", want: true},
+		{addr: "::1", want: true},
+		{addr: "0.0.0.0", want: true},
+		{addr: "10.0.0.1", want: true},
+		{addr: "172.16.0.1", want: true},
+		{addr: "192.168.1.1", want: true},
+		{addr: "169.254.169.254", want: true},
+		{addr: "100.100.100.200", want: true},
+		{addr: "fd00::1", want: true},
+		{addr: "fe80::1", want: true},
+		{addr: "::ffff:127.0.0.1", want: true},
+		{addr: "64:ff9b::a9fe:a9fe", want: true},
+		{addr: "224.0.0.1", want: true},
+	}
+	for _, tt := range tests {
+		if got := blockedAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("blockedAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
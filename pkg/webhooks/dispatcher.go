@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+	"github.com/aazw/go-base/pkg/events"
+	"github.com/aazw/go-base/pkg/models"
+)
+
+// EnqueueStore は Dispatcher が配信を登録するためのインターフェース (db.Handler が満たす)
+type EnqueueStore interface {
+	EnqueueWebhookDeliveries(ctx context.Context, event *models.Event, payload []byte) (int, error)
+}
+
+// Dispatcher は outbox の relay から受け取ったイベントを, 配信対象の webhook 毎の配信として登録する events.Sink
+// 実際の送信は Deliverer が行う
+type Dispatcher struct {
+	store EnqueueStore
+}
+
+func NewDispatcher(store EnqueueStore) (*Dispatcher, error) {
+	if store == nil {
+		return nil, cerrors.ErrValidation.New(
+			cerrors.WithMessage("webhook enqueue store is required"),
+		)
+	}
+	return &Dispatcher{store: store}, nil
+}
+
+func (d *Dispatcher) Name() string {
+	return "webhooks"
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event *models.Event) error {
+
+	payload, err := json.Marshal(events.NewMessage(event))
+	if err != nil {
+		return cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("failed to marshal event %s", event.ID),
+		)
+	}
+	_, err = d.store.EnqueueWebhookDeliveries(ctx, event, payload)
+	return err
+}
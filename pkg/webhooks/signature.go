@@ -0,0 +1,75 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+// 配信のリクエストに付けるヘッダ
+const (
+	HeaderDeliveryID = "X-Webhook-Id"        // 配信の ID. 再送時も同じ
+	HeaderEventType  = "X-Webhook-Event"     // イベントの種類 (user.created 等)
+	HeaderTimestamp  = "X-Webhook-Timestamp" // 署名した時刻 (Unix 秒)
+	HeaderSignature  = "X-Webhook-Signature" // v1=<hex(HMAC-SHA256(secret, timestamp + "." + body))>
+)
+
+const signatureVersion = "v1"
+
+// Sign は timestamp と body に対する署名を HeaderSignature の形式で返す
+// 署名対象に timestamp を含めることで, 受信側が古いリクエストの再送 (リプレイ) を拒否できる
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return signatureVersion + "=" + hex.EncodeToString(computeMAC(secret, strconv.FormatInt(timestamp.Unix(), 10), body))
+}
+
+// Verify は受信側で署名を検証する
+// signatureHeader はカンマ区切りで複数の署名を含んでもよく (鍵のローテーション用), いずれかが一致すれば成功とする
+// tolerance が 0 より大きい場合, now との差が tolerance を超える timestamp は拒否する
+func Verify(secret string, timestampHeader string, signatureHeader string, body []byte, tolerance time.Duration, now time.Time) error {
+
+	unix, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return cerrors.ErrInvalidFormat.New(
+			cerrors.WithCause(err),
+			cerrors.WithMessagef("invalid %s header", HeaderTimestamp),
+		)
+	}
+	if tolerance > 0 {
+		if diff := now.Sub(time.Unix(unix, 0)); diff > tolerance || diff < -tolerance {
+			return cerrors.ErrTokenExpired.New(
+				cerrors.WithMessagef("webhook timestamp is outside the tolerance: %s", diff),
+			)
+		}
+	}
+
+	expected := computeMAC(secret, timestampHeader, body)
+	for _, sig := range strings.Split(signatureHeader, ",") {
+		version, value, ok := strings.Cut(strings.TrimSpace(sig), "=")
+		if !ok || version != signatureVersion {
+			continue
+		}
+		mac, err := hex.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(mac, expected) {
+			return nil
+		}
+	}
+	return cerrors.ErrTokenInvalid.New(
+		cerrors.WithMessage("webhook signature mismatch"),
+	)
+}
+
+func computeMAC(secret string, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,114 @@
+package webhooks
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aazw/go-base/pkg/cerrors"
+)
+
+const testSecret = "0123456789abcdef"
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"1","type":"user.created"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := Sign(testSecret, now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		now       time.Time
+		wantCode  string // 空の場合は成功
+	}{
+		{
+			name:      "valid",
+			secret:    testSecret,
+			timestamp: timestamp,
+			signature: signature,
+			body:      body,
+			now:       now.Add(time.Minute),
+		},
+		{
+			name:      "multiple signatures",
+			secret:    testSecret,
+			timestamp: timestamp,
+			signature: "v1=deadbeef, " + signature,
+			body:      body,
+			now:       now,
+		},
+		{
+			name:      "tampered body",
+			secret:    testSecret,
+			timestamp: timestamp,
+			signature: signature,
+			body:      []byte(`{"id":"2","type":"user.created"}`),
+			now:       now,
+			wantCode:  codeOf(cerrors.ErrTokenInvalid.New()),
+		},
+		{
+			name:      "wrong secret",
+			secret:    "fedcba9876543210",
+			timestamp: timestamp,
+			signature: signature,
+			body:      body,
+			now:       now,
+			wantCode:  codeOf(cerrors.ErrTokenInvalid.New()),
+		},
+		{
+			name:      "tampered timestamp",
+			secret:    testSecret,
+			timestamp: strconv.FormatInt(now.Unix()+1, 10),
+			signature: signature,
+			body:      body,
+			now:       now,
+			wantCode:  codeOf(cerrors.ErrTokenInvalid.New()),
+		},
+		{
+			name:      "expired",
+			secret:    testSecret,
+			timestamp: timestamp,
+			signature: signature,
+			body:      body,
+			now:       now.Add(10 * time.Minute),
+			wantCode:  codeOf(cerrors.ErrTokenExpired.New()),
+		},
+		{
+			name:      "invalid timestamp",
+			secret:    testSecret,
+			timestamp: "abc",
+			signature: signature,
+			body:      body,
+			now:       now,
+			wantCode:  codeOf(cerrors.ErrInvalidFormat.New()),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.timestamp, tt.signature, tt.body, 5*time.Minute, tt.now)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Verify() error = %v, want nil", err)
+				}
+				return
+			}
+			if got := codeOf(err); got != tt.wantCode {
+				t.Errorf("Verify() error code = %q, want %q (err=%v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func codeOf(err error) string {
+	var cerr *cerrors.CustomError
+	if errors.As(err, &cerr) {
+		return cerr.Code()
+	}
+	return ""
+}
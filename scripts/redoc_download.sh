@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# move to project root
+SCRIPT_DIR=$(cd -- "$(dirname -- "${BASH_SOURCE[0]}")" &>/dev/null && pwd)
+cd ${SCRIPT_DIR}/..
+
+# redoc
+# https://github.com/Redocly/redoc
+# API ドキュメント (/docs) で使う redoc.standalone.js を取得し, バイナリに埋め込む (CDN は使わない)
+REDOC_VERSION=2.1.5
+
+curl -fsSL "https://registry.npmjs.org/redoc/-/redoc-${REDOC_VERSION}.tgz" |
+  tar -xzO package/bundles/redoc.standalone.js >pkg/api/docs/redoc.standalone.js